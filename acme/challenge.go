@@ -0,0 +1,138 @@
+// Package acme serves ACME HTTP-01 challenge tokens for nginx to proxy to
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// ChallengePath is the URL prefix ACME servers use for HTTP-01 validation
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// tokenPattern matches the base64url alphabet used by ACME tokens
+var tokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ChallengeServer answers HTTP-01 challenges from memory or from a webroot directory
+// The webroot layout matches certbot/lego --webroot: <webroot>/.well-known/acme-challenge/<token>
+type ChallengeServer struct {
+	addr    string
+	webroot string
+	log     *lgr.Logger
+
+	mu     sync.RWMutex
+	tokens map[string]string
+	srv    *http.Server
+}
+
+// NewChallengeServer creates a new challenge responder listening on addr
+func NewChallengeServer(addr, webroot string, log *lgr.Logger) *ChallengeServer {
+	return &ChallengeServer{
+		addr:    addr,
+		webroot: webroot,
+		log:     log,
+		tokens:  make(map[string]string),
+	}
+}
+
+// SetToken registers a key authorization for a token
+func (s *ChallengeServer) SetToken(token, keyAuth string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = keyAuth
+}
+
+// DeleteToken removes a previously registered token
+func (s *ChallengeServer) DeleteToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+// Start begins serving challenges in the background
+func (s *ChallengeServer) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(ChallengePath, s)
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Logf("ERROR [ACME] challenge server failed error=%q", err)
+		}
+	}()
+
+	s.log.Logf("INFO [ACME] challenge responder listening addr=%s webroot=%q", s.addr, s.webroot)
+	return nil
+}
+
+// Close stops the challenge server
+func (s *ChallengeServer) Close(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("challenge server shutdown failed: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP answers a single challenge request
+func (s *ChallengeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, ChallengePath)
+	if !tokenPattern.MatchString(token) {
+		http.NotFound(w, r)
+		return
+	}
+
+	keyAuth, ok := s.lookup(token)
+	if !ok {
+		s.log.Logf("WARN [ACME] unknown challenge token=%s host=%s", token, r.Host)
+		http.NotFound(w, r)
+		return
+	}
+
+	s.log.Logf("INFO [ACME] answered challenge token=%s host=%s", token, r.Host)
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(keyAuth)) //nolint:errcheck // client write errors are not actionable
+}
+
+// lookup finds a token in memory first, then in the webroot
+func (s *ChallengeServer) lookup(token string) (string, bool) {
+	s.mu.RLock()
+	keyAuth, ok := s.tokens[token]
+	s.mu.RUnlock()
+	if ok {
+		return keyAuth, true
+	}
+
+	if s.webroot == "" {
+		return "", false
+	}
+
+	// token is validated against tokenPattern, so it cannot escape the webroot
+	// #nosec G304 -- path is built from the configured webroot and a validated token
+	data, err := os.ReadFile(filepath.Join(s.webroot, ".well-known", "acme-challenge", token))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
@@ -0,0 +1,60 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestChallengeServer(t *testing.T) {
+	webroot := t.TempDir()
+	dir := filepath.Join(webroot, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file-token"), []byte("file-token.keyauth\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	s := NewChallengeServer("127.0.0.1:0", webroot, lgr.New())
+	s.SetToken("mem-token", "mem-token.keyauth")
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "token from memory", path: ChallengePath + "mem-token", wantCode: http.StatusOK, wantBody: "mem-token.keyauth"},
+		{name: "token from webroot", path: ChallengePath + "file-token", wantCode: http.StatusOK, wantBody: "file-token.keyauth"},
+		{name: "unknown token", path: ChallengePath + "missing", wantCode: http.StatusNotFound},
+		{name: "path traversal rejected", path: ChallengePath + "..%2F..%2Fetc%2Fpasswd", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, http.NoBody))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("deleted token is no longer served", func(t *testing.T) {
+		s.DeleteToken("mem-token")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ChallengePath+"mem-token", http.NoBody))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+}
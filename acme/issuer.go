@@ -0,0 +1,474 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"golang.org/x/crypto/acme"
+)
+
+// ACME directories of Let's Encrypt
+const (
+	DirectoryProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	DirectoryStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// DefaultCertsDir is where the account key and issued certificates are stored
+const DefaultCertsDir = "/etc/nginx/proxy-certs"
+
+const (
+	renewBefore   = 30 * 24 * time.Hour // renew certificates expiring within this window
+	checkInterval = 12 * time.Hour      // renewal check without route changes
+	retryAfter    = time.Hour           // failed hostnames are retried after this, to stay below rate limits
+	issueTimeout  = 2 * time.Minute     // per certificate, including challenge validation
+)
+
+// KeyType is the private key algorithm of issued certificates
+type KeyType string
+
+// supported certificate key types
+const (
+	KeyECDSA256 KeyType = "ecdsa256"
+	KeyECDSA384 KeyType = "ecdsa384"
+	KeyRSA2048  KeyType = "rsa2048"
+	KeyRSA4096  KeyType = "rsa4096"
+)
+
+// ParseKeyType parses a key type, empty is ecdsa256
+func ParseKeyType(s string) (KeyType, error) {
+	switch kt := KeyType(strings.ToLower(strings.TrimSpace(s))); kt {
+	case "":
+		return KeyECDSA256, nil
+	case KeyECDSA256, KeyECDSA384, KeyRSA2048, KeyRSA4096:
+		return kt, nil
+	default:
+		return "", fmt.Errorf("invalid ACME key type %q, expected ecdsa256, ecdsa384, rsa2048 or rsa4096", s)
+	}
+}
+
+// ResolveDirectory maps production and staging to the Let's Encrypt directories,
+// other values must be https:// directory URLs of another CA
+func ResolveDirectory(s string) (string, error) {
+	switch s = strings.TrimSpace(s); {
+	case s == "production":
+		return DirectoryProduction, nil
+	case s == "staging":
+		return DirectoryStaging, nil
+	case strings.HasPrefix(s, "https://"):
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid ACME directory %q, expected production, staging or an https:// URL", s)
+	}
+}
+
+// IssuerConfig holds the ACME account and issuance settings
+type IssuerConfig struct {
+	Directory string  // directory URL, see ResolveDirectory
+	Email     string  // account contact for expiry notices, may be empty
+	KeyType   KeyType // certificate key algorithm
+	Dir       string  // account key and certificates, <hostname>.crt and <hostname>.key
+}
+
+// Issuer obtains and renews certificates with HTTP-01 challenges answered by a ChallengeServer
+type Issuer struct {
+	cfg        IssuerConfig
+	client     *acme.Client
+	challenges *ChallengeServer
+	log        *lgr.Logger
+
+	mu         sync.Mutex
+	hostnames  []string
+	failed     map[string]time.Time // hostname -> last failed attempt
+	registered bool
+	wake       chan struct{}
+}
+
+// NewIssuer creates an issuer, loading the account key from the certs dir or creating one
+func NewIssuer(cfg IssuerConfig, challenges *ChallengeServer, log *lgr.Logger) (*Issuer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create certs dir: %w", err)
+	}
+	key, err := accountKey(filepath.Join(cfg.Dir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		cfg:        cfg,
+		client:     &acme.Client{Key: key, DirectoryURL: cfg.Directory, UserAgent: "proxy-nginx"},
+		challenges: challenges,
+		log:        log,
+		failed:     make(map[string]time.Time),
+		wake:       make(chan struct{}, 1),
+	}, nil
+}
+
+// Request sets the hostnames certificates are kept for and wakes the issuer
+func (i *Issuer) Request(hostnames []string) {
+	i.mu.Lock()
+	i.hostnames = hostnames
+	i.mu.Unlock()
+
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run issues and renews certificates until ctx is cancelled
+// issued is called after new certificates were written, e.g. to regenerate configs
+func (i *Issuer) Run(ctx context.Context, issued func()) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.wake:
+		case <-ticker.C:
+		}
+		if n := i.ensure(ctx); n > 0 {
+			i.log.Logf("INFO [ACME] certificates issued count=%d", n)
+			issued()
+		}
+	}
+}
+
+// ensure obtains missing and expiring certificates, failures are logged and retried later
+func (i *Issuer) ensure(ctx context.Context) int {
+	i.mu.Lock()
+	hostnames := i.hostnames
+	i.mu.Unlock()
+
+	issued := 0
+	for _, hostname := range hostnames {
+		if ctx.Err() != nil {
+			return issued
+		}
+		if !i.due(hostname) {
+			continue
+		}
+		if err := i.obtain(ctx, hostname); err != nil {
+			i.log.Logf("ERROR [ACME] issuance failed host=%s retry_in=%s error=%q", hostname, retryAfter, err)
+			i.mu.Lock()
+			i.failed[hostname] = time.Now()
+			i.mu.Unlock()
+			continue
+		}
+		i.mu.Lock()
+		delete(i.failed, hostname)
+		i.mu.Unlock()
+		issued++
+	}
+	return issued
+}
+
+// due reports whether hostname needs a certificate and did not fail recently
+func (i *Issuer) due(hostname string) bool {
+	i.mu.Lock()
+	last, failed := i.failed[hostname]
+	i.mu.Unlock()
+	if failed && time.Since(last) < retryAfter {
+		return false
+	}
+
+	certPath, _ := CertDir(i.cfg.Dir).paths(hostname)
+	cert, err := readCert(certPath)
+	if err != nil {
+		return true
+	}
+	if reason := i.mismatch(hostname, cert); reason != "" {
+		i.log.Logf("INFO [ACME] reissuing certificate host=%s reason=%q", hostname, reason)
+		return true
+	}
+	return time.Until(cert.NotAfter) < renewBefore
+}
+
+// mismatch reports why a certificate does not match the configured directory and key type,
+// empty if it does
+// Certificates issued before the directory was recorded are checked by the Let's Encrypt
+// staging issuer name instead
+func (i *Issuer) mismatch(hostname string, cert *x509.Certificate) string {
+	if kt := certKeyType(cert); kt != i.cfg.KeyType {
+		return fmt.Sprintf("key type %s, configured %s", kt, i.cfg.KeyType)
+	}
+	// #nosec G304 -- path is inside the configured certs dir
+	directory, err := os.ReadFile(CertDir(i.cfg.Dir).directoryPath(hostname))
+	switch {
+	case err == nil && strings.TrimSpace(string(directory)) != i.cfg.Directory:
+		return fmt.Sprintf("issued by %s, configured %s", strings.TrimSpace(string(directory)), i.cfg.Directory)
+	case err != nil && strings.HasPrefix(cert.Issuer.CommonName, "(STAGING)") && i.cfg.Directory != DirectoryStaging:
+		return fmt.Sprintf("issued by %s, configured %s", DirectoryStaging, i.cfg.Directory)
+	}
+	return ""
+}
+
+// obtain orders a certificate for hostname and writes it with its key
+func (i *Issuer) obtain(ctx context.Context, hostname string) error {
+	ctx, cancel := context.WithTimeout(ctx, issueTimeout)
+	defer cancel()
+
+	if err := i.register(ctx); err != nil {
+		return err
+	}
+
+	i.log.Logf("INFO [ACME] ordering certificate host=%s directory=%s key_type=%s", hostname, i.cfg.Directory, i.cfg.KeyType)
+	order, err := i.client.AuthorizeOrder(ctx, acme.DomainIDs(hostname))
+	if err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := i.authorize(ctx, url); err != nil {
+			return err
+		}
+	}
+	if order, err = i.client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("order not ready: %w", err)
+	}
+
+	key, err := newKey(i.cfg.KeyType)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostname},
+		DNSNames: []string{hostname},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+	chain, _, err := i.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize failed: %w", err)
+	}
+
+	return i.write(hostname, key, chain)
+}
+
+// authorize answers the HTTP-01 challenge of an authorization and waits for validation
+func (i *Issuer) authorize(ctx context.Context, url string) error {
+	authz, err := i.client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	keyAuth, err := i.client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("failed to build challenge response: %w", err)
+	}
+	i.challenges.SetToken(challenge.Token, keyAuth)
+	defer i.challenges.DeleteToken(challenge.Token)
+
+	if _, err := i.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("challenge not accepted: %w", err)
+	}
+	if _, err := i.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("challenge validation failed: %w", err)
+	}
+	return nil
+}
+
+// register creates the ACME account on first use, an existing account is reused
+func (i *Issuer) register(ctx context.Context) error {
+	if i.registered {
+		return nil
+	}
+
+	account := &acme.Account{}
+	if i.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + i.cfg.Email}
+	}
+	_, err := i.client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("account registration failed: %w", err)
+	}
+	i.registered = true
+	i.log.Logf("INFO [ACME] account ready directory=%s email=%q", i.cfg.Directory, i.cfg.Email)
+	return nil
+}
+
+// write stores the key before the certificate, CertDir only reports complete pairs
+func (i *Issuer) write(hostname string, key crypto.Signer, chain [][]byte) error {
+	certPath, keyPath := CertDir(i.cfg.Dir).paths(hostname)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	if err := writeFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return err
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := writeFile(certPath, certPEM); err != nil {
+		return err
+	}
+	if err := writeFile(CertDir(i.cfg.Dir).directoryPath(hostname), []byte(i.cfg.Directory+"\n")); err != nil {
+		return err
+	}
+
+	i.log.Logf("INFO [ACME] certificate written host=%s path=%s", hostname, certPath)
+	return nil
+}
+
+// CertDir is the directory of issued certificates, <hostname>.crt and <hostname>.key
+type CertDir string
+
+// CertFiles returns the certificate and key files issued for hostname
+func (d CertDir) CertFiles(hostname string) (cert, key string, ok bool) {
+	cert, key = d.paths(hostname)
+	if _, err := os.Stat(cert); err != nil {
+		return "", "", false
+	}
+	if _, err := os.Stat(key); err != nil {
+		return "", "", false
+	}
+	return cert, key, true
+}
+
+func (d CertDir) paths(hostname string) (cert, key string) {
+	return filepath.Join(string(d), hostname+".crt"), filepath.Join(string(d), hostname+".key")
+}
+
+// directoryPath is the file recording the ACME directory a certificate was issued by
+func (d CertDir) directoryPath(hostname string) string {
+	return filepath.Join(string(d), hostname+".directory")
+}
+
+// accountKey loads the ECDSA account key from path, creating it on first start
+func accountKey(path string) (crypto.Signer, error) {
+	// #nosec G304 -- path is inside the configured certs dir
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid account key %s", path)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account key %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode account key: %w", err)
+	}
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newKey generates a certificate private key
+func newKey(kt KeyType) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch kt {
+	case KeyECDSA384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", kt, err)
+	}
+	return key, nil
+}
+
+// readCert parses the first certificate in a PEM file
+func readCert(path string) (*x509.Certificate, error) {
+	// #nosec G304 -- path is inside the configured certs dir
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate %s: %w", path, err)
+	}
+	return cert, nil
+}
+
+// certKeyType returns the key type of a certificate, empty for keys newKey does not generate
+func certKeyType(cert *x509.Certificate) KeyType {
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return KeyECDSA256
+		case elliptic.P384():
+			return KeyECDSA384
+		}
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return KeyRSA2048
+		case 4096:
+			return KeyRSA4096
+		}
+	}
+	return ""
+}
+
+// writeFile writes data with owner-only permissions via a temp file and rename
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
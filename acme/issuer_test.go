@@ -0,0 +1,152 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestParseKeyType(t *testing.T) {
+	for input, want := range map[string]KeyType{"": KeyECDSA256, "ECDSA384": KeyECDSA384, " rsa2048 ": KeyRSA2048} {
+		got, err := ParseKeyType(input)
+		if err != nil || got != want {
+			t.Errorf("ParseKeyType(%q) = %s, %v, want %s", input, got, err, want)
+		}
+	}
+	if _, err := ParseKeyType("ed25519"); err == nil {
+		t.Error("ParseKeyType(ed25519) expected error")
+	}
+}
+
+func TestResolveDirectory(t *testing.T) {
+	tests := map[string]string{
+		"production":                       DirectoryProduction,
+		"staging":                          DirectoryStaging,
+		"https://ca.internal/acme/dir":     "https://ca.internal/acme/dir",
+		"http://ca.internal/acme/dir":      "",
+		"acme-v02.api.letsencrypt.org/dir": "",
+	}
+	for input, want := range tests {
+		got, err := ResolveDirectory(input)
+		if want == "" {
+			if err == nil {
+				t.Errorf("ResolveDirectory(%q) expected error", input)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("ResolveDirectory(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestIssuerDue(t *testing.T) {
+	dir := t.TempDir()
+	issuer, err := NewIssuer(IssuerConfig{Directory: DirectoryStaging, KeyType: KeyECDSA256, Dir: dir}, nil, lgr.New())
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+
+	// the account key is kept across restarts
+	account, err := os.ReadFile(filepath.Join(dir, "account.key"))
+	if err != nil {
+		t.Fatalf("account key not written: %v", err)
+	}
+	if _, err := NewIssuer(IssuerConfig{Dir: dir}, nil, lgr.New()); err != nil {
+		t.Fatalf("NewIssuer() with existing account key error = %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(dir, "account.key")); string(again) != string(account) {
+		t.Error("account key was replaced")
+	}
+
+	writeCert(t, issuer, "fresh.example.com", 90*24*time.Hour)
+	writeCert(t, issuer, "expiring.example.com", 10*24*time.Hour)
+	issuer.failed["failed.example.com"] = time.Now()
+
+	tests := map[string]bool{
+		"fresh.example.com":    false,
+		"expiring.example.com": true,
+		"missing.example.com":  true,
+		"failed.example.com":   false,
+	}
+	for hostname, want := range tests {
+		if got := issuer.due(hostname); got != want {
+			t.Errorf("due(%s) = %t, want %t", hostname, got, want)
+		}
+	}
+
+	// a changed directory or key type reissues fresh certificates
+	for name, cfg := range map[string]IssuerConfig{
+		"directory": {Directory: DirectoryProduction, KeyType: KeyECDSA256, Dir: dir},
+		"key type":  {Directory: DirectoryStaging, KeyType: KeyRSA2048, Dir: dir},
+	} {
+		changed, err := NewIssuer(cfg, nil, lgr.New())
+		if err != nil {
+			t.Fatalf("NewIssuer() error = %v", err)
+		}
+		if !changed.due("fresh.example.com") {
+			t.Errorf("%s changed: fresh certificate should be due", name)
+		}
+	}
+
+	// certificates without a recorded directory are matched by the staging issuer name
+	if err := os.Remove(filepath.Join(dir, "fresh.example.com.directory")); err != nil {
+		t.Fatal(err)
+	}
+	production, err := NewIssuer(IssuerConfig{Directory: DirectoryProduction, KeyType: KeyECDSA256, Dir: dir}, nil, lgr.New())
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+	if production.due("fresh.example.com") {
+		t.Error("unrecorded certificate of another issuer should not be due")
+	}
+	writeCertBy(t, issuer, "staged.example.com", "(STAGING) Ersatz Edamame E1", 90*24*time.Hour)
+	if err := os.Remove(filepath.Join(dir, "staged.example.com.directory")); err != nil {
+		t.Fatal(err)
+	}
+	if !production.due("staged.example.com") {
+		t.Error("unrecorded staging certificate should be due with the production directory")
+	}
+
+	if _, _, ok := CertDir(dir).CertFiles("fresh.example.com"); !ok {
+		t.Error("CertFiles(fresh.example.com) not found")
+	}
+	if _, _, ok := CertDir(dir).CertFiles("missing.example.com"); ok {
+		t.Error("CertFiles(missing.example.com) found")
+	}
+}
+
+// writeCert stores a self-signed certificate for hostname valid for validFor
+func writeCert(t *testing.T, issuer *Issuer, hostname string, validFor time.Duration) {
+	t.Helper()
+	writeCertBy(t, issuer, hostname, hostname, validFor)
+}
+
+// writeCertBy stores a certificate for hostname named as issued by issuerName
+func writeCertBy(t *testing.T, issuer *Issuer, hostname, issuerName string, validFor time.Duration) {
+	t.Helper()
+	key, err := newKey(KeyECDSA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: issuerName}}, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issuer.write(hostname, key, [][]byte{der}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,1169 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: admin/adminpb/admin.proto
+
+package adminpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ConfigKind selects one of the generated configs
+type ConfigKind int32
+
+const (
+	ConfigKind_CONFIG_KIND_UNSPECIFIED ConfigKind = 0
+	// nginx stream module config (TCP/UDP)
+	ConfigKind_CONFIG_KIND_STREAM ConfigKind = 1
+	// nginx HTTP module config
+	ConfigKind_CONFIG_KIND_HTTP ConfigKind = 2
+)
+
+// Enum value maps for ConfigKind.
+var (
+	ConfigKind_name = map[int32]string{
+		0: "CONFIG_KIND_UNSPECIFIED",
+		1: "CONFIG_KIND_STREAM",
+		2: "CONFIG_KIND_HTTP",
+	}
+	ConfigKind_value = map[string]int32{
+		"CONFIG_KIND_UNSPECIFIED": 0,
+		"CONFIG_KIND_STREAM":      1,
+		"CONFIG_KIND_HTTP":        2,
+	}
+)
+
+func (x ConfigKind) Enum() *ConfigKind {
+	p := new(ConfigKind)
+	*p = x
+	return p
+}
+
+func (x ConfigKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConfigKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_admin_adminpb_admin_proto_enumTypes[0].Descriptor()
+}
+
+func (ConfigKind) Type() protoreflect.EnumType {
+	return &file_admin_adminpb_admin_proto_enumTypes[0]
+}
+
+func (x ConfigKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConfigKind.Descriptor instead.
+func (ConfigKind) EnumDescriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{0}
+}
+
+// ListRoutesRequest is the request of Admin.ListRoutes
+type ListRoutesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRoutesRequest) Reset() {
+	*x = ListRoutesRequest{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRoutesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRoutesRequest) ProtoMessage() {}
+
+func (x *ListRoutesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRoutesRequest.ProtoReflect.Descriptor instead.
+func (*ListRoutesRequest) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{0}
+}
+
+// ListRoutesResponse holds the routes applied by the last successful generation
+type ListRoutesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// RFC 3339 time of the last successful generation, empty before the first one
+	GeneratedAt string       `protobuf:"bytes,1,opt,name=generated_at,json=generatedAt,proto3" json:"generated_at,omitempty"`
+	Containers  []*Container `protobuf:"bytes,2,rep,name=containers,proto3" json:"containers,omitempty"`
+	// report of the last successful generation, unset before the first one
+	Report        *Report `protobuf:"bytes,3,opt,name=report,proto3" json:"report,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRoutesResponse) Reset() {
+	*x = ListRoutesResponse{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRoutesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRoutesResponse) ProtoMessage() {}
+
+func (x *ListRoutesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRoutesResponse.ProtoReflect.Descriptor instead.
+func (*ListRoutesResponse) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListRoutesResponse) GetGeneratedAt() string {
+	if x != nil {
+		return x.GeneratedAt
+	}
+	return ""
+}
+
+func (x *ListRoutesResponse) GetContainers() []*Container {
+	if x != nil {
+		return x.Containers
+	}
+	return nil
+}
+
+func (x *ListRoutesResponse) GetReport() *Report {
+	if x != nil {
+		return x.Report
+	}
+	return nil
+}
+
+// Container holds the routes published for one container
+type Container struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Id    string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	// e.g. "tcp:80 -> 172.17.0.2:8080", "http:api.example.com -> 172.17.0.3:8080"
+	Routes []string `protobuf:"bytes,3,rep,name=routes,proto3" json:"routes,omitempty"`
+	// workload responsible for the routes, unset for routes not read from Docker
+	Owner         *Owner `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Container) Reset() {
+	*x = Container{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Container) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Container) ProtoMessage() {}
+
+func (x *Container) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Container.ProtoReflect.Descriptor instead.
+func (*Container) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Container) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Container) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Container) GetRoutes() []string {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+func (x *Container) GetOwner() *Owner {
+	if x != nil {
+		return x.Owner
+	}
+	return nil
+}
+
+// Owner identifies the workload of a container, as in the comments of the generated config
+type Owner struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Project       string                 `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"` // compose project or swarm stack
+	Service       string                 `protobuf:"bytes,2,opt,name=service,proto3" json:"service,omitempty"` // compose or swarm service name
+	Image         string                 `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`
+	LabelSource   string                 `protobuf:"bytes,4,opt,name=label_source,json=labelSource,proto3" json:"label_source,omitempty"` // compose:<files>, swarm or container
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Owner) Reset() {
+	*x = Owner{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Owner) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Owner) ProtoMessage() {}
+
+func (x *Owner) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Owner.ProtoReflect.Descriptor instead.
+func (*Owner) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Owner) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *Owner) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Owner) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *Owner) GetLabelSource() string {
+	if x != nil {
+		return x.LabelSource
+	}
+	return ""
+}
+
+// Report describes what a generation produced
+type Report struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Added   []*Container           `protobuf:"bytes,1,rep,name=added,proto3" json:"added,omitempty"`
+	Removed []*Container           `protobuf:"bytes,2,rep,name=removed,proto3" json:"removed,omitempty"`
+	// containers present before and now with different routes, holding the new routes
+	Changed []*Container        `protobuf:"bytes,3,rep,name=changed,proto3" json:"changed,omitempty"`
+	Skipped []*SkippedContainer `protobuf:"bytes,4,rep,name=skipped,proto3" json:"skipped,omitempty"`
+	Configs []*GeneratedConfig  `protobuf:"bytes,5,rep,name=configs,proto3" json:"configs,omitempty"`
+	// containers with the same routes whose proxy labels changed, e.g. auth or headers
+	Relabeled []*Container   `protobuf:"bytes,6,rep,name=relabeled,proto3" json:"relabeled,omitempty"`
+	Denied    []*DeniedRoute `protobuf:"bytes,7,rep,name=denied,proto3" json:"denied,omitempty"`
+	// warm-up requests to the HTTP routes of added containers, after the reload
+	Warmups       []*WarmupResult `protobuf:"bytes,8,rep,name=warmups,proto3" json:"warmups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Report) Reset() {
+	*x = Report{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Report) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Report) ProtoMessage() {}
+
+func (x *Report) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Report.ProtoReflect.Descriptor instead.
+func (*Report) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Report) GetAdded() []*Container {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *Report) GetRemoved() []*Container {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+func (x *Report) GetChanged() []*Container {
+	if x != nil {
+		return x.Changed
+	}
+	return nil
+}
+
+func (x *Report) GetSkipped() []*SkippedContainer {
+	if x != nil {
+		return x.Skipped
+	}
+	return nil
+}
+
+func (x *Report) GetConfigs() []*GeneratedConfig {
+	if x != nil {
+		return x.Configs
+	}
+	return nil
+}
+
+func (x *Report) GetRelabeled() []*Container {
+	if x != nil {
+		return x.Relabeled
+	}
+	return nil
+}
+
+func (x *Report) GetDenied() []*DeniedRoute {
+	if x != nil {
+		return x.Denied
+	}
+	return nil
+}
+
+func (x *Report) GetWarmups() []*WarmupResult {
+	if x != nil {
+		return x.Warmups
+	}
+	return nil
+}
+
+// SkippedContainer is a container with proxy labels that is not routed
+type SkippedContainer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SkippedContainer) Reset() {
+	*x = SkippedContainer{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SkippedContainer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SkippedContainer) ProtoMessage() {}
+
+func (x *SkippedContainer) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SkippedContainer.ProtoReflect.Descriptor instead.
+func (*SkippedContainer) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SkippedContainer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SkippedContainer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SkippedContainer) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// DeniedRoute is a route of a container left out by the route policy
+type DeniedRoute struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Container     string                 `protobuf:"bytes,1,opt,name=container,proto3" json:"container,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Route         string                 `protobuf:"bytes,3,opt,name=route,proto3" json:"route,omitempty"` // e.g. http:api.example.com, tcp:5432
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeniedRoute) Reset() {
+	*x = DeniedRoute{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeniedRoute) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeniedRoute) ProtoMessage() {}
+
+func (x *DeniedRoute) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeniedRoute.ProtoReflect.Descriptor instead.
+func (*DeniedRoute) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeniedRoute) GetContainer() string {
+	if x != nil {
+		return x.Container
+	}
+	return ""
+}
+
+func (x *DeniedRoute) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeniedRoute) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *DeniedRoute) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// WarmupResult is the outcome of a warm-up request to an added route
+type WarmupResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Container     string                 `protobuf:"bytes,1,opt,name=container,proto3" json:"container,omitempty"`
+	Route         string                 `protobuf:"bytes,2,opt,name=route,proto3" json:"route,omitempty"`   // e.g. http:api.example.com
+	Ok            bool                   `protobuf:"varint,3,opt,name=ok,proto3" json:"ok,omitempty"`        // answered without a 5xx status
+	Detail        string                 `protobuf:"bytes,4,opt,name=detail,proto3" json:"detail,omitempty"` // status of the response or the error
+	DurationMs    int64                  `protobuf:"varint,5,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WarmupResult) Reset() {
+	*x = WarmupResult{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WarmupResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WarmupResult) ProtoMessage() {}
+
+func (x *WarmupResult) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WarmupResult.ProtoReflect.Descriptor instead.
+func (*WarmupResult) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WarmupResult) GetContainer() string {
+	if x != nil {
+		return x.Container
+	}
+	return ""
+}
+
+func (x *WarmupResult) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *WarmupResult) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *WarmupResult) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *WarmupResult) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+// GeneratedConfig describes one generated config of a report
+type GeneratedConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          ConfigKind             `protobuf:"varint,1,opt,name=kind,proto3,enum=proxy.admin.v1.ConfigKind" json:"kind,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Checksum      string                 `protobuf:"bytes,3,opt,name=checksum,proto3" json:"checksum,omitempty"` // SHA256 of the rendered config, hex encoded
+	Changed       bool                   `protobuf:"varint,4,opt,name=changed,proto3" json:"changed,omitempty"`
+	Namespace     string                 `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"` // proxy.namespace of a namespace config, empty for the main configs
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`         // conflict within the namespace, its previous config is kept
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GeneratedConfig) Reset() {
+	*x = GeneratedConfig{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeneratedConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeneratedConfig) ProtoMessage() {}
+
+func (x *GeneratedConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeneratedConfig.ProtoReflect.Descriptor instead.
+func (*GeneratedConfig) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GeneratedConfig) GetKind() ConfigKind {
+	if x != nil {
+		return x.Kind
+	}
+	return ConfigKind_CONFIG_KIND_UNSPECIFIED
+}
+
+func (x *GeneratedConfig) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *GeneratedConfig) GetChecksum() string {
+	if x != nil {
+		return x.Checksum
+	}
+	return ""
+}
+
+func (x *GeneratedConfig) GetChanged() bool {
+	if x != nil {
+		return x.Changed
+	}
+	return false
+}
+
+func (x *GeneratedConfig) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *GeneratedConfig) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// WatchEventsRequest is the request of Admin.WatchEvents
+type WatchEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{9}
+}
+
+// Event is the event that is also posted to webhooks
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // e.g. config.reloaded, config.failed, route.added, alert.firing
+	Time          string                 `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"` // RFC 3339
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Details       map[string]string      `protobuf:"bytes,4,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetDetails() map[string]string {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+// RegenerateRequest is the request of Admin.Regenerate
+type RegenerateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegenerateRequest) Reset() {
+	*x = RegenerateRequest{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegenerateRequest) ProtoMessage() {}
+
+func (x *RegenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegenerateRequest.ProtoReflect.Descriptor instead.
+func (*RegenerateRequest) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{11}
+}
+
+// RegenerateResponse is the response of Admin.Regenerate
+type RegenerateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Report        *Report                `protobuf:"bytes,1,opt,name=report,proto3" json:"report,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegenerateResponse) Reset() {
+	*x = RegenerateResponse{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegenerateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegenerateResponse) ProtoMessage() {}
+
+func (x *RegenerateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegenerateResponse.ProtoReflect.Descriptor instead.
+func (*RegenerateResponse) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RegenerateResponse) GetReport() *Report {
+	if x != nil {
+		return x.Report
+	}
+	return nil
+}
+
+// GetConfigRequest selects a generated config
+type GetConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          ConfigKind             `protobuf:"varint,1,opt,name=kind,proto3,enum=proxy.admin.v1.ConfigKind" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigRequest) Reset() {
+	*x = GetConfigRequest{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigRequest) ProtoMessage() {}
+
+func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigRequest) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetConfigRequest) GetKind() ConfigKind {
+	if x != nil {
+		return x.Kind
+	}
+	return ConfigKind_CONFIG_KIND_UNSPECIFIED
+}
+
+// GetConfigResponse holds a generated config
+type GetConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Content       []byte                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse) Reset() {
+	*x = GetConfigResponse{}
+	mi := &file_admin_adminpb_admin_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse) ProtoMessage() {}
+
+func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_admin_adminpb_admin_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse) Descriptor() ([]byte, []int) {
+	return file_admin_adminpb_admin_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GetConfigResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *GetConfigResponse) GetContent() []byte {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+var File_admin_adminpb_admin_proto protoreflect.FileDescriptor
+
+const file_admin_adminpb_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x19admin/adminpb/admin.proto\x12\x0eproxy.admin.v1\"\x13\n" +
+	"\x11ListRoutesRequest\"\xa2\x01\n" +
+	"\x12ListRoutesResponse\x12!\n" +
+	"\fgenerated_at\x18\x01 \x01(\tR\vgeneratedAt\x129\n" +
+	"\n" +
+	"containers\x18\x02 \x03(\v2\x19.proxy.admin.v1.ContainerR\n" +
+	"containers\x12.\n" +
+	"\x06report\x18\x03 \x01(\v2\x16.proxy.admin.v1.ReportR\x06report\"t\n" +
+	"\tContainer\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x16\n" +
+	"\x06routes\x18\x03 \x03(\tR\x06routes\x12+\n" +
+	"\x05owner\x18\x04 \x01(\v2\x15.proxy.admin.v1.OwnerR\x05owner\"t\n" +
+	"\x05Owner\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x18\n" +
+	"\aservice\x18\x02 \x01(\tR\aservice\x12\x14\n" +
+	"\x05image\x18\x03 \x01(\tR\x05image\x12!\n" +
+	"\flabel_source\x18\x04 \x01(\tR\vlabelSource\"\xc0\x03\n" +
+	"\x06Report\x12/\n" +
+	"\x05added\x18\x01 \x03(\v2\x19.proxy.admin.v1.ContainerR\x05added\x123\n" +
+	"\aremoved\x18\x02 \x03(\v2\x19.proxy.admin.v1.ContainerR\aremoved\x123\n" +
+	"\achanged\x18\x03 \x03(\v2\x19.proxy.admin.v1.ContainerR\achanged\x12:\n" +
+	"\askipped\x18\x04 \x03(\v2 .proxy.admin.v1.SkippedContainerR\askipped\x129\n" +
+	"\aconfigs\x18\x05 \x03(\v2\x1f.proxy.admin.v1.GeneratedConfigR\aconfigs\x127\n" +
+	"\trelabeled\x18\x06 \x03(\v2\x19.proxy.admin.v1.ContainerR\trelabeled\x123\n" +
+	"\x06denied\x18\a \x03(\v2\x1b.proxy.admin.v1.DeniedRouteR\x06denied\x126\n" +
+	"\awarmups\x18\b \x03(\v2\x1c.proxy.admin.v1.WarmupResultR\awarmups\"N\n" +
+	"\x10SkippedContainer\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"i\n" +
+	"\vDeniedRoute\x12\x1c\n" +
+	"\tcontainer\x18\x01 \x01(\tR\tcontainer\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x14\n" +
+	"\x05route\x18\x03 \x01(\tR\x05route\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"\x8b\x01\n" +
+	"\fWarmupResult\x12\x1c\n" +
+	"\tcontainer\x18\x01 \x01(\tR\tcontainer\x12\x14\n" +
+	"\x05route\x18\x02 \x01(\tR\x05route\x12\x0e\n" +
+	"\x02ok\x18\x03 \x01(\bR\x02ok\x12\x16\n" +
+	"\x06detail\x18\x04 \x01(\tR\x06detail\x12\x1f\n" +
+	"\vduration_ms\x18\x05 \x01(\x03R\n" +
+	"durationMs\"\xbf\x01\n" +
+	"\x0fGeneratedConfig\x12.\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x1a.proxy.admin.v1.ConfigKindR\x04kind\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x1a\n" +
+	"\bchecksum\x18\x03 \x01(\tR\bchecksum\x12\x18\n" +
+	"\achanged\x18\x04 \x01(\bR\achanged\x12\x1c\n" +
+	"\tnamespace\x18\x05 \x01(\tR\tnamespace\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"\x14\n" +
+	"\x12WatchEventsRequest\"\xc3\x01\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04time\x18\x02 \x01(\tR\x04time\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12<\n" +
+	"\adetails\x18\x04 \x03(\v2\".proxy.admin.v1.Event.DetailsEntryR\adetails\x1a:\n" +
+	"\fDetailsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x13\n" +
+	"\x11RegenerateRequest\"D\n" +
+	"\x12RegenerateResponse\x12.\n" +
+	"\x06report\x18\x01 \x01(\v2\x16.proxy.admin.v1.ReportR\x06report\"B\n" +
+	"\x10GetConfigRequest\x12.\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x1a.proxy.admin.v1.ConfigKindR\x04kind\"A\n" +
+	"\x11GetConfigResponse\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\fR\acontent*W\n" +
+	"\n" +
+	"ConfigKind\x12\x1b\n" +
+	"\x17CONFIG_KIND_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12CONFIG_KIND_STREAM\x10\x01\x12\x14\n" +
+	"\x10CONFIG_KIND_HTTP\x10\x022\xcf\x02\n" +
+	"\x05Admin\x12S\n" +
+	"\n" +
+	"ListRoutes\x12!.proxy.admin.v1.ListRoutesRequest\x1a\".proxy.admin.v1.ListRoutesResponse\x12J\n" +
+	"\vWatchEvents\x12\".proxy.admin.v1.WatchEventsRequest\x1a\x15.proxy.admin.v1.Event0\x01\x12S\n" +
+	"\n" +
+	"Regenerate\x12!.proxy.admin.v1.RegenerateRequest\x1a\".proxy.admin.v1.RegenerateResponse\x12P\n" +
+	"\tGetConfig\x12 .proxy.admin.v1.GetConfigRequest\x1a!.proxy.admin.v1.GetConfigResponseB*Z(github.com/moontechs/proxy/admin/adminpbb\x06proto3"
+
+var (
+	file_admin_adminpb_admin_proto_rawDescOnce sync.Once
+	file_admin_adminpb_admin_proto_rawDescData []byte
+)
+
+func file_admin_adminpb_admin_proto_rawDescGZIP() []byte {
+	file_admin_adminpb_admin_proto_rawDescOnce.Do(func() {
+		file_admin_adminpb_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_admin_adminpb_admin_proto_rawDesc), len(file_admin_adminpb_admin_proto_rawDesc)))
+	})
+	return file_admin_adminpb_admin_proto_rawDescData
+}
+
+var file_admin_adminpb_admin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_admin_adminpb_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_admin_adminpb_admin_proto_goTypes = []any{
+	(ConfigKind)(0),            // 0: proxy.admin.v1.ConfigKind
+	(*ListRoutesRequest)(nil),  // 1: proxy.admin.v1.ListRoutesRequest
+	(*ListRoutesResponse)(nil), // 2: proxy.admin.v1.ListRoutesResponse
+	(*Container)(nil),          // 3: proxy.admin.v1.Container
+	(*Owner)(nil),              // 4: proxy.admin.v1.Owner
+	(*Report)(nil),             // 5: proxy.admin.v1.Report
+	(*SkippedContainer)(nil),   // 6: proxy.admin.v1.SkippedContainer
+	(*DeniedRoute)(nil),        // 7: proxy.admin.v1.DeniedRoute
+	(*WarmupResult)(nil),       // 8: proxy.admin.v1.WarmupResult
+	(*GeneratedConfig)(nil),    // 9: proxy.admin.v1.GeneratedConfig
+	(*WatchEventsRequest)(nil), // 10: proxy.admin.v1.WatchEventsRequest
+	(*Event)(nil),              // 11: proxy.admin.v1.Event
+	(*RegenerateRequest)(nil),  // 12: proxy.admin.v1.RegenerateRequest
+	(*RegenerateResponse)(nil), // 13: proxy.admin.v1.RegenerateResponse
+	(*GetConfigRequest)(nil),   // 14: proxy.admin.v1.GetConfigRequest
+	(*GetConfigResponse)(nil),  // 15: proxy.admin.v1.GetConfigResponse
+	nil,                        // 16: proxy.admin.v1.Event.DetailsEntry
+}
+var file_admin_adminpb_admin_proto_depIdxs = []int32{
+	3,  // 0: proxy.admin.v1.ListRoutesResponse.containers:type_name -> proxy.admin.v1.Container
+	5,  // 1: proxy.admin.v1.ListRoutesResponse.report:type_name -> proxy.admin.v1.Report
+	4,  // 2: proxy.admin.v1.Container.owner:type_name -> proxy.admin.v1.Owner
+	3,  // 3: proxy.admin.v1.Report.added:type_name -> proxy.admin.v1.Container
+	3,  // 4: proxy.admin.v1.Report.removed:type_name -> proxy.admin.v1.Container
+	3,  // 5: proxy.admin.v1.Report.changed:type_name -> proxy.admin.v1.Container
+	6,  // 6: proxy.admin.v1.Report.skipped:type_name -> proxy.admin.v1.SkippedContainer
+	9,  // 7: proxy.admin.v1.Report.configs:type_name -> proxy.admin.v1.GeneratedConfig
+	3,  // 8: proxy.admin.v1.Report.relabeled:type_name -> proxy.admin.v1.Container
+	7,  // 9: proxy.admin.v1.Report.denied:type_name -> proxy.admin.v1.DeniedRoute
+	8,  // 10: proxy.admin.v1.Report.warmups:type_name -> proxy.admin.v1.WarmupResult
+	0,  // 11: proxy.admin.v1.GeneratedConfig.kind:type_name -> proxy.admin.v1.ConfigKind
+	16, // 12: proxy.admin.v1.Event.details:type_name -> proxy.admin.v1.Event.DetailsEntry
+	5,  // 13: proxy.admin.v1.RegenerateResponse.report:type_name -> proxy.admin.v1.Report
+	0,  // 14: proxy.admin.v1.GetConfigRequest.kind:type_name -> proxy.admin.v1.ConfigKind
+	1,  // 15: proxy.admin.v1.Admin.ListRoutes:input_type -> proxy.admin.v1.ListRoutesRequest
+	10, // 16: proxy.admin.v1.Admin.WatchEvents:input_type -> proxy.admin.v1.WatchEventsRequest
+	12, // 17: proxy.admin.v1.Admin.Regenerate:input_type -> proxy.admin.v1.RegenerateRequest
+	14, // 18: proxy.admin.v1.Admin.GetConfig:input_type -> proxy.admin.v1.GetConfigRequest
+	2,  // 19: proxy.admin.v1.Admin.ListRoutes:output_type -> proxy.admin.v1.ListRoutesResponse
+	11, // 20: proxy.admin.v1.Admin.WatchEvents:output_type -> proxy.admin.v1.Event
+	13, // 21: proxy.admin.v1.Admin.Regenerate:output_type -> proxy.admin.v1.RegenerateResponse
+	15, // 22: proxy.admin.v1.Admin.GetConfig:output_type -> proxy.admin.v1.GetConfigResponse
+	19, // [19:23] is the sub-list for method output_type
+	15, // [15:19] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_admin_adminpb_admin_proto_init() }
+func file_admin_adminpb_admin_proto_init() {
+	if File_admin_adminpb_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_admin_adminpb_admin_proto_rawDesc), len(file_admin_adminpb_admin_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_admin_adminpb_admin_proto_goTypes,
+		DependencyIndexes: file_admin_adminpb_admin_proto_depIdxs,
+		EnumInfos:         file_admin_adminpb_admin_proto_enumTypes,
+		MessageInfos:      file_admin_adminpb_admin_proto_msgTypes,
+	}.Build()
+	File_admin_adminpb_admin_proto = out.File
+	file_admin_adminpb_admin_proto_goTypes = nil
+	file_admin_adminpb_admin_proto_depIdxs = nil
+}
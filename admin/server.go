@@ -0,0 +1,307 @@
+// Package admin serves the gRPC admin API: routes, events, regeneration and generated configs
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/admin/adminpb"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Backend is the watcher state the admin API reads and controls
+type Backend interface {
+	Routes() *state.Snapshot              // routes applied by the last successful generation
+	Report() *nginx.Report                // report of the last successful generation, nil before the first one
+	Regenerate(ctx context.Context) error // scan, generate and reload if changed
+	ConfigPaths() (stream, http string)   // generated config files
+	Rendered(path string) ([]byte, bool)  // config rendered in memory in read-only mode
+}
+
+// Server implements the Admin gRPC service
+type Server struct {
+	adminpb.UnimplementedAdminServer
+
+	addr    string
+	token   string // bearer token required from clients, empty disables
+	backend Backend
+	events  *notify.Broker
+	log     *lgr.Logger
+
+	srv  *grpc.Server
+	done chan struct{} // closed on shutdown to end event streams
+}
+
+// NewServer creates an admin server listening on addr, host:port or unix:/path
+func NewServer(addr, token string, backend Backend, events *notify.Broker, log *lgr.Logger) *Server {
+	return &Server{
+		addr:    addr,
+		token:   token,
+		backend: backend,
+		events:  events,
+		log:     log,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start begins serving the admin API in the background
+// Without a token only a unix socket is served, the API has no TLS and reloads nginx
+func (s *Server) Start() error {
+	if s.token == "" && !strings.HasPrefix(s.addr, "unix:") {
+		return fmt.Errorf("admin API on %s requires ADMIN_TOKEN, only unix sockets may be unauthenticated", s.addr)
+	}
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	s.srv = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.authUnary),
+		grpc.ChainStreamInterceptor(s.authStream),
+	)
+	adminpb.RegisterAdminServer(s.srv, s)
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.log.Logf("ERROR [Admin] admin server failed error=%q", err)
+		}
+	}()
+
+	s.log.Logf("INFO [Admin] serving gRPC admin API addr=%s auth=%t", s.addr, s.token != "")
+	return nil
+}
+
+// listen opens a TCP or unix socket listener, replacing a stale socket file
+func (s *Server) listen() (net.Listener, error) {
+	network, address := "tcp", s.addr
+	if path, ok := strings.CutPrefix(s.addr, "unix:"); ok {
+		network, address = "unix", path
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+			}
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	return ln, nil
+}
+
+// Close ends event streams and stops the server, in-flight calls get until ctx is done
+func (s *Server) Close(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	close(s.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return fmt.Errorf("admin server shutdown timed out: %w", ctx.Err())
+	}
+}
+
+// ListRoutes returns the routes applied by the last successful generation and its report
+func (s *Server) ListRoutes(_ context.Context, _ *adminpb.ListRoutesRequest) (*adminpb.ListRoutesResponse, error) {
+	resp := &adminpb.ListRoutesResponse{Report: reportToProto(s.backend.Report())}
+	snap := s.backend.Routes()
+	if snap == nil {
+		return resp, nil
+	}
+
+	if !snap.GeneratedAt.IsZero() {
+		resp.GeneratedAt = snap.GeneratedAt.UTC().Format(time.RFC3339)
+	}
+	resp.Containers = containersToProto(snap.Containers)
+	return resp, nil
+}
+
+// WatchEvents streams events until the client disconnects or the server stops
+func (s *Server) WatchEvents(_ *adminpb.WatchEventsRequest, stream grpc.ServerStreamingServer[adminpb.Event]) error {
+	events, cancel := s.events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(toProto(event)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// Regenerate scans containers, regenerates configs and reloads nginx if they changed
+func (s *Server) Regenerate(ctx context.Context, _ *adminpb.RegenerateRequest) (*adminpb.RegenerateResponse, error) {
+	s.log.Logf("INFO [Admin] regeneration requested")
+	if err := s.backend.Regenerate(ctx); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &adminpb.RegenerateResponse{Report: reportToProto(s.backend.Report())}, nil
+}
+
+// GetConfig returns a generated config file, or the rendered config in read-only mode
+func (s *Server) GetConfig(_ context.Context, req *adminpb.GetConfigRequest) (*adminpb.GetConfigResponse, error) {
+	streamPath, httpPath := s.backend.ConfigPaths()
+
+	var path string
+	switch req.GetKind() {
+	case adminpb.ConfigKind_CONFIG_KIND_STREAM:
+		path = streamPath
+	case adminpb.ConfigKind_CONFIG_KIND_HTTP:
+		path = httpPath
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown config kind %s", req.GetKind())
+	}
+
+	if content, ok := s.backend.Rendered(path); ok {
+		return &adminpb.GetConfigResponse{Path: path, Content: content}, nil
+	}
+
+	// #nosec G304 -- path is one of the configured output paths
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, status.Errorf(codes.NotFound, "config %s not generated yet", path)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read config: %v", err)
+	}
+	return &adminpb.GetConfigResponse{Path: path, Content: content}, nil
+}
+
+func (s *Server) authUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authStream(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authorize checks the "authorization: Bearer <token>" metadata when a token is configured
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func toProto(event notify.Event) *adminpb.Event {
+	return &adminpb.Event{
+		Type:    event.Type,
+		Time:    event.Time.UTC().Format(time.RFC3339),
+		Message: event.Message,
+		Details: event.Details,
+	}
+}
+
+// reportToProto converts a generation report, nil stays unset
+func reportToProto(report *nginx.Report) *adminpb.Report {
+	if report == nil {
+		return nil
+	}
+
+	resp := &adminpb.Report{
+		Added:     containersToProto(report.Changes.Added),
+		Removed:   containersToProto(report.Changes.Removed),
+		Changed:   containersToProto(report.Changes.Changed),
+		Relabeled: containersToProto(report.Changes.Relabeled),
+		Configs: []*adminpb.GeneratedConfig{
+			configToProto(adminpb.ConfigKind_CONFIG_KIND_STREAM, report.Stream),
+			configToProto(adminpb.ConfigKind_CONFIG_KIND_HTTP, report.HTTP),
+		},
+	}
+	for _, ns := range report.Namespaces {
+		for _, config := range []*adminpb.GeneratedConfig{
+			configToProto(adminpb.ConfigKind_CONFIG_KIND_STREAM, ns.Stream),
+			configToProto(adminpb.ConfigKind_CONFIG_KIND_HTTP, ns.HTTP),
+		} {
+			config.Namespace, config.Error = ns.Name, ns.Error
+			resp.Configs = append(resp.Configs, config)
+		}
+	}
+	for _, ctr := range report.Skipped {
+		resp.Skipped = append(resp.Skipped, &adminpb.SkippedContainer{Name: ctr.Name, Id: ctr.ID, Reason: ctr.Reason})
+	}
+	for _, route := range report.Denied {
+		resp.Denied = append(resp.Denied, &adminpb.DeniedRoute{
+			Container: route.Container, Id: route.ID, Route: route.Route, Reason: route.Reason,
+		})
+	}
+	for _, w := range report.Warmups {
+		resp.Warmups = append(resp.Warmups, &adminpb.WarmupResult{
+			Container: w.Container, Route: w.Route, Ok: w.OK, Detail: w.Detail, DurationMs: w.Duration.Milliseconds(),
+		})
+	}
+	return resp
+}
+
+func configToProto(kind adminpb.ConfigKind, config nginx.ConfigReport) *adminpb.GeneratedConfig {
+	return &adminpb.GeneratedConfig{Kind: kind, Path: config.Path, Checksum: config.Checksum, Changed: config.Changed}
+}
+
+func containersToProto(containers []state.Container) []*adminpb.Container {
+	result := make([]*adminpb.Container, 0, len(containers))
+	for _, ctr := range containers {
+		container := &adminpb.Container{
+			Name:   ctr.Name,
+			Id:     ctr.ID,
+			Routes: ctr.Routes,
+		}
+		if ctr.Owner != nil {
+			container.Owner = &adminpb.Owner{
+				Project:     ctr.Owner.Project,
+				Service:     ctr.Owner.Service,
+				Image:       ctr.Owner.Image,
+				LabelSource: ctr.Owner.LabelSource,
+			}
+		}
+		result = append(result, container)
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/admin/adminpb"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeBackend struct {
+	snap        *state.Snapshot
+	report      *nginx.Report
+	regenErr    error
+	regenerated int
+	streamPath  string
+	httpPath    string
+	rendered    map[string][]byte
+}
+
+func (f *fakeBackend) Routes() *state.Snapshot { return f.snap }
+
+func (f *fakeBackend) Report() *nginx.Report { return f.report }
+
+func (f *fakeBackend) Regenerate(context.Context) error {
+	f.regenerated++
+	return f.regenErr
+}
+
+func (f *fakeBackend) ConfigPaths() (stream, http string) { return f.streamPath, f.httpPath }
+
+func (f *fakeBackend) Rendered(path string) ([]byte, bool) {
+	content, ok := f.rendered[path]
+	return content, ok
+}
+
+// startServer serves the admin API on a unix socket and returns a connected client
+func startServer(t *testing.T, token string, backend Backend, events *notify.Broker) adminpb.AdminClient {
+	t.Helper()
+	// unix socket paths are limited to ~100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "admin.sock")
+
+	srv := NewServer("unix:"+socket, token, backend, events, lgr.New())
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := srv.Close(ctx); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+
+	conn, err := grpc.NewClient("unix:"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return adminpb.NewAdminClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{
+		snap: &state.Snapshot{
+			GeneratedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			Containers: []state.Container{
+				{Name: "api", ID: "abc", Routes: []string{"http:api.example.com -> 172.17.0.3:8080"},
+					Owner: &docker.Owner{Project: "shop", Service: "api", Image: "shop-api:1.4", LabelSource: docker.LabelSourceContainer}},
+			},
+		},
+		streamPath: filepath.Join(dir, "proxy.conf"),
+		httpPath:   filepath.Join(dir, "http-proxy.conf"),
+	}
+	if err := os.WriteFile(backend.httpPath, []byte("server {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := startServer(t, "", backend, notify.NewBroker())
+	ctx := context.Background()
+
+	t.Run("list routes", func(t *testing.T) {
+		resp, err := client.ListRoutes(ctx, &adminpb.ListRoutesRequest{})
+		if err != nil {
+			t.Fatalf("ListRoutes() error = %v", err)
+		}
+		if resp.GetGeneratedAt() != "2024-01-01T12:00:00Z" || len(resp.GetContainers()) != 1 {
+			t.Fatalf("unexpected response %v", resp)
+		}
+		ctr := resp.GetContainers()[0]
+		if ctr.GetName() != "api" || ctr.GetId() != "abc" || len(ctr.GetRoutes()) != 1 {
+			t.Errorf("unexpected container %v", ctr)
+		}
+		if owner := ctr.GetOwner(); owner.GetProject() != "shop" || owner.GetImage() != "shop-api:1.4" || owner.GetLabelSource() != "container" {
+			t.Errorf("owner = %v, want the shop project's image", owner)
+		}
+		if resp.GetReport() != nil {
+			t.Errorf("report = %v, want unset before the first generation", resp.GetReport())
+		}
+	})
+
+	t.Run("get config", func(t *testing.T) {
+		resp, err := client.GetConfig(ctx, &adminpb.GetConfigRequest{Kind: adminpb.ConfigKind_CONFIG_KIND_HTTP})
+		if err != nil {
+			t.Fatalf("GetConfig() error = %v", err)
+		}
+		if resp.GetPath() != backend.httpPath || string(resp.GetContent()) != "server {}\n" {
+			t.Errorf("unexpected response %v", resp)
+		}
+
+		_, err = client.GetConfig(ctx, &adminpb.GetConfigRequest{Kind: adminpb.ConfigKind_CONFIG_KIND_STREAM})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("GetConfig(stream) code = %v, want NotFound", status.Code(err))
+		}
+		_, err = client.GetConfig(ctx, &adminpb.GetConfigRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetConfig(unspecified) code = %v, want InvalidArgument", status.Code(err))
+		}
+	})
+
+	t.Run("get rendered config in read-only mode", func(t *testing.T) {
+		backend.rendered = map[string][]byte{backend.streamPath: []byte("stream {}\n")}
+		defer func() { backend.rendered = nil }()
+
+		resp, err := client.GetConfig(ctx, &adminpb.GetConfigRequest{Kind: adminpb.ConfigKind_CONFIG_KIND_STREAM})
+		if err != nil {
+			t.Fatalf("GetConfig() error = %v", err)
+		}
+		if string(resp.GetContent()) != "stream {}\n" {
+			t.Errorf("unexpected content %q", resp.GetContent())
+		}
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		backend.report = &nginx.Report{
+			Changes: state.Changes{Added: backend.snap.Containers, Relabeled: backend.snap.Containers},
+			Skipped: []docker.SkippedContainer{{Name: "db", ID: "def", Reason: "no IP address"}},
+			Denied:  []docker.DeniedRoute{{Container: "web", ID: "ghi", Route: "http:evil.example.com", Reason: "hostname not allowed"}},
+			Stream:  nginx.ConfigReport{Path: backend.streamPath, Checksum: "e3b0c442"},
+			HTTP:    nginx.ConfigReport{Path: backend.httpPath, Checksum: "a1b2c3d4", Changed: true},
+			Warmups: []nginx.WarmupResult{{Container: "api", Route: "http:api.example.com", OK: true, Detail: "200", Duration: 1500 * time.Millisecond}},
+		}
+		resp, err := client.Regenerate(ctx, &adminpb.RegenerateRequest{})
+		if err != nil {
+			t.Fatalf("Regenerate() error = %v", err)
+		}
+		report := resp.GetReport()
+		if len(report.GetAdded()) != 1 || report.GetAdded()[0].GetName() != "api" ||
+			len(report.GetSkipped()) != 1 || report.GetSkipped()[0].GetReason() != "no IP address" {
+			t.Errorf("unexpected report %v", report)
+		}
+		if len(report.GetRelabeled()) != 1 || len(report.GetDenied()) != 1 || report.GetDenied()[0].GetRoute() != "http:evil.example.com" ||
+			len(report.GetWarmups()) != 1 || !report.GetWarmups()[0].GetOk() || report.GetWarmups()[0].GetDurationMs() != 1500 {
+			t.Errorf("unexpected relabeled, denied or warm-ups in report %v", report)
+		}
+		if configs := report.GetConfigs(); len(configs) != 2 || configs[1].GetKind() != adminpb.ConfigKind_CONFIG_KIND_HTTP ||
+			configs[1].GetChecksum() != "a1b2c3d4" || !configs[1].GetChanged() || configs[0].GetChanged() {
+			t.Errorf("unexpected report configs %v", configs)
+		}
+		routes, err := client.ListRoutes(ctx, &adminpb.ListRoutesRequest{})
+		if err != nil || len(routes.GetReport().GetAdded()) != 1 {
+			t.Errorf("ListRoutes() = %v, %v, want the last report", routes, err)
+		}
+
+		backend.regenErr = errors.New("validation failed")
+		_, err = client.Regenerate(ctx, &adminpb.RegenerateRequest{})
+		if status.Code(err) != codes.Internal || status.Convert(err).Message() != "validation failed" {
+			t.Errorf("Regenerate() error = %v, want Internal validation failed", err)
+		}
+		if backend.regenerated != 2 {
+			t.Errorf("regenerated %d times, want 2", backend.regenerated)
+		}
+	})
+}
+
+func TestServerWatchEvents(t *testing.T) {
+	events := notify.NewBroker()
+	client := startServer(t, "", &fakeBackend{}, events)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchEvents(ctx, &adminpb.WatchEventsRequest{})
+	if err != nil {
+		t.Fatalf("WatchEvents() error = %v", err)
+	}
+
+	// the subscription is registered once the stream is served, publish until the event arrives
+	received := make(chan *adminpb.Event, 1)
+	go func() {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Errorf("Recv() error = %v", err)
+			close(received)
+			return
+		}
+		received <- event
+	}()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		events.Notify(ctx, notify.Event{
+			Type:    "config.reloaded",
+			Time:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			Message: "configs reloaded on local",
+			Details: map[string]string{"added": "1"},
+		})
+		select {
+		case event := <-received:
+			if event.GetType() != "config.reloaded" || event.GetTime() != "2024-01-01T12:00:00Z" || event.GetDetails()["added"] != "1" {
+				t.Errorf("unexpected event %v", event)
+			}
+			return
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	client := startServer(t, "s3cret", &fakeBackend{}, notify.NewBroker())
+
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{name: "missing token", want: codes.Unauthenticated},
+		{name: "wrong token", token: "Bearer nope", want: codes.Unauthenticated},
+		{name: "valid token", token: "Bearer s3cret", want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.token)
+			}
+			_, err := client.ListRoutes(ctx, &adminpb.ListRoutesRequest{})
+			if status.Code(err) != tt.want {
+				t.Errorf("ListRoutes() code = %v, want %v", status.Code(err), tt.want)
+			}
+		})
+	}
+}
+
+func TestServerRequiresTokenOnTCP(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", "", &fakeBackend{}, notify.NewBroker(), lgr.New())
+	if err := srv.Start(); err == nil {
+		t.Fatal("expected an error for a TCP listener without a token")
+	}
+}
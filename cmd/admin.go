@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/admin"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+)
+
+// adminBackend exposes a pipeline to the admin API
+type adminBackend struct {
+	pipe *pipeline
+}
+
+func (b adminBackend) Routes() *state.Snapshot { return b.pipe.routes() }
+
+func (b adminBackend) Report() *nginx.Report { return b.pipe.lastReport() }
+
+func (b adminBackend) Regenerate(ctx context.Context) error { return b.pipe.run(ctx) }
+
+func (b adminBackend) ConfigPaths() (stream, http string) { return b.pipe.gen.ConfigPaths() }
+
+func (b adminBackend) Rendered(path string) ([]byte, bool) { return b.pipe.gen.Rendered(path) }
+
+// digestEvents are the event types batched by --webhook-digest, failures, drift and alerts are sent at once
+var digestEvents = []string{eventConfigReloaded, eventRouteAdded, eventRouteChanged, eventRouteRemoved}
+
+// newEvents returns the sink for proxy events, posting to webhooks and the admin API event stream
+// With a webhook digest window only the webhooks are batched, the event stream stays live
+// Webhooks are posted in the background, runs send events while holding the pipeline lock
+func newEvents(cfg *config.Config, log *lgr.Logger) (notify.Multi, *notify.Broker) {
+	broker := notify.NewBroker()
+	var webhooks notify.Sink = notify.New(cfg.Webhooks, log)
+	if cfg.WebhookDigest > 0 && len(cfg.Webhooks) > 0 {
+		webhooks = notify.NewDigest(webhooks, cfg.WebhookDigest, digestEvents, log)
+	}
+	if len(cfg.Webhooks) > 0 {
+		webhooks = notify.NewAsync(webhooks, log)
+	}
+	return notify.Multi{webhooks, broker}, broker
+}
+
+// startAdmin starts the gRPC admin API if configured
+// The returned stop function is always safe to call
+func startAdmin(cfg *config.Config, pipe *pipeline, events *notify.Broker, log *lgr.Logger) (func(), error) {
+	if cfg.AdminGRPCAddr == "" {
+		return func() {}, nil
+	}
+	if cfg.AdminToken == "" {
+		log.Logf("WARN [Admin] ADMIN_TOKEN is not set, the admin socket accepts unauthenticated calls")
+	}
+
+	server := admin.NewServer(cfg.AdminGRPCAddr, cfg.AdminToken, adminBackend{pipe: pipe}, events, log)
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Close(ctx); err != nil {
+			log.Logf("WARN [Admin] %v", err)
+		}
+		events.Close()
+	}, nil
+}
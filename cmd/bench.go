@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure scan, validation and rendering times with synthetic containers",
+	Long: `Synthesizes --containers fake containers with varied proxy labels and measures
+each stage of a generation end to end, without touching Docker or nginx:
+
+- scan: the container list and inspects answered in memory, parsed like a
+  real scan
+- validate: the checks of lint-labels, including port and hostname conflicts
+  and --policy-hostnames / --policy-ports
+- render: the stream and HTTP configs built with the configured templates
+  and defaults; nothing is written, and nginx -V, nginx -T, plugins and
+  Vault are skipped
+
+The containers cycle through plain and hardened HTTP hosts, replicas pooled
+on one hostname, TCP and UDP ports and containers with several routes.
+Each stage runs --runs times, the logs of the stages are discarded so they
+do not skew the timings.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+
+		n, _ := cmd.Flags().GetInt("containers") //nolint:errcheck // flag is predefined
+		runs, _ := cmd.Flags().GetInt("runs")    //nolint:errcheck // flag is predefined
+		if n < 1 || n > docker.MaxSyntheticContainers {
+			return logError("invalid --containers %d, expected 1 to %d", n, docker.MaxSyntheticContainers)
+		}
+		if runs < 1 {
+			return logError("invalid --runs %d, expected 1 or more", runs)
+		}
+
+		quiet := lgr.New(lgr.Out(io.Discard), lgr.Err(io.Discard))
+		generator, err := newGenerator(benchConfig(cfg), quiet)
+		if err != nil {
+			return logError("generator initialization failed: %w", err)
+		}
+		generator.SetReadOnly(true)
+		policy, err := docker.ParsePolicy(cfg.PolicyHostnames, cfg.PolicyPorts)
+		if err != nil {
+			return logError("invalid policy: %w", err)
+		}
+
+		b := &bench{gen: generator, policy: policy, log: quiet}
+		result, err := b.run(context.Background(), n, runs)
+		if err != nil {
+			return logError("benchmark failed: %w", err)
+		}
+		printBench(os.Stdout, result)
+		return nil
+	},
+}
+
+func init() {
+	benchCmd.Flags().Int("containers", 1000, "Number of synthetic containers")
+	benchCmd.Flags().Int("runs", 3, "Runs of each stage, the table shows the fastest, mean and slowest")
+	rootCmd.AddCommand(benchCmd)
+}
+
+// benchConfig returns cfg without the settings that reach outside the process: the nginx
+// binary of the capability probe and config checks, plugins and Vault
+func benchConfig(cfg *config.Config) *config.Config {
+	offline := *cfg
+	offline.NginxBinary, offline.CheckNginxConfig = "", false
+	offline.PluginsDir = ""
+	offline.Vault = config.Vault{}
+	return &offline
+}
+
+// bench stages, in run order
+var benchStages = []string{"scan", "validate", "render"}
+
+// bench measures the stages of a generation with synthetic containers
+type bench struct {
+	gen    *nginx.Generator
+	policy docker.Policy
+	log    *lgr.Logger // of the synthetic Docker client
+}
+
+// benchResult are the timings of every stage run and what the last run produced
+type benchResult struct {
+	containers int
+	timings    map[string][]time.Duration // stage -> duration of each run
+	routed     int                        // containers found by the scan
+	skipped    int                        // containers the scan skipped
+	issues     int                        // label problems found by validate
+	configSize int                        // bytes of the rendered stream and HTTP configs
+}
+
+// run runs every stage runs times on n synthetic containers
+func (b *bench) run(ctx context.Context, n, runs int) (benchResult, error) {
+	client, err := docker.NewSyntheticClient(n, b.log)
+	if err != nil {
+		return benchResult{}, err
+	}
+	labels, err := client.ListLabels(ctx)
+	if err != nil {
+		return benchResult{}, fmt.Errorf("list labels: %w", err)
+	}
+
+	result := benchResult{containers: n, timings: make(map[string][]time.Duration)}
+	for range runs {
+		start := time.Now()
+		scan, err := client.Scan(ctx)
+		if err != nil {
+			return benchResult{}, fmt.Errorf("scan: %w", err)
+		}
+		result.timings["scan"] = append(result.timings["scan"], time.Since(start))
+		result.routed, result.skipped = len(scan.Containers), len(scan.Skipped)
+
+		start = time.Now()
+		issues := append(docker.LintLabels(labels), b.policy.Lint(labels)...)
+		result.timings["validate"] = append(result.timings["validate"], time.Since(start))
+		result.issues = len(issues)
+
+		start = time.Now()
+		streamConf, httpConf, err := b.gen.Render(scan.Containers, scan.Skipped...)
+		if err != nil {
+			return benchResult{}, fmt.Errorf("render: %w", err)
+		}
+		result.timings["render"] = append(result.timings["render"], time.Since(start))
+		result.configSize = len(streamConf) + len(httpConf)
+	}
+	return result, nil
+}
+
+// printBench writes the fastest, mean and slowest run of each stage and the total of a
+// generation, with the mean per container
+func printBench(out io.Writer, result benchResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STAGE\tMIN\tMEAN\tMAX\tPER CONTAINER") //nolint:errcheck // terminal output
+	var total time.Duration
+	for _, stage := range benchStages {
+		timings := result.timings[stage]
+		fastest, slowest, sum := timings[0], timings[0], time.Duration(0)
+		for _, d := range timings {
+			fastest, slowest, sum = min(fastest, d), max(slowest, d), sum+d
+		}
+		mean := sum / time.Duration(len(timings))
+		total += mean
+		//nolint:errcheck // terminal output
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", stage, benchRound(fastest), benchRound(mean), benchRound(slowest),
+			benchRound(mean/time.Duration(result.containers)))
+	}
+	//nolint:errcheck // terminal output
+	_, _ = fmt.Fprintf(w, "total\t\t%s\t\t%s\n", benchRound(total), benchRound(total/time.Duration(result.containers)))
+	_ = w.Flush() //nolint:errcheck // terminal output
+
+	//nolint:errcheck // terminal output
+	_, _ = fmt.Fprintf(out, "\n%d containers, %d routed, %d skipped, %d label issues, %d runs, %d KiB of configs\n",
+		result.containers, result.routed, result.skipped, result.issues, len(result.timings["scan"]), result.configSize/1024)
+}
+
+// benchRound rounds a duration to three significant digits, e.g. 1.23ms
+func benchRound(d time.Duration) time.Duration {
+	for unit := time.Second; unit >= time.Nanosecond; unit /= 1000 {
+		if d >= unit {
+			return d.Round(unit / 100)
+		}
+	}
+	return d
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/moontechs/proxy/config"
+)
+
+func TestBenchConfig(t *testing.T) {
+	cfg := &config.Config{NginxBinary: "nginx", CheckNginxConfig: true, PluginsDir: "/etc/proxy/plugins.d",
+		Vault: config.Vault{Addr: "https://vault:8200"}, PolicyPorts: "80,443"}
+	got := benchConfig(cfg)
+	if got.NginxBinary != "" || got.CheckNginxConfig || got.PluginsDir != "" || got.Vault != (config.Vault{}) {
+		t.Errorf("benchConfig() keeps settings reaching outside the process: %+v", got)
+	}
+	if got.PolicyPorts != "80,443" || cfg.NginxBinary != "nginx" {
+		t.Errorf("benchConfig() should copy the other settings and leave cfg as is")
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/moontechs/proxy/docker"
+	"github.com/spf13/cobra"
+)
+
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "Print the ports and hostnames claimed by containers and flag collisions",
+	Long: `Prints a matrix of all TCP ports, UDP ports, SSH aliases and hostnames claimed
+by the proxy labels of running containers, or of the services in Compose files
+with --compose-file, and the containers owning them. Nothing is generated.
+
+Every claim is ok, pooled (shared by replicas of a service or containers with
+one proxy.stream.hash), a conflict that fails generation, or a near miss that
+generates but is likely a mistake: replicas forwarding one hostname to
+different ports, or a wildcard hostname also matching a hostname of another
+container. --compose-file can be repeated, with --running the services are
+checked against the running containers, e.g. before deploying a new stack.
+
+Exits with code 11 on conflicts, like generation, near misses alone exit zero.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		composeFiles, _ := cmd.Flags().GetStringArray("compose-file") //nolint:errcheck // flag is predefined
+		running, _ := cmd.Flags().GetBool("running")                  //nolint:errcheck // flag is predefined
+
+		labels := make(map[string]map[string]string)
+		if len(composeFiles) == 0 || running {
+			var err error
+			if labels, err = runningLabels(cfg, log, "Conflicts"); err != nil {
+				return err
+			}
+		}
+		// services replace running containers of the same name, the new version of a stack
+		for _, file := range composeFiles {
+			services, err := docker.LoadComposeLabels(file)
+			if err != nil {
+				return logError("compose file %s load failed: %w", file, err)
+			}
+			maps.Copy(labels, services)
+		}
+
+		claims := docker.ClaimMatrix(labels)
+		if len(claims) == 0 {
+			fmt.Printf("No ports or hostnames claimed by %d containers\n", len(labels))
+			return nil
+		}
+		conflicts, nearMisses := printClaims(os.Stdout, claims)
+		fmt.Printf("\n%d claims by %d containers, %d conflicts, %d near misses\n", len(claims), len(labels), conflicts, nearMisses)
+
+		if conflicts > 0 {
+			return &ExitError{Code: exitConflict, Err: fmt.Errorf("%d conflicts found", conflicts)}
+		}
+		return nil
+	},
+}
+
+func init() {
+	conflictsCmd.Flags().StringArray("compose-file", nil, "Check the services of a Compose file instead of running containers, repeatable")
+	conflictsCmd.Flags().Bool("running", false, "Check the Compose file services together with the running containers")
+	rootCmd.AddCommand(conflictsCmd)
+}
+
+// printClaims writes the claims as a table, one row per owner, followed by the notes of
+// conflicts and near misses, and returns their counts
+func printClaims(out io.Writer, claims []docker.Claim) (conflicts, nearMisses int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tCLAIM\tCONTAINER\tLABEL\tBACKEND\tSTATUS") //nolint:errcheck // terminal output
+	for _, claim := range claims {
+		for i, owner := range claim.Owners {
+			kind, name, status := claim.Kind, claim.Name, claim.Status
+			if i > 0 {
+				kind, name, status = "", "", ""
+			}
+			backend := "-"
+			if owner.Port != 0 {
+				backend = strconv.Itoa(owner.Port)
+			}
+			//nolint:errcheck // terminal output
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", kind, name, owner.Container, owner.Label, backend, status)
+		}
+	}
+	_ = w.Flush() //nolint:errcheck // terminal output
+
+	for _, claim := range claims {
+		switch claim.Status {
+		case docker.ClaimConflict:
+			conflicts++
+		case docker.ClaimNearMiss:
+			nearMisses++
+		default:
+			continue
+		}
+		if conflicts+nearMisses == 1 {
+			_, _ = fmt.Fprintln(out) //nolint:errcheck // terminal output
+		}
+		_, _ = fmt.Fprintf(out, "%-9s %s %s: %s\n", claim.Status, claim.Kind, claim.Name, claim.Note) //nolint:errcheck // terminal output
+	}
+	return conflicts, nearMisses
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the local nginx supports the configured features",
+	Long: `Runs nginx -V and reports which optional modules the local nginx build has:
+
+- HTTP/2 and HTTP/3, used by --http2, --http3 and proxy.http.http2/http3
+- ModSecurity, used by hosts with proxy.http.waf
+- the upstream check module, used for active proxy.http.healthcheck probes
+
+Also checks that the --waf-rules file exists. Remote targets (SSH, object
+storage, Kubernetes, fan-out) run their own nginx and are not checked.
+
+Exits non-zero if a configured feature cannot work.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		ctx, cancel := context.WithTimeout(context.Background(), capabilityProbeTimeout)
+		defer cancel()
+		caps, err := nginx.ProbeCapabilities(ctx, cfg.NginxBinary, log)
+		if err != nil {
+			return logError("nginx check failed: %w", err)
+		}
+		fmt.Printf("✓ nginx %s\n", caps.Version)
+
+		problems := 0
+		check := func(ok, required bool, feature, missing string) {
+			switch {
+			case ok:
+				fmt.Printf("✓ %s\n", feature)
+			case required:
+				problems++
+				fmt.Printf("✗ %s: %s\n", feature, missing)
+			default:
+				fmt.Printf("- %s: not available (not configured)\n", feature)
+			}
+		}
+
+		check(caps.HTTP2, cfg.HTTP2, "HTTP/2", "nginx is built without --with-http_v2_module, --http2 is ignored")
+		check(caps.HTTP3, cfg.HTTP3, "HTTP/3", "nginx is built without --with-http_v3_module, --http3 is ignored")
+		check(caps.ModSecurity, cfg.WAFRules != "", "ModSecurity",
+			"module not found, install ModSecurity-nginx and load_module it; hosts with proxy.http.waf are skipped")
+
+		if !caps.UpstreamCheck {
+			fmt.Println("- upstream check module: not available, proxy.http.healthcheck routes use passive checks")
+		} else {
+			fmt.Println("✓ upstream check module")
+		}
+
+		if cfg.WAFRules != "" {
+			_, statErr := os.Stat(cfg.WAFRules)
+			check(statErr == nil, true, "WAF rules "+cfg.WAFRules, fmt.Sprintf("%v", statErr))
+		}
+
+		if problems > 0 {
+			return &ExitError{Code: 1, Err: fmt.Errorf("%d doctor checks failed", problems)}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
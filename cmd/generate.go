@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/moontechs/proxy/docker"
-	"github.com/moontechs/proxy/nginx"
 	"github.com/spf13/cobra"
 )
 
@@ -31,7 +29,7 @@ Generates two config files:
 		log.Logf("INFO [Generate] starting config generation")
 
 		// Connect to Docker
-		dockerClient, err := docker.NewClient(cfg.DockerHost, log)
+		dockerClient, err := newDockerClient(cfg, log)
 		if err != nil {
 			return logError("docker connection failed: %w", err)
 		}
@@ -41,35 +39,51 @@ Generates two config files:
 			}
 		}()
 
-		// Scan containers
-		ctx := context.Background()
-		containers, err := dockerClient.ScanContainers(ctx)
-		if err != nil {
-			return logError("container scan failed: %w", err)
+		if err := dockerClient.CheckAPIVersion(dockerFeatures(cfg, false)...); err != nil {
+			return logError("docker API check failed: %w", err)
 		}
 
-		log.Logf("INFO [Generate] discovered containers=%d", len(containers))
-
 		// Generate configs
-		generator, err := nginx.NewGenerator(cfg.StreamConfigPath, cfg.HTTPConfigPath, log)
+		generator, err := newGenerator(cfg, log)
 		if err != nil {
 			return logError("generator initialization failed: %w", err)
 		}
 
-		changed, err := generator.Generate(containers)
+		pipe, err := newPipeline(dockerClient, generator, nil, nil, cfg.StateFile, log)
+		if err != nil {
+			return logError("state initialization failed: %w", err)
+		}
+
+		// Scan containers and write configs
+		report, err := pipe.runWithoutReload(context.Background())
 		if err != nil {
 			return logError("config generation failed: %w", err)
 		}
 
-		if !changed {
+		if !report.Changed() {
 			log.Logf("INFO [Generate] configs unchanged, no action needed")
 			return nil
 		}
 
 		log.Logf("INFO [Generate] configs written successfully")
 		fmt.Println("✓ Nginx configurations generated successfully")
-		fmt.Printf("  Stream config: %s\n", cfg.StreamConfigPath)
-		fmt.Printf("  HTTP config: %s\n", cfg.HTTPConfigPath)
+		fmt.Printf("  Stream config: %s (sha256 %s)\n", report.Stream.Path, report.Stream.Checksum[:12])
+		fmt.Printf("  HTTP config: %s (sha256 %s)\n", report.HTTP.Path, report.HTTP.Checksum[:12])
+		for _, ns := range report.Namespaces {
+			if ns.Error != "" {
+				fmt.Printf("  Namespace %s: kept previous configs, %s\n", ns.Name, ns.Error)
+				continue
+			}
+			fmt.Printf("  Namespace %s: %s, %s\n", ns.Name, ns.Stream.Path, ns.HTTP.Path)
+		}
+		fmt.Printf("  Routes: %d added, %d removed, %d changed\n",
+			len(report.Changes.Added), len(report.Changes.Removed), len(report.Changes.Changed))
+		for _, ctr := range report.Skipped {
+			fmt.Printf("  Skipped %s: %s\n", ctr.Name, ctr.Reason)
+		}
+		for _, d := range report.Denied {
+			fmt.Printf("  Denied %s %s: %s\n", d.Container, d.Route, d.Reason)
+		}
 
 		return nil
 	},
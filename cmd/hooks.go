@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+)
+
+// hook stages, the event type posted to hook URLs is "hook.<stage>"
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+// hookWaitDelay bounds the wait for output pipes once a timed out hook command was killed
+const hookWaitDelay = 5 * time.Second
+
+// hooks run commands and post to URLs around each reload with the changed routes,
+// for integrations like a CDN purge or a DNS update without changes to the proxy
+type hooks struct {
+	cfg      config.Hooks
+	preURLs  *notify.Notifier
+	postURLs *notify.Notifier
+	log      *lgr.Logger
+}
+
+// newHooks returns the hooks of the settings, nil when none is set
+func newHooks(cfg config.Hooks, log *lgr.Logger) (*hooks, error) {
+	if cfg.Pre == "" && cfg.Post == "" && len(cfg.PreURLs) == 0 && len(cfg.PostURLs) == 0 {
+		return nil, nil
+	}
+	for _, cmdline := range []string{cfg.Pre, cfg.Post} {
+		if cmdline == "" {
+			continue
+		}
+		if _, err := nginx.SplitCommand(cmdline); err != nil {
+			return nil, fmt.Errorf("invalid hook command: %w", err)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid hook-timeout %s, expected a positive duration", cfg.Timeout)
+	}
+	return &hooks{
+		cfg:      cfg,
+		preURLs:  notify.NewWithTimeout(cfg.PreURLs, cfg.Timeout, log),
+		postURLs: notify.NewWithTimeout(cfg.PostURLs, cfg.Timeout, log),
+		log:      log,
+	}, nil
+}
+
+// run calls the command and URLs of a stage with the changes applied to target
+// Every hook of the stage is called, the returned error joins their failures
+func (h *hooks) run(ctx context.Context, stage, target string, changes state.Changes) error {
+	cmdline, urls := h.cfg.Pre, h.preURLs
+	if stage == hookPost {
+		cmdline, urls = h.cfg.Post, h.postURLs
+	}
+	event := hookEvent(stage, target, changes)
+
+	var errs []error
+	if cmdline != "" {
+		started := time.Now()
+		out, err := h.command(ctx, cmdline, event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s-hook command failed: %w\nOutput: %s", stage, err, out))
+		} else {
+			h.log.Logf("INFO [Hooks] command finished hook=%s duration=%s output=%q",
+				stage, time.Since(started).Round(time.Millisecond), strings.TrimSpace(string(out)))
+		}
+	}
+	if urls.Enabled() {
+		if err := urls.Send(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s-hook %w", stage, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// command runs a hook command with the changes in PROXY_* variables and as JSON on stdin
+func (h *hooks) command(ctx context.Context, cmdline string, event notify.Event) ([]byte, error) {
+	args, err := nginx.SplitCommand(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode changes: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Timeout)
+	defer cancel()
+	// #nosec G204 -- command line is from trusted configuration, not user input
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.WaitDelay = hookWaitDelay
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = os.Environ()
+	for key, value := range event.Details {
+		cmd.Env = append(cmd.Env, "PROXY_"+strings.ToUpper(key)+"="+value)
+	}
+	return cmd.CombinedOutput()
+}
+
+// hookEvent describes the changes of a reload, details hold comma-separated container names
+// per change and the HTTP hostnames of all changed containers, e.g. to purge their caches
+func hookEvent(stage, target string, changes state.Changes) notify.Event {
+	var hostnames []string
+	seen := make(map[string]bool)
+	names := func(containers []state.Container) string {
+		list := make([]string, 0, len(containers))
+		for _, ctr := range containers {
+			list = append(list, ctr.Name)
+			for _, route := range ctr.Routes {
+				name, _, _ := strings.Cut(route, " -> ")
+				if host, ok := strings.CutPrefix(name, "http:"); ok && !seen[host] {
+					seen[host] = true
+					hostnames = append(hostnames, host)
+				}
+			}
+		}
+		return strings.Join(list, ",")
+	}
+
+	details := map[string]string{
+		"hook":      stage,
+		"target":    target,
+		"added":     names(changes.Added),
+		"changed":   names(changes.Changed),
+		"removed":   names(changes.Removed),
+		"relabeled": names(changes.Relabeled),
+	}
+	sort.Strings(hostnames)
+	details["hostnames"] = strings.Join(hostnames, ",")
+
+	return notify.Event{
+		Type: "hook." + stage,
+		Message: fmt.Sprintf("%s-hook for %s: %d added, %d changed, %d removed", stage, target,
+			len(changes.Added), len(changes.Changed), len(changes.Removed)),
+		Details: details,
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+)
+
+func TestHooksRun(t *testing.T) {
+	dir := t.TempDir()
+	envFile, stdinFile := filepath.Join(dir, "env"), filepath.Join(dir, "stdin")
+
+	var posted []notify.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		posted = append(posted, event)
+		if event.Type == "hook.pre" {
+			http.Error(w, "frozen", http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+
+	h, err := newHooks(config.Hooks{
+		Pre:      "sh -c 'exit 1'",
+		Post:     "sh -c 'env | grep ^PROXY_ > " + envFile + "; cat > " + stdinFile + "'",
+		PreURLs:  []string{srv.URL},
+		PostURLs: []string{srv.URL},
+		Timeout:  5 * time.Second,
+	}, lgr.New())
+	if err != nil {
+		t.Fatalf("newHooks() error = %v", err)
+	}
+	changes := state.Changes{
+		Added:   []state.Container{{Name: "app", Routes: []string{"http:app.example.com -> 172.17.0.2:8080", "tcp:5432 -> 172.17.0.2:5432"}}},
+		Removed: []state.Container{{Name: "old", Routes: []string{"http:old.example.com -> 172.17.0.3:8080"}}},
+	}
+
+	// a failing pre-hook reports the command and the URL
+	err = h.run(context.Background(), hookPre, "local", changes)
+	if err == nil || !strings.Contains(err.Error(), "pre-hook command failed") || !strings.Contains(err.Error(), "status 409") {
+		t.Errorf("pre-hook error = %v, want the command and URL failures", err)
+	}
+
+	if err := h.run(context.Background(), hookPost, "local", changes); err != nil {
+		t.Fatalf("post-hook error = %v", err)
+	}
+	env, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("post-hook command did not run: %v", err)
+	}
+	for _, want := range []string{"PROXY_HOOK=post", "PROXY_TARGET=local", "PROXY_ADDED=app", "PROXY_REMOVED=old",
+		"PROXY_HOSTNAMES=app.example.com,old.example.com"} {
+		if !strings.Contains(string(env), want+"\n") {
+			t.Errorf("hook environment misses %s:\n%s", want, env)
+		}
+	}
+	var stdin notify.Event
+	if data, err := os.ReadFile(stdinFile); err != nil || json.Unmarshal(data, &stdin) != nil || stdin.Type != "hook.post" {
+		t.Errorf("hook stdin = %+v, %v, want the post event", stdin, err)
+	}
+	if len(posted) != 2 || posted[1].Type != "hook.post" || posted[1].Details["added"] != "app" {
+		t.Errorf("posted = %+v, want the pre and post events", posted)
+	}
+}
+
+func TestNewHooks(t *testing.T) {
+	if h, err := newHooks(config.Hooks{Timeout: time.Second}, lgr.New()); h != nil || err != nil {
+		t.Errorf("newHooks() without hooks = %v, %v, want disabled", h, err)
+	}
+	for _, cfg := range []config.Hooks{{Pre: "purge 'cdn", Timeout: time.Second}, {Post: "purge", Timeout: 0}} {
+		if _, err := newHooks(cfg, lgr.New()); err == nil {
+			t.Errorf("newHooks(%+v) should fail", cfg)
+		}
+	}
+}
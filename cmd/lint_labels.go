@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/docker"
+	"github.com/spf13/cobra"
+)
+
+var lintLabelsCmd = &cobra.Command{
+	Use:   "lint-labels",
+	Short: "Check container proxy labels and report problems with suggested fixes",
+	Long: `Checks the proxy.* labels of all running containers, or of the services
+in a Compose file with --compose-file, without generating configs.
+
+Every problem is listed with the container, label and a suggested fix:
+invalid ports and hostnames, misspelled or ignored labels, incomplete TLS
+secrets, ports or hostnames claimed by more than one container and routes
+denied by --policy-hostnames or --policy-ports.
+
+Exits non-zero if any error is found, warnings alone exit zero.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		composeFile, _ := cmd.Flags().GetString("compose-file") //nolint:errcheck // flag is predefined
+
+		var labels map[string]map[string]string
+		var err error
+		if composeFile != "" {
+			labels, err = docker.LoadComposeLabels(composeFile)
+			if err != nil {
+				return logError("compose file load failed: %w", err)
+			}
+		} else if labels, err = runningLabels(cfg, log, "Lint"); err != nil {
+			return err
+		}
+
+		policy, err := docker.ParsePolicy(cfg.PolicyHostnames, cfg.PolicyPorts)
+		if err != nil {
+			return logError("invalid policy: %w", err)
+		}
+		issues := append(docker.LintLabels(labels), policy.Lint(labels)...)
+		sort.SliceStable(issues, func(i, j int) bool { return issues[i].Container < issues[j].Container })
+		errorCount := 0
+		for _, issue := range issues {
+			if issue.Severity == docker.SeverityError {
+				errorCount++
+			}
+			fmt.Printf("%-7s %s: %s=%q: %s\n", issue.Severity, issue.Container, issue.Label, issue.Value, issue.Message)
+			if issue.Fix != "" {
+				fmt.Printf("        fix: %s\n", issue.Fix)
+			}
+		}
+
+		if len(issues) == 0 {
+			fmt.Printf("✓ No label problems found in %d containers\n", len(labels))
+			return nil
+		}
+		fmt.Printf("\n%d containers checked, %d errors, %d warnings\n", len(labels), errorCount, len(issues)-errorCount)
+
+		if errorCount > 0 {
+			return &ExitError{Code: 1, Err: fmt.Errorf("%d label errors found", errorCount)}
+		}
+		return nil
+	},
+}
+
+func init() {
+	lintLabelsCmd.Flags().String("compose-file", "", "Check the services of a Compose file instead of running containers")
+	rootCmd.AddCommand(lintLabelsCmd)
+}
+
+// runningLabels returns the proxy labels of the running containers, keyed by container name
+// Errors are logged under component
+func runningLabels(cfg *config.Config, log *lgr.Logger, component string) (map[string]map[string]string, error) {
+	dockerClient, err := newDockerClient(cfg, log)
+	if err != nil {
+		return nil, logError("docker connection failed: %w", err)
+	}
+	defer func() {
+		if closeErr := dockerClient.Close(); closeErr != nil {
+			log.Logf("WARN [%s] failed to close docker client: %v", component, closeErr)
+		}
+	}()
+
+	if err := dockerClient.CheckAPIVersion(dockerFeatures(cfg, false)...); err != nil {
+		return nil, logError("docker API check failed: %w", err)
+	}
+
+	labels, err := dockerClient.ListLabels(context.Background())
+	if err != nil {
+		return nil, logError("container listing failed: %w", err)
+	}
+	return labels, nil
+}
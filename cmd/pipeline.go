@@ -0,0 +1,608 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/acme"
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/metrics"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/state"
+)
+
+// pipeline event types sent to webhooks and the admin API
+const (
+	eventConfigReloaded = "config.reloaded"
+	eventConfigFailed   = "config.failed"
+	eventConfigDrift    = "config.drift"
+	eventConfigWarmedUp = "config.warmed_up"
+
+	// escalation once the failure budget is exhausted, and the first successful run after it
+	eventBudgetExhausted = "config.budget_exhausted"
+	eventConfigRecovered = "config.recovered"
+
+	// per container, once its route changes are applied
+	eventRouteAdded   = "route.added"
+	eventRouteChanged = "route.changed"
+	eventRouteRemoved = "route.removed"
+)
+
+// DockerScanner finds routable containers and streams their events, implemented by docker.Client
+type DockerScanner interface {
+	Scan(ctx context.Context) (docker.ScanResult, error)
+	WatchEvents(ctx context.Context) (<-chan docker.ContainerEvent, <-chan error)
+}
+
+// Validator checks the generated configs, implemented by nginx.Validator
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// Reloader applies validated configs to nginx, implemented by nginx.Reloader
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// pipeline performs the full workflow: scan → generate → deliver/validate → reload
+// and tracks the applied routes in the persisted state file
+type pipeline struct {
+	scanner DockerScanner
+	gen     *nginx.Generator
+	val     Validator         // local validation without reload, nil skips it
+	target  delivery.Target   // where changed configs are applied, nil for generate-only
+	events  notify.Sink       // reload and failure events, nil disables them
+	metrics *metrics.Registry // drift and convergence gauges, nil disables them
+	certs   *acme.Issuer      // certificates for the HTTPS hosts of applied routes, nil disables issuance
+	warmup  *warmer           // requests to added routes after a reload, nil disables them
+	hooks   *hooks            // commands and URLs called around a reload, nil disables them
+	log     *lgr.Logger
+
+	// readOnly renders and compares configs without delivering them or persisting state
+	readOnly bool
+
+	// mu serializes runs from the watcher and the admin API and guards applied
+	mu sync.Mutex
+
+	// pending are the route events of the current run and warming its report to warm up, both
+	// done once p.mu is released; eventsMu keeps consecutive runs in order
+	pending  []notify.Event
+	warming  *nginx.Report
+	eventsMu sync.Mutex
+
+	// queueMu guards queued, the one run waiting for the current one to finish
+	queueMu sync.Mutex
+	queued  *queuedRun
+
+	targets string    // per-target status of a fan-out delivery in this run, empty if none
+	change  time.Time // next route expiry or schedule window change of the last scan, zero if none
+
+	statePath string          // empty disables state persistence
+	applied   *state.Snapshot // routes applied by the last successful run
+	report    *nginx.Report   // report of the last successful run, nil before the first one
+	startup   bool            // true until the first successful run
+
+	// convergence, unix nanoseconds read by the age gauges without waiting for a run
+	lastSuccess  atomic.Int64 // end of the last successful run, pipeline creation before the first one
+	pendingSince atomic.Int64 // first failed run since the last successful one, 0 when converged
+
+	// failure budget, escalated by exhaust once failureBudget runs in a row failed
+	failureBudget int             // 0 disables it
+	onExhausted   func(err error) // called when the budget is exhausted, nil keeps watching
+	failures      atomic.Int64    // consecutive failed runs, 0 after a successful one
+}
+
+// newPipeline creates a pipeline and loads the state persisted by a previous run
+func newPipeline(scanner DockerScanner, gen *nginx.Generator, val Validator,
+	target delivery.Target, statePath string, log *lgr.Logger) (*pipeline, error) {
+	p := &pipeline{
+		scanner:   scanner,
+		gen:       gen,
+		val:       val,
+		target:    target,
+		log:       log,
+		statePath: statePath,
+		applied:   &state.Snapshot{},
+		startup:   true,
+	}
+	p.lastSuccess.Store(time.Now().UnixNano())
+
+	if statePath != "" {
+		snap, err := state.Load(statePath)
+		if err != nil {
+			return nil, err
+		}
+		p.applied = snap
+		log.Logf("DEBUG [Pipeline] loaded state path=%s containers=%d", statePath, len(snap.Containers))
+	}
+
+	return p, nil
+}
+
+// queuedRun is a run waiting for the current one, shared by every caller arriving meanwhile
+type queuedRun struct {
+	done chan struct{}
+	err  error
+}
+
+// run scans containers, regenerates configs and reloads nginx if they changed
+// Runs never overlap: while one is in progress at most one more is queued, and callers
+// arriving meanwhile share its result, since its scan starts after their changes
+func (p *pipeline) run(ctx context.Context) error {
+	p.queueMu.Lock()
+	if q := p.queued; q != nil {
+		p.queueMu.Unlock()
+		p.log.Logf("DEBUG [Pipeline] run already queued, waiting for its result")
+		select {
+		case <-q.done:
+			return q.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	q := &queuedRun{done: make(chan struct{})}
+	p.queued = q
+	p.queueMu.Unlock()
+
+	p.mu.Lock()
+	defer close(q.done)
+	defer p.finishRun(ctx)
+
+	// started, callers from now on queue the next run
+	p.queueMu.Lock()
+	p.queued = nil
+	p.queueMu.Unlock()
+
+	q.err = p.runLocked(ctx)
+	return q.err
+}
+
+// runLocked does one run and reports its outcome, the caller holds p.mu
+func (p *pipeline) runLocked(ctx context.Context) error {
+	err := p.apply(ctx)
+	previous := p.converged(err)
+	budget := int64(p.failureBudget)
+	if err != nil {
+		event := notify.Event{Type: eventConfigFailed, Message: err.Error()}
+		if p.targets != "" {
+			event.Details = map[string]string{"targets": p.targets}
+		}
+		p.notify(ctx, event)
+		if budget > 0 && previous+1 == budget {
+			p.exhaust(ctx, err)
+		}
+		return err
+	}
+	if budget > 0 && previous >= budget {
+		p.log.Logf("INFO [Pipeline] recovered from failure budget failures=%d", previous)
+		p.notify(ctx, notify.Event{
+			Type:    eventConfigRecovered,
+			Message: fmt.Sprintf("configs applied again after %d failed runs", previous),
+			Details: map[string]string{"failures": strconv.FormatInt(previous, 10)},
+		})
+	}
+	return nil
+}
+
+// converged records the outcome of a run for the age gauges and the failure budget
+// It returns the number of consecutive failed runs before this one
+func (p *pipeline) converged(err error) int64 {
+	now := time.Now().UnixNano()
+	if err != nil {
+		p.pendingSince.CompareAndSwap(0, now)
+		return p.failures.Add(1) - 1
+	}
+	p.lastSuccess.Store(now)
+	p.pendingSince.Store(0)
+	return p.failures.Swap(0)
+}
+
+// exhaust escalates the run using up the failure budget, so orchestrators or a human act
+// instead of the watcher retrying silently: a critical webhook, /readyz failing until the
+// next successful run and onExhausted, e.g. to exit
+func (p *pipeline) exhaust(ctx context.Context, err error) {
+	p.log.Logf("ERROR [Pipeline] failure budget exhausted failures=%d error=%q", p.failureBudget, err)
+	p.notify(ctx, notify.Event{
+		Type:    eventBudgetExhausted,
+		Message: fmt.Sprintf("%d runs in a row failed, last error: %v", p.failureBudget, err),
+		Details: map[string]string{"severity": "critical", "failures": strconv.Itoa(p.failureBudget), "error": err.Error()},
+	})
+	if p.onExhausted != nil {
+		p.onExhausted(err)
+	}
+}
+
+// ready fails while the failure budget is exhausted, served on /readyz
+func (p *pipeline) ready() error {
+	if n := p.failures.Load(); p.failureBudget > 0 && n >= int64(p.failureBudget) {
+		return fmt.Errorf("%d runs in a row failed, failure budget is %d", n, p.failureBudget)
+	}
+	return nil
+}
+
+// setMetrics enables the drift and convergence gauges
+// The ages let alerts fire when the watcher runs but keeps failing to apply changes
+func (p *pipeline) setMetrics(registry *metrics.Registry) {
+	p.metrics = registry
+	registry.SetFunc("proxy_last_success_age_seconds",
+		"Seconds since the last successful generation, or since start before the first one", nil,
+		func() float64 { return ageSeconds(p.lastSuccess.Load()) })
+	registry.SetFunc("proxy_pending_change_age_seconds",
+		"Seconds since a change failed to apply, 0 when the last run succeeded", nil,
+		func() float64 { return ageSeconds(p.pendingSince.Load()) })
+	registry.SetFunc("proxy_consecutive_failures",
+		"Failed runs since the last successful one", nil,
+		func() float64 { return float64(p.failures.Load()) })
+	// alert before generations fail, e.g. proxy_config_usage / proxy_config_limit > 0.8
+	for _, gauge := range limitGauges {
+		labels := metrics.Labels{"limit": gauge.limit}
+		registry.SetFunc("proxy_config_usage", "Routes, servers of the largest upstream and bytes of the largest config of the last generation",
+			labels, func() float64 { used, _ := gauge.value(p.gen.Usage()); return float64(used) })
+		registry.SetFunc("proxy_config_limit", "Limit of proxy_config_usage, 0 is disabled",
+			labels, func() float64 { _, limit := gauge.value(p.gen.Usage()); return float64(limit) })
+	}
+	registry.SetReady(p.ready)
+}
+
+// limitGauges are the config limits exported by setMetrics
+var limitGauges = []struct {
+	limit string
+	value func(nginx.Usage) (used, limit int)
+}{
+	{"routes", func(u nginx.Usage) (int, int) { return u.Routes, u.Limits.Routes }},
+	{"upstream_servers", func(u nginx.Usage) (int, int) { return u.UpstreamServers, u.Limits.UpstreamServers }},
+	{"config_size_bytes", func(u nginx.Usage) (int, int) { return u.ConfigSize, u.Limits.ConfigSize }},
+}
+
+// ageSeconds returns the seconds since a unix nanosecond time, 0 for the zero time
+func ageSeconds(since int64) float64 {
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since)).Seconds()
+}
+
+// apply does the work of run, the caller holds p.mu
+func (p *pipeline) apply(ctx context.Context) error {
+	p.targets = ""
+	report, err := p.generate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if p.readOnly {
+		p.reportDrift(ctx)
+		p.commit(ctx, report)
+		return nil
+	}
+
+	// configs written by a failed run are unchanged now but still not applied
+	if !report.Changed() && p.pendingSince.Load() == 0 {
+		p.log.Logf("INFO [Pipeline] configs unchanged, skipping reload")
+		p.commit(ctx, report)
+		return nil
+	}
+
+	// deliver, validate and reload
+	files, err := p.files()
+	if err != nil {
+		return err
+	}
+	if p.hooks != nil {
+		if err := p.hooks.run(ctx, hookPre, p.target.Name(), report.Changes); err != nil {
+			return fmt.Errorf("reload cancelled by %w", err)
+		}
+	}
+	err = p.target.Apply(ctx, files)
+	if fanOut, ok := p.target.(*delivery.FanOut); ok {
+		p.targets = fanOut.Summary()
+	}
+	if err != nil {
+		return fmt.Errorf("target %s: %w", p.target.Name(), err)
+	}
+
+	p.log.Logf("INFO [Pipeline] configs reloaded successfully target=%s", p.target.Name())
+	if p.hooks != nil {
+		if err := p.hooks.run(ctx, hookPost, p.target.Name(), report.Changes); err != nil {
+			p.log.Logf("WARN [Hooks] %v", err)
+		}
+	}
+	details := report.Details()
+	details["target"] = p.target.Name()
+	if p.targets != "" {
+		details["targets"] = p.targets
+	}
+	p.notify(ctx, notify.Event{
+		Type:    eventConfigReloaded,
+		Message: "configs reloaded on " + p.target.Name(),
+		Details: details,
+	})
+	p.commit(ctx, report)
+	if p.warmup != nil {
+		p.warming = p.report
+	}
+	return nil
+}
+
+// runWithoutReload scans and regenerates configs without touching nginx
+// Configs are validated when a validator is set, e.g. before run mode starts nginx
+func (p *pipeline) runWithoutReload(ctx context.Context) (nginx.Report, error) {
+	p.mu.Lock()
+	defer p.finishRun(ctx)
+
+	report, err := p.generate(ctx)
+	if err != nil {
+		p.converged(err)
+		return nginx.Report{}, err
+	}
+
+	if p.val != nil {
+		if err := p.val.Validate(ctx); err != nil {
+			p.converged(err)
+			return report, fmt.Errorf("%w: %w", delivery.ErrValidation, err)
+		}
+	}
+
+	p.commit(ctx, report)
+	p.converged(nil)
+	return report, nil
+}
+
+// generate scans containers, writes configs and logs route changes
+func (p *pipeline) generate(ctx context.Context) (nginx.Report, error) {
+	// tampered configs differ from the regenerated ones, so they are replaced and reloaded below
+	if p.readOnly {
+		p.log.Logf("DEBUG [Pipeline] read-only, skipping signature verification")
+	} else if err := p.gen.VerifySignatures(); err != nil {
+		p.log.Logf("ERROR [Pipeline] signature verification failed, restoring generated configs error=%q", err)
+	}
+
+	// scan containers
+	scan, err := p.scanner.Scan(ctx)
+	if err != nil {
+		return nginx.Report{}, fmt.Errorf("scan failed: %w", err)
+	}
+	containers := scan.Containers
+
+	p.log.Logf("INFO [Pipeline] scanned containers=%d skipped=%d", len(containers), len(scan.Skipped))
+
+	p.change = scan.NextChange
+
+	// route changes are reported against the applied routes, not a generation that failed to apply
+	p.gen.SetPreviousRoutes(p.applied)
+	report, err := p.gen.GenerateContext(ctx, containers, scan.Skipped...)
+	if err != nil {
+		return nginx.Report{}, fmt.Errorf("generation failed: %w", err)
+	}
+	p.logChanges(report.Changes)
+
+	// routes on the restart page are removed by the run after their grace period
+	if until := p.gen.RestartPageUntil(); !until.IsZero() && (p.change.IsZero() || until.Before(p.change)) {
+		p.change = until
+	}
+
+	return report, nil
+}
+
+// nextChange returns when the routes of the last scan change next, as a route expires,
+// a schedule window opens or closes or the restart page of a gone container ends; zero if they never do
+func (p *pipeline) nextChange() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.change
+}
+
+// files reads the generated configs for delivery
+func (p *pipeline) files() ([]delivery.File, error) {
+	streamPath, httpPath := p.gen.ConfigPaths()
+
+	files := []delivery.File{
+		{Kind: delivery.KindStream, LocalPath: streamPath},
+		{Kind: delivery.KindHTTP, LocalPath: httpPath},
+	}
+	for i := range files {
+		// #nosec G304 -- path is from trusted configuration, not user input
+		content, err := os.ReadFile(files[i].LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generated config: %w", err)
+		}
+		files[i].Content = content
+	}
+	return files, nil
+}
+
+// logChanges reports route changes per container
+// On startup, removed containers are the ones that died while the watcher was down
+func (p *pipeline) logChanges(changes state.Changes) {
+	for _, ctr := range changes.Removed {
+		reason := "container gone"
+		if p.startup {
+			reason = "container gone while watcher was down"
+		}
+		for _, route := range ctr.Routes {
+			p.log.Logf("WARN [Pipeline] removing stale route container=%s id=%s route=%q reason=%q",
+				ctr.Name, ctr.ID, route, reason)
+		}
+	}
+	for _, ctr := range changes.Added {
+		p.log.Logf("INFO [Pipeline] routes added container=%s routes=%d", ctr.Name, len(ctr.Routes))
+	}
+	for _, ctr := range changes.Changed {
+		p.log.Logf("INFO [Pipeline] routes changed container=%s routes=%d", ctr.Name, len(ctr.Routes))
+	}
+	for _, ctr := range changes.Relabeled {
+		p.log.Logf("INFO [Pipeline] labels changed container=%s routes=%d", ctr.Name, len(ctr.Routes))
+	}
+}
+
+// reportDrift publishes how the configs on disk differ from the rendered ones in read-only mode
+func (p *pipeline) reportDrift(ctx context.Context) {
+	details := make(map[string]string)
+	var drifted []string
+	for _, d := range p.gen.Drift() {
+		if p.metrics != nil {
+			p.metrics.Set("proxy_config_drift_lines", "Lines differing between the rendered and the on-disk config",
+				metrics.Labels{"config": d.Config, "change": "added"}, float64(d.Added))
+			p.metrics.Set("proxy_config_drift_lines", "Lines differing between the rendered and the on-disk config",
+				metrics.Labels{"config": d.Config, "change": "removed"}, float64(d.Removed))
+		}
+		details[d.Config+"_added"] = strconv.Itoa(d.Added)
+		details[d.Config+"_removed"] = strconv.Itoa(d.Removed)
+		if d.Changed() {
+			drifted = append(drifted, d.Path)
+		}
+	}
+
+	if len(drifted) == 0 {
+		p.log.Logf("INFO [Pipeline] read-only, configs on disk match the rendered ones")
+		return
+	}
+
+	p.log.Logf("WARN [Pipeline] read-only, configs on disk differ from the rendered ones, skipping delivery and reload paths=%s",
+		strings.Join(drifted, ","))
+	p.notify(ctx, notify.Event{
+		Type:    eventConfigDrift,
+		Message: "configs on disk differ from the rendered ones: " + strings.Join(drifted, ", "),
+		Details: details,
+	})
+}
+
+// routes returns the routes applied by the last successful run
+func (p *pipeline) routes() *state.Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.applied
+}
+
+// lastReport returns the report of the last successful run, nil before the first one
+func (p *pipeline) lastReport() *nginx.Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.report
+}
+
+// notifyRoutes queues an event per container with added, changed or removed routes, sent
+// together by finishRun after the run
+func (p *pipeline) notifyRoutes(previous *state.Snapshot, changes state.Changes) {
+	if p.events == nil {
+		return
+	}
+
+	event := func(typ, verb string, ctr state.Container) notify.Event {
+		return notify.Event{
+			Type:    typ,
+			Message: fmt.Sprintf("routes %s for %s", verb, ctr.Name),
+			Details: map[string]string{
+				"container": ctr.Name,
+				"id":        ctr.ID,
+				"routes":    strings.Join(ctr.Routes, ", "),
+			},
+		}
+	}
+	for _, ctr := range changes.Added {
+		p.pending = append(p.pending, event(eventRouteAdded, "added", ctr))
+	}
+	for _, ctr := range changes.Changed {
+		e := event(eventRouteChanged, "changed", ctr)
+		for _, old := range previous.Containers {
+			if old.Name == ctr.Name {
+				e.Details["previous_routes"] = strings.Join(old.Routes, ", ")
+			}
+		}
+		p.pending = append(p.pending, e)
+	}
+	for _, ctr := range changes.Removed {
+		p.pending = append(p.pending, event(eventRouteRemoved, "removed", ctr))
+	}
+}
+
+// finishRun releases p.mu, then sends the route events queued by the run and warms up its
+// routes, so slow sinks and backends never hold up the next run
+func (p *pipeline) finishRun(ctx context.Context) {
+	events, warming := p.pending, p.warming
+	p.pending, p.warming = nil, nil
+	p.eventsMu.Lock()
+	defer p.eventsMu.Unlock()
+	p.mu.Unlock()
+
+	for _, event := range events {
+		p.notify(ctx, event)
+	}
+	if warming != nil {
+		p.warmUp(ctx, warming)
+	}
+}
+
+// warmUp requests the added and changed routes of an applied report and adds the results to
+// it, unless a later run replaced it meanwhile
+func (p *pipeline) warmUp(ctx context.Context, report *nginx.Report) {
+	results := p.warmup.warm(ctx, report.Changes)
+	if len(results) == 0 {
+		return
+	}
+	details := nginx.Report{Warmups: results}.Details()
+	p.notify(ctx, notify.Event{
+		Type:    eventConfigWarmedUp,
+		Message: fmt.Sprintf("%s of %d routes warmed up", details["warmed_up"], len(results)),
+		Details: map[string]string{"warmed_up": details["warmed_up"], "warmup_failed": details["warmup_failed"]},
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.report != report {
+		return
+	}
+	// readers of routes and lastReport hold the previous values, they are replaced, not changed
+	warmed := *report
+	warmed.Warmups = results
+	p.report = &warmed
+	if p.statePath == "" {
+		return
+	}
+	snap := *p.applied
+	snap.Report = warmed.Summary()
+	p.applied = &snap
+	if err := snap.Save(p.statePath); err != nil {
+		p.log.Logf("WARN [Pipeline] failed to persist state error=%q", err)
+	}
+}
+
+// notify sends an event if events are enabled
+func (p *pipeline) notify(ctx context.Context, event notify.Event) {
+	if p.events != nil {
+		p.events.Notify(ctx, event)
+	}
+}
+
+// commit records the routes of a successfully applied report and persists them
+// Certificates are requested and route events sent here, once the changes are served
+func (p *pipeline) commit(ctx context.Context, report nginx.Report) {
+	previous, current := p.applied, report.Routes
+	p.applied = current
+	p.report = &report
+	p.startup = false
+
+	if p.readOnly {
+		return
+	}
+	p.notifyRoutes(previous, report.Changes)
+	if p.certs != nil {
+		p.certs.Request(report.ACMEHostnames)
+	}
+	if p.statePath == "" {
+		return
+	}
+	current.Report = report.Summary()
+	if err := current.Save(p.statePath); err != nil {
+		p.log.Logf("WARN [Pipeline] failed to persist state error=%q", err)
+	}
+}
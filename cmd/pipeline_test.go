@@ -0,0 +1,446 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/metrics"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+)
+
+// fakeScanner returns a fixed scan result and streams the events sent to its channels
+type fakeScanner struct {
+	result docker.ScanResult
+	err    error
+	events chan docker.ContainerEvent
+	errs   chan error
+}
+
+func (s *fakeScanner) Scan(context.Context) (docker.ScanResult, error) {
+	return s.result, s.err
+}
+
+func (s *fakeScanner) WatchEvents(context.Context) (<-chan docker.ContainerEvent, <-chan error) {
+	return s.events, s.errs
+}
+
+// fakeNginx counts validations and reloads, failing them with the configured errors
+type fakeNginx struct {
+	validateErr error
+	reloadErr   error
+
+	mu          sync.Mutex
+	validations int
+	reloads     int
+}
+
+func (n *fakeNginx) Validate(context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.validations++
+	return n.validateErr
+}
+
+func (n *fakeNginx) Reload(context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reloads++
+	return n.reloadErr
+}
+
+func (n *fakeNginx) counts() (validations, reloads int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.validations, n.reloads
+}
+
+// recordedEvents collects pipeline events
+type recordedEvents struct {
+	events []notify.Event
+}
+
+func (r *recordedEvents) Notify(_ context.Context, event notify.Event) {
+	r.events = append(r.events, event)
+}
+
+func (r *recordedEvents) types() []string {
+	types := make([]string, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// newTestPipeline wires a pipeline to fakes, with configs and state in a temp dir
+func newTestPipeline(t *testing.T, scanner *fakeScanner, ngx *fakeNginx) (*pipeline, *recordedEvents) {
+	t.Helper()
+	dir := t.TempDir()
+	log := lgr.New()
+	gen, err := nginx.NewGenerator(filepath.Join(dir, "stream.conf"), filepath.Join(dir, "http.conf"), log)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	pipe, err := newPipeline(scanner, gen, ngx, delivery.NewLocal(ngx, ngx), filepath.Join(dir, "state.json"), log)
+	if err != nil {
+		t.Fatalf("newPipeline() error = %v", err)
+	}
+	events := &recordedEvents{}
+	pipe.events = events
+	return pipe, events
+}
+
+func webScan() docker.ScanResult {
+	return docker.ScanResult{Containers: []docker.ContainerInfo{{
+		Name: "web", ID: "abc123", IP: "172.17.0.2",
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80},
+	}}}
+}
+
+func TestPipelineRun(t *testing.T) {
+	ngx := &fakeNginx{}
+	pipe, events := newTestPipeline(t, &fakeScanner{result: webScan()}, ngx)
+
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if validations, reloads := ngx.counts(); validations != 1 || reloads != 1 {
+		t.Errorf("validations=%d reloads=%d, want one of each", validations, reloads)
+	}
+	if got := events.types(); len(got) != 2 || got[0] != eventConfigReloaded || got[1] != eventRouteAdded {
+		t.Errorf("events = %v, want %s and %s", got, eventConfigReloaded, eventRouteAdded)
+	}
+	if routes := pipe.routes(); len(routes.Containers) != 1 || routes.Containers[0].Name != "web" {
+		t.Errorf("applied routes = %+v, want web", routes.Containers)
+	}
+	if details := events.events[0].Details; details["added"] != "1" || details["http_checksum"] == "" {
+		t.Errorf("event details = %v, want the generation report", details)
+	}
+
+	// an unchanged scan reports no route changes and skips the reload
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("second run() error = %v", err)
+	}
+	report := pipe.lastReport()
+	if report == nil || len(report.Changes.Added) != 0 || len(report.Changes.Changed) != 0 {
+		t.Errorf("second report = %+v, want no route changes", report)
+	}
+}
+
+func TestPipelineRunFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		scanner     *fakeScanner
+		ngx         *fakeNginx
+		wantErr     string
+		wantReloads int
+	}{
+		{
+			name:    "scan",
+			scanner: &fakeScanner{err: errors.New("connection refused")},
+			ngx:     &fakeNginx{},
+			wantErr: "scan failed: connection refused",
+		},
+		{
+			name:    "validation",
+			scanner: &fakeScanner{result: webScan()},
+			ngx:     &fakeNginx{validateErr: errors.New("unknown directive")},
+			wantErr: "validation failed: unknown directive",
+		},
+		{
+			name:        "reload",
+			scanner:     &fakeScanner{result: webScan()},
+			ngx:         &fakeNginx{reloadErr: errors.New("nginx is not running")},
+			wantErr:     "reload failed: nginx is not running",
+			wantReloads: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe, events := newTestPipeline(t, tt.scanner, tt.ngx)
+
+			err := pipe.run(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, reloads := tt.ngx.counts(); reloads != tt.wantReloads {
+				t.Errorf("reloads = %d, want %d", reloads, tt.wantReloads)
+			}
+			if got := events.types(); len(got) != 1 || got[0] != eventConfigFailed {
+				t.Errorf("events = %v, want %s", got, eventConfigFailed)
+			}
+			if routes := pipe.routes(); len(routes.Containers) != 0 {
+				t.Errorf("failed run applied routes %+v", routes.Containers)
+			}
+		})
+	}
+}
+
+func TestPipelineRunWithoutReload(t *testing.T) {
+	ngx := &fakeNginx{}
+	pipe, _ := newTestPipeline(t, &fakeScanner{result: webScan()}, ngx)
+
+	report, err := pipe.runWithoutReload(context.Background())
+	if err != nil || !report.Changed() {
+		t.Fatalf("runWithoutReload() = %+v, %v, want changed configs", report, err)
+	}
+	if validations, reloads := ngx.counts(); validations != 1 || reloads != 0 {
+		t.Errorf("validations=%d reloads=%d, want validation only", validations, reloads)
+	}
+
+	ngx.validateErr = errors.New("unknown directive")
+	if _, err := pipe.runWithoutReload(context.Background()); err == nil {
+		t.Error("runWithoutReload() with invalid configs should fail")
+	}
+}
+
+func TestPipelineConvergenceGauges(t *testing.T) {
+	ngx := &fakeNginx{validateErr: errors.New("unknown directive")}
+	pipe, _ := newTestPipeline(t, &fakeScanner{result: webScan()}, ngx)
+	registry := metrics.NewRegistry()
+	pipe.setMetrics(registry)
+
+	gauge := func(name string) float64 {
+		samples := registry.Samples(name)
+		if len(samples) != 1 {
+			t.Fatalf("%s samples = %+v, want one", name, samples)
+		}
+		return samples[0].Value
+	}
+
+	if got := gauge("proxy_pending_change_age_seconds"); got != 0 {
+		t.Errorf("pending age before any run = %v, want 0", got)
+	}
+
+	// a failing run leaves a pending change that ages
+	if err := pipe.run(context.Background()); err == nil {
+		t.Fatal("run() with invalid configs should fail")
+	}
+	pending := pipe.pendingSince.Load()
+	if pending == 0 || gauge("proxy_pending_change_age_seconds") <= 0 {
+		t.Error("failed run should start the pending change age")
+	}
+	if err := pipe.run(context.Background()); err == nil {
+		t.Fatal("second run() with invalid configs should fail")
+	}
+	if pipe.pendingSince.Load() != pending {
+		t.Error("pending change age should count from the first failed run")
+	}
+	if gauge("proxy_last_success_age_seconds") <= 0 {
+		t.Error("last success age should count from start before the first success")
+	}
+
+	ngx.validateErr = nil
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if got := gauge("proxy_pending_change_age_seconds"); got != 0 {
+		t.Errorf("pending age after a successful run = %v, want 0", got)
+	}
+	if got := gauge("proxy_last_success_age_seconds"); got <= 0 || got > 5 {
+		t.Errorf("last success age = %v, want the time since the run", got)
+	}
+}
+
+func TestPipelineFailureBudget(t *testing.T) {
+	ngx := &fakeNginx{validateErr: errors.New("unknown directive")}
+	pipe, events := newTestPipeline(t, &fakeScanner{result: webScan()}, ngx)
+	pipe.failureBudget = 2
+	var exhausted []error
+	pipe.onExhausted = func(err error) { exhausted = append(exhausted, err) }
+
+	// the budget is exhausted once, by the second failure in a row
+	for range 3 {
+		if err := pipe.run(context.Background()); err == nil {
+			t.Fatal("run() with invalid configs should fail")
+		}
+	}
+	want := []string{eventConfigFailed, eventConfigFailed, eventBudgetExhausted, eventConfigFailed}
+	if got := events.types(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if len(exhausted) != 1 || !strings.Contains(exhausted[0].Error(), "unknown directive") {
+		t.Errorf("onExhausted calls = %v, want one with the last error", exhausted)
+	}
+	if e := events.events[2]; e.Details["severity"] != "critical" || e.Details["failures"] != "2" {
+		t.Errorf("budget event details = %v", e.Details)
+	}
+	if err := pipe.ready(); err == nil || !strings.Contains(err.Error(), "3 runs in a row failed") {
+		t.Errorf("ready() = %v, want not ready", err)
+	}
+
+	// a successful run recovers and resets the budget
+	ngx.validateErr = nil
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if got := events.types(); !slices.Contains(got, eventConfigRecovered) {
+		t.Errorf("events = %v, want %s", got, eventConfigRecovered)
+	}
+	if err := pipe.ready(); err != nil || pipe.failures.Load() != 0 {
+		t.Errorf("ready() = %v, failures = %d after recovery", err, pipe.failures.Load())
+	}
+}
+
+func TestPipelinePreHookVeto(t *testing.T) {
+	ngx := &fakeNginx{}
+	pipe, _ := newTestPipeline(t, &fakeScanner{result: webScan()}, ngx)
+	var err error
+	if pipe.hooks, err = newHooks(config.Hooks{Pre: "sh -c 'exit 1'", Timeout: 5 * time.Second}, lgr.New()); err != nil {
+		t.Fatalf("newHooks() error = %v", err)
+	}
+
+	if err := pipe.run(context.Background()); err == nil || !strings.Contains(err.Error(), "reload cancelled by pre-hook") {
+		t.Fatalf("run() error = %v, want the pre-hook veto", err)
+	}
+	if validations, reloads := ngx.counts(); validations != 0 || reloads != 0 {
+		t.Errorf("validations=%d reloads=%d, want none after a veto", validations, reloads)
+	}
+	if routes := pipe.routes(); len(routes.Containers) != 0 {
+		t.Errorf("vetoed run applied routes %+v", routes.Containers)
+	}
+}
+
+func TestPipelineRouteEvents(t *testing.T) {
+	scanner := &fakeScanner{result: webScan()}
+	pipe, events := newTestPipeline(t, scanner, &fakeNginx{})
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	// web moves to another port, api is new
+	scanner.result = docker.ScanResult{Containers: []docker.ContainerInfo{
+		{Name: "web", ID: "abc123", IP: "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 8080}},
+		{Name: "api", ID: "def456", IP: "172.17.0.3",
+			Mappings: []docker.PortMapping{{ProxyPort: 9000, ContainerPort: 9000, Protocol: docker.TCP}}},
+	}}
+	events.events = nil
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	byType := make(map[string]notify.Event)
+	for _, event := range events.events {
+		byType[event.Type] = event
+	}
+	if added := byType[eventRouteAdded]; added.Details["container"] != "api" ||
+		added.Details["routes"] != "tcp:9000 -> 172.17.0.3:9000" {
+		t.Errorf("route.added = %+v", added)
+	}
+	if changed := byType[eventRouteChanged]; changed.Details["container"] != "web" ||
+		changed.Details["routes"] != "http:web.example.com -> 172.17.0.2:8080" ||
+		changed.Details["previous_routes"] != "http:web.example.com -> 172.17.0.2:80" {
+		t.Errorf("route.changed = %+v", changed)
+	}
+
+	scanner.result = docker.ScanResult{}
+	events.events = nil
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	var removed []string
+	for _, event := range events.events {
+		if event.Type == eventRouteRemoved {
+			removed = append(removed, event.Details["container"])
+		}
+	}
+	if len(removed) != 2 {
+		t.Errorf("route.removed containers = %v, want api and web", removed)
+	}
+
+	// failed runs send no route events
+	scanner.result = webScan()
+	events.events = nil
+	pipe.target = delivery.NewLocal(&fakeNginx{validateErr: errors.New("unknown directive")}, &fakeNginx{})
+	if err := pipe.run(context.Background()); err == nil {
+		t.Fatal("run() with invalid configs should fail")
+	}
+	if got := events.types(); len(got) != 1 || got[0] != eventConfigFailed {
+		t.Errorf("events of a failed run = %v, want %s only", got, eventConfigFailed)
+	}
+}
+
+// lockCheckingSink records whether the pipeline lock was free when each route event arrived
+type lockCheckingSink struct {
+	pipe     *pipeline
+	unlocked []bool
+}
+
+func (s *lockCheckingSink) Notify(_ context.Context, event notify.Event) {
+	if !strings.HasPrefix(event.Type, "route.") {
+		return
+	}
+	locked := !s.pipe.mu.TryLock()
+	if !locked {
+		s.pipe.mu.Unlock()
+	}
+	s.unlocked = append(s.unlocked, !locked)
+}
+
+func TestPipelineRouteEventsAfterUnlock(t *testing.T) {
+	pipe, _ := newTestPipeline(t, &fakeScanner{result: webScan()}, &fakeNginx{})
+	sink := &lockCheckingSink{pipe: pipe}
+	pipe.events = sink
+
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if len(sink.unlocked) != 1 || !sink.unlocked[0] {
+		t.Errorf("route events unlocked = %v, want one sent after the run released the lock", sink.unlocked)
+	}
+}
+
+// gatedScanner blocks each scan until the gate is opened and counts the scans
+type gatedScanner struct {
+	fakeScanner
+	gate  chan struct{}
+	scans atomic.Int32
+}
+
+func (s *gatedScanner) Scan(ctx context.Context) (docker.ScanResult, error) {
+	s.scans.Add(1)
+	<-s.gate
+	return s.fakeScanner.Scan(ctx)
+}
+
+func TestPipelineRunQueuesOne(t *testing.T) {
+	scanner := &gatedScanner{fakeScanner: fakeScanner{result: webScan()}, gate: make(chan struct{})}
+	pipe, _ := newTestPipeline(t, &scanner.fakeScanner, &fakeNginx{})
+	pipe.scanner = scanner
+
+	errs := make(chan error, 4)
+	go func() { errs <- pipe.run(context.Background()) }()
+	for scanner.scans.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// three runs arrive during the first one and are served by the one queued run
+	for range 3 {
+		go func() { errs <- pipe.run(context.Background()) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := scanner.scans.Load(); got != 1 {
+		t.Fatalf("scans = %d while the first run is in progress, want 1", got)
+	}
+
+	close(scanner.gate)
+	for range 4 {
+		if err := <-errs; err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	}
+	if got := scanner.scans.Load(); got != 2 {
+		t.Errorf("scans = %d, want the first run and one queued run", got)
+	}
+}
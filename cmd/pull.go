@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Fetch configs published to object storage and apply them to the local nginx",
+	Long: `Edge node side of hub-and-spoke distribution. A hub runs watch with
+--object-store-url and publishes every config change as a new version;
+edge nodes run pull against the same bucket to download the latest version,
+validate it with nginx -t and reload nginx.
+
+A version that fails validation is rolled back locally and nginx keeps
+serving the previous configs.
+
+With --interval the bucket is polled until interrupted, otherwise pull
+runs once.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		interval, _ := cmd.Flags().GetDuration("interval") //nolint:errcheck // flag is predefined
+
+		if cfg.ObjectStore.URL == "" {
+			return logError("pull requires --object-store-url")
+		}
+
+		bucket, err := newBucket(cfg)
+		if err != nil {
+			return logError("object store setup failed: %w", err)
+		}
+
+		reloader, err := nginx.NewReloader(cfg.NginxReloadCmd, log)
+		if err != nil {
+			return logError("reloader initialization failed: %w", err)
+		}
+
+		puller := delivery.NewPuller(bucket, map[string]string{
+			delivery.KindStream: cfg.StreamConfigPath,
+			delivery.KindHTTP:   cfg.HTTPConfigPath,
+		}, nginx.NewValidator(log), reloader, log)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		log.Logf("INFO [Pull] pulling configs source=%s", bucket)
+
+		if interval <= 0 {
+			changed, err := puller.Pull(ctx)
+			if err != nil {
+				return logError("pull failed: %w", err)
+			}
+			if changed {
+				fmt.Println("✓ Nginx configurations updated from object storage")
+			}
+			return nil
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			select {
+			case sig := <-sigCh:
+				log.Logf("INFO [Pull] shutdown signal=%s", sig)
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// errors are retried on the next tick, nginx keeps the last good configs
+			if _, err := puller.Pull(ctx); err != nil && ctx.Err() == nil {
+				log.Logf("ERROR [Pull] pull failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+func init() {
+	pullCmd.Flags().Duration("interval", 0, "Poll the bucket at this interval (0 pulls once)")
+	rootCmd.AddCommand(pullCmd)
+}
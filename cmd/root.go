@@ -1,19 +1,43 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/acme"
 	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/metrics"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/notify"
+	"github.com/moontechs/proxy/vault"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfg *config.Config
-	log *lgr.Logger
+	cfg     *config.Config
+	cfgFile *config.File
+	log     *lgr.Logger
 )
 
+// vaultClient is reused by configureGenerator across config reloads, so cached secrets and
+// leases survive them; it is replaced only when the Vault settings change
+var vaultClient struct {
+	mu     sync.Mutex
+	cfg    config.Vault
+	client *vault.Client
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "proxy",
 	Short: "Docker-aware Nginx stream and HTTP proxy configurator",
@@ -31,8 +55,11 @@ Container labels:
   proxy.http.https: "true"               # Listen on 443 (default: false)`,
 	Version: "2.0.0",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		// Initialize configuration from flags and environment
-		cfg = getConfig(cmd)
+		// Initialize configuration from config file, flags and environment
+		var err error
+		if cfg, err = loadConfig(cmd); err != nil {
+			return err
+		}
 
 		// Initialize logger
 		log = setupLogger(cmd)
@@ -41,60 +68,594 @@ Container labels:
 }
 
 // Execute runs the root command
+// Errors are returned as ExitError with the exit code of their failure type, see exitCode
 func Execute() error {
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+	if err == nil {
+		return nil
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{Code: exitCode(err), Err: err}
 }
 
 func init() {
 	// persistent flags available to all subcommands
+	rootCmd.PersistentFlags().String("config", "", "YAML config file with flag-name keys (reloaded on SIGHUP/change in watch and run)")
 	rootCmd.PersistentFlags().String("log-level", "INFO", "Log level (DEBUG, INFO, TRACE)")
-	rootCmd.PersistentFlags().String("docker-host", "unix:///var/run/docker.sock", "Docker socket path")
+	rootCmd.PersistentFlags().String("docker-host", config.DefaultDockerHost(), "Docker daemon address (unix://, npipe://, tcp://)")
+	rootCmd.PersistentFlags().String("docker-api-version", "", "Pin the Docker API version, e.g. 1.41 (default: negotiated with the daemon)")
+	rootCmd.PersistentFlags().String("address-family", docker.AddressFamilyPreferIPv4, "Container addresses of upstreams: ipv4, ipv6, prefer-ipv4 or prefer-ipv6 (the other family for single-stack containers)")
+	rootCmd.PersistentFlags().String("host-address", docker.HostAddressGateway, "Address of network_mode: host containers: an IP address, host-gateway (the default bridge gateway) or off to skip them")
+	rootCmd.PersistentFlags().Int("docker-api-rate", docker.DefaultAPIRate, "Docker API calls per second (lists, inspects, exec) before throttling (0 disables)")
+	rootCmd.PersistentFlags().Int("docker-api-burst", docker.DefaultAPIBurst, "Docker API calls sent at once before --docker-api-rate throttles")
+	rootCmd.PersistentFlags().Int("docker-api-budget", 0, "Docker API calls per minute, further calls fail until the minute is over (0 is unlimited)")
 	rootCmd.PersistentFlags().String("stream-config-path", "/etc/nginx/conf.d/proxy.conf", "Nginx stream config output path")
 	rootCmd.PersistentFlags().String("http-config-path", "/etc/nginx/conf.d/http-proxy.conf", "Nginx HTTP config output path")
+	rootCmd.PersistentFlags().String("extra-config-dir", "", "Directory of hand-written nginx configs checked for listen/server_name conflicts, never written")
+	rootCmd.PersistentFlags().Bool("check-nginx-config", false, "Check labels for conflicts with hand-written servers in the local nginx config (nginx -T)")
 	rootCmd.PersistentFlags().String("reload-cmd", "nginx -s reload", "Nginx reload command")
+	rootCmd.PersistentFlags().String("nginx-cmd", "nginx -g 'daemon off;'", "Nginx start command used by run (must stay in foreground)")
+	rootCmd.PersistentFlags().String("nginx-binary", "nginx", "Command running the nginx binary for capability probes (-V) and --check-nginx-config (-T), e.g. docker exec edge nginx")
+	rootCmd.PersistentFlags().String("acme-challenge-addr", "", "Address of the built-in ACME HTTP-01 responder, e.g. 127.0.0.1:8402 (empty disables)")
+	rootCmd.PersistentFlags().String("state-file", "/etc/nginx/conf.d/proxy-state.json", "File recording applied routes between runs (empty disables)")
+	rootCmd.PersistentFlags().String("secrets-dir", nginx.DefaultSecretsDir, "Directory with files referenced by *.secret labels (Docker secrets mount)")
+	rootCmd.PersistentFlags().String("config-file-mode", "0644", "Octal mode of the generated configs, set after each write")
+	rootCmd.PersistentFlags().String("config-owner", "", "Owner of the generated configs, user[:group] (empty keeps the proxy's user)")
+	rootCmd.PersistentFlags().Bool("fsync", false, "Flush written configs to disk before reloading nginx")
+	rootCmd.PersistentFlags().String("secrets-file-mode", "0600", "Octal mode of the include holding upstream credentials")
+	rootCmd.PersistentFlags().String("secrets-owner", "", "Owner of the include holding upstream credentials, user[:group] (empty keeps the proxy's user)")
+	rootCmd.PersistentFlags().String("vault-addr", "", "Vault address for vault:<path>#<field> secret labels (empty disables)")
+	rootCmd.PersistentFlags().String("vault-token-file", "", "File with the Vault token, re-read on every request (e.g. Vault Agent sink)")
+	rootCmd.PersistentFlags().String("vault-secrets-dir", "/etc/nginx/proxy-secrets", "Directory where Vault secrets are written for nginx")
+	rootCmd.PersistentFlags().String("vault-refresh", "5m", "Re-read Vault secrets without a lease at this interval")
+	rootCmd.PersistentFlags().String("signing-key-file", "", "HMAC key file for signing generated configs (.sig files next to them)")
+	rootCmd.PersistentFlags().String("debounce", "2s", "Delay after the last Docker event before regenerating")
+	rootCmd.PersistentFlags().Int("failure-budget", 0, "Consecutive failed regenerations before escalating: webhook and non-ready /readyz (0 disables)")
+	rootCmd.PersistentFlags().Bool("failure-exit", false, "Exit with code 3 once the failure budget is exhausted, so orchestrators restart the proxy")
+	rootCmd.PersistentFlags().String("stream-template", "", "Custom stream config template file (default: built-in)")
+	rootCmd.PersistentFlags().String("http-template", "", "Custom HTTP config template file (default: built-in)")
+	rootCmd.PersistentFlags().String("ssh-target", "", "Deliver configs to a remote nginx over SSH, user@host[:port] (empty disables)")
+	rootCmd.PersistentFlags().String("ssh-key", "", "Private key file for SSH delivery")
+	rootCmd.PersistentFlags().String("ssh-known-hosts", "", "known_hosts file used to verify the SSH host key")
+	rootCmd.PersistentFlags().Bool("ssh-insecure-host-key", false, "Skip SSH host key verification (testing only)")
+	rootCmd.PersistentFlags().String("ssh-stream-config-path", "", "Remote stream config path (default: same as local)")
+	rootCmd.PersistentFlags().String("ssh-http-config-path", "", "Remote HTTP config path (default: same as local)")
+	rootCmd.PersistentFlags().String("ssh-validate-cmd", "nginx -t", "Remote nginx validation command")
+	rootCmd.PersistentFlags().String("ssh-reload-cmd", "nginx -s reload", "Remote nginx reload command")
+	rootCmd.PersistentFlags().String("object-store-url", "", "Publish configs to an S3-compatible bucket, http(s)://endpoint/bucket[/prefix] (empty disables)")
+	rootCmd.PersistentFlags().String("object-store-region", "us-east-1", "Object store signing region")
+	rootCmd.PersistentFlags().String("kube-target", "", "Write configs to a Kubernetes configmap/<name> or secret/<name> (empty disables)")
+	rootCmd.PersistentFlags().String("kube-namespace", "", "Kubernetes namespace (default: service account namespace)")
+	rootCmd.PersistentFlags().String("kube-deployment", "", "Deployment whose pod template annotation is bumped after an update")
+	rootCmd.PersistentFlags().String("kube-api-server", "", "Kubernetes API server URL (default: in-cluster)")
+	rootCmd.PersistentFlags().String("kube-token-path", "", "Bearer token file (default: service account token)")
+	rootCmd.PersistentFlags().String("kube-ca-path", "", "API server CA file (default: service account CA in-cluster)")
+	rootCmd.PersistentFlags().Bool("targets-stop-on-error", false, "Skip the remaining fan-out targets after the first failure")
+	rootCmd.PersistentFlags().Bool("http2", false, "Enable HTTP/2 on HTTPS listeners (proxy.http.http2 overrides per host)")
+	rootCmd.PersistentFlags().Bool("http3", false, "Enable HTTP/3 (QUIC) on HTTPS listeners (proxy.http.http3 overrides per host)")
+	rootCmd.PersistentFlags().Bool("request-id", false, "Pass X-Request-ID to backends and log it (proxy.http.request_id overrides per host)")
+	rootCmd.PersistentFlags().Bool("isolate-namespaces", false, "Keep the previous configs of a proxy.namespace with conflicting routes instead of failing the generation")
+	rootCmd.PersistentFlags().String("waf-rules", "", "ModSecurity rules file for hosts with proxy.http.waf")
+	rootCmd.PersistentFlags().String("bot-presets", "scanners", "Built-in user-agent blocklists for proxy.http.block_bots: scanners, seo, ai or none")
+	rootCmd.PersistentFlags().String("bot-patterns-file", "", "File with extra user-agent regexes for proxy.http.block_bots, one per line")
+	rootCmd.PersistentFlags().String("syslog-server", "", "Ship nginx access and error logs to syslog at host[:port] or unix:/path")
+	rootCmd.PersistentFlags().String("syslog-facility", "", "Syslog facility for nginx logs (default: local7)")
+	rootCmd.PersistentFlags().String("access-log-sample", "", "Share of successful requests written to the access log, e.g. 1% (errors are always logged)")
+	rootCmd.PersistentFlags().String("access-log-json", "", "Extra JSON access log for per-host metrics, e.g. /var/log/nginx/proxy-access.json")
+	rootCmd.PersistentFlags().String("metrics-addr", "", "Serve Prometheus metrics on /metrics at this address, e.g. :9113")
+	rootCmd.PersistentFlags().String("webhook-urls", "", "Comma-separated webhook URLs notified of config reloads, failures and alerts")
+	rootCmd.PersistentFlags().String("webhook-digest", "0", "Batch reload and route webhooks into one summary per window, e.g. 5m (failures are sent at once, 0 disables)")
+	rootCmd.PersistentFlags().String("admin-grpc-addr", "", "Serve the gRPC admin API in watch and run at host:port or unix:/path (empty disables)")
+	rootCmd.PersistentFlags().String("geoip-db", "", "GeoIP2 country database for proxy.http.geo.* labels (requires the nginx geoip2 module)")
+	rootCmd.PersistentFlags().String("acme-webroot", "", "Webroot directory with ACME challenge tokens (certbot/lego --webroot layout)")
+	rootCmd.PersistentFlags().String("client-header-buffer-size", "", "client_header_buffer_size of all HTTP servers, e.g. 4k (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().String("large-client-header-buffers", "", "large_client_header_buffers of all HTTP servers, e.g. \"8 32k\" (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().String("upstream-zone", nginx.DefaultUpstreamZone, "Shared memory zone size of every upstream block, off keeps upstream state per worker")
+	rootCmd.PersistentFlags().Int("max-routes", nginx.DefaultMaxRoutes, "Routes (stream ports, HTTP servers, redirects) beyond which a generation fails (0 disables)")
+	rootCmd.PersistentFlags().Int("max-upstream-servers", nginx.DefaultMaxUpstreamServers, "Servers of one upstream block beyond which a generation fails (0 disables)")
+	rootCmd.PersistentFlags().String("max-config-size", nginx.DefaultMaxConfigSize, "Size of one rendered config beyond which a generation fails, e.g. 64m (off disables)")
+	rootCmd.PersistentFlags().String("restart-page-grace", "0", "Serve a \"service restarting\" page on the HTTP routes of gone containers this long before removing them, e.g. 30s (0 disables)")
+	rootCmd.PersistentFlags().String("restart-page-addr", nginx.DefaultRestartPageAddr, "Local ip:port nginx serves the restart page on, the fallback upstream of those routes")
+	rootCmd.PersistentFlags().String("forwarded-headers", docker.ForwardedAppend, "X-Forwarded-For, -Proto and -Host sent to backends: append, overwrite or strip")
+	rootCmd.PersistentFlags().String("trusted-proxies", "", "Comma-separated CIDRs of proxies in front of nginx whose X-Forwarded-* headers are trusted")
+	rootCmd.PersistentFlags().String("internal-cidrs", nginx.DefaultInternalCIDRs, "Comma-separated client CIDRs proxy.http.internal_only routes are served to (empty skips those routes)")
+	rootCmd.PersistentFlags().Int("internal-deny-status", 403, "Status of clients outside internal_only and allow_from networks: 403, or 444 to close the connection")
+	rootCmd.PersistentFlags().String("port-check", "warn", "Check the host for sockets bound to new stream ports: off, warn or fail")
+	rootCmd.PersistentFlags().String("policy-hostnames", "", "Hostnames routes may claim, e.g. *.corp.example.com (empty allows all)")
+	rootCmd.PersistentFlags().String("policy-ports", "", "TCP and UDP proxy ports routes may claim, e.g. 80,443,1024-65535 (empty allows all)")
+	rootCmd.PersistentFlags().String("transform-script", "", "Starlark file whose transform(containers) function may change the routes before rendering")
+	rootCmd.PersistentFlags().String("plugins-dir", "", "Executables run on each generation with the routes, they can veto it or add config, e.g. /etc/proxy/plugins.d (empty disables)")
+	rootCmd.PersistentFlags().String("resolver", "", "Comma-separated DNS servers nginx resolves names with at runtime, proxy.http.resolver overrides it")
+	rootCmd.PersistentFlags().String("stream-proxy-timeout", "", "proxy_timeout of all TCP servers, e.g. 1h (empty keeps 5m per server)")
+	rootCmd.PersistentFlags().String("stream-connect-timeout", "", "proxy_connect_timeout of all TCP servers (empty keeps 10s per server)")
+	rootCmd.PersistentFlags().String("stream-preread-timeout", "", "preread_timeout of the stream servers (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().String("stream-tcp-nodelay", "", "tcp_nodelay of the stream servers, on or off (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().Int("ssh-gateway-port", 0, "Route TLS-wrapped SSH on this port to containers by proxy.ssh.alias (0 disables)")
+	rootCmd.PersistentFlags().String("ssh-gateway-host", "", "Public hostname of the SSH gateway, used in the ssh snippets of status")
+	rootCmd.PersistentFlags().String("ssh-gateway-cert", "", "TLS certificate of the SSH gateway, required with --ssh-gateway-port")
+	rootCmd.PersistentFlags().String("ssh-gateway-key", "", "TLS key of the SSH gateway")
+	rootCmd.PersistentFlags().String("ssl-session-cache", "", "ssl_session_cache of HTTPS listeners, e.g. shared:SSL:10m (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().String("ssl-session-timeout", "", "ssl_session_timeout of HTTPS listeners, e.g. 1d (empty keeps the nginx default)")
+	rootCmd.PersistentFlags().String("ssl-ticket-key-rotate", "0", "Rotate managed session ticket keys at this interval in watch and run, e.g. 12h (0 disables)")
+	rootCmd.PersistentFlags().String("ssl-ticket-keys-dir", nginx.DefaultTicketKeysDir, "Directory for managed session ticket keys")
+	rootCmd.PersistentFlags().String("warmup-path", "", "Request this path on HTTP routes of added containers after each reload in watch and run, e.g. / (empty disables)")
+	rootCmd.PersistentFlags().String("warmup-addr", "127.0.0.1", "Address nginx listens on for warm-up requests")
+	rootCmd.PersistentFlags().String("warmup-timeout", "30s", "Timeout of each warm-up request")
+	rootCmd.PersistentFlags().Int("warmup-http-port", 80, "Port of the HTTP servers of nginx for warm-up requests")
+	rootCmd.PersistentFlags().Int("warmup-https-port", 443, "Port of the HTTPS servers of nginx for warm-up requests")
+	rootCmd.PersistentFlags().String("pre-hook", "", "Command run with the changed routes before each reload in watch and run, a failure cancels the reload")
+	rootCmd.PersistentFlags().String("post-hook", "", "Command run with the changed routes after each successful reload in watch and run")
+	rootCmd.PersistentFlags().String("pre-hook-urls", "", "Comma-separated URLs posted the changed routes before each reload, a non-2xx answer cancels the reload")
+	rootCmd.PersistentFlags().String("post-hook-urls", "", "Comma-separated URLs posted the changed routes after each successful reload")
+	rootCmd.PersistentFlags().String("hook-timeout", "30s", "Timeout of each hook command or request")
+	rootCmd.PersistentFlags().String("acme-directory", "", "Issue certificates for HTTPS hosts from this ACME directory: production, staging or a URL (empty disables)")
+	rootCmd.PersistentFlags().String("acme-email", "", "ACME account email for expiry notices")
+	rootCmd.PersistentFlags().String("acme-key-type", string(acme.KeyECDSA256), "Key type of issued certificates: ecdsa256, ecdsa384, rsa2048 or rsa4096")
+	rootCmd.PersistentFlags().String("acme-certs-dir", acme.DefaultCertsDir, "Directory for the ACME account key and issued certificates")
 }
 
-// getConfig builds config from flags and environment variables
-func getConfig(cmd *cobra.Command) *config.Config {
-	// these flags are defined in init(), so GetString should never error
-	logLevel, _ := cmd.Flags().GetString("log-level")                  //nolint:errcheck // flags are predefined
-	dockerHost, _ := cmd.Flags().GetString("docker-host")              //nolint:errcheck // flags are predefined
-	streamConfigPath, _ := cmd.Flags().GetString("stream-config-path") //nolint:errcheck // flags are predefined
-	httpConfigPath, _ := cmd.Flags().GetString("http-config-path")     //nolint:errcheck // flags are predefined
-	reloadCmd, _ := cmd.Flags().GetString("reload-cmd")                //nolint:errcheck // flags are predefined
-
-	// override with environment variables if set
-	if val := os.Getenv("LOG_LEVEL"); val != "" {
-		logLevel = val
-	}
-	if val := os.Getenv("DOCKER_HOST"); val != "" {
-		dockerHost = val
+// loadConfig (re)reads the config file and builds config from it, flags and environment
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	var file *config.File
+	if path := stringSetting(cmd, "config", "PROXY_CONFIG"); path != "" {
+		var err error
+		if file, err = config.LoadFile(path); err != nil {
+			return nil, err
+		}
 	}
-	if val := os.Getenv("NGINX_STREAM_CONFIG_PATH"); val != "" {
-		streamConfigPath = val
-	}
-	if val := os.Getenv("NGINX_HTTP_CONFIG_PATH"); val != "" {
-		httpConfigPath = val
-	}
-	if val := os.Getenv("NGINX_RELOAD_CMD"); val != "" {
-		reloadCmd = val
+
+	// getConfig reads the file through cfgFile, keep the previous one when the settings are invalid
+	previous := cfgFile
+	cfgFile = file
+	cfg, err := getConfig(cmd)
+	if err != nil {
+		cfgFile = previous
+		return nil, err
 	}
+	return cfg, nil
+}
 
+// getConfig builds config from the config file, flags and environment variables
+// Precedence: environment > explicitly set flag > config file > flag default
+func getConfig(cmd *cobra.Command) (*config.Config, error) {
 	// get network name from environment or use default
 	networkName := config.DefaultNetworkName
 	if val := os.Getenv("PROXY_NETWORK"); val != "" {
 		networkName = val
 	}
 
+	debounce, err := durationSetting(cmd, "debounce", "DEBOUNCE")
+	if err != nil {
+		return nil, err
+	}
+	restartGrace, err := durationSetting(cmd, "restart-page-grace", "RESTART_PAGE_GRACE")
+	if err != nil {
+		return nil, err
+	}
+	failureBudget, err := intSetting(cmd, "failure-budget", "FAILURE_BUDGET")
+	if err != nil {
+		return nil, err
+	}
+	if failureBudget < 0 {
+		return nil, fmt.Errorf("invalid failure-budget %d, expected 0 or more", failureBudget)
+	}
+	failureExit, err := boolSetting(cmd, "failure-exit", "FAILURE_EXIT")
+	if err != nil {
+		return nil, err
+	}
+	dockerAPIRate, err := intSetting(cmd, "docker-api-rate", "DOCKER_API_RATE")
+	if err != nil {
+		return nil, err
+	}
+	dockerAPIBurst, err := intSetting(cmd, "docker-api-burst", "DOCKER_API_BURST")
+	if err != nil {
+		return nil, err
+	}
+	dockerAPIBudget, err := intSetting(cmd, "docker-api-budget", "DOCKER_API_BUDGET")
+	if err != nil {
+		return nil, err
+	}
+	if dockerAPIRate < 0 || dockerAPIBurst < 0 || dockerAPIBudget < 0 {
+		return nil, fmt.Errorf("invalid docker API limits rate=%d burst=%d budget=%d, expected 0 or more",
+			dockerAPIRate, dockerAPIBurst, dockerAPIBudget)
+	}
+
+	sshCfg, err := getSSHConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeCfg, err := getKubernetesConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey, err := getSigningKey(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultRefresh, err := durationSetting(cmd, "vault-refresh", "VAULT_REFRESH")
+	if err != nil {
+		return nil, err
+	}
+
+	sshGatewayPort, err := intSetting(cmd, "ssh-gateway-port", "SSH_GATEWAY_PORT")
+	if err != nil {
+		return nil, err
+	}
+	internalStatus, err := intSetting(cmd, "internal-deny-status", "INTERNAL_DENY_STATUS")
+	if err != nil {
+		return nil, err
+	}
+	maxRoutes, err := intSetting(cmd, "max-routes", "MAX_ROUTES")
+	if err != nil {
+		return nil, err
+	}
+	maxServers, err := intSetting(cmd, "max-upstream-servers", "MAX_UPSTREAM_SERVERS")
+	if err != nil {
+		return nil, err
+	}
+	ticketRotate, err := durationSetting(cmd, "ssl-ticket-key-rotate", "SSL_TICKET_KEY_ROTATE")
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := getHooksConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	warmupTimeout, err := durationSetting(cmd, "warmup-timeout", "WARMUP_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	warmupHTTPPort, err := intSetting(cmd, "warmup-http-port", "WARMUP_HTTP_PORT")
+	if err != nil {
+		return nil, err
+	}
+	warmupHTTPSPort, err := intSetting(cmd, "warmup-https-port", "WARMUP_HTTPS_PORT")
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []config.TargetSpec
+	if err := cfgFile.Decode("targets", &targets); err != nil {
+		return nil, err
+	}
+	stopOnError, err := boolSetting(cmd, "targets-stop-on-error", "TARGETS_STOP_ON_ERROR")
+	if err != nil {
+		return nil, err
+	}
+
+	http2, err := boolSetting(cmd, "http2", "HTTP2")
+	if err != nil {
+		return nil, err
+	}
+	http3, err := boolSetting(cmd, "http3", "HTTP3")
+	if err != nil {
+		return nil, err
+	}
+	requestID, err := boolSetting(cmd, "request-id", "REQUEST_ID")
+	if err != nil {
+		return nil, err
+	}
+	isolateNamespaces, err := boolSetting(cmd, "isolate-namespaces", "ISOLATE_NAMESPACES")
+	if err != nil {
+		return nil, err
+	}
+	checkNginxConfig, err := boolSetting(cmd, "check-nginx-config", "CHECK_NGINX_CONFIG")
+	if err != nil {
+		return nil, err
+	}
+	fsync, err := boolSetting(cmd, "fsync", "FSYNC")
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := notify.ParseURLs(stringSetting(cmd, "webhook-urls", "WEBHOOK_URLS"))
+	if err != nil {
+		return nil, err
+	}
+	webhookDigest, err := durationSetting(cmd, "webhook-digest", "WEBHOOK_DIGEST")
+	if err != nil {
+		return nil, err
+	}
+	var alerts []config.AlertRule
+	if err := cfgFile.Decode("alerts", &alerts); err != nil {
+		return nil, err
+	}
+	var streams []config.StreamRoute
+	if err := cfgFile.Decode("streams", &streams); err != nil {
+		return nil, err
+	}
+
 	return &config.Config{
-		LogLevel:         logLevel,
-		LogCaller:        false,
-		DockerHost:       dockerHost,
-		NetworkName:      networkName,
-		StreamConfigPath: streamConfigPath,
-		HTTPConfigPath:   httpConfigPath,
-		NginxReloadCmd:   reloadCmd,
+		LogLevel:          stringSetting(cmd, "log-level", "LOG_LEVEL"),
+		LogCaller:         false,
+		DockerHost:        stringSetting(cmd, "docker-host", "DOCKER_HOST"),
+		DockerAPIVersion:  stringSetting(cmd, "docker-api-version", "DOCKER_API_VERSION"),
+		DockerAPIRate:     dockerAPIRate,
+		DockerAPIBurst:    dockerAPIBurst,
+		DockerAPIBudget:   dockerAPIBudget,
+		AddressFamily:     stringSetting(cmd, "address-family", "ADDRESS_FAMILY"),
+		HostAddress:       stringSetting(cmd, "host-address", "HOST_ADDRESS"),
+		NetworkName:       networkName,
+		StreamConfigPath:  stringSetting(cmd, "stream-config-path", "NGINX_STREAM_CONFIG_PATH"),
+		HTTPConfigPath:    stringSetting(cmd, "http-config-path", "NGINX_HTTP_CONFIG_PATH"),
+		ExtraConfigDir:    stringSetting(cmd, "extra-config-dir", "EXTRA_CONFIG_DIR"),
+		CheckNginxConfig:  checkNginxConfig,
+		NginxReloadCmd:    stringSetting(cmd, "reload-cmd", "NGINX_RELOAD_CMD"),
+		NginxCmd:          stringSetting(cmd, "nginx-cmd", "NGINX_CMD"),
+		NginxBinary:       stringSetting(cmd, "nginx-binary", "NGINX_BINARY"),
+		ACMEChallengeAddr: stringSetting(cmd, "acme-challenge-addr", "ACME_CHALLENGE_ADDR"),
+		ACMEWebroot:       stringSetting(cmd, "acme-webroot", "ACME_WEBROOT"),
+		ACMEDirectory:     stringSetting(cmd, "acme-directory", "ACME_DIRECTORY"),
+		ACMEEmail:         stringSetting(cmd, "acme-email", "ACME_EMAIL"),
+		ACMEKeyType:       stringSetting(cmd, "acme-key-type", "ACME_KEY_TYPE"),
+		ACMECertsDir:      stringSetting(cmd, "acme-certs-dir", "ACME_CERTS_DIR"),
+		ConfigFile:        stringSetting(cmd, "config", "PROXY_CONFIG"),
+		Debounce:          debounce,
+		FailureBudget:     failureBudget,
+		FailureExit:       failureExit,
+		StateFile:         stringSetting(cmd, "state-file", "STATE_FILE"),
+		SecretsDir:        stringSetting(cmd, "secrets-dir", "SECRETS_DIR"),
+		ConfigFileMode:    stringSetting(cmd, "config-file-mode", "CONFIG_FILE_MODE"),
+		ConfigOwner:       stringSetting(cmd, "config-owner", "CONFIG_OWNER"),
+		Fsync:             fsync,
+		SecretsFileMode:   stringSetting(cmd, "secrets-file-mode", "SECRETS_FILE_MODE"),
+		SecretsOwner:      stringSetting(cmd, "secrets-owner", "SECRETS_OWNER"),
+		SigningKey:        signingKey,
+		HTTP2:             http2,
+		HTTP3:             http3,
+		GeoIPDB:           stringSetting(cmd, "geoip-db", "GEOIP_DB"),
+		RequestID:         requestID,
+		WAFRules:          stringSetting(cmd, "waf-rules", "WAF_RULES"),
+		BotPresets:        stringSetting(cmd, "bot-presets", "BOT_PRESETS"),
+		BotPatternsFile:   stringSetting(cmd, "bot-patterns-file", "BOT_PATTERNS_FILE"),
+		SyslogServer:      stringSetting(cmd, "syslog-server", "SYSLOG_SERVER"),
+		SyslogFacility:    stringSetting(cmd, "syslog-facility", "SYSLOG_FACILITY"),
+		AccessLogJSON:     stringSetting(cmd, "access-log-json", "ACCESS_LOG_JSON"),
+		AccessLogSample:   stringSetting(cmd, "access-log-sample", "ACCESS_LOG_SAMPLE"),
+		HeaderBufferSize:  stringSetting(cmd, "client-header-buffer-size", "CLIENT_HEADER_BUFFER_SIZE"),
+		HeaderBuffers:     stringSetting(cmd, "large-client-header-buffers", "LARGE_CLIENT_HEADER_BUFFERS"),
+		UpstreamZone:      stringSetting(cmd, "upstream-zone", "UPSTREAM_ZONE"),
+		MaxRoutes:         maxRoutes,
+		MaxServers:        maxServers,
+		MaxConfigSize:     stringSetting(cmd, "max-config-size", "MAX_CONFIG_SIZE"),
+		RestartGrace:      restartGrace,
+		RestartPageAddr:   stringSetting(cmd, "restart-page-addr", "RESTART_PAGE_ADDR"),
+		ForwardedHeaders:  stringSetting(cmd, "forwarded-headers", "FORWARDED_HEADERS"),
+		TrustedProxies:    stringSetting(cmd, "trusted-proxies", "TRUSTED_PROXIES"),
+		Resolver:          stringSetting(cmd, "resolver", "RESOLVER"),
+		InternalCIDRs:     stringSetting(cmd, "internal-cidrs", "INTERNAL_CIDRS"),
+		InternalStatus:    internalStatus,
+		PortCheck:         stringSetting(cmd, "port-check", "PORT_CHECK"),
+		PolicyHostnames:   stringSetting(cmd, "policy-hostnames", "POLICY_HOSTNAMES"),
+		PolicyPorts:       stringSetting(cmd, "policy-ports", "POLICY_PORTS"),
+		TransformScript:   stringSetting(cmd, "transform-script", "TRANSFORM_SCRIPT"),
+		PluginsDir:        stringSetting(cmd, "plugins-dir", "PLUGINS_DIR"),
+		IsolateNamespaces: isolateNamespaces,
+		MetricsAddr:       stringSetting(cmd, "metrics-addr", "METRICS_ADDR"),
+		Webhooks:          webhooks,
+		WebhookDigest:     webhookDigest,
+		Alerts:            alerts,
+		Streams:           streams,
+		AdminGRPCAddr:     stringSetting(cmd, "admin-grpc-addr", "ADMIN_GRPC_ADDR"),
+		// token only from the environment, never from flags or the config file
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		Vault: config.Vault{
+			Addr: stringSetting(cmd, "vault-addr", "VAULT_ADDR"),
+			// token only from the environment, never from flags or the config file
+			Token:     os.Getenv("VAULT_TOKEN"),
+			TokenFile: stringSetting(cmd, "vault-token-file", "VAULT_TOKEN_FILE"),
+			Dir:       stringSetting(cmd, "vault-secrets-dir", "VAULT_SECRETS_DIR"),
+			Refresh:   vaultRefresh,
+		},
+		StreamDefaults: config.StreamDefaults{
+			ProxyTimeout:   stringSetting(cmd, "stream-proxy-timeout", "STREAM_PROXY_TIMEOUT"),
+			ConnectTimeout: stringSetting(cmd, "stream-connect-timeout", "STREAM_CONNECT_TIMEOUT"),
+			PrereadTimeout: stringSetting(cmd, "stream-preread-timeout", "STREAM_PREREAD_TIMEOUT"),
+			TCPNodelay:     stringSetting(cmd, "stream-tcp-nodelay", "STREAM_TCP_NODELAY"),
+		},
+		SSHGateway: config.SSHGateway{
+			Port: sshGatewayPort,
+			Host: stringSetting(cmd, "ssh-gateway-host", "SSH_GATEWAY_HOST"),
+			Cert: stringSetting(cmd, "ssh-gateway-cert", "SSH_GATEWAY_CERT"),
+			Key:  stringSetting(cmd, "ssh-gateway-key", "SSH_GATEWAY_KEY"),
+		},
+		Warmup: config.Warmup{
+			Path:      stringSetting(cmd, "warmup-path", "WARMUP_PATH"),
+			Addr:      stringSetting(cmd, "warmup-addr", "WARMUP_ADDR"),
+			Timeout:   warmupTimeout,
+			HTTPPort:  warmupHTTPPort,
+			HTTPSPort: warmupHTTPSPort,
+		},
+		Hooks: hooks,
+		TLSSessions: config.TLSSessions{
+			Cache:         stringSetting(cmd, "ssl-session-cache", "SSL_SESSION_CACHE"),
+			Timeout:       stringSetting(cmd, "ssl-session-timeout", "SSL_SESSION_TIMEOUT"),
+			TicketRotate:  ticketRotate,
+			TicketKeysDir: stringSetting(cmd, "ssl-ticket-keys-dir", "SSL_TICKET_KEYS_DIR"),
+		},
+		SSH:                sshCfg,
+		Kubernetes:         kubeCfg,
+		Targets:            targets,
+		TargetsStopOnError: stopOnError,
+		ObjectStore: config.ObjectStore{
+			URL:    stringSetting(cmd, "object-store-url", "OBJECT_STORE_URL"),
+			Region: stringSetting(cmd, "object-store-region", "OBJECT_STORE_REGION"),
+			// credentials only from the environment, never from flags or the config file
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		StreamTemplate: stringSetting(cmd, "stream-template", "STREAM_TEMPLATE"),
+		HTTPTemplate:   stringSetting(cmd, "http-template", "HTTP_TEMPLATE"),
+	}, nil
+}
+
+// getSigningKey reads the config signing key from SIGNING_KEY or the signing key file
+func getSigningKey(cmd *cobra.Command) ([]byte, error) {
+	key := []byte(os.Getenv("SIGNING_KEY"))
+	if len(key) == 0 {
+		path := stringSetting(cmd, "signing-key-file", "SIGNING_KEY_FILE")
+		if path == "" {
+			return nil, nil
+		}
+		// #nosec G304 -- key path is from trusted configuration
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key = bytes.TrimSpace(data)
+	}
+
+	if len(key) < 16 {
+		return nil, errors.New("signing key is too short, use at least 16 bytes")
 	}
+	return key, nil
+}
+
+// getSSHConfig parses the SSH delivery settings
+func getSSHConfig(cmd *cobra.Command) (config.SSHTarget, error) {
+	target := stringSetting(cmd, "ssh-target", "SSH_TARGET")
+	if target == "" {
+		return config.SSHTarget{}, nil
+	}
+
+	user, addr, ok := strings.Cut(target, "@")
+	if !ok || user == "" || addr == "" {
+		return config.SSHTarget{}, fmt.Errorf("invalid ssh-target %q, expected user@host[:port]", target)
+	}
+
+	insecure, err := boolSetting(cmd, "ssh-insecure-host-key", "SSH_INSECURE_HOST_KEY")
+	if err != nil {
+		return config.SSHTarget{}, err
+	}
+
+	return config.SSHTarget{
+		Addr:             addr,
+		User:             user,
+		KeyPath:          stringSetting(cmd, "ssh-key", "SSH_KEY"),
+		KnownHostsPath:   stringSetting(cmd, "ssh-known-hosts", "SSH_KNOWN_HOSTS"),
+		InsecureHostKey:  insecure,
+		StreamConfigPath: stringSetting(cmd, "ssh-stream-config-path", "SSH_STREAM_CONFIG_PATH"),
+		HTTPConfigPath:   stringSetting(cmd, "ssh-http-config-path", "SSH_HTTP_CONFIG_PATH"),
+		ValidateCmd:      stringSetting(cmd, "ssh-validate-cmd", "SSH_VALIDATE_CMD"),
+		ReloadCmd:        stringSetting(cmd, "ssh-reload-cmd", "SSH_RELOAD_CMD"),
+	}, nil
+}
+
+// getKubernetesConfig parses the Kubernetes delivery settings
+func getKubernetesConfig(cmd *cobra.Command) (config.KubernetesTarget, error) {
+	target := stringSetting(cmd, "kube-target", "KUBE_TARGET")
+	if target == "" {
+		return config.KubernetesTarget{}, nil
+	}
+
+	kind, name, ok := strings.Cut(target, "/")
+	kind = strings.ToLower(kind)
+	if !ok || name == "" || (kind != "configmap" && kind != "secret") {
+		return config.KubernetesTarget{}, fmt.Errorf("invalid kube-target %q, expected configmap/<name> or secret/<name>", target)
+	}
+
+	return config.KubernetesTarget{
+		Kind:       kind,
+		Name:       name,
+		Namespace:  stringSetting(cmd, "kube-namespace", "KUBE_NAMESPACE"),
+		Deployment: stringSetting(cmd, "kube-deployment", "KUBE_DEPLOYMENT"),
+		APIServer:  stringSetting(cmd, "kube-api-server", "KUBE_API_SERVER"),
+		TokenPath:  stringSetting(cmd, "kube-token-path", "KUBE_TOKEN_PATH"),
+		CAPath:     stringSetting(cmd, "kube-ca-path", "KUBE_CA_PATH"),
+	}, nil
+}
+
+// getHooksConfig reads the pre- and post-hook settings
+func getHooksConfig(cmd *cobra.Command) (config.Hooks, error) {
+	timeout, err := durationSetting(cmd, "hook-timeout", "HOOK_TIMEOUT")
+	if err != nil {
+		return config.Hooks{}, err
+	}
+	preURLs, err := notify.ParseURLs(stringSetting(cmd, "pre-hook-urls", "PRE_HOOK_URLS"))
+	if err != nil {
+		return config.Hooks{}, fmt.Errorf("invalid pre-hook-urls: %w", err)
+	}
+	postURLs, err := notify.ParseURLs(stringSetting(cmd, "post-hook-urls", "POST_HOOK_URLS"))
+	if err != nil {
+		return config.Hooks{}, fmt.Errorf("invalid post-hook-urls: %w", err)
+	}
+	return config.Hooks{
+		Pre:      stringSetting(cmd, "pre-hook", "PRE_HOOK"),
+		Post:     stringSetting(cmd, "post-hook", "POST_HOOK"),
+		PreURLs:  preURLs,
+		PostURLs: postURLs,
+		Timeout:  timeout,
+	}, nil
+}
+
+// stringSetting returns a string setting from environment, flag or config file
+func stringSetting(cmd *cobra.Command, flag, env string) string {
+	// flags are defined in init(), so GetString should never error
+	val, _ := cmd.Flags().GetString(flag) //nolint:errcheck // flags are predefined
+	if fileVal, ok := cfgFile.Get(flag); ok && !cmd.Flags().Changed(flag) {
+		val = fileVal
+	}
+	if envVal := os.Getenv(env); envVal != "" {
+		return envVal
+	}
+	return val
+}
+
+// boolSetting returns a bool setting, see stringSetting for precedence
+func boolSetting(cmd *cobra.Command, flag, env string) (bool, error) {
+	val, _ := cmd.Flags().GetBool(flag) //nolint:errcheck // flags are predefined
+	if fileVal, ok := cfgFile.Get(flag); ok && !cmd.Flags().Changed(flag) {
+		parsed, err := strconv.ParseBool(fileVal)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s %q: %w", flag, fileVal, err)
+		}
+		val = parsed
+	}
+	if envVal := os.Getenv(env); envVal != "" {
+		parsed, err := strconv.ParseBool(envVal)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s %q: %w", env, envVal, err)
+		}
+		val = parsed
+	}
+	return val, nil
+}
+
+// intSetting returns an int setting, see stringSetting for precedence
+func intSetting(cmd *cobra.Command, flag, env string) (int, error) {
+	val, _ := cmd.Flags().GetInt(flag) //nolint:errcheck // flags are predefined
+	if fileVal, ok := cfgFile.Get(flag); ok && !cmd.Flags().Changed(flag) {
+		parsed, err := strconv.Atoi(fileVal)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", flag, fileVal, err)
+		}
+		val = parsed
+	}
+	if envVal := os.Getenv(env); envVal != "" {
+		parsed, err := strconv.Atoi(envVal)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", env, envVal, err)
+		}
+		val = parsed
+	}
+	return val, nil
+}
+
+// durationSetting returns a duration setting, see stringSetting for precedence
+func durationSetting(cmd *cobra.Command, flag, env string) (time.Duration, error) {
+	val := stringSetting(cmd, flag, env)
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", flag, val, err)
+	}
+	return d, nil
 }
 
 // setupLogger initializes the logger based on configuration
@@ -128,6 +689,681 @@ func setupLogger(cmd *cobra.Command) *lgr.Logger {
 	return lgr.New(opts...)
 }
 
+// newGenerator creates a generator with templates and global options from the configuration
+func newGenerator(cfg *config.Config, log *lgr.Logger) (*nginx.Generator, error) {
+	generator, err := nginx.NewGenerator(cfg.StreamConfigPath, cfg.HTTPConfigPath, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureGenerator(generator, cfg, log); err != nil {
+		return nil, err
+	}
+
+	return generator, nil
+}
+
+// configureGenerator applies the reloadable settings to a generator
+func configureGenerator(generator *nginx.Generator, cfg *config.Config, log *lgr.Logger) error {
+	if err := generator.LoadTemplates(cfg.StreamTemplate, cfg.HTTPTemplate); err != nil {
+		return err
+	}
+
+	secrets, err := newSecretResolver(cfg, log)
+	if err != nil {
+		return err
+	}
+
+	botPatterns, err := nginx.BotPatterns(cfg.BotPresets, cfg.BotPatternsFile)
+	if err != nil {
+		return err
+	}
+
+	policy, err := docker.ParsePolicy(cfg.PolicyHostnames, cfg.PolicyPorts)
+	if err != nil {
+		return err
+	}
+
+	internal, err := nginx.NewInternalNetworks(cfg.InternalCIDRs, cfg.InternalStatus)
+	if err != nil {
+		return err
+	}
+
+	portCheck, err := nginx.ParsePortCheck(cfg.PortCheck)
+	if err != nil {
+		return err
+	}
+
+	syslog, err := nginx.SyslogTarget(cfg.SyslogServer, cfg.SyslogFacility)
+	if err != nil {
+		return err
+	}
+
+	logSample, err := docker.ParseLogSample(cfg.AccessLogSample)
+	if err != nil {
+		return fmt.Errorf("invalid access log sample: %w", err)
+	}
+
+	headerBuffers, err := nginx.NewHeaderBuffers(cfg.HeaderBufferSize, cfg.HeaderBuffers)
+	if err != nil {
+		return err
+	}
+
+	upstreamZone, err := nginx.ParseUpstreamZone(cfg.UpstreamZone)
+	if err != nil {
+		return err
+	}
+
+	limits, err := nginx.NewLimits(cfg.MaxRoutes, cfg.MaxServers, cfg.MaxConfigSize)
+	if err != nil {
+		return err
+	}
+
+	restartPage, err := nginx.NewRestartPage(cfg.RestartGrace, cfg.RestartPageAddr)
+	if err != nil {
+		return err
+	}
+
+	forwarded, err := nginx.NewForwardedPolicy(cfg.ForwardedHeaders, cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := docker.ParseResolver(cfg.Resolver)
+	if err != nil {
+		return fmt.Errorf("invalid resolver: %w", err)
+	}
+
+	streamDefaults, err := nginx.NewStreamDefaults(cfg.StreamDefaults.ProxyTimeout, cfg.StreamDefaults.ConnectTimeout,
+		cfg.StreamDefaults.PrereadTimeout, cfg.StreamDefaults.TCPNodelay)
+	if err != nil {
+		return err
+	}
+
+	sshGateway, err := nginx.NewSSHGateway(cfg.SSHGateway.Port, cfg.SSHGateway.Cert, cfg.SSHGateway.Key)
+	if err != nil {
+		return err
+	}
+
+	var tickets *nginx.TicketKeys
+	if cfg.TLSSessions.TicketRotate > 0 && remoteDelivery(cfg) {
+		return errors.New("--ssl-ticket-key-rotate needs a local nginx, ticket keys are not delivered to remote targets")
+	}
+	if cfg.TLSSessions.TicketRotate > 0 {
+		tickets = &nginx.TicketKeys{Dir: cfg.TLSSessions.TicketKeysDir}
+	}
+	tlsSessions, err := nginx.NewTLSSessions(cfg.TLSSessions.Cache, cfg.TLSSessions.Timeout, tickets)
+	if err != nil {
+		return err
+	}
+
+	configMode, err := nginx.ParseFileMode(cfg.ConfigFileMode)
+	if err != nil {
+		return err
+	}
+	configOwner, err := nginx.ParseFileOwner(cfg.ConfigOwner)
+	if err != nil {
+		return err
+	}
+	secretsMode, err := nginx.ParseFileMode(cfg.SecretsFileMode)
+	if err != nil {
+		return err
+	}
+	secretsOwner, err := nginx.ParseFileOwner(cfg.SecretsOwner)
+	if err != nil {
+		return err
+	}
+
+	external := make([]nginx.ExternalStream, 0, len(cfg.Streams))
+	for _, route := range cfg.Streams {
+		stream, err := nginx.NewExternalStream(route.Name, route.Protocol, route.Port, route.Target)
+		if err != nil {
+			return err
+		}
+		external = append(external, stream)
+	}
+
+	opts := nginx.Options{
+		ACMEChallengeAddr: cfg.ACMEChallengeAddr,
+		HeaderBuffers:     headerBuffers,
+		UpstreamZone:      upstreamZone,
+		Forwarded:         forwarded,
+		Resolver:          resolver,
+		Internal:          internal,
+		PortCheck:         portCheck,
+		Limits:            limits,
+		RestartPage:       restartPage,
+		Policy:            policy,
+		TransformScript:   cfg.TransformScript,
+		PluginsDir:        cfg.PluginsDir,
+		StreamDefaults:    streamDefaults,
+		SSHGateway:        sshGateway,
+		TLSSessions:       tlsSessions,
+		SecretsDir:        cfg.SecretsDir,
+		ConfigFileMode:    configMode,
+		ConfigOwner:       configOwner,
+		Fsync:             cfg.Fsync,
+		SecretsFileMode:   secretsMode,
+		SecretsOwner:      secretsOwner,
+		RemoteDelivery:    remoteDelivery(cfg),
+		Secrets:           secrets,
+		SigningKey:        cfg.SigningKey,
+		HTTP2:             cfg.HTTP2,
+		HTTP3:             cfg.HTTP3,
+		GeoIPDB:           cfg.GeoIPDB,
+		RequestID:         cfg.RequestID,
+		WAFRules:          cfg.WAFRules,
+		BotPatterns:       botPatterns,
+		Syslog:            syslog,
+		AccessLogJSON:     cfg.AccessLogJSON,
+		AccessLogSample:   logSample,
+		ExtraConfigDir:    cfg.ExtraConfigDir,
+		ConfigDumpCmd:     configDumpCmd(cfg, log),
+		IsolateNamespaces: cfg.IsolateNamespaces,
+		ExternalStreams:   external,
+		Capabilities:      probeCapabilities(cfg, log),
+	}
+	if cfg.ACMEDirectory != "" {
+		opts.Certificates = acme.CertDir(cfg.ACMECertsDir)
+	}
+	generator.SetOptions(opts)
+
+	return nil
+}
+
+// remoteDelivery reports whether the configs go to another nginx than the local one
+func remoteDelivery(cfg *config.Config) bool {
+	return cfg.SSH.Addr != "" || cfg.ObjectStore.URL != "" || cfg.Kubernetes.Name != "" || len(cfg.Targets) > 0
+}
+
+// capabilityProbeTimeout bounds nginx -V, a hung binary or docker exec must not block generation
+const capabilityProbeTimeout = 10 * time.Second
+
+// probeCapabilities asks the local nginx which protocols and modules it supports
+// Remote targets run a different nginx and bench sets no binary, nil assumes everything is supported
+func probeCapabilities(cfg *config.Config, log *lgr.Logger) *nginx.Capabilities {
+	if remoteDelivery(cfg) || cfg.NginxBinary == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), capabilityProbeTimeout)
+	defer cancel()
+	caps, err := nginx.ProbeCapabilities(ctx, cfg.NginxBinary, log)
+	if err != nil {
+		log.Logf("DEBUG [Config] nginx capability probe failed, assuming all protocols are supported error=%q", err)
+		return nil
+	}
+	return caps
+}
+
+// configDumpCmd returns the command printing the local nginx config for conflict checks
+// Remote targets run a different nginx, so the check is skipped for them
+func configDumpCmd(cfg *config.Config, log *lgr.Logger) string {
+	if !cfg.CheckNginxConfig {
+		return ""
+	}
+	if remoteDelivery(cfg) {
+		log.Logf("WARN [Config] --check-nginx-config only checks a local nginx, skipping it for remote targets")
+		return ""
+	}
+	return cfg.NginxBinary + " -T"
+}
+
+// newSecretResolver resolves *.secret labels from the secrets dir, and from Vault when configured
+func newSecretResolver(cfg *config.Config, log *lgr.Logger) (nginx.SecretResolver, error) {
+	dirSecrets := nginx.DirSecrets{Dir: cfg.SecretsDir}
+	if cfg.Vault.Addr == "" {
+		return dirSecrets, nil
+	}
+
+	vaultClient.mu.Lock()
+	defer vaultClient.mu.Unlock()
+	if vaultClient.client == nil || vaultClient.cfg != cfg.Vault {
+		client, err := vault.NewClient(cfg.Vault.Addr, cfg.Vault.Token, cfg.Vault.TokenFile, cfg.Vault.Refresh, log)
+		if err != nil {
+			return nil, fmt.Errorf("vault setup failed: %w", err)
+		}
+		vaultClient.cfg, vaultClient.client = cfg.Vault, client
+	}
+	return vault.NewResolver(vaultClient.client, cfg.Vault.Dir, dirSecrets, log), nil
+}
+
+// newTarget selects where changed configs are applied: the local nginx, a remote host
+// over SSH, an object store bucket, a Kubernetes ConfigMap/Secret or a fan-out to
+// the instances of the "targets" config file section
+func newTarget(cfg *config.Config, dockerClient *docker.Client, val Validator,
+	reload Reloader, log *lgr.Logger) (delivery.Target, error) {
+	selected := 0
+	for _, set := range []bool{cfg.SSH.Addr != "", cfg.ObjectStore.URL != "", cfg.Kubernetes.Name != "", len(cfg.Targets) > 0} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return nil, errors.New("ssh-target, object-store-url, kube-target and targets are mutually exclusive")
+	}
+
+	switch {
+	case len(cfg.Targets) > 0:
+		targets := make([]delivery.Target, 0, len(cfg.Targets))
+		for i, spec := range cfg.Targets {
+			target, err := newSpecTarget(cfg, spec, dockerClient, val, reload, log)
+			if errors.Is(err, docker.ErrPermissionDenied) {
+				log.Logf("WARN [Config] target %d (%s) disabled: %v", i, spec.Name, err)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("target %d (%s): %w", i, spec.Name, err)
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			return nil, errors.New("all targets are disabled, see the warnings above")
+		}
+		return delivery.NewFanOut(targets, cfg.TargetsStopOnError, log), nil
+	case cfg.ObjectStore.URL != "":
+		bucket, err := newBucket(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return delivery.NewObjectStore(bucket, bucket.String(), val, log), nil
+	case cfg.Kubernetes.Name != "":
+		return delivery.NewKubernetes(delivery.KubernetesConfig{
+			APIServer:  cfg.Kubernetes.APIServer,
+			TokenPath:  cfg.Kubernetes.TokenPath,
+			CAPath:     cfg.Kubernetes.CAPath,
+			Namespace:  cfg.Kubernetes.Namespace,
+			Kind:       cfg.Kubernetes.Kind,
+			Name:       cfg.Kubernetes.Name,
+			Deployment: cfg.Kubernetes.Deployment,
+		}, log)
+	case cfg.SSH.Addr != "":
+		return delivery.NewSSH(delivery.SSHConfig{
+			Addr:            cfg.SSH.Addr,
+			User:            cfg.SSH.User,
+			KeyPath:         cfg.SSH.KeyPath,
+			KnownHostsPath:  cfg.SSH.KnownHostsPath,
+			InsecureHostKey: cfg.SSH.InsecureHostKey,
+			RemotePaths: map[string]string{
+				cfg.StreamConfigPath: cfg.SSH.StreamConfigPath,
+				cfg.HTTPConfigPath:   cfg.SSH.HTTPConfigPath,
+			},
+			ValidateCmd: cfg.SSH.ValidateCmd,
+			ReloadCmd:   cfg.SSH.ReloadCmd,
+		}, log)
+	default:
+		return delivery.NewLocal(val, reload), nil
+	}
+}
+
+// newSpecTarget builds one fan-out target from its config file entry
+func newSpecTarget(cfg *config.Config, spec config.TargetSpec, dockerClient *docker.Client,
+	val Validator, reload Reloader, log *lgr.Logger) (delivery.Target, error) {
+	validateCmd, reloadCmd := spec.ValidateCmd, spec.ReloadCmd
+	if validateCmd == "" {
+		validateCmd = "nginx -t"
+	}
+	if reloadCmd == "" {
+		reloadCmd = "nginx -s reload"
+	}
+	streamPath, httpPath := spec.StreamConfigPath, spec.HTTPConfigPath
+	if streamPath == "" {
+		streamPath = cfg.StreamConfigPath
+	}
+	if httpPath == "" {
+		httpPath = cfg.HTTPConfigPath
+	}
+	paths := map[string]string{delivery.KindStream: streamPath, delivery.KindHTTP: httpPath}
+
+	switch spec.Type {
+	case "local":
+		// same paths as the generator: the default local nginx
+		if streamPath == cfg.StreamConfigPath && httpPath == cfg.HTTPConfigPath &&
+			spec.ValidateCmd == "" && spec.ReloadCmd == "" {
+			return delivery.NewLocal(val, reload), nil
+		}
+		instanceVal, err := nginx.NewCommandValidator(validateCmd, log)
+		if err != nil {
+			return nil, err
+		}
+		instanceReload, err := nginx.NewReloader(reloadCmd, log)
+		if err != nil {
+			return nil, err
+		}
+		name := spec.Name
+		if name == "" {
+			name = "local:" + filepath.Dir(streamPath)
+		}
+		return delivery.NewLocalCopy(name, paths, instanceVal, instanceReload, log), nil
+	case "ssh":
+		user, addr, ok := strings.Cut(spec.SSHTarget, "@")
+		if !ok || user == "" || addr == "" {
+			return nil, fmt.Errorf("invalid ssh-target %q, expected user@host[:port]", spec.SSHTarget)
+		}
+		return delivery.NewSSH(delivery.SSHConfig{
+			Addr:            addr,
+			User:            user,
+			KeyPath:         spec.SSHKey,
+			KnownHostsPath:  spec.SSHKnownHosts,
+			InsecureHostKey: spec.SSHInsecureHostKey,
+			RemotePaths: map[string]string{
+				cfg.StreamConfigPath: streamPath,
+				cfg.HTTPConfigPath:   httpPath,
+			},
+			ValidateCmd: validateCmd,
+			ReloadCmd:   reloadCmd,
+		}, log)
+	case "docker-exec":
+		if spec.Container == "" {
+			return nil, errors.New("docker-exec target requires a container")
+		}
+		if dockerClient == nil {
+			return nil, errors.New("docker-exec target requires a docker connection")
+		}
+		if !dockerClient.Permissions().Exec {
+			return nil, fmt.Errorf("%w: docker-exec target needs exec, allow EXEC and POST on the socket proxy",
+				docker.ErrPermissionDenied)
+		}
+		validateArgs, err := nginx.SplitCommand(validateCmd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validate-cmd: %w", err)
+		}
+		reloadArgs, err := nginx.SplitCommand(reloadCmd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reload-cmd: %w", err)
+		}
+		return delivery.NewDockerExec(spec.Container, dockerClient, paths, validateArgs, reloadArgs, log), nil
+	default:
+		return nil, fmt.Errorf("unknown target type %q, expected local, ssh or docker-exec", spec.Type)
+	}
+}
+
+// newBucket creates the object store client from config
+func newBucket(cfg *config.Config) (*delivery.S3Bucket, error) {
+	return delivery.NewS3Bucket(cfg.ObjectStore.URL, cfg.ObjectStore.Region, delivery.S3Credentials{
+		AccessKey:    cfg.ObjectStore.AccessKey,
+		SecretKey:    cfg.ObjectStore.SecretKey,
+		SessionToken: cfg.ObjectStore.SessionToken,
+	})
+}
+
+// startMetrics serves the metrics registry, tails the JSON access log into it and evaluates alert rules, if configured
+// The returned stop function is always safe to call
+func startMetrics(ctx context.Context, cfg *config.Config, registry *metrics.Registry, events notify.Sink,
+	log *lgr.Logger) (func(), error) {
+	if cfg.MetricsAddr == "" && len(cfg.Alerts) == 0 {
+		return func() {}, nil
+	}
+
+	var alerter *metrics.Alerter
+	if len(cfg.Alerts) > 0 {
+		var err error
+		if alerter, err = newAlerter(cfg, registry, events, log); err != nil {
+			return nil, err
+		}
+	}
+
+	var server *metrics.Server
+	if cfg.MetricsAddr != "" {
+		server = metrics.NewServer(cfg.MetricsAddr, registry, log)
+		if err := server.Start(); err != nil {
+			return nil, err
+		}
+	}
+
+	tailCtx, stopTail := context.WithCancel(ctx)
+	if cfg.AccessLogJSON != "" {
+		go metrics.NewTailer(cfg.AccessLogJSON, registry, log).Run(tailCtx)
+	}
+	if alerter != nil {
+		go alerter.Run(tailCtx)
+	}
+
+	return func() {
+		stopTail()
+		if server == nil {
+			return
+		}
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Close(closeCtx); err != nil {
+			log.Logf("WARN [Metrics] %v", err)
+		}
+	}, nil
+}
+
+// newAlerter creates the alerter for the alert rules of the config file
+func newAlerter(cfg *config.Config, registry *metrics.Registry, events notify.Sink, log *lgr.Logger) (*metrics.Alerter, error) {
+	if cfg.AccessLogJSON == "" {
+		return nil, errors.New("alert rules need the JSON access log, set --access-log-json")
+	}
+	if len(cfg.Webhooks) == 0 && cfg.AdminGRPCAddr == "" {
+		return nil, errors.New("alert rules need a webhook or the admin API, set --webhook-urls or --admin-grpc-addr")
+	}
+
+	rules := make([]metrics.AlertRule, 0, len(cfg.Alerts))
+	for _, rule := range cfg.Alerts {
+		rules = append(rules, metrics.AlertRule{
+			Name:        rule.Name,
+			Host:        rule.Host,
+			Status:      rule.Status,
+			Threshold:   rule.Threshold,
+			For:         rule.For,
+			MinRequests: rule.MinRequests,
+		})
+	}
+	return metrics.NewAlerter(rules, registry, events, log)
+}
+
+// newDockerClient connects to the configured Docker host
+// When the default socket is missing, rootless Docker and Podman sockets are tried before failing
+func newDockerClient(cfg *config.Config, log *lgr.Logger) (*docker.Client, error) {
+	host := cfg.DockerHost
+	if host == config.DefaultDockerHost() {
+		detected, ok := docker.DetectHost(host, docker.SocketCandidates())
+		switch {
+		case !ok:
+			log.Logf("DEBUG [Docker] no socket found at %s or %s", host, strings.Join(docker.SocketCandidates(), ", "))
+		case detected != host:
+			log.Logf("INFO [Docker] default socket not found, using detected socket=%s", detected)
+			host = detected
+		}
+	}
+	family, err := docker.ParseAddressFamily(cfg.AddressFamily)
+	if err != nil {
+		return nil, err
+	}
+	hostAddr, err := docker.ParseHostAddress(cfg.HostAddress)
+	if err != nil {
+		return nil, err
+	}
+	dockerClient, err := docker.NewClient(host, cfg.DockerAPIVersion, log)
+	if err != nil {
+		return nil, err
+	}
+	dockerClient.SetAPILimits(dockerAPILimits(cfg), nil)
+	dockerClient.SetAddressFamily(family)
+	dockerClient.SetHostAddress(hostAddr)
+	return dockerClient, nil
+}
+
+// dockerAPILimits returns the throttling of Docker API calls
+func dockerAPILimits(cfg *config.Config) docker.APILimits {
+	return docker.APILimits{Rate: cfg.DockerAPIRate, Burst: cfg.DockerAPIBurst, Budget: cfg.DockerAPIBudget}
+}
+
+// observeDockerAPI counts the Docker API calls of the client in the registry, with the time
+// they were throttled and the calls rejected over the budget
+func observeDockerAPI(dockerClient *docker.Client, cfg *config.Config, registry *metrics.Registry) {
+	dockerClient.SetAPILimits(dockerAPILimits(cfg), func(call docker.APICall) {
+		labels := metrics.Labels{"call": call.Name}
+		if call.Rejected {
+			registry.Add("proxy_docker_api_rejected_total", "Docker API calls rejected over --docker-api-budget", labels, 1)
+			return
+		}
+		registry.Add("proxy_docker_api_calls_total", "Docker API calls by kind", labels, 1)
+		registry.Add("proxy_docker_api_throttled_seconds_total", "Seconds Docker API calls waited for --docker-api-rate", labels,
+			call.Waited.Seconds())
+	})
+}
+
+// dockerFeatures returns the Docker API features used by one-off scans, or by the watching commands
+func dockerFeatures(cfg *config.Config, watching bool) []docker.Feature {
+	features := []docker.Feature{docker.FeatureScan}
+	if !watching {
+		return features
+	}
+	features = append(features, docker.FeatureEvents, docker.FeatureNetwork)
+	for _, spec := range cfg.Targets {
+		if spec.Type == "docker-exec" {
+			return append(features, docker.FeatureExec)
+		}
+	}
+	return features
+}
+
+// checkDockerPermissions probes the endpoints a restricted docker-socket-proxy may deny
+// Scans need container access, missing network and exec access degrade with a warning
+func checkDockerPermissions(ctx context.Context, dockerClient *docker.Client, log *lgr.Logger) error {
+	perms := dockerClient.ProbePermissions(ctx)
+	if !perms.Containers {
+		return fmt.Errorf("%w: listing containers is required, allow CONTAINERS on the socket proxy",
+			docker.ErrPermissionDenied)
+	}
+	if !perms.Networks {
+		log.Logf("WARN [Docker] network access denied, the proxy network is not created automatically " +
+			"(allow NETWORKS and POST on the socket proxy)")
+	}
+	if !perms.Exec {
+		log.Logf("WARN [Docker] exec access denied, docker-exec targets are disabled " +
+			"(allow EXEC and POST on the socket proxy)")
+	}
+	return nil
+}
+
+// ensureNetwork creates the proxy network, skipping it when the Docker API denies network access
+func ensureNetwork(ctx context.Context, dockerClient *docker.Client, name string, log *lgr.Logger) error {
+	if dockerClient.Permissions().Networks {
+		err := dockerClient.EnsureNetwork(ctx, name)
+		if !errors.Is(err, docker.ErrPermissionDenied) {
+			return err
+		}
+		// listing can be allowed while creating is not, e.g. NETWORKS without POST
+	}
+	log.Logf("WARN [Docker] skipping network setup, create it manually: docker network create %s", name)
+	return nil
+}
+
+// startACMEResponder starts the ACME challenge responder if configured, nil when disabled
+// The returned stop function is always safe to call
+func startACMEResponder(cfg *config.Config, log *lgr.Logger) (*acme.ChallengeServer, func(), error) {
+	if cfg.ACMEChallengeAddr == "" {
+		return nil, func() {}, nil
+	}
+
+	responder := acme.NewChallengeServer(cfg.ACMEChallengeAddr, cfg.ACMEWebroot, log)
+	if err := responder.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	return responder, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := responder.Close(ctx); err != nil {
+			log.Logf("WARN [ACME] %v", err)
+		}
+	}, nil
+}
+
+// startACMEIssuer issues certificates for the HTTPS hosts of the pipeline if an ACME directory
+// is configured, and regenerates configs once new certificates are written
+// The returned stop function is always safe to call
+func startACMEIssuer(ctx context.Context, cfg *config.Config, responder *acme.ChallengeServer,
+	pipe *pipeline, log *lgr.Logger) (func(), error) {
+	if cfg.ACMEDirectory == "" {
+		return func() {}, nil
+	}
+	if responder == nil {
+		return nil, errors.New("acme-directory needs acme-challenge-addr to answer HTTP-01 challenges")
+	}
+
+	directory, err := acme.ResolveDirectory(cfg.ACMEDirectory)
+	if err != nil {
+		return nil, err
+	}
+	keyType, err := acme.ParseKeyType(cfg.ACMEKeyType)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := acme.NewIssuer(acme.IssuerConfig{
+		Directory: directory,
+		Email:     cfg.ACMEEmail,
+		KeyType:   keyType,
+		Dir:       cfg.ACMECertsDir,
+	}, responder, log)
+	if err != nil {
+		return nil, err
+	}
+	pipe.certs = issuer
+
+	ctx, cancel := context.WithCancel(ctx)
+	go issuer.Run(ctx, func() {
+		if err := pipe.run(ctx); err != nil {
+			log.Logf("ERROR [ACME] regeneration with new certificates failed error=%q", err)
+		}
+	})
+
+	log.Logf("INFO [ACME] issuer started directory=%s key_type=%s certs_dir=%s", directory, keyType, cfg.ACMECertsDir)
+	return cancel, nil
+}
+
+// startTicketRotation rotates the managed session ticket keys if enabled and regenerates
+// configs, so nginx reloads with the new key while older ones still decrypt tickets
+// A first key is written at start, the returned stop function is always safe to call
+func startTicketRotation(ctx context.Context, cfg *config.Config, pipe *pipeline, log *lgr.Logger) (func(), error) {
+	if cfg.TLSSessions.TicketRotate <= 0 {
+		return func() {}, nil
+	}
+
+	tickets := &nginx.TicketKeys{Dir: cfg.TLSSessions.TicketKeysDir}
+	files, err := tickets.Files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if err := tickets.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(cfg.TLSSessions.TicketRotate)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := tickets.Rotate(); err != nil {
+				log.Logf("ERROR [TLS] ticket key rotation failed error=%q", err)
+				continue
+			}
+			log.Logf("INFO [TLS] ticket key rotated dir=%s", tickets.Dir)
+			if err := pipe.run(ctx); err != nil {
+				log.Logf("ERROR [TLS] regeneration with the new ticket key failed error=%q", err)
+				continue
+			}
+			if err := tickets.Prune(); err != nil {
+				log.Logf("ERROR [TLS] old ticket key removal failed error=%q", err)
+			}
+		}
+	}()
+
+	log.Logf("INFO [TLS] ticket key rotation started interval=%s dir=%s", cfg.TLSSessions.TicketRotate, tickets.Dir)
+	return cancel, nil
+}
+
 // GetConfig returns the current configuration (used by subcommands)
 func GetConfig() *config.Config {
 	return cfg
@@ -138,6 +1374,57 @@ func GetLogger() *lgr.Logger {
 	return log
 }
 
+// process exit codes, so wrapper scripts and health checks can branch on the failure type
+const (
+	exitFailure           = 1  // any other error
+	exitFailureBudget     = 3  // watch or run gave up after --failure-budget failed runs, see --failure-exit
+	exitDockerUnreachable = 10 // the Docker daemon does not answer
+	exitConflict          = 11 // routes claim the same port, hostname or SSH alias
+	exitValidation        = 12 // nginx rejected the generated configs
+	exitReload            = 13 // nginx failed to reload the configs
+	exitTampered          = 14 // validate found configs modified outside the proxy
+	exitVetoed            = 15 // a plugin vetoed the generation
+	exitLimit             = 16 // the configs exceed --max-routes, --max-upstream-servers or --max-config-size
+)
+
+// exitCode returns the exit code of a command error by its failure type
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, docker.ErrUnreachable):
+		return exitDockerUnreachable
+	case errors.Is(err, nginx.ErrConflict):
+		return exitConflict
+	case errors.Is(err, nginx.ErrTampered):
+		return exitTampered
+	case errors.Is(err, nginx.ErrVetoed):
+		return exitVetoed
+	case errors.Is(err, nginx.ErrLimitExceeded):
+		return exitLimit
+	case errors.Is(err, delivery.ErrValidation):
+		return exitValidation
+	case errors.Is(err, delivery.ErrReload):
+		return exitReload
+	}
+	return exitFailure
+}
+
+// ExitError carries a specific process exit code out of a command
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 // logError logs an error and returns it for command return
 func logError(format string, args ...interface{}) error {
 	err := fmt.Errorf(format, args...)
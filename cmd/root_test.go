@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "other", err: errors.New("generator initialization failed"), want: exitFailure},
+		{name: "docker", err: fmt.Errorf("docker connection failed: %w", docker.ErrUnreachable), want: exitDockerUnreachable},
+		{name: "conflict", err: fmt.Errorf("initial generation failed: %w", nginx.ErrConflict), want: exitConflict},
+		{name: "validation", err: fmt.Errorf("target local: %w: nginx config invalid", delivery.ErrValidation), want: exitValidation},
+		{name: "reload", err: fmt.Errorf("target local: %w: nginx is not running", delivery.ErrReload), want: exitReload},
+		{name: "tampered", err: fmt.Errorf("tampered configs detected: %w", nginx.ErrTampered), want: exitTampered},
+		{name: "vetoed", err: fmt.Errorf("generation failed: %w gate: frozen", nginx.ErrVetoed), want: exitVetoed},
+		{name: "limit", err: fmt.Errorf("initial generation failed: %w: 12000 routes, limit is 10000", nginx.ErrLimitExceeded), want: exitLimit},
+		{
+			name: "fan-out",
+			err:  fmt.Errorf("2 of 2 targets failed: %w", errors.Join(delivery.ErrReload, delivery.ErrValidation)),
+			want: exitValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSecretResolverReusesVaultClient(t *testing.T) {
+	cfg := &config.Config{Vault: config.Vault{Addr: "http://127.0.0.1:8200", Token: "root", Dir: t.TempDir()}}
+	if _, err := newSecretResolver(cfg, lgr.New()); err != nil {
+		t.Fatalf("newSecretResolver() error = %v", err)
+	}
+	first := vaultClient.client
+
+	if _, err := newSecretResolver(cfg, lgr.New()); err != nil {
+		t.Fatalf("newSecretResolver() error = %v", err)
+	}
+	if vaultClient.client != first {
+		t.Error("reload with the same Vault settings created a new client")
+	}
+
+	cfg.Vault.Token = "rotated"
+	if _, err := newSecretResolver(cfg, lgr.New()); err != nil {
+		t.Fatalf("newSecretResolver() error = %v", err)
+	}
+	if vaultClient.client == first {
+		t.Error("changed Vault settings kept the previous client")
+	}
+}
+
+func TestConfigDumpCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{name: "disabled", cfg: config.Config{NginxBinary: "nginx"}, want: ""},
+		{name: "local", cfg: config.Config{CheckNginxConfig: true, NginxBinary: "nginx"}, want: "nginx -T"},
+		{name: "nginx binary", cfg: config.Config{CheckNginxConfig: true, NginxBinary: "docker exec edge nginx"}, want: "docker exec edge nginx -T"},
+		{name: "remote target", cfg: config.Config{CheckNginxConfig: true, NginxBinary: "nginx", SSH: config.SSHTarget{Addr: "edge:22"}}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configDumpCmd(&tt.cfg, lgr.New()); got != tt.want {
+				t.Errorf("configDumpCmd() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureGeneratorTicketRotation(t *testing.T) {
+	generator, err := nginx.NewGenerator(filepath.Join(t.TempDir(), "stream.conf"), filepath.Join(t.TempDir(), "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	cfg := &config.Config{SSH: config.SSHTarget{Addr: "edge:22"}}
+	cfg.TLSSessions.TicketRotate = 12 * time.Hour
+	if err := configureGenerator(generator, cfg, lgr.New()); err == nil {
+		t.Error("configureGenerator() error = nil, want ticket rotation rejected for a remote target")
+	}
+}
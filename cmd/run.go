@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/moontechs/proxy/metrics"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run nginx as a child process and keep its configs in sync with Docker",
+	Long: `Supervisor mode: generates the initial configs, starts nginx in the
+foreground as a child process and then watches Docker events exactly like
+the watch command.
+
+Features:
+- Initial generation and validation before nginx starts
+- Signals (SIGINT/SIGTERM/SIGQUIT/SIGUSR1) are forwarded to nginx
+- SIGHUP reloads the proxy configuration and regenerates (nginx is reloaded if configs change)
+- Exits with nginx's exit code when nginx stops
+- Single-container image without s6/supervisord`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		log.Logf("INFO [Run] starting supervisor mode")
+
+		// Setup components
+		dockerClient, err := newDockerClient(cfg, log)
+		if err != nil {
+			return logError("docker connection failed: %w", err)
+		}
+		defer func() {
+			if closeErr := dockerClient.Close(); closeErr != nil {
+				log.Logf("WARN [Run] failed to close docker client: %v", closeErr)
+			}
+		}()
+
+		if err := dockerClient.CheckAPIVersion(dockerFeatures(cfg, true)...); err != nil {
+			return logError("docker API check failed: %w", err)
+		}
+
+		if err := checkDockerPermissions(ctx, dockerClient, log); err != nil {
+			return logError("docker permission check failed: %w", err)
+		}
+
+		if err := ensureNetwork(ctx, dockerClient, cfg.NetworkName, log); err != nil {
+			return logError("network setup failed: %w", err)
+		}
+
+		generator, err := newGenerator(cfg, log)
+		if err != nil {
+			return logError("generator initialization failed: %w", err)
+		}
+
+		validator := nginx.NewValidator(log)
+
+		responder, stopACME, err := startACMEResponder(cfg, log)
+		if err != nil {
+			return logError("ACME responder start failed: %w", err)
+		}
+		defer stopACME()
+
+		events, broker := newEvents(cfg, log)
+		defer events.Flush(context.Background())
+
+		registry := metrics.NewRegistry()
+		observeDockerAPI(dockerClient, cfg, registry)
+		stopMetrics, err := startMetrics(ctx, cfg, registry, events, log)
+		if err != nil {
+			return logError("metrics server start failed: %w", err)
+		}
+		defer stopMetrics()
+
+		reloader, err := nginx.NewReloader(cfg.NginxReloadCmd, log)
+		if err != nil {
+			return logError("reloader initialization failed: %w", err)
+		}
+
+		// Initial generation happens before nginx exists, so there is nothing to reload yet
+		target, err := newTarget(cfg, dockerClient, validator, reloader, log)
+		if err != nil {
+			return logError("delivery target setup failed: %w", err)
+		}
+
+		pipe, err := newPipeline(dockerClient, generator, validator, target, cfg.StateFile, log)
+		if err != nil {
+			return logError("state initialization failed: %w", err)
+		}
+		pipe.events = events
+		pipe.failureBudget = cfg.FailureBudget
+		budgetErr := exitOnExhausted(cfg, pipe, cancel)
+		pipe.setMetrics(registry)
+		if pipe.warmup, err = newWarmer(cfg.Warmup, log); err != nil {
+			return logError("warm-up setup failed: %w", err)
+		}
+		if pipe.hooks, err = newHooks(cfg.Hooks, log); err != nil {
+			return logError("hook setup failed: %w", err)
+		}
+
+		stopIssuer, err := startACMEIssuer(ctx, cfg, responder, pipe, log)
+		if err != nil {
+			return logError("ACME issuer start failed: %w", err)
+		}
+		defer stopIssuer()
+
+		stopTickets, err := startTicketRotation(ctx, cfg, pipe, log)
+		if err != nil {
+			return logError("ticket key rotation start failed: %w", err)
+		}
+		defer stopTickets()
+
+		log.Logf("INFO [Run] performing initial config generation")
+		if _, err := pipe.runWithoutReload(ctx); err != nil {
+			return logError("initial generation failed: %w", err)
+		}
+
+		stopAdmin, err := startAdmin(cfg, pipe, broker, log)
+		if err != nil {
+			return logError("admin API start failed: %w", err)
+		}
+		defer stopAdmin()
+
+		// Start nginx
+		supervisor := nginx.NewSupervisor(cfg.NginxCmd, log)
+		if err := supervisor.Start(); err != nil {
+			return logError("nginx start failed: %w", err)
+		}
+
+		// Forward signals to nginx, nginx exit ends the watch loop
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, forwardedSignals...)
+		defer signal.Stop(sigCh)
+
+		go func() {
+			for {
+				select {
+				case sig := <-sigCh:
+					log.Logf("INFO [Run] received signal=%s, forwarding to nginx", sig)
+					if err := supervisor.Signal(sig); err != nil {
+						log.Logf("WARN [Run] signal forwarding failed error=%q", err)
+					}
+				case <-supervisor.Done():
+					cancel()
+					return
+				}
+			}
+		}()
+
+		log.Logf("INFO [Run] ready and watching for container events")
+		fmt.Println("✓ Nginx running, watching Docker events (Ctrl+C to stop)")
+
+		w := newWatcher(dockerClient, cfg, log, pipe.run)
+		w.reloadConfig = reloadGeneratorConfig(cmd, generator, log)
+		w.nextChange = pipe.nextChange
+		w.watchConfigChanges(ctx, cfg.ConfigFile)
+
+		loopErr := w.run(ctx)
+		exitErr := budgetErr()
+		if loopErr != nil || exitErr != nil {
+			// watcher died or gave up while nginx is still up, stop nginx gracefully
+			if err := supervisor.Signal(stopSignal); err != nil {
+				log.Logf("WARN [Run] failed to stop nginx error=%q", err)
+			}
+		}
+
+		<-supervisor.Done()
+
+		if loopErr != nil {
+			return loopErr
+		}
+		if exitErr != nil {
+			return exitErr
+		}
+		if err := supervisor.Err(); err != nil {
+			return logError("nginx wait failed: %w", err)
+		}
+		if code := supervisor.ExitCode(); code != 0 {
+			return &ExitError{Code: code, Err: fmt.Errorf("nginx exited with code %d", code)}
+		}
+
+		fmt.Println("✓ Nginx stopped, shutting down")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/dataplane"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Experimental: proxy traffic directly in Go without nginx",
+	Long: `Runs the TCP/UDP forwarding and HTTP hostname routing in-process
+instead of generating nginx configs. Uses the same container labels and
+Docker event watching as the watch command, containers are rewritten by
+--transform-script and checked against --policy-hostnames and --policy-ports
+before they are routed.
+
+Limitations:
+- HTTPS listeners (proxy.http.https) are not terminated, HTTP routing is plain HTTP only
+- Hosts protected with proxy.http.auth.secret or proxy.http.oidc.* are not served
+- Hosts with proxy.http.backend_scheme=https, proxy.http.grpc, proxy.http.static.root,
+  proxy.http.geo.*, proxy.http.valid_referers, proxy.http.waf, proxy.http.block_bots,
+  proxy.http.allowed_methods, proxy.http.max_body_size, proxy.http.internal_only,
+  proxy.http.allow_from, proxy.http.pass_vars or proxy.http.forwarded_headers=overwrite|strip
+  are not served
+- --forwarded-headers other than append and --trusted-proxies fail the start
+- proxy.http.request_id, limit_conn and limit_rate are ignored,
+  as is proxy.tcp.max_connections
+- Replicas pooled with proxy.stream.hash or by service are all served by the first container,
+  proxy.http.next_upstream, retries and next_upstream_timeout are ignored
+- No per-route tuning beyond what the labels describe`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		listenAddr, _ := cmd.Flags().GetString("listen-addr") //nolint:errcheck // flag is predefined
+		httpPort, _ := cmd.Flags().GetInt("http-port")        //nolint:errcheck // flag is predefined
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		log.Logf("INFO [Serve] starting embedded data plane")
+
+		dockerClient, err := newDockerClient(cfg, log)
+		if err != nil {
+			return logError("docker connection failed: %w", err)
+		}
+		defer func() {
+			if closeErr := dockerClient.Close(); closeErr != nil {
+				log.Logf("WARN [Serve] failed to close docker client: %v", closeErr)
+			}
+		}()
+
+		if err := dockerClient.CheckAPIVersion(dockerFeatures(cfg, true)...); err != nil {
+			return logError("docker API check failed: %w", err)
+		}
+
+		if err := checkDockerPermissions(ctx, dockerClient, log); err != nil {
+			return logError("docker permission check failed: %w", err)
+		}
+
+		if err := ensureNetwork(ctx, dockerClient, cfg.NetworkName, log); err != nil {
+			return logError("network setup failed: %w", err)
+		}
+
+		server := dataplane.NewServer(listenAddr, httpPort, log)
+		if err := server.Start(); err != nil {
+			return logError("data plane start failed: %w", err)
+		}
+		defer func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer shutdownCancel()
+			if err := server.Close(shutdownCtx); err != nil {
+				log.Logf("WARN [Serve] data plane shutdown failed: %v", err)
+			}
+		}()
+
+		routes := &serveRoutes{scanner: dockerClient, server: server, config: GetConfig, log: log}
+
+		log.Logf("INFO [Serve] performing initial route setup")
+		if err := routes.apply(ctx); err != nil {
+			return logError("initial route setup failed: %w", err)
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			select {
+			case sig := <-sigCh:
+				log.Logf("INFO [Serve] shutdown signal=%s", sig)
+				fmt.Println("\n✓ Shutting down gracefully...")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		fmt.Println("✓ Serving traffic, watching Docker events (Ctrl+C to stop)")
+
+		w := newWatcher(dockerClient, cfg, log, routes.apply)
+		w.nextChange = routes.nextChange
+		w.reloadConfig = reloadGeneratorConfig(cmd, nil, log)
+		w.watchConfigChanges(ctx, cfg.ConfigFile)
+
+		return w.run(ctx)
+	},
+}
+
+// routeUpdater replaces the routes of the data plane, implemented by dataplane.Server
+type routeUpdater interface {
+	Update(containers []docker.ContainerInfo) error
+}
+
+// serveRoutes applies scans to the embedded data plane and remembers when their routes
+// change next, so expiring routes and schedule windows are applied without a Docker event
+type serveRoutes struct {
+	scanner DockerScanner
+	server  routeUpdater
+	config  func() *config.Config // current settings, re-read on every apply
+	log     *lgr.Logger
+
+	mu     sync.Mutex
+	change time.Time
+}
+
+// apply scans the containers and updates the routes of the data plane
+func (s *serveRoutes) apply(ctx context.Context) error {
+	scan, err := s.scanner.Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+	s.mu.Lock()
+	s.change = scan.NextChange
+	s.mu.Unlock()
+
+	containers, err := serveContainers(s.config(), scan.Containers, s.log)
+	if err != nil {
+		return err
+	}
+	if err := s.server.Update(containers); err != nil {
+		return fmt.Errorf("route update failed: %w", err)
+	}
+	return nil
+}
+
+// nextChange returns when the routes of the last scan change next, zero if they never do
+func (s *serveRoutes) nextChange() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.change
+}
+
+// serveContainers prepares the scanned containers for the data plane the way the generator
+// does for nginx: the transform script runs first, then the route policy drops denied routes
+// Errors keep the current routes, an invalid policy fails the initial setup
+func serveContainers(cfg *config.Config, containers []docker.ContainerInfo, log *lgr.Logger) ([]docker.ContainerInfo, error) {
+	policy, err := docker.ParsePolicy(cfg.PolicyHostnames, cfg.PolicyPorts)
+	if err != nil {
+		return nil, err
+	}
+	// the data plane appends the client to X-Forwarded-For, like nginx without trusted proxies
+	forwarded, err := nginx.NewForwardedPolicy(cfg.ForwardedHeaders, cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded.Mode != "" || len(forwarded.TrustedProxies) > 0 {
+		return nil, errors.New("--forwarded-headers other than append and --trusted-proxies are not supported by serve")
+	}
+	if containers, err = nginx.Transform(cfg.TransformScript, containers, log); err != nil {
+		return nil, fmt.Errorf("transform failed: %w", err)
+	}
+	containers, denied := policy.Admit(containers)
+	for _, d := range denied {
+		log.Logf("WARN [Serve] route denied container=%s route=%s reason=%q", d.Container, d.Route, d.Reason)
+	}
+	return containers, nil
+}
+
+func init() {
+	serveCmd.Flags().String("listen-addr", "", "Bind address for all listeners (default: all interfaces)")
+	serveCmd.Flags().Int("http-port", 80, "HTTP hostname routing port (0 disables HTTP routing)")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestServeContainers(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{Name: "web", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+		{Name: "tmp-web", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"tmp.example.com"}, ContainerPort: 80}},
+	}
+
+	t.Run("transform script", func(t *testing.T) {
+		script := filepath.Join(t.TempDir(), "transform.star")
+		src := "def transform(containers):\n    return [c for c in containers if not c[\"Name\"].startswith(\"tmp-\")]\n"
+		if err := os.WriteFile(script, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := serveContainers(&config.Config{TransformScript: script}, containers, lgr.New())
+		if err != nil {
+			t.Fatalf("serveContainers() error = %v", err)
+		}
+		if len(got) != 1 || got[0].Name != "web" {
+			t.Errorf("serveContainers() = %+v, want only web", got)
+		}
+	})
+
+	t.Run("failing transform script", func(t *testing.T) {
+		script := filepath.Join(t.TempDir(), "transform.star")
+		if err := os.WriteFile(script, []byte("def transform(containers):\n    fail(\"boom\")\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := serveContainers(&config.Config{TransformScript: script}, containers, lgr.New()); err == nil {
+			t.Error("serveContainers() error = nil, want the script failure")
+		}
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		got, err := serveContainers(&config.Config{PolicyHostnames: "web.example.com"}, containers, lgr.New())
+		if err != nil {
+			t.Fatalf("serveContainers() error = %v", err)
+		}
+		if len(got) != 1 || got[0].Name != "web" {
+			t.Errorf("serveContainers() = %+v, want only web", got)
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		if _, err := serveContainers(&config.Config{PolicyPorts: "80-x"}, containers, lgr.New()); err == nil {
+			t.Error("serveContainers() error = nil, want the policy error")
+		}
+	})
+
+	t.Run("forwarded headers", func(t *testing.T) {
+		for _, cfg := range []*config.Config{{ForwardedHeaders: "strip"}, {TrustedProxies: "173.245.48.0/20"}} {
+			if _, err := serveContainers(cfg, containers, lgr.New()); err == nil {
+				t.Errorf("serveContainers(%+v) error = nil, want unsupported settings rejected", cfg)
+			}
+		}
+		if _, err := serveContainers(&config.Config{ForwardedHeaders: "append"}, containers, lgr.New()); err != nil {
+			t.Errorf("serveContainers() error = %v, want append served", err)
+		}
+	})
+
+	t.Run("no settings", func(t *testing.T) {
+		got, err := serveContainers(&config.Config{}, containers, lgr.New())
+		if err != nil || len(got) != len(containers) {
+			t.Errorf("serveContainers() = %d containers, %v, want all of them", len(got), err)
+		}
+	})
+}
+
+// timedScanner routes web until expires, like a container with proxy.expires
+type timedScanner struct {
+	expires time.Time
+}
+
+func (s *timedScanner) Scan(context.Context) (docker.ScanResult, error) {
+	if time.Now().Before(s.expires) {
+		return docker.ScanResult{NextChange: s.expires, Containers: []docker.ContainerInfo{
+			{Name: "web", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+		}}, nil
+	}
+	return docker.ScanResult{}, nil
+}
+
+func (s *timedScanner) WatchEvents(context.Context) (<-chan docker.ContainerEvent, <-chan error) {
+	return make(chan docker.ContainerEvent), make(chan error)
+}
+
+// recordingServer sends every route update of the data plane to updates
+type recordingServer struct {
+	updates chan []docker.ContainerInfo
+}
+
+func (s *recordingServer) Update(containers []docker.ContainerInfo) error {
+	s.updates <- containers
+	return nil
+}
+
+// serveUpdates runs serve's watcher on scanner without Docker events and returns the routes
+// of the initial update and of the n updates after it
+func serveUpdates(t *testing.T, scanner DockerScanner, n int) [][]docker.ContainerInfo {
+	t.Helper()
+	server := &recordingServer{updates: make(chan []docker.ContainerInfo, 10)}
+	routes := &serveRoutes{scanner: scanner, server: server, log: lgr.New(),
+		config: func() *config.Config { return &config.Config{} }}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := routes.apply(ctx); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	updates := [][]docker.ContainerInfo{<-server.updates}
+
+	w := newWatcher(scanner, &config.Config{Debounce: time.Millisecond}, lgr.New(), routes.apply)
+	w.nextChange = routes.nextChange
+	done := make(chan error, 1)
+	go func() { done <- w.run(ctx) }()
+
+	for range n {
+		select {
+		case containers := <-server.updates:
+			updates = append(updates, containers)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("routes not updated when they changed, updates=%d", len(updates))
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run() after cancel = %v, want nil", err)
+	}
+	return updates
+}
+
+func TestServeRoutesExpire(t *testing.T) {
+	updates := serveUpdates(t, &timedScanner{expires: time.Now().Add(50 * time.Millisecond)}, 1)
+	if len(updates[0]) != 1 || len(updates[1]) != 0 {
+		t.Errorf("routes = %+v, want web until it expires and none after", updates)
+	}
+}
+
+// windowScanner routes admin between opens and closes, like a container with proxy.schedule
+type windowScanner struct {
+	opens, closes time.Time
+}
+
+func (s *windowScanner) Scan(context.Context) (docker.ScanResult, error) {
+	switch now := time.Now(); {
+	case now.Before(s.opens):
+		return docker.ScanResult{NextChange: s.opens}, nil
+	case now.Before(s.closes):
+		return docker.ScanResult{NextChange: s.closes, Containers: []docker.ContainerInfo{
+			{Name: "admin", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"admin.example.com"}, ContainerPort: 80}},
+		}}, nil
+	default:
+		return docker.ScanResult{}, nil
+	}
+}
+
+func (s *windowScanner) WatchEvents(context.Context) (<-chan docker.ContainerEvent, <-chan error) {
+	return make(chan docker.ContainerEvent), make(chan error)
+}
+
+func TestServeRoutesScheduleWindow(t *testing.T) {
+	now := time.Now()
+	updates := serveUpdates(t, &windowScanner{opens: now.Add(50 * time.Millisecond), closes: now.Add(100 * time.Millisecond)}, 2)
+	if len(updates[0]) != 0 || len(updates[1]) != 1 || len(updates[2]) != 0 {
+		t.Errorf("routes = %+v, want admin only while its window is open", updates)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed to nginx in run mode
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1}
+
+// stopSignal asks nginx for a graceful shutdown
+var stopSignal os.Signal = syscall.SIGQUIT
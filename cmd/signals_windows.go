@@ -0,0 +1,15 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed to nginx in run mode
+// Windows only delivers interrupt and terminate, nginx is stopped via process kill
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// stopSignal stops nginx, Windows has no graceful shutdown signal
+var stopSignal os.Signal = os.Kill
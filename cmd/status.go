@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/state"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the routes of the last generation",
+	Long: `Reads the routes of the last generation from the state file and prints them
+per container.
+
+With the SSH gateway enabled (--ssh-gateway-port), each proxy.ssh.alias is listed
+with the ssh command that reaches it: SSH is wrapped in TLS by openssl s_client,
+which sends the alias as server name. With --ssh-config the aliases are printed as
+~/.ssh/config entries instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		sshConfig, _ := cmd.Flags().GetBool("ssh-config") //nolint:errcheck // flag is predefined
+
+		snap, err := state.Load(cfg.StateFile)
+		if err != nil {
+			return logError("state load failed: %w", err)
+		}
+		if len(snap.Containers) == 0 {
+			fmt.Printf("No routes in %s, run generate or watch first\n", cfg.StateFile)
+			return nil
+		}
+
+		gateway := sshGatewayAddr(cfg.SSHGateway)
+		if sshConfig {
+			printSSHConfig(os.Stdout, snap, gateway)
+			return nil
+		}
+		printStatus(os.Stdout, snap, gateway)
+		return nil
+	},
+}
+
+func init() {
+	statusCmd.Flags().Bool("ssh-config", false, "Print the SSH gateway aliases as ~/.ssh/config entries")
+	rootCmd.AddCommand(statusCmd)
+}
+
+// sshGatewayAddr returns the host:port clients reach the SSH gateway at, empty when disabled
+// Without --ssh-gateway-host the hostname of this machine is used
+func sshGatewayAddr(gw config.SSHGateway) string {
+	if gw.Port == 0 {
+		return ""
+	}
+	host := gw.Host
+	if host == "" {
+		host, _ = os.Hostname() //nolint:errcheck // falls back to localhost
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(gw.Port))
+}
+
+// sshProxyCommand wraps SSH in TLS to the gateway, %h is the alias ssh was called with
+func sshProxyCommand(gateway string) string {
+	return "openssl s_client -quiet -verify_quiet -servername %h -connect " + gateway
+}
+
+// sshAliases returns the SSH gateway aliases of a snapshot with their containers, in order
+func sshAliases(snap *state.Snapshot) (aliases, containers []string) {
+	for _, ctr := range snap.Containers {
+		for _, route := range ctr.Routes {
+			name, _, _ := strings.Cut(route, " -> ")
+			if alias, ok := strings.CutPrefix(name, "ssh:"); ok {
+				aliases = append(aliases, alias)
+				containers = append(containers, ctr.Name)
+			}
+		}
+	}
+	return aliases, containers
+}
+
+// printStatus writes the routes as a table, followed by the ssh commands of the gateway aliases
+func printStatus(out io.Writer, snap *state.Snapshot, gateway string) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CONTAINER\tROUTE\tUPSTREAM") //nolint:errcheck // terminal output
+	for _, ctr := range snap.Containers {
+		for _, route := range ctr.Routes {
+			name, upstream, _ := strings.Cut(route, " -> ")
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", ctr.Name, name, upstream) //nolint:errcheck // terminal output
+		}
+	}
+	_ = w.Flush() //nolint:errcheck // terminal output
+	printReport(out, snap)
+
+	aliases, containers := sshAliases(snap)
+	if len(aliases) == 0 {
+		return
+	}
+	if gateway == "" {
+		_, _ = fmt.Fprintln(out, "\nSSH aliases are not routed, the SSH gateway is disabled (--ssh-gateway-port)") //nolint:errcheck // terminal output
+		return
+	}
+	_, _ = fmt.Fprintf(out, "\nSSH gateway %s:\n", gateway) //nolint:errcheck // terminal output
+	for i, alias := range aliases {
+		//nolint:errcheck // terminal output
+		_, _ = fmt.Fprintf(out, "  ssh -o ProxyCommand=%q %s  # %s\n", sshProxyCommand(gateway), alias, containers[i])
+	}
+}
+
+// printReport writes the summary of the generation that wrote the snapshot, if the state
+// file has one
+func printReport(out io.Writer, snap *state.Snapshot) {
+	report := snap.Report
+	if report == nil {
+		return
+	}
+	//nolint:errcheck // terminal output
+	_, _ = fmt.Fprintf(out, "\nGenerated %s: %d added, %d removed, %d changed, %d relabeled\n",
+		snap.GeneratedAt.Format(time.RFC3339), len(report.Added), len(report.Removed), len(report.Changed), len(report.Relabeled))
+	for _, skipped := range report.Skipped {
+		_, _ = fmt.Fprintf(out, "  skipped %s: %s\n", skipped.Container, skipped.Reason) //nolint:errcheck // terminal output
+	}
+	for _, denied := range report.Denied {
+		_, _ = fmt.Fprintf(out, "  denied %s %s: %s\n", denied.Container, denied.Route, denied.Reason) //nolint:errcheck // terminal output
+	}
+	for _, w := range report.Warmups {
+		result := "ok"
+		if !w.OK {
+			result = "failed"
+		}
+		//nolint:errcheck // terminal output
+		_, _ = fmt.Fprintf(out, "  warm-up %s %s %s: %s in %s\n", w.Container, w.Route, result, w.Detail, w.Duration.Round(time.Millisecond))
+	}
+}
+
+// printSSHConfig writes a ~/.ssh/config entry per gateway alias
+func printSSHConfig(out io.Writer, snap *state.Snapshot, gateway string) {
+	aliases, containers := sshAliases(snap)
+	if gateway == "" || len(aliases) == 0 {
+		_, _ = fmt.Fprintln(out, "# no SSH gateway aliases") //nolint:errcheck // terminal output
+		return
+	}
+	for i, alias := range aliases {
+		//nolint:errcheck // terminal output
+		_, _ = fmt.Fprintf(out, "# %s\nHost %s\n    ProxyCommand %s\n\n", containers[i], alias, sshProxyCommand(gateway))
+	}
+}
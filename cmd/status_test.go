@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/state"
+)
+
+func TestPrintStatus(t *testing.T) {
+	snap := &state.Snapshot{Containers: []state.Container{
+		{Name: "db", Routes: []string{"ssh:db-shell -> 172.17.0.2:22", "tcp:5432 -> 172.17.0.2:5432"}},
+		{Name: "web", Routes: []string{"http:web.example.com -> 172.17.0.3:80"}},
+	}}
+	gateway := sshGatewayAddr(config.SSHGateway{Port: 2222, Host: "gw.example.com"})
+
+	var out bytes.Buffer
+	printStatus(&out, snap, gateway)
+	for _, want := range []string{
+		"CONTAINER  ROUTE                 UPSTREAM\n",
+		"db         tcp:5432              172.17.0.2:5432\n",
+		"SSH gateway gw.example.com:2222:\n" +
+			`  ssh -o ProxyCommand="openssl s_client -quiet -verify_quiet -servername %h -connect gw.example.com:2222" db-shell  # db`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printStatus() missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	printSSHConfig(&out, snap, gateway)
+	want := "# db\nHost db-shell\n    ProxyCommand openssl s_client -quiet -verify_quiet -servername %h -connect gw.example.com:2222\n\n"
+	if out.String() != want {
+		t.Errorf("printSSHConfig() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	printStatus(&out, snap, sshGatewayAddr(config.SSHGateway{}))
+	if !strings.Contains(out.String(), "the SSH gateway is disabled") {
+		t.Errorf("printStatus() without gateway:\n%s", out.String())
+	}
+}
+
+func TestPrintStatusReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	snap := &state.Snapshot{
+		GeneratedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Containers:  []state.Container{{Name: "web", Routes: []string{"http:web.example.com -> 172.17.0.3:80"}}},
+		Report: &state.Report{
+			Added:   []string{"web"},
+			Skipped: []state.SkippedRoute{{Container: "db", Reason: "no IP address"}},
+			Denied:  []state.SkippedRoute{{Container: "web", Route: "http:evil.example.com", Reason: "hostname not allowed"}},
+			Warmups: []state.WarmupResult{{Container: "web", Route: "http:web.example.com", OK: true, Detail: "200", Duration: 12 * time.Millisecond}},
+		},
+	}
+	if err := snap.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	printStatus(&out, loaded, "")
+	for _, want := range []string{
+		"Generated 2026-01-02T03:04:05Z: 1 added, 0 removed, 0 changed, 0 relabeled\n",
+		"  skipped db: no IP address\n",
+		"  denied web http:evil.example.com: hostname not allowed\n",
+		"  warm-up web http:web.example.com ok: 200 in 12ms\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printStatus() missing %q:\n%s", want, out.String())
+		}
+	}
+}
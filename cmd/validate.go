@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/moontechs/proxy/delivery"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Verify generated config signatures and run nginx -t",
+	Long: `Checks the generated configs on disk without scanning Docker:
+
+- With a signing key (--signing-key-file or SIGNING_KEY), each config must
+  match its detached .sig file, so changes made outside the proxy are detected
+- Runs nginx -t unless --skip-nginx is set
+
+Exits with code 14 if a config was tampered with and 12 if nginx rejects it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+		log := GetLogger()
+
+		skipNginx, _ := cmd.Flags().GetBool("skip-nginx") //nolint:errcheck // flag is predefined
+
+		generator, err := newGenerator(cfg, log)
+		if err != nil {
+			return logError("generator initialization failed: %w", err)
+		}
+
+		if len(cfg.SigningKey) > 0 {
+			if err := generator.VerifySignatures(); err != nil {
+				if errors.Is(err, nginx.ErrTampered) {
+					return logError("tampered configs detected: %w", err)
+				}
+				return logError("signature verification failed: %w", err)
+			}
+			fmt.Println("✓ Config signatures valid")
+		}
+
+		if !skipNginx {
+			if err := nginx.NewValidator(log).Validate(context.Background()); err != nil {
+				return logError("%w: %w", delivery.ErrValidation, err)
+			}
+			fmt.Println("✓ nginx -t passed")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	validateCmd.Flags().Bool("skip-nginx", false, "Only verify signatures, do not run nginx -t")
+	rootCmd.AddCommand(validateCmd)
+}
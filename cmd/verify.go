@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/moontechs/proxy/state"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Probe every generated route through nginx",
+	Long: `Reads the routes of the last generation from the state file and probes
+each one end to end, beyond what nginx -t checks:
+
+- HTTP routes: a request to nginx with the route's Host header, following a
+  redirect to HTTPS once (certificates are not verified); 5xx responses fail
+- Alias redirects: nginx must answer with a redirect
+- TCP routes: a connection through nginx and one to the upstream, so a stream
+  server that accepts but cannot reach its container fails
+- UDP routes: a DNS query through nginx with --udp-dns, skipped otherwise
+- SSH gateway aliases: a TLS connection to the gateway with the alias as server
+  name, which must answer with an SSH banner
+
+Prints a PASS/FAIL/SKIP table and exits non-zero if any route fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := GetConfig()
+
+		v := verifier{}
+		v.addr, _ = cmd.Flags().GetString("nginx-addr")   //nolint:errcheck // flag is predefined
+		v.httpPort, _ = cmd.Flags().GetInt("http-port")   //nolint:errcheck // flag is predefined
+		v.httpsPort, _ = cmd.Flags().GetInt("https-port") //nolint:errcheck // flag is predefined
+		v.timeout, _ = cmd.Flags().GetDuration("timeout") //nolint:errcheck // flag is predefined
+		v.udpDNS, _ = cmd.Flags().GetBool("udp-dns")      //nolint:errcheck // flag is predefined
+		v.sshPort = cfg.SSHGateway.Port
+
+		snap, err := state.Load(cfg.StateFile)
+		if err != nil {
+			return logError("state load failed: %w", err)
+		}
+		if len(snap.Containers) == 0 {
+			fmt.Printf("No routes in %s, run generate or watch first\n", cfg.StateFile)
+			return nil
+		}
+
+		results := v.verify(context.Background(), snap)
+		failed := printResults(os.Stdout, results)
+		if failed > 0 {
+			return &ExitError{Code: 1, Err: fmt.Errorf("%d of %d routes failed verification", failed, len(results))}
+		}
+		return nil
+	},
+}
+
+func init() {
+	verifyCmd.Flags().String("nginx-addr", "127.0.0.1", "Address nginx listens on")
+	verifyCmd.Flags().Int("http-port", 80, "Port of the HTTP servers")
+	verifyCmd.Flags().Int("https-port", 443, "Port of the HTTPS servers")
+	verifyCmd.Flags().Duration("timeout", 3*time.Second, "Timeout of each probe")
+	verifyCmd.Flags().Bool("udp-dns", false, "Probe UDP routes with a DNS query instead of skipping them")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// route results
+const (
+	verifyPass = "PASS"
+	verifyFail = "FAIL"
+	verifySkip = "SKIP"
+)
+
+// verifyResult is the outcome of probing one route
+type verifyResult struct {
+	Container string
+	Route     string // e.g. tcp:5432, http:api.example.com
+	Upstream  string // host:port, unix:/path, static:/dir or redirect:<host>
+	Result    string
+	Detail    string
+}
+
+// verifier probes routes through nginx
+type verifier struct {
+	addr      string
+	httpPort  int
+	httpsPort int
+	timeout   time.Duration
+	udpDNS    bool
+	sshPort   int    // SSH gateway port, 0 skips SSH aliases
+	path      string // request path of HTTP probes, empty is /
+}
+
+// verify probes every route of a snapshot in order
+func (v verifier) verify(ctx context.Context, snap *state.Snapshot) []verifyResult {
+	var results []verifyResult
+	for _, ctr := range snap.Containers {
+		for _, route := range ctr.Routes {
+			result := v.probe(ctx, route)
+			result.Container = ctr.Name
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// probe checks one state route, "<proto>:<port or hostname> -> <upstream>"
+func (v verifier) probe(ctx context.Context, route string) verifyResult {
+	name, upstream, ok := strings.Cut(route, " -> ")
+	result := verifyResult{Route: name, Upstream: upstream}
+	proto, target, _ := strings.Cut(name, ":")
+	if !ok || target == "" {
+		return v.skip(result, "unknown route format")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	var detail string
+	var err error
+	switch proto {
+	case "tcp":
+		detail, err = v.probeTCP(ctx, target, upstream)
+	case "udp":
+		if !v.udpDNS {
+			return v.skip(result, "use --udp-dns to probe with a DNS query")
+		}
+		detail, err = v.probeDNS(ctx, target)
+	case "http":
+		detail, err = v.probeHTTP(ctx, target, upstream)
+	case "ssh":
+		if v.sshPort == 0 {
+			return v.skip(result, "the SSH gateway is disabled")
+		}
+		detail, err = v.probeSSH(ctx, target)
+	default:
+		return v.skip(result, "unknown protocol "+proto)
+	}
+
+	if err != nil {
+		result.Result, result.Detail = verifyFail, err.Error()
+		return result
+	}
+	result.Result, result.Detail = verifyPass, detail
+	return result
+}
+
+func (v verifier) skip(result verifyResult, detail string) verifyResult {
+	result.Result, result.Detail = verifySkip, detail
+	return result
+}
+
+// probeTCP connects through nginx, then to the upstream, nginx stream servers accept
+// connections before they connect upstream
+func (v verifier) probeTCP(ctx context.Context, port, upstream string) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(v.addr, port))
+	if err != nil {
+		return "", fmt.Errorf("nginx: %w", err)
+	}
+	_ = conn.Close() //nolint:errcheck // probe connection
+
+	conn, err = dialer.DialContext(ctx, "tcp", upstream)
+	if err != nil {
+		return "", fmt.Errorf("upstream: %w", err)
+	}
+	_ = conn.Close() //nolint:errcheck // probe connection
+	return "connected", nil
+}
+
+// probeSSH connects to the SSH gateway with the alias as server name and reads the SSH banner
+func (v verifier) probeSSH(ctx context.Context, alias string) (string, error) {
+	dialer := tls.Dialer{
+		// #nosec G402 -- only the route is checked, SSH host keys authenticate the server
+		Config: &tls.Config{InsecureSkipVerify: true, ServerName: alias},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(v.addr, strconv.Itoa(v.sshPort)))
+	if err != nil {
+		return "", fmt.Errorf("nginx: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck // probe connection
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline) //nolint:errcheck // the read fails instead
+	}
+
+	banner := make([]byte, 255)
+	n, err := conn.Read(banner)
+	if err != nil {
+		return "", fmt.Errorf("SSH banner: %w", err)
+	}
+	line, _, _ := strings.Cut(string(banner[:n]), "\r\n")
+	if !strings.HasPrefix(line, "SSH-") {
+		return "", fmt.Errorf("SSH banner: got %q", line)
+	}
+	return line, nil
+}
+
+// probeDNS sends a query for the root NS records through nginx, any answer passes
+func (v verifier) probeDNS(ctx context.Context, port string) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(v.addr, port))
+	if err != nil {
+		return "", fmt.Errorf("nginx: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck // probe connection
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline) //nolint:errcheck // the read fails instead
+	}
+
+	query := dnsQuery()
+	if _, err := conn.Write(query); err != nil {
+		return "", fmt.Errorf("DNS query: %w", err)
+	}
+	answer := make([]byte, 512)
+	n, err := conn.Read(answer)
+	if err != nil {
+		return "", fmt.Errorf("DNS answer: %w", err)
+	}
+	if n < 12 || answer[0] != query[0] || answer[1] != query[1] || answer[2]&0x80 == 0 {
+		return "", errors.New("DNS answer: not a response to the query")
+	}
+	return "DNS rcode " + strconv.Itoa(int(answer[3]&0x0f)), nil
+}
+
+// dnsQuery builds a recursive query for the NS records of the root zone with a random ID
+func dnsQuery() []byte {
+	query := make([]byte, 12, 17)
+	_, _ = rand.Read(query[:2])              //nolint:errcheck // never fails
+	query[2] = 0x01                          // recursion desired
+	binary.BigEndian.PutUint16(query[4:], 1) // one question
+	// root name, type NS, class IN
+	return append(query, 0x00, 0x00, 0x02, 0x00, 0x01)
+}
+
+// probeHTTP requests the hostname from nginx, following a redirect to HTTPS once
+func (v verifier) probeHTTP(ctx context.Context, hostname, upstream string) (string, error) {
+	path := v.path
+	if path == "" {
+		path = "/"
+	}
+	client := &http.Client{
+		// nginx is dialed whatever the URL host, the hostname only goes into Host and SNI
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				port := strconv.Itoa(v.httpPort)
+				if _, p, err := net.SplitHostPort(addr); err == nil && p == "443" {
+					port = strconv.Itoa(v.httpsPort)
+				}
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, net.JoinHostPort(v.addr, port))
+			},
+			// #nosec G402 -- only the route is checked, certificates are checked by clients
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: hostname},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	defer client.CloseIdleConnections()
+
+	status, location, err := httpStatus(ctx, client, "http://"+hostname+path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(upstream, "redirect:") {
+		if status < 300 || status > 399 {
+			return "", fmt.Errorf("status %d, want a redirect", status)
+		}
+		return fmt.Sprintf("%d -> %s", status, location), nil
+	}
+
+	scheme := "http"
+	if strings.HasPrefix(location, "https://"+hostname) && status >= 300 && status <= 399 {
+		scheme = "https"
+		if status, _, err = httpStatus(ctx, client, "https://"+hostname+path); err != nil {
+			return "", err
+		}
+	}
+	if status >= 500 {
+		return "", fmt.Errorf("%s status %d", scheme, status)
+	}
+	return fmt.Sprintf("%s status %d", scheme, status), nil
+}
+
+// httpStatus sends a GET and returns the status and Location of the response
+func httpStatus(ctx context.Context, client *http.Client, url string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("nginx: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // read-only
+	// drained for reuse, a big body is not worth reading and closes the connection
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint:errcheck // best effort
+	return resp.StatusCode, resp.Header.Get("Location"), nil
+}
+
+// printResults writes the results as a table and returns the number of failed routes
+func printResults(out io.Writer, results []verifyResult) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RESULT\tCONTAINER\tROUTE\tUPSTREAM\tDETAIL") //nolint:errcheck // terminal output
+	failed := 0
+	for _, r := range results {
+		if r.Result == verifyFail {
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Result, r.Container, r.Route, r.Upstream, r.Detail) //nolint:errcheck // terminal output
+	}
+	_ = w.Flush() //nolint:errcheck // terminal output
+	return failed
+}
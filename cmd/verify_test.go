@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moontechs/proxy/state"
+)
+
+// listenPort returns the port of a test listener address
+func listenPort(t *testing.T, addr net.Addr) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatalf("bad listener address %s: %v", addr, err)
+	}
+	n, _ := strconv.Atoi(port) //nolint:errcheck // from the listener
+	return n
+}
+
+func TestVerifierProbe(t *testing.T) {
+	// nginx stand-in answering by Host header
+	nginx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "web.example.com":
+			w.WriteHeader(http.StatusOK)
+		case "down.example.com":
+			w.WriteHeader(http.StatusBadGateway)
+		case "www.example.com":
+			http.Redirect(w, r, "http://example.com/", http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer nginx.Close()
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer tcp.Close()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	tcpPort := strconv.Itoa(listenPort(t, tcp.Addr()))
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	// DNS stand-in answering every query with its ID and the response bit
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer udp.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			answer := append([]byte{}, buf[:n]...)
+			answer[2] |= 0x80
+			_, _ = udp.WriteTo(answer, addr)
+		}
+	}()
+	udpPort := strconv.Itoa(listenPort(t, udp.LocalAddr()))
+
+	// SSH gateway stand-in sending a banner for one alias only
+	gatewayCert := httptest.NewTLSServer(nil)
+	gatewayCert.Close()
+	gateway, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: gatewayCert.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer gateway.Close()
+	go func() {
+		for {
+			conn, err := gateway.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil && tlsConn.ConnectionState().ServerName == "db-shell" {
+				_, _ = tlsConn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			}
+			_ = tlsConn.Close()
+		}
+	}()
+
+	v := verifier{addr: "127.0.0.1", httpPort: listenPort(t, nginx.Listener.Addr()), timeout: time.Second, udpDNS: true,
+		sshPort: listenPort(t, gateway.Addr())}
+	tests := []struct {
+		route      string
+		want       string
+		wantDetail string
+	}{
+		{route: "http:web.example.com -> 172.17.0.2:80", want: verifyPass, wantDetail: "http status 200"},
+		{route: "http:down.example.com -> 172.17.0.3:80", want: verifyFail, wantDetail: "http status 502"},
+		{route: "http:www.example.com -> redirect:example.com", want: verifyPass, wantDetail: "301 -> http://example.com/"},
+		{route: "http:web.example.com -> redirect:example.com", want: verifyFail, wantDetail: "want a redirect"},
+		{route: "tcp:" + tcpPort + " -> " + tcp.Addr().String(), want: verifyPass, wantDetail: "connected"},
+		{route: "tcp:" + tcpPort + " -> " + closedAddr, want: verifyFail, wantDetail: "upstream:"},
+		{route: "udp:" + udpPort + " -> 172.17.0.4:53", want: verifyPass, wantDetail: "DNS rcode 0"},
+		{route: "ssh:db-shell -> 172.17.0.5:22", want: verifyPass, wantDetail: "SSH-2.0-OpenSSH_9.6"},
+		{route: "ssh:git -> 172.17.0.6:22", want: verifyFail, wantDetail: "SSH banner"},
+		{route: "unknown", want: verifySkip, wantDetail: "unknown route format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			got := v.probe(context.Background(), tt.route)
+			if got.Result != tt.want || !strings.Contains(got.Detail, tt.wantDetail) {
+				t.Errorf("probe() = %s %q, want %s %q", got.Result, got.Detail, tt.want, tt.wantDetail)
+			}
+		})
+	}
+
+	v.udpDNS = false
+	if got := v.probe(context.Background(), "udp:"+udpPort+" -> 172.17.0.4:53"); got.Result != verifySkip {
+		t.Errorf("UDP probe without --udp-dns = %s, want %s", got.Result, verifySkip)
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	v := verifier{addr: "127.0.0.1", httpPort: 1, timeout: 100 * time.Millisecond}
+	snap := &state.Snapshot{Containers: []state.Container{
+		{Name: "dns", Routes: []string{"udp:53 -> 172.17.0.4:53"}},
+		{Name: "web", Routes: []string{"http:web.example.com -> 172.17.0.2:80"}},
+	}}
+
+	var out bytes.Buffer
+	if failed := printResults(&out, v.verify(context.Background(), snap)); failed != 1 {
+		t.Errorf("printResults() failed = %d, want 1", failed)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "RESULT") ||
+		!strings.HasPrefix(lines[1], "SKIP    dns") || !strings.HasPrefix(lines[2], "FAIL    web") {
+		t.Errorf("printResults() output:\n%s", out.String())
+	}
+}
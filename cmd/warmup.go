@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/state"
+)
+
+// warmupWorkers bounds the warm-up requests in flight, a big change set must not flood nginx
+const warmupWorkers = 8
+
+// warmer requests the HTTP routes of added and changed containers through nginx after a reload,
+// so apps that boot or compile lazily do it before the first client arrives
+type warmer struct {
+	probe verifier // HTTP probe of verify, with the warm-up path and timeout
+	log   *lgr.Logger
+}
+
+// newWarmer returns the warmer of the settings, nil when no warm-up path is set
+func newWarmer(cfg config.Warmup, log *lgr.Logger) (*warmer, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return nil, fmt.Errorf("invalid warmup-path %q, expected an absolute path like /", cfg.Path)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid warmup-timeout %s, expected a positive duration", cfg.Timeout)
+	}
+	for _, port := range []int{cfg.HTTPPort, cfg.HTTPSPort} {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid warm-up port %d, expected 1-65535", port)
+		}
+	}
+	return &warmer{
+		probe: verifier{addr: cfg.Addr, httpPort: cfg.HTTPPort, httpsPort: cfg.HTTPSPort, timeout: cfg.Timeout, path: cfg.Path},
+		log:   log,
+	}, nil
+}
+
+// warm sends one request to each HTTP route of the changes, warmupWorkers at a time, and returns
+// the results in order
+// Redirects and static sites have no backend to warm up and are left out
+func (w *warmer) warm(ctx context.Context, changes state.Changes) []nginx.WarmupResult {
+	var results []nginx.WarmupResult
+	var routes []string
+	for _, ctr := range append(append([]state.Container{}, changes.Added...), changes.Changed...) {
+		for _, route := range ctr.Routes {
+			name, upstream, _ := strings.Cut(route, " -> ")
+			if !strings.HasPrefix(name, "http:") || strings.HasPrefix(upstream, "redirect:") || strings.HasPrefix(upstream, "static:") {
+				continue
+			}
+			results = append(results, nginx.WarmupResult{Container: ctr.Name, Route: name})
+			routes = append(routes, route)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(warmupWorkers, len(results)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				started := time.Now()
+				probe := w.probe.probe(ctx, routes[i])
+				results[i].Duration = time.Since(started)
+				results[i].OK, results[i].Detail = probe.Result == verifyPass, probe.Detail
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range results {
+		if result.OK {
+			w.log.Logf("INFO [Warmup] container=%s route=%s detail=%q duration=%s",
+				result.Container, result.Route, result.Detail, result.Duration.Round(time.Millisecond))
+			continue
+		}
+		w.log.Logf("WARN [Warmup] request failed container=%s route=%s error=%q duration=%s",
+			result.Container, result.Route, result.Detail, result.Duration.Round(time.Millisecond))
+	}
+	return results
+}
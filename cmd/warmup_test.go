@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/nginx"
+	"github.com/moontechs/proxy/state"
+)
+
+func TestWarmerWarm(t *testing.T) {
+	// nginx stand-in answering by Host header, only on the warm-up path
+	var requests atomic.Int32
+	nginxSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case r.URL.Path != "/warm":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Host == "down.example.com":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer nginxSrv.Close()
+
+	w := &warmer{
+		probe: verifier{addr: "127.0.0.1", httpPort: listenPort(t, nginxSrv.Listener.Addr()), timeout: time.Second, path: "/warm"},
+		log:   lgr.New(),
+	}
+	changes := state.Changes{
+		Added: []state.Container{
+			{Name: "app", Routes: []string{
+				"http:app.example.com -> 172.17.0.2:8080",
+				"http:www.app.example.com -> redirect:app.example.com",
+				"tcp:5432 -> 172.17.0.2:5432",
+			}},
+			{Name: "docs", Routes: []string{"http:docs.example.com -> static:/srv/docs"}},
+		},
+		Changed: []state.Container{{Name: "api", Routes: []string{"http:down.example.com -> 172.17.0.3:8080"}}},
+		Removed: []state.Container{{Name: "gone", Routes: []string{"http:gone.example.com -> 172.17.0.4:8080"}}},
+	}
+
+	results := w.warm(context.Background(), changes)
+	if len(results) != 2 || requests.Load() != 2 {
+		t.Fatalf("warm() = %+v, requests %d, want the backend routes of added and changed containers", results, requests.Load())
+	}
+	if r := results[0]; r.Container != "app" || r.Route != "http:app.example.com" || !r.OK || r.Detail != "http status 200" {
+		t.Errorf("results[0] = %+v, want app warmed up", r)
+	}
+	if r := results[1]; r.Container != "api" || r.OK || r.Detail != "http status 502" {
+		t.Errorf("results[1] = %+v, want the 502 of api", r)
+	}
+
+	details := nginx.Report{Warmups: results}.Details()
+	if details["warmed_up"] != "1" || details["warmup_failed"] != "1" {
+		t.Errorf("Details() = %v, want one warmed up and one failed", details)
+	}
+}
+
+func TestNewWarmer(t *testing.T) {
+	if w, err := newWarmer(config.Warmup{}, lgr.New()); w != nil || err != nil {
+		t.Errorf("newWarmer() without path = %v, %v, want disabled", w, err)
+	}
+	w, err := newWarmer(config.Warmup{Path: "/", Addr: "127.0.0.1", Timeout: 30 * time.Second, HTTPPort: 8080, HTTPSPort: 8443}, lgr.New())
+	if err != nil {
+		t.Fatalf("newWarmer() error = %v", err)
+	}
+	if w.probe.httpPort != 8080 || w.probe.httpsPort != 8443 {
+		t.Errorf("newWarmer() ports = %d, %d, want the configured 8080 and 8443", w.probe.httpPort, w.probe.httpsPort)
+	}
+	for _, cfg := range []config.Warmup{
+		{Path: "healthz", Timeout: time.Second, HTTPPort: 80, HTTPSPort: 443},
+		{Path: "/", Timeout: 0, HTTPPort: 80, HTTPSPort: 443},
+		{Path: "/", Timeout: time.Second, HTTPPort: 0, HTTPSPort: 443},
+	} {
+		if _, err := newWarmer(cfg, lgr.New()); err == nil {
+			t.Errorf("newWarmer(%+v) should fail", cfg)
+		}
+	}
+}
+
+func TestPipelineWarmupAfterUnlock(t *testing.T) {
+	var pipe *pipeline
+	var unlocked atomic.Bool
+	nginxSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pipe.mu.TryLock() {
+			pipe.mu.Unlock()
+			unlocked.Store(true)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer nginxSrv.Close()
+
+	pipe, events := newTestPipeline(t, &fakeScanner{result: webScan()}, &fakeNginx{})
+	pipe.warmup = &warmer{
+		probe: verifier{addr: "127.0.0.1", httpPort: listenPort(t, nginxSrv.Listener.Addr()), timeout: time.Second, path: "/"},
+		log:   lgr.New(),
+	}
+	if err := pipe.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !unlocked.Load() {
+		t.Error("warm-up ran while the pipeline lock was held")
+	}
+	if report := pipe.lastReport(); len(report.Warmups) != 1 || !report.Warmups[0].OK {
+		t.Errorf("report warm-ups = %+v, want one successful", report.Warmups)
+	}
+	if got := events.types(); got[len(got)-1] != eventConfigWarmedUp {
+		t.Errorf("events = %v, want %s last", got, eventConfigWarmedUp)
+	}
+	snap, err := state.Load(pipe.statePath)
+	if err != nil || snap.Report == nil || len(snap.Report.Warmups) != 1 {
+		t.Errorf("persisted report = %+v, %v, want the warm-up result", snap.Report, err)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-pkgz/lgr"
-	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/metrics"
 	"github.com/moontechs/proxy/nginx"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +19,18 @@ import (
 var watchCmd = &cobra.Command{
 	Use:   "watch",
 	Short: "Watch Docker events and regenerate configs on container changes",
-	Long: `Watches Docker container events (start/stop/die) and automatically
+	Long: `Watches Docker container events (start/stop/die/health) and automatically
 regenerates Nginx configurations when containers change.
 
 Features:
-- 2-second debouncing to batch rapid changes
+- Debouncing (default 2s, --debounce) to batch rapid changes
+- Config file and template reload on SIGHUP or file change
 - Automatic Nginx validation before reload
 - Graceful shutdown on SIGINT/SIGTERM
-- Keeps old config if new one fails validation`,
+- --on-shutdown keep|empty|restore controls what is left behind on exit
+- Keeps old config if new one fails validation
+- --read-only renders configs in memory and reports drift from the files on disk
+  without writing files or reloading nginx`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := GetConfig()
 		log := GetLogger()
@@ -32,10 +38,25 @@ Features:
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		log.Logf("INFO [Watch] starting watch mode")
+		readOnly, err := boolSetting(cmd, "read-only", "READ_ONLY")
+		if err != nil {
+			return logError("%w", err)
+		}
+		onShutdown := stringSetting(cmd, "on-shutdown", "ON_SHUTDOWN")
+		if onShutdown != shutdownKeep && onShutdown != shutdownEmpty && onShutdown != shutdownRestore {
+			return logError("invalid on-shutdown %q, expected keep, empty or restore", onShutdown)
+		}
+		if readOnly && onShutdown != shutdownKeep {
+			return logError("read-only mode never writes configs, on-shutdown must be keep")
+		}
+		if readOnly && cfg.Vault.Addr != "" {
+			return logError("read-only mode never writes files, vault secrets are written to vault-secrets-dir")
+		}
+
+		log.Logf("INFO [Watch] starting watch mode read_only=%t", readOnly)
 
 		// Setup components
-		dockerClient, err := docker.NewClient(cfg.DockerHost, log)
+		dockerClient, err := newDockerClient(cfg, log)
 		if err != nil {
 			return logError("docker connection failed: %w", err)
 		}
@@ -45,115 +66,432 @@ Features:
 			}
 		}()
 
-		// Ensure proxy network exists
-		if err := dockerClient.EnsureNetwork(ctx, cfg.NetworkName); err != nil {
+		if err := dockerClient.CheckAPIVersion(dockerFeatures(cfg, true)...); err != nil {
+			return logError("docker API check failed: %w", err)
+		}
+
+		if err := checkDockerPermissions(ctx, dockerClient, log); err != nil {
+			return logError("docker permission check failed: %w", err)
+		}
+
+		// Ensure proxy network exists, read-only mode leaves docker untouched too
+		if readOnly {
+			log.Logf("INFO [Watch] read-only, skipping network setup network=%s", cfg.NetworkName)
+		} else if err := ensureNetwork(ctx, dockerClient, cfg.NetworkName, log); err != nil {
 			return logError("network setup failed: %w", err)
 		}
 
-		generator, err := nginx.NewGenerator(cfg.StreamConfigPath, cfg.HTTPConfigPath, log)
+		generator, err := newGenerator(cfg, log)
 		if err != nil {
 			return logError("generator initialization failed: %w", err)
 		}
+		generator.SetReadOnly(readOnly)
 
 		validator := nginx.NewValidator(log)
 
+		responder, stopACME, err := startACMEResponder(cfg, log)
+		if err != nil {
+			return logError("ACME responder start failed: %w", err)
+		}
+		defer stopACME()
+
+		events, broker := newEvents(cfg, log)
+		defer events.Flush(context.Background())
+		registry := metrics.NewRegistry()
+		observeDockerAPI(dockerClient, cfg, registry)
+
+		stopMetrics, err := startMetrics(ctx, cfg, registry, events, log)
+		if err != nil {
+			return logError("metrics server start failed: %w", err)
+		}
+		defer stopMetrics()
+
 		reloader, err := nginx.NewReloader(cfg.NginxReloadCmd, log)
 		if err != nil {
 			return logError("reloader initialization failed: %w", err)
 		}
 
-		// Initial generation
+		// capture pre-start configs before the first generation overwrites them
+		var snapshot *nginx.Snapshot
+		if onShutdown == shutdownRestore {
+			if snapshot, err = generator.TakeSnapshot(); err != nil {
+				return logError("config snapshot failed: %w", err)
+			}
+		}
+
+		target, err := newTarget(cfg, dockerClient, validator, reloader, log)
+		if err != nil {
+			return logError("delivery target setup failed: %w", err)
+		}
+
+		pipe, err := newPipeline(dockerClient, generator, validator, target, cfg.StateFile, log)
+		if err != nil {
+			return logError("state initialization failed: %w", err)
+		}
+		pipe.events = events
+		pipe.failureBudget = cfg.FailureBudget
+		budgetErr := exitOnExhausted(cfg, pipe, cancel)
+		pipe.setMetrics(registry)
+		if pipe.warmup, err = newWarmer(cfg.Warmup, log); err != nil {
+			return logError("warm-up setup failed: %w", err)
+		}
+		if pipe.hooks, err = newHooks(cfg.Hooks, log); err != nil {
+			return logError("hook setup failed: %w", err)
+		}
+		pipe.readOnly = readOnly
+
+		// certificates and ticket keys are files too, read-only mode renders with the existing ones
+		if readOnly {
+			log.Logf("INFO [Watch] read-only, skipping certificate issuance and ticket key rotation")
+		} else {
+			stopIssuer, err := startACMEIssuer(ctx, cfg, responder, pipe, log)
+			if err != nil {
+				return logError("ACME issuer start failed: %w", err)
+			}
+			defer stopIssuer()
+
+			stopTickets, err := startTicketRotation(ctx, cfg, pipe, log)
+			if err != nil {
+				return logError("ticket key rotation start failed: %w", err)
+			}
+			defer stopTickets()
+		}
+
+		// Initial generation, also drops routes of containers that died while the watcher was down
+		// In read-only mode conflicts are reported and watching continues
 		log.Logf("INFO [Watch] performing initial config generation")
-		if err := generateAndReload(ctx, dockerClient, generator, validator, reloader, log); err != nil {
-			return logError("initial generation failed: %w", err)
+		if err := pipe.run(ctx); err != nil {
+			if !readOnly {
+				return logError("initial generation failed: %w", err)
+			}
+			log.Logf("ERROR [Watch] read-only, initial generation failed error=%q", err)
 		}
 
-		// Watch events
-		eventCh, errCh := dockerClient.WatchEvents(ctx)
+		stopAdmin, err := startAdmin(cfg, pipe, broker, log)
+		if err != nil {
+			return logError("admin API start failed: %w", err)
+		}
+		defer stopAdmin()
 
 		// Setup signal handling
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			select {
+			case sig := <-sigCh:
+				log.Logf("INFO [Watch] shutdown signal=%s", sig)
+				fmt.Println("\n✓ Shutting down gracefully...")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
 
 		log.Logf("INFO [Watch] ready and watching for container events")
 		fmt.Println("✓ Watching Docker events (Ctrl+C to stop)")
 
-		// Event loop with debouncing
-		var pendingReload bool
-		debounceTimer := time.NewTimer(0)
-		<-debounceTimer.C // Drain initial timer
+		w := newWatcher(dockerClient, cfg, log, pipe.run)
+		w.reloadConfig = reloadGeneratorConfig(cmd, generator, log)
+		w.nextChange = pipe.nextChange
+		w.watchConfigChanges(ctx, cfg.ConfigFile)
+
+		loopErr := w.run(ctx)
+		teardown(onShutdown, snapshot, generator, validator, reloader, log)
+		if err := budgetErr(); err != nil {
+			return err
+		}
+		return loopErr
+	},
+}
+
+// shutdown behaviors for watch mode
+const (
+	shutdownKeep    = "keep"    // leave generated configs in place
+	shutdownEmpty   = "empty"   // write empty configs and reload
+	shutdownRestore = "restore" // restore configs captured before start and reload
+)
 
+// exitOnExhausted makes the pipeline stop the command via cancel once its failure budget is exhausted,
+// if --failure-exit is set; the returned function gives the exit error after shutdown, nil otherwise
+func exitOnExhausted(cfg *config.Config, pipe *pipeline, cancel context.CancelFunc) func() error {
+	var exhausted atomic.Pointer[ExitError]
+	if cfg.FailureExit {
+		pipe.onExhausted = func(err error) {
+			exhausted.CompareAndSwap(nil, &ExitError{Code: exitFailureBudget, Err: fmt.Errorf("failure budget exhausted: %w", err)})
+			cancel()
+		}
+	}
+	return func() error {
+		if err := exhausted.Load(); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// teardownTimeout bounds the nginx commands of the teardown, the watch context is done by then
+const teardownTimeout = 30 * time.Second
+
+// teardown applies the on-shutdown behavior once the watch loop has stopped
+// Failures are logged only, shutdown continues regardless
+func teardown(mode string, snapshot *nginx.Snapshot, gen *nginx.Generator, val Validator,
+	reload Reloader, log *lgr.Logger) {
+	var changed bool
+	var err error
+
+	switch mode {
+	case shutdownEmpty:
+		log.Logf("INFO [Watch] on-shutdown=empty, writing empty configs")
+		var report nginx.Report
+		report, err = gen.Generate(nil)
+		changed = report.Changed()
+	case shutdownRestore:
+		log.Logf("INFO [Watch] on-shutdown=restore, restoring pre-start configs")
+		changed, err = gen.RestoreSnapshot(snapshot)
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Logf("ERROR [Watch] shutdown teardown failed error=%q", err)
+		return
+	}
+	if !changed {
+		log.Logf("INFO [Watch] shutdown teardown left configs unchanged")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), teardownTimeout)
+	defer cancel()
+	if err := val.Validate(ctx); err != nil {
+		log.Logf("ERROR [Watch] shutdown teardown validation failed error=%q", err)
+		return
+	}
+	if err := reload.Reload(ctx); err != nil {
+		log.Logf("ERROR [Watch] shutdown teardown reload failed error=%q", err)
+		return
+	}
+
+	log.Logf("INFO [Watch] shutdown teardown applied mode=%s", mode)
+}
+
+// watcher runs the debounced Docker event loop shared by watch, run and serve
+type watcher struct {
+	scanner    DockerScanner
+	log        *lgr.Logger
+	debounce   time.Duration
+	refresh    time.Duration // periodic regeneration to pick up rotated secrets, 0 disables
+	regenerate func(context.Context) error
+
+	// nextChange returns when the routes change next, as a route expires or a schedule
+	// window opens or closes, regenerated then; nil disables it
+	nextChange func() time.Time
+
+	// reloadConfig re-reads and applies the proxy configuration, nil disables reloads
+	reloadConfig func() (*config.Config, error)
+	reloadCh     chan struct{}
+}
+
+// newWatcher creates a watcher with the configured debounce delay
+func newWatcher(scanner DockerScanner, cfg *config.Config, log *lgr.Logger,
+	regenerate func(context.Context) error) *watcher {
+	w := &watcher{
+		scanner:    scanner,
+		log:        log,
+		debounce:   cfg.Debounce,
+		regenerate: regenerate,
+		reloadCh:   make(chan struct{}, 1),
+	}
+	if cfg.Vault.Addr != "" {
+		w.refresh = cfg.Vault.Refresh
+	}
+	return w
+}
+
+// watchConfigChanges requests a config reload on SIGHUP and when the config file changes
+func (w *watcher) watchConfigChanges(ctx context.Context, path string) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hupCh)
 		for {
 			select {
-			case event := <-eventCh:
-				log.Logf("INFO [Watch] event received type=%s container=%s", event.Type, event.Name)
+			case <-hupCh:
+				w.log.Logf("INFO [Watch] SIGHUP received, reloading configuration")
+				w.requestConfigReload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-				// Mark for reload and start/reset debounce timer
-				pendingReload = true
-				debounceTimer.Reset(2 * time.Second)
+	if path == "" {
+		return
+	}
 
-			case <-debounceTimer.C:
-				if pendingReload {
-					log.Logf("INFO [Watch] triggering config regeneration")
+	go func() {
+		lastMod := fileModTime(path)
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if mod := fileModTime(path); !mod.Equal(lastMod) {
+					lastMod = mod
+					w.log.Logf("INFO [Watch] config file changed path=%s, reloading configuration", path)
+					w.requestConfigReload()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// requestConfigReload schedules a config reload without blocking
+func (w *watcher) requestConfigReload() {
+	select {
+	case w.reloadCh <- struct{}{}:
+	default:
+	}
+}
 
-					if err := generateAndReload(ctx, dockerClient, generator, validator, reloader, log); err != nil {
-						log.Logf("ERROR [Watch] regeneration failed error=%q", err)
-						// Don't exit, continue watching
-					}
+// run consumes Docker events and calls regenerate with debouncing
+// Returns nil when ctx is cancelled, or an error if the event stream fails
+func (w *watcher) run(ctx context.Context) error {
+	eventCh, errCh := w.scanner.WatchEvents(ctx)
 
-					pendingReload = false
+	// Event loop with debouncing
+	var pendingReload bool
+	debounceTimer := time.NewTimer(0)
+	<-debounceTimer.C // Drain initial timer
+
+	// secrets are re-read on regeneration, rotated ones change the config and reload nginx
+	var refreshCh <-chan time.Time
+	if w.refresh > 0 {
+		refreshTicker := time.NewTicker(w.refresh)
+		defer refreshTicker.Stop()
+		refreshCh = refreshTicker.C
+	}
+
+	// expired routes and schedule windows are applied by a regeneration
+	changeCh := w.changeAfter()
+
+	for {
+		select {
+		case event, ok := <-eventCh:
+			if !ok {
+				// stream closed, wait for the error or cancellation
+				eventCh = nil
+				continue
+			}
+			w.log.Logf("INFO [Watch] event received type=%s container=%s", event.Type, event.Name)
+
+			// Mark for reload and start/reset debounce timer
+			pendingReload = true
+			debounceTimer.Reset(w.debounce)
+
+		case <-w.reloadCh:
+			if w.reloadConfig == nil {
+				continue
+			}
+			newCfg, err := w.reloadConfig()
+			if err != nil {
+				w.log.Logf("ERROR [Watch] config reload failed, keeping previous settings error=%q", err)
+				continue
+			}
+			w.debounce = newCfg.Debounce
+			w.log.Logf("INFO [Watch] configuration reloaded debounce=%s", w.debounce)
+
+			// apply new settings with the next generation
+			pendingReload = true
+			debounceTimer.Reset(w.debounce)
+
+		case <-refreshCh:
+			w.log.Logf("DEBUG [Watch] periodic secrets refresh")
+			pendingReload = true
+			debounceTimer.Reset(w.debounce)
+
+		case <-changeCh:
+			w.log.Logf("INFO [Watch] route expiry or schedule window reached, regenerating")
+			changeCh = nil
+			pendingReload = true
+			debounceTimer.Reset(w.debounce)
+
+		case <-debounceTimer.C:
+			if pendingReload {
+				w.log.Logf("INFO [Watch] triggering config regeneration")
+
+				if err := w.regenerate(ctx); err != nil {
+					w.log.Logf("ERROR [Watch] regeneration failed error=%q", err)
+					// Don't exit, continue watching
 				}
 
-			case err := <-errCh:
-				log.Logf("ERROR [Watch] event stream error=%q", err)
-				return logError("event stream error: %w", err)
+				pendingReload = false
+				changeCh = w.changeAfter()
+			}
 
-			case sig := <-sigCh:
-				log.Logf("INFO [Watch] shutdown signal=%s", sig)
-				fmt.Println("\n✓ Shutting down gracefully...")
-				cancel()
+		case err := <-errCh:
+			if ctx.Err() != nil {
 				return nil
 			}
+			w.log.Logf("ERROR [Watch] event stream error=%q", err)
+			return logError("event stream error: %w", err)
+
+		case <-ctx.Done():
+			return nil
 		}
-	},
+	}
 }
 
-// generateAndReload performs the full workflow: scan → generate → validate → reload
-func generateAndReload(ctx context.Context, dockerClient *docker.Client, gen *nginx.Generator,
-	val *nginx.Validator, reload *nginx.Reloader, log *lgr.Logger) error {
-	// scan containers
-	containers, err := dockerClient.ScanContainers(ctx)
-	if err != nil {
-		return fmt.Errorf("scan failed: %w", err)
+// changeAfter returns a channel receiving when the routes change next, nil if they never do
+func (w *watcher) changeAfter() <-chan time.Time {
+	if w.nextChange == nil {
+		return nil
 	}
+	next := w.nextChange()
+	if next.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(next))
+}
 
-	log.Logf("INFO [Watch] scanned containers=%d", len(containers))
+// reloadGeneratorConfig returns a config reload function that re-applies generator settings
+// Settings that are bound at startup (docker host, output paths, commands) need a restart
+func reloadGeneratorConfig(cmd *cobra.Command, generator *nginx.Generator, log *lgr.Logger) func() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		newCfg, err := loadConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
 
-	// generate configs
-	changed, err := gen.Generate(containers)
-	if err != nil {
-		return fmt.Errorf("generation failed: %w", err)
-	}
+		if generator != nil {
+			if err := configureGenerator(generator, newCfg, log); err != nil {
+				return nil, err
+			}
+		}
 
-	if !changed {
-		log.Logf("INFO [Watch] configs unchanged, skipping reload")
-		return nil
-	}
+		if newCfg.DockerHost != cfg.DockerHost || newCfg.StreamConfigPath != cfg.StreamConfigPath ||
+			newCfg.HTTPConfigPath != cfg.HTTPConfigPath || newCfg.NginxReloadCmd != cfg.NginxReloadCmd {
+			log.Logf("WARN [Watch] docker host, config paths and reload command changes require a restart")
+		}
 
-	// validate
-	if err := val.Validate(); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		cfg = newCfg
+		return newCfg, nil
 	}
+}
 
-	// reload Nginx
-	if err := reload.Reload(); err != nil {
-		return fmt.Errorf("reload failed: %w", err)
+// fileModTime returns the modification time of path, zero if it cannot be read
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
 	}
-
-	log.Logf("INFO [Watch] configs reloaded successfully")
-	return nil
+	return info.ModTime()
 }
 
 func init() {
+	watchCmd.Flags().String("on-shutdown", shutdownKeep, "What to do with generated configs on exit: keep, empty or restore")
+	watchCmd.Flags().Bool("read-only", false, "Audit mode: render configs in memory and report drift, never write files or reload nginx")
 	rootCmd.AddCommand(watchCmd)
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/config"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestWatcherDebouncesEvents(t *testing.T) {
+	scanner := &fakeScanner{events: make(chan docker.ContainerEvent, 10), errs: make(chan error, 1)}
+	var runs atomic.Int32
+	regenerated := make(chan struct{}, 10)
+	w := newWatcher(scanner, &config.Config{Debounce: 20 * time.Millisecond}, lgr.New(), func(context.Context) error {
+		runs.Add(1)
+		regenerated <- struct{}{}
+		return errors.New("conflict") // failed regenerations keep the watcher running
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.run(ctx) }()
+
+	for _, name := range []string{"web", "api", "db"} {
+		scanner.events <- docker.ContainerEvent{Type: docker.EventStart, Name: name}
+	}
+	select {
+	case <-regenerated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no regeneration after events")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := runs.Load(); got != 1 {
+		t.Errorf("regenerations = %d, want the burst of events debounced into one", got)
+	}
+
+	scanner.events <- docker.ContainerEvent{Type: docker.EventStop, Name: "web"}
+	select {
+	case <-regenerated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher stopped after a failed regeneration")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run() after cancel = %v, want nil", err)
+	}
+}
+
+func TestWatcherStreamError(t *testing.T) {
+	scanner := &fakeScanner{events: make(chan docker.ContainerEvent), errs: make(chan error, 1)}
+	w := newWatcher(scanner, &config.Config{Debounce: time.Millisecond}, lgr.New(), func(context.Context) error {
+		return nil
+	})
+
+	scanner.errs <- errors.New("daemon restarted")
+	if err := w.run(context.Background()); err == nil {
+		t.Error("run() should fail when the event stream fails")
+	}
+}
+
+func TestWatcherRegeneratesOnRouteChange(t *testing.T) {
+	scanner := &fakeScanner{events: make(chan docker.ContainerEvent), errs: make(chan error, 1)}
+	regenerated := make(chan struct{}, 10)
+	w := newWatcher(scanner, &config.Config{Debounce: time.Millisecond}, lgr.New(), func(context.Context) error {
+		regenerated <- struct{}{}
+		return nil
+	})
+	var changes atomic.Int32
+	w.nextChange = func() time.Time {
+		if changes.Add(1) > 1 {
+			return time.Time{} // nothing left to change after the regeneration
+		}
+		return time.Now().Add(20 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.run(ctx) }()
+
+	select {
+	case <-regenerated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no regeneration when the route expired")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := len(regenerated); got != 0 {
+		t.Errorf("extra regenerations = %d, want none without further changes", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run() after cancel = %v, want nil", err)
+	}
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/moontechs/proxy/notify"
 )
 
 const (
@@ -10,35 +16,450 @@ const (
 	DefaultNetworkName = "proxy-network"
 )
 
+// DefaultDockerHost returns the Docker daemon address for the current platform
+func DefaultDockerHost() string {
+	if runtime.GOOS == "windows" {
+		return "npipe:////./pipe/docker_engine"
+	}
+	return "unix:///var/run/docker.sock"
+}
+
 // Config holds all proxy configuration
 type Config struct {
+	ConfigFile string // optional YAML config file, reloaded in watch mode
+
+	// watch mode
+	Debounce      time.Duration // delay after the last event before regenerating (default: 2s)
+	FailureBudget int           // consecutive failed runs before escalating, see --failure-budget (0 disables)
+	FailureExit   bool          // exit with code 3 once the failure budget is exhausted
+
 	// docker
-	DockerHost  string
-	NetworkName string // docker network name for proxy communication (default: proxy-network)
+	DockerHost       string
+	DockerAPIVersion string // pinned Docker API version, e.g. 1.41 (default: negotiated)
+	DockerAPIRate    int    // Docker API calls per second before throttling (default: 50, 0 disables)
+	DockerAPIBurst   int    // Docker API calls sent at once before throttling (default: 100)
+	DockerAPIBudget  int    // Docker API calls per minute, 0 is unlimited
+	AddressFamily    string // container addresses of upstreams: ipv4, ipv6, prefer-ipv4 (default) or prefer-ipv6
+	HostAddress      string // address of host network containers: an IP address, host-gateway (default) or off
+	NetworkName      string // docker network name for proxy communication (default: proxy-network)
 
 	// nginx configuration paths
 	StreamConfigPath string // path to stream module config (default: /etc/nginx/conf.d/proxy.conf)
 	HTTPConfigPath   string // path to HTTP module config (default: /etc/nginx/conf.d/http-proxy.conf)
 	NginxReloadCmd   string // nginx reload command (default: nginx -s reload)
+	NginxCmd         string // nginx foreground start command for run mode (default: nginx -g 'daemon off;')
+	NginxBinary      string // command running the nginx binary for -V and -T, e.g. docker exec edge nginx (default: nginx)
+	StreamTemplate   string // custom stream template file (default: built-in)
+	HTTPTemplate     string // custom HTTP template file (default: built-in)
+	ExtraConfigDir   string // hand-written configs checked for conflicts, never written (empty disables)
+	CheckNginxConfig bool   // check labels against hand-written servers in nginx -T output
+	StateFile        string // applied routes from the last run (default: /etc/nginx/conf.d/proxy-state.json)
+	SecretsDir       string // files referenced by *.secret labels (default: /run/secrets)
+	ConfigFileMode   string // octal mode of the generated configs (default: 0644)
+	ConfigOwner      string // user[:group] of the generated configs (empty keeps the proxy's user)
+	Fsync            bool   // flush written configs to disk before reloading
+	SecretsFileMode  string // octal mode of the secrets include of upstream credentials (default: 0600)
+	SecretsOwner     string // user[:group] of the secrets include (empty keeps the proxy's user)
+	Vault            Vault  // Vault for vault:<path>#<field> secret labels (disabled when Addr is empty)
+	SigningKey       []byte // HMAC key for config signatures (disabled when empty)
+	HTTP2            bool   // http2 on HTTPS listeners, overridable per host
+	HTTP3            bool   // QUIC listeners and Alt-Svc on HTTPS hosts, overridable per host
+	GeoIPDB          string // GeoIP2 country database for proxy.http.geo.* labels (empty disables)
+	RequestID        bool   // X-Request-ID propagation and logging, overridable per host
+	WAFRules         string // ModSecurity rules file for proxy.http.waf hosts (empty skips them)
+	BotPresets       string // comma-separated built-in bot blocklists (default: scanners)
+	BotPatternsFile  string // extra user-agent regexes, one per line
+	SyslogServer     string // syslog host[:port] or unix:/path for nginx logs (empty disables)
+	SyslogFacility   string // syslog facility (default: nginx's local7)
+	AccessLogJSON    string // JSON access log written by nginx and tailed for metrics (empty disables)
+	AccessLogSample  string // share of successful requests logged, e.g. 1% (empty logs every request)
+	HeaderBufferSize string // client_header_buffer_size of all servers (empty keeps the nginx default)
+	HeaderBuffers    string // large_client_header_buffers of all servers, e.g. "8 32k" (empty keeps the nginx default)
+	UpstreamZone     string // zone size of every upstream block (default: 64k, off disables)
+	MaxRoutes        int    // routes of a generation before it fails (default: 10000, 0 disables)
+	MaxServers       int    // servers of one upstream block before a generation fails (default: 256, 0 disables)
+	MaxConfigSize    string // size of one rendered config before a generation fails (default: 64m, off disables)
+	ForwardedHeaders string // X-Forwarded-* to backends: append (default), overwrite or strip
+	TrustedProxies   string // comma-separated CIDRs of proxies in front of nginx (empty trusts none)
+	Resolver         string // DNS servers nginx resolves names with at runtime (empty uses nginx.conf)
+	InternalCIDRs    string // client CIDRs of proxy.http.internal_only routes (default: private and loopback networks)
+	InternalStatus   int    // status of clients outside internal_only and allow_from networks: 403 (default) or 444
+	PortCheck        string // off, warn or fail on sockets bound to new stream ports (default: warn)
+	PolicyHostnames  string // comma-separated hostnames routes may claim, *.domain allows names under it (optional)
+	PolicyPorts      string // comma-separated proxy ports and ranges routes may claim (optional)
+	TransformScript  string // starlark file transforming the containers before rendering (optional)
+	PluginsDir       string // executables run on each generation, e.g. /etc/proxy/plugins.d (default: empty, disabled)
+	TLSSessions      TLSSessions
+	StreamDefaults   StreamDefaults
+	SSHGateway       SSHGateway
+	Warmup           Warmup
+	Hooks            Hooks
+
+	// IsolateNamespaces checks conflicts within each proxy.namespace on its own,
+	// a conflict there keeps the namespace's previous configs instead of failing the generation
+	IsolateNamespaces bool
+
+	// restart page of the HTTP routes of gone containers, served before the routes are removed
+	RestartGrace    time.Duration // how long the restart page is served (0 disables)
+	RestartPageAddr string        // local listen address of the restart page (default: 127.0.0.1:8098)
+
+	// metrics
+	MetricsAddr string // Prometheus /metrics listen address (empty disables)
+
+	// notifications
+	Webhooks      []string      // webhook URLs notified of config reloads, failures and alerts
+	WebhookDigest time.Duration // window batching reload and route webhooks into one summary (0 sends each one)
+	Alerts        []AlertRule   // access log alert rules, configured in the "alerts" section of the config file
+
+	// Streams are stream routes to targets outside Docker, configured in the "streams" section of the config file
+	Streams []StreamRoute
+
+	// admin API
+	AdminGRPCAddr string // gRPC admin API listen address, host:port or unix:/path (empty disables)
+	AdminToken    string // bearer token required by the admin API (ADMIN_TOKEN)
+
+	// remote delivery
+	SSH         SSHTarget        // remote nginx reached over SSH (disabled when Addr is empty)
+	ObjectStore ObjectStore      // S3-compatible bucket for hub-and-spoke publishing (disabled when URL is empty)
+	Kubernetes  KubernetesTarget // ConfigMap/Secret written via the Kubernetes API (disabled when Name is empty)
+
+	// multi-instance fan-out, configured in the "targets" section of the config file
+	Targets            []TargetSpec
+	TargetsStopOnError bool // skip remaining targets after the first failure
+
+	// ACME HTTP-01 challenge responder
+	ACMEChallengeAddr string // responder listen address proxied to by nginx (empty disables)
+	ACMEWebroot       string // directory with challenge tokens written by an external ACME client
+
+	// built-in ACME issuance, needs the challenge responder
+	ACMEDirectory string // production, staging or a directory URL (empty disables issuance)
+	ACMEEmail     string // account contact for expiry notices
+	ACMEKeyType   string // certificate key type: ecdsa256, ecdsa384, rsa2048 or rsa4096
+	ACMECertsDir  string // account key and issued certificates
 
 	// logging
 	LogLevel  string
 	LogCaller bool
 }
 
+// TLSSessions holds TLS session resumption settings for HTTPS listeners
+type TLSSessions struct {
+	Cache         string        // ssl_session_cache, e.g. shared:SSL:10m (empty keeps the nginx default)
+	Timeout       string        // ssl_session_timeout, e.g. 1d (empty keeps the nginx default)
+	TicketRotate  time.Duration // ticket key rotation interval (0 disables managed ticket keys)
+	TicketKeysDir string        // where managed ticket keys are written
+}
+
+// StreamDefaults holds settings of all stream servers (empty values keep the built-in ones)
+type StreamDefaults struct {
+	ProxyTimeout   string // proxy_timeout of TCP servers, e.g. 1h (default: 5m per server)
+	ConnectTimeout string // proxy_connect_timeout of TCP servers (default: 10s per server)
+	PrereadTimeout string // preread_timeout (empty keeps the nginx default)
+	TCPNodelay     string // tcp_nodelay on or off (empty keeps the nginx default)
+}
+
+// SSHGateway holds settings of the TLS-wrapped SSH gateway routed by proxy.ssh.alias
+type SSHGateway struct {
+	Port int    // listen port (0 disables the gateway)
+	Host string // public hostname clients connect to, used in the printed ssh snippets
+	Cert string // TLS certificate (empty uses the stream-level one of nginx.conf)
+	Key  string // TLS key
+}
+
+// Warmup holds settings of the requests sent to added routes after a reload
+type Warmup struct {
+	Path    string        // request path, e.g. / (empty disables warm-up)
+	Addr    string        // address nginx listens on (default: 127.0.0.1)
+	Timeout time.Duration // per request, long enough for the app to boot (default: 30s)
+
+	HTTPPort  int // port of the HTTP servers of nginx (default: 80)
+	HTTPSPort int // port of the HTTPS servers of nginx (default: 443)
+}
+
+// Hooks holds the commands and URLs called around each reload with the changed routes
+type Hooks struct {
+	Pre      string        // command run before delivery, a failure cancels the reload (empty disables)
+	Post     string        // command run after a successful reload (empty disables)
+	PreURLs  []string      // URLs posted to before delivery, a non-2xx answer cancels the reload
+	PostURLs []string      // URLs posted to after a successful reload
+	Timeout  time.Duration // per command or request (default: 30s)
+}
+
+// Vault holds settings for reading secrets from HashiCorp Vault
+type Vault struct {
+	Addr      string
+	Token     string        // static token (VAULT_TOKEN)
+	TokenFile string        // token file re-read on every request, takes precedence over Token
+	Dir       string        // where secrets are written for nginx
+	Refresh   time.Duration // re-read interval for secrets without a lease, also drives rotation checks
+}
+
+// SSHTarget holds settings for delivering configs to a remote nginx over SSH
+type SSHTarget struct {
+	Addr             string // host[:port]
+	User             string
+	KeyPath          string // private key file
+	KnownHostsPath   string // known_hosts file for host key verification
+	InsecureHostKey  bool   // skip host key verification
+	StreamConfigPath string // remote stream config path (default: same as local)
+	HTTPConfigPath   string // remote HTTP config path (default: same as local)
+	ValidateCmd      string // remote validation command (default: nginx -t)
+	ReloadCmd        string // remote reload command (default: nginx -s reload)
+}
+
+// ObjectStore holds settings for publishing configs to an S3-compatible bucket
+type ObjectStore struct {
+	URL          string // http(s)://endpoint/bucket[/prefix]
+	Region       string // signing region (default: us-east-1)
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// KubernetesTarget holds settings for writing configs into a ConfigMap or Secret
+type KubernetesTarget struct {
+	Kind       string // configmap or secret
+	Name       string
+	Namespace  string // default: service account namespace
+	Deployment string // deployment to roll out after an update (optional)
+	APIServer  string // default: in-cluster API server
+	TokenPath  string // default: service account token
+	CAPath     string // default: service account CA
+}
+
+// AlertRule fires when the share of requests with a status class on a host
+// stays above a threshold, see metrics.AlertRule
+type AlertRule struct {
+	Name        string        `yaml:"name"`
+	Host        string        `yaml:"host"`         // empty checks every host
+	Status      string        `yaml:"status"`       // status class (default: 5xx)
+	Threshold   float64       `yaml:"threshold"`    // ratio, e.g. 0.1 for 10%
+	For         time.Duration `yaml:"for"`          // window, e.g. 5m
+	MinRequests int           `yaml:"min-requests"` // default: 10
+}
+
+// StreamRoute forwards a stream port to a target outside Docker, see nginx.ExternalStream
+type StreamRoute struct {
+	Name     string `yaml:"name"`
+	Protocol string `yaml:"protocol"` // tcp or udp (default: tcp)
+	Port     int    `yaml:"port"`     // listen port
+	Target   string `yaml:"target"`   // host:port
+}
+
+// TargetSpec describes one nginx instance of a fan-out
+type TargetSpec struct {
+	Name             string `yaml:"name"`
+	Type             string `yaml:"type"`               // local, ssh or docker-exec
+	StreamConfigPath string `yaml:"stream-config-path"` // path on the instance (default: same as generated)
+	HTTPConfigPath   string `yaml:"http-config-path"`
+	ValidateCmd      string `yaml:"validate-cmd"` // default: nginx -t
+	ReloadCmd        string `yaml:"reload-cmd"`   // default: nginx -s reload
+
+	// ssh
+	SSHTarget          string `yaml:"ssh-target"` // user@host[:port]
+	SSHKey             string `yaml:"ssh-key"`
+	SSHKnownHosts      string `yaml:"ssh-known-hosts"`
+	SSHInsecureHostKey bool   `yaml:"ssh-insecure-host-key"`
+
+	// docker-exec
+	Container string `yaml:"container"`
+}
+
 // Load parses environment variables and returns Config
 // This is kept for backwards compatibility but config is now mostly handled via CLI flags
 func Load() (*Config, error) {
 	cfg := &Config{}
+	cfg.ConfigFile = getEnvOrDefault("PROXY_CONFIG", "")
 
 	// docker configuration
-	cfg.DockerHost = getEnvOrDefault("DOCKER_HOST", "unix:///var/run/docker.sock")
+	cfg.DockerHost = getEnvOrDefault("DOCKER_HOST", DefaultDockerHost())
+	cfg.DockerAPIVersion = getEnvOrDefault("DOCKER_API_VERSION", "")
+	dockerAPIRate, err := strconv.Atoi(getEnvOrDefault("DOCKER_API_RATE", "50"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_API_RATE: %w", err)
+	}
+	cfg.DockerAPIRate = dockerAPIRate
+	dockerAPIBurst, err := strconv.Atoi(getEnvOrDefault("DOCKER_API_BURST", "100"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_API_BURST: %w", err)
+	}
+	cfg.DockerAPIBurst = dockerAPIBurst
+	dockerAPIBudget, err := strconv.Atoi(getEnvOrDefault("DOCKER_API_BUDGET", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_API_BUDGET: %w", err)
+	}
+	cfg.DockerAPIBudget = dockerAPIBudget
+	cfg.AddressFamily = getEnvOrDefault("ADDRESS_FAMILY", "prefer-ipv4")
+	cfg.HostAddress = getEnvOrDefault("HOST_ADDRESS", "host-gateway")
 	cfg.NetworkName = getEnvOrDefault("PROXY_NETWORK", DefaultNetworkName)
 
+	// watch mode
+	debounce, err := time.ParseDuration(getEnvOrDefault("DEBOUNCE", "2s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEBOUNCE: %w", err)
+	}
+	cfg.Debounce = debounce
+	failureBudget, err := strconv.Atoi(getEnvOrDefault("FAILURE_BUDGET", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FAILURE_BUDGET: %w", err)
+	}
+	cfg.FailureBudget = failureBudget
+	cfg.FailureExit = getEnvOrDefault("FAILURE_EXIT", "false") == "true"
+
 	// nginx configuration paths
 	cfg.StreamConfigPath = getEnvOrDefault("NGINX_STREAM_CONFIG_PATH", "/etc/nginx/conf.d/proxy.conf")
 	cfg.HTTPConfigPath = getEnvOrDefault("NGINX_HTTP_CONFIG_PATH", "/etc/nginx/conf.d/http-proxy.conf")
 	cfg.NginxReloadCmd = getEnvOrDefault("NGINX_RELOAD_CMD", "nginx -s reload")
+	cfg.NginxCmd = getEnvOrDefault("NGINX_CMD", "nginx -g 'daemon off;'")
+	cfg.NginxBinary = getEnvOrDefault("NGINX_BINARY", "nginx")
+	cfg.StreamTemplate = getEnvOrDefault("STREAM_TEMPLATE", "")
+	cfg.HTTPTemplate = getEnvOrDefault("HTTP_TEMPLATE", "")
+	cfg.ExtraConfigDir = getEnvOrDefault("EXTRA_CONFIG_DIR", "")
+	cfg.CheckNginxConfig = getEnvOrDefault("CHECK_NGINX_CONFIG", "false") == "true"
+	cfg.StateFile = getEnvOrDefault("STATE_FILE", "/etc/nginx/conf.d/proxy-state.json")
+	cfg.SecretsDir = getEnvOrDefault("SECRETS_DIR", "/run/secrets")
+	cfg.ConfigFileMode = getEnvOrDefault("CONFIG_FILE_MODE", "0644")
+	cfg.ConfigOwner = getEnvOrDefault("CONFIG_OWNER", "")
+	cfg.Fsync = getEnvOrDefault("FSYNC", "false") == "true"
+	cfg.SecretsFileMode = getEnvOrDefault("SECRETS_FILE_MODE", "0600")
+	cfg.SecretsOwner = getEnvOrDefault("SECRETS_OWNER", "")
+	cfg.HTTP2 = getEnvOrDefault("HTTP2", "false") == "true"
+	cfg.HTTP3 = getEnvOrDefault("HTTP3", "false") == "true"
+	cfg.GeoIPDB = getEnvOrDefault("GEOIP_DB", "")
+	cfg.RequestID = getEnvOrDefault("REQUEST_ID", "false") == "true"
+	cfg.WAFRules = getEnvOrDefault("WAF_RULES", "")
+	cfg.BotPresets = getEnvOrDefault("BOT_PRESETS", "scanners")
+	cfg.BotPatternsFile = getEnvOrDefault("BOT_PATTERNS_FILE", "")
+	cfg.SyslogServer = getEnvOrDefault("SYSLOG_SERVER", "")
+	cfg.SyslogFacility = getEnvOrDefault("SYSLOG_FACILITY", "")
+	cfg.AccessLogJSON = getEnvOrDefault("ACCESS_LOG_JSON", "")
+	cfg.AccessLogSample = getEnvOrDefault("ACCESS_LOG_SAMPLE", "")
+	cfg.HeaderBufferSize = getEnvOrDefault("CLIENT_HEADER_BUFFER_SIZE", "")
+	cfg.HeaderBuffers = getEnvOrDefault("LARGE_CLIENT_HEADER_BUFFERS", "")
+	cfg.UpstreamZone = getEnvOrDefault("UPSTREAM_ZONE", "64k")
+	maxRoutes, err := strconv.Atoi(getEnvOrDefault("MAX_ROUTES", "10000"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAX_ROUTES: %w", err)
+	}
+	cfg.MaxRoutes = maxRoutes
+	maxServers, err := strconv.Atoi(getEnvOrDefault("MAX_UPSTREAM_SERVERS", "256"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAX_UPSTREAM_SERVERS: %w", err)
+	}
+	cfg.MaxServers = maxServers
+	cfg.MaxConfigSize = getEnvOrDefault("MAX_CONFIG_SIZE", "64m")
+	restartGrace, err := time.ParseDuration(getEnvOrDefault("RESTART_PAGE_GRACE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RESTART_PAGE_GRACE: %w", err)
+	}
+	cfg.RestartGrace = restartGrace
+	cfg.RestartPageAddr = getEnvOrDefault("RESTART_PAGE_ADDR", "127.0.0.1:8098")
+	cfg.ForwardedHeaders = getEnvOrDefault("FORWARDED_HEADERS", "append")
+	cfg.TrustedProxies = getEnvOrDefault("TRUSTED_PROXIES", "")
+	cfg.Resolver = getEnvOrDefault("RESOLVER", "")
+	cfg.InternalCIDRs = getEnvOrDefault("INTERNAL_CIDRS", "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.0/8,fc00::/7,::1")
+	internalStatus, err := strconv.Atoi(getEnvOrDefault("INTERNAL_DENY_STATUS", "403"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid INTERNAL_DENY_STATUS: %w", err)
+	}
+	cfg.InternalStatus = internalStatus
+	cfg.PortCheck = getEnvOrDefault("PORT_CHECK", "warn")
+	cfg.PolicyHostnames = getEnvOrDefault("POLICY_HOSTNAMES", "")
+	cfg.PolicyPorts = getEnvOrDefault("POLICY_PORTS", "")
+	cfg.TransformScript = getEnvOrDefault("TRANSFORM_SCRIPT", "")
+	cfg.PluginsDir = getEnvOrDefault("PLUGINS_DIR", "")
+	cfg.IsolateNamespaces = getEnvOrDefault("ISOLATE_NAMESPACES", "false") == "true"
+
+	// metrics configuration
+	cfg.MetricsAddr = getEnvOrDefault("METRICS_ADDR", "")
+	webhooks, err := notify.ParseURLs(getEnvOrDefault("WEBHOOK_URLS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_URLS: %w", err)
+	}
+	cfg.Webhooks = webhooks
+	webhookDigest, err := time.ParseDuration(getEnvOrDefault("WEBHOOK_DIGEST", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_DIGEST: %w", err)
+	}
+	cfg.WebhookDigest = webhookDigest
+
+	// admin API configuration
+	cfg.AdminGRPCAddr = getEnvOrDefault("ADMIN_GRPC_ADDR", "")
+	cfg.AdminToken = getEnvOrDefault("ADMIN_TOKEN", "")
+
+	// TLS session configuration
+	ticketRotate, err := time.ParseDuration(getEnvOrDefault("SSL_TICKET_KEY_ROTATE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSL_TICKET_KEY_ROTATE: %w", err)
+	}
+	cfg.TLSSessions = TLSSessions{
+		Cache:         getEnvOrDefault("SSL_SESSION_CACHE", ""),
+		Timeout:       getEnvOrDefault("SSL_SESSION_TIMEOUT", ""),
+		TicketRotate:  ticketRotate,
+		TicketKeysDir: getEnvOrDefault("SSL_TICKET_KEYS_DIR", "/etc/nginx/proxy-tickets"),
+	}
+
+	cfg.StreamDefaults = StreamDefaults{
+		ProxyTimeout:   getEnvOrDefault("STREAM_PROXY_TIMEOUT", ""),
+		ConnectTimeout: getEnvOrDefault("STREAM_CONNECT_TIMEOUT", ""),
+		PrereadTimeout: getEnvOrDefault("STREAM_PREREAD_TIMEOUT", ""),
+		TCPNodelay:     getEnvOrDefault("STREAM_TCP_NODELAY", ""),
+	}
+
+	sshGatewayPort, err := strconv.Atoi(getEnvOrDefault("SSH_GATEWAY_PORT", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH_GATEWAY_PORT: %w", err)
+	}
+	cfg.SSHGateway = SSHGateway{
+		Port: sshGatewayPort,
+		Host: getEnvOrDefault("SSH_GATEWAY_HOST", ""),
+		Cert: getEnvOrDefault("SSH_GATEWAY_CERT", ""),
+		Key:  getEnvOrDefault("SSH_GATEWAY_KEY", ""),
+	}
+
+	warmupTimeout, err := time.ParseDuration(getEnvOrDefault("WARMUP_TIMEOUT", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARMUP_TIMEOUT: %w", err)
+	}
+	warmupHTTPPort, err := strconv.Atoi(getEnvOrDefault("WARMUP_HTTP_PORT", "80"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARMUP_HTTP_PORT: %w", err)
+	}
+	warmupHTTPSPort, err := strconv.Atoi(getEnvOrDefault("WARMUP_HTTPS_PORT", "443"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARMUP_HTTPS_PORT: %w", err)
+	}
+	cfg.Warmup = Warmup{
+		Path:      getEnvOrDefault("WARMUP_PATH", ""),
+		Addr:      getEnvOrDefault("WARMUP_ADDR", "127.0.0.1"),
+		Timeout:   warmupTimeout,
+		HTTPPort:  warmupHTTPPort,
+		HTTPSPort: warmupHTTPSPort,
+	}
+
+	hookTimeout, err := time.ParseDuration(getEnvOrDefault("HOOK_TIMEOUT", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid HOOK_TIMEOUT: %w", err)
+	}
+	cfg.Hooks = Hooks{
+		Pre:     getEnvOrDefault("PRE_HOOK", ""),
+		Post:    getEnvOrDefault("POST_HOOK", ""),
+		Timeout: hookTimeout,
+	}
+	if urls := getEnvOrDefault("PRE_HOOK_URLS", ""); urls != "" {
+		cfg.Hooks.PreURLs = strings.Split(urls, ",")
+	}
+	if urls := getEnvOrDefault("POST_HOOK_URLS", ""); urls != "" {
+		cfg.Hooks.PostURLs = strings.Split(urls, ",")
+	}
+
+	// ACME configuration
+	cfg.ACMEChallengeAddr = getEnvOrDefault("ACME_CHALLENGE_ADDR", "")
+	cfg.ACMEWebroot = getEnvOrDefault("ACME_WEBROOT", "")
+	cfg.ACMEDirectory = getEnvOrDefault("ACME_DIRECTORY", "")
+	cfg.ACMEEmail = getEnvOrDefault("ACME_EMAIL", "")
+	cfg.ACMEKeyType = getEnvOrDefault("ACME_KEY_TYPE", "ecdsa256")
+	cfg.ACMECertsDir = getEnvOrDefault("ACME_CERTS_DIR", "/etc/nginx/proxy-certs")
 
 	// logging configuration
 	cfg.LogLevel = strings.ToUpper(getEnvOrDefault("LOG_LEVEL", "INFO"))
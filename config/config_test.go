@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -35,6 +36,18 @@ func TestLoad(t *testing.T) {
 				if cfg.LogCaller {
 					t.Error("expected LogCaller=false by default")
 				}
+				if cfg.Debounce != 2*time.Second {
+					t.Errorf("expected default debounce 2s, got %s", cfg.Debounce)
+				}
+				if cfg.AddressFamily != "prefer-ipv4" {
+					t.Errorf("expected default address family prefer-ipv4, got %s", cfg.AddressFamily)
+				}
+				if cfg.HostAddress != "host-gateway" {
+					t.Errorf("expected default host address host-gateway, got %s", cfg.HostAddress)
+				}
+				if cfg.RestartGrace != 0 || cfg.RestartPageAddr != "127.0.0.1:8098" {
+					t.Errorf("expected the restart page disabled on 127.0.0.1:8098, got %s on %s", cfg.RestartGrace, cfg.RestartPageAddr)
+				}
 			},
 		},
 		{
@@ -69,6 +82,52 @@ func TestLoad(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "custom debounce",
+			envVars: map[string]string{
+				"DEBOUNCE": "500ms",
+			},
+			wantErr: false,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Debounce != 500*time.Millisecond {
+					t.Errorf("expected debounce 500ms, got %s", cfg.Debounce)
+				}
+			},
+		},
+		{
+			name: "invalid debounce",
+			envVars: map[string]string{
+				"DEBOUNCE": "soon",
+			},
+			wantErr: true,
+		},
+		{
+			name: "docker API limits",
+			envVars: map[string]string{
+				"DOCKER_API_RATE":   "10",
+				"DOCKER_API_BUDGET": "600",
+			},
+			wantErr: false,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.DockerAPIRate != 10 || cfg.DockerAPIBurst != 100 || cfg.DockerAPIBudget != 600 {
+					t.Errorf("expected rate 10, burst 100, budget 600, got %d, %d, %d", cfg.DockerAPIRate, cfg.DockerAPIBurst, cfg.DockerAPIBudget)
+				}
+			},
+		},
+		{
+			name: "invalid webhook URL",
+			envVars: map[string]string{
+				"WEBHOOK_URLS": "https://hooks.example.com/a,hooks.example.com/b",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid docker API rate",
+			envVars: map[string]string{
+				"DOCKER_API_RATE": "fast",
+			},
+			wantErr: true,
+		},
 		{
 			name: "log level normalization",
 			envVars: map[string]string{
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File holds settings read from a YAML config file
+// Top-level keys are CLI flag names (e.g. "reload-cmd: nginx -s reload"),
+// structured sections can be decoded separately with Decode
+type File struct {
+	Path  string
+	nodes map[string]yaml.Node
+}
+
+// LoadFile reads and parses a YAML config file
+func LoadFile(path string) (*File, error) {
+	// #nosec G304 -- path is from trusted configuration, not user input
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	nodes := make(map[string]yaml.Node)
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return &File{Path: path, nodes: nodes}, nil
+}
+
+// Get returns the scalar value for a key
+// Returns false if the file is nil, the key is missing or not a scalar
+func (f *File) Get(key string) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	node, ok := f.nodes[key]
+	if !ok || node.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return node.Value, true
+}
+
+// Decode decodes a structured section into out
+// Missing keys leave out untouched
+func (f *File) Decode(key string, out interface{}) error {
+	if f == nil {
+		return nil
+	}
+	node, ok := f.nodes[key]
+	if !ok {
+		return nil
+	}
+	if err := node.Decode(out); err != nil {
+		return fmt.Errorf("invalid %q section in config file: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yml")
+	content := `reload-cmd: systemctl reload nginx
+debounce: 5s
+fsync: true
+targets:
+  - name: nas
+    port: 2222
+alerts:
+  - name: api-5xx
+    threshold: 0.1
+    for: 5m
+streams:
+  - name: nas-ssh
+    port: 2222
+    target: 192.168.1.10:22
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	t.Run("scalar values", func(t *testing.T) {
+		if v, ok := f.Get("reload-cmd"); !ok || v != "systemctl reload nginx" {
+			t.Errorf("Get(reload-cmd) = %q, %t", v, ok)
+		}
+		if v, ok := f.Get("debounce"); !ok || v != "5s" {
+			t.Errorf("Get(debounce) = %q, %t", v, ok)
+		}
+		if v, ok := f.Get("fsync"); !ok || v != "true" {
+			t.Errorf("Get(fsync) = %q, %t", v, ok)
+		}
+	})
+
+	t.Run("missing and structured keys are not scalars", func(t *testing.T) {
+		if _, ok := f.Get("missing"); ok {
+			t.Error("expected missing key to be absent")
+		}
+		if _, ok := f.Get("targets"); ok {
+			t.Error("expected structured key not to be returned as scalar")
+		}
+	})
+
+	t.Run("decodes structured sections", func(t *testing.T) {
+		var targets []struct {
+			Name string `yaml:"name"`
+			Port int    `yaml:"port"`
+		}
+		if err := f.Decode("targets", &targets); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if len(targets) != 1 || targets[0].Name != "nas" || targets[0].Port != 2222 {
+			t.Errorf("unexpected targets %+v", targets)
+		}
+	})
+
+	t.Run("decodes alert rule durations", func(t *testing.T) {
+		var alerts []AlertRule
+		if err := f.Decode("alerts", &alerts); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if len(alerts) != 1 || alerts[0].Name != "api-5xx" || alerts[0].Threshold != 0.1 || alerts[0].For != 5*time.Minute {
+			t.Errorf("unexpected alerts %+v", alerts)
+		}
+	})
+
+	t.Run("decodes stream routes", func(t *testing.T) {
+		var streams []StreamRoute
+		if err := f.Decode("streams", &streams); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if len(streams) != 1 || streams[0].Name != "nas-ssh" || streams[0].Port != 2222 || streams[0].Target != "192.168.1.10:22" {
+			t.Errorf("unexpected streams %+v", streams)
+		}
+	})
+
+	t.Run("nil file is empty", func(t *testing.T) {
+		var empty *File
+		if _, ok := empty.Get("reload-cmd"); ok {
+			t.Error("nil file should not return values")
+		}
+	})
+
+	t.Run("invalid yaml fails", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.yml")
+		if err := os.WriteFile(bad, []byte("a: [unclosed"), 0o600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if _, err := LoadFile(bad); err == nil {
+			t.Error("expected parse error")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package dataplane
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// hostRouter dispatches HTTP requests to container backends by Host header
+type hostRouter struct {
+	routes atomic.Value // map[string]*httputil.ReverseProxy
+	log    *lgr.Logger
+}
+
+func newHostRouter(log *lgr.Logger) *hostRouter {
+	r := &hostRouter{log: log}
+	r.routes.Store(map[string]*httputil.ReverseProxy{})
+	return r
+}
+
+// SetRoutes replaces the hostname -> backend address table
+func (r *hostRouter) SetRoutes(targets map[string]string) {
+	routes := make(map[string]*httputil.ReverseProxy, len(targets))
+	for hostname, target := range targets {
+		backend := &url.URL{Scheme: "http", Host: target}
+		proxy := httputil.NewSingleHostReverseProxy(backend)
+
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			// the original Host header is kept, like proxy_set_header Host $host
+			director(req)
+			req.Header.Set("X-Real-IP", clientIP(req.RemoteAddr))
+			req.Header.Set("X-Forwarded-Proto", "http")
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+			r.log.Logf("WARN [Dataplane] upstream error host=%s target=%s error=%q", req.Host, target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		routes[strings.ToLower(hostname)] = proxy
+	}
+	r.routes.Store(routes)
+}
+
+func (r *hostRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	routes, _ := r.routes.Load().(map[string]*httputil.ReverseProxy) //nolint:errcheck // always stored as map
+	proxy, ok := routes[strings.ToLower(host)]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	proxy.ServeHTTP(w, req)
+}
+
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
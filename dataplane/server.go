@@ -0,0 +1,279 @@
+// Package dataplane implements TCP/UDP forwarding and HTTP host routing in Go,
+// as an experimental alternative to generating nginx configs
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+)
+
+// Server forwards traffic to containers based on their proxy labels
+type Server struct {
+	listenAddr string
+	httpPort   int
+	log        *lgr.Logger
+
+	mu      sync.Mutex
+	tcp     map[int]*tcpForwarder
+	udp     map[int]*udpForwarder
+	router  *hostRouter
+	httpSrv *http.Server
+}
+
+// NewServer creates a new data plane server
+// listenAddr is the bind address (empty for all interfaces), httpPort 0 disables HTTP routing
+func NewServer(listenAddr string, httpPort int, log *lgr.Logger) *Server {
+	return &Server{
+		listenAddr: listenAddr,
+		httpPort:   httpPort,
+		log:        log,
+		tcp:        make(map[int]*tcpForwarder),
+		udp:        make(map[int]*udpForwarder),
+		router:     newHostRouter(log),
+	}
+}
+
+// Start opens the HTTP listener, stream listeners are opened by Update
+func (s *Server) Start() error {
+	if s.httpPort == 0 {
+		s.log.Logf("INFO [Dataplane] HTTP routing disabled")
+		return nil
+	}
+
+	addr := s.addr(s.httpPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s.httpSrv = &http.Server{
+		Handler:           s.router,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		if err := s.httpSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Logf("ERROR [Dataplane] HTTP server failed error=%q", err)
+		}
+	}()
+
+	s.log.Logf("INFO [Dataplane] HTTP routing listening addr=%s", addr)
+	return nil
+}
+
+// Update applies the route set from discovered containers
+// New ports are opened, removed ports are closed and targets of existing ports are swapped in place
+// New ports are opened before anything changes, when one fails to open the previous routes stay
+func (s *Server) Update(containers []docker.ContainerInfo) error {
+	tcpTargets, udpTargets, hostTargets, err := buildRoutes(containers)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// open new listeners
+	newTCP := make(map[int]*tcpForwarder)
+	newUDP := make(map[int]*udpForwarder)
+	rollback := func() {
+		for _, fwd := range newTCP {
+			fwd.Close()
+		}
+		for _, fwd := range newUDP {
+			fwd.Close()
+		}
+	}
+	for port, target := range tcpTargets {
+		if _, ok := s.tcp[port]; ok {
+			continue
+		}
+		fwd, err := newTCPForwarder(s.addr(port), target, s.log)
+		if err != nil {
+			rollback()
+			return err
+		}
+		newTCP[port] = fwd
+	}
+	for port, target := range udpTargets {
+		if _, ok := s.udp[port]; ok {
+			continue
+		}
+		fwd, err := newUDPForwarder(s.addr(port), target, s.log)
+		if err != nil {
+			rollback()
+			return err
+		}
+		newUDP[port] = fwd
+	}
+
+	// close removed listeners
+	for port, fwd := range s.tcp {
+		if _, ok := tcpTargets[port]; !ok {
+			fwd.Close()
+			delete(s.tcp, port)
+			s.log.Logf("INFO [Dataplane] closed protocol=TCP port=%d", port)
+		}
+	}
+	for port, fwd := range s.udp {
+		if _, ok := udpTargets[port]; !ok {
+			fwd.Close()
+			delete(s.udp, port)
+			s.log.Logf("INFO [Dataplane] closed protocol=UDP port=%d", port)
+		}
+	}
+
+	// add the new listeners and retarget existing ones
+	for port, target := range tcpTargets {
+		if fwd, ok := newTCP[port]; ok {
+			s.tcp[port] = fwd
+			s.log.Logf("INFO [Dataplane] listening protocol=TCP port=%d target=%s", port, target)
+			continue
+		}
+		s.tcp[port].SetTarget(target)
+	}
+	for port, target := range udpTargets {
+		if fwd, ok := newUDP[port]; ok {
+			s.udp[port] = fwd
+			s.log.Logf("INFO [Dataplane] listening protocol=UDP port=%d target=%s", port, target)
+			continue
+		}
+		s.udp[port].SetTarget(target)
+	}
+
+	s.router.SetRoutes(hostTargets)
+
+	s.log.Logf("INFO [Dataplane] routes applied tcp_ports=%d udp_ports=%d http_hosts=%d",
+		len(tcpTargets), len(udpTargets), len(hostTargets))
+
+	return nil
+}
+
+// Close stops all listeners
+func (s *Server) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for port, fwd := range s.tcp {
+		fwd.Close()
+		delete(s.tcp, port)
+	}
+	for port, fwd := range s.udp {
+		fwd.Close()
+		delete(s.udp, port)
+	}
+
+	if s.httpSrv != nil {
+		if err := s.httpSrv.Shutdown(ctx); err != nil {
+			return fmt.Errorf("HTTP server shutdown failed: %w", err)
+		}
+	}
+
+	s.log.Logf("INFO [Dataplane] stopped")
+	return nil
+}
+
+func (s *Server) addr(port int) string {
+	return net.JoinHostPort(s.listenAddr, strconv.Itoa(port))
+}
+
+// buildRoutes transforms container info into port and hostname target tables
+// Conflicts are rejected with the same rules as the nginx generator
+func buildRoutes(containers []docker.ContainerInfo) (tcp, udp map[int]string, hosts map[string]string, err error) {
+	tcp = make(map[int]string)
+	udp = make(map[int]string)
+	hosts = make(map[string]string)
+
+	tcpOwners := make(map[int]string)
+	udpOwners := make(map[int]string)
+	hostOwners := make(map[string]string)
+	tcpHashes := make(map[int]string)
+	udpHashes := make(map[int]string)
+	hostServices := make(map[string]string)
+
+	for _, ctr := range containers {
+		for _, mapping := range ctr.Mappings {
+			target := net.JoinHostPort(ctr.IP, strconv.Itoa(mapping.ContainerPort))
+			// one target per port, pooled replicas are all served by the first one
+			hashes := udpHashes
+			if mapping.Protocol == docker.TCP {
+				hashes = tcpHashes
+			}
+			if hash, pooled := hashes[mapping.ProxyPort]; pooled && mapping.Hash != "" && mapping.Hash == hash {
+				continue
+			}
+			if mapping.Protocol == docker.TCP {
+				if existing, exists := tcpOwners[mapping.ProxyPort]; exists {
+					return nil, nil, nil, conflictf("TCP port conflict: port %d claimed by both %s and %s",
+						mapping.ProxyPort, existing, ctr.Name)
+				}
+				tcpOwners[mapping.ProxyPort] = ctr.Name
+				tcpHashes[mapping.ProxyPort] = mapping.Hash
+				tcp[mapping.ProxyPort] = target
+				continue
+			}
+			if existing, exists := udpOwners[mapping.ProxyPort]; exists {
+				return nil, nil, nil, conflictf("UDP port conflict: port %d claimed by both %s and %s",
+					mapping.ProxyPort, existing, ctr.Name)
+			}
+			udpOwners[mapping.ProxyPort] = ctr.Name
+			udpHashes[mapping.ProxyPort] = mapping.Hash
+			udp[mapping.ProxyPort] = target
+		}
+
+		for _, mapping := range ctr.AllHTTPMappings() {
+			if unsupportedHTTP(mapping) {
+				continue
+			}
+			for _, hostname := range mapping.Hostnames {
+				target := net.JoinHostPort(ctr.IP, strconv.Itoa(mapping.PortFor(hostname)))
+				if service, pooled := hostServices[hostname]; pooled && ctr.Service != "" && ctr.Service == service {
+					continue
+				}
+				if existing, exists := hostOwners[hostname]; exists {
+					return nil, nil, nil, conflictf("HTTP hostname conflict: %s claimed by both %s and %s",
+						hostname, existing, ctr.Name)
+				}
+				hostOwners[hostname] = ctr.Name
+				hostServices[hostname] = ctr.Service
+				hosts[hostname] = target
+			}
+		}
+	}
+
+	return tcp, udp, hosts, nil
+}
+
+// unsupportedHTTP reports whether a route needs a feature the data plane does not implement
+// Basic auth, OIDC, backend TLS, gRPC, static files, geo and referer rules, the WAF, bot
+// blocking, method and client network restrictions, body size limits, nginx variables passed
+// to the backend and X-Forwarded-* modes other than append are not implemented here, never
+// expose such hosts without them; socket paths are only valid inside the nginx container
+func unsupportedHTTP(mapping docker.HTTPMapping) bool {
+	return mapping.AuthSecret != "" || mapping.OIDC != nil || mapping.BackendHTTPS || mapping.GRPC ||
+		mapping.StaticRoot != "" || mapping.Socket != "" || len(mapping.GeoAllow) > 0 || len(mapping.GeoDeny) > 0 ||
+		len(mapping.ValidReferers) > 0 || mapping.WAF || mapping.BlockBots || len(mapping.AllowedMethods) > 0 ||
+		mapping.InternalOnly || len(mapping.AllowFrom) > 0 || (mapping.MaxBodySize != "" && mapping.MaxBodySize != "0") ||
+		mapping.Forwarded == docker.ForwardedOverwrite || mapping.Forwarded == docker.ForwardedStrip ||
+		len(mapping.PassVars) > 0
+}
+
+// conflictError is a route conflict matching nginx.ErrConflict, so serve exits like generate
+type conflictError struct{ error }
+
+func (conflictError) Is(target error) bool { return target == nginx.ErrConflict }
+
+// conflictf formats a conflict error
+func conflictf(format string, args ...any) error {
+	return conflictError{fmt.Errorf(format, args...)}
+}
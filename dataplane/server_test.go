@@ -0,0 +1,265 @@
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/nginx"
+)
+
+// freePort returns a currently unused local TCP port
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to get free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestBuildRoutes(t *testing.T) {
+	t.Run("rejects TCP port conflicts", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{Name: "web1", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 80, ContainerPort: 8080, Protocol: docker.TCP}}},
+			{Name: "web2", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 80, ContainerPort: 3000, Protocol: docker.TCP}}},
+		}
+		_, _, _, err := buildRoutes(containers)
+		if err == nil || !strings.Contains(err.Error(), "TCP port conflict: port 80") || !errors.Is(err, nginx.ErrConflict) {
+			t.Errorf("expected TCP conflict error, got %v", err)
+		}
+	})
+
+	t.Run("same port TCP and UDP is allowed", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{Name: "dns", IP: "172.17.0.2", Mappings: []docker.PortMapping{
+				{ProxyPort: 53, ContainerPort: 53, Protocol: docker.TCP},
+				{ProxyPort: 53, ContainerPort: 53, Protocol: docker.UDP},
+			}},
+		}
+		tcp, udp, _, err := buildRoutes(containers)
+		if err != nil {
+			t.Fatalf("buildRoutes() error = %v", err)
+		}
+		if tcp[53] != "172.17.0.2:53" || udp[53] != "172.17.0.2:53" {
+			t.Errorf("unexpected targets tcp=%v udp=%v", tcp, udp)
+		}
+	})
+
+	t.Run("service replicas use the first container", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{Name: "api-1", IP: "172.17.0.2", Service: "shop/api", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 80}},
+			{Name: "api-2", IP: "172.17.0.3", Service: "shop/api", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 80}},
+		}
+		_, _, hosts, err := buildRoutes(containers)
+		if err != nil {
+			t.Fatalf("buildRoutes() error = %v", err)
+		}
+		if hosts["api.example.com"] != "172.17.0.2:80" {
+			t.Errorf("unexpected target hosts=%v", hosts)
+		}
+	})
+
+	t.Run("skips hosts with unsupported features", func(t *testing.T) {
+		for name, mapping := range map[string]docker.HTTPMapping{
+			"allow_from":      {AllowFrom: []string{"203.0.113.7"}},
+			"allowed_methods": {AllowedMethods: []string{"GET", "HEAD"}},
+			"block_bots":      {BlockBots: true},
+			"forwarded":       {Forwarded: docker.ForwardedStrip},
+			"internal_only":   {InternalOnly: true},
+			"max_body_size":   {MaxBodySize: "10m"},
+			"pass_vars":       {PassVars: []docker.PassVar{{Header: "X-Ssl-Client-S-Dn", Variable: "$ssl_client_s_dn"}}},
+			"oidc":            {OIDC: &docker.OIDC{}},
+			"referers":        {ValidReferers: []string{"none", "*.example.com"}},
+		} {
+			mapping.Hostnames, mapping.ContainerPort = []string{"app.example.com"}, 80
+			_, _, hosts, err := buildRoutes([]docker.ContainerInfo{{Name: "app", IP: "172.17.0.2", HTTPMapping: &mapping}})
+			if err != nil {
+				t.Fatalf("buildRoutes() error = %v", err)
+			}
+			if len(hosts) != 0 {
+				t.Errorf("%s: host served without the feature, hosts=%v", name, hosts)
+			}
+		}
+	})
+
+	t.Run("skips both audiences of an authenticated host", func(t *testing.T) {
+		// proxy.http.host.internal drops the auth of the internal variant and relies on internal_only
+		_, _, hosts, err := buildRoutes([]docker.ContainerInfo{{Name: "nas", IP: "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"nas.example.com"}, ContainerPort: 5000,
+				Audience: docker.AudienceExternal, AuthSecret: "nas-users"},
+			HTTPRoutes: []docker.HTTPMapping{{Hostnames: []string{"nas.lan"}, ContainerPort: 5000,
+				Audience: docker.AudienceInternal, InternalOnly: true}},
+		}})
+		if err != nil {
+			t.Fatalf("buildRoutes() error = %v", err)
+		}
+		if len(hosts) != 0 {
+			t.Errorf("a host served without its auth or client restriction, hosts=%v", hosts)
+		}
+	})
+
+	t.Run("hashed replicas use the first container", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{Name: "wg1", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 51820, ContainerPort: 51820, Protocol: docker.UDP, Hash: "$remote_addr"}}},
+			{Name: "wg2", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 51820, ContainerPort: 51820, Protocol: docker.UDP, Hash: "$remote_addr"}}},
+		}
+		_, udp, _, err := buildRoutes(containers)
+		if err != nil {
+			t.Fatalf("buildRoutes() error = %v", err)
+		}
+		if udp[51820] != "172.17.0.2:51820" {
+			t.Errorf("unexpected target udp=%v", udp)
+		}
+	})
+}
+
+func TestServerForwarding(t *testing.T) {
+	log := lgr.New()
+
+	// HTTP backend echoing the Host header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "host=%s", r.Host)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	backendPort, _ := strconv.Atoi(backendURL.Port())
+
+	// TCP echo backend
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start echo backend: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+
+	httpPort := freePort(t)
+	tcpPort := freePort(t)
+
+	server := NewServer("127.0.0.1", httpPort, log)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Close(context.Background())
+
+	err = server.Update([]docker.ContainerInfo{
+		{
+			Name:     "app",
+			IP:       "127.0.0.1",
+			Mappings: []docker.PortMapping{{ProxyPort: tcpPort, ContainerPort: echoPort, Protocol: docker.TCP}},
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames:     []string{"app.example.com"},
+				ContainerPort: backendPort,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	t.Run("routes HTTP by host header", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", httpPort), http.NoBody)
+		req.Host = "app.example.com"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "host=app.example.com" {
+			t.Errorf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("unknown host returns 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", httpPort), http.NoBody)
+		req.Host = "other.example.com"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("forwards TCP connections", func(t *testing.T) {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", tcpPort), 2*time.Second)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(buf) != "ping" {
+			t.Errorf("echo = %q, want ping", buf)
+		}
+	})
+
+	t.Run("keeps the previous routes when a port fails to open", func(t *testing.T) {
+		taken, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to occupy a port: %v", err)
+		}
+		defer taken.Close()
+		freeTCP := freePort(t)
+
+		err = server.Update([]docker.ContainerInfo{{
+			Name: "db", IP: "127.0.0.1", Mappings: []docker.PortMapping{
+				{ProxyPort: freeTCP, ContainerPort: echoPort, Protocol: docker.TCP},
+				{ProxyPort: taken.Addr().(*net.TCPAddr).Port, ContainerPort: echoPort, Protocol: docker.TCP},
+			},
+		}})
+		if err == nil {
+			t.Fatal("expected an error for the occupied port")
+		}
+		if _, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", freeTCP), time.Second); err == nil {
+			t.Error("expected the port opened before the failure to be closed again")
+		}
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", tcpPort), time.Second)
+		if err != nil {
+			t.Fatalf("expected the previous TCP port to stay open: %v", err)
+		}
+		conn.Close()
+	})
+
+	t.Run("closes removed ports", func(t *testing.T) {
+		if err := server.Update(nil); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		if _, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", tcpPort), time.Second); err == nil {
+			t.Error("expected removed TCP port to be closed")
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+const (
+	tcpConnectTimeout = 10 * time.Second
+	udpSessionTimeout = 30 * time.Second
+	udpBufferSize     = 64 * 1024
+)
+
+// tcpForwarder accepts TCP connections on one port and pipes them to the current target
+type tcpForwarder struct {
+	ln     net.Listener
+	target atomic.Value // string
+	log    *lgr.Logger
+}
+
+func newTCPForwarder(addr, target string, log *lgr.Logger) (*tcpForwarder, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+
+	f := &tcpForwarder{ln: ln, log: log}
+	f.target.Store(target)
+
+	go f.serve()
+
+	return f, nil
+}
+
+// SetTarget changes the upstream for new connections, existing ones are kept
+func (f *tcpForwarder) SetTarget(target string) {
+	f.target.Store(target)
+}
+
+// Close stops accepting connections
+func (f *tcpForwarder) Close() {
+	if err := f.ln.Close(); err != nil {
+		f.log.Logf("WARN [Dataplane] failed to close tcp listener error=%q", err)
+	}
+}
+
+func (f *tcpForwarder) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				f.log.Logf("ERROR [Dataplane] tcp accept failed error=%q", err)
+			}
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *tcpForwarder) handle(client net.Conn) {
+	defer client.Close()
+
+	target, _ := f.target.Load().(string) //nolint:errcheck // always stored as string
+	upstream, err := net.DialTimeout("tcp", target, tcpConnectTimeout)
+	if err != nil {
+		f.log.Logf("WARN [Dataplane] tcp dial failed target=%s error=%q", target, err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src) //nolint:errcheck // connection errors end the session
+		// half-close so the other side sees EOF
+		if tc, ok := dst.(*net.TCPConn); ok {
+			_ = tc.CloseWrite() //nolint:errcheck // best effort
+		}
+		done <- struct{}{}
+	}
+
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+
+	<-done
+	<-done
+}
+
+// udpForwarder relays UDP datagrams, keeping one upstream socket per client address
+type udpForwarder struct {
+	conn   *net.UDPConn
+	target atomic.Value // string
+	log    *lgr.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*net.UDPConn
+}
+
+func newUDPForwarder(addr, target string, log *lgr.Logger) (*udpForwarder, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid udp address %s: %w", addr, err)
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+
+	f := &udpForwarder{conn: conn, log: log, sessions: make(map[string]*net.UDPConn)}
+	f.target.Store(target)
+
+	go f.serve()
+
+	return f, nil
+}
+
+// SetTarget changes the upstream for new client sessions
+func (f *udpForwarder) SetTarget(target string) {
+	f.target.Store(target)
+}
+
+// Close stops the listener and all client sessions
+func (f *udpForwarder) Close() {
+	if err := f.conn.Close(); err != nil {
+		f.log.Logf("WARN [Dataplane] failed to close udp listener error=%q", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, upstream := range f.sessions {
+		_ = upstream.Close() //nolint:errcheck // shutting down
+		delete(f.sessions, key)
+	}
+}
+
+func (f *udpForwarder) serve() {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, client, err := f.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				f.log.Logf("ERROR [Dataplane] udp read failed error=%q", err)
+			}
+			return
+		}
+
+		upstream, err := f.session(client)
+		if err != nil {
+			f.log.Logf("WARN [Dataplane] udp session failed client=%s error=%q", client, err)
+			continue
+		}
+
+		if _, err := upstream.Write(buf[:n]); err != nil {
+			f.log.Logf("WARN [Dataplane] udp write failed client=%s error=%q", client, err)
+		}
+	}
+}
+
+// session returns the upstream socket for a client, creating it on first packet
+func (f *udpForwarder) session(client *net.UDPAddr) (*net.UDPConn, error) {
+	key := client.String()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if upstream, ok := f.sessions[key]; ok {
+		return upstream, nil
+	}
+
+	target, _ := f.target.Load().(string) //nolint:errcheck // always stored as string
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid udp target %s: %w", target, err)
+	}
+
+	upstream, err := net.DialUDP("udp", nil, targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("udp dial failed: %w", err)
+	}
+
+	f.sessions[key] = upstream
+	go f.relayReplies(key, client, upstream)
+
+	return upstream, nil
+}
+
+// relayReplies copies upstream responses back to the client until the session idles out
+func (f *udpForwarder) relayReplies(key string, client *net.UDPAddr, upstream *net.UDPConn) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.sessions, key)
+		f.mu.Unlock()
+		_ = upstream.Close() //nolint:errcheck // session ended
+	}()
+
+	buf := make([]byte, udpBufferSize)
+	for {
+		if err := upstream.SetReadDeadline(time.Now().Add(udpSessionTimeout)); err != nil {
+			return
+		}
+		n, err := upstream.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := f.conn.WriteToUDP(buf[:n], client); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package delivery applies generated nginx configs to local or remote nginx instances
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// config kinds, used to map files between hosts with different paths
+const (
+	KindStream = "stream"
+	KindHTTP   = "http"
+)
+
+// ErrValidation and ErrReload mark the failures of a target's nginx to accept or load the configs
+var (
+	ErrValidation = errors.New("validation failed")
+	ErrReload     = errors.New("reload failed")
+)
+
+// File is a generated config file ready for delivery
+type File struct {
+	Kind      string // KindStream or KindHTTP
+	LocalPath string // where the generator wrote the file
+	Content   []byte
+}
+
+// Target applies generated configs to one nginx instance: deliver, validate, reload
+type Target interface {
+	Name() string
+	Apply(ctx context.Context, files []File) error
+}
+
+// validator matches nginx.Validator
+type validator interface {
+	Validate(ctx context.Context) error
+}
+
+// reloader matches nginx.Reloader
+type reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// Local applies configs to the nginx running next to the proxy
+// Files are already in place, so only validation and reload are needed
+type Local struct {
+	val    validator
+	reload reloader
+}
+
+// NewLocal creates a target for the local nginx
+func NewLocal(val validator, reload reloader) *Local {
+	return &Local{val: val, reload: reload}
+}
+
+// Name returns the target name used in logs
+func (l *Local) Name() string {
+	return "local"
+}
+
+// Apply validates and reloads the local nginx
+func (l *Local) Apply(ctx context.Context, _ []File) error {
+	if err := l.val.Validate(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	if err := l.reload.Reload(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrReload, err)
+	}
+	return nil
+}
+
+// LocalCopy writes configs to other paths on this host, for a second nginx
+// instance with its own conf dir, then validates and reloads that instance
+// A failed validation restores the previous files of the instance
+type LocalCopy struct {
+	name   string
+	paths  map[string]string // kind -> path for this instance
+	val    validator
+	reload reloader
+	log    *lgr.Logger
+}
+
+// NewLocalCopy creates a target for a local nginx instance with its own paths
+func NewLocalCopy(name string, paths map[string]string, val validator, reload reloader, log *lgr.Logger) *LocalCopy {
+	return &LocalCopy{name: name, paths: paths, val: val, reload: reload, log: log}
+}
+
+// Name returns the target name used in logs
+func (l *LocalCopy) Name() string {
+	return l.name
+}
+
+// Apply copies the files into place, validates and reloads
+func (l *LocalCopy) Apply(ctx context.Context, files []File) error {
+	contents := make(map[string][]byte, len(files))
+	for _, file := range files {
+		path, ok := l.paths[file.Kind]
+		if !ok || path == "" {
+			continue
+		}
+		contents[path] = file.Content
+	}
+
+	previous, changed, err := replaceFiles(contents)
+	if err != nil {
+		restoreFiles(previous, l.log)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := l.val.Validate(ctx); err != nil {
+		restoreFiles(previous, l.log)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	if err := l.reload.Reload(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrReload, err)
+	}
+	return nil
+}
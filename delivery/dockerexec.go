@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// containerExec matches the docker.Client file copy and exec helpers
+type containerExec interface {
+	CopyFile(ctx context.Context, containerName, dstPath string, content []byte) error
+	Exec(ctx context.Context, containerName string, cmd []string) (string, int, error)
+}
+
+// DockerExec delivers configs into an nginx container through the Docker API
+// and runs validation and reload with docker exec
+type DockerExec struct {
+	container   string
+	docker      containerExec
+	paths       map[string]string // kind -> path inside the container
+	validateCmd []string
+	reloadCmd   []string
+	log         *lgr.Logger
+}
+
+// NewDockerExec creates a target for an nginx container
+func NewDockerExec(container string, docker containerExec, paths map[string]string,
+	validateCmd, reloadCmd []string, log *lgr.Logger) *DockerExec {
+	return &DockerExec{
+		container:   container,
+		docker:      docker,
+		paths:       paths,
+		validateCmd: validateCmd,
+		reloadCmd:   reloadCmd,
+		log:         log,
+	}
+}
+
+// Name returns the target name used in logs
+func (d *DockerExec) Name() string {
+	return "docker://" + d.container
+}
+
+// Apply copies the files into the container, validates and reloads
+func (d *DockerExec) Apply(ctx context.Context, files []File) error {
+	for _, file := range files {
+		path, ok := d.paths[file.Kind]
+		if !ok || path == "" {
+			continue
+		}
+		if err := d.docker.CopyFile(ctx, d.container, path, file.Content); err != nil {
+			return err
+		}
+	}
+
+	if err := d.exec(ctx, d.validateCmd); err != nil {
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	if err := d.exec(ctx, d.reloadCmd); err != nil {
+		return fmt.Errorf("%w: %w", ErrReload, err)
+	}
+
+	d.log.Logf("INFO [DockerExec] reload successful container=%s", d.container)
+	return nil
+}
+
+func (d *DockerExec) exec(ctx context.Context, cmd []string) error {
+	out, code, err := d.docker.Exec(ctx, d.container, cmd)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("%v exited with code %d\nOutput: %s", cmd, code, out)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Result is the outcome of applying configs to one target
+type Result struct {
+	Target   string
+	Err      error
+	Duration time.Duration
+	Skipped  bool // not attempted after an earlier failure with StopOnError
+}
+
+// FanOut applies the same configs to several targets in sequence,
+// e.g. both nginx instances of an HA pair behind a VIP
+// Targets are reloaded one at a time so at least one instance keeps serving
+type FanOut struct {
+	targets     []Target
+	stopOnError bool
+	log         *lgr.Logger
+
+	mu   sync.Mutex
+	last []Result
+}
+
+// NewFanOut creates a fan-out target
+// With stopOnError the remaining targets are skipped after the first failure, which keeps
+// them on the previous configs when a change is rejected, otherwise all targets are tried
+func NewFanOut(targets []Target, stopOnError bool, log *lgr.Logger) *FanOut {
+	return &FanOut{targets: targets, stopOnError: stopOnError, log: log}
+}
+
+// Name returns the target name used in logs
+func (f *FanOut) Name() string {
+	names := make([]string, 0, len(f.targets))
+	for _, t := range f.targets {
+		names = append(names, t.Name())
+	}
+	return "fanout(" + strings.Join(names, ",") + ")"
+}
+
+// Apply applies configs to every target in order and reports per-target status
+// Returns an error if any target failed, the pipeline then retries on the next event
+func (f *FanOut) Apply(ctx context.Context, files []File) error {
+	results := make([]Result, 0, len(f.targets))
+	var errs []error
+
+	for _, target := range f.targets {
+		if ctx.Err() != nil || (f.stopOnError && len(errs) > 0) {
+			results = append(results, Result{Target: target.Name(), Skipped: true})
+			f.log.Logf("WARN [FanOut] target=%s status=skipped", target.Name())
+			continue
+		}
+
+		start := time.Now()
+		err := target.Apply(ctx, files)
+		result := Result{Target: target.Name(), Err: err, Duration: time.Since(start)}
+		results = append(results, result)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name(), err))
+			f.log.Logf("ERROR [FanOut] target=%s status=failed duration=%s error=%q", target.Name(), result.Duration, err)
+			continue
+		}
+		f.log.Logf("INFO [FanOut] target=%s status=ok duration=%s", target.Name(), result.Duration)
+	}
+
+	f.mu.Lock()
+	f.last = results
+	f.mu.Unlock()
+
+	applied := 0
+	for _, r := range results {
+		if !r.Skipped && r.Err == nil {
+			applied++
+		}
+	}
+	f.log.Logf("INFO [FanOut] targets=%d applied=%d failed=%d", len(f.targets), applied, len(errs))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d targets failed: %w", len(errs), len(f.targets), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Results returns the per-target outcome of the last Apply
+func (f *FanOut) Results() []Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Result(nil), f.last...)
+}
+
+// Status returns the outcome of a result: ok, failed or skipped
+func (r Result) Status() string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Err != nil:
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+// Summary returns the per-target status of the last Apply, e.g. "local=ok,nginx-b=failed"
+func (f *FanOut) Summary() string {
+	results := f.Results()
+	statuses := make([]string, 0, len(results))
+	for _, r := range results {
+		statuses = append(statuses, r.Target+"="+r.Status())
+	}
+	return strings.Join(statuses, ",")
+}
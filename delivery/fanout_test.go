@@ -0,0 +1,101 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+type stubTarget struct {
+	name    string
+	err     error
+	applied int
+}
+
+func (s *stubTarget) Name() string { return s.name }
+
+func (s *stubTarget) Apply(context.Context, []File) error {
+	s.applied++
+	return s.err
+}
+
+func TestFanOut(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopOnError bool
+		wantApplied []int
+		wantSkipped []bool
+		wantSummary string
+	}{
+		{name: "continue after failure", stopOnError: false, wantApplied: []int{1, 1, 1}, wantSkipped: []bool{false, false, false},
+			wantSummary: "a=ok,b=failed,c=ok"},
+		{name: "stop on error", stopOnError: true, wantApplied: []int{1, 1, 0}, wantSkipped: []bool{false, false, true},
+			wantSummary: "a=ok,b=failed,c=skipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := []*stubTarget{
+				{name: "a"},
+				{name: "b", err: errors.New("nginx -t failed")},
+				{name: "c"},
+			}
+			fanOut := NewFanOut([]Target{targets[0], targets[1], targets[2]}, tt.stopOnError, lgr.New())
+
+			err := fanOut.Apply(context.Background(), nil)
+			if err == nil {
+				t.Fatal("expected error for partial failure")
+			}
+
+			results := fanOut.Results()
+			for i, target := range targets {
+				if target.applied != tt.wantApplied[i] {
+					t.Errorf("target %s applied %d times, want %d", target.name, target.applied, tt.wantApplied[i])
+				}
+				if results[i].Skipped != tt.wantSkipped[i] {
+					t.Errorf("target %s skipped = %v, want %v", target.name, results[i].Skipped, tt.wantSkipped[i])
+				}
+			}
+			if results[1].Err == nil {
+				t.Error("expected failure recorded for target b")
+			}
+			if summary := fanOut.Summary(); summary != tt.wantSummary {
+				t.Errorf("Summary() = %q, want %q", summary, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestLocalCopy(t *testing.T) {
+	dir := t.TempDir()
+	streamPath := filepath.Join(dir, "proxy.conf")
+	nginx := &fakeNginx{}
+	target := NewLocalCopy("nginx-b", map[string]string{KindStream: streamPath}, nginx, nginx, lgr.New())
+
+	files := []File{
+		{Kind: KindStream, Content: []byte("stream v1")},
+		{Kind: KindHTTP, Content: []byte("http v1")}, // no path for this instance, ignored
+	}
+	if err := target.Apply(context.Background(), files); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	assertFile(t, streamPath, "stream v1")
+
+	// unchanged content does not reload again
+	if err := target.Apply(context.Background(), files); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if nginx.reloads != 1 {
+		t.Errorf("reloads = %d, want 1", nginx.reloads)
+	}
+
+	nginx.validateErr = errors.New("bad config")
+	files[0].Content = []byte("stream v2")
+	if err := target.Apply(context.Background(), files); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Apply() error = %v, want ErrValidation", err)
+	}
+	assertFile(t, streamPath, "stream v1")
+}
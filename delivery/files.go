@@ -0,0 +1,65 @@
+package delivery
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// replaceFiles writes files keyed by path, skipping files with identical content
+// Returns the previous content of replaced files (nil for files that did not exist)
+// so a failed apply can be rolled back with restoreFiles
+func replaceFiles(files map[string][]byte) (map[string][]byte, bool, error) {
+	previous := make(map[string][]byte, len(files))
+	changed := false
+
+	for path, content := range files {
+		// #nosec G304 -- path is from trusted configuration, not user input
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return previous, false, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err == nil && bytes.Equal(old, content) {
+			continue
+		}
+
+		previous[path] = old
+		if err := writeFile(path, content); err != nil {
+			return previous, false, err
+		}
+		changed = true
+	}
+	return previous, changed, nil
+}
+
+// restoreFiles puts back the previous files after a failed apply
+func restoreFiles(previous map[string][]byte, log *lgr.Logger) {
+	for path, content := range previous {
+		var err error
+		if content == nil {
+			err = os.Remove(path)
+		} else {
+			err = writeFile(path, content)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Logf("ERROR [Delivery] failed to restore path=%s error=%q", path, err)
+		}
+	}
+}
+
+// writeFile writes data to a temp file in the same directory and renames it into place
+func writeFile(path string, data []byte) error {
+	tmpFile := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	// #nosec G306 -- nginx config files need 0644 to be readable by nginx process
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		_ = os.Remove(tmpFile) //nolint:errcheck // best effort cleanup
+		return fmt.Errorf("failed to rename %s: %w", path, err)
+	}
+	return nil
+}
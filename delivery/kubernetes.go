@@ -0,0 +1,225 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// in-cluster service account defaults
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// ConfigHashAnnotation is bumped on the deployment pod template to trigger a rollout
+	ConfigHashAnnotation = "proxy.moontechs.com/config-hash"
+)
+
+// KubernetesConfig describes the ConfigMap or Secret receiving the configs
+type KubernetesConfig struct {
+	APIServer  string // default: in-cluster https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT
+	TokenPath  string // default: service account token
+	CAPath     string // default: service account CA, empty system roots when APIServer is set
+	Namespace  string // default: service account namespace
+	Kind       string // "configmap" or "secret"
+	Name       string
+	Deployment string // deployment bumped after an update (empty skips the rollout)
+}
+
+// Kubernetes writes configs into a ConfigMap or Secret through the Kubernetes API
+// Files are stored under their base names, matching the paths of the mounting nginx
+type Kubernetes struct {
+	cfg    KubernetesConfig
+	client *http.Client
+	log    *lgr.Logger
+}
+
+// NewKubernetes creates a Kubernetes delivery target
+func NewKubernetes(cfg KubernetesConfig, log *lgr.Logger) (*Kubernetes, error) {
+	if cfg.Kind != "configmap" && cfg.Kind != "secret" {
+		return nil, fmt.Errorf("invalid kubernetes kind %q, expected configmap or secret", cfg.Kind)
+	}
+	if cfg.Name == "" {
+		return nil, errors.New("kubernetes target requires a name")
+	}
+
+	if cfg.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("not running in a cluster, set the kubernetes API server explicitly")
+		}
+		cfg.APIServer = "https://" + net.JoinHostPort(host, port)
+		if cfg.CAPath == "" {
+			cfg.CAPath = filepath.Join(serviceAccountDir, "ca.crt")
+		}
+	}
+	cfg.APIServer = strings.TrimSuffix(cfg.APIServer, "/")
+	if cfg.TokenPath == "" {
+		cfg.TokenPath = filepath.Join(serviceAccountDir, "token")
+	}
+	if cfg.Namespace == "" {
+		// #nosec G304 -- fixed service account path
+		ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes namespace not set and not readable from service account: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAPath != "" {
+		// #nosec G304 -- CA path is from trusted configuration
+		ca, err := os.ReadFile(cfg.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kubernetes CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Kubernetes{
+		cfg:    cfg,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		log:    log,
+	}, nil
+}
+
+// Name returns the target name used in logs
+func (k *Kubernetes) Name() string {
+	return "kubernetes://" + k.cfg.Namespace + "/" + k.cfg.Kind + "/" + k.cfg.Name
+}
+
+// Apply writes the files into the ConfigMap/Secret, creating it if missing,
+// and bumps the deployment annotation so nginx pods pick up the new configs
+func (k *Kubernetes) Apply(ctx context.Context, files []File) error {
+	obj := k.object(files)
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", k.cfg.Kind, err)
+	}
+
+	collection := fmt.Sprintf("/api/v1/namespaces/%s/%ss", k.cfg.Namespace, k.cfg.Kind)
+	status, detail, err := k.request(ctx, http.MethodPatch, collection+"/"+k.cfg.Name, "application/merge-patch+json", body)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		k.log.Logf("INFO [Kubernetes] creating %s namespace=%s name=%s", k.cfg.Kind, k.cfg.Namespace, k.cfg.Name)
+		if status, detail, err = k.request(ctx, http.MethodPost, collection, "application/json", body); err != nil {
+			return err
+		}
+	}
+	if status/100 != 2 {
+		return fmt.Errorf("update of %s %s failed: %s", k.cfg.Kind, k.cfg.Name, detail)
+	}
+	k.log.Logf("INFO [Kubernetes] updated %s namespace=%s name=%s files=%d", k.cfg.Kind, k.cfg.Namespace, k.cfg.Name, len(files))
+
+	if k.cfg.Deployment == "" {
+		return nil
+	}
+	return k.rollout(ctx, files)
+}
+
+// object builds the ConfigMap/Secret body, used for both merge patch and create
+func (k *Kubernetes) object(files []File) map[string]any {
+	obj := map[string]any{
+		"apiVersion": "v1",
+		"metadata":   map[string]any{"name": k.cfg.Name, "namespace": k.cfg.Namespace},
+	}
+
+	if k.cfg.Kind == "secret" {
+		obj["kind"] = "Secret"
+		data := make(map[string][]byte, len(files)) // []byte is base64 encoded by encoding/json
+		for _, f := range files {
+			data[filepath.Base(f.LocalPath)] = f.Content
+		}
+		obj["data"] = data
+		return obj
+	}
+
+	obj["kind"] = "ConfigMap"
+	data := make(map[string]string, len(files))
+	for _, f := range files {
+		data[filepath.Base(f.LocalPath)] = string(f.Content)
+	}
+	obj["data"] = data
+	return obj
+}
+
+// rollout sets the config hash annotation on the pod template, which restarts pods only when configs differ
+func (k *Kubernetes) rollout(ctx context.Context, files []File) error {
+	sorted := append([]File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LocalPath < sorted[j].LocalPath })
+	var all bytes.Buffer
+	for _, f := range sorted {
+		all.WriteString(f.LocalPath)
+		all.Write(f.Content)
+	}
+	hash := sha256Hex(all.Bytes())[:16]
+
+	patch := map[string]any{"spec": map[string]any{"template": map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{ConfigHashAnnotation: hash}},
+	}}}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode deployment patch: %w", err)
+	}
+
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/%s", k.cfg.Namespace, k.cfg.Deployment)
+	status, detail, err := k.request(ctx, http.MethodPatch, path, "application/merge-patch+json", body)
+	if err != nil {
+		return err
+	}
+	if status/100 != 2 {
+		return fmt.Errorf("rollout of deployment %s failed: %s", k.cfg.Deployment, detail)
+	}
+
+	k.log.Logf("INFO [Kubernetes] rollout triggered deployment=%s config_hash=%s", k.cfg.Deployment, hash)
+	return nil
+}
+
+// request sends an authenticated API request and returns the status code,
+// with the response body as detail for non-2xx responses
+func (k *Kubernetes) request(ctx context.Context, method, path, contentType string, body []byte) (int, string, error) {
+	// tokens are rotated by the kubelet, read on every request
+	// #nosec G304 -- token path is from trusted configuration
+	token, err := os.ReadFile(k.cfg.TokenPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read kubernetes token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, k.cfg.APIServer+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("kubernetes %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, responseError(resp), nil
+	}
+	return resp.StatusCode, "", nil
+}
@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestKubernetesApply(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		bodies   = map[string]map[string]any{}
+		exists   bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		var body map[string]any
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		bodies[r.Method+" "+r.URL.Path] = body
+
+		switch {
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/namespaces/edge/configmaps/nginx-proxy" && !exists:
+			http.NotFound(w, r)
+		case r.Method == http.MethodPost:
+			exists = true
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := NewKubernetes(KubernetesConfig{
+		APIServer:  srv.URL,
+		TokenPath:  tokenPath,
+		Namespace:  "edge",
+		Kind:       "configmap",
+		Name:       "nginx-proxy",
+		Deployment: "nginx",
+	}, lgr.New())
+	if err != nil {
+		t.Fatalf("NewKubernetes() error = %v", err)
+	}
+
+	files := []File{
+		{Kind: KindStream, LocalPath: "/etc/nginx/conf.d/proxy.conf", Content: []byte("stream {}")},
+		{Kind: KindHTTP, LocalPath: "/etc/nginx/conf.d/http-proxy.conf", Content: []byte("server {}")},
+	}
+	if err := target.Apply(context.Background(), files); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []string{
+		"PATCH /api/v1/namespaces/edge/configmaps/nginx-proxy",
+		"POST /api/v1/namespaces/edge/configmaps",
+		"PATCH /apis/apps/v1/namespaces/edge/deployments/nginx",
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %v, want %v", requests, want)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i, requests[i], want[i])
+		}
+	}
+
+	data, _ := bodies["POST /api/v1/namespaces/edge/configmaps"]["data"].(map[string]any)
+	if data["proxy.conf"] != "stream {}" || data["http-proxy.conf"] != "server {}" {
+		t.Errorf("unexpected configmap data %v", data)
+	}
+
+	// second apply updates in place
+	requests = nil
+	if err := target.Apply(context.Background(), files); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(requests) != 2 || requests[0] != want[0] {
+		t.Errorf("requests = %v, want patch and rollout", requests)
+	}
+}
+
+func TestNewKubernetes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  KubernetesConfig
+	}{
+		{name: "invalid kind", cfg: KubernetesConfig{APIServer: "http://api", Namespace: "edge", Kind: "pod", Name: "x"}},
+		{name: "missing name", cfg: KubernetesConfig{APIServer: "http://api", Namespace: "edge", Kind: "secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKubernetes(tt.cfg, lgr.New()); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// manifestKey points at the latest published version
+const manifestKey = "manifest.json"
+
+// Manifest describes one published config version
+type Manifest struct {
+	Version     string         `json:"version"`
+	PublishedAt time.Time      `json:"published_at"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestFile is one config file in a published version
+type ManifestFile struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+}
+
+// ObjectStore publishes configs to a bucket for edge nodes running `proxy pull`
+// Every publish writes an immutable versions/<version>/ directory and then
+// replaces the manifest, so pullers never see a half-written version
+// Configs are validated by the nginx next to the hub first, a rejected version is not published
+type ObjectStore struct {
+	bucket Bucket
+	name   string
+	val    validator
+	log    *lgr.Logger
+	now    func() time.Time
+}
+
+// NewObjectStore creates a publishing target, name is used in logs
+func NewObjectStore(bucket Bucket, name string, val validator, log *lgr.Logger) *ObjectStore {
+	return &ObjectStore{bucket: bucket, name: name, val: val, log: log, now: time.Now}
+}
+
+// Name returns the target name used in logs
+func (o *ObjectStore) Name() string {
+	return o.name
+}
+
+// Apply validates the files written by the generator, then uploads them as a new version
+// and points the manifest at it
+func (o *ObjectStore) Apply(ctx context.Context, files []File) error {
+	if err := o.val.Validate(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+
+	now := o.now().UTC()
+	manifest := Manifest{Version: now.Format("20060102T150405.000000000Z"), PublishedAt: now}
+
+	for _, file := range files {
+		key := fmt.Sprintf("versions/%s/%s.conf", manifest.Version, file.Kind)
+		if err := o.bucket.Put(ctx, key, file.Content); err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{Kind: file.Kind, Key: key, SHA256: sha256Hex(file.Content)})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := o.bucket.Put(ctx, manifestKey, data); err != nil {
+		return fmt.Errorf("manifest upload failed: %w", err)
+	}
+
+	o.log.Logf("INFO [ObjectStore] published target=%s version=%s files=%d", o.name, manifest.Version, len(files))
+	return nil
+}
+
+// Puller fetches the latest published version and applies it to the local nginx
+type Puller struct {
+	bucket  Bucket
+	paths   map[string]string // kind -> local path
+	val     validator
+	reload  reloader
+	log     *lgr.Logger
+	version string // last applied version
+}
+
+// NewPuller creates a puller writing each config kind to the given local path
+func NewPuller(bucket Bucket, paths map[string]string, val validator, reload reloader, log *lgr.Logger) *Puller {
+	return &Puller{bucket: bucket, paths: paths, val: val, reload: reload, log: log}
+}
+
+// Pull applies the latest version if it differs from the local configs
+// On validation failure the previous files are restored and nginx is not reloaded
+func (p *Puller) Pull(ctx context.Context) (bool, error) {
+	data, err := p.bucket.Get(ctx, manifestKey)
+	if errors.Is(err, ErrNotFound) {
+		p.log.Logf("INFO [Pull] nothing published yet")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return false, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version == p.version {
+		p.log.Logf("DEBUG [Pull] version unchanged version=%s", manifest.Version)
+		return false, nil
+	}
+
+	files, err := p.download(ctx, manifest)
+	if err != nil {
+		return false, err
+	}
+
+	previous, changed, err := replaceFiles(files)
+	if err != nil {
+		restoreFiles(previous, p.log)
+		return false, err
+	}
+	if !changed {
+		p.log.Logf("INFO [Pull] configs unchanged version=%s", manifest.Version)
+		p.version = manifest.Version
+		return false, nil
+	}
+
+	if err := p.val.Validate(ctx); err != nil {
+		restoreFiles(previous, p.log)
+		return false, fmt.Errorf("%w for version %s: %w", ErrValidation, manifest.Version, err)
+	}
+	if err := p.reload.Reload(ctx); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrReload, err)
+	}
+
+	p.version = manifest.Version
+	p.log.Logf("INFO [Pull] applied version=%s", manifest.Version)
+	return true, nil
+}
+
+// download fetches and verifies the files of a manifest, keyed by local path
+func (p *Puller) download(ctx context.Context, manifest Manifest) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(manifest.Files))
+	for _, mf := range manifest.Files {
+		localPath, ok := p.paths[mf.Kind]
+		if !ok {
+			p.log.Logf("WARN [Pull] skipping unknown config kind=%s key=%s", mf.Kind, mf.Key)
+			continue
+		}
+
+		content, err := p.bucket.Get(ctx, mf.Key)
+		if err != nil {
+			return nil, err
+		}
+		if sha256Hex(content) != mf.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", mf.Key)
+		}
+		files[localPath] = content
+	}
+	return files, nil
+}
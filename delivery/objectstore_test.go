@@ -0,0 +1,153 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+type memBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *memBucket) Put(_ context.Context, key string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.objects == nil {
+		b.objects = map[string][]byte{}
+	}
+	b.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memBucket) Get(_ context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("get %s: %w", key, ErrNotFound)
+	}
+	return data, nil
+}
+
+type fakeNginx struct {
+	validateErr error
+	reloads     int
+}
+
+func (f *fakeNginx) Validate(context.Context) error { return f.validateErr }
+func (f *fakeNginx) Reload(context.Context) error   { f.reloads++; return nil }
+
+func TestObjectStorePull(t *testing.T) {
+	log := lgr.New()
+	ctx := context.Background()
+	dir := t.TempDir()
+	streamPath := filepath.Join(dir, "proxy.conf")
+	httpPath := filepath.Join(dir, "http-proxy.conf")
+
+	bucket := &memBucket{}
+	hub := &fakeNginx{}
+	publisher := NewObjectStore(bucket, "test", hub, log)
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	publisher.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	nginx := &fakeNginx{}
+	puller := NewPuller(bucket, map[string]string{KindStream: streamPath, KindHTTP: httpPath}, nginx, nginx, log)
+
+	t.Run("nothing published", func(t *testing.T) {
+		changed, err := puller.Pull(ctx)
+		if err != nil || changed {
+			t.Fatalf("Pull() = %v, %v, want false, nil", changed, err)
+		}
+	})
+
+	t.Run("applies published version", func(t *testing.T) {
+		err := publisher.Apply(ctx, []File{
+			{Kind: KindStream, Content: []byte("stream v1")},
+			{Kind: KindHTTP, Content: []byte("http v1")},
+		})
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+
+		changed, err := puller.Pull(ctx)
+		if err != nil || !changed {
+			t.Fatalf("Pull() = %v, %v, want true, nil", changed, err)
+		}
+		assertFile(t, streamPath, "stream v1")
+		assertFile(t, httpPath, "http v1")
+		if nginx.reloads != 1 {
+			t.Errorf("reloads = %d, want 1", nginx.reloads)
+		}
+
+		// same version again is a no-op
+		if changed, _ := puller.Pull(ctx); changed {
+			t.Error("second pull of the same version should not change anything")
+		}
+	})
+
+	t.Run("invalid version is rolled back", func(t *testing.T) {
+		err := publisher.Apply(ctx, []File{
+			{Kind: KindStream, Content: []byte("stream v2")},
+			{Kind: KindHTTP, Content: []byte("http v1")},
+		})
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+
+		nginx.validateErr = errors.New("bad config")
+		if _, err := puller.Pull(ctx); err == nil {
+			t.Fatal("expected validation error")
+		}
+		assertFile(t, streamPath, "stream v1")
+		if nginx.reloads != 1 {
+			t.Errorf("reloads = %d, want 1", nginx.reloads)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		nginx.validateErr = nil
+		for key := range bucket.objects {
+			if key != manifestKey {
+				bucket.objects[key] = []byte("tampered")
+			}
+		}
+		if _, err := puller.Pull(ctx); err == nil {
+			t.Fatal("expected checksum error")
+		}
+		assertFile(t, streamPath, "stream v1")
+	})
+
+	t.Run("configs rejected by the hub are not published", func(t *testing.T) {
+		hub.validateErr = errors.New("bad config")
+		published := len(bucket.objects)
+		manifest := string(bucket.objects[manifestKey])
+
+		err := publisher.Apply(ctx, []File{{Kind: KindStream, Content: []byte("stream v3")}})
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("Apply() error = %v, want ErrValidation", err)
+		}
+		if len(bucket.objects) != published || string(bucket.objects[manifestKey]) != manifest {
+			t.Error("a rejected version was uploaded")
+		}
+	})
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", path, data, want)
+	}
+}
@@ -0,0 +1,216 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist in the bucket
+var ErrNotFound = errors.New("object not found")
+
+// Bucket stores and fetches objects by key
+type Bucket interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// S3Credentials are the static credentials used to sign requests
+// Empty AccessKey sends unsigned requests (public buckets, local test servers)
+type S3Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// S3Bucket is a minimal client for S3-compatible storage (AWS S3, GCS interoperability
+// API, MinIO, R2) using path-style requests signed with AWS Signature Version 4
+type S3Bucket struct {
+	endpoint *url.URL // scheme and host
+	bucket   string
+	prefix   string
+	region   string
+	creds    S3Credentials
+	client   *http.Client
+}
+
+// NewS3Bucket creates a bucket client from a URL like https://s3.amazonaws.com/bucket/prefix
+func NewS3Bucket(rawURL, region string, creds S3Credentials) (*S3Bucket, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid object store url %q, expected http(s)://endpoint/bucket[/prefix]", rawURL)
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("object store url %q has no bucket", rawURL)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Bucket{
+		endpoint: &url.URL{Scheme: u.Scheme, Host: u.Host},
+		bucket:   bucket,
+		prefix:   prefix,
+		region:   region,
+		creds:    creds,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// String returns the bucket location used in logs
+func (b *S3Bucket) String() string {
+	return b.endpoint.String() + "/" + b.objectPath("")
+}
+
+// Put uploads an object
+func (b *S3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("put %s failed: %s", key, responseError(resp))
+	}
+	return nil
+}
+
+// Get downloads an object, returns ErrNotFound for missing keys
+func (b *S3Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("get %s: %w", key, ErrNotFound)
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("get %s failed: %s", key, responseError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (b *S3Bucket) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = "/" + b.objectPath(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if b.creds.AccessKey != "" {
+		b.sign(req, body, time.Now())
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+func (b *S3Bucket) objectPath(key string) string {
+	parts := []string{b.bucket}
+	if b.prefix != "" {
+		parts = append(parts, b.prefix)
+	}
+	if key != "" {
+		parts = append(parts, key)
+	}
+	return strings.Join(parts, "/")
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (b *S3Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if b.creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", b.creds.SessionToken)
+	}
+
+	// headers must be sorted by name
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if b.creds.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = b.creds.SessionToken
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.creds.SecretKey), date)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.creds.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data)) //nolint:errcheck // hash writes never fail
+	return mac.Sum(nil)
+}
+
+func responseError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // best effort error detail
+	return fmt.Sprintf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,82 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewS3Bucket(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "bucket with prefix", url: "https://s3.example.com/configs/edge", want: "https://s3.example.com/configs/edge"},
+		{name: "bucket only", url: "http://minio:9000/configs/", want: "http://minio:9000/configs"},
+		{name: "missing bucket", url: "https://s3.example.com/", wantErr: true},
+		{name: "unsupported scheme", url: "s3://configs/edge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, err := NewS3Bucket(tt.url, "", S3Credentials{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewS3Bucket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && bucket.String() != tt.want {
+				t.Errorf("String() = %s, want %s", bucket.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Bucket(t *testing.T) {
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "missing signature", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	bucket, err := NewS3Bucket(srv.URL+"/configs/edge", "eu-west-1", S3Credentials{AccessKey: "AKID", SecretKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewS3Bucket() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := bucket.Put(ctx, "manifest.json", []byte(`{}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, ok := objects["/configs/edge/manifest.json"]; !ok {
+		t.Errorf("object stored under unexpected path: %v", objects)
+	}
+
+	data, err := bucket.Get(ctx, "manifest.json")
+	if err != nil || string(data) != `{}` {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+
+	if _, err := bucket.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,185 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig describes a remote nginx host reachable over SSH
+type SSHConfig struct {
+	Addr            string            // host:port, port defaults to 22
+	User            string            // login user
+	KeyPath         string            // private key for authentication
+	KnownHostsPath  string            // known_hosts file for host key verification
+	InsecureHostKey bool              // skip host key verification (testing only)
+	RemotePaths     map[string]string // local path -> remote path, missing entries keep the local path
+	ValidateCmd     string            // remote validation command (default: nginx -t)
+	ReloadCmd       string            // remote reload command (default: nginx -s reload)
+}
+
+// SSH uploads configs to a remote host and runs validation and reload there
+type SSH struct {
+	cfg     SSHConfig
+	sshConf *ssh.ClientConfig
+	log     *lgr.Logger
+}
+
+// NewSSH creates an SSH delivery target with key-based authentication
+func NewSSH(cfg SSHConfig, log *lgr.Logger) (*SSH, error) {
+	if cfg.Addr == "" || cfg.User == "" {
+		return nil, errors.New("ssh target requires address and user")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		cfg.Addr = net.JoinHostPort(cfg.Addr, "22")
+	}
+	if cfg.ValidateCmd == "" {
+		cfg.ValidateCmd = "nginx -t"
+	}
+	if cfg.ReloadCmd == "" {
+		cfg.ReloadCmd = "nginx -s reload"
+	}
+
+	// #nosec G304 -- key path is from trusted configuration
+	key, err := os.ReadFile(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.InsecureHostKey:
+		log.Logf("WARN [SSH] host key verification disabled target=%s", cfg.Addr)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey() // #nosec G106 -- explicitly requested by configuration
+	case cfg.KnownHostsPath != "":
+		hostKeyCallback, err = knownhosts.New(cfg.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+	default:
+		return nil, errors.New("ssh target requires a known_hosts file")
+	}
+
+	return &SSH{
+		cfg: cfg,
+		sshConf: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+		log: log,
+	}, nil
+}
+
+// Name returns the target name used in logs
+func (s *SSH) Name() string {
+	return "ssh://" + s.cfg.User + "@" + s.cfg.Addr
+}
+
+// Apply uploads all files, then validates and reloads the remote nginx
+func (s *SSH) Apply(ctx context.Context, files []File) error {
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, file := range files {
+		remotePath := s.remotePath(file.LocalPath)
+		if err := s.upload(ctx, client, remotePath, file.Content); err != nil {
+			return fmt.Errorf("upload of %s failed: %w", remotePath, err)
+		}
+		s.log.Logf("INFO [SSH] uploaded target=%s path=%s size=%d", s.cfg.Addr, remotePath, len(file.Content))
+	}
+
+	if out, err := s.run(ctx, client, s.cfg.ValidateCmd, nil); err != nil {
+		return fmt.Errorf("remote %w: %w\nOutput: %s", ErrValidation, err, out)
+	}
+	if out, err := s.run(ctx, client, s.cfg.ReloadCmd, nil); err != nil {
+		return fmt.Errorf("remote %w: %w\nOutput: %s", ErrReload, err, out)
+	}
+
+	s.log.Logf("INFO [SSH] remote reload successful target=%s", s.cfg.Addr)
+	return nil
+}
+
+func (s *SSH) dial(ctx context.Context) (*ssh.Client, error) {
+	dialer := net.Dialer{Timeout: s.sshConf.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("ssh dial %s failed: %w", s.cfg.Addr, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.cfg.Addr, s.sshConf)
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck // handshake already failed
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", s.cfg.Addr, err)
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// upload writes content to a temp file next to remotePath and renames it into place
+func (s *SSH) upload(ctx context.Context, client *ssh.Client, remotePath string, content []byte) error {
+	tmpPath := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".tmp")
+	script := fmt.Sprintf("cat > %s && mv %s %s", shellQuote(tmpPath), shellQuote(tmpPath), shellQuote(remotePath))
+
+	if out, err := s.run(ctx, client, script, content); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+// run executes a remote command, closing the session if ctx is cancelled
+func (s *SSH) run(ctx context.Context, client *ssh.Client, command string, stdin []byte) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("ssh session failed: %w", err)
+	}
+	defer session.Close()
+
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = session.Close() //nolint:errcheck // aborting on cancellation
+		case <-done:
+		}
+	}()
+
+	s.log.Logf("DEBUG [SSH] running target=%s cmd=%q", s.cfg.Addr, command)
+	out, err := session.CombinedOutput(command)
+	return string(out), err
+}
+
+func (s *SSH) remotePath(localPath string) string {
+	if remote, ok := s.cfg.RemotePaths[localPath]; ok && remote != "" {
+		return remote
+	}
+	return localPath
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
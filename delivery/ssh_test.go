@@ -0,0 +1,63 @@
+package delivery
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/etc/nginx/conf.d/proxy.conf", want: `'/etc/nginx/conf.d/proxy.conf'`},
+		{in: "it's", want: `'it'\''s'`},
+		{in: "", want: `''`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := shellQuote(tt.in); got != tt.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemotePath(t *testing.T) {
+	s := &SSH{cfg: SSHConfig{RemotePaths: map[string]string{
+		"/etc/nginx/conf.d/proxy.conf":      "/srv/nginx/stream.conf",
+		"/etc/nginx/conf.d/http-proxy.conf": "",
+	}}}
+
+	if got := s.remotePath("/etc/nginx/conf.d/proxy.conf"); got != "/srv/nginx/stream.conf" {
+		t.Errorf("mapped path = %s", got)
+	}
+	if got := s.remotePath("/etc/nginx/conf.d/http-proxy.conf"); got != "/etc/nginx/conf.d/http-proxy.conf" {
+		t.Errorf("empty mapping should keep local path, got %s", got)
+	}
+}
+
+func TestNewSSH(t *testing.T) {
+	log := lgr.New()
+	missingKey := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name string
+		cfg  SSHConfig
+	}{
+		{name: "missing user", cfg: SSHConfig{Addr: "edge-1"}},
+		{name: "missing address", cfg: SSHConfig{User: "deploy"}},
+		{name: "unreadable key", cfg: SSHConfig{Addr: "edge-1", User: "deploy", KeyPath: missingKey}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSSH(tt.cfg, log); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
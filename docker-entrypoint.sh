@@ -10,6 +10,12 @@ export NGINX_WORKER_CONNECTIONS=${NGINX_WORKER_CONNECTIONS:-1000}
 echo "[Entrypoint] Configuring Nginx with NGINX_WORKER_CONNECTIONS=$NGINX_WORKER_CONNECTIONS"
 envsubst '${NGINX_WORKER_CONNECTIONS}' < /etc/nginx/nginx.conf.template > /etc/nginx/nginx.conf
 
+# In supervisor mode the proxy starts and owns nginx itself
+if [ "$1" = "run" ]; then
+    echo "[Entrypoint] Starting proxy in supervisor mode"
+    exec /usr/local/bin/proxy "$@"
+fi
+
 # Start Nginx in background
 echo "[Entrypoint] Starting Nginx"
 nginx
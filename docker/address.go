@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// address family policies, which container address upstreams use
+const (
+	AddressFamilyIPv4       = "ipv4"        // IPv4 only, IPv6-only containers are skipped
+	AddressFamilyIPv6       = "ipv6"        // IPv6 only, IPv4-only containers are skipped
+	AddressFamilyPreferIPv4 = "prefer-ipv4" // IPv4, IPv6 for IPv6-only containers (default)
+	AddressFamilyPreferIPv6 = "prefer-ipv6" // IPv6, IPv4 for IPv4-only containers
+)
+
+// ParseAddressFamily validates an address family policy, empty is AddressFamilyPreferIPv4
+func ParseAddressFamily(s string) (string, error) {
+	switch family := strings.ToLower(strings.TrimSpace(s)); family {
+	case "":
+		return AddressFamilyPreferIPv4, nil
+	case AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyPreferIPv4, AddressFamilyPreferIPv6:
+		return family, nil
+	default:
+		return "", fmt.Errorf("invalid address family %q, expected ipv4, ipv6, prefer-ipv4 or prefer-ipv6", s)
+	}
+}
+
+// SetAddressFamily sets which container addresses upstreams use, see ParseAddressFamily
+func (c *Client) SetAddressFamily(family string) {
+	c.family = family
+}
+
+// containerAddress picks the address of a container by the address family policy
+// The default bridge address comes first, then the networks by name; link-local IPv6
+// addresses are never used
+func containerAddress(settings *types.NetworkSettings, family string) (string, error) {
+	var ipv4, ipv6 string
+	if settings != nil {
+		ipv4, ipv6 = settings.IPAddress, settings.GlobalIPv6Address
+		names := make([]string, 0, len(settings.Networks))
+		for name := range settings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			network := settings.Networks[name]
+			if network == nil {
+				continue
+			}
+			if ipv4 == "" {
+				ipv4 = network.IPAddress
+			}
+			if ipv6 == "" {
+				ipv6 = network.GlobalIPv6Address
+			}
+		}
+	}
+
+	switch {
+	case ipv4 == "" && ipv6 == "":
+		return "", errNoIPAddress
+	case family == AddressFamilyIPv4 && ipv4 == "":
+		return "", fmt.Errorf("%w: only IPv6 address %s, address family is ipv4", errNoIPAddress, ipv6)
+	case family == AddressFamilyIPv6 && ipv6 == "":
+		return "", fmt.Errorf("%w: only IPv4 address %s, address family is ipv6", errNoIPAddress, ipv4)
+	case family == AddressFamilyIPv6, family == AddressFamilyPreferIPv6 && ipv6 != "", ipv4 == "":
+		return ipv6, nil
+	default:
+		return ipv4, nil
+	}
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestParseAddressFamily(t *testing.T) {
+	for input, want := range map[string]string{"": AddressFamilyPreferIPv4, " IPv6 ": AddressFamilyIPv6, "prefer-ipv6": AddressFamilyPreferIPv6} {
+		if got, err := ParseAddressFamily(input); err != nil || got != want {
+			t.Errorf("ParseAddressFamily(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseAddressFamily("inet6"); err == nil {
+		t.Error("expected an error for an unknown family")
+	}
+}
+
+func TestContainerAddress(t *testing.T) {
+	settings := func(networks map[string]*network.EndpointSettings) *types.NetworkSettings {
+		return &types.NetworkSettings{Networks: networks}
+	}
+	dualStack := settings(map[string]*network.EndpointSettings{
+		"proxy": {IPAddress: "172.18.0.5", GlobalIPv6Address: "fd00::5"},
+	})
+	ipv6Only := settings(map[string]*network.EndpointSettings{
+		"v6": {GlobalIPv6Address: "fd00::6"},
+	})
+	ipv4Only := settings(map[string]*network.EndpointSettings{
+		"b": {IPAddress: "172.19.0.2"}, "a": {IPAddress: "172.18.0.2"},
+	})
+
+	tests := []struct {
+		name     string
+		settings *types.NetworkSettings
+		family   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "dual-stack default", settings: dualStack, want: "172.18.0.5"},
+		{name: "dual-stack prefer-ipv6", settings: dualStack, family: AddressFamilyPreferIPv6, want: "fd00::5"},
+		{name: "dual-stack ipv6", settings: dualStack, family: AddressFamilyIPv6, want: "fd00::5"},
+		{name: "IPv6-only default", settings: ipv6Only, want: "fd00::6"},
+		{name: "IPv6-only ipv4", settings: ipv6Only, family: AddressFamilyIPv4, wantErr: true},
+		{name: "IPv4-only prefer-ipv6", settings: ipv4Only, family: AddressFamilyPreferIPv6, want: "172.18.0.2"},
+		{name: "IPv4-only ipv6", settings: ipv4Only, family: AddressFamilyIPv6, wantErr: true},
+		{
+			name:     "link-local only",
+			settings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{LinkLocalIPv6Address: "fe80::7"}},
+			wantErr:  true,
+		},
+		{
+			name:     "default bridge first",
+			settings: &types.NetworkSettings{DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.9"}, Networks: ipv4Only.Networks},
+			want:     "172.17.0.9",
+		},
+		{name: "no networks", settings: settings(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := containerAddress(tt.settings, tt.family)
+		if tt.wantErr {
+			if !errors.Is(err, errNoIPAddress) {
+				t.Errorf("%s: expected errNoIPAddress, got %q, %v", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: containerAddress() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// audiences of the proxy.http.host.internal and proxy.http.host.external server blocks
+const (
+	AudienceInternal = "internal"
+	AudienceExternal = "external"
+)
+
+// audienceLabelSuffixes are set per audience and cannot be combined with the audience hosts
+// Aliases would be served by both server blocks
+var audienceLabelSuffixes = []string{"host", "internal_only", "allow_from", "aliases"}
+
+// hasHTTPHost reports whether proxy.http.host or one of its audiences is set
+func hasHTTPHost(labels map[string]string) bool {
+	return labels[httpLabelPrefix+"host"] != "" || labels[httpLabelPrefix+"host."+AudienceInternal] != "" ||
+		labels[httpLabelPrefix+"host."+AudienceExternal] != ""
+}
+
+// parseHTTPAudiences parses the routes under prefix: the <prefix>host route, or one route per
+// audience of <prefix>host.internal and <prefix>host.external, external first
+// Both audiences share the other labels, the internal route is open to the internal networks only
+// and the external one must authenticate clients
+func (c *Client) parseHTTPAudiences(name, prefix string, labels map[string]string) ([]HTTPMapping, error) {
+	internalHosts := strings.TrimSpace(labels[prefix+"host."+AudienceInternal])
+	externalHosts := strings.TrimSpace(labels[prefix+"host."+AudienceExternal])
+	if internalHosts == "" && externalHosts == "" {
+		mapping, err := c.parseHTTPMapping(name, prefix, labels)
+		if err != nil || mapping == nil {
+			return nil, err
+		}
+		return []HTTPMapping{*mapping}, nil
+	}
+	for _, suffix := range audienceLabelSuffixes {
+		if _, ok := labels[prefix+suffix]; ok {
+			return nil, fmt.Errorf("%s%s cannot be combined with %shost.internal or %shost.external", prefix, suffix, prefix, prefix)
+		}
+	}
+
+	var mappings []HTTPMapping
+	for _, audience := range []struct{ name, hosts string }{{AudienceExternal, externalHosts}, {AudienceInternal, internalHosts}} {
+		if audience.hosts == "" {
+			continue
+		}
+		mapping, err := c.parseHTTPMapping(name, prefix, audienceLabels(prefix, audience.name, audience.hosts, labels))
+		if err != nil {
+			return nil, fmt.Errorf("%shost.%s: %w", prefix, audience.name, err)
+		}
+		if audience.name == AudienceExternal && mapping.AuthSecret == "" && mapping.OIDC == nil {
+			return nil, fmt.Errorf("%shost.external requires %sauth.secret or %soidc.auth_url, use %shost for a public route without authentication",
+				prefix, prefix, prefix, prefix)
+		}
+		mapping.Audience = audience.name
+		mappings = append(mappings, *mapping)
+	}
+	return mappings, nil
+}
+
+// audienceLabels returns the labels of one audience's route: its hosts as <prefix>host and its
+// hardening defaults, internal routes drop authentication and external ones block bots unless set
+func audienceLabels(prefix, audience, hosts string, labels map[string]string) map[string]string {
+	out := maps.Clone(labels)
+	delete(out, prefix+"host."+AudienceInternal)
+	delete(out, prefix+"host."+AudienceExternal)
+	out[prefix+"host"] = hosts
+	switch audience {
+	case AudienceInternal:
+		out[prefix+"internal_only"] = "true"
+		for _, suffix := range []string{"auth.secret", "oidc.auth_url", "oidc.provider", "oidc.login_url"} {
+			delete(out, prefix+suffix)
+		}
+	case AudienceExternal:
+		if _, ok := out[prefix+"block_bots"]; !ok {
+			out[prefix+"block_bots"] = "true"
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestParseHTTPAudiences(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	labels := map[string]string{
+		"proxy.http.host.internal": "nas.lan",
+		"proxy.http.host.external": "nas.example.com",
+		"proxy.http.port":          "5000",
+		"proxy.http.auth.secret":   "nas_users",
+	}
+	got, err := c.parseHTTPAudiences("nas", httpLabelPrefix, labels)
+	if err != nil {
+		t.Fatalf("parseHTTPAudiences() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("parseHTTPAudiences() = %+v, want an external and an internal route", got)
+	}
+	external, internal := got[0], got[1]
+	if external.Audience != AudienceExternal || !slices.Equal(external.Hostnames, []string{"nas.example.com"}) ||
+		external.AuthSecret != "nas_users" || !external.BlockBots || external.InternalOnly || external.ContainerPort != 5000 {
+		t.Errorf("external route = %+v, want authenticated with bots blocked", external)
+	}
+	if internal.Audience != AudienceInternal || !slices.Equal(internal.Hostnames, []string{"nas.lan"}) ||
+		internal.AuthSecret != "" || internal.BlockBots || !internal.InternalOnly || internal.ContainerPort != 5000 {
+		t.Errorf("internal route = %+v, want open to the internal networks", internal)
+	}
+
+	labels["proxy.http.block_bots"] = "false"
+	if got, err := c.parseHTTPAudiences("nas", httpLabelPrefix, labels); err != nil || got[0].BlockBots {
+		t.Errorf("parseHTTPAudiences() = %+v, %v, want block_bots=false kept on the external route", got, err)
+	}
+
+	got, err = c.parseHTTPAudiences("nas", httpLabelPrefix, map[string]string{"proxy.http.host.internal": "nas.lan"})
+	if err != nil || len(got) != 1 || got[0].Audience != AudienceInternal {
+		t.Errorf("parseHTTPAudiences() = %+v, %v, want the internal route only", got, err)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"external without auth": {"proxy.http.host.external": "nas.example.com"},
+		"combined with host":    {"proxy.http.host": "nas.example.com", "proxy.http.host.internal": "nas.lan"},
+		"combined with aliases": {"proxy.http.host.internal": "nas.lan", "proxy.http.aliases": "www.nas.lan"},
+	} {
+		if _, err := c.parseHTTPAudiences("nas", httpLabelPrefix, labels); err == nil {
+			t.Errorf("%s: parseHTTPAudiences() should fail", name)
+		}
+	}
+}
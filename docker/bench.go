@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/go-pkgz/lgr"
+)
+
+// MaxSyntheticContainers is the most containers of NewSyntheticClient, their proxy ports
+// count up from 10000
+const MaxSyntheticContainers = 50000
+
+// syntheticProfiles are the label sets cycled through by syntheticContainers
+var syntheticProfiles = []string{"web", "api", "pool", "tcp", "udp", "multi"}
+
+// syntheticContainers returns n running containers with varied proxy labels for load tests:
+// plain and hardened HTTP hosts, replicas pooled on one hostname, TCP and UDP ports and
+// containers with several routes, all valid and free of conflicts
+func syntheticContainers(n int) []types.Container {
+	containers := make([]types.Container, n)
+	for i := range containers {
+		profile := syntheticProfiles[i%len(syntheticProfiles)]
+		name := fmt.Sprintf("bench-%s-%d", profile, i)
+		labels := map[string]string{"com.docker.compose.project": "bench"}
+		switch profile {
+		case "web":
+			labels["proxy.http.host"] = name + ".bench.test"
+			labels["proxy.http.port"] = "8080"
+		case "api":
+			labels["proxy.http.host"] = name + ".bench.test"
+			labels["proxy.http.port"] = "3000"
+			labels["proxy.http.aliases"] = "www." + name + ".bench.test"
+			labels["proxy.http.allowed_methods"] = "GET,POST"
+			labels["proxy.http.max_body_size"] = "10m"
+			labels["proxy.http.limit_rate"] = "1m"
+		case "pool":
+			// three replicas of a service share each hostname
+			pool := strconv.Itoa(i / (3 * len(syntheticProfiles)))
+			labels["com.docker.compose.service"] = "pool-" + pool
+			labels["proxy.http.host"] = "pool-" + pool + ".bench.test"
+			labels["proxy.http.port"] = "8080"
+		case "tcp":
+			labels["proxy.tcp.ports"] = fmt.Sprintf("%d:5432", 10000+i)
+		case "udp":
+			labels["proxy.udp.ports"] = fmt.Sprintf("%d:53", 10000+i)
+		case "multi":
+			labels["proxy.http.routes.1.host"] = name + ".bench.test"
+			labels["proxy.http.routes.1.port"] = "3000"
+			labels["proxy.http.routes.2.host"] = "admin." + name + ".bench.test"
+			labels["proxy.http.routes.2.port"] = "9090"
+		}
+		containers[i] = types.Container{
+			ID:      fmt.Sprintf("%064x", i+1),
+			Names:   []string{"/" + name},
+			Image:   "bench/" + profile + ":1.0",
+			Labels:  labels,
+			State:   "running",
+			Created: time.Now().Unix(),
+		}
+	}
+	return containers
+}
+
+// NewSyntheticClient returns a client whose Docker API answers in memory with n containers
+// of varied proxy labels, so Scan and ListLabels run their full parsing path without a daemon
+func NewSyntheticClient(n int, log *lgr.Logger) (*Client, error) {
+	containers := syntheticContainers(n)
+	api := &syntheticDocker{containers: containers, index: make(map[string]int, len(containers))}
+	for i, ctr := range containers {
+		api.index[ctr.ID] = i
+	}
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://synthetic.invalid:2375"), client.WithVersion("1.43"),
+		client.WithHTTPClient(&http.Client{Transport: api}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return &Client{cli: cli, log: log}, nil
+}
+
+// syntheticDocker answers container list and inspect requests of the Docker API
+type syntheticDocker struct {
+	containers []types.Container
+	index      map[string]int // container ID -> index in containers
+}
+
+// RoundTrip implements http.RoundTripper
+func (d *syntheticDocker) RoundTrip(r *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1.43")
+	var body any
+	switch id, ok := strings.CutSuffix(strings.TrimPrefix(path, "/containers/"), "/json"); {
+	case path == "/containers/json":
+		body = d.containers
+	case ok && strings.HasPrefix(path, "/containers/"):
+		i, found := d.index[id]
+		if !found {
+			return syntheticResponse(r, http.StatusNotFound, map[string]string{"message": "No such container: " + id})
+		}
+		body = types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: id, Name: d.containers[i].Names[0]},
+			NetworkSettings: &types.NetworkSettings{
+				Networks: map[string]*network.EndpointSettings{"bench": {IPAddress: syntheticIP(i)}},
+			},
+		}
+	default:
+		return syntheticResponse(r, http.StatusNotFound, map[string]string{"message": "page not found"})
+	}
+	return syntheticResponse(r, http.StatusOK, body)
+}
+
+// syntheticResponse encodes body as the JSON response to r
+func syntheticResponse(r *http.Request, status int, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    r,
+	}, nil
+}
+
+// syntheticIP returns a distinct address of 10.200.0.0/16 for the i-th container
+func syntheticIP(i int) string {
+	return fmt.Sprintf("10.200.%d.%d", i/250, i%250+2)
+}
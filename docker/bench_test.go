@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestSyntheticClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewSyntheticClient(60, lgr.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Scan(ctx)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(result.Containers) != 60 || len(result.Skipped) != 0 {
+		t.Fatalf("expected 60 routed and no skipped containers, got %d and %+v", len(result.Containers), result.Skipped)
+	}
+	ips := make(map[string]bool)
+	for _, info := range result.Containers {
+		ips[info.IP] = true
+	}
+	if len(ips) != 60 {
+		t.Errorf("expected distinct IPs, got %d", len(ips))
+	}
+
+	labels, err := c.ListLabels(ctx)
+	if err != nil {
+		t.Fatalf("list labels failed: %v", err)
+	}
+	if issues := LintLabels(labels); len(issues) != 0 {
+		t.Errorf("expected valid labels, got %+v", issues)
+	}
+	pooled := 0
+	for _, claim := range ClaimMatrix(labels) {
+		switch claim.Status {
+		case ClaimPooled:
+			pooled++
+			if len(claim.Owners) != 3 {
+				t.Errorf("expected 3 replicas of %s, got %+v", claim.Name, claim.Owners)
+			}
+		case ClaimConflict, ClaimNearMiss:
+			t.Errorf("unexpected %s claim %s: %s", claim.Status, claim.Name, claim.Note)
+		}
+	}
+	if pooled != 3 {
+		t.Errorf("expected 3 pooled hostnames, got %d", pooled)
+	}
+}
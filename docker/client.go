@@ -2,9 +2,18 @@ package docker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/netip"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -16,245 +25,1658 @@ import (
 
 // Client wraps Docker API client
 type Client struct {
-	cli *client.Client
-	log *lgr.Logger
+	cli   *client.Client
+	log   *lgr.Logger
+	perms *Permissions // set by ProbePermissions
+
+	limiter *limiter      // throttles API calls, nil sends them at once, see SetAPILimits
+	observe func(APICall) // metrics of throttled calls, may be nil
+	family  string        // address family policy, empty is AddressFamilyPreferIPv4
+
+	hostMu   sync.Mutex
+	hostAddr string // address of host network containers, see SetHostAddress
+	hostIP   string // resolved host-gateway address
+}
+
+// Protocol represents the network protocol type
+type Protocol int
+
+const (
+	// TCP represents the TCP protocol
+	TCP Protocol = iota
+	// UDP represents the UDP protocol
+	UDP
+)
+
+// ContainerInfo holds parsed container information
+type ContainerInfo struct {
+	Name        string
+	ID          string
+	IP          string
+	Service     string        // compose project/service or swarm service, replicas share a hostname
+	Namespace   string        // proxy.namespace, routes are written to the namespace's own config files
+	Mappings    []PortMapping // TCP/UDP port mappings
+	HTTPMapping *HTTPMapping  // HTTP hostname routing (optional)
+	HTTPRoutes  []HTTPMapping // indexed proxy.http.routes.<n>.* routes (optional)
+	SSH         *SSHMapping   // SSH gateway aliases (optional)
+	Expires     time.Time     // proxy.expires, the routes are dropped from then on (zero never expires)
+	DependsOn   []string      // proxy.depends_on, routed only while these containers are ready
+	LabelsHash  string        // checksum of the proxy.* labels, see LabelsChecksum
+	Owner       Owner         // project, image and label source, zero for routes not read from Docker
+}
+
+// SSHMapping routes SSH gateway aliases to the container's SSH port
+type SSHMapping struct {
+	Aliases       []string // proxy.ssh.alias, the names clients send through the gateway
+	ContainerPort int      // proxy.ssh.port (default: 22)
+}
+
+// AllHTTPMappings returns the proxy.http.* mapping followed by the indexed routes
+func (c ContainerInfo) AllHTTPMappings() []HTTPMapping {
+	if c.HTTPMapping == nil {
+		return c.HTTPRoutes
+	}
+	return append([]HTTPMapping{*c.HTTPMapping}, c.HTTPRoutes...)
+}
+
+// PortMapping represents a proxy port to container port mapping with protocol
+type PortMapping struct {
+	ProxyPort     int
+	ContainerPort int
+	Protocol      Protocol
+
+	MaxConnections int // concurrent connections through the port, 0 is unlimited (TCP only)
+
+	Timeout        string // proxy_timeout of the stream server, e.g. 30m (empty keeps the default)
+	ConnectTimeout string // proxy_connect_timeout of the stream server (TCP only, empty keeps the default)
+
+	// Hash is the nginx hash key, e.g. $remote_addr; containers with the same hash on a port
+	// are pooled into one upstream with consistent hashing instead of conflicting
+	Hash string
+}
+
+// HTTPMapping represents HTTP hostname-based routing configuration
+type HTTPMapping struct {
+	Hostnames     []string // list of hostnames for this container
+	ContainerPort int      // container HTTP port
+	HTTPS         bool     // whether to listen on 443 instead of 80
+	PlainHTTP     bool     // with HTTPS, also serve on 80 without redirecting (https=both)
+
+	// secret references: file names in the secrets dir (e.g. /run/secrets)
+	// or vault:<path>#<field>, resolved to files by the generator
+	AuthSecret    string // htpasswd file for basic auth
+	TLSCertSecret string // certificate chain in PEM format
+	TLSKeySecret  string // private key in PEM format
+
+	// UpstreamAuthSecret holds the Authorization header sent to the backend, e.g. "Bearer <token>"
+	UpstreamAuthSecret string
+
+	// HostPorts overrides ContainerPort for hostnames listed as host:port
+	HostPorts map[string]int
+
+	// OIDC protects the route with single sign-on through an auth service, nil disables it
+	OIDC *OIDC
+
+	// backend TLS, for containers that only speak HTTPS
+	BackendHTTPS     bool   // proxy to the container over TLS
+	BackendSSLVerify bool   // verify the backend certificate against the system CA bundle
+	BackendSNI       string // server name sent to and verified against the backend, empty uses the request host
+
+	// UpstreamHost is the Host header sent to the backend: UpstreamHostPreserve, UpstreamHostUpstream
+	// or a name[:port]; empty sends the requested hostname
+	UpstreamHost string
+
+	// Forwarded is the X-Forwarded-* mode, see ForwardedAppend; empty uses the global setting
+	Forwarded string
+
+	// Resolver is the DNS servers of this host, see ParseResolver; empty uses the global setting
+	Resolver string
+
+	GRPC bool // route with grpc_pass, implies HTTPS since clients need HTTP/2 negotiated over TLS
+
+	// listener protocols for HTTPS hosts, nil uses the global setting
+	HTTP2 *bool
+	HTTP3 *bool // QUIC listener and Alt-Svc header
+
+	// StaticRoot serves files from this directory inside the nginx container instead of proxying
+	StaticRoot string
+
+	// Socket proxies to this unix socket inside the nginx container instead of the container IP and port
+	Socket string
+
+	// Aliases redirect to the first hostname, e.g. www.example.com -> example.com
+	Aliases []string
+
+	// ACME opts the hostnames in or out of challenge routing and certificate issuance, nil is opted in
+	ACME *bool
+
+	// country access control, ISO 3166-1 alpha-2 codes, at most one of them is set
+	GeoAllow []string
+	GeoDeny  []string
+
+	// client networks served, other clients get the global deny status; InternalOnly uses the
+	// global internal CIDRs, AllowFrom lists its own addresses and CIDRs, at most one is set
+	InternalOnly bool
+	AllowFrom    []string
+
+	// ValidReferers answers requests from other referers with 403, e.g. none, blocked,
+	// server_names or *.example.com; empty allows every referer
+	ValidReferers []string
+
+	// request restrictions, empty allows every method and keeps the global body size
+	AllowedMethods []string // methods answered, others get 405; GET implies HEAD
+	MaxBodySize    string   // client_max_body_size in nginx size units, e.g. 10m; 0 is unlimited
+
+	// failover to other replicas, empty and zero keep the nginx defaults
+	NextUpstream        string // space-separated proxy_next_upstream conditions, e.g. "error timeout http_502"
+	Retries             int    // further attempts after the first one
+	NextUpstreamTimeout string // time limit for all attempts, e.g. 10s
+
+	// per-client limits, zero or empty disables them
+	LimitConn int    // concurrent connections per client IP
+	LimitRate string // bandwidth per connection in nginx size units, e.g. 500k or 2m
+
+	// ReadTimeout is proxy_read_timeout and proxy_send_timeout, e.g. 1h for quiet WebSockets;
+	// empty keeps 60s
+	ReadTimeout string
+
+	// Preset is the proxy.http.preset applied to the route with its version, e.g. "grafana v1"
+	Preset string
+
+	// PassVars are nginx variables sent to the backend as request headers, e.g. $ssl_client_s_dn
+	PassVars []PassVar
+
+	// Mirror copies requests to this hostname or container, with an optional :port overriding
+	// its HTTP port; responses of the copies are discarded, empty disables mirroring
+	Mirror        string
+	MirrorPercent int // share of requests copied, 1 to 100
+
+	// HealthCheck probes the backends, nil leaves failure detection to nginx's defaults
+	HealthCheck *HealthCheck
+
+	// Audience is AudienceInternal or AudienceExternal for proxy.http.host.internal and
+	// proxy.http.host.external routes, empty for proxy.http.host
+	Audience string
+
+	// HeaderBuffers is large_client_header_buffers number and size for big cookies and long URLs,
+	// e.g. "8 32k"; empty uses the global setting
+	HeaderBuffers string
+
+	// response buffering, empty keeps the nginx defaults
+	BufferingOff    bool   // pass responses through as they arrive, for SSE and streaming
+	ProxyBuffers    string // proxy_buffers number and size, e.g. "16 8k"
+	ProxyBufferSize string // proxy_buffer_size for the response headers, e.g. 16k
+
+	// WAF enables ModSecurity with the global rules file
+	WAF bool
+
+	// BlockBots answers user agents on the global bot blocklist with 403
+	BlockBots bool
+
+	// RequestID passes an X-Request-ID to the backend and logs it, nil uses the global setting
+	RequestID *bool
+
+	// LogSample is the share of successful requests written to the access log, e.g. 1%;
+	// errors are always logged, empty uses the global setting and 100% logs everything
+	LogSample string
+}
+
+// OIDC providers, the auth services proxy.http.oidc.* routes authenticate against
+const (
+	OIDCOAuth2Proxy = "oauth2-proxy"
+	OIDCVouch       = "vouch"
+)
+
+// proxy.http.upstream_host modes, any other value is sent as the Host header itself
+const (
+	UpstreamHostPreserve = "preserve" // the Host header exactly as the client sent it, port included
+	UpstreamHostUpstream = "upstream" // the address of the container, as if it was requested directly
+)
+
+// proxy.http.forwarded_headers modes of the X-Forwarded-For, -Proto and -Host headers
+const (
+	ForwardedAppend    = "append"    // add the client to X-Forwarded-For, pass trusted proxies' headers on
+	ForwardedOverwrite = "overwrite" // send only the client address, scheme and host seen by nginx
+	ForwardedStrip     = "strip"     // remove the headers
+)
+
+// OIDC is an OpenID Connect login through an auth_request service such as oauth2-proxy or Vouch Proxy
+// The identity provider, client ID and secret are configured in that service
+type OIDC struct {
+	Provider string // oauth2-proxy or vouch
+	AuthURL  string // auth service as reachable from nginx, e.g. http://oauth2-proxy:4180
+	LoginURL string // public Vouch URL users are sent to for login and sign-out, vouch only
+}
+
+// Primary returns the canonical hostname aliases redirect to
+func (m HTTPMapping) Primary() string {
+	if len(m.Hostnames) == 0 {
+		return ""
+	}
+	return m.Hostnames[0]
+}
+
+// ACMEEnabled reports whether ACME challenges are routed and certificates issued for the hostnames
+func (m HTTPMapping) ACMEEnabled() bool {
+	return m.ACME == nil || *m.ACME
+}
+
+// PortFor returns the container port a hostname is routed to
+func (m HTTPMapping) PortFor(hostname string) int {
+	if port, ok := m.HostPorts[hostname]; ok {
+		return port
+	}
+	return m.ContainerPort
+}
+
+// secretNameRe matches Docker secret names, which never contain path separators
+var secretNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ErrUnreachable is returned when the Docker daemon does not answer at the configured host
+var ErrUnreachable = errors.New("docker daemon unreachable")
+
+// unreachableError marks connection failures with ErrUnreachable, other errors are returned as is
+func unreachableError(err error) error {
+	if client.IsErrConnectionFailed(err) {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	return err
+}
+
+// NewClient creates a new Docker client
+// Supports unix://, tcp:// and (on Windows) npipe:// hosts
+// An empty apiVersion negotiates the version with the daemon, otherwise it is pinned
+func NewClient(host, apiVersion string, log *lgr.Logger) (*Client, error) {
+	if strings.HasPrefix(host, "npipe://") && runtime.GOOS != "windows" {
+		return nil, fmt.Errorf("named pipe docker host %s is only supported on Windows", host)
+	}
+
+	opts := []client.Opt{client.WithHost(host), client.WithAPIVersionNegotiation()}
+	if apiVersion != "" {
+		opts = append(opts, client.WithVersion(strings.TrimPrefix(apiVersion, "v")))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+
+	log.Logf("INFO connecting to Docker socket=%s", host)
+
+	// test connection
+	ctx := context.Background()
+	ping, err := cli.Ping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping Docker daemon: %w: %w", ErrUnreachable, err)
+	}
+	cli.NegotiateAPIVersionPing(ping) // no-op for a pinned version
+
+	c := &Client{cli: cli, log: log}
+	if apiVersion != "" {
+		if err := c.checkPinnedVersion(ctx, cli.ClientVersion()); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Logf("DEBUG docker connection established api_version=%s pinned=%t", cli.ClientVersion(), apiVersion != "")
+
+	return c, nil
+}
+
+// SkippedContainer is a container with proxy labels that could not be routed
+type SkippedContainer struct {
+	Name   string
+	ID     string
+	Reason string
+	Stream bool // has TCP or UDP labels
+	HTTP   bool // has HTTP labels
+}
+
+// ScanResult holds the routable containers of a scan and the ones that were skipped
+type ScanResult struct {
+	Containers []ContainerInfo
+	Skipped    []SkippedContainer
+	NextChange time.Time // next time a route expires or a schedule window opens or closes, zero if none
+}
+
+// errNoIPAddress is returned for containers without an address of the address family
+var errNoIPAddress = errors.New("no IP address")
+
+// ScanContainers finds all running containers with proxy labels
+func (c *Client) ScanContainers(ctx context.Context) ([]ContainerInfo, error) {
+	result, err := c.Scan(ctx)
+	return result.Containers, err
+}
+
+// Scan finds all running containers with proxy labels and reports the ones skipped
+// because of invalid labels or a missing IP address
+func (c *Client) Scan(ctx context.Context) (ScanResult, error) {
+	c.log.Logf("INFO scanning containers for proxy labels")
+	c.log.Logf("DEBUG [Docker] listing_all_containers")
+
+	if err := c.throttle(ctx, "list"); err != nil {
+		return ScanResult{}, fmt.Errorf("failed to list containers: %w", err)
+	}
+	containers, err := c.cli.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("failed to list containers: %w", unreachableError(err))
+	}
+
+	c.log.Logf("DEBUG [Docker] found_running_containers count=%d", len(containers))
+
+	var result ScanResult
+	now := time.Now()
+	for _, ctr := range containers {
+		if next := routeChange(ctr, now); !next.IsZero() && (result.NextChange.IsZero() || next.Before(result.NextChange)) {
+			result.NextChange = next
+		}
+		info, err := c.parseContainer(ctx, ctr)
+		if err != nil {
+			// a partial scan would drop the routes of the containers left out
+			if errors.Is(err, ErrBudgetExhausted) || ctx.Err() != nil {
+				return ScanResult{}, fmt.Errorf("scan aborted at container %s: %w", strings.TrimPrefix(ctr.Names[0], "/"), err)
+			}
+			if errors.Is(err, errOutsideSchedule) {
+				c.log.Logf("INFO [Docker] container=%s not_routed=%q", ctr.Names[0], err)
+			} else {
+				c.log.Logf("WARN [Docker] container=%s parse_error=%q", ctr.Names[0], err)
+			}
+			if skipped, ok := skippedContainer(ctr, err); ok {
+				result.Skipped = append(result.Skipped, skipped)
+			}
+			continue
+		}
+		if info != nil {
+			result.Containers = append(result.Containers, *info)
+		}
+	}
+
+	// routes waiting for their proxy.depends_on containers are skipped until those are ready
+	var waiting map[string]string
+	result.Containers, waiting = gateDependencies(result.Containers, containers)
+	for _, ctr := range containers {
+		if reason, ok := waiting[strings.TrimPrefix(ctr.Names[0], "/")]; ok {
+			err := fmt.Errorf("%w: %s", errWaitingForDependency, reason)
+			c.log.Logf("INFO [Docker] container=%s not_routed=%q", ctr.Names[0], err)
+			if skipped, ok := skippedContainer(ctr, err); ok {
+				result.Skipped = append(result.Skipped, skipped)
+			}
+		}
+	}
+
+	c.log.Logf("INFO route discovery complete: containers=%d skipped=%d", len(result.Containers), len(result.Skipped))
+	return result, nil
+}
+
+// LabelsChecksum returns a short checksum of the proxy.* labels, so label changes that
+// leave the routes alone are still told apart between scans
+func LabelsChecksum(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if strings.HasPrefix(key, "proxy.") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(h, "%s=%s\n", key, labels[key]) //nolint:errcheck // hash writes never fail
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// routeChange returns the next time after now the routes of a container expire or its
+// schedule window opens or closes, zero if never; invalid labels are reported by parseContainer
+func routeChange(ctr types.Container, now time.Time) time.Time {
+	var next time.Time
+	if expires, err := parseExpiry(ctr.Labels["proxy.expires"], time.Unix(ctr.Created, 0)); err == nil && expires.After(now) {
+		next = expires
+	}
+	if sched, err := parseSchedule(ctr.Labels["proxy.schedule"]); err == nil && sched != nil {
+		if boundary := sched.next(now); next.IsZero() || boundary.Before(next) {
+			next = boundary
+		}
+	}
+	return next
+}
+
+// skippedContainer describes a container that failed to parse, false if it has no route labels
+func skippedContainer(ctr types.Container, err error) (SkippedContainer, bool) {
+	stream := ctr.Labels["proxy.tcp.ports"] != "" || ctr.Labels["proxy.udp.ports"] != ""
+	http := hasHTTPHost(ctr.Labels) || hasHTTPRouteLabels(ctr.Labels)
+	if !stream && !http {
+		return SkippedContainer{}, false
+	}
+
+	id := ctr.ID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return SkippedContainer{
+		Name:   strings.TrimPrefix(ctr.Names[0], "/"),
+		ID:     id,
+		Reason: err.Error(),
+		Stream: stream,
+		HTTP:   http,
+	}, true
+}
+
+//nolint:gocognit,gocyclo // complex parsing logic is unavoidable
+func (c *Client) parseContainer(ctx context.Context, ctr types.Container) (*ContainerInfo, error) {
+	name := strings.TrimPrefix(ctr.Names[0], "/")
+	id := ctr.ID[:12]
+
+	// expired routes are dropped, e.g. of a demo environment nobody removed
+	expires, err := parseExpiry(ctr.Labels["proxy.expires"], time.Unix(ctr.Created, 0))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.expires: %w", err)
+	}
+	if !expires.IsZero() && !time.Now().Before(expires) {
+		return nil, fmt.Errorf("routes expired at %s (proxy.expires)", expires.UTC().Format(time.RFC3339))
+	}
+
+	// scheduled routes are only generated while a window is open
+	sched, err := parseSchedule(ctr.Labels["proxy.schedule"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.schedule: %w", err)
+	}
+	if sched != nil && !sched.open(time.Now()) {
+		return nil, fmt.Errorf("%w %s", errOutsideSchedule, sched)
+	}
+
+	dependsOn, err := parseDependsOn(ctr.Labels["proxy.depends_on"], name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.depends_on: %w", err)
+	}
+
+	// get container IP
+	if err := c.throttle(ctx, "inspect"); err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	inspect, err := c.cli.ContainerInspect(ctx, ctr.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	// containers on the host network have no address of their own, their ports are on the host
+	var ip string
+	if inspect.ContainerJSONBase != nil && inspect.HostConfig != nil && inspect.HostConfig.NetworkMode.IsHost() {
+		ip, err = c.hostAddress(ctx)
+	} else {
+		ip, err = containerAddress(inspect.NetworkSettings, c.family)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Logf("DEBUG [Docker] processing_container name=%s id=%s ip=%s", name, id, ip)
+
+	// read labels
+	c.log.Logf("DEBUG [Docker] reading_labels container=%s", name)
+
+	tcpPortsStr := ctr.Labels["proxy.tcp.ports"]
+	udpPortsStr := ctr.Labels["proxy.udp.ports"]
+	httpHostStr := ctr.Labels["proxy.http.host"]
+
+	c.log.Logf("DEBUG [Docker] container=%s proxy.tcp.ports=%q", name, tcpPortsStr)
+	c.log.Logf("DEBUG [Docker] container=%s proxy.udp.ports=%q", name, udpPortsStr)
+	c.log.Logf("DEBUG [Docker] container=%s proxy.http.host=%q", name, httpHostStr)
+
+	routeIndexes, err := httpRouteIndexes(ctr.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip if all labels are empty
+	if tcpPortsStr == "" && udpPortsStr == "" && !hasHTTPHost(ctr.Labels) && len(routeIndexes) == 0 &&
+		ctr.Labels["proxy.ssh.alias"] == "" {
+		c.log.Logf("WARN [Docker] container=%s no proxy labels, skipping", name)
+		return nil, nil
+	}
+
+	var mappings []PortMapping
+	tcpCount := 0
+	udpCount := 0
+
+	streamHash, err := parseStreamHash(ctr.Labels["proxy.stream.hash"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.stream.hash: %w", err)
+	}
+
+	namespace, err := parseNamespace(ctr.Labels["proxy.namespace"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.namespace: %w", err)
+	}
+
+	// parse TCP port mappings
+	if tcpPortsStr != "" {
+		c.log.Logf("DEBUG [Docker] parsing_tcp_port_mappings container=%s input=%q", name, tcpPortsStr)
+		tcpMappings, err := parsePortMappings(tcpPortsStr)
+		if err != nil {
+			c.log.Logf("ERROR [Docker] container=%s invalid_tcp_port_mapping format=%q", name, tcpPortsStr)
+			c.log.Logf("WARN [Docker] skipping_container name=%s reason=invalid_configuration", name)
+			return nil, fmt.Errorf("invalid TCP port mappings: %w", err)
+		}
+		maxConns, err := parseLimitConn(ctr.Labels["proxy.tcp.max_connections"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy.tcp.max_connections: %w", err)
+		}
+		preset, err := parseTCPPreset(ctr.Labels["proxy.tcp.preset"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy.tcp.preset: %w", err)
+		}
+		// tag with TCP protocol
+		for i := range tcpMappings {
+			tcpMappings[i].Protocol = TCP
+			tcpMappings[i].MaxConnections = maxConns
+			preset.apply(&tcpMappings[i])
+			tcpMappings[i].Hash = streamHash
+			mappings = append(mappings, tcpMappings[i])
+			c.log.Logf("DEBUG [Docker] container=%s parsed protocol=TCP proxy_port=%d container_port=%d",
+				name, tcpMappings[i].ProxyPort, tcpMappings[i].ContainerPort)
+		}
+		tcpCount = len(tcpMappings)
+	}
+
+	// parse UDP port mappings
+	if udpPortsStr != "" {
+		c.log.Logf("DEBUG [Docker] parsing_udp_port_mappings container=%s input=%q", name, udpPortsStr)
+		udpMappings, err := parsePortMappings(udpPortsStr)
+		if err != nil {
+			c.log.Logf("ERROR [Docker] container=%s invalid_udp_port_mapping format=%q", name, udpPortsStr)
+			c.log.Logf("WARN [Docker] skipping_container name=%s reason=invalid_configuration", name)
+			return nil, fmt.Errorf("invalid UDP port mappings: %w", err)
+		}
+		// tag with UDP protocol
+		for i := range udpMappings {
+			if udpMappings[i].ConnectTimeout != "" {
+				return nil, fmt.Errorf("invalid UDP port mappings: connect_timeout of port %d only applies to TCP",
+					udpMappings[i].ProxyPort)
+			}
+			udpMappings[i].Protocol = UDP
+			udpMappings[i].Hash = streamHash
+			mappings = append(mappings, udpMappings[i])
+			c.log.Logf("DEBUG [Docker] container=%s parsed protocol=UDP proxy_port=%d container_port=%d",
+				name, udpMappings[i].ProxyPort, udpMappings[i].ContainerPort)
+		}
+		udpCount = len(udpMappings)
+	}
+
+	// parse SSH gateway aliases
+	sshMapping, err := parseSSHMapping(ctr.Labels["proxy.ssh.alias"], ctr.Labels["proxy.ssh.port"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH gateway labels: %w", err)
+	}
+
+	// credentials only come from secret files, labels are readable by anyone with Docker access
+	for label, replacement := range plaintextLabels {
+		if _, ok := ctr.Labels[label]; ok {
+			c.log.Logf("WARN [Docker] container=%s label=%s ignored, plaintext credentials are not supported, use %s",
+				name, label, replacement)
+		}
+	}
+
+	// parse HTTP hostname mapping
+	httpMappings, err := c.parseHTTPAudiences(name, httpLabelPrefix, ctr.Labels)
+	if err != nil {
+		return nil, err
+	}
+	var httpMapping *HTTPMapping
+	if len(httpMappings) > 0 {
+		httpMapping = &httpMappings[0]
+	}
+
+	// parse indexed HTTP routes, each with its own hostnames, port and secrets, after the
+	// proxy.http.host.internal route
+	httpRoutes := make([]HTTPMapping, 0, len(routeIndexes)+len(httpMappings))
+	if len(httpMappings) > 1 {
+		httpRoutes = append(httpRoutes, httpMappings[1:]...)
+	}
+	for _, index := range routeIndexes {
+		prefix := httpRouteLabelPrefix(index)
+		routes, err := c.parseHTTPAudiences(name, prefix, ctr.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", index, err)
+		}
+		if len(routes) == 0 {
+			return nil, fmt.Errorf("route %d: %shost is required", index, prefix)
+		}
+		httpRoutes = append(httpRoutes, routes...)
+	}
+
+	c.log.Logf("DEBUG [Docker] container=%s port_mappings_count=%d", name, len(mappings))
+	c.log.Logf("INFO [Docker] registered_container name=%s tcp_ports=%d udp_ports=%d http_hosts=%d",
+		name, tcpCount, udpCount, func() int {
+			hosts := 0
+			if httpMapping != nil {
+				hosts = len(httpMapping.Hostnames)
+			}
+			for _, route := range httpRoutes {
+				hosts += len(route.Hostnames)
+			}
+			return hosts
+		}())
+
+	info := &ContainerInfo{
+		Name:        name,
+		ID:          id,
+		IP:          ip,
+		Service:     serviceName(ctr.Labels),
+		Namespace:   namespace,
+		Mappings:    mappings,
+		HTTPMapping: httpMapping,
+		SSH:         sshMapping,
+		Expires:     expires,
+		DependsOn:   dependsOn,
+		LabelsHash:  LabelsChecksum(ctr.Labels),
+		Owner:       newOwner(ctr.Image, ctr.Labels),
+	}
+	if len(httpRoutes) > 0 {
+		info.HTTPRoutes = httpRoutes
+	}
+	return info, nil
+}
+
+// HTTP label prefixes, a route is read from <prefix>host, <prefix>port and so on
+const (
+	httpLabelPrefix      = "proxy.http."
+	httpRoutesLabelStart = "proxy.http.routes."
+)
+
+// httpRouteLabelPrefix returns the label prefix of an indexed route, e.g. proxy.http.routes.1.
+func httpRouteLabelPrefix(index int) string {
+	return httpRoutesLabelStart + strconv.Itoa(index) + "."
+}
+
+// httpRouteIndexes returns the sorted indexes used in proxy.http.routes.<n>.* labels
+func httpRouteIndexes(labels map[string]string) ([]int, error) {
+	seen := make(map[int]bool)
+	for label := range labels {
+		rest, ok := strings.CutPrefix(label, httpRoutesLabelStart)
+		if !ok {
+			continue
+		}
+		indexStr, _, _ := strings.Cut(rest, ".")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil || index < 1 {
+			return nil, fmt.Errorf("invalid route index %q in %s, expected a positive number", indexStr, label)
+		}
+		seen[index] = true
+	}
+
+	indexes := make([]int, 0, len(seen))
+	for index := range seen {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// parseHTTPMapping parses the HTTP labels under prefix, nil if <prefix>host is not set
+func (c *Client) parseHTTPMapping(name, prefix string, labels map[string]string) (*HTTPMapping, error) {
+	httpHostStr := labels[prefix+"host"]
+	if httpHostStr == "" {
+		return nil, nil
+	}
+	labels, preset, err := applyHTTPPreset(prefix, labels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %spreset: %w", prefix, err)
+	}
+	httpPortStr := labels[prefix+"port"]
+	httpHTTPSStr := labels[prefix+"https"]
+	authSecretStr := strings.TrimSpace(labels[prefix+"auth.secret"])
+	tlsCertSecretStr := strings.TrimSpace(labels[prefix+"tls.cert.secret"])
+	tlsKeySecretStr := strings.TrimSpace(labels[prefix+"tls.key.secret"])
+	upstreamAuthSecretStr := strings.TrimSpace(labels[prefix+"upstream.auth.secret"])
+
+	c.log.Logf("DEBUG [Docker] parsing_http_host container=%s label=%shost input=%q", name, prefix, httpHostStr)
+
+	// parse hostnames (comma-separated), host:port overrides the port for one hostname
+	hostnames := strings.Split(httpHostStr, ",")
+	var hostPorts map[string]int
+	for i := range hostnames {
+		hostnames[i] = strings.TrimSpace(hostnames[i])
+		host, portStr, found := strings.Cut(hostnames[i], ":")
+		if !found {
+			continue
+		}
+		port, err := parseHTTPPort(portStr)
+		if err != nil {
+			c.log.Logf("ERROR [Docker] container=%s invalid_host_port label=%shost host=%q", name, prefix, hostnames[i])
+			return nil, fmt.Errorf("hostname %q: %w", hostnames[i], err)
+		}
+		if hostPorts == nil {
+			hostPorts = make(map[string]int)
+		}
+		hostnames[i] = host
+		hostPorts[host] = port
+	}
+
+	// parse HTTP port (default: 80)
+	httpPort := 80
+	if httpPortStr != "" {
+		var err error
+		httpPort, err = parseHTTPPort(httpPortStr)
+		if err != nil {
+			c.log.Logf("ERROR [Docker] container=%s invalid_http_port label=%sport format=%q", name, prefix, httpPortStr)
+			return nil, err
+		}
+	}
+
+	// parse HTTPS flag (default: false), both serves the hostnames on 80 and 443
+	https, plainHTTP := labelBool(httpHTTPSStr), false
+	if strings.EqualFold(strings.TrimSpace(httpHTTPSStr), "both") {
+		https, plainHTTP = true, true
+	}
+
+	// parse backend scheme (default: http)
+	backendHTTPS := false
+	switch scheme := strings.ToLower(strings.TrimSpace(labels[prefix+"backend_scheme"])); scheme {
+	case "", "http":
+	case "https":
+		backendHTTPS = true
+	default:
+		return nil, fmt.Errorf("invalid %sbackend_scheme %q, expected http or https", prefix, scheme)
+	}
+	backendSSLVerify := labelBool(labels[prefix+"backend_ssl_verify"])
+	backendSNI := strings.TrimSpace(labels[prefix+"backend_sni"])
+	if backendSNI != "" && !hostnameRe.MatchString(backendSNI) {
+		return nil, fmt.Errorf("invalid %sbackend_sni %q", prefix, backendSNI)
+	}
+	if !backendHTTPS && (backendSSLVerify || backendSNI != "") {
+		c.log.Logf("WARN [Docker] container=%s %sbackend_ssl_verify and %sbackend_sni ignored without %sbackend_scheme=https",
+			name, prefix, prefix, prefix)
+	}
+
+	for suffix, secret := range map[string]string{
+		"auth.secret":          authSecretStr,
+		"tls.cert.secret":      tlsCertSecretStr,
+		"tls.key.secret":       tlsKeySecretStr,
+		"upstream.auth.secret": upstreamAuthSecretStr,
+	} {
+		if secret != "" && !validSecretRef(secret) {
+			c.log.Logf("ERROR [Docker] container=%s invalid_secret_name label=%s%s value=%q", name, prefix, suffix, secret)
+			return nil, fmt.Errorf("invalid secret name %q in %s%s", secret, prefix, suffix)
+		}
+	}
+	if (tlsCertSecretStr == "") != (tlsKeySecretStr == "") {
+		return nil, fmt.Errorf("%stls.cert.secret and %stls.key.secret must be set together", prefix, prefix)
+	}
+	if tlsCertSecretStr != "" && !https {
+		c.log.Logf("INFO [Docker] container=%s tls secrets set, enabling https", name)
+		https = true
+	}
+
+	staticRoot := strings.TrimSpace(labels[prefix+"static.root"])
+	if staticRoot != "" && !validAbsPath(staticRoot) {
+		return nil, fmt.Errorf("invalid %sstatic.root %q, expected an absolute path without .. or special characters", prefix, staticRoot)
+	}
+
+	socket := strings.TrimSpace(labels[prefix+"socket"])
+	if socket != "" && !validAbsPath(socket) {
+		return nil, fmt.Errorf("invalid %ssocket %q, expected an absolute path without .. or special characters", prefix, socket)
+	}
+	if socket != "" && staticRoot != "" {
+		return nil, fmt.Errorf("%ssocket and %sstatic.root cannot be combined", prefix, prefix)
+	}
+	if socket != "" && (httpPortStr != "" || len(hostPorts) > 0) {
+		c.log.Logf("WARN [Docker] container=%s %sport and host:port ignored with %ssocket", name, prefix, prefix)
+	}
+
+	oidc, err := parseOIDC(prefix, labels)
+	if err != nil {
+		return nil, err
+	}
+	if oidc != nil && authSecretStr != "" {
+		return nil, fmt.Errorf("%soidc.auth_url and %sauth.secret cannot be combined", prefix, prefix)
+	}
+
+	aliases, err := parseAliases(labels[prefix+"aliases"], hostnames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %saliases: %w", prefix, err)
+	}
+
+	geoAllow, err := parseCountryCodes(labels[prefix+"geo.allow"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sgeo.allow: %w", prefix, err)
+	}
+	geoDeny, err := parseCountryCodes(labels[prefix+"geo.deny"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sgeo.deny: %w", prefix, err)
+	}
+	if len(geoAllow) > 0 && len(geoDeny) > 0 {
+		return nil, fmt.Errorf("%sgeo.allow and %sgeo.deny cannot be combined", prefix, prefix)
+	}
+
+	validReferers, err := parseValidReferers(labels[prefix+"valid_referers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %svalid_referers: %w", prefix, err)
+	}
+
+	internalOnly := labelBool(labels[prefix+"internal_only"])
+	allowFrom, err := ParseCIDRs(labels[prefix+"allow_from"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sallow_from: %w", prefix, err)
+	}
+	if internalOnly && len(allowFrom) > 0 {
+		return nil, fmt.Errorf("%sinternal_only and %sallow_from cannot be combined", prefix, prefix)
+	}
+
+	upstreamHost, err := parseUpstreamHost(labels[prefix+"upstream_host"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %supstream_host: %w", prefix, err)
+	}
+
+	forwarded, err := ParseForwardedMode(labels[prefix+"forwarded_headers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sforwarded_headers: %w", prefix, err)
+	}
+
+	resolver, err := ParseResolver(labels[prefix+"resolver"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sresolver: %w", prefix, err)
+	}
+
+	logSample, err := ParseLogSample(labels[prefix+"access_log.sample"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %saccess_log.sample: %w", prefix, err)
+	}
+
+	nextUpstream, err := parseNextUpstream(labels[prefix+"next_upstream"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %snext_upstream: %w", prefix, err)
+	}
+	retries, err := parseRetries(labels[prefix+"retries"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sretries: %w", prefix, err)
+	}
+	nextUpstreamTimeout, err := parseNginxTime(labels[prefix+"next_upstream_timeout"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %snext_upstream_timeout: %w", prefix, err)
+	}
+	readTimeout, err := parseNginxTime(labels[prefix+"read_timeout"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sread_timeout: %w", prefix, err)
+	}
+	passVars, err := parsePassVars(labels[prefix+"pass_vars"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %spass_vars: %w", prefix, err)
+	}
+
+	mirror, mirrorPercent, err := parseMirror(labels[prefix+"mirror"], labels[prefix+"mirror.percent"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %smirror or %smirror.percent: %w", prefix, prefix, err)
+	}
+
+	healthCheck, err := parseHealthCheck(prefix, labels)
+	if err != nil {
+		return nil, err
+	}
+	if healthCheck != nil && staticRoot != "" {
+		c.log.Logf("WARN [Docker] container=%s %shealthcheck.* ignored with %sstatic.root", name, prefix, prefix)
+	}
+
+	allowedMethods, err := parseAllowedMethods(labels[prefix+"allowed_methods"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sallowed_methods: %w", prefix, err)
+	}
+	maxBodySize, err := parseMaxBodySize(labels[prefix+"max_body_size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %smax_body_size: %w", prefix, err)
+	}
+
+	limitConn, err := parseLimitConn(labels[prefix+"limit_conn"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %slimit_conn: %w", prefix, err)
+	}
+	limitRate, err := parseLimitRate(labels[prefix+"limit_rate"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %slimit_rate: %w", prefix, err)
+	}
+
+	headerBuffers, err := parseHeaderBuffers(labels[prefix+"header_buffers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sheader_buffers: %w", prefix, err)
+	}
+
+	bufferingOff, err := parseBufferingOff(labels[prefix+"buffering"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sbuffering: %w", prefix, err)
+	}
+	proxyBuffers, proxyBufferSize, err := parseProxyBuffers(labels[prefix+"buffers"], labels[prefix+"buffer_size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %sbuffers or %sbuffer_size: %w", prefix, prefix, err)
+	}
+
+	waf := labelBool(labels[prefix+"waf"])
+	blockBots := labelBool(labels[prefix+"block_bots"])
+	requestID := c.optionalBool(name, prefix+"request_id", labels)
+	http2 := c.optionalBool(name, prefix+"http2", labels)
+	http3 := c.optionalBool(name, prefix+"http3", labels)
+	acme := c.optionalBool(name, prefix+"acme", labels)
+
+	// plaintext HTTP/2 (h2c) on port 80 would break HTTP/1 clients of every host there
+	grpc := labelBool(labels[prefix+"grpc"])
+	if grpc && staticRoot != "" {
+		return nil, fmt.Errorf("%sgrpc and %sstatic.root cannot be combined", prefix, prefix)
+	}
+	if grpc && oidc != nil {
+		return nil, fmt.Errorf("%sgrpc and %soidc.auth_url cannot be combined, gRPC clients cannot follow login redirects",
+			prefix, prefix)
+	}
+	if grpc && plainHTTP {
+		return nil, fmt.Errorf("%shttps=both cannot be combined with %sgrpc, gRPC clients need TLS", prefix, prefix)
+	}
+	if (grpc || staticRoot != "") && (bufferingOff || proxyBuffers != "" || proxyBufferSize != "") {
+		c.log.Logf("WARN [Docker] container=%s %sbuffering, %sbuffers and %sbuffer_size ignored with grpc or static.root",
+			name, prefix, prefix, prefix)
+	}
+	if grpc && mirror != "" {
+		c.log.Logf("WARN [Docker] container=%s %smirror ignored with grpc, copies are sent over HTTP/1.1", name, prefix)
+		mirror, mirrorPercent = "", 0
+	}
+	if grpc && !https {
+		c.log.Logf("INFO [Docker] container=%s grpc set, enabling https", name)
+		https = true
+	}
+
+	c.log.Logf("INFO [Docker] container=%s http_mapping hostnames=%d port=%d https=%t plain_http=%t auth=%t backend_https=%t grpc=%t preset=%q",
+		name, len(hostnames), httpPort, https, plainHTTP, authSecretStr != "", backendHTTPS, grpc, preset)
+
+	return &HTTPMapping{
+		Hostnames:     hostnames,
+		ContainerPort: httpPort,
+		HTTPS:         https,
+		PlainHTTP:     plainHTTP,
+		AuthSecret:    authSecretStr,
+		TLSCertSecret: tlsCertSecretStr,
+		TLSKeySecret:  tlsKeySecretStr,
+		HostPorts:     hostPorts,
+		OIDC:          oidc,
+
+		UpstreamAuthSecret: upstreamAuthSecretStr,
+
+		BackendHTTPS:     backendHTTPS,
+		BackendSSLVerify: backendHTTPS && backendSSLVerify,
+		BackendSNI:       backendSNI,
+
+		UpstreamHost: upstreamHost,
+		Forwarded:    forwarded,
+		Resolver:     resolver,
+
+		GRPC:  grpc,
+		HTTP2: http2,
+		HTTP3: http3,
+
+		StaticRoot: staticRoot,
+		Socket:     socket,
+		Aliases:    aliases,
+		ACME:       acme,
+
+		GeoAllow: geoAllow,
+		GeoDeny:  geoDeny,
+
+		InternalOnly: internalOnly,
+		AllowFrom:    allowFrom,
+
+		ValidReferers: validReferers,
+
+		AllowedMethods: allowedMethods,
+		MaxBodySize:    maxBodySize,
+
+		NextUpstream:        nextUpstream,
+		Retries:             retries,
+		NextUpstreamTimeout: nextUpstreamTimeout,
+		ReadTimeout:         readTimeout,
+		HealthCheck:         healthCheck,
+		PassVars:            passVars,
+		Mirror:              mirror,
+		MirrorPercent:       mirrorPercent,
+		Preset:              preset,
+
+		LimitConn: limitConn,
+		LimitRate: limitRate,
+
+		HeaderBuffers: headerBuffers,
+
+		BufferingOff:    bufferingOff,
+		ProxyBuffers:    proxyBuffers,
+		ProxyBufferSize: proxyBufferSize,
+
+		WAF:       waf,
+		BlockBots: blockBots,
+		RequestID: requestID,
+		LogSample: logSample,
+	}, nil
+}
+
+// serviceLabels are the orchestrator labels serviceName reads
+var serviceLabels = []string{"com.docker.swarm.service.name", "com.docker.compose.project", "com.docker.compose.service"}
+
+// serviceName identifies the service a container is a replica of, empty for standalone containers
+func serviceName(labels map[string]string) string {
+	if name := labels["com.docker.swarm.service.name"]; name != "" {
+		return name
+	}
+	project, service := labels["com.docker.compose.project"], labels["com.docker.compose.service"]
+	if service == "" {
+		return ""
+	}
+	return project + "/" + service
+}
+
+// nextUpstreamConditions are the proxy_next_upstream conditions accepted in labels
+var nextUpstreamConditions = map[string]bool{
+	"error": true, "timeout": true, "invalid_header": true, "non_idempotent": true, "off": true,
+	"http_500": true, "http_502": true, "http_503": true, "http_504": true,
+	"http_403": true, "http_404": true, "http_429": true,
+}
+
+// parseNextUpstream parses comma- or space-separated conditions, e.g. "error,timeout,http_502"
+func parseNextUpstream(s string) (string, error) {
+	conditions := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ',' || r == ' ' })
+	for _, condition := range conditions {
+		if !nextUpstreamConditions[condition] {
+			return "", fmt.Errorf("unknown condition %q", condition)
+		}
+		if condition == "off" && len(conditions) > 1 {
+			return "", fmt.Errorf("off cannot be combined with other conditions")
+		}
+	}
+	return strings.Join(conditions, " "), nil
+}
+
+// parseRetries parses the number of further attempts, empty keeps the nginx default
+func parseRetries(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	retries, err := strconv.Atoi(s)
+	if err != nil || retries < 1 || retries > 100 {
+		return 0, fmt.Errorf("%q is not a number of retries between 1 and 100", s)
+	}
+	return retries, nil
+}
+
+// nginxTimeRe matches nginx times, e.g. 500ms, 10s or 1m
+var nginxTimeRe = regexp.MustCompile(`^[1-9][0-9]*(ms|s|m|h)?$`)
+
+// parseNginxTime parses an nginx time, empty keeps the nginx default
+func parseNginxTime(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s != "" && !nginxTimeRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a time like 10s or 500ms", s)
+	}
+	return s, nil
+}
+
+// streamHashRe matches one or more nginx variables, e.g. $remote_addr or $remote_addr$server_port
+var streamHashRe = regexp.MustCompile(`^(\$[a-z][a-z0-9_]*)+$`)
+
+// parseStreamHash parses a stream upstream hash key, empty means round-robin
+func parseStreamHash(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s != "" && !streamHashRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a list of nginx variables like $remote_addr", s)
+	}
+	return s, nil
+}
+
+// namespaceRe matches namespace names, they become part of config file names
+var namespaceRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// parseNamespace parses the namespace of a container's routes, empty is the main config
+func parseNamespace(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s != "" && !namespaceRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a name of up to 32 lowercase letters, digits and dashes", s)
+	}
+	return s, nil
+}
+
+// parseLimitConn parses a connection limit, empty means no limit
+func parseLimitConn(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > 65535 {
+		return 0, fmt.Errorf("%q is not a connection count between 1 and 65535", s)
+	}
+	return limit, nil
 }
 
-// Protocol represents the network protocol type
-type Protocol int
+// limitRateRe matches nginx sizes in bytes per second, e.g. 512k
+var limitRateRe = regexp.MustCompile(`^[1-9][0-9]*[kKmMgG]?$`)
 
-const (
-	// TCP represents the TCP protocol
-	TCP Protocol = iota
-	// UDP represents the UDP protocol
-	UDP
+var (
+	// oidcAuthURLRe matches auth service addresses without a path, e.g. http://oauth2-proxy:4180
+	oidcAuthURLRe = regexp.MustCompile(`^https?://[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`)
+	// oidcLoginURLRe matches public https URLs with an optional path, e.g. https://login.example.com
+	oidcLoginURLRe = regexp.MustCompile(`^https://[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?(/[A-Za-z0-9._~-]+)*$`)
 )
 
-// ContainerInfo holds parsed container information
-type ContainerInfo struct {
-	Name        string
-	ID          string
-	IP          string
-	Mappings    []PortMapping // TCP/UDP port mappings
-	HTTPMapping *HTTPMapping  // HTTP hostname routing (optional)
+// parseOIDC parses the proxy.http.oidc.* labels, nil without oidc.auth_url
+func parseOIDC(prefix string, labels map[string]string) (*OIDC, error) {
+	authURL := strings.TrimSuffix(strings.TrimSpace(labels[prefix+"oidc.auth_url"]), "/")
+	provider := strings.ToLower(strings.TrimSpace(labels[prefix+"oidc.provider"]))
+	loginURL := strings.TrimSuffix(strings.TrimSpace(labels[prefix+"oidc.login_url"]), "/")
+	if authURL == "" {
+		if provider != "" || loginURL != "" {
+			return nil, fmt.Errorf("%soidc.provider and %soidc.login_url need %soidc.auth_url", prefix, prefix, prefix)
+		}
+		return nil, nil
+	}
+	if !oidcAuthURLRe.MatchString(authURL) {
+		return nil, fmt.Errorf("invalid %soidc.auth_url %q, expected http://host:port without a path", prefix, authURL)
+	}
+
+	switch provider {
+	case "", OIDCOAuth2Proxy:
+		if loginURL != "" {
+			return nil, fmt.Errorf("%soidc.login_url is only used with %soidc.provider=vouch", prefix, prefix)
+		}
+		return &OIDC{Provider: OIDCOAuth2Proxy, AuthURL: authURL}, nil
+	case OIDCVouch:
+		if !oidcLoginURLRe.MatchString(loginURL) {
+			return nil, fmt.Errorf("invalid %soidc.login_url %q, vouch needs its public https URL", prefix, loginURL)
+		}
+		return &OIDC{Provider: OIDCVouch, AuthURL: authURL, LoginURL: loginURL}, nil
+	default:
+		return nil, fmt.Errorf("invalid %soidc.provider %q, expected oauth2-proxy or vouch", prefix, provider)
+	}
 }
 
-// PortMapping represents a proxy port to container port mapping with protocol
-type PortMapping struct {
-	ProxyPort     int
-	ContainerPort int
-	Protocol      Protocol
+// logSampleRe matches access log sampling percentages, e.g. 1% or 0.5%
+var logSampleRe = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,2})?%$`)
+
+// ParseLogSample parses an access log sampling percentage of a label or the global setting,
+// normalized like 0.5%; empty keeps the global setting and 100% logs every request
+func ParseLogSample(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !logSampleRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a percentage like 1%% or 0.5%%", s)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || percent > 100 {
+		return "", fmt.Errorf("%q is not a percentage up to 100%%", s)
+	}
+	return strconv.FormatFloat(percent, 'f', -1, 64) + "%", nil
 }
 
-// HTTPMapping represents HTTP hostname-based routing configuration
-type HTTPMapping struct {
-	Hostnames     []string // list of hostnames for this container
-	ContainerPort int      // container HTTP port
-	HTTPS         bool     // whether to listen on 443 instead of 80
+// parseLimitRate parses a bandwidth limit, empty means no limit
+func parseLimitRate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !limitRateRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a rate like 500k or 2m (bytes per second)", s)
+	}
+	return strings.ToLower(s), nil
 }
 
-// NewClient creates a new Docker client
-func NewClient(host string, log *lgr.Logger) (*Client, error) {
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(host),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+// parseBufferingOff parses proxy.http.buffering, on (default) or off
+func parseBufferingOff(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "on", "true":
+		return false, nil
+	case "off", "false":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%q is not on or off", s)
 	}
+}
 
-	log.Logf("INFO connecting to Docker socket=%s", host)
+// bufferSizeRe matches nginx buffer sizes, e.g. 4k
+var bufferSizeRe = regexp.MustCompile(`^([1-9][0-9]*)([km]?)$`)
 
-	// test connection
-	ctx := context.Background()
-	if _, err := cli.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping Docker daemon: %w", err)
+// default proxy_buffers of nginx on 4k page systems, used to check a lone proxy_buffer_size
+const (
+	defaultProxyBuffers    = 8
+	defaultProxyBufferSize = 4 << 10
+)
+
+// parseProxyBuffers parses proxy_buffers ("16 8k") and proxy_buffer_size ("16k")
+// Sizes nginx -t would reject are refused: the default proxy_busy_buffers_size, twice the
+// larger buffer, must fit in all proxy_buffers minus one
+func parseProxyBuffers(buffers, bufferSize string) (string, string, error) {
+	buffers = strings.ToLower(strings.Join(strings.Fields(buffers), " "))
+	bufferSize = strings.ToLower(strings.TrimSpace(bufferSize))
+
+	num, size := defaultProxyBuffers, defaultProxyBufferSize
+	if buffers != "" {
+		numStr, sizeStr, ok := strings.Cut(buffers, " ")
+		n, err := strconv.Atoi(numStr)
+		if !ok || err != nil || n < 2 || n > 1024 {
+			return "", "", fmt.Errorf("%q is not a buffer count (2-1024) and size like 16 8k", buffers)
+		}
+		if size, ok = parseBufferSize(sizeStr); !ok {
+			return "", "", fmt.Errorf("%q is not a buffer count and size like 16 8k", buffers)
+		}
+		num = n
 	}
 
-	log.Logf("DEBUG docker connection established")
+	headerSize := defaultProxyBufferSize
+	if bufferSize != "" {
+		var ok bool
+		if headerSize, ok = parseBufferSize(bufferSize); !ok {
+			return "", "", fmt.Errorf("%q is not a size like 16k", bufferSize)
+		}
+	}
 
-	return &Client{cli: cli, log: log}, nil
+	if busy := 2 * max(size, headerSize); (buffers != "" || bufferSize != "") && busy > (num-1)*size {
+		return "", "", fmt.Errorf("%d buffers of %s are too few for buffer_size %s, use at least %d",
+			num, sizeString(size), sizeString(headerSize), (busy+size-1)/size+1)
+	}
+	return buffers, bufferSize, nil
 }
 
-// ScanContainers finds all running containers with proxy labels
-func (c *Client) ScanContainers(ctx context.Context) ([]ContainerInfo, error) {
-	c.log.Logf("INFO scanning containers for proxy labels")
-	c.log.Logf("DEBUG [Docker] listing_all_containers")
+// minHeaderBufferSize is the smallest large header buffer, nginx refuses buffers below its connection pool size
+const minHeaderBufferSize = 1 << 10
 
-	containers, err := c.cli.ContainerList(ctx, container.ListOptions{})
+// parseHeaderBuffers parses large_client_header_buffers ("8 32k"), empty keeps the global setting
+func parseHeaderBuffers(s string) (string, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if s == "" {
+		return "", nil
+	}
+	numStr, sizeStr, ok := strings.Cut(s, " ")
+	num, err := strconv.Atoi(numStr)
+	if !ok || err != nil || num < 1 || num > 1024 {
+		return "", fmt.Errorf("%q is not a buffer count (1-1024) and size like 8 32k", s)
+	}
+	if size, ok := parseBufferSize(sizeStr); !ok || size < minHeaderBufferSize {
+		return "", fmt.Errorf("%q is not a buffer count and size of at least 1k like 8 32k", s)
+	}
+	return s, nil
+}
+
+// parseBufferSize converts an nginx size to bytes, sizes above 64m are refused
+func parseBufferSize(s string) (int, bool) {
+	m := bufferSizeRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
 	if err != nil {
-		return nil, fmt.Errorf("failed to list containers: %w", err)
+		return 0, false
 	}
+	switch m[2] {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	}
+	return n, n <= 64<<20
+}
 
-	c.log.Logf("DEBUG [Docker] found_running_containers count=%d", len(containers))
+// sizeString formats bytes as an nginx size
+func sizeString(n int) string {
+	switch {
+	case n%(1<<20) == 0:
+		return strconv.Itoa(n>>20) + "m"
+	case n%(1<<10) == 0:
+		return strconv.Itoa(n>>10) + "k"
+	default:
+		return strconv.Itoa(n)
+	}
+}
 
-	var results []ContainerInfo
-	for _, ctr := range containers {
-		info, err := c.parseContainer(ctx, ctr)
-		if err != nil {
-			c.log.Logf("WARN [Docker] container=%s parse_error=%q", ctr.Names[0], err)
+// countryCodeRe matches ISO 3166-1 alpha-2 country codes
+var countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// parseCountryCodes parses a comma-separated list of country codes, e.g. "DE,AT"
+func parseCountryCodes(s string) ([]string, error) {
+	var codes []string
+	for _, part := range strings.Split(s, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if code == "" {
 			continue
 		}
-		if info != nil {
-			results = append(results, *info)
+		if !countryCodeRe.MatchString(code) {
+			return nil, fmt.Errorf("%q is not a two-letter country code", part)
 		}
+		codes = append(codes, code)
 	}
-
-	c.log.Logf("INFO route discovery complete: containers=%d", len(results))
-	return results, nil
+	return codes, nil
 }
 
-//nolint:gocognit,gocyclo // complex parsing logic is unavoidable
-func (c *Client) parseContainer(ctx context.Context, ctr types.Container) (*ContainerInfo, error) {
-	name := strings.TrimPrefix(ctr.Names[0], "/")
-	id := ctr.ID[:12]
-
-	// get container IP
-	inspect, err := c.cli.ContainerInspect(ctx, ctr.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to inspect container: %w", err)
+// refererRe matches valid_referers hosts with an optional leading or trailing wildcard and path,
+// e.g. *.example.com, example.* or example.com/gallery/
+var refererRe = regexp.MustCompile(`^(\*\.)?([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.\*)?(/[A-Za-z0-9._~/-]*)?$`)
+
+// ParseCIDRs parses comma- or space-separated addresses and CIDRs, e.g. "192.168.0.0/16,10.0.0.5"
+// CIDRs are normalized to their network, 10.1.2.3/8 becomes 10.0.0.0/8
+func ParseCIDRs(s string) ([]string, error) {
+	var cidrs []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if addr, err := netip.ParseAddr(part); err == nil {
+			cidrs = append(cidrs, addr.String())
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR like 192.168.0.0/16", part)
+		}
+		cidrs = append(cidrs, prefix.Masked().String())
 	}
+	return cidrs, nil
+}
 
-	ip := inspect.NetworkSettings.IPAddress
-	if ip == "" {
-		// try default bridge network
-		for _, network := range inspect.NetworkSettings.Networks {
-			if network.IPAddress != "" {
-				ip = network.IPAddress
-				break
-			}
+// parseValidReferers parses a comma or space-separated list of valid_referers values
+// Regular expressions are refused, they would need quoting in the config
+func parseValidReferers(s string) ([]string, error) {
+	var referers []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		referer := strings.ToLower(part)
+		switch {
+		case referer == "none" || referer == "blocked" || referer == "server_names":
+		case !refererRe.MatchString(referer):
+			return nil, fmt.Errorf("%q is not none, blocked, server_names or a hostname like *.example.com", part)
+		}
+		if !slices.Contains(referers, referer) {
+			referers = append(referers, referer)
 		}
 	}
+	return referers, nil
+}
 
-	if ip == "" {
-		c.log.Logf("WARN [Docker] container=%s no_ip_address skipping", name)
-		return nil, nil
+// httpMethods are the methods proxy.http.allowed_methods accepts, WebDAV included
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS",
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+// parseAllowedMethods parses a comma or space-separated list of HTTP methods, GET adds HEAD
+func parseAllowedMethods(s string) ([]string, error) {
+	var methods []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		method := strings.ToUpper(part)
+		if !slices.Contains(httpMethods, method) {
+			return nil, fmt.Errorf("%q is not an HTTP method like GET, POST or DELETE", part)
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+		if method == "GET" && !slices.Contains(methods, "HEAD") {
+			methods = append(methods, "HEAD")
+		}
 	}
+	return methods, nil
+}
 
-	c.log.Logf("DEBUG [Docker] processing_container name=%s id=%s ip=%s", name, id, ip)
-
-	// read labels
-	c.log.Logf("DEBUG [Docker] reading_labels container=%s", name)
-
-	tcpPortsStr := ctr.Labels["proxy.tcp.ports"]
-	udpPortsStr := ctr.Labels["proxy.udp.ports"]
-	httpHostStr := ctr.Labels["proxy.http.host"]
-	httpPortStr := ctr.Labels["proxy.http.port"]
-	httpHTTPSStr := ctr.Labels["proxy.http.https"]
+// maxBodySizeRe matches nginx sizes, 0 disables the check
+var maxBodySizeRe = regexp.MustCompile(`^(0|[1-9][0-9]*[kKmMgG]?)$`)
 
-	c.log.Logf("DEBUG [Docker] container=%s proxy.tcp.ports=%q", name, tcpPortsStr)
-	c.log.Logf("DEBUG [Docker] container=%s proxy.udp.ports=%q", name, udpPortsStr)
-	c.log.Logf("DEBUG [Docker] container=%s proxy.http.host=%q", name, httpHostStr)
+// parseMaxBodySize parses the largest request body accepted, empty keeps the global setting
+func parseMaxBodySize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !maxBodySizeRe.MatchString(s) {
+		return "", fmt.Errorf("%q is not a size like 10m or 0 for unlimited", s)
+	}
+	return strings.ToLower(s), nil
+}
 
-	// skip if all labels are empty
-	if tcpPortsStr == "" && udpPortsStr == "" && httpHostStr == "" {
-		c.log.Logf("WARN [Docker] container=%s no proxy labels, skipping", name)
-		return nil, nil
+// parseUpstreamHost parses the Host header mode sent to the backend, see UpstreamHostPreserve
+func parseUpstreamHost(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", UpstreamHostPreserve, UpstreamHostUpstream:
+		return s, nil
+	}
+	name, port, hasPort := strings.Cut(s, ":")
+	if strings.Contains(name, "*") || !hostnameRe.MatchString(name) {
+		return "", fmt.Errorf("%q is not preserve, upstream or a hostname like app.internal", s)
+	}
+	if hasPort {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return "", fmt.Errorf("invalid port in %q", s)
+		}
 	}
+	return s, nil
+}
 
-	var mappings []PortMapping
-	tcpCount := 0
-	udpCount := 0
+// PassVar is an nginx variable sent to the backend in a request header
+type PassVar struct {
+	Header   string // e.g. X-Ssl-Client-S-Dn
+	Variable string // e.g. $ssl_client_s_dn
+}
 
-	// parse TCP port mappings
-	if tcpPortsStr != "" {
-		c.log.Logf("DEBUG [Docker] parsing_tcp_port_mappings container=%s input=%q", name, tcpPortsStr)
-		tcpMappings, err := parsePortMappings(tcpPortsStr)
-		if err != nil {
-			c.log.Logf("ERROR [Docker] container=%s invalid_tcp_port_mapping format=%q", name, tcpPortsStr)
-			c.log.Logf("WARN [Docker] skipping_container name=%s reason=invalid_configuration", name)
-			return nil, fmt.Errorf("invalid TCP port mappings: %w", err)
+var (
+	passVarRe    = regexp.MustCompile(`^\$[a-z][a-z0-9_]*$`)
+	headerNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+)
+
+// passVarProxy are the variables of the generated config that routes may pass
+var passVarProxy = []string{"$proxy_geoip_country_code", "$proxy_request_id"}
+
+// passVarReserved are the headers the generated config sets itself, the hop-by-hop and framing
+// headers nginx manages and the ones the auth subrequests rely on; Proxy-* headers are reserved too
+var passVarReserved = []string{"host", "x-real-ip", "x-forwarded-for", "x-forwarded-proto", "x-forwarded-host",
+	"x-request-id", "x-forwarded-user", "x-forwarded-email", "authorization", "upgrade", "connection",
+	"content-length", "transfer-encoding", "te", "trailer", "expect", "keep-alive",
+	"x-original-uri", "x-auth-request-redirect"}
+
+// parsePassVars parses comma-separated variables sent to the backend, each $variable or
+// Header-Name=$variable; the header defaults to X- and the title-cased variable name, e.g.
+// $ssl_client_s_dn is sent as X-Ssl-Client-S-Dn
+func parsePassVars(s string) ([]PassVar, error) {
+	var vars []PassVar
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
 		}
-		// tag with TCP protocol
-		for i := range tcpMappings {
-			tcpMappings[i].Protocol = TCP
-			mappings = append(mappings, tcpMappings[i])
-			c.log.Logf("DEBUG [Docker] container=%s parsed protocol=TCP proxy_port=%d container_port=%d",
-				name, tcpMappings[i].ProxyPort, tcpMappings[i].ContainerPort)
+		header, variable, named := strings.Cut(part, "=")
+		header, variable = strings.TrimSpace(header), strings.ToLower(strings.TrimSpace(variable))
+		if !named {
+			variable, header = strings.ToLower(header), ""
 		}
-		tcpCount = len(tcpMappings)
+		if !strings.HasPrefix(variable, "$") {
+			variable = "$" + variable
+		}
+		switch {
+		case !passVarRe.MatchString(variable):
+			return nil, fmt.Errorf("%q is not an nginx variable like $ssl_client_s_dn", part)
+		case strings.HasPrefix(variable, "$proxy_") && !slices.Contains(passVarProxy, variable):
+			return nil, fmt.Errorf("%s is internal to the proxy, only %s can be passed", variable, strings.Join(passVarProxy, " and "))
+		}
+		if header == "" {
+			words := strings.Split(strings.TrimPrefix(variable, "$"), "_")
+			for i, word := range words {
+				words[i] = strings.ToUpper(word[:1]) + word[1:]
+			}
+			header = "X-" + strings.Join(words, "-")
+		}
+		switch {
+		case !headerNameRe.MatchString(header):
+			return nil, fmt.Errorf("%q is not a header name like X-Client-DN", header)
+		case slices.Contains(passVarReserved, strings.ToLower(header)), strings.HasPrefix(strings.ToLower(header), "proxy-"):
+			return nil, fmt.Errorf("header %s is set by the proxy", header)
+		case seen[strings.ToLower(header)]:
+			return nil, fmt.Errorf("header %s is listed twice", header)
+		}
+		seen[strings.ToLower(header)] = true
+		vars = append(vars, PassVar{Header: header, Variable: variable})
 	}
+	return vars, nil
+}
 
-	// parse UDP port mappings
-	if udpPortsStr != "" {
-		c.log.Logf("DEBUG [Docker] parsing_udp_port_mappings container=%s input=%q", name, udpPortsStr)
-		udpMappings, err := parsePortMappings(udpPortsStr)
-		if err != nil {
-			c.log.Logf("ERROR [Docker] container=%s invalid_udp_port_mapping format=%q", name, udpPortsStr)
-			c.log.Logf("WARN [Docker] skipping_container name=%s reason=invalid_configuration", name)
-			return nil, fmt.Errorf("invalid UDP port mappings: %w", err)
+// parseMirror parses a mirror target, a hostname or container name with an optional port,
+// and the share of requests copied to it as 10 or 10%; empty copies every request
+func parseMirror(target, percent string) (string, int, error) {
+	target = strings.TrimSpace(target)
+	percent = strings.TrimSuffix(strings.TrimSpace(percent), "%")
+	if target == "" {
+		if percent != "" {
+			return "", 0, errors.New("mirror.percent needs a mirror target")
 		}
-		// tag with UDP protocol
-		for i := range udpMappings {
-			udpMappings[i].Protocol = UDP
-			mappings = append(mappings, udpMappings[i])
-			c.log.Logf("DEBUG [Docker] container=%s parsed protocol=UDP proxy_port=%d container_port=%d",
-				name, udpMappings[i].ProxyPort, udpMappings[i].ContainerPort)
+		return "", 0, nil
+	}
+	name, port, hasPort := strings.Cut(target, ":")
+	if !containerNameRe.MatchString(name) {
+		return "", 0, fmt.Errorf("%q is not a hostname or container name", target)
+	}
+	if hasPort {
+		if _, err := parseHTTPPort(port); err != nil {
+			return "", 0, fmt.Errorf("invalid port in %q", target)
 		}
-		udpCount = len(udpMappings)
 	}
+	if percent == "" {
+		return target, 100, nil
+	}
+	share, err := strconv.Atoi(percent)
+	if err != nil || share < 1 || share > 100 {
+		return "", 0, fmt.Errorf("%q is not a percentage between 1 and 100", percent)
+	}
+	return target, share, nil
+}
 
-	// parse HTTP hostname mapping
-	var httpMapping *HTTPMapping
-	if httpHostStr != "" {
-		c.log.Logf("DEBUG [Docker] parsing_http_host container=%s input=%q", name, httpHostStr)
-
-		// parse hostnames (comma-separated)
-		hostnames := strings.Split(httpHostStr, ",")
-		for i := range hostnames {
-			hostnames[i] = strings.TrimSpace(hostnames[i])
-		}
+// ParseForwardedMode parses an X-Forwarded-* mode, see ForwardedAppend; empty stays empty
+func ParseForwardedMode(s string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(s)); mode {
+	case "", ForwardedAppend, ForwardedOverwrite, ForwardedStrip:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%q is not append, overwrite or strip", s)
+	}
+}
 
-		// parse HTTP port (default: 80)
-		httpPort := 80
-		if httpPortStr != "" {
-			var err error
-			httpPort, err = strconv.Atoi(strings.TrimSpace(httpPortStr))
-			if err != nil {
-				c.log.Logf("ERROR [Docker] container=%s invalid_http_port format=%q", name, httpPortStr)
-				return nil, fmt.Errorf("invalid HTTP port: %w", err)
-			}
-			if httpPort < 1 || httpPort > 65535 {
-				return nil, fmt.Errorf("HTTP port %d out of range", httpPort)
+// ParseResolver parses comma or space-separated DNS server addresses with an optional port,
+// e.g. "1.1.1.1, [2606:4700:4700::1111]:53", into nginx resolver syntax; empty stays empty
+func ParseResolver(s string) (string, error) {
+	var servers []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		server := part
+		if addrPort, err := netip.ParseAddrPort(part); err == nil && addrPort.Port() != 0 {
+			server = addrPort.String()
+		} else if addr, err := netip.ParseAddr(strings.Trim(part, "[]")); err == nil && addr.Zone() == "" {
+			if server = addr.String(); addr.Is6() {
+				server = "[" + server + "]"
 			}
+		} else {
+			return "", fmt.Errorf("%q is not an IP address like 1.1.1.1 or 1.1.1.1:53", part)
 		}
+		if !slices.Contains(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+	return strings.Join(servers, " "), nil
+}
 
-		// parse HTTPS flag (default: false)
-		https := false
-		if httpHTTPSStr != "" {
-			https = strings.ToLower(strings.TrimSpace(httpHTTPSStr)) == "true"
+// parseAliases parses a comma-separated list of redirect hostnames, e.g. "www.example.com"
+// An alias may not be one of the routed hostnames, it would redirect to itself
+func parseAliases(s string, hostnames []string) ([]string, error) {
+	var aliases []string
+	for _, part := range strings.Split(s, ",") {
+		alias := strings.ToLower(strings.TrimSpace(part))
+		if alias == "" {
+			continue
+		}
+		if !hostnameRe.MatchString(alias) {
+			return nil, fmt.Errorf("%q is not a hostname", part)
+		}
+		if slices.Contains(hostnames, alias) {
+			return nil, fmt.Errorf("%q is also a routed hostname", alias)
 		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, nil
+}
+
+// parseExpiry parses an RFC 3339 time or a duration after the container was created,
+// empty never expires
+func parseExpiry(s string, created time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("%q is not a time like 2025-01-31T00:00:00Z or a duration like 72h", s)
+	}
+	return created.Add(d), nil
+}
 
-		httpMapping = &HTTPMapping{
-			Hostnames:     hostnames,
-			ContainerPort: httpPort,
-			HTTPS:         https,
+// parseSSHMapping parses the SSH gateway aliases and port, nil without aliases
+func parseSSHMapping(aliases, port string) (*SSHMapping, error) {
+	parsed, err := parseAliases(aliases, nil)
+	if err != nil {
+		return nil, fmt.Errorf("proxy.ssh.alias: %w", err)
+	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
+	for _, alias := range parsed {
+		if strings.HasPrefix(alias, "*.") {
+			return nil, fmt.Errorf("proxy.ssh.alias: wildcard %q is not supported", alias)
 		}
+	}
 
-		c.log.Logf("INFO [Docker] container=%s http_mapping hostnames=%d port=%d https=%t",
-			name, len(hostnames), httpPort, https)
+	containerPort, err := parseSSHPort(port)
+	if err != nil {
+		return nil, fmt.Errorf("proxy.ssh.port: %w", err)
 	}
+	return &SSHMapping{Aliases: parsed, ContainerPort: containerPort}, nil
+}
 
-	c.log.Logf("DEBUG [Docker] container=%s port_mappings_count=%d", name, len(mappings))
-	c.log.Logf("INFO [Docker] registered_container name=%s tcp_ports=%d udp_ports=%d http_hosts=%d",
-		name, tcpCount, udpCount, func() int {
-			if httpMapping != nil {
-				return len(httpMapping.Hostnames)
-			}
-			return 0
-		}())
+// parseSSHPort parses the container's SSH port, empty is 22
+func parseSSHPort(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 22, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a port", s)
+	}
+	return port, nil
+}
 
-	return &ContainerInfo{
-		Name:        name,
-		ID:          id,
-		IP:          ip,
-		Mappings:    mappings,
-		HTTPMapping: httpMapping,
-	}, nil
+// parseBool parses a boolean label value like strconv.ParseBool, e.g. true, false, 1 or 0,
+// an empty value is false; labels and lint share it so both agree on what counts as true
+func parseBool(value string) (bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// labelBool returns a boolean label, values that are not booleans are false and reported by the lint
+func labelBool(value string) bool {
+	b, err := parseBool(value)
+	return err == nil && b
+}
+
+// optionalBool parses a boolean label that overrides a global setting, nil when unset or invalid
+func (c *Client) optionalBool(name, label string, labels map[string]string) *bool {
+	value := strings.TrimSpace(labels[label])
+	if value == "" {
+		return nil
+	}
+	b, err := parseBool(value)
+	if err != nil {
+		c.log.Logf("WARN [Docker] container=%s label=%s value=%q is not a boolean, using the global setting", name, label, value)
+		return nil
+	}
+	return &b
 }
 
 // parsePortMappings parses the proxy.ports label
-// Format: "80:1080,443:1443,53,8080"
+// Format: "80:1080,443:1443,53,8080", each entry may carry options: "5432;timeout=30m"
 //
 //nolint:gocognit // complex parsing logic is unavoidable
 func parsePortMappings(s string) ([]PortMapping, error) {
@@ -262,8 +1684,12 @@ func parsePortMappings(s string) ([]PortMapping, error) {
 	mappings := make([]PortMapping, 0, len(parts))
 
 	for _, part := range parts {
-		part = strings.TrimSpace(part)
+		entry, options, _ := strings.Cut(part, ";")
+		part = strings.TrimSpace(entry)
 		if part == "" {
+			if strings.TrimSpace(options) != "" {
+				return nil, fmt.Errorf("port options %q without a port", options)
+			}
 			continue
 		}
 
@@ -303,15 +1729,48 @@ func parsePortMappings(s string) ([]PortMapping, error) {
 			return nil, fmt.Errorf("container port %d out of range", containerPort)
 		}
 
-		mappings = append(mappings, PortMapping{
+		mapping := PortMapping{
 			ProxyPort:     proxyPort,
 			ContainerPort: containerPort,
-		})
+		}
+		if err := parsePortOptions(&mapping, options); err != nil {
+			return nil, fmt.Errorf("invalid options of port %d: %w", proxyPort, err)
+		}
+		mappings = append(mappings, mapping)
 	}
 
 	return mappings, nil
 }
 
+// parsePortOptions parses the ";"-separated key=value options of a port mapping entry
+func parsePortOptions(mapping *PortMapping, options string) error {
+	for _, option := range strings.Split(options, ";") {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(option, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("option %q is not key=value", strings.TrimSpace(option))
+		}
+		var dst *string
+		switch key {
+		case "timeout":
+			dst = &mapping.Timeout
+		case "connect_timeout":
+			dst = &mapping.ConnectTimeout
+		default:
+			return fmt.Errorf("unknown option %q, expected timeout or connect_timeout", key)
+		}
+		t, err := parseNginxTime(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*dst = t
+	}
+	return nil
+}
+
 // EventType represents container lifecycle events
 type EventType string
 
@@ -322,6 +1781,12 @@ const (
 	EventStop EventType = "stop"
 	// EventDie represents a container die event
 	EventDie EventType = "die"
+	// EventUpdate represents a docker container update, applied without a restart
+	EventUpdate EventType = "update"
+	// EventRename represents a container rename, OldName holds the previous name
+	EventRename EventType = "rename"
+	// EventHealthStatus represents a health check status change, e.g. to healthy
+	EventHealthStatus EventType = "health_status"
 )
 
 // ContainerEvent represents a Docker container event
@@ -329,6 +1794,7 @@ type ContainerEvent struct {
 	Type        EventType
 	ContainerID string
 	Name        string
+	OldName     string // previous name of a rename event
 	Timestamp   time.Time
 }
 
@@ -347,7 +1813,16 @@ func (c *Client) WatchEvents(ctx context.Context) (<-chan ContainerEvent, <-chan
 		eventFilters.Add("event", "start")
 		eventFilters.Add("event", "stop")
 		eventFilters.Add("event", "die")
-
+		eventFilters.Add("event", "update")
+		eventFilters.Add("event", "rename")
+		eventFilters.Add("event", "health_status")
+
+		// every (re)subscription waits for the rate, a watcher reconnecting in a loop cannot
+		// hammer the daemon; it is not counted against the budget, so scans cannot starve it
+		if err := c.throttle(ctx, "events"); err != nil {
+			errCh <- fmt.Errorf("failed to subscribe to events: %w", err)
+			return
+		}
 		eventStream, eventErrCh := c.cli.Events(ctx, types.EventsOptions{
 			Filters: eventFilters,
 		})
@@ -357,15 +1832,25 @@ func (c *Client) WatchEvents(ctx context.Context) (<-chan ContainerEvent, <-chan
 		for {
 			select {
 			case event := <-eventStream:
+				eventType := EventType(event.Action)
+				if strings.HasPrefix(string(event.Action), string(EventHealthStatus)) {
+					eventType = EventHealthStatus // the action is e.g. "health_status: healthy"
+				}
 				containerEvent := ContainerEvent{
-					Type:        EventType(event.Action),
+					Type:        eventType,
 					ContainerID: event.Actor.ID[:12],
 					Name:        strings.TrimPrefix(event.Actor.Attributes["name"], "/"),
+					OldName:     strings.TrimPrefix(event.Actor.Attributes["oldName"], "/"),
 					Timestamp:   time.Unix(event.Time, 0),
 				}
 
-				c.log.Logf("INFO [Docker] event type=%s container=%s id=%s",
-					containerEvent.Type, containerEvent.Name, containerEvent.ContainerID)
+				if containerEvent.OldName != "" {
+					c.log.Logf("INFO [Docker] event type=%s container=%s old_name=%s id=%s",
+						containerEvent.Type, containerEvent.Name, containerEvent.OldName, containerEvent.ContainerID)
+				} else {
+					c.log.Logf("INFO [Docker] event type=%s container=%s id=%s",
+						containerEvent.Type, containerEvent.Name, containerEvent.ContainerID)
+				}
 
 				eventCh <- containerEvent
 
@@ -391,11 +1876,14 @@ func (c *Client) EnsureNetwork(ctx context.Context, networkName string) error {
 	c.log.Logf("INFO ensuring docker network exists: %s", networkName)
 
 	// check if network already exists
+	if err := c.throttle(ctx, "network"); err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
 	networks, err := c.cli.NetworkList(ctx, types.NetworkListOptions{
 		Filters: filters.NewArgs(filters.Arg("name", networkName)),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to list networks: %w", err)
+		return fmt.Errorf("failed to list networks: %w", permissionError(err))
 	}
 
 	// network exists (exact match required)
@@ -417,7 +1905,7 @@ func (c *Client) EnsureNetwork(ctx context.Context, networkName string) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create network: %w", err)
+		return fmt.Errorf("failed to create network: %w", permissionError(err))
 	}
 
 	c.log.Logf("INFO network created successfully: %s (id=%s)", networkName, resp.ID[:12])
@@ -431,3 +1919,39 @@ func (c *Client) Close() error {
 
 	return c.cli.Close()
 }
+
+// absPathRe matches absolute paths that are safe to embed in root and server directives
+var absPathRe = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+
+// validAbsPath reports whether a static.root or socket label is an absolute path without traversal
+func validAbsPath(path string) bool {
+	if !absPathRe.MatchString(path) {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// hasHTTPRouteLabels reports whether any proxy.http.routes.<n>.* label is set
+func hasHTTPRouteLabels(labels map[string]string) bool {
+	for label := range labels {
+		if strings.HasPrefix(label, httpRoutesLabelStart) {
+			return true
+		}
+	}
+	return false
+}
+
+// validSecretRef reports whether a *.secret label value is a plain secret name
+// or a vault:<path>#<field> reference
+func validSecretRef(ref string) bool {
+	if rest, ok := strings.CutPrefix(ref, "vault:"); ok {
+		path, field, found := strings.Cut(rest, "#")
+		return found && strings.Trim(path, "/") != "" && field != ""
+	}
+	return secretNameRe.MatchString(ref)
+}
@@ -1,7 +1,13 @@
 package docker
 
 import (
+	"reflect"
+	"slices"
 	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/go-pkgz/lgr"
 )
 
 func TestParsePortMappings(t *testing.T) {
@@ -96,6 +102,40 @@ func TestParsePortMappings(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:  "port options",
+			input: "5432;timeout=30m, 2222:22; timeout=12H ;connect_timeout=5s,53",
+			want: []PortMapping{
+				{ProxyPort: 5432, ContainerPort: 5432, Timeout: "30m"},
+				{ProxyPort: 2222, ContainerPort: 22, Timeout: "12h", ConnectTimeout: "5s"},
+				{ProxyPort: 53, ContainerPort: 53},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "unknown port option",
+			input:   "5432;idle=30m",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "invalid port option time",
+			input:   "5432;timeout=30 minutes",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "port option without value",
+			input:   "5432;timeout",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "port options without port",
+			input:   ";timeout=30m",
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:  "complex realistic example",
 			input: "80:1080,443:1443,53,8080:3000,9000",
@@ -131,6 +171,10 @@ func TestParsePortMappings(t *testing.T) {
 					if mapping.ContainerPort != tt.want[i].ContainerPort {
 						t.Errorf("mapping[%d].ContainerPort = %d, want %d", i, mapping.ContainerPort, tt.want[i].ContainerPort)
 					}
+					if mapping.Timeout != tt.want[i].Timeout || mapping.ConnectTimeout != tt.want[i].ConnectTimeout {
+						t.Errorf("mapping[%d] timeouts = %q/%q, want %q/%q", i, mapping.Timeout, mapping.ConnectTimeout,
+							tt.want[i].Timeout, tt.want[i].ConnectTimeout)
+					}
 				}
 			}
 		})
@@ -318,3 +362,788 @@ func TestHTTPMapping(t *testing.T) {
 		}
 	})
 }
+
+func TestValidSecretRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{ref: "app_htpasswd", want: true},
+		{ref: "app.example.com-cert", want: true},
+		{ref: "vault:secret/data/app#cert", want: true},
+		{ref: "../etc/shadow", want: false},
+		{ref: "/run/secrets/app", want: false},
+		{ref: "vault:secret/data/app", want: false},
+		{ref: "vault:#cert", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := validSecretRef(tt.ref); got != tt.want {
+				t.Errorf("validSecretRef(%q) = %v, want %v", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkippedContainer(t *testing.T) {
+	ctr := types.Container{
+		ID:     "0123456789abcdef",
+		Names:  []string{"/web"},
+		Labels: map[string]string{"proxy.http.host": "app.example.com"},
+	}
+	got, ok := skippedContainer(ctr, errNoIPAddress)
+	if !ok {
+		t.Fatal("container with route labels should be reported as skipped")
+	}
+	want := SkippedContainer{Name: "web", ID: "0123456789ab", Reason: "no IP address", HTTP: true}
+	if got != want {
+		t.Errorf("skippedContainer() = %+v, want %+v", got, want)
+	}
+
+	ctr.Labels = map[string]string{"com.example.other": "x"}
+	if _, ok := skippedContainer(ctr, errNoIPAddress); ok {
+		t.Error("container without route labels should not be reported")
+	}
+}
+
+func TestHTTPRouteIndexes(t *testing.T) {
+	got, err := httpRouteIndexes(map[string]string{
+		"proxy.http.routes.10.host": "b.example.com",
+		"proxy.http.routes.2.host":  "a.example.com",
+		"proxy.http.routes.2.port":  "9090",
+		"proxy.http.host":           "c.example.com",
+	})
+	if err != nil {
+		t.Fatalf("httpRouteIndexes() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 10 {
+		t.Errorf("httpRouteIndexes() = %v, want [2 10]", got)
+	}
+
+	for _, label := range []string{"proxy.http.routes.x.host", "proxy.http.routes.0.host"} {
+		if _, err := httpRouteIndexes(map[string]string{label: "a.example.com"}); err == nil {
+			t.Errorf("httpRouteIndexes(%s) should fail", label)
+		}
+	}
+}
+
+func TestParseHTTPMapping(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	labels := map[string]string{
+		"proxy.http.routes.1.host":                 "app.example.com, www.example.com",
+		"proxy.http.routes.1.port":                 "3000",
+		"proxy.http.routes.1.upstream.auth.secret": "app_token",
+		"proxy.http.routes.2.host":                 "admin.example.com",
+		"proxy.http.routes.2.port":                 "9090",
+		"proxy.http.routes.2.tls.cert.secret":      "admin_cert",
+		"proxy.http.routes.2.tls.key.secret":       "admin_key",
+		"proxy.http.routes.3.port":                 "70000",
+		"proxy.http.routes.3.host":                 "bad.example.com",
+	}
+
+	got, err := c.parseHTTPMapping("app", httpRouteLabelPrefix(1), labels)
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if len(got.Hostnames) != 2 || got.Hostnames[1] != "www.example.com" || got.ContainerPort != 3000 || got.HTTPS ||
+		got.UpstreamAuthSecret != "app_token" {
+		t.Errorf("route 1 = %+v", got)
+	}
+
+	got, err = c.parseHTTPMapping("app", httpRouteLabelPrefix(2), labels)
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if got.ContainerPort != 9090 || !got.HTTPS || got.TLSCertSecret != "admin_cert" {
+		t.Errorf("route 2 = %+v, want https with its own certificate", got)
+	}
+
+	if _, err := c.parseHTTPMapping("app", httpRouteLabelPrefix(3), labels); err == nil {
+		t.Error("route 3 with out of range port should fail")
+	}
+
+	got, err = c.parseHTTPMapping("app", httpLabelPrefix, labels)
+	if err != nil || got != nil {
+		t.Errorf("parseHTTPMapping() without proxy.http.host = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestAllHTTPMappings(t *testing.T) {
+	info := ContainerInfo{
+		HTTPMapping: &HTTPMapping{Hostnames: []string{"main.example.com"}, ContainerPort: 80},
+		HTTPRoutes: []HTTPMapping{
+			{Hostnames: []string{"admin.example.com"}, ContainerPort: 9090},
+		},
+	}
+	got := info.AllHTTPMappings()
+	if len(got) != 2 || got[0].ContainerPort != 80 || got[1].ContainerPort != 9090 {
+		t.Errorf("AllHTTPMappings() = %+v", got)
+	}
+
+	info.HTTPMapping = nil
+	if got := info.AllHTTPMappings(); len(got) != 1 {
+		t.Errorf("AllHTTPMappings() without proxy.http.* mapping = %+v", got)
+	}
+}
+
+func TestParseHTTPMappingHostPorts(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host": "admin.example.com:9090, app.example.com:3000, www.example.com",
+		"proxy.http.port": "8080",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	wantPorts := map[string]int{"admin.example.com": 9090, "app.example.com": 3000, "www.example.com": 8080}
+	if len(got.Hostnames) != 3 {
+		t.Fatalf("Hostnames = %v", got.Hostnames)
+	}
+	for _, hostname := range got.Hostnames {
+		if got.PortFor(hostname) != wantPorts[hostname] {
+			t.Errorf("PortFor(%s) = %d, want %d", hostname, got.PortFor(hostname), wantPorts[hostname])
+		}
+	}
+
+	for _, host := range []string{"admin.example.com:abc", "admin.example.com:0"} {
+		if _, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{"proxy.http.host": host}); err == nil {
+			t.Errorf("parseHTTPMapping(%q) should fail", host)
+		}
+	}
+}
+
+func TestParseHTTPMappingBackendTLS(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("unifi", httpLabelPrefix, map[string]string{
+		"proxy.http.host":               "unifi.example.com",
+		"proxy.http.port":               "8443",
+		"proxy.http.backend_scheme":     "https",
+		"proxy.http.backend_ssl_verify": "true",
+		"proxy.http.backend_sni":        "unifi.local",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if !got.BackendHTTPS || !got.BackendSSLVerify || got.BackendSNI != "unifi.local" {
+		t.Errorf("parseHTTPMapping() = %+v, want https backend with verification and SNI", got)
+	}
+
+	got, err = c.parseHTTPMapping("web", httpLabelPrefix, map[string]string{
+		"proxy.http.host":               "web.example.com",
+		"proxy.http.backend_ssl_verify": "true",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if got.BackendHTTPS || got.BackendSSLVerify {
+		t.Errorf("backend_ssl_verify without backend_scheme=https should be ignored: %+v", got)
+	}
+
+	if _, err := c.parseHTTPMapping("web", httpLabelPrefix, map[string]string{
+		"proxy.http.host":           "web.example.com",
+		"proxy.http.backend_scheme": "ftp",
+	}); err == nil {
+		t.Error("parseHTTPMapping() should reject unknown backend schemes")
+	}
+}
+
+func TestParseHTTPMappingGRPC(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("api", httpLabelPrefix, map[string]string{
+		"proxy.http.host": "grpc.example.com",
+		"proxy.http.port": "50051",
+		"proxy.http.grpc": "true",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if !got.GRPC || !got.HTTPS {
+		t.Errorf("parseHTTPMapping() = %+v, want gRPC on an HTTPS listener", got)
+	}
+}
+
+func TestParseHTTPMappingHTTPSBoth(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("camera", httpLabelPrefix, map[string]string{
+		"proxy.http.host":  "cam.example.com",
+		"proxy.http.https": "Both",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if !got.HTTPS || !got.PlainHTTP {
+		t.Errorf("HTTPS = %t, PlainHTTP = %t, want both", got.HTTPS, got.PlainHTTP)
+	}
+
+	if _, err := c.parseHTTPMapping("api", httpLabelPrefix, map[string]string{
+		"proxy.http.host":  "api.example.com",
+		"proxy.http.https": "both",
+		"proxy.http.grpc":  "true",
+	}); err == nil {
+		t.Error("expected error for https=both with grpc")
+	}
+}
+
+func TestParseHTTPMappingProtocols(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host":  "app.example.com",
+		"proxy.http.https": "true",
+		"proxy.http.http2": "false",
+		"proxy.http.http3": "maybe",
+
+		"proxy.http.request_id": "true",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if got.HTTP2 == nil || *got.HTTP2 {
+		t.Errorf("HTTP2 = %v, want explicit false", got.HTTP2)
+	}
+	if got.HTTP3 != nil {
+		t.Errorf("HTTP3 = %v, want nil for an invalid value", *got.HTTP3)
+	}
+	if got.RequestID == nil || !*got.RequestID {
+		t.Errorf("RequestID = %v, want explicit true", got.RequestID)
+	}
+}
+
+func TestParseHTTPMappingSocket(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("php", "proxy.http.", map[string]string{
+		"proxy.http.host":   "app.example.com",
+		"proxy.http.socket": "/run/app/app.sock",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if got.Socket != "/run/app/app.sock" {
+		t.Errorf("Socket = %q, want /run/app/app.sock", got.Socket)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"relative path":    {"proxy.http.host": "app.example.com", "proxy.http.socket": "run/app.sock"},
+		"with static.root": {"proxy.http.host": "app.example.com", "proxy.http.socket": "/run/app.sock", "proxy.http.static.root": "/data/www"},
+	} {
+		if _, err := c.parseHTTPMapping("php", "proxy.http.", labels); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseHTTPMappingAliases(t *testing.T) {
+	c := &Client{log: lgr.New()}
+
+	got, err := c.parseHTTPMapping("web", "proxy.http.", map[string]string{
+		"proxy.http.host":    "example.com,shop.example.com",
+		"proxy.http.aliases": "www.example.com, WWW.shop.example.com,",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	if len(got.Aliases) != 2 || got.Aliases[0] != "www.example.com" || got.Aliases[1] != "www.shop.example.com" {
+		t.Errorf("Aliases = %v", got.Aliases)
+	}
+	if got.Primary() != "example.com" {
+		t.Errorf("Primary() = %q, want example.com", got.Primary())
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"invalid hostname": {"proxy.http.host": "example.com", "proxy.http.aliases": "https://www.example.com"},
+		"routed hostname":  {"proxy.http.host": "example.com,www.example.com", "proxy.http.aliases": "www.example.com"},
+	} {
+		if _, err := c.parseHTTPMapping("web", "proxy.http.", labels); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestValidAbsPath(t *testing.T) {
+	tests := map[string]bool{
+		"/data/www":          true,
+		"/srv/site-1/public": true,
+		"data/www":           false,
+		"/data/../etc":       false,
+		"/data/www; deny":    false,
+		"/data/{www}":        false,
+	}
+	for path, want := range tests {
+		if got := validAbsPath(path); got != want {
+			t.Errorf("validAbsPath(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
+
+func TestParseCountryCodes(t *testing.T) {
+	got, err := parseCountryCodes("de, AT,,ch")
+	if err != nil {
+		t.Fatalf("parseCountryCodes() error = %v", err)
+	}
+	if len(got) != 3 || got[0] != "DE" || got[1] != "AT" || got[2] != "CH" {
+		t.Errorf("parseCountryCodes() = %v, want [DE AT CH]", got)
+	}
+
+	for _, input := range []string{"DEU", "D1", "DE;AT"} {
+		if _, err := parseCountryCodes(input); err == nil {
+			t.Errorf("parseCountryCodes(%q) should fail", input)
+		}
+	}
+
+	c := &Client{log: lgr.New()}
+	if _, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host":      "app.example.com",
+		"proxy.http.geo.allow": "DE",
+		"proxy.http.geo.deny":  "US",
+	}); err == nil {
+		t.Error("parseHTTPMapping() should reject geo.allow combined with geo.deny")
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	conn, err := parseLimitConn(" 4 ")
+	if err != nil || conn != 4 {
+		t.Errorf("parseLimitConn() = %d, %v, want 4", conn, err)
+	}
+	rate, err := parseLimitRate("2M")
+	if err != nil || rate != "2m" {
+		t.Errorf("parseLimitRate() = %q, %v, want 2m", rate, err)
+	}
+	if conn, err := parseLimitConn(""); err != nil || conn != 0 {
+		t.Errorf("parseLimitConn(\"\") = %d, %v, want no limit", conn, err)
+	}
+
+	for _, input := range []string{"0", "-1", "many", "70000"} {
+		if _, err := parseLimitConn(input); err == nil {
+			t.Errorf("parseLimitConn(%q) should fail", input)
+		}
+	}
+	for _, input := range []string{"0", "1.5m", "2mb", "500k;", "fast"} {
+		if _, err := parseLimitRate(input); err == nil {
+			t.Errorf("parseLimitRate(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseOIDC(t *testing.T) {
+	p := httpLabelPrefix
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    *OIDC
+		wantErr bool
+	}{
+		{name: "disabled", labels: map[string]string{}},
+		{
+			name:   "oauth2-proxy by default",
+			labels: map[string]string{p + "oidc.auth_url": "http://oauth2-proxy:4180/"},
+			want:   &OIDC{Provider: OIDCOAuth2Proxy, AuthURL: "http://oauth2-proxy:4180"},
+		},
+		{
+			name: "vouch",
+			labels: map[string]string{p + "oidc.auth_url": "http://vouch:9090", p + "oidc.provider": "Vouch",
+				p + "oidc.login_url": "https://login.example.com"},
+			want: &OIDC{Provider: OIDCVouch, AuthURL: "http://vouch:9090", LoginURL: "https://login.example.com"},
+		},
+		{name: "vouch without login url", labels: map[string]string{p + "oidc.auth_url": "http://vouch:9090", p + "oidc.provider": "vouch"}, wantErr: true},
+		{name: "login url with oauth2-proxy", labels: map[string]string{p + "oidc.auth_url": "http://oauth2-proxy:4180", p + "oidc.login_url": "https://login.example.com"}, wantErr: true},
+		{name: "auth url with path", labels: map[string]string{p + "oidc.auth_url": "http://oauth2-proxy:4180/oauth2/auth"}, wantErr: true},
+		{name: "auth url injection", labels: map[string]string{p + "oidc.auth_url": "http://oauth2-proxy:4180; return 200"}, wantErr: true},
+		{name: "unknown provider", labels: map[string]string{p + "oidc.auth_url": "http://authelia:9091", p + "oidc.provider": "authelia"}, wantErr: true},
+		{name: "provider without auth url", labels: map[string]string{p + "oidc.provider": "vouch"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOIDC(p, tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOIDC() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("parseOIDC() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValidReferers(t *testing.T) {
+	got, err := parseValidReferers("none, blocked server_names  *.Example.com,example.*, example.org/gallery/, none")
+	want := []string{"none", "blocked", "server_names", "*.example.com", "example.*", "example.org/gallery/"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseValidReferers() = %v, %v, want %v", got, err, want)
+	}
+	if got, err := parseValidReferers(""); err != nil || got != nil {
+		t.Errorf("parseValidReferers(\"\") = %v, %v, want no check", got, err)
+	}
+	for _, input := range []string{"~\\.google\\.", "https://example.com", "example.com;", "*example.com", "$host"} {
+		if _, err := parseValidReferers(input); err == nil {
+			t.Errorf("parseValidReferers(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	got, err := ParseCIDRs("10.1.2.3/8, 192.168.1.5 fd00::/8,::1")
+	want := []string{"10.0.0.0/8", "192.168.1.5", "fd00::/8", "::1"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("ParseCIDRs() = %v, %v, want %v", got, err, want)
+	}
+	for _, input := range []string{"10.0.0.0/33", "lan", "192.168.1.0/24;"} {
+		if _, err := ParseCIDRs(input); err == nil {
+			t.Errorf("ParseCIDRs(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseHTTPMappingInternal(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	got, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host": "app.example.com", "proxy.http.allow_from": "192.168.1.0/24,10.0.0.7",
+	})
+	if err != nil || !slices.Equal(got.AllowFrom, []string{"192.168.1.0/24", "10.0.0.7"}) || got.InternalOnly {
+		t.Errorf("parseHTTPMapping() = %+v, %v, want allow_from networks", got, err)
+	}
+	got, err = c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host": "app.example.com", "proxy.http.internal_only": "true",
+	})
+	if err != nil || !got.InternalOnly || got.AllowFrom != nil {
+		t.Errorf("parseHTTPMapping() = %+v, %v, want internal only", got, err)
+	}
+	if _, err := c.parseHTTPMapping("app", httpLabelPrefix, map[string]string{
+		"proxy.http.host": "app.example.com", "proxy.http.internal_only": "true", "proxy.http.allow_from": "10.0.0.0/8",
+	}); err == nil {
+		t.Error("parseHTTPMapping() should refuse internal_only with allow_from")
+	}
+}
+
+func TestParseMirror(t *testing.T) {
+	tests := []struct {
+		target, percent string
+		want            string
+		wantPercent     int
+		wantErr         bool
+	}{
+		{target: "", want: ""},
+		{target: "staging.example.com", want: "staging.example.com", wantPercent: 100},
+		{target: " app-staging:8080 ", percent: "10%", want: "app-staging:8080", wantPercent: 10},
+		{target: "app_staging", percent: "25", want: "app_staging", wantPercent: 25},
+		{target: "", percent: "10", wantErr: true},
+		{target: "http://staging", wantErr: true},
+		{target: "staging:0", wantErr: true},
+		{target: "staging", percent: "0", wantErr: true},
+		{target: "staging", percent: "150%", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, percent, err := parseMirror(tt.target, tt.percent)
+		if (err != nil) != tt.wantErr || got != tt.want || percent != tt.wantPercent {
+			t.Errorf("parseMirror(%q, %q) = %q, %d, %v, want %q, %d (error %t)",
+				tt.target, tt.percent, got, percent, err, tt.want, tt.wantPercent, tt.wantErr)
+		}
+	}
+}
+
+func TestParsePassVars(t *testing.T) {
+	got, err := parsePassVars("$ssl_client_s_dn, X-Country=$proxy_geoip_country_code,X-Nginx-Request=request_id")
+	want := []PassVar{
+		{Header: "X-Ssl-Client-S-Dn", Variable: "$ssl_client_s_dn"},
+		{Header: "X-Country", Variable: "$proxy_geoip_country_code"},
+		{Header: "X-Nginx-Request", Variable: "$request_id"},
+	}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("parsePassVars() = %v, %v, want %v", got, err, want)
+	}
+	if got, err := parsePassVars(""); err != nil || got != nil {
+		t.Errorf("parsePassVars(\"\") = %v, %v, want none", got, err)
+	}
+	// $request_id defaults to X-Request-Id, which proxy.http.request_id sets
+	for _, input := range []string{"$request_id", "$Host;", "X Client=$ssl_client_s_dn", "Host=$ssl_client_s_dn", "$proxy_upstream_authorization",
+		"$ssl_client_s_dn,x-ssl-client-s-dn=$ssl_client_i_dn"} {
+		if _, err := parsePassVars(input); err == nil {
+			t.Errorf("parsePassVars(%q) should fail", input)
+		}
+	}
+	// framing, hop-by-hop and auth subrequest headers would smuggle or spoof requests
+	for _, header := range []string{"Content-Length", "Transfer-Encoding", "TE", "Trailer", "Expect", "Keep-Alive",
+		"Proxy-Authorization", "Proxy-Connection", "X-Original-URI", "X-Auth-Request-Redirect"} {
+		if _, err := parsePassVars(header + "=$ssl_client_s_dn"); err == nil {
+			t.Errorf("parsePassVars() should reserve %s", header)
+		}
+	}
+}
+
+func TestParseAllowedMethods(t *testing.T) {
+	got, err := parseAllowedMethods("get, POST options,post")
+	want := []string{"GET", "HEAD", "POST", "OPTIONS"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseAllowedMethods() = %v, %v, want %v", got, err, want)
+	}
+	if got, err := parseAllowedMethods(""); err != nil || got != nil {
+		t.Errorf("parseAllowedMethods(\"\") = %v, %v, want every method", got, err)
+	}
+	for _, input := range []string{"GET|POST", "FETCH", "GET;"} {
+		if _, err := parseAllowedMethods(input); err == nil {
+			t.Errorf("parseAllowedMethods(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseMaxBodySize(t *testing.T) {
+	for input, want := range map[string]string{"": "", " 10M ": "10m", "512k": "512k", "0": "0"} {
+		if got, err := parseMaxBodySize(input); err != nil || got != want {
+			t.Errorf("parseMaxBodySize(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"10mb", "-1", "01m", "1m;"} {
+		if _, err := parseMaxBodySize(input); err == nil {
+			t.Errorf("parseMaxBodySize(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseLogSample(t *testing.T) {
+	for input, want := range map[string]string{"": "", "1%": "1%", " 0.50% ": "0.5%", "100%": "100%", "0%": "0%"} {
+		if got, err := ParseLogSample(input); err != nil || got != want {
+			t.Errorf("ParseLogSample(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"1", "0.001%", "101%", "all", "1%; access_log off"} {
+		if _, err := ParseLogSample(input); err == nil {
+			t.Errorf("ParseLogSample(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseHeaderBuffers(t *testing.T) {
+	if got, err := parseHeaderBuffers(" 8  32K "); err != nil || got != "8 32k" {
+		t.Errorf("parseHeaderBuffers() = %q, %v, want \"8 32k\"", got, err)
+	}
+	if got, err := parseHeaderBuffers(""); err != nil || got != "" {
+		t.Errorf("parseHeaderBuffers(\"\") = %q, %v, want the global setting", got, err)
+	}
+	for _, input := range []string{"32k", "0 32k", "8 512", "8 32kb", "8 32k;", "8 128m"} {
+		if _, err := parseHeaderBuffers(input); err == nil {
+			t.Errorf("parseHeaderBuffers(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseProxyBuffers(t *testing.T) {
+	buffers, size, err := parseProxyBuffers(" 16  8K ", "16k")
+	if err != nil || buffers != "16 8k" || size != "16k" {
+		t.Errorf("parseProxyBuffers() = %q, %q, %v, want \"16 8k\", \"16k\"", buffers, size, err)
+	}
+	if buffers, size, err := parseProxyBuffers("", ""); err != nil || buffers != "" || size != "" {
+		t.Errorf("parseProxyBuffers(\"\", \"\") = %q, %q, %v, want nginx defaults", buffers, size, err)
+	}
+	if _, _, err := parseProxyBuffers("", "8k"); err != nil {
+		t.Errorf("parseProxyBuffers(\"\", 8k) error = %v", err)
+	}
+
+	tests := []struct{ buffers, size string }{
+		{"", "16k"},    // 8 default 4k buffers are too few for a 16k header buffer
+		{"2 4k", ""},   // busy buffers need 8k, only 4k usable
+		{"1 4k", ""},   // at least two buffers
+		{"16", ""},     // missing size
+		{"16 8kb", ""}, // not an nginx size
+		{"16 128m", ""},
+		{"", "16k;"},
+	}
+	for _, tt := range tests {
+		if _, _, err := parseProxyBuffers(tt.buffers, tt.size); err == nil {
+			t.Errorf("parseProxyBuffers(%q, %q) should fail", tt.buffers, tt.size)
+		}
+	}
+
+	for input, want := range map[string]bool{"": false, "on": false, "OFF": true, "false": true} {
+		if got, err := parseBufferingOff(input); err != nil || got != want {
+			t.Errorf("parseBufferingOff(%q) = %t, %v, want %t", input, got, err, want)
+		}
+	}
+	if _, err := parseBufferingOff("sometimes"); err == nil {
+		t.Error("parseBufferingOff(sometimes) should fail")
+	}
+}
+
+func TestParseStreamHash(t *testing.T) {
+	for _, input := range []string{"", "$remote_addr", " $binary_remote_addr ", "$remote_addr$server_port"} {
+		if _, err := parseStreamHash(input); err != nil {
+			t.Errorf("parseStreamHash(%q) error = %v", input, err)
+		}
+	}
+	for _, input := range []string{"remote_addr", "$remote_addr consistent", "$remote_addr;", "${remote_addr}"} {
+		if _, err := parseStreamHash(input); err == nil {
+			t.Errorf("parseStreamHash(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseNamespace(t *testing.T) {
+	for _, input := range []string{"", "team-a", " billing ", "a", "42"} {
+		if _, err := parseNamespace(input); err != nil {
+			t.Errorf("parseNamespace(%q) error = %v", input, err)
+		}
+	}
+	for _, input := range []string{"Team-A", "team_a", "-team", "team-", "../etc", "a-very-long-namespace-name-of-team-a"} {
+		if _, err := parseNamespace(input); err == nil {
+			t.Errorf("parseNamespace(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseSSHMapping(t *testing.T) {
+	tests := []struct {
+		aliases, port string
+		want          *SSHMapping
+		wantErr       bool
+	}{
+		{aliases: "DB-Shell, backup.lan", want: &SSHMapping{Aliases: []string{"db-shell", "backup.lan"}, ContainerPort: 22}},
+		{aliases: "git", port: "2222", want: &SSHMapping{Aliases: []string{"git"}, ContainerPort: 2222}},
+		{aliases: "", port: "2222", want: nil},
+		{aliases: "*.lan", wantErr: true},
+		{aliases: "db shell", wantErr: true},
+		{aliases: "git", port: "ssh", wantErr: true},
+		{aliases: "git", port: "70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSSHMapping(tt.aliases, tt.port)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSSHMapping(%q, %q) = %+v, %v, want %+v (error %t)", tt.aliases, tt.port, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   string
+	}{
+		{map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.service": "api"}, "shop/api"},
+		{map[string]string{"com.docker.swarm.service.name": "shop_api", "com.docker.compose.service": "api"}, "shop_api"},
+		{map[string]string{"com.docker.compose.project": "shop"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := serviceName(tt.labels); got != tt.want {
+			t.Errorf("serviceName(%v) = %q, want %q", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryPolicy(t *testing.T) {
+	got, err := parseNextUpstream("error, timeout http_502")
+	if err != nil || got != "error timeout http_502" {
+		t.Errorf("parseNextUpstream() = %q, %v, want \"error timeout http_502\"", got, err)
+	}
+	for _, input := range []string{"error,http_418", "off,error", "timeout;"} {
+		if _, err := parseNextUpstream(input); err == nil {
+			t.Errorf("parseNextUpstream(%q) should fail", input)
+		}
+	}
+
+	if retries, err := parseRetries("2"); err != nil || retries != 2 {
+		t.Errorf("parseRetries() = %d, %v, want 2", retries, err)
+	}
+	for _, input := range []string{"0", "101", "two"} {
+		if _, err := parseRetries(input); err == nil {
+			t.Errorf("parseRetries(%q) should fail", input)
+		}
+	}
+
+	if timeout, err := parseNginxTime("10S"); err != nil || timeout != "10s" {
+		t.Errorf("parseNginxTime() = %q, %v, want 10s", timeout, err)
+	}
+	for _, input := range []string{"0", "1.5s", "10 s", "1d"} {
+		if _, err := parseNginxTime(input); err == nil {
+			t.Errorf("parseNginxTime(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "2025-01-31T00:00:00Z", want: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{input: " 72h ", want: created.Add(72 * time.Hour)},
+		{input: ""},
+		{input: "-1h", wantErr: true},
+		{input: "0s", wantErr: true},
+		{input: "tomorrow", wantErr: true},
+		{input: "2025-01-31", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpiry(tt.input, created)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseExpiry(%q) = %v, %v, want %v (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLabelsChecksum(t *testing.T) {
+	labels := map[string]string{"proxy.http.host": "app.example.com", "proxy.http.auth.secret": "htpasswd"}
+	sum := LabelsChecksum(labels)
+	if len(sum) != 16 {
+		t.Errorf("LabelsChecksum() = %q, want 16 hex characters", sum)
+	}
+	if got := LabelsChecksum(map[string]string{"proxy.http.host": "app.example.com", "proxy.http.auth.secret": "htpasswd",
+		"com.docker.compose.version": "2.24.0"}); got != sum {
+		t.Errorf("LabelsChecksum() = %q with other labels, want %q", got, sum)
+	}
+	if got := LabelsChecksum(map[string]string{"proxy.http.host": "app.example.com"}); got == sum {
+		t.Error("LabelsChecksum() unchanged after removing a proxy label")
+	}
+}
+
+func TestParseUpstreamHost(t *testing.T) {
+	tests := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{input: "", want: ""},
+		{input: " Preserve ", want: UpstreamHostPreserve},
+		{input: "upstream", want: UpstreamHostUpstream},
+		{input: "Wiki.Internal", want: "wiki.internal"},
+		{input: "wiki.internal:8080", want: "wiki.internal:8080"},
+		{input: "*.internal", wantErr: true},
+		{input: "wiki.internal:http", wantErr: true},
+		{input: "wiki internal", wantErr: true},
+		{input: "$http_host", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseUpstreamHost(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseUpstreamHost(%q) = %q, %v, want %q (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	tests := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{input: "", want: ""},
+		{input: "1.1.1.1", want: "1.1.1.1"},
+		{input: " 1.1.1.1, 8.8.8.8:5353 1.1.1.1", want: "1.1.1.1 8.8.8.8:5353"},
+		{input: "2606:4700:4700::1111,[::1]:53", want: "[2606:4700:4700::1111] [::1]:53"},
+		{input: "[2606:4700:4700::1111]", want: "[2606:4700:4700::1111]"},
+		{input: "dns.google", wantErr: true},
+		{input: "1.1.1.1:0", wantErr: true},
+		{input: "1.1.1.1;", wantErr: true},
+		{input: "fe80::1%eth0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseResolver(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseResolver(%q) = %q, %v, want %q (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
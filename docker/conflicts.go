@@ -0,0 +1,217 @@
+package docker
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statuses of a Claim
+const (
+	ClaimOK       = "ok"
+	ClaimPooled   = "pooled"    // shared by replicas of a service or containers with one proxy.stream.hash
+	ClaimConflict = "conflict"  // generation fails
+	ClaimNearMiss = "near-miss" // generates, but likely routes differently than intended
+)
+
+// claimKinds are the kinds of claims, in report order
+var claimKinds = []string{"tcp", "udp", "ssh", "host"}
+
+// Claim is a proxy port, SSH alias or hostname with the container labels claiming it
+type Claim struct {
+	Kind   string // tcp, udp, ssh or host
+	Name   string // port, alias or lowercased hostname
+	Owners []ClaimOwner
+	Status string
+	Note   string // why the claim conflicts or nearly does
+}
+
+// ClaimOwner is a container label claiming a port, SSH alias or hostname
+type ClaimOwner struct {
+	Container string
+	Label     string
+	Port      int // backend port of a hostname, 0 for ports and aliases
+}
+
+// containerClaim is a port, SSH alias or hostname claimed by one label of a container
+type containerClaim struct {
+	kind, name string
+	label      string
+	what       string // e.g. TCP port 80
+	port       int    // backend port of a hostname
+	pool       string // containers with the same pool share the claim, empty for none
+}
+
+// containerClaims returns the ports, SSH aliases and hostnames claimed by the labels of
+// one container, invalid labels claim nothing
+func containerClaims(labels map[string]string) []containerClaim {
+	var claims []containerClaim
+	streamPool := ""
+	if hash, _ := parseStreamHash(labels["proxy.stream.hash"]); hash != "" { //nolint:errcheck // reported by lintContainer
+		streamPool = "hash " + hash
+	}
+	hostPool := ""
+	if service := serviceName(labels); service != "" {
+		hostPool = "service " + service
+	}
+
+	for _, proto := range []string{"tcp", "udp"} {
+		label := "proxy." + proto + ".ports"
+		mappings, err := parsePortMappings(labels[label])
+		if err != nil {
+			continue
+		}
+		for _, m := range mappings {
+			claims = append(claims, containerClaim{kind: proto, name: strconv.Itoa(m.ProxyPort), label: label,
+				what: fmt.Sprintf("%s port %d", strings.ToUpper(proto), m.ProxyPort), pool: streamPool})
+		}
+	}
+
+	if ssh, err := parseSSHMapping(labels["proxy.ssh.alias"], labels["proxy.ssh.port"]); err == nil && ssh != nil {
+		for _, alias := range ssh.Aliases {
+			claims = append(claims, containerClaim{kind: "ssh", name: alias, label: "proxy.ssh.alias",
+				what: fmt.Sprintf("SSH alias %s", alias), pool: streamPool})
+		}
+	}
+
+	for _, prefix := range append([]string{httpLabelPrefix}, routePrefixes(labels)...) {
+		defaultPort := 80
+		if routeLabels, _, err := applyHTTPPreset(prefix, labels); err == nil {
+			if port, err := parseHTTPPort(routeLabels[prefix+"port"]); err == nil {
+				defaultPort = port
+			}
+		}
+		for _, label := range []string{prefix + "host", prefix + "host." + AudienceInternal, prefix + "host." + AudienceExternal} {
+			for _, h := range strings.Split(labels[label], ",") {
+				h, portStr, _ := strings.Cut(strings.TrimSpace(h), ":")
+				if h == "" {
+					continue
+				}
+				port := defaultPort
+				if portStr != "" {
+					port, _ = parseHTTPPort(portStr) //nolint:errcheck // reported by lintContainer, 0 is unknown
+				}
+				claims = append(claims, containerClaim{kind: "host", name: strings.ToLower(h), label: label,
+					what: fmt.Sprintf("hostname %s", h), port: port, pool: hostPool})
+			}
+		}
+	}
+	return claims
+}
+
+// ClaimMatrix returns every port, SSH alias and hostname claimed by the labels of several
+// containers, keyed by container name, sorted by kind and name
+// Conflicts fail generation like in LintLabels. Near misses generate but are likely mistakes:
+// replicas sending one hostname to different backend ports, or a wildcard hostname also
+// covering a hostname of another container
+func ClaimMatrix(containers map[string]map[string]string) []Claim {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make(map[string]int)
+	var claims []Claim
+	pools := make(map[string][]string) // claim key -> pool of each owner
+	for _, name := range names {
+		for _, c := range containerClaims(containers[name]) {
+			key := c.kind + ":" + c.name
+			i, ok := index[key]
+			if !ok {
+				i = len(claims)
+				index[key] = i
+				claims = append(claims, Claim{Kind: c.kind, Name: c.name})
+			}
+			claims[i].Owners = append(claims[i].Owners, ClaimOwner{Container: name, Label: c.label, Port: c.port})
+			pools[key] = append(pools[key], c.pool)
+		}
+	}
+
+	for i := range claims {
+		claim := &claims[i]
+		poolsOf := pools[claim.Kind+":"+claim.Name]
+		switch {
+		case len(claim.Owners) == 1:
+			claim.Status = ClaimOK
+		case poolsOf[0] != "" && !slices.ContainsFunc(poolsOf, func(p string) bool { return p != poolsOf[0] }):
+			claim.Status = ClaimPooled
+		default:
+			claim.Status = ClaimConflict
+			claim.Note = fmt.Sprintf("claimed by %d labels, generation fails", len(claim.Owners))
+			continue
+		}
+		if ports := claimPorts(claim.Owners); len(ports) > 1 {
+			claim.Status = ClaimNearMiss
+			claim.Note = fmt.Sprintf("replicas forward to different ports %s", joinInts(ports))
+		}
+	}
+
+	// nginx prefers exact names, the wildcard container loses the hostname silently
+	for i := range claims {
+		wildcard := &claims[i]
+		suffix, ok := strings.CutPrefix(wildcard.Name, "*")
+		if wildcard.Kind != "host" || !ok {
+			continue
+		}
+		for j := range claims {
+			claim := &claims[j]
+			if claim.Kind != "host" || j == i || !strings.HasSuffix(claim.Name, suffix) || claim.Status == ClaimConflict ||
+				sharesContainer(claim.Owners, wildcard.Owners) {
+				continue
+			}
+			note := fmt.Sprintf("also matches %s of %s, the exact name wins", wildcard.Name, wildcard.Owners[0].Container)
+			if claim.Status == ClaimNearMiss {
+				note = claim.Note + ", " + note
+			}
+			claim.Status, claim.Note = ClaimNearMiss, note
+		}
+	}
+
+	slices.SortFunc(claims, func(a, b Claim) int {
+		if c := cmp.Compare(slices.Index(claimKinds, a.Kind), slices.Index(claimKinds, b.Kind)); c != 0 {
+			return c
+		}
+		if a.Kind == "tcp" || a.Kind == "udp" {
+			portA, _ := strconv.Atoi(a.Name) //nolint:errcheck // claimed as an int
+			portB, _ := strconv.Atoi(b.Name) //nolint:errcheck // claimed as an int
+			return cmp.Compare(portA, portB)
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return claims
+}
+
+// claimPorts returns the distinct known backend ports of a hostname's owners, sorted
+func claimPorts(owners []ClaimOwner) []int {
+	var ports []int
+	for _, owner := range owners {
+		if owner.Port != 0 && !slices.Contains(ports, owner.Port) {
+			ports = append(ports, owner.Port)
+		}
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// sharesContainer reports whether a container is among the owners of both claims
+func sharesContainer(a, b []ClaimOwner) bool {
+	for _, owner := range a {
+		if slices.ContainsFunc(b, func(o ClaimOwner) bool { return o.Container == owner.Container }) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinInts joins numbers like 8080 and 8081
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"testing"
+)
+
+func TestClaimMatrix(t *testing.T) {
+	claims := ClaimMatrix(map[string]map[string]string{
+		"db":     {"proxy.tcp.ports": "5432", "proxy.udp.ports": "53"},
+		"db2":    {"proxy.tcp.ports": "5432:5433"},
+		"dns":    {"proxy.udp.ports": "53"},
+		"web-1":  {"proxy.http.host": "app.example.com", "proxy.http.port": "8080", "com.docker.compose.project": "shop", "com.docker.compose.service": "web"},
+		"web-2":  {"proxy.http.host": "app.example.com:8081", "com.docker.compose.project": "shop", "com.docker.compose.service": "web"},
+		"api-1":  {"proxy.http.host": "api.example.com", "com.docker.compose.project": "shop", "com.docker.compose.service": "api"},
+		"api-2":  {"proxy.http.host": "API.example.com", "com.docker.compose.project": "shop", "com.docker.compose.service": "api"},
+		"portal": {"proxy.http.host": "*.example.com", "proxy.http.routes.1.host": "portal.example.com"},
+	})
+
+	want := []struct{ kind, name, status string }{
+		{"tcp", "5432", ClaimConflict},
+		{"udp", "53", ClaimConflict},
+		{"host", "*.example.com", ClaimOK},
+		{"host", "api.example.com", ClaimNearMiss},
+		{"host", "app.example.com", ClaimNearMiss},
+		{"host", "portal.example.com", ClaimOK},
+	}
+	if len(claims) != len(want) {
+		t.Fatalf("ClaimMatrix() = %+v, want %d claims", claims, len(want))
+	}
+	for i, w := range want {
+		if claims[i].Kind != w.kind || claims[i].Name != w.name || claims[i].Status != w.status {
+			t.Errorf("claims[%d] = %s %s %s (%s), want %s %s %s", i, claims[i].Kind, claims[i].Name, claims[i].Status,
+				claims[i].Note, w.kind, w.name, w.status)
+		}
+	}
+	if app := claims[4]; len(app.Owners) != 2 || app.Owners[0].Port != 8080 || app.Owners[1].Port != 8081 {
+		t.Errorf("app.example.com owners = %+v, want web-1 on 8080 and web-2 on 8081", app.Owners)
+	}
+	if api := claims[3]; len(api.Owners) != 2 || api.Note != "also matches *.example.com of portal, the exact name wins" {
+		t.Errorf("api.example.com = %+v, want the pooled replicas shadowing the wildcard", api)
+	}
+}
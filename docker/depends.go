@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// errWaitingForDependency marks containers skipped because a proxy.depends_on container is not ready
+var errWaitingForDependency = errors.New("waiting for proxy.depends_on")
+
+// containerNameRe matches Docker container and compose service names
+var containerNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// parseDependsOn parses the comma-separated containers or compose services the routes of self wait for
+func parseDependsOn(s, self string) ([]string, error) {
+	var deps []string
+	for _, part := range strings.Split(s, ",") {
+		dep := strings.TrimPrefix(strings.TrimSpace(part), "/")
+		switch {
+		case dep == "":
+			continue
+		case !containerNameRe.MatchString(dep):
+			return nil, fmt.Errorf("%q is not a container or service name", part)
+		case dep == self:
+			return nil, fmt.Errorf("%s cannot depend on itself", dep)
+		}
+		if !slices.Contains(deps, dep) {
+			deps = append(deps, dep)
+		}
+	}
+	return deps, nil
+}
+
+// containerHealth returns healthy, unhealthy or starting from the status of a listed container,
+// empty for containers without a health check
+func containerHealth(status string) string {
+	switch {
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
+
+// peer is a running container a proxy.depends_on entry may refer to
+type peer struct {
+	name    string
+	service string // see serviceName
+	health  string // see containerHealth
+	proxied bool   // has route labels, so it is only ready while routed
+}
+
+// matches reports whether dep names the peer for a dependent of the given service:
+// its container name, its swarm service or a compose service of the same project
+func (p peer) matches(dep, dependentService string) bool {
+	if p.name == dep || p.service == dep {
+		return true
+	}
+	project, _, ok := strings.Cut(dependentService, "/")
+	return ok && p.service == project+"/"+dep
+}
+
+// gateDependencies drops containers whose proxy.depends_on containers are not ready and returns
+// the reason per dropped container; a dependency is ready while it runs, is not unhealthy or
+// starting and, if it has route labels, is routed itself, so chains of dependencies are followed
+func gateDependencies(routed []ContainerInfo, running []types.Container) ([]ContainerInfo, map[string]string) {
+	peers := make([]peer, 0, len(running))
+	for _, ctr := range running {
+		labels := ctr.Labels
+		peers = append(peers, peer{
+			name:    strings.TrimPrefix(ctr.Names[0], "/"),
+			service: serviceName(labels),
+			health:  containerHealth(ctr.Status),
+			proxied: labels["proxy.tcp.ports"] != "" || labels["proxy.udp.ports"] != "" || hasHTTPHost(labels) ||
+				hasHTTPRouteLabels(labels) || labels["proxy.ssh.alias"] != "",
+		})
+	}
+
+	ready := make(map[string]bool, len(routed))
+	for _, info := range routed {
+		ready[info.Name] = true
+	}
+
+	// dropping a container may leave its dependents waiting, so repeat until nothing changes
+	waiting := make(map[string]string)
+	for changed := true; changed; {
+		changed = false
+		for _, info := range routed {
+			if !ready[info.Name] {
+				continue
+			}
+			for _, dep := range info.DependsOn {
+				if reason := waitingFor(dep, info, peers, ready); reason != "" {
+					ready[info.Name], waiting[info.Name], changed = false, reason, true
+					break
+				}
+			}
+		}
+	}
+	if len(waiting) == 0 {
+		return routed, nil
+	}
+
+	kept := make([]ContainerInfo, 0, len(routed)-len(waiting))
+	for _, info := range routed {
+		if ready[info.Name] {
+			kept = append(kept, info)
+		}
+	}
+	return kept, waiting
+}
+
+// waitingFor returns why dep of a container is not ready, empty when a matching peer is
+func waitingFor(dep string, info ContainerInfo, peers []peer, ready map[string]bool) string {
+	reason := dep + " is not running"
+	for _, p := range peers {
+		if p.name == info.Name || !p.matches(dep, info.Service) {
+			continue
+		}
+		switch {
+		case p.health == "unhealthy" || p.health == "starting":
+			reason = fmt.Sprintf("%s is %s", dep, p.health)
+		case p.proxied && !ready[p.name]:
+			reason = dep + " is not routed"
+		default:
+			return ""
+		}
+	}
+	return reason
+}
@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestParseDependsOn(t *testing.T) {
+	got, err := parseDependsOn(" api, /db,,api ", "web")
+	if want := []string{"api", "db"}; err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseDependsOn() = %v, %v, want %v", got, err, want)
+	}
+	if got, err := parseDependsOn("", "web"); err != nil || got != nil {
+		t.Errorf("parseDependsOn(\"\") = %v, %v, want none", got, err)
+	}
+	for _, input := range []string{"web", "api db", "search:9200"} {
+		if _, err := parseDependsOn(input, "web"); err == nil {
+			t.Errorf("parseDependsOn(%q) should fail", input)
+		}
+	}
+}
+
+func TestContainerHealth(t *testing.T) {
+	for status, want := range map[string]string{
+		"Up 5 minutes (healthy)":          "healthy",
+		"Up 5 minutes (unhealthy)":        "unhealthy",
+		"Up 3 seconds (health: starting)": "starting",
+		"Up 2 hours":                      "",
+	} {
+		if got := containerHealth(status); got != want {
+			t.Errorf("containerHealth(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestGateDependencies(t *testing.T) {
+	compose := func(service string) map[string]string {
+		return map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.service": service}
+	}
+	running := []types.Container{
+		{Names: []string{"/shop-db-1"}, Status: "Up 1 hour (healthy)", Labels: compose("db")},
+		{Names: []string{"/shop-cache-1"}, Status: "Up 2 seconds (health: starting)", Labels: compose("cache")},
+		{Names: []string{"/shop-api-1"}, Status: "Up 1 hour", Labels: map[string]string{
+			"com.docker.compose.project": "shop", "com.docker.compose.service": "api", "proxy.http.host": "api.example.com"}},
+		{Names: []string{"/search"}, Status: "Up 1 hour (unhealthy)"},
+		{Names: []string{"/billing"}, Status: "Up 1 hour", Labels: map[string]string{"proxy.http.host": "billing.example.com"}},
+		{Names: []string{"/docs"}, Status: "Up 1 hour", Labels: map[string]string{"proxy.http.host": "docs.example.com"}},
+	}
+	routed := []ContainerInfo{
+		{Name: "shop-api-1", Service: "shop/api", DependsOn: []string{"db"}},
+		{Name: "shop-web-1", Service: "shop/web", DependsOn: []string{"api", "shop-db-1"}},
+		{Name: "worker", DependsOn: []string{"cache"}}, // compose services only match within the project
+		{Name: "docs", DependsOn: []string{"search"}},
+		{Name: "admin", DependsOn: []string{"billing"}}, // has route labels but was not routed
+		{Name: "reports", DependsOn: []string{"docs"}},  // waits for a container dropped here
+		{Name: "static"},
+	}
+
+	kept, waiting := gateDependencies(routed, running)
+	var names []string
+	for _, info := range kept {
+		names = append(names, info.Name)
+	}
+	if want := []string{"shop-api-1", "shop-web-1", "static"}; !slices.Equal(names, want) {
+		t.Errorf("gateDependencies() kept %v, want %v", names, want)
+	}
+	for name, want := range map[string]string{
+		"worker":  "cache is not running",
+		"docs":    "search is unhealthy",
+		"admin":   "billing is not routed",
+		"reports": "docs is not routed",
+	} {
+		if waiting[name] != want {
+			t.Errorf("waiting[%s] = %q, want %q", name, waiting[name], want)
+		}
+	}
+
+	// a restarting API keeps the web frontend from being published
+	running[2].Status = "Up 2 seconds (health: starting)"
+	kept, waiting = gateDependencies(routed[:2], running)
+	if len(kept) != 1 || kept[0].Name != "shop-api-1" || waiting["shop-web-1"] != "api is starting" {
+		t.Errorf("gateDependencies() = %v, %v, want the frontend waiting", kept, waiting)
+	}
+}
@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// CopyFile writes content to dstPath inside a running container
+func (c *Client) CopyFile(ctx context.Context, containerName, dstPath string, content []byte) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	hdr := &tar.Header{
+		Name:    path.Base(dstPath),
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to build archive: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to build archive: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to build archive: %w", err)
+	}
+
+	if err := c.throttle(ctx, "exec"); err != nil {
+		return fmt.Errorf("failed to copy %s to container %s: %w", dstPath, containerName, err)
+	}
+	if err := c.cli.CopyToContainer(ctx, containerName, path.Dir(dstPath), &buf, types.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed to copy %s to container %s: %w", dstPath, containerName, err)
+	}
+
+	c.log.Logf("DEBUG copied file container=%s path=%s size=%d", containerName, dstPath, len(content))
+	return nil
+}
+
+// Exec runs a command inside a running container and returns its combined output and exit code
+func (c *Client) Exec(ctx context.Context, containerName string, cmd []string) (string, int, error) {
+	if err := c.throttle(ctx, "exec"); err != nil {
+		return "", 0, fmt.Errorf("failed to create exec in container %s: %w", containerName, err)
+	}
+	created, err := c.cli.ContainerExecCreate(ctx, containerName, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create exec in container %s: %w", containerName, permissionError(err))
+	}
+
+	if err := c.throttle(ctx, "exec"); err != nil {
+		return "", 0, fmt.Errorf("failed to start exec in container %s: %w", containerName, err)
+	}
+	attach, err := c.cli.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to start exec in container %s: %w", containerName, err)
+	}
+	defer attach.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, attach.Reader); err != nil {
+		return out.String(), 0, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	if err := c.throttle(ctx, "exec"); err != nil {
+		return out.String(), 0, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	inspect, err := c.cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return out.String(), 0, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+
+	c.log.Logf("DEBUG exec finished container=%s cmd=%v exit_code=%d", containerName, cmd, inspect.ExitCode)
+	return out.String(), inspect.ExitCode, nil
+}
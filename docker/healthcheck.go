@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthCheck probes the backends of an HTTP route, see proxy.http.healthcheck.*
+// nginx builds with the upstream check module probe actively, others mark a backend down
+// after Fails failed requests
+type HealthCheck struct {
+	Path     string        // request path of active checks, e.g. /healthz
+	Interval time.Duration // time between active checks (default: 5s)
+	Timeout  time.Duration // time an active check may take (default: 1s)
+	Fails    int           // consecutive failures marking a backend down (default: 3)
+}
+
+// health check defaults, used for labels that are not set
+const (
+	defaultHealthInterval = 5 * time.Second
+	defaultHealthTimeout  = time.Second
+	defaultHealthFails    = 3
+)
+
+// healthPathRe matches request paths safe to embed in check_http_send, without variables or quotes
+var healthPathRe = regexp.MustCompile(`^/[A-Za-z0-9._~!&()*+,=:@%/?-]*$`)
+
+// parseHealthCheck parses the <prefix>healthcheck.* labels, nil if <prefix>healthcheck.path is not set
+func parseHealthCheck(prefix string, labels map[string]string) (*HealthCheck, error) {
+	path := strings.TrimSpace(labels[prefix+"healthcheck.path"])
+	if path == "" {
+		for _, suffix := range []string{"healthcheck.interval", "healthcheck.timeout", "healthcheck.fails"} {
+			if _, ok := labels[prefix+suffix]; ok {
+				return nil, fmt.Errorf("%s%s needs %shealthcheck.path", prefix, suffix, prefix)
+			}
+		}
+		return nil, nil
+	}
+	if !healthPathRe.MatchString(path) {
+		return nil, fmt.Errorf("invalid %shealthcheck.path %q, expected a path like /healthz", prefix, path)
+	}
+
+	check := &HealthCheck{Path: path}
+	var err error
+	if check.Interval, err = parseHealthDuration(labels[prefix+"healthcheck.interval"], defaultHealthInterval); err != nil {
+		return nil, fmt.Errorf("invalid %shealthcheck.interval: %w", prefix, err)
+	}
+	if check.Timeout, err = parseHealthDuration(labels[prefix+"healthcheck.timeout"], defaultHealthTimeout); err != nil {
+		return nil, fmt.Errorf("invalid %shealthcheck.timeout: %w", prefix, err)
+	}
+	if check.Timeout > check.Interval {
+		return nil, fmt.Errorf("%shealthcheck.timeout %s is longer than %shealthcheck.interval %s", prefix, check.Timeout, prefix, check.Interval)
+	}
+	if check.Fails, err = parseHealthFails(labels[prefix+"healthcheck.fails"]); err != nil {
+		return nil, fmt.Errorf("invalid %shealthcheck.fails: %w", prefix, err)
+	}
+	return check, nil
+}
+
+// parseHealthDuration parses a health check interval or timeout, empty is def
+func parseHealthDuration(s string, def time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Millisecond {
+		return 0, fmt.Errorf("%q is not a duration like 5s or 500ms", s)
+	}
+	return d, nil
+}
+
+// parseHealthFails parses the failures marking a backend down, empty is the default
+func parseHealthFails(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultHealthFails, nil
+	}
+	fails, err := strconv.Atoi(s)
+	if err != nil || fails < 1 || fails > 100 {
+		return 0, fmt.Errorf("%q is not a number between 1 and 100", s)
+	}
+	return fails, nil
+}
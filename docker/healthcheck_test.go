@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	got, err := parseHealthCheck(httpLabelPrefix, map[string]string{"proxy.http.healthcheck.path": "/healthz"})
+	want := HealthCheck{Path: "/healthz", Interval: 5 * time.Second, Timeout: time.Second, Fails: 3}
+	if err != nil || got == nil || *got != want {
+		t.Errorf("parseHealthCheck() = %+v, %v, want the defaults", got, err)
+	}
+
+	got, err = parseHealthCheck("proxy.http.routes.1.", map[string]string{
+		"proxy.http.routes.1.healthcheck.path":     "/api/health?full=1",
+		"proxy.http.routes.1.healthcheck.interval": "10s",
+		"proxy.http.routes.1.healthcheck.timeout":  "500ms",
+		"proxy.http.routes.1.healthcheck.fails":    "5",
+	})
+	want = HealthCheck{Path: "/api/health?full=1", Interval: 10 * time.Second, Timeout: 500 * time.Millisecond, Fails: 5}
+	if err != nil || got == nil || *got != want {
+		t.Errorf("parseHealthCheck() = %+v, %v, want %+v", got, err, want)
+	}
+
+	if got, err := parseHealthCheck(httpLabelPrefix, map[string]string{}); err != nil || got != nil {
+		t.Errorf("parseHealthCheck() = %+v, %v, want no check", got, err)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"relative path":     {"proxy.http.healthcheck.path": "healthz"},
+		"quoted path":       {"proxy.http.healthcheck.path": `/health"`},
+		"variable in path":  {"proxy.http.healthcheck.path": "/$host"},
+		"bad interval":      {"proxy.http.healthcheck.path": "/", "proxy.http.healthcheck.interval": "5"},
+		"timeout too long":  {"proxy.http.healthcheck.path": "/", "proxy.http.healthcheck.timeout": "10s"},
+		"zero fails":        {"proxy.http.healthcheck.path": "/", "proxy.http.healthcheck.fails": "0"},
+		"interval, no path": {"proxy.http.healthcheck.interval": "5s"},
+	} {
+		if _, err := parseHealthCheck(httpLabelPrefix, labels); err == nil {
+			t.Errorf("%s: parseHealthCheck() should fail", name)
+		}
+	}
+}
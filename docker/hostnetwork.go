@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// host address settings besides an IP address, see ParseHostAddress
+const (
+	HostAddressGateway = "host-gateway" // the gateway of the default bridge network (default)
+	HostAddressOff     = "off"          // host network containers are skipped
+)
+
+// hostGatewayNetworks are the default bridge networks of Docker and Podman, whose gateway
+// is the host-gateway address
+var hostGatewayNetworks = []string{"bridge", "podman"}
+
+// ParseHostAddress validates the address host network containers are routed to: an IP
+// address, HostAddressGateway or HostAddressOff; empty is HostAddressGateway
+func ParseHostAddress(s string) (string, error) {
+	switch addr := strings.ToLower(strings.TrimSpace(s)); addr {
+	case "":
+		return HostAddressGateway, nil
+	case HostAddressGateway, HostAddressOff:
+		return addr, nil
+	default:
+		ip, err := netip.ParseAddr(addr)
+		if err != nil || ip.Zone() != "" {
+			return "", fmt.Errorf("invalid host address %q, expected an IP address, host-gateway or off", s)
+		}
+		return ip.String(), nil
+	}
+}
+
+// SetHostAddress sets the address of host network containers, see ParseHostAddress
+func (c *Client) SetHostAddress(addr string) {
+	c.hostMu.Lock()
+	c.hostAddr, c.hostIP = addr, ""
+	c.hostMu.Unlock()
+}
+
+// hostAddress returns the address of a container running with network_mode: host, the
+// host-gateway address is looked up once and kept for the lifetime of the client
+func (c *Client) hostAddress(ctx context.Context) (string, error) {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+
+	switch c.hostAddr {
+	case HostAddressOff:
+		return "", fmt.Errorf("%w: host network, host address is off", errNoIPAddress)
+	case "", HostAddressGateway:
+	default:
+		return c.hostAddr, nil
+	}
+	if c.hostIP != "" {
+		return c.hostIP, nil
+	}
+
+	for _, name := range hostGatewayNetworks {
+		if err := c.throttle(ctx, "network"); err != nil {
+			return "", fmt.Errorf("failed to inspect network %s: %w", name, err)
+		}
+		resource, err := c.cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+		if client.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect network %s: %w", name, err)
+		}
+		ip, ok := gatewayAddress(resource, c.family)
+		if !ok {
+			continue
+		}
+		c.log.Logf("INFO [Docker] host network containers routed to host-gateway=%s network=%s", ip, name)
+		c.hostIP = ip
+		return ip, nil
+	}
+	return "", fmt.Errorf("%w: host network, no gateway found on networks %s for host-gateway",
+		errNoIPAddress, strings.Join(hostGatewayNetworks, ", "))
+}
+
+// gatewayAddress picks the gateway of a network by the address family policy
+func gatewayAddress(resource types.NetworkResource, family string) (string, bool) {
+	var ipv4, ipv6 string
+	for _, cfg := range resource.IPAM.Config {
+		ip, err := netip.ParseAddr(cfg.Gateway)
+		switch {
+		case err != nil:
+		case ip.Is4() && ipv4 == "":
+			ipv4 = ip.String()
+		case ip.Is6() && ipv6 == "":
+			ipv6 = ip.String()
+		}
+	}
+	switch {
+	case family == AddressFamilyIPv4:
+		return ipv4, ipv4 != ""
+	case family == AddressFamilyIPv6, family == AddressFamilyPreferIPv6 && ipv6 != "", ipv4 == "":
+		return ipv6, ipv6 != ""
+	default:
+		return ipv4, true
+	}
+}
@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/go-pkgz/lgr"
+)
+
+func TestParseHostAddress(t *testing.T) {
+	for input, want := range map[string]string{"": HostAddressGateway, " OFF ": HostAddressOff, "192.168.1.10": "192.168.1.10", "FD00::1": "fd00::1"} {
+		if got, err := ParseHostAddress(input); err != nil || got != want {
+			t.Errorf("ParseHostAddress(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"docker.host", "fe80::1%eth0", "10.0.0.0/8"} {
+		if _, err := ParseHostAddress(input); err == nil {
+			t.Errorf("ParseHostAddress(%q): expected an error", input)
+		}
+	}
+}
+
+func TestGatewayAddress(t *testing.T) {
+	dualStack := types.NetworkResource{IPAM: network.IPAM{Config: []network.IPAMConfig{
+		{Subnet: "172.17.0.0/16", Gateway: "172.17.0.1"}, {Subnet: "fd00::/64", Gateway: "fd00::1"},
+	}}}
+	ipv4Only := types.NetworkResource{IPAM: network.IPAM{Config: []network.IPAMConfig{{Gateway: "172.17.0.1"}}}}
+
+	tests := []struct {
+		resource types.NetworkResource
+		family   string
+		want     string
+	}{
+		{resource: dualStack, want: "172.17.0.1"},
+		{resource: dualStack, family: AddressFamilyPreferIPv6, want: "fd00::1"},
+		{resource: ipv4Only, family: AddressFamilyPreferIPv6, want: "172.17.0.1"},
+		{resource: ipv4Only, family: AddressFamilyIPv6},
+		{resource: types.NetworkResource{}},
+	}
+	for _, tt := range tests {
+		got, ok := gatewayAddress(tt.resource, tt.family)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("gatewayAddress(%+v, %q) = %q, %t, want %q", tt.resource.IPAM.Config, tt.family, got, ok, tt.want)
+		}
+	}
+}
+
+// hostNetworkDocker answers inspects of host network containers, networks lists the default
+// bridge networks by name
+func hostNetworkDocker(t *testing.T, networks map[string]string) (*Client, *int) {
+	t.Helper()
+	inspects := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1.43")
+		var body any
+		switch {
+		case strings.HasPrefix(path, "/networks/"):
+			inspects++
+			gateway, ok := networks[strings.TrimPrefix(path, "/networks/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				body = map[string]string{"message": "network not found"}
+				break
+			}
+			body = types.NetworkResource{IPAM: network.IPAM{Config: []network.IPAMConfig{{Gateway: gateway}}}}
+		case strings.HasPrefix(path, "/containers/"):
+			body = types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{HostConfig: &container.HostConfig{NetworkMode: "host"}},
+				NetworkSettings:   &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{"host": {}}},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			body = map[string]string{"message": "page not found"}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{cli: cli, log: lgr.New()}, &inspects
+}
+
+func TestParseContainerHostNetwork(t *testing.T) {
+	ctx := context.Background()
+	ctr := types.Container{
+		ID:     strings.Repeat("a", 64),
+		Names:  []string{"/grafana"},
+		Labels: map[string]string{"proxy.http.host": "grafana.example.com", "proxy.http.port": "3000"},
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		networks map[string]string
+		want     string
+		inspects int
+	}{
+		{name: "host-gateway", networks: map[string]string{"bridge": "172.17.0.1"}, want: "172.17.0.1", inspects: 1},
+		{name: "podman", addr: HostAddressGateway, networks: map[string]string{"podman": "10.88.0.1"}, want: "10.88.0.1", inspects: 2},
+		{name: "configured address", addr: "192.168.1.10", want: "192.168.1.10"},
+		{name: "no gateway", networks: map[string]string{}, inspects: 4}, // retried on the next scan
+		{name: "off", addr: HostAddressOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, inspects := hostNetworkDocker(t, tt.networks)
+			c.SetHostAddress(tt.addr)
+
+			// a found host-gateway address is looked up once
+			for range 2 {
+				info, err := c.parseContainer(ctx, ctr)
+				if tt.want == "" {
+					if !errors.Is(err, errNoIPAddress) {
+						t.Fatalf("expected errNoIPAddress, got %+v, %v", info, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("parseContainer() error = %v", err)
+				}
+				if info.IP != tt.want || info.HTTPMapping.ContainerPort != 3000 {
+					t.Errorf("expected %s:3000, got %s:%d", tt.want, info.IP, info.HTTPMapping.ContainerPort)
+				}
+			}
+			if *inspects != tt.inspects {
+				t.Errorf("expected %d network inspects, got %d", tt.inspects, *inspects)
+			}
+		})
+	}
+}
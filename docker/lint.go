@@ -0,0 +1,859 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a label lint issue
+type Severity string
+
+const (
+	// SeverityError marks labels that make the container be skipped or routed incorrectly
+	SeverityError Severity = "error"
+	// SeverityWarning marks labels that are ignored or likely not what was intended
+	SeverityWarning Severity = "warning"
+)
+
+// LabelIssue describes one problem found in a container's proxy labels
+type LabelIssue struct {
+	Container string
+	Label     string
+	Value     string
+	Severity  Severity
+	Message   string
+	Fix       string // suggested fix, may be empty
+}
+
+// knownLabels are all labels read by the proxy, besides indexed routes
+var knownLabels = []string{
+	"proxy.tcp.ports",
+	"proxy.tcp.max_connections",
+	"proxy.tcp.preset",
+	"proxy.stream.hash",
+	"proxy.udp.ports",
+	"proxy.namespace",
+	"proxy.expires",
+	"proxy.schedule",
+	"proxy.depends_on",
+	"proxy.ssh.alias",
+	"proxy.ssh.port",
+	"proxy.http.host",
+	"proxy.http.host.internal",
+	"proxy.http.host.external",
+	"proxy.http.port",
+	"proxy.http.https",
+	"proxy.http.auth.secret",
+	"proxy.http.tls.cert.secret",
+	"proxy.http.tls.key.secret",
+	"proxy.http.upstream.auth.secret",
+	"proxy.http.backend_scheme",
+	"proxy.http.backend_ssl_verify",
+	"proxy.http.backend_sni",
+	"proxy.http.upstream_host",
+	"proxy.http.forwarded_headers",
+	"proxy.http.grpc",
+	"proxy.http.http2",
+	"proxy.http.http3",
+	"proxy.http.static.root",
+	"proxy.http.socket",
+	"proxy.http.aliases",
+	"proxy.http.acme",
+	"proxy.http.oidc.auth_url",
+	"proxy.http.oidc.provider",
+	"proxy.http.oidc.login_url",
+	"proxy.http.header_buffers",
+	"proxy.http.buffering",
+	"proxy.http.buffers",
+	"proxy.http.buffer_size",
+	"proxy.http.valid_referers",
+	"proxy.http.allowed_methods",
+	"proxy.http.resolver",
+	"proxy.http.max_body_size",
+	"proxy.http.geo.allow",
+	"proxy.http.geo.deny",
+	"proxy.http.request_id",
+	"proxy.http.access_log.sample",
+	"proxy.http.waf",
+	"proxy.http.block_bots",
+	"proxy.http.limit_conn",
+	"proxy.http.limit_rate",
+	"proxy.http.next_upstream",
+	"proxy.http.retries",
+	"proxy.http.next_upstream_timeout",
+	"proxy.http.read_timeout",
+	"proxy.http.internal_only",
+	"proxy.http.allow_from",
+	"proxy.http.preset",
+	"proxy.http.healthcheck.path",
+	"proxy.http.healthcheck.interval",
+	"proxy.http.healthcheck.timeout",
+	"proxy.http.healthcheck.fails",
+	"proxy.http.mirror",
+	"proxy.http.mirror.percent",
+	"proxy.http.pass_vars",
+}
+
+// httpLabelSuffixes are the labels of one HTTP route, after proxy.http. or proxy.http.routes.<n>.
+var httpLabelSuffixes = []string{"host", "host.internal", "host.external", "port", "https", "auth.secret", "tls.cert.secret", "tls.key.secret",
+	"upstream.auth.secret", "backend_scheme", "backend_ssl_verify", "backend_sni", "upstream_host", "forwarded_headers", "resolver", "grpc", "http2", "http3", "static.root",
+	"socket", "aliases", "acme", "oidc.auth_url", "oidc.provider", "oidc.login_url", "buffering", "buffers", "buffer_size",
+	"geo.allow", "geo.deny", "valid_referers", "allowed_methods", "max_body_size", "request_id", "access_log.sample", "waf", "block_bots", "limit_conn", "limit_rate", "header_buffers",
+	"next_upstream", "retries", "next_upstream_timeout", "read_timeout", "preset", "internal_only", "allow_from",
+	"healthcheck.path", "healthcheck.interval", "healthcheck.timeout", "healthcheck.fails", "mirror", "mirror.percent", "pass_vars"}
+
+// plaintextLabels carry credentials in labels and are ignored, mapped to their *.secret replacement
+var plaintextLabels = map[string]string{
+	"proxy.http.auth":       "proxy.http.auth.secret",
+	"proxy.http.auth.users": "proxy.http.auth.secret",
+	"proxy.http.tls.cert":   "proxy.http.tls.cert.secret",
+	"proxy.http.tls.key":    "proxy.http.tls.key.secret",
+}
+
+// hostnameRe matches DNS names, optionally with a leading wildcard label
+var hostnameRe = regexp.MustCompile(`^(\*\.)?([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+// LintLabels checks the proxy labels of several containers, keyed by container name
+// Every problem is reported, including port and hostname conflicts between containers
+// Issues are sorted by container name
+func LintLabels(containers map[string]map[string]string) []LabelIssue {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var issues []LabelIssue
+	owners := make(map[string]string) // "tcp:80", "udp:53", "host:example.com" -> container
+	for _, name := range names {
+		labels := containers[name]
+		issues = append(issues, lintContainer(name, labels)...)
+		issues = append(issues, lintConflicts(name, labels, owners)...)
+	}
+	return issues
+}
+
+//nolint:gocognit,gocyclo // one check per label
+func lintContainer(name string, labels map[string]string) []LabelIssue {
+	var issues []LabelIssue
+	add := func(sev Severity, label, msg, fix string) {
+		issues = append(issues, LabelIssue{Container: name, Label: label, Value: labels[label], Severity: sev, Message: msg, Fix: fix})
+	}
+
+	for _, label := range sortedKeys(labels) {
+		if rest, ok := strings.CutPrefix(label, httpRoutesLabelStart); ok {
+			indexStr, _, _ := strings.Cut(rest, ".")
+			if index, err := strconv.Atoi(indexStr); err != nil || index < 1 {
+				add(SeverityError, label, fmt.Sprintf("invalid route index %q", indexStr),
+					"number routes from 1, e.g. proxy.http.routes.1.host")
+				continue
+			}
+		}
+		if !strings.HasPrefix(label, "proxy.") || isKnownLabel(label) {
+			continue
+		}
+		if replacement, ok := plaintextLabels[label]; ok {
+			add(SeverityWarning, label, "plaintext credentials are not supported, label is ignored",
+				fmt.Sprintf("store the value as a Docker secret and reference it with %s", replacement))
+			continue
+		}
+		fix := ""
+		if suggestion := closestLabel(label); suggestion != "" {
+			fix = fmt.Sprintf("did you mean %s?", suggestion)
+		}
+		add(SeverityWarning, label, "unknown proxy label, ignored", fix)
+	}
+
+	for _, label := range []string{"proxy.tcp.ports", "proxy.udp.ports"} {
+		value, ok := labels[label]
+		if !ok {
+			continue
+		}
+		mappings, err := parsePortMappings(value)
+		if err != nil {
+			add(SeverityError, label, err.Error(), `use comma-separated ports or proxy:container pairs, e.g. "80:8080,443"`)
+			continue
+		}
+		if len(mappings) == 0 {
+			add(SeverityWarning, label, "no ports listed", "remove the label or list at least one port")
+		}
+		if label == "proxy.udp.ports" && slices.ContainsFunc(mappings, func(m PortMapping) bool { return m.ConnectTimeout != "" }) {
+			add(SeverityError, label, "connect_timeout only applies to TCP ports", "remove connect_timeout from the UDP ports")
+		}
+	}
+
+	if value, ok := labels["proxy.tcp.max_connections"]; ok {
+		if _, err := parseLimitConn(value); err != nil {
+			add(SeverityError, "proxy.tcp.max_connections", err.Error(), "use the number of concurrent connections per port, e.g. 50")
+		} else if _, tcp := labels["proxy.tcp.ports"]; !tcp {
+			add(SeverityWarning, "proxy.tcp.max_connections", "ignored without proxy.tcp.ports", "add proxy.tcp.ports or remove the label")
+		}
+	}
+
+	if value, ok := labels["proxy.tcp.preset"]; ok {
+		if _, err := parseTCPPreset(value); err != nil {
+			add(SeverityError, "proxy.tcp.preset", err.Error(), "use "+strings.Join(tcpPresetNames(), ", ")+" or remove the label")
+		} else if _, tcp := labels["proxy.tcp.ports"]; !tcp {
+			add(SeverityWarning, "proxy.tcp.preset", "ignored without proxy.tcp.ports", "add proxy.tcp.ports or remove the label")
+		}
+	}
+
+	if value, ok := labels["proxy.stream.hash"]; ok {
+		_, tcp := labels["proxy.tcp.ports"]
+		_, udp := labels["proxy.udp.ports"]
+		if _, err := parseStreamHash(value); err != nil {
+			add(SeverityError, "proxy.stream.hash", err.Error(), "use nginx variables, e.g. $remote_addr")
+		} else if !tcp && !udp {
+			add(SeverityWarning, "proxy.stream.hash", "ignored without proxy.tcp.ports or proxy.udp.ports",
+				"add stream ports or remove the label")
+		}
+	}
+
+	if value, ok := labels["proxy.namespace"]; ok {
+		if _, err := parseNamespace(value); err != nil {
+			add(SeverityError, "proxy.namespace", err.Error(), "use a short lowercase name, e.g. team-a")
+		}
+	}
+
+	if value, ok := labels["proxy.expires"]; ok {
+		if _, err := parseExpiry(value, time.Now()); err != nil {
+			add(SeverityError, "proxy.expires", err.Error(), "use an RFC 3339 time or a duration after the container was created, e.g. 72h")
+		}
+	}
+
+	if value, ok := labels["proxy.schedule"]; ok {
+		if _, err := parseSchedule(value); err != nil {
+			add(SeverityError, "proxy.schedule", err.Error(), "use days and times in local time, e.g. Mon-Fri 08:00-18:00")
+		}
+	}
+
+	if value, ok := labels["proxy.depends_on"]; ok {
+		if _, err := parseDependsOn(value, name); err != nil {
+			add(SeverityError, "proxy.depends_on", err.Error(), "use comma-separated container or compose service names, e.g. api,db")
+		}
+	}
+
+	if value, ok := labels["proxy.ssh.alias"]; ok {
+		if _, err := parseSSHMapping(value, ""); err != nil {
+			add(SeverityError, "proxy.ssh.alias", err.Error(), "use comma-separated names, e.g. db-shell,backup.lan")
+		}
+	}
+	if value, ok := labels["proxy.ssh.port"]; ok {
+		if _, err := parseSSHPort(value); err != nil {
+			add(SeverityError, "proxy.ssh.port", err.Error(), "use the container's SSH port, e.g. 2222")
+		} else if strings.TrimSpace(labels["proxy.ssh.alias"]) == "" {
+			add(SeverityWarning, "proxy.ssh.port", "ignored without proxy.ssh.alias", "add proxy.ssh.alias or remove the label")
+		}
+	}
+
+	issues = append(issues, lintHTTP(name, httpLabelPrefix, labels)...)
+	for _, prefix := range routePrefixes(labels) {
+		issues = append(issues, lintHTTP(name, prefix, labels)...)
+	}
+
+	return issues
+}
+
+// lintHTTP checks the labels of one HTTP route, proxy.http.* or an indexed route
+//
+//nolint:gocognit,gocyclo // one check per label
+func lintHTTP(name, prefix string, labels map[string]string) []LabelIssue {
+	var issues []LabelIssue
+	add := func(sev Severity, label, msg, fix string) {
+		issues = append(issues, LabelIssue{Container: name, Label: label, Value: labels[label], Severity: sev, Message: msg, Fix: fix})
+	}
+
+	hostLabel := prefix + "host"
+	host, hasHost := labels[hostLabel]
+	var audienceHosts []string
+	for _, audience := range []string{AudienceInternal, AudienceExternal} {
+		if _, ok := labels[hostLabel+"."+audience]; ok {
+			audienceHosts = append(audienceHosts, hostLabel+"."+audience)
+		}
+	}
+	for _, hostLabel := range append(audienceHosts, hostLabel) {
+		host, ok := labels[hostLabel]
+		if !ok {
+			continue
+		}
+		for _, h := range strings.Split(host, ",") {
+			h = strings.TrimSpace(h)
+			bare, portStr, hasPort := strings.Cut(h, ":")
+			switch {
+			case h == "":
+				add(SeverityError, hostLabel, "empty hostname in list", "remove empty entries and trailing commas")
+			case strings.Contains(h, "://") || strings.Contains(h, "/"):
+				add(SeverityError, hostLabel, fmt.Sprintf("hostname %q must not contain a scheme or path", h),
+					fmt.Sprintf("use the bare hostname and set the port with %sport or host:port", prefix))
+			case hasPort && !validHTTPPort(portStr):
+				add(SeverityError, hostLabel, fmt.Sprintf("invalid port in %q", h),
+					"use host:port with a port between 1 and 65535, e.g. admin.example.com:9090")
+			case !hostnameRe.MatchString(bare):
+				add(SeverityError, hostLabel, fmt.Sprintf("invalid hostname %q", h),
+					"use letters, digits, dots and hyphens only, e.g. app.example.com")
+			}
+		}
+	}
+
+	// a route without host makes the container be skipped, proxy.http.* labels are just ignored
+	missingHost := SeverityWarning
+	if prefix != httpLabelPrefix {
+		missingHost = SeverityError
+	}
+	for _, suffix := range httpLabelSuffixes[3:] {
+		if _, ok := labels[prefix+suffix]; ok && !hasHost && len(audienceHosts) == 0 {
+			add(missingHost, prefix+suffix, fmt.Sprintf("ignored without %s", hostLabel),
+				fmt.Sprintf("add %s or remove the label", hostLabel))
+		}
+	}
+
+	if value, ok := labels[prefix+"port"]; ok {
+		if _, err := parseHTTPPort(value); err != nil {
+			add(SeverityError, prefix+"port", err.Error(), "use a port number between 1 and 65535, e.g. 8080")
+		}
+	}
+
+	backendHTTPS := false
+	if value, ok := labels[prefix+"backend_scheme"]; ok {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "http":
+		case "https":
+			backendHTTPS = true
+		default:
+			add(SeverityError, prefix+"backend_scheme", fmt.Sprintf("invalid backend scheme %q", value), `use "http" or "https"`)
+		}
+	}
+	for _, suffix := range []string{"backend_ssl_verify", "grpc", "http2", "http3", "request_id", "waf", "block_bots", "acme"} {
+		value, ok := labels[prefix+suffix]
+		if !ok {
+			continue
+		}
+		if _, err := parseBool(value); err != nil {
+			add(SeverityWarning, prefix+suffix, fmt.Sprintf("%q is not a boolean, treated as false", value),
+				`use "true" or "false"`)
+		}
+	}
+	if value, ok := labels[prefix+"https"]; ok {
+		_, grpc := labels[prefix+"grpc"]
+		both := strings.EqualFold(strings.TrimSpace(value), "both")
+		_, err := parseBool(value)
+		switch {
+		case both && grpc:
+			add(SeverityError, prefix+"https", "both cannot be combined with grpc", `use "true", gRPC clients need TLS`)
+		case !both && err != nil:
+			add(SeverityWarning, prefix+"https", fmt.Sprintf("%q is not a boolean or both, treated as false", value),
+				`use "true", "false" or "both"`)
+		}
+	}
+	if value, ok := labels[prefix+"backend_sni"]; ok && !hostnameRe.MatchString(strings.TrimSpace(value)) {
+		add(SeverityError, prefix+"backend_sni", fmt.Sprintf("invalid server name %q", value),
+			"use the hostname on the backend certificate, e.g. unifi.local")
+	}
+	if value, ok := labels[prefix+"upstream_host"]; ok {
+		if _, err := parseUpstreamHost(value); err != nil {
+			add(SeverityError, prefix+"upstream_host", err.Error(), "use preserve, upstream or the name the backend expects, e.g. app.internal")
+		}
+	}
+	if value, ok := labels[prefix+"forwarded_headers"]; ok {
+		if _, err := ParseForwardedMode(value); err != nil {
+			add(SeverityError, prefix+"forwarded_headers", err.Error(), "use append, overwrite or strip")
+		}
+	}
+	for _, suffix := range []string{"backend_ssl_verify", "backend_sni"} {
+		if _, ok := labels[prefix+suffix]; ok && !backendHTTPS {
+			add(SeverityWarning, prefix+suffix, fmt.Sprintf("ignored without %sbackend_scheme=https", prefix),
+				fmt.Sprintf("set %sbackend_scheme to https or remove the label", prefix))
+		}
+	}
+
+	if value, ok := labels[prefix+"static.root"]; ok {
+		if !validAbsPath(strings.TrimSpace(value)) {
+			add(SeverityError, prefix+"static.root", fmt.Sprintf("invalid static root %q", value),
+				"use an absolute path inside the nginx container, e.g. /data/www")
+		}
+		if _, grpc := labels[prefix+"grpc"]; grpc {
+			add(SeverityError, prefix+"static.root", "cannot be combined with grpc", fmt.Sprintf("remove %sgrpc", prefix))
+		}
+	}
+
+	if value, ok := labels[prefix+"socket"]; ok {
+		if !validAbsPath(strings.TrimSpace(value)) {
+			add(SeverityError, prefix+"socket", fmt.Sprintf("invalid socket path %q", value),
+				"use an absolute path inside the nginx container, e.g. /run/app/app.sock")
+		}
+		if _, static := labels[prefix+"static.root"]; static {
+			add(SeverityError, prefix+"socket", "cannot be combined with static.root", fmt.Sprintf("remove %sstatic.root", prefix))
+		}
+	}
+
+	if value, ok := labels[prefix+"aliases"]; ok {
+		var hostnames []string
+		for _, h := range strings.Split(host, ",") {
+			bare, _, _ := strings.Cut(strings.TrimSpace(h), ":")
+			hostnames = append(hostnames, bare)
+		}
+		if _, err := parseAliases(value, hostnames); err != nil {
+			add(SeverityError, prefix+"aliases", err.Error(),
+				"list hostnames that redirect to the first host, e.g. www.example.com")
+		}
+	}
+
+	_, hasOIDC := labels[prefix+"oidc.auth_url"]
+	_, hasProvider := labels[prefix+"oidc.provider"]
+	_, hasLoginURL := labels[prefix+"oidc.login_url"]
+	if hasOIDC || hasProvider || hasLoginURL {
+		label := prefix + "oidc.auth_url"
+		switch {
+		case hasOIDC:
+		case hasProvider:
+			label = prefix + "oidc.provider"
+		default:
+			label = prefix + "oidc.login_url"
+		}
+		if _, err := parseOIDC(prefix, labels); err != nil {
+			add(SeverityError, label, err.Error(),
+				fmt.Sprintf("set %soidc.auth_url to the auth service, e.g. http://oauth2-proxy:4180", prefix))
+		}
+		if _, auth := labels[prefix+"auth.secret"]; auth && hasOIDC {
+			add(SeverityError, prefix+"oidc.auth_url", "cannot be combined with auth.secret", fmt.Sprintf("remove %sauth.secret", prefix))
+		}
+		if _, grpc := labels[prefix+"grpc"]; grpc && hasOIDC {
+			add(SeverityError, prefix+"oidc.auth_url", "cannot be combined with grpc", "gRPC clients cannot follow login redirects")
+		}
+	}
+
+	if value, ok := labels[prefix+"access_log.sample"]; ok {
+		if _, err := ParseLogSample(value); err != nil {
+			add(SeverityError, prefix+"access_log.sample", err.Error(), "use the share of successful requests to log, e.g. 1%")
+		}
+	}
+
+	if value, ok := labels[prefix+"header_buffers"]; ok {
+		if _, err := parseHeaderBuffers(value); err != nil {
+			add(SeverityError, prefix+"header_buffers", err.Error(), "use a count and size like 8 32k")
+		}
+	}
+
+	if value, ok := labels[prefix+"buffering"]; ok {
+		if _, err := parseBufferingOff(value); err != nil {
+			add(SeverityError, prefix+"buffering", err.Error(), `use "off" for streaming responses such as SSE`)
+		}
+	}
+	_, hasBuffers := labels[prefix+"buffers"]
+	_, hasBufferSize := labels[prefix+"buffer_size"]
+	if hasBuffers || hasBufferSize {
+		if _, _, err := parseProxyBuffers(labels[prefix+"buffers"], labels[prefix+"buffer_size"]); err != nil {
+			label := prefix + "buffers"
+			if !hasBuffers {
+				label = prefix + "buffer_size"
+			}
+			add(SeverityError, label, err.Error(), fmt.Sprintf("set %sbuffers to a count and size like 16 8k next to %sbuffer_size", prefix, prefix))
+		}
+	}
+
+	if value, ok := labels[prefix+"limit_conn"]; ok {
+		if _, err := parseLimitConn(value); err != nil {
+			add(SeverityError, prefix+"limit_conn", err.Error(), "use the number of concurrent connections per client, e.g. 4")
+		}
+	}
+	if value, ok := labels[prefix+"limit_rate"]; ok {
+		if _, err := parseLimitRate(value); err != nil {
+			add(SeverityError, prefix+"limit_rate", err.Error(), "use bytes per second with an optional k, m or g suffix, e.g. 2m")
+		}
+	}
+
+	if value, ok := labels[prefix+"next_upstream"]; ok {
+		if _, err := parseNextUpstream(value); err != nil {
+			add(SeverityError, prefix+"next_upstream", err.Error(), "use proxy_next_upstream conditions, e.g. error,timeout,http_502")
+		}
+	}
+	if value, ok := labels[prefix+"retries"]; ok {
+		if _, err := parseRetries(value); err != nil {
+			add(SeverityError, prefix+"retries", err.Error(), "use the number of further attempts, e.g. 2")
+		}
+	}
+	if value, ok := labels[prefix+"next_upstream_timeout"]; ok {
+		if _, err := parseNginxTime(value); err != nil {
+			add(SeverityError, prefix+"next_upstream_timeout", err.Error(), "use an nginx time, e.g. 10s")
+		}
+	}
+	if value, ok := labels[prefix+"read_timeout"]; ok {
+		if _, err := parseNginxTime(value); err != nil {
+			add(SeverityError, prefix+"read_timeout", err.Error(), "use an nginx time, e.g. 1h")
+		}
+	}
+	if value, ok := labels[prefix+"allow_from"]; ok {
+		if _, err := ParseCIDRs(value); err != nil {
+			add(SeverityError, prefix+"allow_from", err.Error(), "use addresses and CIDRs, e.g. 192.168.0.0/16,10.8.0.0/24")
+		} else if labelBool(labels[prefix+"internal_only"]) {
+			add(SeverityError, prefix+"allow_from", "cannot be combined with "+prefix+"internal_only",
+				"list all allowed networks in "+prefix+"allow_from and remove "+prefix+"internal_only")
+		}
+	}
+	if value, ok := labels[prefix+"pass_vars"]; ok {
+		if _, err := parsePassVars(value); err != nil {
+			add(SeverityError, prefix+"pass_vars", err.Error(), "list variables like $ssl_client_s_dn or X-Client-DN=$ssl_client_s_dn")
+		}
+	}
+	mirror, hasMirror := labels[prefix+"mirror"]
+	if percent, ok := labels[prefix+"mirror.percent"]; ok || hasMirror {
+		label := prefix + "mirror"
+		if _, _, err := parseMirror(mirror, ""); err == nil {
+			label = prefix + "mirror.percent"
+		}
+		if _, _, err := parseMirror(mirror, percent); err != nil {
+			add(SeverityError, label, err.Error(), "use a routed hostname or container name, e.g. app-staging:8080, and a percentage like 10%")
+		}
+	}
+	_, hasHealthPath := labels[prefix+"healthcheck.path"]
+	if value, ok := labels[prefix+"healthcheck.path"]; ok && !healthPathRe.MatchString(strings.TrimSpace(value)) {
+		add(SeverityError, prefix+"healthcheck.path", fmt.Sprintf("invalid path %q", value), "use a path without spaces, quotes or $, e.g. /healthz")
+	}
+	for _, suffix := range []string{"healthcheck.interval", "healthcheck.timeout", "healthcheck.fails"} {
+		value, ok := labels[prefix+suffix]
+		if !ok {
+			continue
+		}
+		_, err := parseHealthDuration(value, 0)
+		if suffix == "healthcheck.fails" {
+			_, err = parseHealthFails(value)
+		}
+		switch {
+		case err != nil:
+			add(SeverityError, prefix+suffix, err.Error(), "use a duration like 5s for times and a number like 3 for fails")
+		case !hasHealthPath:
+			add(SeverityWarning, prefix+suffix, fmt.Sprintf("ignored without %shealthcheck.path", prefix),
+				fmt.Sprintf("add %shealthcheck.path or remove the label", prefix))
+		}
+	}
+	if len(audienceHosts) > 0 {
+		for _, suffix := range audienceLabelSuffixes {
+			if _, ok := labels[prefix+suffix]; ok {
+				add(SeverityError, prefix+suffix, fmt.Sprintf("cannot be combined with %shost.internal or %shost.external", prefix, prefix),
+					fmt.Sprintf("remove %s%s, it is not supported with audience hosts", prefix, suffix))
+			}
+		}
+		_, hasAuth := labels[prefix+"auth.secret"]
+		if _, external := labels[prefix+"host.external"]; external && !hasAuth && !hasOIDC {
+			add(SeverityError, prefix+"host.external", "external routes must authenticate clients",
+				fmt.Sprintf("add %sauth.secret or %soidc.auth_url, or use %shost for a public route", prefix, prefix, prefix))
+		}
+	}
+	if _, ok := labels[prefix+"preset"]; ok {
+		if _, _, err := applyHTTPPreset(prefix, labels); err != nil {
+			add(SeverityError, prefix+"preset", err.Error(), "use "+strings.Join(httpPresetNames(), ", ")+" or remove the label")
+		}
+	}
+
+	for _, suffix := range []string{"geo.allow", "geo.deny"} {
+		if value, ok := labels[prefix+suffix]; ok {
+			if _, err := parseCountryCodes(value); err != nil {
+				add(SeverityError, prefix+suffix, err.Error(), "use ISO 3166-1 alpha-2 codes, e.g. DE,AT")
+			}
+		}
+	}
+	if _, allow := labels[prefix+"geo.allow"]; allow {
+		if _, deny := labels[prefix+"geo.deny"]; deny {
+			add(SeverityError, prefix+"geo.deny", "cannot be combined with geo.allow", "keep either the allow or the deny list")
+		}
+	}
+
+	if value, ok := labels[prefix+"valid_referers"]; ok {
+		referers, err := parseValidReferers(value)
+		switch {
+		case err != nil:
+			add(SeverityError, prefix+"valid_referers", err.Error(), "use e.g. none blocked server_names *.example.com")
+		case !slices.Contains(referers, "none"):
+			add(SeverityWarning, prefix+"valid_referers", "requests without a Referer, e.g. opened directly, get 403",
+				"add none to allow direct requests")
+		}
+	}
+
+	if value, ok := labels[prefix+"resolver"]; ok {
+		if _, err := ParseResolver(value); err != nil {
+			add(SeverityError, prefix+"resolver", err.Error(), "use DNS server IP addresses, e.g. 1.1.1.1,8.8.8.8")
+		}
+	}
+
+	if value, ok := labels[prefix+"allowed_methods"]; ok {
+		methods, err := parseAllowedMethods(value)
+		_, grpc := labels[prefix+"grpc"]
+		switch {
+		case err != nil:
+			add(SeverityError, prefix+"allowed_methods", err.Error(), "use comma-separated methods, e.g. GET,POST")
+		case grpc && !slices.Contains(methods, "POST"):
+			add(SeverityWarning, prefix+"allowed_methods", "gRPC calls are POST requests and get 405", "add POST")
+		}
+	}
+	if value, ok := labels[prefix+"max_body_size"]; ok {
+		if _, err := parseMaxBodySize(value); err != nil {
+			add(SeverityError, prefix+"max_body_size", err.Error(), "use a size with an optional k, m or g suffix, e.g. 10m")
+		}
+	}
+
+	for _, suffix := range []string{"auth.secret", "tls.cert.secret", "tls.key.secret"} {
+		label := prefix + suffix
+		value, ok := labels[label]
+		if ok && !validSecretRef(strings.TrimSpace(value)) {
+			add(SeverityError, label, fmt.Sprintf("invalid secret reference %q", value),
+				"use a secret file name such as app_htpasswd or vault:<path>#<field>")
+		}
+	}
+
+	_, hasCert := labels[prefix+"tls.cert.secret"]
+	_, hasKey := labels[prefix+"tls.key.secret"]
+	if hasCert != hasKey {
+		missing := prefix + "tls.key.secret"
+		present := prefix + "tls.cert.secret"
+		if hasKey {
+			missing, present = present, missing
+		}
+		add(SeverityError, present, "TLS certificate and key must be set together", fmt.Sprintf("add %s", missing))
+	}
+
+	return issues
+}
+
+// lintConflicts reports ports and hostnames already claimed by another container or label
+// Generation fails on any conflict, the container later in name order is reported
+// Stream ports shared by containers with the same proxy.stream.hash, and hostnames shared
+// by replicas of one service, are pooled, not conflicting
+func lintConflicts(name string, labels map[string]string, owners map[string]string) []LabelIssue {
+	var issues []LabelIssue
+	for _, c := range containerClaims(labels) {
+		key := c.kind + ":" + c.name
+		owner := name + " " + c.label
+		poolKey := ""
+		if c.pool != "" {
+			poolKey = key + " " + c.pool
+		}
+		if _, pooled := owners[poolKey]; pooled && poolKey != "" {
+			continue
+		}
+		if existing, ok := owners[key]; ok {
+			issues = append(issues, LabelIssue{
+				Container: name, Label: c.label, Value: labels[c.label], Severity: SeverityError,
+				Message: fmt.Sprintf("%s already claimed by %s", c.what, existing),
+				Fix:     "use each port and hostname once",
+			})
+			continue
+		}
+		owners[key] = owner
+		if poolKey != "" {
+			owners[poolKey] = owner
+		}
+	}
+	return issues
+}
+
+// routePrefixes returns the label prefixes of the valid indexed routes, in index order
+func routePrefixes(labels map[string]string) []string {
+	seen := make(map[int]bool)
+	var indexes []int
+	for label := range labels {
+		rest, ok := strings.CutPrefix(label, httpRoutesLabelStart)
+		if !ok {
+			continue
+		}
+		indexStr, _, _ := strings.Cut(rest, ".")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil || index < 1 || seen[index] {
+			continue
+		}
+		seen[index] = true
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	prefixes := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		prefixes = append(prefixes, httpRouteLabelPrefix(index))
+	}
+	return prefixes
+}
+
+// parseHTTPPort parses the proxy.http.port label
+func parseHTTPPort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid HTTP port %q: %w", s, err)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("HTTP port %d out of range", port)
+	}
+	return port, nil
+}
+
+func validHTTPPort(s string) bool {
+	_, err := parseHTTPPort(s)
+	return err == nil
+}
+
+func isKnownLabel(label string) bool {
+	for _, known := range knownLabels {
+		if label == known {
+			return true
+		}
+	}
+	if rest, ok := strings.CutPrefix(label, httpRoutesLabelStart); ok {
+		_, suffix, _ := strings.Cut(rest, ".")
+		for _, known := range httpLabelSuffixes {
+			if suffix == known {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closestLabel returns the known label nearest to a misspelled one, empty if none is close
+func closestLabel(label string) string {
+	best, bestDist := "", 4
+	for _, known := range knownLabels {
+		if d := editDistance(label, known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	if rest, ok := strings.CutPrefix(label, httpRoutesLabelStart); ok {
+		indexStr, suffix, _ := strings.Cut(rest, ".")
+		for _, known := range httpLabelSuffixes {
+			if d := editDistance(suffix, known); d < bestDist {
+				best, bestDist = httpRoutesLabelStart+indexStr+"."+known, d
+			}
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ListLabels returns the proxy labels of all running containers, keyed by container name
+// Containers without any proxy.* label are left out
+func (c *Client) ListLabels(ctx context.Context) (map[string]map[string]string, error) {
+	if err := c.throttle(ctx, "list"); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	containers, err := c.cli.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	result := make(map[string]map[string]string)
+	for _, ctr := range containers {
+		if labels := proxyLabels(ctr.Labels); len(labels) > 0 {
+			result[strings.TrimPrefix(ctr.Names[0], "/")] = labels
+		}
+	}
+	return result, nil
+}
+
+// LoadComposeLabels reads the proxy labels of every service in a Compose file, keyed by
+// container_name or, when unset, the service name
+// Both the map and the list ("key=value") label forms are supported
+func LoadComposeLabels(path string) (map[string]map[string]string, error) {
+	// #nosec G304 -- compose file path is provided by the operator
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			ContainerName string    `yaml:"container_name"`
+			Labels        yaml.Node `yaml:"labels"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	result := make(map[string]map[string]string)
+	for service, svc := range compose.Services {
+		labels := make(map[string]string)
+		switch svc.Labels.Kind {
+		case yaml.MappingNode:
+			if err := svc.Labels.Decode(&labels); err != nil {
+				return nil, fmt.Errorf("service %s: invalid labels: %w", service, err)
+			}
+		case yaml.SequenceNode:
+			var list []string
+			if err := svc.Labels.Decode(&list); err != nil {
+				return nil, fmt.Errorf("service %s: invalid labels: %w", service, err)
+			}
+			for _, item := range list {
+				k, v, _ := strings.Cut(item, "=")
+				labels[k] = v
+			}
+		case 0:
+			// no labels
+		default:
+			return nil, fmt.Errorf("service %s: labels must be a map or a list", service)
+		}
+
+		name := service
+		if svc.ContainerName != "" {
+			name = svc.ContainerName
+		}
+		if filtered := proxyLabels(labels); len(filtered) > 0 {
+			result[name] = filtered
+		}
+	}
+	return result, nil
+}
+
+// proxyLabels returns the proxy.* labels, plus the service labels replicas are pooled by
+func proxyLabels(labels map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range labels {
+		if strings.HasPrefix(k, "proxy.") {
+			result[k] = v
+		}
+	}
+	if len(result) == 0 {
+		return result
+	}
+	for _, k := range serviceLabels {
+		if v, ok := labels[k]; ok {
+			result[k] = v
+		}
+	}
+	return result
+}
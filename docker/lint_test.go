@@ -0,0 +1,530 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestLintLabels(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers map[string]map[string]string
+		want       []LabelIssue // compared on container, label and severity
+	}{
+		{
+			name: "valid labels",
+			containers: map[string]map[string]string{
+				"web": {"proxy.http.host": "app.example.com, www.example.com", "proxy.http.port": "8080", "proxy.http.https": "true"},
+				"db":  {"proxy.tcp.ports": "5432"},
+			},
+			want: nil,
+		},
+		{
+			name: "invalid ports",
+			containers: map[string]map[string]string{
+				"db": {"proxy.tcp.ports": "5432:abc", "proxy.udp.ports": "53,53"},
+			},
+			want: []LabelIssue{
+				{Container: "db", Label: "proxy.tcp.ports", Severity: SeverityError},
+				{Container: "db", Label: "proxy.udp.ports", Severity: SeverityError},
+			},
+		},
+		{
+			name: "misspelled and plaintext labels",
+			containers: map[string]map[string]string{
+				"web": {"proxy.http.hosts": "app.example.com", "proxy.http.auth": "admin:secret"},
+			},
+			want: []LabelIssue{
+				{Container: "web", Label: "proxy.http.auth", Severity: SeverityWarning},
+				{Container: "web", Label: "proxy.http.hosts", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "bad http labels",
+			containers: map[string]map[string]string{
+				"web": {
+					"proxy.http.host":            "https://app.example.com,,bad_host",
+					"proxy.http.port":            "70000",
+					"proxy.http.https":           "yes",
+					"proxy.http.tls.cert.secret": "../cert",
+				},
+			},
+			want: []LabelIssue{
+				{Container: "web", Label: "proxy.http.host", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.host", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.host", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.port", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.https", Severity: SeverityWarning},
+				{Container: "web", Label: "proxy.http.tls.cert.secret", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.tls.cert.secret", Severity: SeverityError},
+			},
+		},
+		{
+			name: "https both",
+			containers: map[string]map[string]string{
+				"camera": {"proxy.http.host": "cam.example.com", "proxy.http.https": "both"},
+				"api":    {"proxy.http.host": "api.example.com", "proxy.http.https": "both", "proxy.http.grpc": "true"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.https", Severity: SeverityError},
+			},
+		},
+		{
+			name: "connection and bandwidth limits",
+			containers: map[string]map[string]string{
+				"files": {"proxy.http.host": "files.example.com", "proxy.http.limit_conn": "2", "proxy.http.limit_rate": "1m"},
+				"bad":   {"proxy.http.host": "bad.example.com", "proxy.http.limit_conn": "0", "proxy.http.limit_rate": "1mb/s"},
+			},
+			want: []LabelIssue{
+				{Container: "bad", Label: "proxy.http.limit_conn", Severity: SeverityError},
+				{Container: "bad", Label: "proxy.http.limit_rate", Severity: SeverityError},
+			},
+		},
+		{
+			name: "single sign-on",
+			containers: map[string]map[string]string{
+				"grafana": {"proxy.http.host": "grafana.example.com", "proxy.http.oidc.auth_url": "http://oauth2-proxy:4180"},
+				"wiki":    {"proxy.http.host": "wiki.example.com", "proxy.http.oidc.auth_url": "http://vouch:9090", "proxy.http.oidc.provider": "vouch"},
+				"admin": {"proxy.http.host": "admin.example.com", "proxy.http.oidc.auth_url": "http://oauth2-proxy:4180",
+					"proxy.http.auth.secret": "admin_htpasswd"},
+			},
+			want: []LabelIssue{
+				{Container: "admin", Label: "proxy.http.oidc.auth_url", Severity: SeverityError},
+				{Container: "wiki", Label: "proxy.http.oidc.auth_url", Severity: SeverityError},
+			},
+		},
+		{
+			name: "valid referers",
+			containers: map[string]map[string]string{
+				"media":   {"proxy.http.host": "media.example.com", "proxy.http.valid_referers": "none blocked *.example.com"},
+				"strict":  {"proxy.http.host": "strict.example.com", "proxy.http.valid_referers": "server_names"},
+				"pattern": {"proxy.http.host": "pattern.example.com", "proxy.http.valid_referers": "none ~google"},
+			},
+			want: []LabelIssue{
+				{Container: "pattern", Label: "proxy.http.valid_referers", Severity: SeverityError},
+				{Container: "strict", Label: "proxy.http.valid_referers", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "request restrictions",
+			containers: map[string]map[string]string{
+				"wiki":   {"proxy.http.host": "wiki.example.com", "proxy.http.allowed_methods": "GET", "proxy.http.max_body_size": "0"},
+				"upload": {"proxy.http.host": "upload.example.com", "proxy.http.max_body_size": "10mb"},
+				"api": {"proxy.http.host": "api.example.com", "proxy.http.grpc": "true",
+					"proxy.http.allowed_methods": "GET"},
+				"bad": {"proxy.http.host": "bad.example.com", "proxy.http.allowed_methods": "GET|POST"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.allowed_methods", Severity: SeverityWarning},
+				{Container: "bad", Label: "proxy.http.allowed_methods", Severity: SeverityError},
+				{Container: "upload", Label: "proxy.http.max_body_size", Severity: SeverityError},
+			},
+		},
+		{
+			name: "access log sampling",
+			containers: map[string]map[string]string{
+				"api": {"proxy.http.host": "api.example.com", "proxy.http.access_log.sample": "1%"},
+				"bad": {"proxy.http.host": "bad.example.com", "proxy.http.access_log.sample": "0.01"},
+			},
+			want: []LabelIssue{
+				{Container: "bad", Label: "proxy.http.access_log.sample", Severity: SeverityError},
+			},
+		},
+		{
+			name: "header buffers",
+			containers: map[string]map[string]string{
+				"grafana": {"proxy.http.host": "grafana.example.com", "proxy.http.header_buffers": "8 32k"},
+				"bad":     {"proxy.http.host": "bad.example.com", "proxy.http.header_buffers": "32k"},
+			},
+			want: []LabelIssue{
+				{Container: "bad", Label: "proxy.http.header_buffers", Severity: SeverityError},
+			},
+		},
+		{
+			name: "response buffering",
+			containers: map[string]map[string]string{
+				"events": {"proxy.http.host": "events.example.com", "proxy.http.buffering": "off"},
+				"api":    {"proxy.http.host": "api.example.com", "proxy.http.buffers": "16 8k", "proxy.http.buffer_size": "16k"},
+				"bad":    {"proxy.http.host": "bad.example.com", "proxy.http.buffering": "sometimes", "proxy.http.buffer_size": "16k"},
+			},
+			want: []LabelIssue{
+				{Container: "bad", Label: "proxy.http.buffering", Severity: SeverityError},
+				{Container: "bad", Label: "proxy.http.buffer_size", Severity: SeverityError},
+			},
+		},
+		{
+			name: "stream connection limits",
+			containers: map[string]map[string]string{
+				"ssh":   {"proxy.tcp.ports": "2222:22", "proxy.tcp.max_connections": "10"},
+				"dns":   {"proxy.udp.ports": "53", "proxy.tcp.max_connections": "10"},
+				"files": {"proxy.tcp.ports": "21", "proxy.tcp.max_connections": "unlimited"},
+			},
+			want: []LabelIssue{
+				{Container: "dns", Label: "proxy.tcp.max_connections", Severity: SeverityWarning},
+				{Container: "files", Label: "proxy.tcp.max_connections", Severity: SeverityError},
+			},
+		},
+		{
+			name: "stream port options",
+			containers: map[string]map[string]string{
+				"db":   {"proxy.tcp.ports": "5432;timeout=30m;connect_timeout=2s"},
+				"ssh":  {"proxy.tcp.ports": "2222:22;idle=1h"},
+				"dns":  {"proxy.udp.ports": "53;connect_timeout=1s"},
+				"vpn":  {"proxy.udp.ports": "51820;timeout=10m"},
+				"auth": {"proxy.tcp.ports": "389;timeout=forever"},
+			},
+			want: []LabelIssue{
+				{Container: "auth", Label: "proxy.tcp.ports", Severity: SeverityError},
+				{Container: "dns", Label: "proxy.udp.ports", Severity: SeverityError},
+				{Container: "ssh", Label: "proxy.tcp.ports", Severity: SeverityError},
+			},
+		},
+		{
+			name: "ssh gateway aliases",
+			containers: map[string]map[string]string{
+				"db":     {"proxy.ssh.alias": "db-shell", "proxy.ssh.port": "2222"},
+				"db2":    {"proxy.ssh.alias": "db-shell"},
+				"git":    {"proxy.ssh.alias": "*.git"},
+				"backup": {"proxy.ssh.port": "22"},
+			},
+			want: []LabelIssue{
+				{Container: "backup", Label: "proxy.ssh.port", Severity: SeverityWarning},
+				{Container: "db2", Label: "proxy.ssh.alias", Severity: SeverityError},
+				{Container: "git", Label: "proxy.ssh.alias", Severity: SeverityError},
+			},
+		},
+		{
+			name: "tcp presets",
+			containers: map[string]map[string]string{
+				"pg":    {"proxy.tcp.ports": "5432", "proxy.tcp.preset": "postgres"},
+				"mongo": {"proxy.tcp.ports": "27017", "proxy.tcp.preset": "mongodb"},
+				"cache": {"proxy.udp.ports": "6379", "proxy.tcp.preset": "redis"},
+			},
+			want: []LabelIssue{
+				{Container: "cache", Label: "proxy.tcp.preset", Severity: SeverityWarning},
+				{Container: "mongo", Label: "proxy.tcp.preset", Severity: SeverityError},
+			},
+		},
+		{
+			name: "upstream host",
+			containers: map[string]map[string]string{
+				"wiki": {"proxy.http.host": "wiki.example.com", "proxy.http.upstream_host": "wiki.internal"},
+				"api":  {"proxy.http.host": "api.example.com", "proxy.http.upstream_host": "*.internal"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.upstream_host", Severity: SeverityError},
+			},
+		},
+		{
+			name: "forwarded headers",
+			containers: map[string]map[string]string{
+				"app":    {"proxy.http.host": "app.example.com", "proxy.http.forwarded_headers": "strip"},
+				"legacy": {"proxy.http.host": "legacy.example.com", "proxy.http.forwarded_headers": "keep"},
+			},
+			want: []LabelIssue{
+				{Container: "legacy", Label: "proxy.http.forwarded_headers", Severity: SeverityError},
+			},
+		},
+		{
+			name: "resolver",
+			containers: map[string]map[string]string{
+				"app":    {"proxy.http.host": "app.example.com", "proxy.http.resolver": "1.1.1.1,8.8.8.8"},
+				"search": {"proxy.http.host": "search.example.com", "proxy.http.resolver": "dns.google"},
+			},
+			want: []LabelIssue{
+				{Container: "search", Label: "proxy.http.resolver", Severity: SeverityError},
+			},
+		},
+		{
+			name: "route expiry",
+			containers: map[string]map[string]string{
+				"demo":  {"proxy.http.host": "demo.example.com", "proxy.expires": "2025-01-31T00:00:00Z"},
+				"trial": {"proxy.http.host": "trial.example.com", "proxy.expires": "72h"},
+				"stale": {"proxy.http.host": "stale.example.com", "proxy.expires": "next week"},
+			},
+			want: []LabelIssue{
+				{Container: "stale", Label: "proxy.expires", Severity: SeverityError},
+			},
+		},
+		{
+			name: "schedules",
+			containers: map[string]map[string]string{
+				"admin":  {"proxy.http.host": "admin.example.com", "proxy.schedule": "Mon-Fri 08:00-18:00"},
+				"backup": {"proxy.tcp.ports": "873", "proxy.schedule": "22:00-06:00"},
+				"report": {"proxy.http.host": "report.example.com", "proxy.schedule": "Weekdays 8-18"},
+			},
+			want: []LabelIssue{
+				{Container: "report", Label: "proxy.schedule", Severity: SeverityError},
+			},
+		},
+		{
+			name: "dependencies",
+			containers: map[string]map[string]string{
+				"web":  {"proxy.http.host": "web.example.com", "proxy.depends_on": "api, db"},
+				"api":  {"proxy.http.host": "api.example.com", "proxy.depends_on": "api"},
+				"docs": {"proxy.http.host": "docs.example.com", "proxy.depends_on": "search:9200"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.depends_on", Severity: SeverityError},
+				{Container: "docs", Label: "proxy.depends_on", Severity: SeverityError},
+			},
+		},
+		{
+			name: "stream hash pools",
+			containers: map[string]map[string]string{
+				"wg1": {"proxy.udp.ports": "51820", "proxy.stream.hash": "$remote_addr"},
+				"wg2": {"proxy.udp.ports": "51820", "proxy.stream.hash": "$remote_addr"},
+				"wg3": {"proxy.udp.ports": "51820"},
+				"dns": {"proxy.udp.ports": "5353", "proxy.stream.hash": "remote_addr"},
+			},
+			want: []LabelIssue{
+				{Container: "dns", Label: "proxy.stream.hash", Severity: SeverityError},
+				{Container: "wg3", Label: "proxy.udp.ports", Severity: SeverityError},
+			},
+		},
+		{
+			name: "namespaces",
+			containers: map[string]map[string]string{
+				"api": {"proxy.http.host": "api.example.com", "proxy.namespace": "team-a"},
+				"web": {"proxy.http.host": "web.example.com", "proxy.namespace": "Team A"},
+			},
+			want: []LabelIssue{
+				{Container: "web", Label: "proxy.namespace", Severity: SeverityError},
+			},
+		},
+		{
+			name: "service replicas and retry policy",
+			containers: map[string]map[string]string{
+				"shop-api-1": {
+					"proxy.http.host": "api.example.com", "proxy.http.retries": "2",
+					"com.docker.compose.project": "shop", "com.docker.compose.service": "api",
+				},
+				"shop-api-2": {
+					"proxy.http.host": "api.example.com", "proxy.http.next_upstream": "error,teapot",
+					"com.docker.compose.project": "shop", "com.docker.compose.service": "api",
+				},
+				"shop-web-1": {
+					"proxy.http.host": "api.example.com", "proxy.http.next_upstream_timeout": "soon",
+					"com.docker.compose.project": "shop", "com.docker.compose.service": "web",
+				},
+			},
+			want: []LabelIssue{
+				{Container: "shop-api-2", Label: "proxy.http.next_upstream", Severity: SeverityError},
+				{Container: "shop-web-1", Label: "proxy.http.next_upstream_timeout", Severity: SeverityError},
+				{Container: "shop-web-1", Label: "proxy.http.host", Severity: SeverityError},
+			},
+		},
+		{
+			name: "per-hostname ports",
+			containers: map[string]map[string]string{
+				"a": {"proxy.http.host": "admin.example.com:9090,app.example.com:3000"},
+				"b": {"proxy.http.host": "app.example.com:8080,bad.example.com:99999"},
+			},
+			want: []LabelIssue{
+				{Container: "b", Label: "proxy.http.host", Severity: SeverityError},
+				{Container: "b", Label: "proxy.http.host", Severity: SeverityError},
+			},
+		},
+		{
+			name: "backend tls",
+			containers: map[string]map[string]string{
+				"unifi": {
+					"proxy.http.host":               "unifi.example.com",
+					"proxy.http.backend_scheme":     "https",
+					"proxy.http.backend_ssl_verify": "true",
+					"proxy.http.backend_sni":        "unifi.local",
+				},
+				"web": {
+					"proxy.http.host":           "web.example.com",
+					"proxy.http.backend_scheme": "tls",
+					"proxy.http.backend_sni":    "web.local",
+				},
+			},
+			want: []LabelIssue{
+				{Container: "web", Label: "proxy.http.backend_scheme", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.backend_sni", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "http labels without host",
+			containers: map[string]map[string]string{
+				"web": {"proxy.tcp.ports": "8080", "proxy.http.port": "80"},
+			},
+			want: []LabelIssue{
+				{Container: "web", Label: "proxy.http.port", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "indexed routes",
+			containers: map[string]map[string]string{
+				"app": {
+					"proxy.http.routes.1.host": "app.example.com",
+					"proxy.http.routes.1.port": "3000",
+					"proxy.http.routes.2.port": "9090",
+					"proxy.http.routes.3.host": "app.example.com",
+					"proxy.http.routes.3.prot": "8080",
+					"proxy.http.routes.x.host": "x.example.com",
+				},
+			},
+			want: []LabelIssue{
+				{Container: "app", Label: "proxy.http.routes.3.prot", Severity: SeverityWarning},
+				{Container: "app", Label: "proxy.http.routes.x.host", Severity: SeverityError},
+				{Container: "app", Label: "proxy.http.routes.2.port", Severity: SeverityError},
+				{Container: "app", Label: "proxy.http.routes.3.host", Severity: SeverityError},
+			},
+		},
+		{
+			name: "audience hosts",
+			containers: map[string]map[string]string{
+				"nas": {"proxy.http.host.internal": "nas.lan", "proxy.http.host.external": "nas.example.com",
+					"proxy.http.port": "5000", "proxy.http.internal_only": "true"},
+				"wiki": {"proxy.http.host.internal": "wiki.lan", "proxy.http.host.external": "wiki.example.com",
+					"proxy.http.oidc.auth_url": "http://oauth2-proxy:4180"},
+			},
+			want: []LabelIssue{
+				{Container: "nas", Label: "proxy.http.internal_only", Severity: SeverityError},
+				{Container: "nas", Label: "proxy.http.host.external", Severity: SeverityError},
+			},
+		},
+		{
+			name: "health checks",
+			containers: map[string]map[string]string{
+				"api": {"proxy.http.host": "api.example.com", "proxy.http.healthcheck.path": "health",
+					"proxy.http.healthcheck.fails": "0", "proxy.http.healthcheck.interval": "10s"},
+				"web": {"proxy.http.host": "web.example.com", "proxy.http.healthcheck.timeout": "1s"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.healthcheck.path", Severity: SeverityError},
+				{Container: "api", Label: "proxy.http.healthcheck.fails", Severity: SeverityError},
+				{Container: "web", Label: "proxy.http.healthcheck.timeout", Severity: SeverityWarning},
+			},
+		},
+		{
+			name: "mirrors",
+			containers: map[string]map[string]string{
+				"shop": {"proxy.http.host": "shop.example.com", "proxy.http.mirror": "shop-staging", "proxy.http.mirror.percent": "200"},
+				"api":  {"proxy.http.host": "api.example.com", "proxy.http.mirror": "https://staging"},
+				"blog": {"proxy.http.host": "blog.example.com", "proxy.http.mirror.percent": "10"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.mirror", Severity: SeverityError},
+				{Container: "blog", Label: "proxy.http.mirror.percent", Severity: SeverityError},
+				{Container: "shop", Label: "proxy.http.mirror.percent", Severity: SeverityError},
+			},
+		},
+		{
+			name: "pass vars",
+			containers: map[string]map[string]string{
+				"api": {"proxy.http.host": "api.example.com", "proxy.http.pass_vars": "$ssl_client_s_dn,X-Forwarded-For=$remote_addr"},
+				"web": {"proxy.http.host": "web.example.com", "proxy.http.pass_vars": "X-Client-DN=$ssl_client_s_dn"},
+			},
+			want: []LabelIssue{
+				{Container: "api", Label: "proxy.http.pass_vars", Severity: SeverityError},
+			},
+		},
+		{
+			name: "conflicts between containers",
+			containers: map[string]map[string]string{
+				"a": {"proxy.tcp.ports": "80", "proxy.http.host": "app.example.com"},
+				"b": {"proxy.tcp.ports": "80:8080", "proxy.udp.ports": "80", "proxy.http.host": "App.example.com"},
+			},
+			want: []LabelIssue{
+				{Container: "b", Label: "proxy.tcp.ports", Severity: SeverityError},
+				{Container: "b", Label: "proxy.http.host", Severity: SeverityError},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LintLabels(tt.containers)
+			if len(got) != len(tt.want) {
+				t.Fatalf("LintLabels() returned %d issues, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i].Container != tt.want[i].Container || got[i].Label != tt.want[i].Label ||
+					got[i].Severity != tt.want[i].Severity {
+					t.Errorf("issue %d = %s %s %s (%s), want %s %s %s", i, got[i].Container, got[i].Label,
+						got[i].Severity, got[i].Message, tt.want[i].Container, tt.want[i].Label, tt.want[i].Severity)
+				}
+				if got[i].Message == "" {
+					t.Errorf("issue %d has no message", i)
+				}
+			}
+		})
+	}
+}
+
+func TestClosestLabel(t *testing.T) {
+	tests := map[string]string{
+		"proxy.http.hosts":         "proxy.http.host",
+		"proxy.tcp.port":           "proxy.tcp.ports",
+		"proxy.http.routes.2.hots": "proxy.http.routes.2.host",
+		"proxy.htpp.https":         "proxy.http.https",
+		"proxy.something.new":      "",
+	}
+	for label, want := range tests {
+		if got := closestLabel(label); got != want {
+			t.Errorf("closestLabel(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestLoadComposeLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := `services:
+  web:
+    image: nginx
+    container_name: web-1
+    labels:
+      proxy.http.host: app.example.com
+      com.example.other: ignored
+  db:
+    image: postgres
+    labels:
+      - "proxy.tcp.ports=5432"
+  worker:
+    image: busybox
+`
+	if err := os.WriteFile(path, []byte(compose), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadComposeLabels(path)
+	if err != nil {
+		t.Fatalf("LoadComposeLabels() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("LoadComposeLabels() returned %d services, want 2: %v", len(got), got)
+	}
+	if got["web-1"]["proxy.http.host"] != "app.example.com" {
+		t.Errorf("web-1 labels = %v", got["web-1"])
+	}
+	if _, ok := got["web-1"]["com.example.other"]; ok {
+		t.Errorf("non-proxy label was not filtered: %v", got["web-1"])
+	}
+	if got["db"]["proxy.tcp.ports"] != "5432" {
+		t.Errorf("db labels = %v", got["db"])
+	}
+}
+
+func TestBooleanLabelsAgreeWithLint(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	for _, value := range []string{"true", "TRUE", "1", " t ", "false", "0", "yes", "on", "tRue"} {
+		labels := map[string]string{"proxy.http.host": "app.example.com", "proxy.http.waf": value}
+		mapping, err := c.parseHTTPMapping("app", "proxy.http.", labels)
+		if err != nil {
+			t.Fatalf("parseHTTPMapping(waf=%q) error = %v", value, err)
+		}
+		warned := len(lintContainer("app", labels)) > 0
+		want, err := strconv.ParseBool(strings.TrimSpace(value))
+		if mapping.WAF != (err == nil && want) || warned != (err != nil) {
+			t.Errorf("waf=%q: WAF = %v, lint warned = %v", value, mapping.WAF, warned)
+		}
+	}
+}
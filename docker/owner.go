@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// label sources of an Owner
+const (
+	LabelSourceContainer = "container" // docker run or another client setting container labels
+	LabelSourceSwarm     = "swarm"     // container labels of a swarm service
+)
+
+// Owner identifies the workload responsible for a container's routes, written above its
+// blocks in the generated config and listed by the admin API
+type Owner struct {
+	Project     string `json:"project,omitempty"`      // compose project or swarm stack
+	Service     string `json:"service,omitempty"`      // compose or swarm service name
+	Image       string `json:"image,omitempty"`        // e.g. ghcr.io/acme/shop:1.4
+	LabelSource string `json:"label_source,omitempty"` // compose:<files>, swarm or container
+}
+
+// newOwner reads the owner of a container from its image and orchestrator labels
+func newOwner(image string, labels map[string]string) Owner {
+	owner := Owner{Image: image, LabelSource: LabelSourceContainer}
+	switch {
+	case labels["com.docker.swarm.service.name"] != "":
+		owner.Project = labels["com.docker.stack.namespace"]
+		owner.Service = labels["com.docker.swarm.service.name"]
+		owner.LabelSource = LabelSourceSwarm
+	case labels["com.docker.compose.project"] != "":
+		owner.Project = labels["com.docker.compose.project"]
+		owner.Service = labels["com.docker.compose.service"]
+		if files := labels["com.docker.compose.project.config_files"]; files != "" {
+			owner.LabelSource = "compose:" + files
+		}
+	}
+	return owner
+}
+
+// ownerValueRe matches values written unquoted into ownership comments
+var ownerValueRe = regexp.MustCompile(`^[A-Za-z0-9._/:@,+=-]+$`)
+
+// String returns the owner as key=value pairs, e.g. project=shop service=web image=shop:1.4
+// labels=compose:/srv/shop/compose.yml; values with spaces or control characters are quoted,
+// so labels cannot break out of a config comment
+func (o Owner) String() string {
+	var parts []string
+	for _, field := range []struct{ key, value string }{
+		{"project", o.Project}, {"service", o.Service}, {"image", o.Image}, {"labels", o.LabelSource},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value := field.value
+		if !ownerValueRe.MatchString(value) {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, field.key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"testing"
+)
+
+func TestNewOwner(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   Owner
+	}{
+		{name: "docker run", want: Owner{Image: "nginx:1.27", LabelSource: LabelSourceContainer}},
+		{
+			name: "compose",
+			labels: map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.service": "web",
+				"com.docker.compose.project.config_files": "/srv/shop/compose.yml"},
+			want: Owner{Project: "shop", Service: "web", Image: "nginx:1.27", LabelSource: "compose:/srv/shop/compose.yml"},
+		},
+		{
+			name:   "swarm",
+			labels: map[string]string{"com.docker.stack.namespace": "shop", "com.docker.swarm.service.name": "shop_web"},
+			want:   Owner{Project: "shop", Service: "shop_web", Image: "nginx:1.27", LabelSource: LabelSourceSwarm},
+		},
+	}
+	for _, tt := range tests {
+		if got := newOwner("nginx:1.27", tt.labels); got != tt.want {
+			t.Errorf("%s: newOwner() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOwnerString(t *testing.T) {
+	owner := Owner{Project: "shop", Image: "ghcr.io/acme/shop@sha256:ab12", LabelSource: "compose:/srv/my shop/compose.yml"}
+	want := `project=shop image=ghcr.io/acme/shop@sha256:ab12 labels="compose:/srv/my shop/compose.yml"`
+	if got := owner.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	if got := (Owner{Project: "shop\nserver {"}).String(); got != `project="shop\nserver {"` {
+		t.Errorf("String() = %s, want the newline escaped", got)
+	}
+	if got := (Owner{}).String(); got != "" {
+		t.Errorf("String() = %q, want empty", got)
+	}
+}
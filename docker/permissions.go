@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+// ErrPermissionDenied is returned when the Docker API refuses an endpoint,
+// usually because a docker-socket-proxy in front of the daemon does not allow it
+var ErrPermissionDenied = errors.New("docker API permission denied")
+
+// probeName is a container and network name that is not expected to exist
+const probeName = "proxy-permission-probe"
+
+// Permissions reports which Docker API endpoints the daemon, or a socket proxy in front of it, allows
+type Permissions struct {
+	Containers bool // list and inspect containers, required for scans
+	Networks   bool // list and create networks, used to set up the proxy network
+	Exec       bool // run commands in containers, used by docker-exec targets
+}
+
+// allPermissions is assumed until the permissions are probed
+var allPermissions = Permissions{Containers: true, Networks: true, Exec: true}
+
+// ProbePermissions checks access to the endpoints used by the proxy without changing anything
+// Only explicit permission errors count as denied, other failures surface when the endpoint is used,
+// as do probes the API limits reject
+func (c *Client) ProbePermissions(ctx context.Context) Permissions {
+	perms := allPermissions
+
+	if c.throttle(ctx, "list") == nil {
+		if _, err := c.cli.ContainerList(ctx, types.ContainerListOptions{Limit: 1}); isPermissionDenied(err) {
+			perms.Containers = false
+		}
+	}
+
+	if c.throttle(ctx, "network") == nil {
+		if _, err := c.cli.NetworkList(ctx, types.NetworkListOptions{
+			Filters: filters.NewArgs(filters.Arg("name", probeName)),
+		}); isPermissionDenied(err) {
+			perms.Networks = false
+		}
+	}
+
+	// an exec on a missing container answers 404 when exec is allowed, a socket proxy answers 403 first
+	if c.throttle(ctx, "exec") == nil {
+		if _, err := c.cli.ContainerExecCreate(ctx, probeName, types.ExecConfig{Cmd: []string{"true"}}); isPermissionDenied(err) {
+			perms.Exec = false
+		}
+	}
+
+	c.perms = &perms
+	c.log.Logf("DEBUG [Docker] permissions containers=%t networks=%t exec=%t", perms.Containers, perms.Networks, perms.Exec)
+	return perms
+}
+
+// Permissions returns the probed permissions, everything is assumed allowed before ProbePermissions
+func (c *Client) Permissions() Permissions {
+	if c.perms == nil {
+		return allPermissions
+	}
+	return *c.perms
+}
+
+// isPermissionDenied reports whether err is a 401/403 answer of the Docker API
+func isPermissionDenied(err error) bool {
+	return err != nil && (errdefs.IsForbidden(err) || errdefs.IsUnauthorized(err))
+}
+
+// permissionError marks permission errors with ErrPermissionDenied, other errors are returned as is
+func permissionError(err error) error {
+	if isPermissionDenied(err) {
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/go-pkgz/lgr"
+)
+
+// socketProxy answers like a docker-socket-proxy that denies the given path prefixes
+func socketProxy(t *testing.T, denied ...string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1.43")
+		for _, prefix := range denied {
+			if strings.HasPrefix(path, prefix) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		switch {
+		case path == "/containers/json" || path == "/networks":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("[]"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No such container"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{cli: cli, log: lgr.New()}
+}
+
+func TestProbePermissions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unprobed client assumes everything is allowed", func(t *testing.T) {
+		if got := (&Client{}).Permissions(); got != allPermissions {
+			t.Errorf("Permissions() = %+v", got)
+		}
+	})
+
+	t.Run("unrestricted daemon", func(t *testing.T) {
+		c := socketProxy(t)
+		if got := c.ProbePermissions(ctx); got != allPermissions {
+			t.Errorf("ProbePermissions() = %+v", got)
+		}
+	})
+
+	t.Run("socket proxy without networks and exec", func(t *testing.T) {
+		c := socketProxy(t, "/networks", "/containers/"+probeName+"/exec")
+		want := Permissions{Containers: true}
+		if got := c.ProbePermissions(ctx); got != want {
+			t.Errorf("ProbePermissions() = %+v, want %+v", got, want)
+		}
+		if got := c.Permissions(); got != want {
+			t.Errorf("Permissions() = %+v, want %+v", got, want)
+		}
+
+		err := c.EnsureNetwork(ctx, "proxy")
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("EnsureNetwork() error = %v, want ErrPermissionDenied", err)
+		}
+	})
+	t.Run("probes are throttled", func(t *testing.T) {
+		c := socketProxy(t)
+		var calls []string
+		c.SetAPILimits(APILimits{Rate: 100, Burst: 10}, func(call APICall) { calls = append(calls, call.Name) })
+		c.ProbePermissions(ctx)
+		if want := []string{"list", "network", "exec"}; !slices.Equal(calls, want) {
+			t.Errorf("throttled calls = %v, want %v", calls, want)
+		}
+	})
+
+	t.Run("event subscriptions are throttled outside the budget", func(t *testing.T) {
+		c := socketProxy(t)
+		var calls []string
+		c.SetAPILimits(APILimits{Rate: 100, Burst: 10, Budget: 1}, func(call APICall) { calls = append(calls, call.Name) })
+		if err := c.throttle(ctx, "list"); err != nil {
+			t.Fatal(err)
+		}
+		_, errCh := c.WatchEvents(ctx)
+		if err := <-errCh; errors.Is(err, ErrBudgetExhausted) {
+			t.Errorf("WatchEvents() error = %v, want the subscription sent", err)
+		}
+		if want := []string{"list", "events"}; !slices.Equal(calls, want) {
+			t.Errorf("throttled calls = %v, want %v", calls, want)
+		}
+	})
+}
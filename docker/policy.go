@@ -0,0 +1,225 @@
+package docker
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Policy restricts the routes containers may claim, routes it denies are dropped before generation
+// The zero Policy admits every route
+type Policy struct {
+	Hostnames []string    // allowed hostnames, "*.corp.example.com" allows any name under it (empty allows all)
+	Ports     []PortRange // allowed TCP and UDP proxy ports (empty allows all)
+}
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	From, To int
+}
+
+// DeniedRoute is a route a Policy removed from a container
+type DeniedRoute struct {
+	Container string
+	ID        string
+	Route     string // e.g. "http:shop.example.com", "tcp:22"
+	Reason    string
+}
+
+// ParsePolicy parses comma-separated hostname patterns and ports or port ranges
+// Format: "*.corp.example.com,status.example.com" and "80,443,1024-65535"
+func ParsePolicy(hostnames, ports string) (Policy, error) {
+	var p Policy
+	for _, h := range strings.Split(hostnames, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h == "" {
+			continue
+		}
+		if !hostnameRe.MatchString(h) {
+			return Policy{}, fmt.Errorf("invalid policy hostname %q, expected a name or *.domain", h)
+		}
+		p.Hostnames = append(p.Hostnames, h)
+	}
+	for _, part := range strings.Split(ports, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		r, err := parsePortRange(from, to)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid policy port %q: %w", part, err)
+		}
+		p.Ports = append(p.Ports, r)
+	}
+	return p, nil
+}
+
+func parsePortRange(from, to string) (PortRange, error) {
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return PortRange{}, err
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return PortRange{}, err
+	}
+	if start < 1 || end > 65535 || start > end {
+		return PortRange{}, fmt.Errorf("range %d-%d outside 1-65535", start, end)
+	}
+	return PortRange{From: start, To: end}, nil
+}
+
+// Enabled reports whether the policy restricts any route
+func (p Policy) Enabled() bool {
+	return len(p.Hostnames) > 0 || len(p.Ports) > 0
+}
+
+// hostnameDenied returns why a hostname is denied, empty when it is allowed
+func (p Policy) hostnameDenied(hostname string) string {
+	if len(p.Hostnames) == 0 {
+		return ""
+	}
+	hostname = strings.ToLower(hostname)
+	for _, allowed := range p.Hostnames {
+		if hostname == allowed {
+			return ""
+		}
+		if domain, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(hostname, domain) {
+			return ""
+		}
+	}
+	return "hostname not allowed by policy, allowed: " + strings.Join(p.Hostnames, ",")
+}
+
+// portDenied returns why a proxy port is denied, empty when it is allowed
+func (p Policy) portDenied(port int) string {
+	if len(p.Ports) == 0 {
+		return ""
+	}
+	allowed := make([]string, 0, len(p.Ports))
+	for _, r := range p.Ports {
+		if port >= r.From && port <= r.To {
+			return ""
+		}
+		if r.From == r.To {
+			allowed = append(allowed, strconv.Itoa(r.From))
+		} else {
+			allowed = append(allowed, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	return "port not allowed by policy, allowed: " + strings.Join(allowed, ",")
+}
+
+// Admit returns the containers with the routes the policy denies removed, and the denied routes
+// A container without any admitted route is dropped, containers are copied before they change
+func (p Policy) Admit(containers []ContainerInfo) ([]ContainerInfo, []DeniedRoute) {
+	if !p.Enabled() {
+		return containers, nil
+	}
+	admitted := make([]ContainerInfo, 0, len(containers))
+	var denied []DeniedRoute
+	for _, c := range containers {
+		deny := func(route, reason string) {
+			denied = append(denied, DeniedRoute{Container: c.Name, ID: c.ID, Route: route, Reason: reason})
+		}
+		hostnames := func(names []string) []string {
+			var kept []string
+			for _, name := range names {
+				if reason := p.hostnameDenied(name); reason != "" {
+					deny("http:"+name, reason)
+					continue
+				}
+				kept = append(kept, name)
+			}
+			return kept
+		}
+
+		var mappings []PortMapping
+		for _, m := range c.Mappings {
+			if reason := p.portDenied(m.ProxyPort); reason != "" {
+				proto := "tcp"
+				if m.Protocol == UDP {
+					proto = "udp"
+				}
+				deny(fmt.Sprintf("%s:%d", proto, m.ProxyPort), reason)
+				continue
+			}
+			mappings = append(mappings, m)
+		}
+		// an HTTP route without an admitted hostname is dropped with its aliases
+		admit := func(m HTTPMapping) (HTTPMapping, bool) {
+			m.Hostnames = hostnames(m.Hostnames)
+			m.Aliases = hostnames(m.Aliases)
+			return m, len(m.Hostnames) > 0
+		}
+		var routes []HTTPMapping
+		for _, m := range c.HTTPRoutes {
+			if m, ok := admit(m); ok {
+				routes = append(routes, m)
+			}
+		}
+		if c.HTTPMapping != nil {
+			if m, ok := admit(*c.HTTPMapping); ok {
+				c.HTTPMapping = &m
+			} else {
+				c.HTTPMapping = nil
+			}
+		}
+		c.Mappings, c.HTTPRoutes = mappings, routes
+		if len(c.Mappings) > 0 || c.HTTPMapping != nil || len(c.HTTPRoutes) > 0 || c.SSH != nil {
+			admitted = append(admitted, c)
+		}
+	}
+	return admitted, denied
+}
+
+// Lint reports the labels of containers, keyed by container name, claiming routes the policy denies
+func (p Policy) Lint(containers map[string]map[string]string) []LabelIssue {
+	if !p.Enabled() {
+		return nil
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var issues []LabelIssue
+	for _, name := range names {
+		labels := containers[name]
+		issue := func(label, value, reason, fix string) {
+			issues = append(issues, LabelIssue{
+				Container: name, Label: label, Value: value, Severity: SeverityError, Message: reason, Fix: fix,
+			})
+		}
+		for _, proto := range []string{"tcp", "udp"} {
+			label := "proxy." + proto + ".ports"
+			mappings, err := parsePortMappings(labels[label])
+			if err != nil {
+				continue // reported by LintLabels
+			}
+			for _, m := range mappings {
+				if reason := p.portDenied(m.ProxyPort); reason != "" {
+					issue(label, labels[label], fmt.Sprintf("%s port %d: %s", strings.ToUpper(proto), m.ProxyPort, reason),
+						"use an allowed proxy port")
+				}
+			}
+		}
+		for _, prefix := range append([]string{httpLabelPrefix}, routePrefixes(labels)...) {
+			for _, label := range []string{prefix + "host", prefix + "host." + AudienceInternal, prefix + "host." + AudienceExternal, prefix + "aliases"} {
+				for _, h := range strings.Split(labels[label], ",") {
+					if h, _, _ = strings.Cut(strings.TrimSpace(h), ":"); h == "" {
+						continue
+					}
+					if reason := p.hostnameDenied(h); reason != "" {
+						issue(label, labels[label], fmt.Sprintf("hostname %s: %s", h, reason), "use a hostname under an allowed domain")
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("*.Corp.example.com, status.example.com", "80,443,1024-65535")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if len(p.Hostnames) != 2 || p.Hostnames[0] != "*.corp.example.com" {
+		t.Errorf("Hostnames = %v", p.Hostnames)
+	}
+	if len(p.Ports) != 3 || p.Ports[2] != (PortRange{From: 1024, To: 65535}) {
+		t.Errorf("Ports = %v", p.Ports)
+	}
+	if p, err := ParsePolicy("", ""); err != nil || p.Enabled() {
+		t.Errorf("empty policy = %+v, %v, want disabled", p, err)
+	}
+
+	for _, tt := range []struct{ hostnames, ports string }{
+		{hostnames: "bad host"},
+		{ports: "http"},
+		{ports: "2000-1000"},
+		{ports: "0-80"},
+		{ports: "443-70000"},
+	} {
+		if _, err := ParsePolicy(tt.hostnames, tt.ports); err == nil {
+			t.Errorf("ParsePolicy(%q, %q) should fail", tt.hostnames, tt.ports)
+		}
+	}
+}
+
+func TestPolicyAdmit(t *testing.T) {
+	p, err := ParsePolicy("*.corp.example.com", "80,443,1024-65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := []ContainerInfo{
+		{Name: "web", ID: "a1", HTTPMapping: &HTTPMapping{
+			Hostnames: []string{"web.corp.example.com", "web.example.com"},
+			Aliases:   []string{"www.example.com"},
+		}},
+		{Name: "dns", ID: "b2", Mappings: []PortMapping{
+			{ProxyPort: 53, ContainerPort: 53, Protocol: UDP},
+			{ProxyPort: 5353, ContainerPort: 53, Protocol: UDP},
+		}},
+		{Name: "ssh", ID: "c3", Mappings: []PortMapping{{ProxyPort: 22, ContainerPort: 22}}},
+		{Name: "shop", ID: "d4", HTTPRoutes: []HTTPMapping{
+			{Hostnames: []string{"shop.example.com"}},
+			{Hostnames: []string{"Shop.Corp.Example.com"}},
+		}},
+	}
+
+	admitted, denied := p.Admit(containers)
+	if len(admitted) != 3 {
+		t.Fatalf("admitted %d containers, want web, dns and shop: %+v", len(admitted), admitted)
+	}
+	if web := admitted[0].HTTPMapping; len(web.Hostnames) != 1 || web.Hostnames[0] != "web.corp.example.com" || len(web.Aliases) != 0 {
+		t.Errorf("web mapping = %+v, want only the corp hostname", web)
+	}
+	if dns := admitted[1].Mappings; len(dns) != 1 || dns[0].ProxyPort != 5353 {
+		t.Errorf("dns mappings = %+v, want only 5353", dns)
+	}
+	if shop := admitted[2].HTTPRoutes; len(shop) != 1 || shop[0].Hostnames[0] != "Shop.Corp.Example.com" {
+		t.Errorf("shop routes = %+v, want the corp route", shop)
+	}
+	if len(containers[0].HTTPMapping.Hostnames) != 2 || len(containers[1].Mappings) != 2 {
+		t.Error("Admit changed the caller's containers")
+	}
+
+	var routes []string
+	for _, d := range denied {
+		routes = append(routes, d.Container+" "+d.Route)
+		if !strings.Contains(d.Reason, "not allowed by policy") {
+			t.Errorf("denied %+v without a policy reason", d)
+		}
+	}
+	want := "web http:web.example.com,web http:www.example.com,dns udp:53,ssh tcp:22,shop http:shop.example.com"
+	if got := strings.Join(routes, ","); got != want {
+		t.Errorf("denied = %s, want %s", got, want)
+	}
+
+	if admitted, denied := (Policy{}).Admit(containers); len(admitted) != len(containers) || denied != nil {
+		t.Errorf("zero policy admitted %d containers and denied %+v", len(admitted), denied)
+	}
+}
+
+func TestPolicyLint(t *testing.T) {
+	p, err := ParsePolicy("*.corp.example.com", "1024-65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := p.Lint(map[string]map[string]string{
+		"web": {"proxy.http.host": "web.corp.example.com,web.example.com:8080", "proxy.http.aliases": "www.corp.example.com"},
+		"db":  {"proxy.tcp.ports": "5432,22:2222"},
+		"api": {"proxy.http.routes.1.host": "api.example.com"},
+		"docs": {"proxy.http.host.internal": "docs.corp.example.com", "proxy.http.host.external": "docs.example.com",
+			"proxy.http.auth.secret": "docs-users"},
+	})
+	if len(issues) != 4 {
+		t.Fatalf("got %d issues, want 4: %+v", len(issues), issues)
+	}
+	for i, want := range []struct{ container, label, message string }{
+		{"api", "proxy.http.routes.1.host", "hostname api.example.com"},
+		{"db", "proxy.tcp.ports", "TCP port 22"},
+		{"docs", "proxy.http.host.external", "hostname docs.example.com"},
+		{"web", "proxy.http.host", "hostname web.example.com"},
+	} {
+		got := issues[i]
+		if got.Container != want.container || got.Label != want.label || !strings.HasPrefix(got.Message, want.message) ||
+			got.Severity != SeverityError {
+			t.Errorf("issue %d = %+v, want %s %s %s", i, got, want.container, want.label, want.message)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tcpPreset holds the stream settings a proxy.tcp.preset gives ports that do not set them
+// Presets never enable proxy_protocol, database clients and servers do not speak it
+type tcpPreset struct {
+	timeout        string // idle connections of pools and sessions outlive the 5m default
+	connectTimeout string
+	maxConnections int // the server's own default connection limit
+}
+
+// tcpPresets are the protocol defaults of proxy.tcp.preset
+var tcpPresets = map[string]tcpPreset{
+	// pooled connections idle between queries, max_connections defaults to 100
+	"postgres": {timeout: "1h", connectTimeout: "5s", maxConnections: 100},
+	// wait_timeout closes idle sessions after 8h, max_connections defaults to 151
+	"mysql": {timeout: "8h", connectTimeout: "5s", maxConnections: 151},
+	// pub/sub and blocking commands idle for long, maxclients defaults to 10000
+	"redis": {timeout: "1h", connectTimeout: "2s", maxConnections: 10000},
+}
+
+// parseTCPPreset returns the named preset, empty returns the zero preset
+func parseTCPPreset(s string) (tcpPreset, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" {
+		return tcpPreset{}, nil
+	}
+	preset, ok := tcpPresets[name]
+	if !ok {
+		return tcpPreset{}, fmt.Errorf("unknown preset %q, expected one of %s", s, strings.Join(tcpPresetNames(), ", "))
+	}
+	return preset, nil
+}
+
+// tcpPresetNames returns the sorted preset names
+func tcpPresetNames() []string {
+	names := make([]string, 0, len(tcpPresets))
+	for name := range tcpPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply fills the settings a mapping leaves unset, port options and labels win
+func (p tcpPreset) apply(mapping *PortMapping) {
+	if mapping.Timeout == "" {
+		mapping.Timeout = p.timeout
+	}
+	if mapping.ConnectTimeout == "" {
+		mapping.ConnectTimeout = p.connectTimeout
+	}
+	if mapping.MaxConnections == 0 {
+		mapping.MaxConnections = p.maxConnections
+	}
+}
+
+// httpPresetFiles are the proxy.http.preset data files, one presets/<name>.yml per preset
+//
+//go:embed presets/*.yml
+var httpPresetFiles embed.FS
+
+// httpPreset holds the label defaults a proxy.http.preset gives a route
+// Version is raised whenever the defaults change, the generated config names it
+type httpPreset struct {
+	Version int               `yaml:"version"`
+	Labels  map[string]string `yaml:"labels"` // label suffixes after proxy.http. or proxy.http.routes.<n>.
+}
+
+// httpPresets are the embedded HTTP presets by name
+var httpPresets = mustLoadHTTPPresets()
+
+// mustLoadHTTPPresets parses the preset files, they ship with the binary so an error is a bug
+func mustLoadHTTPPresets() map[string]httpPreset {
+	presets, err := loadHTTPPresets()
+	if err != nil {
+		panic(err)
+	}
+	return presets
+}
+
+func loadHTTPPresets() (map[string]httpPreset, error) {
+	paths, err := httpPresetFiles.ReadDir("presets")
+	if err != nil {
+		return nil, err
+	}
+	presets := make(map[string]httpPreset, len(paths))
+	for _, entry := range paths {
+		data, err := httpPresetFiles.ReadFile(path.Join("presets", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var preset httpPreset
+		if err := yaml.Unmarshal(data, &preset); err != nil {
+			return nil, fmt.Errorf("preset %s: %w", entry.Name(), err)
+		}
+		if preset.Version < 1 {
+			return nil, fmt.Errorf("preset %s: missing version", entry.Name())
+		}
+		// a preset tunes a route, it never routes hostnames or grants access
+		for suffix := range preset.Labels {
+			if !slices.Contains(httpLabelSuffixes, suffix) || slices.Contains(httpPresetReserved, suffix) {
+				return nil, fmt.Errorf("preset %s: label %s cannot be preset", entry.Name(), suffix)
+			}
+		}
+		presets[strings.TrimSuffix(entry.Name(), ".yml")] = preset
+	}
+	return presets, nil
+}
+
+// httpPresetReserved are the HTTP labels presets may not set
+var httpPresetReserved = []string{"host", "host.internal", "host.external", "preset", "auth.secret", "tls.cert.secret", "tls.key.secret",
+	"upstream.auth.secret", "oidc.auth_url", "oidc.provider", "oidc.login_url", "aliases", "static.root", "socket", "internal_only", "allow_from", "mirror"}
+
+// httpPresetNames returns the sorted HTTP preset names
+func httpPresetNames() []string {
+	names := make([]string, 0, len(httpPresets))
+	for name := range httpPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyHTTPPreset returns the labels with the defaults of the route's preset added, labels set
+// on the container win, and the preset with its version, e.g. "grafana v1"; without a preset
+// labels are returned as they are
+func applyHTTPPreset(prefix string, labels map[string]string) (map[string]string, string, error) {
+	value := labels[prefix+"preset"]
+	name := strings.ToLower(strings.TrimSpace(value))
+	if name == "" {
+		return labels, "", nil
+	}
+	preset, ok := httpPresets[name]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown preset %q, expected one of %s", value, strings.Join(httpPresetNames(), ", "))
+	}
+	merged := make(map[string]string, len(labels)+len(preset.Labels))
+	for label, v := range labels {
+		merged[label] = v
+	}
+	for suffix, v := range preset.Labels {
+		if _, ok := merged[prefix+suffix]; !ok {
+			merged[prefix+suffix] = v
+		}
+	}
+	return merged, fmt.Sprintf("%s v%d", name, preset.Version), nil
+}
@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestTCPPreset(t *testing.T) {
+	preset, err := parseTCPPreset(" Postgres ")
+	if err != nil {
+		t.Fatalf("parseTCPPreset() error = %v", err)
+	}
+
+	// port options and proxy.tcp.max_connections win over the preset
+	mappings := []PortMapping{
+		{ProxyPort: 5432},
+		{ProxyPort: 6432, Timeout: "30m", MaxConnections: 20},
+	}
+	for i := range mappings {
+		preset.apply(&mappings[i])
+	}
+	want := []PortMapping{
+		{ProxyPort: 5432, Timeout: "1h", ConnectTimeout: "5s", MaxConnections: 100},
+		{ProxyPort: 6432, Timeout: "30m", ConnectTimeout: "5s", MaxConnections: 20},
+	}
+	for i := range want {
+		if mappings[i] != want[i] {
+			t.Errorf("mapping[%d] = %+v, want %+v", i, mappings[i], want[i])
+		}
+	}
+
+	if preset, err := parseTCPPreset(""); err != nil || preset != (tcpPreset{}) {
+		t.Errorf("parseTCPPreset(\"\") = %+v, %v, want the zero preset", preset, err)
+	}
+	if _, err := parseTCPPreset("mongodb"); err == nil {
+		t.Error("parseTCPPreset(\"mongodb\") should fail")
+	}
+}
+
+func TestHTTPPresets(t *testing.T) {
+	// every shipped preset must parse into a valid route
+	c := &Client{log: lgr.New()}
+	for _, name := range httpPresetNames() {
+		mapping, err := c.parseHTTPMapping("app", httpLabelPrefix,
+			map[string]string{"proxy.http.host": "app.example.com", "proxy.http.preset": name})
+		if err != nil {
+			t.Errorf("preset %s: parseHTTPMapping() error = %v", name, err)
+			continue
+		}
+		if !strings.HasPrefix(mapping.Preset, name+" v") {
+			t.Errorf("preset %s: Preset = %q", name, mapping.Preset)
+		}
+	}
+	if len(httpPresets) < 3 {
+		t.Errorf("loaded presets %v, want grafana, home-assistant and nextcloud", httpPresetNames())
+	}
+}
+
+func TestApplyHTTPPreset(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	mapping, err := c.parseHTTPMapping("cloud", httpRouteLabelPrefix(1), map[string]string{
+		"proxy.http.routes.1.host":          "cloud.example.com",
+		"proxy.http.routes.1.preset":        "Nextcloud",
+		"proxy.http.routes.1.max_body_size": "2g",
+	})
+	if err != nil {
+		t.Fatalf("parseHTTPMapping() error = %v", err)
+	}
+	// labels on the container win over the preset
+	if mapping.MaxBodySize != "2g" || mapping.ReadTimeout != "1h" || !mapping.BufferingOff || mapping.Preset != "nextcloud v1" {
+		t.Errorf("mapping = %+v, want the preset with the label's body size", mapping)
+	}
+
+	labels := map[string]string{"proxy.http.host": "app.example.com"}
+	if got, preset, err := applyHTTPPreset(httpLabelPrefix, labels); err != nil || preset != "" || len(got) != 1 {
+		t.Errorf("applyHTTPPreset() without preset = %v, %q, %v", got, preset, err)
+	}
+	labels["proxy.http.preset"] = "wordpress"
+	if _, err := c.parseHTTPMapping("app", httpLabelPrefix, labels); err == nil || !strings.Contains(err.Error(), "grafana") {
+		t.Errorf("parseHTTPMapping() error = %v, want the known presets", err)
+	}
+}
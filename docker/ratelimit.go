@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is returned for Docker API calls over the per-minute budget of APILimits
+var ErrBudgetExhausted = errors.New("docker API budget exhausted")
+
+// default APILimits, small hosts never reach them
+const (
+	DefaultAPIRate  = 50  // calls per second
+	DefaultAPIBurst = 100 // calls at once
+)
+
+// APILimits throttle the calls of a Client to the Docker daemon, so an event storm cannot
+// hammer it with container lists and inspects; the long-lived event subscription only waits
+// for the rate and is exempt from the budget
+type APILimits struct {
+	Rate   int // sustained calls per second, 0 disables throttling
+	Burst  int // calls sent at once before throttling starts, 0 is Rate
+	Budget int // calls per minute, further calls fail with ErrBudgetExhausted; 0 is unlimited
+}
+
+// APICall is a Docker API call passed through the limits, for metrics
+type APICall struct {
+	Name     string        // list, inspect, network, exec or events
+	Waited   time.Duration // time spent throttled before the call was sent
+	Rejected bool          // over the budget and not sent
+}
+
+// limiter is a token bucket with a per-minute budget
+type limiter struct {
+	mu     sync.Mutex
+	limits APILimits
+	now    func() time.Time
+
+	tokens float64
+	last   time.Time
+	window time.Time // start of the budget minute
+	used   int       // calls in the budget minute
+}
+
+// newLimiter returns the limiter of limits, nil if they throttle nothing
+func newLimiter(limits APILimits) *limiter {
+	if limits.Rate <= 0 && limits.Budget <= 0 {
+		return nil
+	}
+	if limits.Burst <= 0 {
+		limits.Burst = limits.Rate
+	}
+	return &limiter{limits: limits, now: time.Now, tokens: float64(limits.Burst)}
+}
+
+// reserve takes a call from the bucket, and from the budget if budgeted, and returns how long
+// to wait before sending it
+func (l *limiter) reserve(budgeted bool) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	if budgeted && l.limits.Budget > 0 {
+		if now.Sub(l.window) >= time.Minute {
+			l.window, l.used = now, 0
+		}
+		if l.used >= l.limits.Budget {
+			return 0, fmt.Errorf("%w: %d calls per minute, resets in %s", ErrBudgetExhausted, l.limits.Budget,
+				l.window.Add(time.Minute).Sub(now).Round(time.Second))
+		}
+		l.used++
+	}
+	if l.limits.Rate <= 0 {
+		return 0, nil
+	}
+
+	if !l.last.IsZero() {
+		l.tokens = min(float64(l.limits.Burst), l.tokens+now.Sub(l.last).Seconds()*float64(l.limits.Rate))
+	}
+	l.last = now
+	l.tokens-- // negative tokens are calls waiting for their turn
+	if l.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(-l.tokens / float64(l.limits.Rate) * float64(time.Second)), nil
+}
+
+// SetAPILimits throttles the Docker API calls of the client, observe is told about every
+// call that passed or was rejected, nil disables it
+func (c *Client) SetAPILimits(limits APILimits, observe func(APICall)) {
+	c.limiter = newLimiter(limits)
+	c.observe = observe
+}
+
+// throttle waits until a call named name may be sent, or fails when it is over the budget
+// or ctx ends first. The event subscription is never rejected, a watcher resubscribing after
+// a burst of scans would otherwise exit
+func (c *Client) throttle(ctx context.Context, name string) error {
+	if c.limiter == nil {
+		return nil
+	}
+	wait, err := c.limiter.reserve(name != "events")
+	if err != nil {
+		c.log.Logf("WARN [Docker] call rejected call=%s reason=%q", name, err)
+		if c.observe != nil {
+			c.observe(APICall{Name: name, Rejected: true})
+		}
+		return err
+	}
+	if wait > 0 {
+		c.log.Logf("DEBUG [Docker] call throttled call=%s wait=%s", name, wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("throttled docker %s call canceled: %w", name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+	if c.observe != nil {
+		c.observe(APICall{Name: name, Waited: wait})
+	}
+	return nil
+}
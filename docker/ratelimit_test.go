@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestNewLimiter(t *testing.T) {
+	if l := newLimiter(APILimits{}); l != nil {
+		t.Errorf("expected no limiter without limits, got %+v", l)
+	}
+	if l := newLimiter(APILimits{Rate: 5}); l == nil || l.limits.Burst != 5 {
+		t.Errorf("expected burst to default to the rate, got %+v", l)
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newLimiter(APILimits{Rate: 10, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	var waits []time.Duration
+	for range 4 {
+		wait, err := l.reserve(true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		waits = append(waits, wait)
+	}
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Errorf("call %d: expected wait %s, got %s", i, want[i], waits[i])
+		}
+	}
+
+	// a second refills the bucket, previous waits included
+	now = now.Add(time.Second)
+	if wait, _ := l.reserve(true); wait != 0 {
+		t.Errorf("expected refilled bucket, got wait %s", wait)
+	}
+}
+
+func TestLimiterBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newLimiter(APILimits{Budget: 2})
+	l.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := l.reserve(true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	now = now.Add(20 * time.Second)
+	_, err := l.reserve(true)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("expected ErrBudgetExhausted, got %v", err)
+	}
+	if want := "docker API budget exhausted: 2 calls per minute, resets in 40s"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+
+	if _, err := l.reserve(false); err != nil {
+		t.Errorf("expected unbudgeted calls over the budget to pass, got %v", err)
+	}
+
+	now = now.Add(40 * time.Second)
+	if _, err := l.reserve(true); err != nil {
+		t.Errorf("expected the budget to reset after a minute, got %v", err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	c := &Client{log: lgr.New()}
+	if err := c.throttle(context.Background(), "list"); err != nil {
+		t.Fatalf("expected unlimited client to pass, got %v", err)
+	}
+
+	var calls []APICall
+	c.SetAPILimits(APILimits{Rate: 1, Burst: 1, Budget: 2}, func(call APICall) { calls = append(calls, call) })
+	if err := c.throttle(context.Background(), "list"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.throttle(ctx, "inspect"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected throttled call to end with ctx, got %v", err)
+	}
+	if err := c.throttle(context.Background(), "inspect"); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+
+	want := []APICall{{Name: "list"}, {Name: "inspect", Rejected: true}}
+	if len(calls) != len(want) {
+		t.Fatalf("expected observed calls %+v, got %+v", want, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: expected %+v, got %+v", i, want[i], calls[i])
+		}
+	}
+}
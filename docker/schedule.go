@@ -0,0 +1,165 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errOutsideSchedule marks containers skipped because their proxy.schedule window is closed
+var errOutsideSchedule = errors.New("outside the proxy.schedule window")
+
+// weekdays maps the day names of proxy.schedule to their weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// schedule is a set of weekly windows in which a container is routed, in local time
+type schedule struct {
+	spec    string
+	windows []scheduleWindow
+}
+
+// scheduleWindow is open from start to end minutes of its days,
+// a window ending before it starts closes the next day
+type scheduleWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+// parseSchedule parses windows like "Mon-Fri 08:00-18:00; Sat 10:00-14:00", nil when empty
+// The days are optional and default to every day
+func parseSchedule(s string) (*schedule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	sched := &schedule{spec: s}
+	for _, part := range strings.Split(s, ";") {
+		fields := strings.Fields(part)
+		var window scheduleWindow
+		switch len(fields) {
+		case 1:
+			for d := range window.days {
+				window.days[d] = true
+			}
+		case 2:
+			days, err := parseDays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			window.days = days
+		default:
+			return nil, fmt.Errorf("invalid window %q, expected days and times like Mon-Fri 08:00-18:00", strings.TrimSpace(part))
+		}
+
+		times := fields[len(fields)-1]
+		from, to, ok := strings.Cut(times, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid times %q, expected a range like 08:00-18:00", times)
+		}
+		var err error
+		if window.start, err = parseClock(from, false); err != nil {
+			return nil, err
+		}
+		if window.end, err = parseClock(to, true); err != nil {
+			return nil, err
+		}
+		if window.start == window.end {
+			return nil, fmt.Errorf("invalid times %q, the window is empty", times)
+		}
+		sched.windows = append(sched.windows, window)
+	}
+	return sched, nil
+}
+
+// parseDays parses comma-separated days and day ranges, e.g. Mon-Fri or Sat,Sun
+// A range like Fri-Mon wraps around the weekend
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[strings.ToLower(from)]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q, expected Mon, Tue, Wed, Thu, Fri, Sat or Sun", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(to)]; !ok {
+				return days, fmt.Errorf("invalid day %q, expected Mon, Tue, Wed, Thu, Fri, Sat or Sun", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses HH:MM into minutes of the day, 24:00 only as end of a window
+func parseClock(s string, end bool) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	hours, herr := strconv.Atoi(hh)
+	minutes, merr := strconv.Atoi(mm)
+	if !ok || len(hh) != 2 || len(mm) != 2 || herr != nil || merr != nil || hours > 24 || minutes > 59 ||
+		(hours == 24 && (minutes != 0 || !end)) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// open reports whether a window of the schedule is open at t
+func (s *schedule) open(t time.Time) bool {
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// overnight window, open from start on its days until end the next day
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the first time after t at which a window opens or closes
+func (s *schedule) next(t time.Time) time.Time {
+	t = t.Local()
+	var next time.Time
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, time.Local)
+		for _, w := range s.windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			end := w.end
+			if w.end < w.start {
+				end += 24 * 60
+			}
+			for _, minute := range []int{w.start, end} {
+				boundary := time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, time.Local)
+				if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+	}
+	return next
+}
+
+// String returns the schedule as written in the label
+func (s *schedule) String() string {
+	return s.spec
+}
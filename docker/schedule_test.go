@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, input := range []string{"", "Mon-Fri 08:00-18:00", "sat,sun 10:00-24:00", "Fri-Mon 22:00-06:00", "09:00-17:00; Sat 10:00-12:00"} {
+		if _, err := parseSchedule(input); err != nil {
+			t.Errorf("parseSchedule(%q) error = %v", input, err)
+		}
+	}
+	for _, input := range []string{"Mon-Fri", "Weekdays 08:00-18:00", "Mon-Fri 8:00-18:00", "Mon 08:00", "Mon 08:00-08:00",
+		"Mon 24:00-18:00", "Mon 08:00-18:60", "Mon Tue 08:00-18:00", "Mon-Fri 08:00-18:00;"} {
+		if _, err := parseSchedule(input); err == nil {
+			t.Errorf("parseSchedule(%q) should fail", input)
+		}
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	// 2025-06-02 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 6, day, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"Mon-Fri 08:00-18:00", at(2, 8, 0), true},
+		{"Mon-Fri 08:00-18:00", at(2, 18, 0), false},
+		{"Mon-Fri 08:00-18:00", at(7, 12, 0), false}, // Saturday
+		{"Fri-Mon 22:00-06:00", at(3, 5, 59), true},  // Tuesday morning, opened on Monday
+		{"Fri-Mon 22:00-06:00", at(3, 22, 0), false}, // Tuesday evening
+		{"Sun 10:00-24:00", at(8, 23, 59), true},
+		{"09:00-17:00; Sat 10:00-12:00", at(7, 11, 0), true},
+	}
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q) error = %v", tt.spec, err)
+		}
+		if got := sched.open(tt.at); got != tt.want {
+			t.Errorf("schedule %q open at %s = %t, want %t", tt.spec, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 6, day, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		spec     string
+		from     time.Time
+		wantNext time.Time
+	}{
+		{"Mon-Fri 08:00-18:00", at(2, 12, 0), at(2, 18, 0)},
+		{"Mon-Fri 08:00-18:00", at(2, 18, 0), at(3, 8, 0)},
+		{"Mon-Fri 08:00-18:00", at(6, 19, 0), at(9, 8, 0)}, // Friday evening to Monday
+		{"Mon 22:00-06:00", at(3, 1, 0), at(3, 6, 0)},
+		{"Mon 22:00-06:00", at(3, 6, 0), at(9, 22, 0)},
+	}
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q) error = %v", tt.spec, err)
+		}
+		if got := sched.next(tt.from); !got.Equal(tt.wantNext) {
+			t.Errorf("schedule %q next after %s = %s, want %s", tt.spec, tt.from, got, tt.wantNext)
+		}
+	}
+}
+
+func TestRouteChange(t *testing.T) {
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.Local)
+	created := now.Add(-time.Hour).Unix()
+	tests := []struct {
+		labels map[string]string
+		want   time.Time
+	}{
+		{map[string]string{"proxy.expires": "2h"}, now.Add(time.Hour)},
+		{map[string]string{"proxy.expires": "2h", "proxy.schedule": "08:00-12:30"}, now.Add(30 * time.Minute)},
+		{map[string]string{"proxy.expires": "30m"}, time.Time{}}, // already expired
+		{map[string]string{"proxy.schedule": "invalid"}, time.Time{}},
+		{map[string]string{"proxy.http.host": "app.example.com"}, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := routeChange(types.Container{Labels: tt.labels, Created: created}, now); !got.Equal(tt.want) {
+			t.Errorf("routeChange(%v) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SocketCandidates returns the unix sockets probed when the default Docker socket is missing:
+// rootless Docker, rootless and rootful Podman, and Docker Desktop
+func SocketCandidates() []string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", strconv.Itoa(os.Getuid()))
+	}
+
+	candidates := []string{
+		filepath.Join(runtimeDir, "docker.sock"),
+		filepath.Join(runtimeDir, "podman", "podman.sock"),
+		"/run/podman/podman.sock",
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".docker", "run", "docker.sock"))
+	}
+	return candidates
+}
+
+// DetectHost returns host if its unix socket exists, otherwise the first existing socket
+// of candidates as a unix:// host
+// Returns false if no socket was found or host is not a unix socket, host is returned as is then
+func DetectHost(host string, candidates []string) (string, bool) {
+	path, ok := strings.CutPrefix(host, "unix://")
+	if !ok {
+		return host, false
+	}
+	if isSocket(path) {
+		return host, true
+	}
+
+	for _, candidate := range candidates {
+		if isSocket(candidate) {
+			return "unix://" + candidate, true
+		}
+	}
+	return host, false
+}
+
+// isSocket reports whether path is an existing unix socket
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectHost(t *testing.T) {
+	// unix socket paths are limited to ~100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "sockets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	rootless := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", rootless)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	plainFile := filepath.Join(dir, "podman.sock")
+	if err := os.WriteFile(plainFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := "unix://" + filepath.Join(dir, "missing.sock")
+
+	tests := []struct {
+		name       string
+		host       string
+		candidates []string
+		want       string
+		wantOK     bool
+	}{
+		{name: "existing socket is kept", host: "unix://" + rootless, want: "unix://" + rootless, wantOK: true},
+		{name: "first existing candidate", host: missing, candidates: []string{plainFile, rootless},
+			want: "unix://" + rootless, wantOK: true},
+		{name: "no socket found", host: missing, candidates: []string{plainFile}, want: missing},
+		{name: "non-unix host", host: "tcp://127.0.0.1:2375", candidates: []string{rootless}, want: "tcp://127.0.0.1:2375"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectHost(tt.host, tt.candidates)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("DetectHost() = %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
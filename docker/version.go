@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/versions"
+)
+
+// Feature is a Docker API capability the proxy relies on
+type Feature string
+
+// features checked by CheckAPIVersion
+const (
+	FeatureScan    Feature = "container scan"           // container list with label filters and inspect
+	FeatureEvents  Feature = "container event filters"  // events filtered by type and action
+	FeatureNetwork Feature = "attachable proxy network" // network create with Attachable
+	FeatureExec    Feature = "docker-exec targets"      // archive upload, exec create and inspect
+)
+
+// minAPIVersions is the oldest Docker API version supporting each feature
+var minAPIVersions = map[Feature]string{
+	FeatureScan:    "1.24",
+	FeatureEvents:  "1.24",
+	FeatureNetwork: "1.25",
+	FeatureExec:    "1.25",
+}
+
+// APIVersion returns the Docker API version used by the client, pinned or negotiated with the daemon
+func (c *Client) APIVersion() string {
+	return c.cli.ClientVersion()
+}
+
+// CheckAPIVersion fails if the API version in use is older than one of the features needs
+// The error lists every unsupported feature with the version it requires
+func (c *Client) CheckAPIVersion(features ...Feature) error {
+	return checkAPIVersion(c.APIVersion(), features)
+}
+
+func checkAPIVersion(version string, features []Feature) error {
+	var unsupported []string
+	for _, feature := range features {
+		minVersion, ok := minAPIVersions[feature]
+		if ok && versions.LessThan(version, minVersion) {
+			unsupported = append(unsupported, fmt.Sprintf("%s needs %s", feature, minVersion))
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("docker API version %s is too old: %s", version, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// checkPinnedVersion verifies that the daemon serves a pinned API version
+func (c *Client) checkPinnedVersion(ctx context.Context, pinned string) error {
+	server, err := c.cli.ServerVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Docker version: %w", err)
+	}
+	if server.APIVersion != "" && versions.GreaterThan(pinned, server.APIVersion) {
+		return fmt.Errorf("docker API version %s is newer than the daemon's %s (Docker %s)",
+			pinned, server.APIVersion, server.Version)
+	}
+	if server.MinAPIVersion != "" && versions.LessThan(pinned, server.MinAPIVersion) {
+		return fmt.Errorf("docker API version %s is older than the daemon's minimum %s (Docker %s)",
+			pinned, server.MinAPIVersion, server.Version)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestCheckAPIVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		features []Feature
+		wantErr  string
+	}{
+		{name: "current daemon", version: "1.44", features: []Feature{FeatureScan, FeatureEvents, FeatureNetwork, FeatureExec}},
+		{name: "oldest supported", version: "1.25", features: []Feature{FeatureScan, FeatureNetwork, FeatureExec}},
+		{name: "scan only on old daemon", version: "1.24", features: []Feature{FeatureScan, FeatureEvents}},
+		{
+			name:     "lists every unsupported feature",
+			version:  "1.24",
+			features: []Feature{FeatureScan, FeatureNetwork, FeatureExec},
+			wantErr:  "docker API version 1.24 is too old: attachable proxy network needs 1.25, docker-exec targets needs 1.25",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIVersion(tt.version, tt.features)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkAPIVersion() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkAPIVersion() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClientAPIVersion(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Api-Version", "1.43")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"Version":"24.0.7","ApiVersion":"1.43","MinAPIVersion":"1.12"}`))
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+	host := "tcp://" + strings.TrimPrefix(srv.URL, "http://")
+
+	t.Run("negotiates with the daemon", func(t *testing.T) {
+		c, err := NewClient(host, "", lgr.New())
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+		if c.APIVersion() != "1.43" {
+			t.Errorf("APIVersion() = %s, want 1.43", c.APIVersion())
+		}
+	})
+
+	t.Run("pins a supported version", func(t *testing.T) {
+		paths = nil
+		c, err := NewClient(host, "v1.41", lgr.New())
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+		if c.APIVersion() != "1.41" {
+			t.Errorf("APIVersion() = %s, want 1.41", c.APIVersion())
+		}
+		if len(paths) == 0 || !strings.HasPrefix(paths[len(paths)-1], "/v1.41/") {
+			t.Errorf("requests %v do not use the pinned version", paths)
+		}
+	})
+
+	t.Run("rejects a version newer than the daemon", func(t *testing.T) {
+		_, err := NewClient(host, "1.44", lgr.New())
+		if err == nil || !strings.Contains(err.Error(), "newer than the daemon's 1.43") {
+			t.Errorf("NewClient() error = %v", err)
+		}
+	})
+}
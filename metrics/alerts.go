@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/notify"
+)
+
+// alert event types sent to webhooks
+const (
+	AlertFiring   = "alert.firing"
+	AlertResolved = "alert.resolved"
+)
+
+// defaultMinRequests keeps a rule from firing on a handful of requests
+const defaultMinRequests = 10
+
+// statusClassRe matches status classes recorded by the tailer
+var statusClassRe = regexp.MustCompile(`^[1-5]xx$`)
+
+// AlertRule fires when the share of requests with a status class on a host
+// stays above a threshold over a window
+type AlertRule struct {
+	Name        string
+	Host        string        // hostname, empty checks every host separately
+	Status      string        // status class, default 5xx
+	Threshold   float64       // ratio between 0 and 1, e.g. 0.1 for 10%
+	For         time.Duration // window the ratio is computed over
+	MinRequests int           // requests in the window needed to fire (default: 10)
+}
+
+// Alerter evaluates alert rules against the access log counters and
+// notifies webhooks when an alert fires or resolves
+type Alerter struct {
+	rules    []AlertRule
+	registry *Registry
+	notifier notify.Sink
+	interval time.Duration
+	log      *lgr.Logger
+
+	history []counterSnapshot // oldest first
+	firing  map[string]bool   // keyed by rule name and host
+}
+
+// counterSnapshot holds request counts per host and status class at one time
+type counterSnapshot struct {
+	at    time.Time
+	hosts map[string]map[string]float64
+}
+
+// NewAlerter validates rules and creates an alerter
+func NewAlerter(rules []AlertRule, registry *Registry, notifier notify.Sink, log *lgr.Logger) (*Alerter, error) {
+	seen := make(map[string]bool)
+	checked := make([]AlertRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("alert rule without name")
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule %q", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		if rule.Status == "" {
+			rule.Status = "5xx"
+		}
+		if !statusClassRe.MatchString(rule.Status) {
+			return nil, fmt.Errorf("alert %q: invalid status %q, expected a class like 5xx", rule.Name, rule.Status)
+		}
+		if rule.Threshold <= 0 || rule.Threshold > 1 {
+			return nil, fmt.Errorf("alert %q: threshold must be a ratio above 0 and up to 1, got %v", rule.Name, rule.Threshold)
+		}
+		if rule.For < time.Minute {
+			return nil, fmt.Errorf("alert %q: for must be at least 1m, got %s", rule.Name, rule.For)
+		}
+		if rule.MinRequests < 0 {
+			return nil, fmt.Errorf("alert %q: min-requests must not be negative", rule.Name)
+		}
+		if rule.MinRequests == 0 {
+			rule.MinRequests = defaultMinRequests
+		}
+		checked = append(checked, rule)
+	}
+
+	return &Alerter{
+		rules:    checked,
+		registry: registry,
+		notifier: notifier,
+		interval: 15 * time.Second,
+		log:      log,
+		firing:   make(map[string]bool),
+	}, nil
+}
+
+// Run evaluates the rules until ctx is cancelled
+func (a *Alerter) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.evaluate(ctx, time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluate records a snapshot and checks every rule against the window ending now
+func (a *Alerter) evaluate(ctx context.Context, now time.Time) {
+	current := a.snapshot(now)
+	a.history = append(a.history, current)
+
+	var longest time.Duration
+	for _, rule := range a.rules {
+		longest = max(longest, rule.For)
+	}
+	// keep one snapshot at or before the longest window as its baseline
+	for len(a.history) > 1 && !a.history[1].at.After(now.Add(-longest)) {
+		a.history = a.history[1:]
+	}
+
+	for _, rule := range a.rules {
+		baseline, ok := a.baseline(now.Add(-rule.For))
+		if !ok {
+			continue // not enough history to cover the window yet
+		}
+		for host, counts := range current.hosts {
+			if rule.Host != "" && rule.Host != host {
+				continue
+			}
+			ratio, total := statusRatio(counts, baseline.hosts[host], rule.Status)
+			breached := total >= float64(rule.MinRequests) && ratio > rule.Threshold
+			a.transition(ctx, rule, host, breached, ratio, total)
+		}
+	}
+}
+
+// statusRatio returns the share of requests with status since the baseline counts and the request count
+func statusRatio(counts, baseline map[string]float64, status string) (ratio, total float64) {
+	var matched float64
+	for class, count := range counts {
+		delta := count - baseline[class]
+		total += delta
+		if class == status {
+			matched += delta
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return matched / total, total
+}
+
+// baseline returns the newest snapshot taken at or before since
+func (a *Alerter) baseline(since time.Time) (counterSnapshot, bool) {
+	for i := len(a.history) - 1; i >= 0; i-- {
+		if !a.history[i].at.After(since) {
+			return a.history[i], true
+		}
+	}
+	return counterSnapshot{}, false
+}
+
+// transition notifies webhooks when the state of rule on host changes
+func (a *Alerter) transition(ctx context.Context, rule AlertRule, host string, breached bool, ratio, total float64) {
+	key := rule.Name + "\x00" + host
+	if breached == a.firing[key] {
+		return
+	}
+	a.firing[key] = breached
+
+	eventType, state := AlertFiring, "firing"
+	if !breached {
+		eventType, state = AlertResolved, "resolved"
+	}
+	message := fmt.Sprintf("%s %s on %s: %s ratio %.1f%% (threshold %.1f%%) over %s",
+		rule.Name, state, host, rule.Status, ratio*100, rule.Threshold*100, rule.For)
+	a.log.Logf("WARN [Alerts] %s", message)
+
+	a.notifier.Notify(ctx, notify.Event{
+		Type:    eventType,
+		Message: message,
+		Details: map[string]string{
+			"rule":      rule.Name,
+			"host":      host,
+			"status":    rule.Status,
+			"ratio":     strconv.FormatFloat(ratio, 'f', 4, 64),
+			"threshold": strconv.FormatFloat(rule.Threshold, 'f', 4, 64),
+			"window":    rule.For.String(),
+			"requests":  strconv.FormatFloat(total, 'f', 0, 64),
+		},
+	})
+}
+
+// snapshot copies the request counters per host and status class
+func (a *Alerter) snapshot(now time.Time) counterSnapshot {
+	snap := counterSnapshot{at: now, hosts: make(map[string]map[string]float64)}
+	for _, sample := range a.registry.Samples(requestsTotal) {
+		host := sample.Labels["host"]
+		if snap.hosts[host] == nil {
+			snap.hosts[host] = make(map[string]float64)
+		}
+		snap.hosts[host][sample.Labels["status_class"]] = sample.Value
+	}
+	return snap
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/notify"
+)
+
+func TestNewAlerterValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		wantErr bool
+	}{
+		{name: "valid", rule: AlertRule{Name: "api-5xx", Threshold: 0.1, For: 5 * time.Minute}},
+		{name: "missing name", rule: AlertRule{Threshold: 0.1, For: 5 * time.Minute}, wantErr: true},
+		{name: "bad status", rule: AlertRule{Name: "a", Status: "500", Threshold: 0.1, For: 5 * time.Minute}, wantErr: true},
+		{name: "percent threshold", rule: AlertRule{Name: "a", Threshold: 10, For: 5 * time.Minute}, wantErr: true},
+		{name: "zero threshold", rule: AlertRule{Name: "a", For: 5 * time.Minute}, wantErr: true},
+		{name: "short window", rule: AlertRule{Name: "a", Threshold: 0.1, For: 10 * time.Second}, wantErr: true},
+		{name: "negative min requests", rule: AlertRule{Name: "a", Threshold: 0.1, For: time.Minute, MinRequests: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAlerter([]AlertRule{tt.rule}, NewRegistry(), notify.New(nil, lgr.New()), lgr.New())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAlerter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("duplicate names", func(t *testing.T) {
+		rule := AlertRule{Name: "a", Threshold: 0.1, For: time.Minute}
+		if _, err := NewAlerter([]AlertRule{rule, rule}, NewRegistry(), notify.New(nil, lgr.New()), lgr.New()); err == nil {
+			t.Error("expected duplicate rule error")
+		}
+	})
+}
+
+func TestAlerterEvaluate(t *testing.T) {
+	var events []notify.Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		events = append(events, event)
+	}))
+	defer webhook.Close()
+
+	registry := NewRegistry()
+	requests := func(host, class string, n int) {
+		registry.Add(requestsTotal, "", Labels{"host": host, "status_class": class}, float64(n))
+	}
+	alerter, err := NewAlerter([]AlertRule{
+		{Name: "api-5xx", Host: "api.example.com", Threshold: 0.1, For: 5 * time.Minute},
+	}, registry, notify.New([]string{webhook.URL}, lgr.New()), lgr.New())
+	if err != nil {
+		t.Fatalf("NewAlerter() error = %v", err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	requests("api.example.com", "2xx", 100)
+	requests("web.example.com", "5xx", 100)
+	alerter.evaluate(ctx, start)
+
+	// errors before the window is covered do not fire
+	requests("api.example.com", "5xx", 50)
+	alerter.evaluate(ctx, start.Add(time.Minute))
+	if len(events) != 0 {
+		t.Fatalf("expected no events before the window is covered, got %+v", events)
+	}
+
+	// 50 of 60 requests in the last 5m failed
+	requests("api.example.com", "2xx", 10)
+	alerter.evaluate(ctx, start.Add(5*time.Minute))
+	if len(events) != 1 || events[0].Type != AlertFiring || events[0].Details["host"] != "api.example.com" {
+		t.Fatalf("expected one firing event for api.example.com, got %+v", events)
+	}
+
+	// still failing, no repeated notification
+	requests("api.example.com", "5xx", 50)
+	alerter.evaluate(ctx, start.Add(8*time.Minute))
+	if len(events) != 1 {
+		t.Fatalf("expected no repeated event, got %+v", events)
+	}
+
+	// healthy traffic over the following window resolves the alert
+	requests("api.example.com", "2xx", 500)
+	alerter.evaluate(ctx, start.Add(14*time.Minute))
+	if len(events) != 2 || events[1].Type != AlertResolved {
+		t.Fatalf("expected a resolved event, got %+v", events)
+	}
+}
+
+func TestStatusRatio(t *testing.T) {
+	ratio, total := statusRatio(
+		map[string]float64{"2xx": 90, "5xx": 30},
+		map[string]float64{"2xx": 50, "5xx": 20},
+		"5xx",
+	)
+	if ratio != 0.2 || total != 50 {
+		t.Errorf("statusRatio() = %v, %v, want 0.2, 50", ratio, total)
+	}
+
+	if ratio, total := statusRatio(map[string]float64{"2xx": 5}, map[string]float64{"2xx": 5}, "5xx"); ratio != 0 || total != 0 {
+		t.Errorf("statusRatio() without traffic = %v, %v", ratio, total)
+	}
+}
@@ -0,0 +1,275 @@
+// Package metrics collects proxy metrics and exposes them in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Labels are the label names and values of one series
+type Labels map[string]string
+
+// metric types of the exposition format
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+	typeSummary = "summary"
+)
+
+// summaryWindow is the number of recent observations quantiles are computed from
+const summaryWindow = 1024
+
+// summaryQuantiles are reported for every summary
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Registry holds metric families, it is safe for concurrent use
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	ready    func() error // readiness check of /readyz, nil is always ready
+}
+
+type family struct {
+	typ    string
+	help   string
+	series map[string]*series // keyed by rendered labels
+}
+
+type series struct {
+	labels Labels
+	value  float64        // counter or gauge value
+	fn     func() float64 // gauge computed when read, see SetFunc
+
+	// summary state
+	window []float64 // ring buffer of the last observations
+	next   int
+	sum    float64
+	count  uint64
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Add increments a counter
+func (r *Registry) Add(name, help string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, typeCounter, help, labels).value += delta
+}
+
+// Set sets a gauge
+func (r *Registry) Set(name, help string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, typeGauge, help, labels).value = value
+}
+
+// SetFunc sets a gauge computed on every read, e.g. the age of an event
+// fn is called with the registry locked and must not use it
+func (r *Registry) SetFunc(name, help string, labels Labels, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, typeGauge, help, labels).fn = fn
+}
+
+// Observe records a summary observation
+func (r *Registry) Observe(name, help string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, typeSummary, help, labels)
+	if len(s.window) < summaryWindow {
+		s.window = append(s.window, value)
+	} else {
+		s.window[s.next] = value
+		s.next = (s.next + 1) % summaryWindow
+	}
+	s.sum += value
+	s.count++
+}
+
+// series returns the series for labels, creating the family and series on first use
+// The caller holds r.mu
+func (r *Registry) series(name, typ, help string, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{typ: typ, help: help, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := renderLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: copyLabels(labels)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// current returns the value of a counter or gauge series
+func (s *series) current() float64 {
+	if s.fn != nil {
+		return s.fn()
+	}
+	return s.value
+}
+
+// Sample is the value of one counter or gauge series
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// Samples returns the current values of a counter or gauge family
+func (r *Registry) Samples(name string) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		return nil
+	}
+	samples := make([]Sample, 0, len(f.series))
+	for _, key := range sortedKeys(f.series) {
+		s := f.series[key]
+		samples = append(samples, Sample{Labels: copyLabels(s.labels), Value: s.current()})
+	}
+	return samples
+}
+
+// WriteTo writes all metrics in the Prometheus text format, sorted by name and labels
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(r.families) {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+		for _, key := range sortedKeys(f.series) {
+			s := f.series[key]
+			if f.typ != typeSummary {
+				fmt.Fprintf(&b, "%s%s %s\n", name, wrapLabels(key), formatFloat(s.current()))
+				continue
+			}
+			sorted := append([]float64(nil), s.window...)
+			sort.Float64s(sorted)
+			for _, q := range summaryQuantiles {
+				qKey := joinLabels(key, `quantile="`+formatFloat(q)+`"`)
+				fmt.Fprintf(&b, "%s%s %s\n", name, wrapLabels(qKey), formatFloat(quantile(sorted, q)))
+			}
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, wrapLabels(key), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, wrapLabels(key), s.count)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Handler serves the registry on /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w) //nolint:errcheck // client write errors are not actionable
+	})
+}
+
+// SetReady sets the readiness check served on /readyz
+// fn returns why the proxy is not ready, nil when it is
+func (r *Registry) SetReady(fn func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready = fn
+}
+
+// ReadyHandler serves /readyz, 200 while the readiness check passes and 503 with its error otherwise
+func (r *Registry) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		ready := r.ready
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if ready != nil {
+			if err := ready(); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = fmt.Fprintf(w, "not ready: %v\n", err) //nolint:errcheck // client write errors are not actionable
+				return
+			}
+		}
+		_, _ = io.WriteString(w, "ok\n") //nolint:errcheck // client write errors are not actionable
+	})
+}
+
+// quantile returns the q-quantile of sorted values, NaN without values
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	return sorted[int(q*float64(len(sorted)-1)+0.5)]
+}
+
+// renderLabels renders labels as name="value" pairs sorted by name
+func renderLabels(labels Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		pairs = append(pairs, name+`="`+escapeLabel(labels[name])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func copyLabels(labels Labels) Labels {
+	c := make(Labels, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func joinLabels(key, pair string) string {
+	if key == "" {
+		return pair
+	}
+	return key + "," + pair
+}
+
+func wrapLabels(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
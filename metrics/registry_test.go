@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Add("proxy_http_requests_total", "Requests", Labels{"host": "b.example.com", "status_class": "2xx"}, 1)
+	r.Add("proxy_http_requests_total", "Requests", Labels{"status_class": "5xx", "host": "a.example.com"}, 2)
+	r.Add("proxy_http_requests_total", "Requests", Labels{"host": "a.example.com", "status_class": "5xx"}, 1)
+	r.Set("proxy_up", "Up", nil, 1)
+	for i := 1; i <= 100; i++ {
+		r.Observe("proxy_http_request_duration_seconds", "Duration", Labels{"host": `we"ird`}, float64(i))
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP proxy_http_request_duration_seconds Duration
+# TYPE proxy_http_request_duration_seconds summary
+proxy_http_request_duration_seconds{host="we\"ird",quantile="0.5"} 51
+proxy_http_request_duration_seconds{host="we\"ird",quantile="0.9"} 90
+proxy_http_request_duration_seconds{host="we\"ird",quantile="0.99"} 99
+proxy_http_request_duration_seconds_sum{host="we\"ird"} 5050
+proxy_http_request_duration_seconds_count{host="we\"ird"} 100
+# HELP proxy_http_requests_total Requests
+# TYPE proxy_http_requests_total counter
+proxy_http_requests_total{host="a.example.com",status_class="5xx"} 3
+proxy_http_requests_total{host="b.example.com",status_class="2xx"} 1
+# HELP proxy_up Up
+# TYPE proxy_up gauge
+proxy_up 1
+`
+	if b.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestSummaryWindow(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < summaryWindow; i++ {
+		r.Observe("d", "Duration", nil, 100)
+	}
+	// old observations leave the window, totals keep them
+	for i := 0; i < summaryWindow; i++ {
+		r.Observe("d", "Duration", nil, 1)
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	for _, want := range []string{`d{quantile="0.99"} 1`, "d_sum 103424", "d_count 2048"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestSetFunc(t *testing.T) {
+	r := NewRegistry()
+	value := 1.0
+	r.SetFunc("proxy_age_seconds", "Age", nil, func() float64 { return value })
+
+	value = 42
+	if samples := r.Samples("proxy_age_seconds"); len(samples) != 1 || samples[0].Value != 42 {
+		t.Errorf("Samples() = %+v, want the value computed when read", samples)
+	}
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if !strings.Contains(b.String(), "# TYPE proxy_age_seconds gauge\nproxy_age_seconds 42\n") {
+		t.Errorf("WriteTo() =\n%s", b.String())
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	r := NewRegistry()
+	status := func() (int, string) {
+		rec := httptest.NewRecorder()
+		r.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := status(); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("without check = %d %q, want ready", code, body)
+	}
+
+	var failing error
+	r.SetReady(func() error { return failing })
+	if code, _ := status(); code != http.StatusOK {
+		t.Errorf("passing check = %d, want 200", code)
+	}
+	failing = errors.New("5 consecutive runs failed")
+	if code, body := status(); code != http.StatusServiceUnavailable || body != "not ready: 5 consecutive runs failed\n" {
+		t.Errorf("failing check = %d %q, want 503 with the reason", code, body)
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Server exposes a registry on /metrics for Prometheus to scrape and its readiness on /readyz
+type Server struct {
+	addr     string
+	registry *Registry
+	log      *lgr.Logger
+	srv      *http.Server
+}
+
+// NewServer creates a metrics server listening on addr
+func NewServer(addr string, registry *Registry, log *lgr.Logger) *Server {
+	return &Server{addr: addr, registry: registry, log: log}
+}
+
+// Start begins serving metrics in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.registry.Handler())
+	mux.Handle("/readyz", s.registry.ReadyHandler())
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Logf("ERROR [Metrics] metrics server failed error=%q", err)
+		}
+	}()
+
+	s.log.Logf("INFO [Metrics] serving metrics addr=%s", s.addr)
+	return nil
+}
+
+// Close stops the metrics server
+func (s *Server) Close(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("metrics server shutdown failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// metric names recorded from the access log
+const (
+	requestsTotal    = "proxy_http_requests_total"
+	requestDuration  = "proxy_http_request_duration_seconds"
+	receivedBytes    = "proxy_http_received_bytes_total"
+	sentBytes        = "proxy_http_sent_bytes_total"
+	upstreamDuration = "proxy_http_upstream_duration_seconds"
+)
+
+// accessLogEntry is one line of the proxy_json access log format
+type accessLogEntry struct {
+	Host          string  `json:"host"`
+	Status        int     `json:"status"`
+	RequestTime   float64 `json:"request_time"`
+	RequestLength int64   `json:"request_length"`
+	BytesSent     int64   `json:"bytes_sent"`
+
+	// "0.012", "-" without an upstream, "0.010, 0.004" when several servers were tried
+	UpstreamResponseTime string `json:"upstream_response_time"`
+}
+
+// Tailer follows a JSON access log and records per-host request metrics
+// Rotated or truncated logs are reopened and read from the start
+type Tailer struct {
+	path     string
+	registry *Registry
+	interval time.Duration
+	log      *lgr.Logger
+
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+}
+
+// NewTailer creates a tailer for the access log at path
+func NewTailer(path string, registry *Registry, log *lgr.Logger) *Tailer {
+	return &Tailer{path: path, registry: registry, interval: time.Second, log: log}
+}
+
+// Run follows the log until ctx is cancelled
+// Lines already in the log on startup are skipped, only new requests are counted
+func (t *Tailer) Run(ctx context.Context) {
+	defer t.close()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	first := true
+	for {
+		if err := t.poll(first); err != nil {
+			t.log.Logf("DEBUG [Metrics] access log poll failed path=%s error=%q", t.path, err)
+		}
+		first = false
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll reopens the log if needed and records new complete lines
+func (t *Tailer) poll(skipExisting bool) error {
+	if err := t.reopenIfRotated(skipExisting); err != nil {
+		return err
+	}
+	if t.file == nil {
+		return nil
+	}
+
+	for {
+		line, err := t.reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// keep a partial line for the next poll
+			if len(line) > 0 {
+				if _, seekErr := t.file.Seek(t.offset, io.SeekStart); seekErr != nil {
+					return fmt.Errorf("seek failed: %w", seekErr)
+				}
+				t.reader.Reset(t.file)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		t.offset += int64(len(line))
+		t.record(line)
+	}
+}
+
+// reopenIfRotated opens the log when it is not open, was replaced or was truncated
+func (t *Tailer) reopenIfRotated(skipExisting bool) error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		t.close()
+		return err
+	}
+
+	if t.file != nil {
+		current, statErr := t.file.Stat()
+		if statErr == nil && os.SameFile(info, current) && info.Size() >= t.offset {
+			return nil
+		}
+		t.log.Logf("INFO [Metrics] access log rotated path=%s, reopening", t.path)
+		t.close()
+		skipExisting = false
+	}
+
+	// #nosec G304 -- path comes from operator configuration
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.file = file
+	t.offset = 0
+	if skipExisting {
+		if t.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			t.close()
+			return fmt.Errorf("seek failed: %w", err)
+		}
+	}
+	t.reader = bufio.NewReader(file)
+	return nil
+}
+
+// record turns one log line into metrics, malformed lines are ignored
+func (t *Tailer) record(line []byte) {
+	var entry accessLogEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Host == "" || entry.Status == 0 {
+		return
+	}
+
+	t.registry.Add(requestsTotal, "HTTP requests by host and status class, from the access log",
+		Labels{"host": entry.Host, "status_class": fmt.Sprintf("%dxx", entry.Status/100)}, 1)
+	t.registry.Observe(requestDuration, "HTTP request duration by host, from the access log",
+		Labels{"host": entry.Host}, entry.RequestTime)
+	t.registry.Add(receivedBytes, "Bytes received from clients by host, request line, headers and body, from the access log",
+		Labels{"host": entry.Host}, float64(entry.RequestLength))
+	t.registry.Add(sentBytes, "Bytes sent to clients by host, headers and body, from the access log",
+		Labels{"host": entry.Host}, float64(entry.BytesSent))
+	if upstream, ok := upstreamTime(entry.UpstreamResponseTime); ok {
+		t.registry.Observe(upstreamDuration, "Time waiting for the backends by host, from the access log",
+			Labels{"host": entry.Host}, upstream)
+	}
+}
+
+// upstreamTime sums the times of an $upstream_*_time value, false for requests nginx answered
+// itself; servers tried in turn are separated by commas, internal redirects by colons
+func upstreamTime(s string) (float64, bool) {
+	var total float64
+	found := false
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+		if v, err := strconv.ParseFloat(part, 64); err == nil {
+			total += v
+			found = true
+		}
+	}
+	return total, found
+}
+
+func (t *Tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close() //nolint:errcheck // read-only file
+		t.file = nil
+	}
+}
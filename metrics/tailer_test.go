@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	appendLog := func(text string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(r *Registry, series string) bool {
+		var b strings.Builder
+		if _, err := r.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(b.String(), series)
+	}
+
+	appendLog(`{"host":"old.example.com","status":200,"request_time":0.1}` + "\n")
+
+	registry := NewRegistry()
+	tailer := NewTailer(path, registry, lgr.New())
+	defer tailer.close()
+	if err := tailer.poll(true); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+
+	appendLog(`{"host":"api.example.com","status":200,"request_time":0.012,"request_length":120,"bytes_sent":2048,"upstream_response_time":"0.010"}` + "\n" +
+		"not json\n" +
+		`{"host":"api.example.com","status":502,"request_time":1.5,"request_length":80,"bytes_sent":300,"upstream_response_time":"1.000, 0.250"}` + "\n" +
+		`{"host":"api.example.com","status":404,`)
+	if err := tailer.poll(false); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	for _, want := range []string{
+		`proxy_http_requests_total{host="api.example.com",status_class="2xx"} 1`,
+		`proxy_http_requests_total{host="api.example.com",status_class="5xx"} 1`,
+		`proxy_http_request_duration_seconds_count{host="api.example.com"} 2`,
+		`proxy_http_received_bytes_total{host="api.example.com"} 200`,
+		`proxy_http_sent_bytes_total{host="api.example.com"} 2348`,
+		`proxy_http_upstream_duration_seconds_sum{host="api.example.com"} 1.26`,
+	} {
+		if !count(registry, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if count(registry, "old.example.com") || count(registry, "4xx") {
+		t.Error("existing and partial lines should not be counted")
+	}
+
+	// the partial line is completed later
+	appendLog(`"request_time":0.001}` + "\n")
+	if err := tailer.poll(false); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if !count(registry, `status_class="4xx"} 1`) {
+		t.Error("completed line should be counted")
+	}
+
+	// rotation: the log is moved away and a new one is created
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(`{"host":"api.example.com","status":201,"request_time":0.002}` + "\n")
+	if err := tailer.poll(false); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if !count(registry, `status_class="2xx"} 2`) {
+		t.Error("rotated log should be read from the start")
+	}
+}
+
+func TestUpstreamTime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+		ok    bool
+	}{
+		{input: "0.012", want: 0.012, ok: true},
+		{input: "0.500, 0.250", want: 0.75, ok: true},
+		{input: "0.100 : 0.200", want: 0.3, ok: true},
+		{input: "-, 0.004", want: 0.004, ok: true},
+		{input: "-"},
+		{input: ""},
+	}
+	for _, tt := range tests {
+		got, ok := upstreamTime(tt.input)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("upstreamTime(%q) = %v, %t, want %v, %t", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
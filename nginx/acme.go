@@ -0,0 +1,50 @@
+package nginx
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// CertStore provides certificates issued per hostname, e.g. by the built-in ACME issuer
+type CertStore interface {
+	CertFiles(hostname string) (cert, key string, ok bool)
+}
+
+// ACMEHostnames returns the sorted hostnames certificates are issued for: HTTPS hosts and
+// their aliases without TLS secrets and not opted out with proxy.http.acme=false
+// Wildcards are left out, HTTP-01 challenges cannot validate them
+func ACMEHostnames(containers []docker.ContainerInfo) []string {
+	seen := make(map[string]bool)
+	for _, container := range containers {
+		for _, mapping := range container.AllHTTPMappings() {
+			if !mapping.HTTPS || mapping.TLSCertSecret != "" || !mapping.ACMEEnabled() {
+				continue
+			}
+			for _, hostname := range append(append([]string(nil), mapping.Hostnames...), mapping.Aliases...) {
+				if !strings.HasPrefix(hostname, "*.") {
+					seen[hostname] = true
+				}
+			}
+		}
+	}
+
+	hostnames := make([]string, 0, len(seen))
+	for hostname := range seen {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// issuedCert returns the certificate issued for an HTTPS hostname without TLS secrets
+func (g *Generator) issuedCert(mapping *docker.HTTPMapping, hostname string, secrets secretFiles) (cert, key string) {
+	if secrets.cert != "" || !mapping.HTTPS || !mapping.ACMEEnabled() || g.opts.Certificates == nil {
+		return secrets.cert, secrets.key
+	}
+	if cert, key, ok := g.opts.Certificates.CertFiles(hostname); ok {
+		return cert, key
+	}
+	return "", ""
+}
@@ -0,0 +1,144 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// headerPrefix starts the generation header line, its timestamp differs on every render
+const headerPrefix = "# Auto-generated by proxy-nginx at "
+
+// maxDriftLines caps the differing lines logged per config
+const maxDriftLines = 20
+
+// Drift describes how a config rendered in read-only mode differs from the file on disk
+type Drift struct {
+	Config  string // stream or http
+	Path    string
+	Added   int // rendered lines missing from the file
+	Removed int // file lines missing from the rendered config
+}
+
+// Changed reports whether the file on disk differs from the rendered config
+func (d Drift) Changed() bool {
+	return d.Added > 0 || d.Removed > 0
+}
+
+// SetReadOnly switches audit mode on or off
+// In audit mode configs are rendered in memory and compared with the files on disk, nothing is written
+func (g *Generator) SetReadOnly(readOnly bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.readOnly = readOnly
+	g.rendered = make(map[string][]byte)
+	g.drift = make(map[string]Drift)
+}
+
+// Rendered returns the config last rendered for path in read-only mode
+func (g *Generator) Rendered(path string) ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	content, ok := g.rendered[path]
+	return content, ok
+}
+
+// Drift returns the differences found by the last read-only generation, stream config first
+func (g *Generator) Drift() []Drift {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	result := make([]Drift, 0, 2)
+	for _, path := range []string{g.streamConfigPath, g.httpConfigPath} {
+		if d, ok := g.drift[path]; ok {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// audit compares a rendered config with the file on disk instead of writing it
+// Returns true if they differ, ignoring the timestamp of the generation header
+func (g *Generator) audit(path string, content []byte) (bool, error) {
+	// #nosec G304 -- path is from trusted configuration, not user input
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read existing config: %w", err)
+	}
+
+	added, removed := lineDrift(existing, content)
+	d := Drift{Config: "http", Path: path, Added: len(added), Removed: len(removed)}
+	if path == g.streamConfigPath {
+		d.Config = "stream"
+	}
+
+	g.mu.Lock()
+	g.rendered[path] = content
+	g.drift[path] = d
+	g.mu.Unlock()
+
+	if !d.Changed() {
+		g.log.Logf("INFO [Generator] read-only, config matches path=%s", path)
+		return false, nil
+	}
+
+	g.log.Logf("WARN [Generator] read-only, config drift path=%s added=%d removed=%d", path, d.Added, d.Removed)
+	if path == SecretsPath(g.httpConfigPath) {
+		return true, nil // secret values are never logged
+	}
+	for i, line := range added {
+		if i == maxDriftLines {
+			g.log.Logf("DEBUG [Generator] drift path=%s ... %d more added lines", path, len(added)-i)
+			break
+		}
+		g.log.Logf("DEBUG [Generator] drift path=%s + %s", path, line)
+	}
+	for i, line := range removed {
+		if i == maxDriftLines {
+			g.log.Logf("DEBUG [Generator] drift path=%s ... %d more removed lines", path, len(removed)-i)
+			break
+		}
+		g.log.Logf("DEBUG [Generator] drift path=%s - %s", path, line)
+	}
+	return true, nil
+}
+
+// lineDrift returns the lines of rendered missing from existing and the lines of existing
+// missing from rendered, counting repeated lines, in the order they appear
+// Blank lines and the generation header are ignored
+func lineDrift(existing, rendered []byte) (added, removed []string) {
+	counts := make(map[string]int)
+	for _, line := range driftLines(existing) {
+		counts[line]++
+	}
+
+	for _, line := range driftLines(rendered) {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+
+	for _, line := range driftLines(existing) {
+		if counts[line] > 0 {
+			counts[line]--
+			removed = append(removed, line)
+		}
+	}
+	return added, removed
+}
+
+// driftLines splits a config into trimmed lines compared by lineDrift
+func driftLines(content []byte) []string {
+	var lines []string
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed == "" || strings.HasPrefix(trimmed, headerPrefix) {
+			continue
+		}
+		lines = append(lines, trimmed)
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{SigningKey: []byte("0123456789abcdef")})
+
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432}}},
+	}
+
+	// configs written by a previous, writing generation
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	original, err := os.ReadFile(streamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen.SetReadOnly(true)
+
+	t.Run("matching configs report no drift", func(t *testing.T) {
+		report, err := gen.Generate(containers)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if report.Changed() {
+			t.Error("expected no drift when only the header timestamp differs")
+		}
+		for _, d := range gen.Drift() {
+			if d.Changed() {
+				t.Errorf("unexpected drift %+v", d)
+			}
+		}
+	})
+
+	t.Run("drift is reported without writing", func(t *testing.T) {
+		if err := os.Remove(httpPath); err != nil {
+			t.Fatal(err)
+		}
+		containers := append(containers, docker.ContainerInfo{
+			Name: "cache", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 6379, ContainerPort: 6379}},
+		})
+
+		report, err := gen.Generate(containers)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if !report.Changed() {
+			t.Error("expected drift")
+		}
+
+		drift := gen.Drift()
+		if len(drift) != 2 || drift[0].Config != "stream" || drift[1].Config != "http" {
+			t.Fatalf("unexpected drift %+v", drift)
+		}
+		if drift[0].Added == 0 || drift[0].Removed != 0 {
+			t.Errorf("unexpected stream drift %+v", drift[0])
+		}
+
+		content, err := os.ReadFile(streamPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != string(original) {
+			t.Error("read-only generation must not write the stream config")
+		}
+		if _, err := os.Stat(httpPath); !os.IsNotExist(err) {
+			t.Error("read-only generation must not write the HTTP config")
+		}
+
+		rendered, ok := gen.Rendered(streamPath)
+		if !ok || !strings.Contains(string(rendered), "upstream tcp_6379") {
+			t.Errorf("unexpected rendered stream config %q", rendered)
+		}
+	})
+}
+
+func TestLineDrift(t *testing.T) {
+	existing := []byte(headerPrefix + "2024-01-01T00:00:00Z\nserver {\n    listen 80;\n    listen 80;\n}\n")
+	rendered := []byte(headerPrefix + "2024-06-01T00:00:00Z\nserver {\n  listen 80;\n  listen 443;\n}\n")
+
+	added, removed := lineDrift(existing, rendered)
+	if !reflect.DeepEqual(added, []string{"listen 443;"}) {
+		t.Errorf("added = %q", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"listen 80;"}) {
+		t.Errorf("removed = %q", removed)
+	}
+}
@@ -0,0 +1,63 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBotPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	valid := filepath.Join(tmpDir, "bots.txt")
+	if err := os.WriteFile(valid, []byte("# custom crawlers\n\n^BadBot/\nEvil ?Scraper\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	quoted := filepath.Join(tmpDir, "quoted.txt")
+	if err := os.WriteFile(quoted, []byte("ok\nbad\" 0; default 1; \"x\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lookahead := filepath.Join(tmpDir, "lookahead.txt")
+	if err := os.WriteFile(lookahead, []byte("bot(?!ok)\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		presets string
+		file    string
+		want    []string
+		wantErr string
+	}{
+		{name: "none", presets: "none", want: nil},
+		{name: "preset", presets: "ai", want: BotPresets["ai"]},
+		{
+			name:    "presets and file",
+			presets: " SEO , ai",
+			file:    valid,
+			want:    append(append(append([]string{}, BotPresets["seo"]...), BotPresets["ai"]...), "^BadBot/", "Evil ?Scraper"),
+		},
+		{name: "unknown preset", presets: "scanners,crawlers", wantErr: `unknown bot preset "crawlers"`},
+		{name: "missing file", file: filepath.Join(tmpDir, "missing.txt"), wantErr: "failed to open bot patterns file"},
+		{name: "quote in pattern", file: quoted, wantErr: "quoted.txt:2:"},
+		{name: "unsupported syntax", file: lookahead, wantErr: "invalid pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BotPatterns(tt.presets, tt.file)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BotPatterns() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BotPatterns() error = %v", err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("BotPatterns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Capabilities are the optional nginx modules generated configs may use
+type Capabilities struct {
+	Version string // e.g. 1.25.3, empty if not reported
+	HTTP2   bool   // ngx_http_v2_module
+	HTTP3   bool   // ngx_http_v3_module (QUIC)
+
+	// ModSecurity is compiled in or available as a dynamic module in ModulesPath,
+	// a dynamic module still needs load_module in nginx.conf
+	ModSecurity bool
+	ModulesPath string
+
+	// UpstreamCheck is nginx_upstream_check_module or a fork with its check directive,
+	// e.g. ngx_healthcheck_module, compiled in
+	UpstreamCheck bool
+}
+
+// modSecurityModule is the dynamic module file built from ModSecurity-nginx
+const modSecurityModule = "ngx_http_modsecurity_module.so"
+
+var (
+	nginxVersionRe = regexp.MustCompile(`nginx version: \S+/(\S+)`)
+	modulesPathRe  = regexp.MustCompile(`--modules-path=(\S+)`)
+)
+
+// probed caches the capabilities per nginx command, the binary does not change while the
+// proxy runs and config reloads would otherwise run it every time
+var probed = struct {
+	mu   sync.Mutex
+	caps map[string]*Capabilities
+}{caps: make(map[string]*Capabilities)}
+
+// ProbeCapabilities runs '<nginx> -V' and reports the compiled-in modules, nginx is the
+// command running the binary, e.g. "nginx" or "docker exec edge nginx"
+// A successful probe is cached per command, the command is killed when ctx is done
+func ProbeCapabilities(ctx context.Context, nginx string, log *lgr.Logger) (*Capabilities, error) {
+	probed.mu.Lock()
+	defer probed.mu.Unlock()
+	if caps, ok := probed.caps[nginx]; ok {
+		return caps, nil
+	}
+
+	cmd, err := buildCommandContext(ctx, nginx+" -V")
+	if err != nil {
+		return nil, err
+	}
+	// nginx -V prints to stderr
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("capability probe interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s -V failed: %w", nginx, err)
+	}
+
+	caps := parseCapabilities(string(output))
+	if !caps.ModSecurity && caps.ModulesPath != "" {
+		if _, err := os.Stat(filepath.Join(caps.ModulesPath, modSecurityModule)); err == nil {
+			caps.ModSecurity = true
+		}
+	}
+	log.Logf("DEBUG [Nginx] capabilities version=%s http2=%t http3=%t modsecurity=%t upstream_check=%t",
+		caps.Version, caps.HTTP2, caps.HTTP3, caps.ModSecurity, caps.UpstreamCheck)
+	probed.caps[nginx] = &caps
+	return &caps, nil
+}
+
+// parseCapabilities extracts the version and modules from 'nginx -V' output
+func parseCapabilities(output string) Capabilities {
+	var caps Capabilities
+	if m := nginxVersionRe.FindStringSubmatch(output); m != nil {
+		caps.Version = m[1]
+	}
+	caps.HTTP2 = strings.Contains(output, "--with-http_v2_module")
+	caps.HTTP3 = strings.Contains(output, "--with-http_v3_module")
+	if m := modulesPathRe.FindStringSubmatch(output); m != nil {
+		caps.ModulesPath = m[1]
+	}
+	// statically built with --add-module=.../ModSecurity-nginx
+	caps.ModSecurity = strings.Contains(strings.ToLower(output), "modsecurity-nginx")
+	// --add-module=.../nginx_upstream_check_module, tengine's ngx_http_upstream_check_module
+	caps.UpstreamCheck = strings.Contains(output, "upstream_check_module") || strings.Contains(output, "ngx_healthcheck_module")
+	return caps
+}
@@ -0,0 +1,94 @@
+package nginx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Capabilities
+	}{
+		{
+			name: "alpine build with http2 and http3",
+			output: `nginx version: nginx/1.25.3
+built by gcc 12.2.1 20220924 (Alpine 12.2.1_git20220924-r10)
+built with OpenSSL 3.1.4 24 Oct 2023
+TLS SNI support enabled
+configure arguments: --prefix=/etc/nginx --modules-path=/usr/lib/nginx/modules --with-http_ssl_module --with-http_v2_module --with-http_v3_module --with-stream`,
+			want: Capabilities{Version: "1.25.3", HTTP2: true, HTTP3: true, ModulesPath: "/usr/lib/nginx/modules"},
+		},
+		{
+			name: "static ModSecurity module",
+			output: `nginx version: nginx/1.24.0
+configure arguments: --prefix=/etc/nginx --with-http_ssl_module --add-module=/build/ModSecurity-nginx`,
+			want: Capabilities{Version: "1.24.0", ModSecurity: true},
+		},
+		{
+			name: "upstream check module",
+			output: `nginx version: nginx/1.24.0
+configure arguments: --prefix=/etc/nginx --with-http_ssl_module --add-module=../nginx_upstream_check_module-master`,
+			want: Capabilities{Version: "1.24.0", UpstreamCheck: true},
+		},
+		{
+			name: "minimal build",
+			output: `nginx version: nginx/1.18.0
+configure arguments: --prefix=/usr/share/nginx --with-http_ssl_module --with-stream`,
+			want: Capabilities{Version: "1.18.0"},
+		},
+		{
+			name:   "unexpected output",
+			output: "command not found",
+			want:   Capabilities{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCapabilities(tt.output); got != tt.want {
+				t.Errorf("parseCapabilities() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	// the probe appends -V, which sh -c takes as $0
+	nginx := fmt.Sprintf(`sh -c 'echo probe >> %s; echo "nginx version: nginx/1.25.3 --with-http_v2_module" >&2'`, calls)
+
+	for range 2 {
+		caps, err := ProbeCapabilities(context.Background(), nginx, lgr.New())
+		if err != nil {
+			t.Fatalf("ProbeCapabilities() error = %v", err)
+		}
+		if caps.Version != "1.25.3" || !caps.HTTP2 {
+			t.Errorf("ProbeCapabilities() = %+v", caps)
+		}
+	}
+	content, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(content), "probe"); n != 1 {
+		t.Errorf("nginx ran %d times, want 1 cached probe", n)
+	}
+
+	t.Run("hung nginx is killed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if _, err := ProbeCapabilities(ctx, "sh -c 'sleep 30'", lgr.New()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ProbeCapabilities() error = %v, want the deadline", err)
+		}
+	})
+}
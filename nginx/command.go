@@ -0,0 +1,115 @@
+package nginx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// commandWaitDelay bounds the wait for output pipes once a cancelled command was killed,
+// children inheriting them could otherwise keep the caller waiting
+const commandWaitDelay = 5 * time.Second
+
+// shellOperators are the unquoted characters a shell would interpret as operators,
+// redirects or expansions, shellExpansions the ones it also expands in double quotes
+const (
+	shellOperators  = "|&;<>`$"
+	shellExpansions = "`$"
+)
+
+// SplitCommand splits a command line into arguments using shell-like quoting rules
+// Supports single quotes, double quotes and backslash escapes outside single quotes,
+// but no expansion, pipes or redirects - use an explicit "sh -c '...'" for those
+// Unescaped shell operators and expansions are rejected instead of being passed on literally
+// On Windows a backslash only escapes a quote, so paths like C:\nginx\nginx.exe stay as they are
+func SplitCommand(cmdline string) ([]string, error) {
+	return splitCommand(cmdline, runtime.GOOS == "windows")
+}
+
+// splitCommand splits a command line like SplitCommand, with the backslash rules of Windows
+// when windows is set
+func splitCommand(cmdline string, windows bool) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	runes := []rune(cmdline)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'' && (!windows || i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\'')):
+			escaped = true
+			inArg = true
+		case quote == 0 && strings.ContainsRune(shellOperators, r),
+			quote == '"' && strings.ContainsRune(shellExpansions, r):
+			return nil, fmt.Errorf("command %q uses shell syntax %q, which runs without a shell, wrap it in \"sh -c '...'\"", cmdline, r)
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command %q", cmdline)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in command %q", cmdline)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	return args, nil
+}
+
+// buildCommand creates an exec.Cmd from a command line without going through a shell
+// This works the same on Linux and Windows hosts
+func buildCommand(cmdline string) (*exec.Cmd, error) {
+	args, err := SplitCommand(cmdline)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G204 -- command line is from trusted configuration, not user input
+	//nolint:noctx // lifetime is managed by callers
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// buildCommandContext creates a command like buildCommand that is killed when ctx is done
+func buildCommandContext(ctx context.Context, cmdline string) (*exec.Cmd, error) {
+	args, err := SplitCommand(cmdline)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G204 -- command line is from trusted configuration, not user input
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.WaitDelay = commandWaitDelay
+	return cmd, nil
+}
@@ -0,0 +1,96 @@
+package nginx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "simple", input: "nginx -s reload", want: []string{"nginx", "-s", "reload"}},
+		{name: "single quotes", input: "nginx -g 'daemon off;'", want: []string{"nginx", "-g", "daemon off;"}},
+		{name: "double quotes", input: `docker exec "my nginx" nginx -s reload`, want: []string{"docker", "exec", "my nginx", "nginx", "-s", "reload"}},
+		{name: "shell wrapper", input: "sh -c 'nginx -t && nginx -s reload'", want: []string{"sh", "-c", "nginx -t && nginx -s reload"}},
+		{name: "escaped space", input: `C:\\nginx\\nginx.exe -p C:\\my\ nginx`, want: []string{`C:\nginx\nginx.exe`, "-p", `C:\my nginx`}},
+		{name: "extra whitespace", input: "  nginx   -t  ", want: []string{"nginx", "-t"}},
+		{name: "empty quoted argument", input: "cmd ''", want: []string{"cmd", ""}},
+		{name: "empty", input: "   ", wantErr: true},
+		{name: "unterminated quote", input: "nginx -g 'daemon off;", wantErr: true},
+		{name: "escaped operator", input: `nginx -g daemon\ off\;`, want: []string{"nginx", "-g", "daemon off;"}},
+		{name: "and list", input: "nginx -t && nginx -s reload", wantErr: true},
+		{name: "pipe", input: "nginx -T | grep server", wantErr: true},
+		{name: "variable", input: "nginx -c $NGINX_CONF", wantErr: true},
+		{name: "variable in double quotes", input: `nginx -c "$NGINX_CONF"`, wantErr: true},
+		{name: "redirect", input: "nginx -t 2>/dev/null", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.input, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommandWindows(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: `C:\nginx\nginx.exe -s reload`, want: []string{`C:\nginx\nginx.exe`, "-s", "reload"}},
+		{input: `"C:\Program Files\nginx\nginx.exe" -p C:\nginx\`, want: []string{`C:\Program Files\nginx\nginx.exe`, "-p", `C:\nginx\`}},
+		{input: `nginx -g "error_log \"C:\logs\error.log\";"`, want: []string{"nginx", "-g", `error_log "C:\logs\error.log";`}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.input, true)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestCommandCancellation(t *testing.T) {
+	log := lgr.New()
+	val, err := NewCommandValidator("sleep 30", log)
+	if err != nil {
+		t.Fatalf("NewCommandValidator() error = %v", err)
+	}
+	reload, err := NewReloader("sleep 30", log)
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	for name, run := range map[string]func(context.Context) error{
+		"validate": val.Validate,
+		"reload":   reload.Reload,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := run(ctx)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("error = %v, want the deadline", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("returned after %s, the stuck command was not killed", elapsed)
+			}
+		})
+	}
+}
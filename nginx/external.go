@@ -0,0 +1,84 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// externalID marks routes from the config file in generated configs and conflict errors
+const externalID = "config"
+
+// externalHostRe matches IPv4 addresses and DNS names of external targets, IPv6 addresses
+// are checked with netip
+var externalHostRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// ExternalStream is a stream route to a target outside Docker, e.g. a physical server
+type ExternalStream struct {
+	Name      string
+	Protocol  docker.Protocol
+	ProxyPort int
+	Host      string // IP address or DNS name, resolved by nginx on reload; IPv6 without brackets
+	Port      int
+}
+
+// NewExternalStream validates an external stream route
+// protocol is tcp or udp (default: tcp), target is host:port, IPv6 addresses in brackets
+func NewExternalStream(name, protocol string, proxyPort int, target string) (ExternalStream, error) {
+	if name == "" {
+		return ExternalStream{}, fmt.Errorf("external stream %s without name", target)
+	}
+
+	stream := ExternalStream{Name: name, ProxyPort: proxyPort}
+	switch strings.ToLower(protocol) {
+	case "", "tcp":
+		stream.Protocol = docker.TCP
+	case "udp":
+		stream.Protocol = docker.UDP
+	default:
+		return ExternalStream{}, fmt.Errorf("external stream %q: invalid protocol %q, expected tcp or udp", name, protocol)
+	}
+
+	if proxyPort < 1 || proxyPort > 65535 {
+		return ExternalStream{}, fmt.Errorf("external stream %q: port %d out of range", name, proxyPort)
+	}
+
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return ExternalStream{}, fmt.Errorf("external stream %q: invalid target %q, expected host:port", name, target)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && ip.Zone() == "" {
+		host = ip.String()
+	} else if !externalHostRe.MatchString(host) {
+		return ExternalStream{}, fmt.Errorf("external stream %q: invalid target host %q", name, host)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return ExternalStream{}, fmt.Errorf("external stream %q: invalid target port %q", name, portStr)
+	}
+	stream.Host, stream.Port = host, port
+
+	return stream, nil
+}
+
+// externalContainers presents external streams as containers, so they are rendered
+// and checked for port conflicts like container routes
+func externalContainers(streams []ExternalStream) []docker.ContainerInfo {
+	containers := make([]docker.ContainerInfo, 0, len(streams))
+	for _, stream := range streams {
+		containers = append(containers, docker.ContainerInfo{
+			Name: "external:" + stream.Name,
+			ID:   externalID,
+			IP:   stream.Host,
+			Mappings: []docker.PortMapping{
+				{ProxyPort: stream.ProxyPort, ContainerPort: stream.Port, Protocol: stream.Protocol},
+			},
+		})
+	}
+	return containers
+}
@@ -0,0 +1,105 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewExternalStream(t *testing.T) {
+	stream, err := NewExternalStream("nas-ssh", "", 2222, "192.168.1.10:22")
+	if err != nil {
+		t.Fatalf("NewExternalStream() error = %v", err)
+	}
+	want := ExternalStream{Name: "nas-ssh", Protocol: docker.TCP, ProxyPort: 2222, Host: "192.168.1.10", Port: 22}
+	if stream != want {
+		t.Errorf("NewExternalStream() = %+v, want %+v", stream, want)
+	}
+
+	tests := map[string]struct {
+		name, protocol string
+		port           int
+		target         string
+	}{
+		"missing name":        {protocol: "tcp", port: 2222, target: "192.168.1.10:22"},
+		"unknown protocol":    {name: "x", protocol: "sctp", port: 2222, target: "192.168.1.10:22"},
+		"port out of range":   {name: "x", port: 70000, target: "192.168.1.10:22"},
+		"target without port": {name: "x", port: 2222, target: "192.168.1.10"},
+		"invalid host":        {name: "x", port: 2222, target: "nas;deny:22"},
+		"IPv6 with zone":      {name: "x", port: 2222, target: "[fe80::1%eth0]:22"},
+		"IPv6 without port":   {name: "x", port: 2222, target: "2001:db8::10"},
+		"invalid target port": {name: "x", port: 2222, target: "nas.lan:0"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewExternalStream(tt.name, tt.protocol, tt.port, tt.target); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestGenerateExternalStreams(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+
+	gen, err := NewGenerator(streamPath, filepath.Join(tmpDir, "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	dns, err := NewExternalStream("dns", "udp", 53, "nas.lan:5353")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssh, err := NewExternalStream("nas-ssh", "tcp", 2222, "192.168.1.10:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdp, err := NewExternalStream("desktop", "tcp", 3389, "[2001:db8::10]:3389")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.SetOptions(Options{ExternalStreams: []ExternalStream{ssh, dns, rdp}})
+
+	containers := []docker.ContainerInfo{
+		{Name: "db", ID: "abc123", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432}}},
+	}
+
+	t.Run("rendered with container routes", func(t *testing.T) {
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		content, err := os.ReadFile(streamPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := string(content)
+		for _, want := range []string{
+			"# Container: external:nas-ssh (config)",
+			"server 192.168.1.10:22;",
+			"listen 2222;",
+			"server nas.lan:5353;",
+			"server [2001:db8::10]:3389;",
+			"listen 53 udp;",
+			"server 172.17.0.2:5432;",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("stream config missing %q:\n%s", want, text)
+			}
+		}
+	})
+
+	t.Run("conflicts with container routes", func(t *testing.T) {
+		conflicting := append(containers, docker.ContainerInfo{
+			Name: "sshd", ID: "def456", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 2222, ContainerPort: 22}},
+		})
+		_, err := gen.Generate(conflicting)
+		if err == nil || !strings.Contains(err.Error(), "port 2222 claimed by both sshd and external:nas-ssh") {
+			t.Errorf("Generate() error = %v, want TCP port conflict", err)
+		}
+	})
+}
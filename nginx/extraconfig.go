@@ -0,0 +1,339 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configServer is a server block of an nginx config the proxy does not generate
+type configServer struct {
+	source    string // file:line of the server block
+	stream    bool
+	tcpPorts  []int
+	udpPorts  []int
+	hostnames []string // exact server_name values, wildcards and regexes are left out
+}
+
+// configToken is a word, a quoted string or one of { } ; of an nginx config
+type configToken struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// configBlock is an open block while parsing, server blocks collect their directives
+type configBlock struct {
+	name   string
+	server *configServer
+	listen [][]string
+}
+
+// tokenizeConfig splits nginx config syntax into tokens, dropping comments
+func tokenizeConfig(content []byte) ([]configToken, error) {
+	var tokens []configToken
+	line := 1
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '#':
+			for i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, configToken{text: string(c), line: line})
+		case c == '"' || c == '\'':
+			start := line
+			var b strings.Builder
+			for i++; i < len(content) && content[i] != c; i++ {
+				if content[i] == '\\' && i+1 < len(content) {
+					i++
+				}
+				if content[i] == '\n' {
+					line++
+				}
+				b.WriteByte(content[i])
+			}
+			if i >= len(content) {
+				return nil, fmt.Errorf("line %d: unterminated string", start)
+			}
+			tokens = append(tokens, configToken{text: b.String(), line: start, quoted: true})
+		default:
+			start := i
+			for i+1 < len(content) && !strings.ContainsRune(" \t\r\n{};#\"'", rune(content[i+1])) {
+				i++
+			}
+			tokens = append(tokens, configToken{text: string(content[start : i+1]), line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// parseConfigServers returns the server blocks of an nginx config with the ports and hostnames they claim
+// Servers inside stream { } or http { } take that context. Top-level servers, as in files included
+// from either context, are stream servers when they proxy_pass at server level or listen on UDP
+func parseConfigServers(path string, content []byte) ([]configServer, error) {
+	tokens, err := tokenizeConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var (
+		stack   []configBlock
+		servers []configServer
+		words   []configToken
+	)
+	within := func(name string) bool {
+		return slices.ContainsFunc(stack, func(b configBlock) bool { return b.name == name })
+	}
+	for _, tok := range tokens {
+		if tok.quoted || (tok.text != "{" && tok.text != "}" && tok.text != ";") {
+			words = append(words, tok)
+			continue
+		}
+
+		switch tok.text {
+		case "{":
+			if len(words) == 0 {
+				return nil, fmt.Errorf("%s:%d: block without name", path, tok.line)
+			}
+			block := configBlock{name: words[0].text}
+			if block.name == "server" && !within("upstream") && !within("mail") {
+				block.server = &configServer{source: fmt.Sprintf("%s:%d", path, words[0].line), stream: within("stream")}
+			}
+			stack = append(stack, block)
+		case "}":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%s:%d: unexpected }", path, tok.line)
+			}
+			block := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if block.server != nil {
+				servers = append(servers, finishConfigServer(*block.server, block.listen))
+			}
+		case ";":
+			if len(words) > 0 && len(stack) > 0 && stack[len(stack)-1].server != nil {
+				addServerDirective(&stack[len(stack)-1], words, within("http"))
+			}
+		}
+		words = words[:0]
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%s: unclosed %s block", path, stack[len(stack)-1].name)
+	}
+	return servers, nil
+}
+
+// addServerDirective records the directives of a server block that claim ports and hostnames
+func addServerDirective(block *configBlock, words []configToken, inHTTP bool) {
+	args := make([]string, 0, len(words)-1)
+	for _, word := range words[1:] {
+		args = append(args, word.text)
+	}
+
+	switch words[0].text {
+	case "listen":
+		block.listen = append(block.listen, args)
+	case "server_name":
+		for _, name := range args {
+			if exactHostname(name) {
+				block.server.hostnames = append(block.server.hostnames, strings.ToLower(name))
+			}
+		}
+	case "proxy_pass":
+		// only stream servers proxy at server level, HTTP servers do it in locations
+		if !inHTTP {
+			block.server.stream = true
+		}
+	}
+}
+
+// finishConfigServer resolves the listen directives of a server once its context is known
+func finishConfigServer(server configServer, listens [][]string) configServer {
+	listens = slices.DeleteFunc(listens, func(args []string) bool { return len(args) == 0 })
+	for _, args := range listens {
+		if slices.Contains(args[1:], "udp") {
+			server.stream = true
+		}
+	}
+	if server.stream {
+		server.hostnames = nil
+	}
+
+	if len(listens) == 0 && !server.stream {
+		server.tcpPorts = append(server.tcpPorts, 80) // nginx default
+	}
+	for _, args := range listens {
+		port, ok := listenPort(args[0])
+		if !ok {
+			continue
+		}
+		if slices.Contains(args[1:], "udp") || slices.Contains(args[1:], "quic") {
+			server.udpPorts = append(server.udpPorts, port)
+		} else {
+			server.tcpPorts = append(server.tcpPorts, port)
+		}
+	}
+	return server
+}
+
+// listenPort returns the port of a listen address: 80, 127.0.0.1:8080, [::]:443 or *:80
+// Unix sockets have no port; an address without one listens on 80
+func listenPort(addr string) (int, bool) {
+	if strings.HasPrefix(addr, "unix:") {
+		return 0, false
+	}
+	if port, err := strconv.Atoi(addr); err == nil {
+		return port, port > 0 && port <= 65535
+	}
+	if i := strings.LastIndex(addr, ":"); i >= 0 && !strings.HasSuffix(addr, "]") {
+		port, err := strconv.Atoi(addr[i+1:])
+		return port, err == nil && port > 0 && port <= 65535
+	}
+	return 80, true
+}
+
+// exactHostname reports whether a server_name value is a plain hostname
+// Wildcards (*.example.com, .example.com), regexes (~...) and catch-alls (_) never equal a label hostname
+func exactHostname(name string) bool {
+	return name != "" && name != "_" && !strings.ContainsAny(name, "*~$") && !strings.HasPrefix(name, ".")
+}
+
+// extraConfigServers parses the *.conf files of the extra config dir
+func (g *Generator) extraConfigServers() ([]configServer, error) {
+	if g.opts.ExtraConfigDir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(g.opts.ExtraConfigDir, "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extra configs: %w", err)
+	}
+	var servers []configServer
+	for _, path := range paths {
+		// #nosec G304 -- path is in the configured extra config dir
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extra config: %w", err)
+		}
+		parsed, err := parseConfigServers(path, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse extra config: %w", err)
+		}
+		servers = append(servers, parsed...)
+	}
+
+	g.log.Logf("DEBUG [Generator] extra configs parsed dir=%s files=%d servers=%d",
+		g.opts.ExtraConfigDir, len(paths), len(servers))
+	return servers, nil
+}
+
+// configDumpHeader starts each file of nginx -T output
+const configDumpHeader = "# configuration file "
+
+// dumpedConfigServers runs the config dump command and parses the servers of every hand-written file
+// Generated files and the extra config dir are left out, they are checked already
+// A failing command or an unparsable file is logged and skipped, nginx -t remains the authority
+func (g *Generator) dumpedConfigServers() []configServer {
+	if g.opts.ConfigDumpCmd == "" {
+		return nil
+	}
+
+	cmd, err := buildCommand(g.opts.ConfigDumpCmd)
+	if err != nil {
+		g.log.Logf("WARN [Generator] invalid config dump command, skipping nginx config checks error=%q", err)
+		return nil
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		g.log.Logf("WARN [Generator] config dump failed, skipping nginx config checks cmd=%q error=%q",
+			g.opts.ConfigDumpCmd, err)
+		return nil
+	}
+
+	var servers []configServer
+	for _, file := range splitConfigDump(output) {
+		if bytes.HasPrefix(file.content, []byte(headerPrefix)) || g.insideExtraConfigDir(file.path) {
+			continue
+		}
+		parsed, err := parseConfigServers(file.path, file.content)
+		if err != nil {
+			g.log.Logf("WARN [Generator] skipping unparsable nginx config error=%q", err)
+			continue
+		}
+		servers = append(servers, parsed...)
+	}
+
+	g.log.Logf("DEBUG [Generator] nginx config parsed cmd=%q servers=%d", g.opts.ConfigDumpCmd, len(servers))
+	return servers
+}
+
+// dumpedFile is one file of nginx -T output
+type dumpedFile struct {
+	path    string
+	content []byte
+}
+
+// splitConfigDump returns the files of nginx -T output in order
+func splitConfigDump(output []byte) []dumpedFile {
+	var files []dumpedFile
+	for line := range bytes.Lines(output) {
+		if name, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r\n"), []byte(configDumpHeader)); ok {
+			files = append(files, dumpedFile{path: strings.TrimSuffix(string(name), ":")})
+			continue
+		}
+		if len(files) > 0 {
+			last := &files[len(files)-1]
+			last.content = append(last.content, line...)
+		}
+	}
+	return files
+}
+
+// configServerClaims presents hand-written servers as routes for the conflict checks
+// Ports and hostnames shared by several of them are claimed once, nginx itself checks those
+func configServerClaims(servers []configServer) ([]StreamContainer, []HTTPServer) {
+	var containers []StreamContainer
+	var httpServers []HTTPServer
+	tcpPorts, udpPorts, hostnames := map[int]bool{}, map[int]bool{}, map[string]bool{}
+	for _, server := range servers {
+		ctr := StreamContainer{Name: server.source}
+		for _, port := range server.tcpPorts {
+			if !tcpPorts[port] {
+				tcpPorts[port] = true
+				ctr.TCPMappings = append(ctr.TCPMappings, StreamMapping{ProxyPort: port})
+			}
+		}
+		for _, port := range server.udpPorts {
+			if !udpPorts[port] {
+				udpPorts[port] = true
+				ctr.UDPMappings = append(ctr.UDPMappings, StreamMapping{ProxyPort: port})
+			}
+		}
+		if len(ctr.TCPMappings) > 0 || len(ctr.UDPMappings) > 0 {
+			containers = append(containers, ctr)
+		}
+		for _, hostname := range server.hostnames {
+			if !hostnames[hostname] {
+				hostnames[hostname] = true
+				httpServers = append(httpServers, HTTPServer{Hostname: hostname, ContainerName: server.source})
+			}
+		}
+	}
+	return containers, httpServers
+}
+
+// insideExtraConfigDir reports whether a config path is in the externally managed extra config dir
+func (g *Generator) insideExtraConfigDir(path string) bool {
+	if g.opts.ExtraConfigDir == "" {
+		return false
+	}
+	return filepath.Clean(filepath.Dir(path)) == filepath.Clean(g.opts.ExtraConfigDir)
+}
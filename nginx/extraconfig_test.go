@@ -0,0 +1,235 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestParseConfigServers(t *testing.T) {
+	content := `# legacy vhosts
+server {
+    listen 80;
+    listen [::]:443 ssl;
+    server_name Legacy.example.com *.legacy.example.com _ "quoted.example.com";
+    location / {
+        proxy_pass http://10.0.0.9:8080; # inside a location, still http
+    }
+}
+
+upstream pool {
+    server 10.0.0.1:80;
+}
+
+server {
+    listen 127.0.0.1:6379;
+    proxy_pass 10.0.0.2:6379;
+}
+
+server {
+    listen 53 udp;
+    proxy_pass 10.0.0.3:53;
+}
+
+stream {
+    server {
+        listen 2222;
+        proxy_pass 10.0.0.4:22;
+    }
+}
+
+http {
+    server {
+        server_name intranet.example.com;
+        listen 443 quic;
+    }
+    server {
+        server_name default.example.com;
+    }
+    server {
+        listen unix:/run/nginx.sock;
+        server_name socket.example.com;
+    }
+}
+`
+	servers, err := parseConfigServers("legacy.conf", []byte(content))
+	if err != nil {
+		t.Fatalf("parseConfigServers() error = %v", err)
+	}
+
+	want := []configServer{
+		{source: "legacy.conf:2", tcpPorts: []int{80, 443}, hostnames: []string{"legacy.example.com", "quoted.example.com"}},
+		{source: "legacy.conf:15", stream: true, tcpPorts: []int{6379}},
+		{source: "legacy.conf:20", stream: true, udpPorts: []int{53}},
+		{source: "legacy.conf:26", stream: true, tcpPorts: []int{2222}},
+		{source: "legacy.conf:33", udpPorts: []int{443}, hostnames: []string{"intranet.example.com"}},
+		{source: "legacy.conf:37", tcpPorts: []int{80}, hostnames: []string{"default.example.com"}},
+		{source: "legacy.conf:40", hostnames: []string{"socket.example.com"}},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Errorf("parseConfigServers() =\n%+v\nwant\n%+v", servers, want)
+	}
+}
+
+func TestParseConfigServersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unclosed block", "server {\n    listen 80;\n", "unclosed server block"},
+		{"unexpected brace", "listen 80;\n}\n", "legacy.conf:2: unexpected }"},
+		{"unterminated string", "server_name \"example.com;\n", "unterminated string"},
+		{"block without name", "{\n}\n", "block without name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigServers("legacy.conf", []byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseConfigServers() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateExtraConfigDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	extraDir := filepath.Join(tmpDir, "extra")
+	if err := os.Mkdir(extraDir, 0o750); err != nil {
+		t.Fatalf("failed to create extra dir: %v", err)
+	}
+	legacy := "server {\n    listen 80;\n    server_name legacy.example.com;\n}\n" +
+		"server {\n    listen 6379;\n    proxy_pass 10.0.0.2:6379;\n}\n"
+	if err := os.WriteFile(filepath.Join(extraDir, "legacy.conf"), []byte(legacy), 0o600); err != nil {
+		t.Fatalf("failed to write extra config: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		container docker.ContainerInfo
+		wantErr   string
+	}{
+		{
+			name: "no conflict",
+			container: docker.ContainerInfo{Name: "web", IP: "172.17.0.2",
+				HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+		},
+		{
+			name: "hostname",
+			container: docker.ContainerInfo{Name: "web", IP: "172.17.0.2",
+				HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"legacy.example.com"}, ContainerPort: 80}},
+			wantErr: "HTTP hostname conflict: legacy.example.com claimed by both " + filepath.Join(extraDir, "legacy.conf") + ":1 and web",
+		},
+		{
+			name: "stream port",
+			container: docker.ContainerInfo{Name: "redis", IP: "172.17.0.3",
+				Mappings: []docker.PortMapping{{ProxyPort: 6379, ContainerPort: 6379, Protocol: docker.TCP}}},
+			wantErr: "TCP port conflict: port 6379 claimed by both " + filepath.Join(extraDir, "legacy.conf") + ":5 and redis",
+		},
+		{
+			name: "http listen port",
+			container: docker.ContainerInfo{Name: "raw", IP: "172.17.0.4",
+				Mappings: []docker.PortMapping{{ProxyPort: 80, ContainerPort: 8080, Protocol: docker.TCP}}},
+			wantErr: "TCP port conflict: port 80",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf"), lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(Options{ExtraConfigDir: extraDir})
+
+			_, err = gen.Generate([]docker.ContainerInfo{tt.container})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// generated configs never go to the extra dir
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(extraDir, "legacy.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{ExtraConfigDir: extraDir})
+	if _, err := gen.Generate(nil); err == nil || !strings.Contains(err.Error(), "refusing to write") {
+		t.Errorf("Generate() into the extra dir error = %v, want refusal", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(extraDir, "legacy.conf")); string(content) != legacy {
+		t.Errorf("extra config overwritten:\n%s", content)
+	}
+}
+
+func TestGenerateConfigDump(t *testing.T) {
+	tmpDir := t.TempDir()
+	dump := `# configuration file /etc/nginx/nginx.conf:
+events {}
+http {
+    server {
+        listen 80 default_server;
+        server_name intranet.example.com;
+    }
+    include /etc/nginx/conf.d/*.conf;
+}
+
+# configuration file /etc/nginx/conf.d/http-proxy.conf:
+# Auto-generated by proxy-nginx at 2025-01-01T00:00:00Z
+server {
+    server_name generated.example.com;
+}
+
+# configuration file /etc/nginx/conf.d/broken.conf:
+server {
+`
+	dumpPath := filepath.Join(tmpDir, "dump.txt")
+	if err := os.WriteFile(dumpPath, []byte(dump), 0o600); err != nil {
+		t.Fatalf("failed to write dump: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cmd      string
+		hostname string
+		wantErr  string
+	}{
+		{name: "hand-written server", cmd: "cat " + dumpPath, hostname: "intranet.example.com",
+			wantErr: "HTTP hostname conflict: intranet.example.com claimed by both /etc/nginx/nginx.conf:3 and web"},
+		{name: "generated config left out", cmd: "cat " + dumpPath, hostname: "generated.example.com"},
+		{name: "failing command skips the check", cmd: "cat " + filepath.Join(tmpDir, "missing.txt"),
+			hostname: "intranet.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf"), lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(Options{ConfigDumpCmd: tt.cmd})
+
+			_, err = gen.Generate([]docker.ContainerInfo{{Name: "web", IP: "172.17.0.2",
+				HTTPMapping: &docker.HTTPMapping{Hostnames: []string{tt.hostname}, ContainerPort: 80}}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
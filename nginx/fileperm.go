@@ -0,0 +1,126 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// FileOwner is the owner set on written files, -1 keeps the user or group
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// ParseFileOwner parses a chown-style owner: user, user:group or :group, by name or numeric ID
+// An empty spec returns nil, files keep the owner of the proxy process
+func ParseFileOwner(spec string) (*FileOwner, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	userName, groupName, _ := strings.Cut(spec, ":")
+	owner := &FileOwner{UID: -1, GID: -1}
+	if userName != "" {
+		uid, err := lookupID(userName, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner %q: %w", spec, err)
+		}
+		owner.UID = uid
+	}
+	if groupName != "" {
+		gid, err := lookupID(groupName, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner %q: %w", spec, err)
+		}
+		owner.GID = gid
+	}
+	if owner.UID == -1 && owner.GID == -1 {
+		return nil, fmt.Errorf("invalid owner %q, expected user, user:group or :group", spec)
+	}
+	return owner, nil
+}
+
+// lookupID returns a numeric ID as is and looks names up
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		if id < 0 {
+			return 0, fmt.Errorf("negative ID %d", id)
+		}
+		return id, nil
+	}
+	idStr, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idStr)
+}
+
+// ParseFileMode parses an octal permission mode like 0600 or 640, empty returns 0 for the default
+func ParseFileMode(s string) (os.FileMode, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permissions like 0644", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// filePerm is the mode and owner a file is written with
+type filePerm struct {
+	mode    os.FileMode
+	owner   *FileOwner // nil keeps the owner of the proxy process
+	enforce bool       // also fix the mode and owner of unchanged files
+}
+
+// apply sets the mode, ignoring the umask, and the owner of path
+func (p filePerm) apply(path string) error {
+	if err := os.Chmod(path, p.mode); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", path, err)
+	}
+	if p.owner != nil {
+		if err := os.Chown(path, p.owner.UID, p.owner.GID); err != nil {
+			return fmt.Errorf("failed to set owner of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// DefaultConfigFileMode lets the nginx workers read the generated configs
+const DefaultConfigFileMode os.FileMode = 0o644
+
+// filePerm returns the permission path is written with, the secrets include is private
+// Configured modes and owners are also enforced on unchanged files
+func (g *Generator) filePerm(path string) filePerm {
+	if path == SecretsPath(g.httpConfigPath) || path == SignaturePath(SecretsPath(g.httpConfigPath)) {
+		perm := filePerm{mode: g.opts.SecretsFileMode, owner: g.opts.SecretsOwner, enforce: true}
+		if perm.mode == 0 {
+			perm.mode = DefaultSecretsFileMode
+		}
+		return perm
+	}
+
+	perm := filePerm{mode: g.opts.ConfigFileMode, owner: g.opts.ConfigOwner}
+	perm.enforce = perm.mode != 0 || perm.owner != nil
+	if perm.mode == 0 {
+		perm.mode = DefaultConfigFileMode
+	}
+	return perm
+}
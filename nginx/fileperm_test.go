@@ -0,0 +1,50 @@
+package nginx
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{input: "0600", want: 0o600},
+		{input: "640", want: 0o640},
+		{input: "", want: 0},
+		{input: "0999", wantErr: true},
+		{input: "1777", wantErr: true},
+		{input: "rw-r--r--", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFileMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFileMode(%q) = %o, %v, want %o (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFileOwner(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *FileOwner
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "101", want: &FileOwner{UID: 101, GID: -1}},
+		{input: "101:102", want: &FileOwner{UID: 101, GID: 102}},
+		{input: ":102", want: &FileOwner{UID: -1, GID: 102}},
+		{input: ":", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "no-such-user-proxy", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFileOwner(tt.input)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFileOwner(%q) = %+v, %v, want %+v (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// ForwardedPolicy controls the X-Forwarded-For, -Proto and -Host headers sent to backends
+// The zero value appends the client to X-Forwarded-For and sets X-Forwarded-Proto, as before
+type ForwardedPolicy struct {
+	// Mode is docker.ForwardedAppend, docker.ForwardedOverwrite or docker.ForwardedStrip,
+	// empty appends; proxy.http.forwarded_headers labels override it
+	Mode string
+
+	// TrustedProxies are the CIDRs of proxies in front of nginx, e.g. Cloudflare or another nginx
+	// The client address is taken from their X-Forwarded-For and, when appending, their
+	// X-Forwarded-Proto and -Host are passed on; headers of other peers are replaced
+	TrustedProxies []string
+}
+
+// NewForwardedPolicy validates the global mode and the comma-separated trusted proxy CIDRs
+func NewForwardedPolicy(mode, trustedProxies string) (ForwardedPolicy, error) {
+	mode, err := docker.ParseForwardedMode(mode)
+	if err != nil {
+		return ForwardedPolicy{}, err
+	}
+	if mode == docker.ForwardedAppend {
+		mode = ""
+	}
+	policy := ForwardedPolicy{Mode: mode}
+	for _, part := range strings.FieldsFunc(trustedProxies, func(r rune) bool { return r == ',' || r == ' ' }) {
+		cidr, err := parseTrustedProxy(part)
+		if err != nil {
+			return ForwardedPolicy{}, err
+		}
+		policy.TrustedProxies = append(policy.TrustedProxies, cidr)
+	}
+	return policy, nil
+}
+
+// parseTrustedProxy normalizes an address or CIDR, e.g. 10.0.0.1 or 173.245.48.0/20
+func parseTrustedProxy(s string) (string, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String(), nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid trusted proxy %q, expected an address or CIDR like 10.0.0.0/8", s)
+	}
+	return network.String(), nil
+}
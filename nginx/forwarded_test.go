@@ -0,0 +1,90 @@
+package nginx
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewForwardedPolicy(t *testing.T) {
+	tests := []struct {
+		mode, trusted string
+		want          ForwardedPolicy
+		wantErr       bool
+	}{
+		{mode: "append", trusted: "173.245.48.0/20, 10.0.0.1,fd00::/8",
+			want: ForwardedPolicy{TrustedProxies: []string{"173.245.48.0/20", "10.0.0.1", "fd00::/8"}}},
+		{mode: " Overwrite ", want: ForwardedPolicy{Mode: docker.ForwardedOverwrite}},
+		{trusted: "192.168.1.7/24", want: ForwardedPolicy{TrustedProxies: []string{"192.168.1.0/24"}}},
+		{},
+		{mode: "replace", wantErr: true},
+		{trusted: "10.0.0.0/33", wantErr: true},
+		{trusted: "10.0.0.0/8; include /etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewForwardedPolicy(tt.mode, tt.trusted)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewForwardedPolicy(%q, %q) = %+v, %v, want %+v (error %t)", tt.mode, tt.trusted, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateForwardedHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	mapping := func(hostname, mode string) *docker.HTTPMapping {
+		return &docker.HTTPMapping{Hostnames: []string{hostname}, ContainerPort: 80, Forwarded: mode}
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "app", IP: "172.17.0.2", HTTPMapping: mapping("app.example.com", "")},
+		{Name: "legacy", IP: "172.17.0.3", HTTPMapping: mapping("legacy.example.com", docker.ForwardedStrip)},
+		{Name: "api", IP: "172.17.0.4", Namespace: "team-a", HTTPMapping: mapping("api.example.com", "")},
+	}
+
+	// without trusted proxies the client is appended, as before
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	text := readConfig(t, httpPath)
+	if !strings.Contains(text, "proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;") ||
+		strings.Contains(text, "set_real_ip_from") || strings.Count(text, `proxy_set_header X-Forwarded-For "";`) != 1 {
+		t.Errorf("HTTP config without trusted proxies:\n%s", text)
+	}
+
+	policy, err := NewForwardedPolicy("overwrite", "173.245.48.0/20")
+	if err != nil {
+		t.Fatalf("NewForwardedPolicy() error = %v", err)
+	}
+	gen.SetOptions(Options{Forwarded: policy})
+	containers[0].HTTPMapping = mapping("app.example.com", docker.ForwardedAppend)
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	text = readConfig(t, httpPath)
+	for _, want := range []string{
+		"set_real_ip_from 173.245.48.0/20;\nreal_ip_header X-Forwarded-For;\nreal_ip_recursive on;",
+		"geo $realip_remote_addr $proxy_trusted_peer {\n    default 0;\n    173.245.48.0/20 1;\n}",
+		"proxy_set_header X-Forwarded-For $proxy_forwarded_for;\n        proxy_set_header X-Forwarded-Proto $proxy_forwarded_proto;",
+		`proxy_set_header X-Forwarded-Host "";`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+
+	// namespace servers use the maps of the main config and the global mode
+	namespace := readConfig(t, NamespacePath(httpPath, "team-a"))
+	if strings.Contains(namespace, "set_real_ip_from") || !strings.Contains(namespace, "proxy_set_header X-Forwarded-For $remote_addr;") {
+		t.Errorf("namespace HTTP config:\n%s", namespace)
+	}
+}
@@ -2,17 +2,26 @@ package nginx
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
-	"regexp"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/go-pkgz/lgr"
 	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/state"
 )
 
 // Generator generates Nginx configuration files from container info
@@ -21,45 +30,202 @@ type Generator struct {
 	httpConfigPath   string
 	streamTemplate   *template.Template
 	httpTemplate     *template.Template
+	opts             Options
 	log              *lgr.Logger
+	previous         *state.Snapshot // routes of the last generation, see SetPreviousRoutes
+	namespacePaths   []string        // namespace configs of the last generation
+
+	// read-only audit mode, see SetReadOnly
+	mu       sync.Mutex
+	readOnly bool
+	rendered map[string][]byte // last rendered config per path
+	drift    map[string]Drift  // last drift per path
+	usage    Usage             // of the last generation, see Usage
+
+	restart map[string]restartServer // HTTP servers of the last generation by hostname, see RestartPage
 }
 
 // StreamData holds data for stream config template
 type StreamData struct {
 	Timestamp  string
 	Containers []StreamContainer
+	Skipped    []SkippedContainer // containers with TCP/UDP labels that are not routed
+	Syslog     string             // syslog:server=... log destination, empty disables
+	Defaults   StreamDefaults     // stream-level settings, written in the main config only
+	SSHGateway SSHGateway         // TLS listener of the SSH gateway, written in the main config only
+	SSHRoutes  []SSHRoute         // gateway aliases sorted by alias, the gateway is left out without them
+	ZoneSize   string             // zone size of every upstream block, empty leaves them out
+	Resolver   string             // DNS servers of nginx, written in the main config only
+	Namespace  string             // proxy.namespace of a namespace config, empty for the main config
+	Includes   []string           // namespace configs included by the main config
+	Plugins    []PluginSnippet    // config added by plugins, written in the main config only
+}
+
+// SkippedContainer explains in the generated config why a container is not routed
+type SkippedContainer struct {
+	Name   string
+	ID     string
+	Reason string
 }
 
 // StreamContainer represents a container's stream proxy configuration
 type StreamContainer struct {
 	Name        string
 	ID          string
+	Namespace   string
+	Owner       string // ownership comment, e.g. project=shop service=db image=postgres:16
 	TCPMappings []StreamMapping
 	UDPMappings []StreamMapping
 }
 
 // StreamMapping represents a single port mapping for stream module
 type StreamMapping struct {
-	ProxyPort     int
-	ContainerPort int
-	ContainerIP   string
+	ProxyPort      int
+	ContainerPort  int
+	ContainerIP    string    // IPv6 addresses in brackets, ready for :port
+	MaxConnections int       // concurrent connections through the port, 0 is unlimited
+	Timeout        string    // proxy_timeout of the server, empty keeps the default
+	ConnectTimeout string    // proxy_connect_timeout of the server, empty keeps the default
+	Hash           string    // consistent hash key of the upstream, empty is round-robin
+	Replicas       []Replica // further containers pooled into this upstream by proxy.stream.hash
+}
+
+// Replica is a pooled container behind an upstream
+type Replica struct {
+	Name    string
+	Address string // ip:port
+}
+
+// streamPool is the first mapping on a port with proxy.stream.hash, later replicas join it
+type streamPool struct {
+	hash    string
+	mapping *StreamMapping
 }
 
 // HTTPData holds data for HTTP config template
 type HTTPData struct {
-	Timestamp   string
-	HTTPServers []HTTPServer
+	Timestamp         string
+	HTTPServers       []HTTPServer
+	Redirects         []HTTPRedirect     // redirect-only servers of proxy.http.aliases
+	ACMEChallengeAddr string             // ACME responder address, empty when disabled
+	ACMEOnlyHostnames []string           // HTTPS-only hostnames needing a port 80 server for challenges
+	Skipped           []SkippedContainer // containers with HTTP labels that are not routed
+	GeoIPDB           string             // GeoIP2 database, set when any server has geo rules
+	RequestID         bool               // any server uses request IDs, emits the shared map and log format
+	LogSamples        []LogSample        // access log sampling rates used by the servers
+	BotPatterns       []string           // user-agent blocklist, set when any server blocks bots
+	Syslog            string             // syslog:server=... log destination, empty disables
+	AccessLogJSON     string             // proxy_json access log path, empty disables
+	Namespace         string             // proxy.namespace of a namespace config, empty for the main config
+	Includes          []string           // namespace configs included by the main config
+	SecretsInclude    string             // secrets include of upstream credentials, empty without them
+	ZoneSize          string             // zone size of every upstream block, empty leaves them out
+	TrustedProxies    []string           // CIDRs of proxies in front of nginx, see ForwardedPolicy
+	Resolver          string             // DNS servers of nginx, written in the main config only
+	Plugins           []PluginSnippet    // config added by plugins, written in the main config only
+	RestartPage       string             // listen address of the restart page, empty without gone containers
+
+	ClientHeaderBufferSize   string // client_header_buffer_size, empty keeps the nginx default
+	LargeClientHeaderBuffers string // large_client_header_buffers, empty keeps the nginx default
+
+	SSLSessionCache   string   // ssl_session_cache, empty keeps the nginx default
+	SSLSessionTimeout string   // ssl_session_timeout, empty keeps the nginx default
+	SessionTicketKeys []string // ssl_session_ticket_key files, newest first
 }
 
 // HTTPServer represents an HTTP server block configuration
 type HTTPServer struct {
+	ContainerName  string
+	ContainerID    string
+	Owner          string // ownership comment, e.g. project=shop service=web image=shop:1.4
+	Service        string // compose or swarm service, replicas of it are pooled into Replicas
+	Namespace      string // proxy.namespace, the server is written to that namespace's config
+	UpstreamName   string
+	Hostname       string
+	ContainerIP    string // IPv6 addresses in brackets, ready for :port
+	ContainerPort  int
+	Replicas       []Replica // further replicas of the service in the upstream
+	ServerParams   string    // passive health check parameters of the upstream servers, e.g. " max_fails=3 fail_timeout=15s"
+	HealthCheck    *UpstreamCheck
+	Mirror         *Mirror // copies of the requests, nil without proxy.http.mirror
+	HTTPS          bool
+	PlainHTTP      bool   // also listen on 80 next to 443
+	AuthFile       string // htpasswd file, empty disables basic auth
+	OIDCAuthURL    string // auth_request service of proxy.http.oidc.*, empty disables single sign-on
+	OIDCVouch      bool   // Vouch Proxy endpoints instead of oauth2-proxy ones
+	OIDCLoginURL   string // public Vouch URL for login and sign-out
+	TLSCertFile    string // certificate, empty uses the certificate configured globally
+	TLSKeyFile     string
+	SecretsVersion string // hash of the secret contents, empty without secrets
+	UpstreamAuth   string // Authorization header to the backend, only rendered into the secrets include
+	PassVars       []docker.PassVar
+
+	BackendHTTPS     bool   // proxy_pass https:// with proxy_ssl_* directives
+	BackendSSLVerify bool   // verify the backend certificate against BackendCAFile
+	BackendSNI       string // proxy_ssl_name, empty uses $host
+	UpstreamHost     string // Host header sent to the backend, empty uses $host
+	Forwarded        string // X-Forwarded-* mode, overwrite or strip, empty appends
+	Resolver         string // DNS servers of this host, empty uses the global resolver
+
+	GRPC          bool // grpc_pass instead of proxy_pass
+	HTTP2         bool // http2 on the 443 listener
+	HTTP3         bool // QUIC listener on 443/udp with an Alt-Svc header
+	QUICReuseport bool // reuseport may only be set on one quic listener per port
+
+	StaticRoot string // serve files from this directory, no upstream is generated
+	Socket     string // unix socket of the upstream server instead of ContainerIP:ContainerPort
+
+	GeoAllow []string // only these countries are served
+	GeoDeny  []string // these countries get 403
+
+	ValidReferers string // valid_referers values, other referers get 403; empty allows all
+
+	AllowFrom  []string // client addresses and CIDRs served, others get DenyStatus; empty serves everyone
+	DenyStatus int
+
+	AllowedMethods string // methods as regex alternation, e.g. GET|HEAD, others get 405; empty allows all
+	MaxBodySize    string // client_max_body_size of this server, empty uses the global setting
+
+	RequestID           bool   // X-Request-ID to the backend, in the response and in the access log
+	LogSample           string // $proxy_log_<name> condition of sampled access logs, empty logs everything
+	NextUpstream        string // proxy_next_upstream conditions, empty keeps the default
+	NextUpstreamTries   int    // attempts including the first one, 0 keeps the default
+	NextUpstreamTimeout string
+	ReadTimeout         string // proxy_read_timeout and proxy_send_timeout, empty keeps 60s
+	Preset              string // proxy.http.preset with its version, e.g. grafana v1
+	Audience            string // internal or external for proxy.http.host.internal and .external
+
+	LimitConn int    // concurrent connections per client IP, 0 is unlimited
+	LimitRate string // bandwidth per connection, empty is unlimited
+
+	HeaderBuffers string // large_client_header_buffers of this server, empty uses the global setting
+
+	BufferingOff    bool   // proxy_buffering off
+	ProxyBuffers    string // proxy_buffers, empty keeps the default
+	ProxyBufferSize string // proxy_buffer_size, empty keeps the default
+
+	WAFRules  string // ModSecurity rules file, empty leaves the WAF off
+	BlockBots bool   // 403 for user agents on the blocklist
+
+	ACME bool // route ACME challenges for this hostname, false with proxy.http.acme=false
+
+	Restarting string // the container is gone, the restart page is served until this RFC 3339 time
+}
+
+// HTTPRedirect is a redirect-only server block sending an alias to its primary hostname
+type HTTPRedirect struct {
 	ContainerName string
 	ContainerID   string
-	UpstreamName  string
-	Hostname      string
-	ContainerIP   string
-	ContainerPort int
-	HTTPS         bool
+	Owner         string
+	Namespace     string
+	Hostname      string // alias, e.g. www.example.com
+	Target        string // primary hostname, e.g. example.com
+	HTTPS         bool   // listen on 443 with the certificate of the primary host
+	PlainHTTP     bool   // also listen on 80, redirecting to the scheme of the request
+	HTTP2         bool
+	TLSCertFile   string
+	TLSKeyFile    string
+	ACME          bool
 }
 
 // NewGenerator creates a new Nginx config generator
@@ -80,67 +246,369 @@ func NewGenerator(streamConfigPath, httpConfigPath string, log *lgr.Logger) (*Ge
 		streamTemplate:   streamTmpl,
 		httpTemplate:     httpTmpl,
 		log:              log,
+		previous:         &state.Snapshot{},
 	}, nil
 }
 
-// Generate generates both stream and HTTP configs from container info
-// Returns true if any config changed, false if unchanged
-func (g *Generator) Generate(containers []docker.ContainerInfo) (bool, error) {
-	g.log.Logf("DEBUG [Generator] processing containers=%d", len(containers))
+// LoadTemplates replaces the built-in templates with files from disk
+// An empty path keeps the built-in template for that module
+func (g *Generator) LoadTemplates(streamTemplatePath, httpTemplatePath string) error {
+	streamTmpl, err := parseTemplate("stream", StreamTemplate, streamTemplatePath)
+	if err != nil {
+		return err
+	}
+
+	httpTmpl, err := parseTemplate("http", HTTPTemplate, httpTemplatePath)
+	if err != nil {
+		return err
+	}
+
+	g.streamTemplate = streamTmpl
+	g.httpTemplate = httpTmpl
+
+	g.log.Logf("DEBUG [Generator] templates loaded stream=%q http=%q", streamTemplatePath, httpTemplatePath)
+	return nil
+}
+
+// parseTemplate parses a template file, falling back to the built-in text when path is empty
+func parseTemplate(name, builtin, path string) (*template.Template, error) {
+	text := builtin
+	if path != "" {
+		// #nosec G304 -- path is from trusted configuration, not user input
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s template: %w", name, err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// ConfigPaths returns the stream and HTTP config output paths
+func (g *Generator) ConfigPaths() (streamPath, httpPath string) {
+	return g.streamConfigPath, g.httpConfigPath
+}
+
+// SetOptions replaces the global generation options
+func (g *Generator) SetOptions(opts Options) {
+	g.opts = opts
+}
+
+// Generate renders both stream and HTTP configs from container info and writes the changed ones
+// Skipped containers are listed in a comment block of the config they would have been routed in
+// The report tells which configs changed, see Report.Changed
+func (g *Generator) Generate(containers []docker.ContainerInfo, skipped ...docker.SkippedContainer) (Report, error) {
+	return g.GenerateContext(context.Background(), containers, skipped...)
+}
+
+// GenerateContext is Generate with a context bounding the plugins, e.g. cancelled on shutdown
+func (g *Generator) GenerateContext(ctx context.Context, containers []docker.ContainerInfo,
+	skipped ...docker.SkippedContainer) (Report, error) {
+	containers, err := g.transform(containers)
+	if err != nil {
+		return Report{}, err
+	}
+	containers, denied := g.admit(containers)
+	containers = g.withoutSSH(containers)
+	configs, err := g.render(ctx, containers, skipped...)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// namespace configs first, the main configs include them
+	namespaces := make([]NamespaceReport, 0, len(configs.namespaces))
+	keep := make([]string, 0, 2*len(configs.namespaces))
+	for _, ns := range configs.namespaces {
+		keep = append(keep, ns.streamPath, ns.httpPath)
+		nsReport, err := g.writeNamespace(ns)
+		if err != nil {
+			return Report{}, err
+		}
+		namespaces = append(namespaces, nsReport)
+	}
+	g.namespacePaths = keep
+	if err := g.writeSecrets(configs.secrets); err != nil {
+		return Report{}, err
+	}
+
+	streamChanged, err := g.writeIfChanged(g.streamConfigPath, configs.stream)
+	if err != nil {
+		return Report{}, fmt.Errorf("stream config generation failed: %w", err)
+	}
+
+	httpChanged, err := g.writeIfChanged(g.httpConfigPath, configs.http)
+	if err != nil {
+		return Report{}, fmt.Errorf("HTTP config generation failed: %w", err)
+	}
+
+	if !g.readOnly {
+		if err := g.removeStaleNamespaces(keep); err != nil {
+			return Report{}, fmt.Errorf("failed to remove stale namespace configs: %w", err)
+		}
+	}
+
+	current := state.FromContainers(containers)
+	report := Report{
+		Routes:     current,
+		Changes:    state.Diff(g.previous, current),
+		Skipped:    skipped,
+		Denied:     denied,
+		Stream:     ConfigReport{Path: g.streamConfigPath, Checksum: checksum(configs.stream), Changed: streamChanged},
+		HTTP:       ConfigReport{Path: g.httpConfigPath, Checksum: checksum(configs.http), Changed: httpChanged},
+		Namespaces: namespaces,
+
+		ACMEHostnames: ACMEHostnames(containers),
+	}
+	g.previous = current
+	g.restart = configs.restart
+
+	g.log.Logf("INFO [Generator] generation complete stream_changed=%t http_changed=%t added=%d removed=%d changed=%d relabeled=%d skipped=%d namespaces=%d",
+		streamChanged, httpChanged, len(report.Changes.Added), len(report.Changes.Removed),
+		len(report.Changes.Changed), len(report.Changes.Relabeled), len(skipped), len(namespaces))
+
+	return report, nil
+}
+
+// admit drops the routes Options.Policy denies before they are rendered or checked
+func (g *Generator) admit(containers []docker.ContainerInfo) ([]docker.ContainerInfo, []docker.DeniedRoute) {
+	containers, denied := g.opts.Policy.Admit(containers)
+	for _, d := range denied {
+		g.log.Logf("WARN [Generator] route denied container=%s route=%s reason=%q", d.Container, d.Route, d.Reason)
+	}
+	return containers, denied
+}
+
+// writeNamespace writes the changed configs of a namespace, a failed namespace keeps its files
+func (g *Generator) writeNamespace(ns namespaceConfig) (NamespaceReport, error) {
+	report := NamespaceReport{
+		Name:   ns.name,
+		Stream: ConfigReport{Path: ns.streamPath},
+		HTTP:   ConfigReport{Path: ns.httpPath},
+	}
+	if ns.err != nil {
+		report.Error = ns.err.Error()
+		return report, nil
+	}
+
+	var err error
+	report.Stream.Checksum, report.HTTP.Checksum = checksum(ns.stream), checksum(ns.http)
+	if report.Stream.Changed, err = g.writeIfChanged(ns.streamPath, ns.stream); err != nil {
+		return report, fmt.Errorf("stream config generation failed namespace=%s: %w", ns.name, err)
+	}
+	if report.HTTP.Changed, err = g.writeIfChanged(ns.httpPath, ns.http); err != nil {
+		return report, fmt.Errorf("HTTP config generation failed namespace=%s: %w", ns.name, err)
+	}
+	return report, nil
+}
+
+// RenderTo renders the configs like Render and writes them to streamOut and httpOut
+// instead of the config paths, e.g. for embedders delivering configs themselves
+func (g *Generator) RenderTo(streamOut, httpOut io.Writer, containers []docker.ContainerInfo,
+	skipped ...docker.SkippedContainer) error {
+	streamConf, httpConf, err := g.Render(containers, skipped...)
+	if err != nil {
+		return err
+	}
+	if _, err := streamOut.Write(streamConf); err != nil {
+		return fmt.Errorf("failed to write stream config: %w", err)
+	}
+	if _, err := httpOut.Write(httpConf); err != nil {
+		return fmt.Errorf("failed to write HTTP config: %w", err)
+	}
+	return nil
+}
+
+// Render builds the stream and HTTP configs from container info without writing them
+// Secrets are still resolved to files, the rendered configs reference them
+// Routes with a proxy.namespace go to namespace configs, which only Generate writes
+func (g *Generator) Render(containers []docker.ContainerInfo,
+	skipped ...docker.SkippedContainer) (streamConf, httpConf []byte, err error) {
+	if containers, err = g.transform(containers); err != nil {
+		return nil, nil, err
+	}
+	containers, _ = g.admit(containers)
+	configs, err := g.render(context.Background(), g.withoutSSH(containers), skipped...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return configs.stream, configs.http, nil
+}
+
+// renderedConfigs are the main configs and the configs of each namespace
+type renderedConfigs struct {
+	stream     []byte
+	http       []byte
+	secrets    []byte // secrets include, nil when no route has upstream credentials
+	namespaces []namespaceConfig
+	restart    map[string]restartServer // HTTP servers to remember for the restart page
+}
+
+// render builds and checks the template data and executes the templates
+func (g *Generator) render(ctx context.Context, containers []docker.ContainerInfo,
+	skipped ...docker.SkippedContainer) (renderedConfigs, error) {
+	g.log.Logf("DEBUG [Generator] processing containers=%d skipped=%d external=%d",
+		len(containers), len(skipped), len(g.opts.ExternalStreams))
+
+	// external routes go through the same conflict checks as container routes
+	if len(g.opts.ExternalStreams) > 0 {
+		containers = append(append([]docker.ContainerInfo{}, containers...), externalContainers(g.opts.ExternalStreams)...)
+	}
 
 	// build template data
-	streamData, httpData := g.buildTemplateData(containers)
+	streamData, httpData := g.buildTemplateData(containers, skipped...)
+	ssh, err := sshRoutes(containers)
+	if err != nil {
+		return renderedConfigs{}, err
+	}
+	streamData.SSHRoutes = ssh
+	restart := g.restartServers(containers, httpData, time.Now())
+	if restarting := g.restartPageServers(restart); len(restarting) > 0 {
+		httpData.HTTPServers = append(httpData.HTTPServers, restarting...)
+		httpData.RestartPage = g.opts.RestartPage.Addr()
+	}
+	usage, err := g.checkRouteLimits(streamData, httpData)
+	if err != nil {
+		return renderedConfigs{}, err
+	}
+	if tickets := g.opts.TLSSessions.Tickets; tickets != nil {
+		keys, err := tickets.Files()
+		if err != nil {
+			return renderedConfigs{}, err
+		}
+		httpData.SessionTicketKeys = keys
+	}
+	secrets := renderSecrets(httpData.Timestamp, httpData.HTTPServers)
+	if secrets != nil && g.opts.RemoteDelivery {
+		return renderedConfigs{}, remoteSecretsError(httpData.HTTPServers)
+	}
+	if secrets != nil {
+		httpData.SecretsInclude = SecretsPath(g.httpConfigPath)
+	}
+	namespaces := g.splitNamespaces(&streamData, &httpData)
+	extra, err := g.extraConfigServers()
+	if err != nil {
+		return renderedConfigs{}, err
+	}
+	extra = append(extra, g.dumpedConfigServers()...)
 
 	// validate for conflicts
-	if err := g.validateConflicts(streamData, httpData); err != nil {
-		return false, err
+	if err := g.validateNamespaces(streamData, httpData, namespaces, extra); err != nil {
+		return renderedConfigs{}, err
 	}
+	if streamData.Plugins, httpData.Plugins, err = g.runPlugins(ctx, containers); err != nil {
+		return renderedConfigs{}, err
+	}
+	includeNamespaces(&streamData, &httpData, namespaces)
 
-	// generate and write stream config
-	streamChanged, err := g.generateStreamConfig(streamData)
-	if err != nil {
-		return false, fmt.Errorf("stream config generation failed: %w", err)
+	configs := renderedConfigs{namespaces: namespaces, secrets: secrets, restart: restart}
+	if configs.stream, configs.http, err = g.renderConfigs(streamData, httpData); err != nil {
+		return renderedConfigs{}, err
+	}
+	for i := range configs.namespaces {
+		ns := &configs.namespaces[i]
+		if ns.err != nil {
+			continue
+		}
+		if ns.stream, ns.http, err = g.renderConfigs(ns.streamData, ns.httpData); err != nil {
+			return renderedConfigs{}, fmt.Errorf("namespace %s: %w", ns.name, err)
+		}
+	}
+	if err := g.checkSizeLimit(usage, configs); err != nil {
+		return renderedConfigs{}, err
+	}
+	if err := g.checkPorts(configs); err != nil {
+		return renderedConfigs{}, err
 	}
+	return configs, nil
+}
 
-	// generate and write HTTP config
-	httpChanged, err := g.generateHTTPConfig(httpData)
+// renderConfigs executes the stream and HTTP templates
+func (g *Generator) renderConfigs(streamData StreamData, httpData HTTPData) (streamConf, httpConf []byte, err error) {
+	streamConf, err = renderTemplate(g.streamTemplate, streamData)
 	if err != nil {
-		return false, fmt.Errorf("HTTP config generation failed: %w", err)
+		return nil, nil, fmt.Errorf("stream config generation failed: %w", err)
 	}
+	g.log.Logf("DEBUG [Generator] stream config generated:\n%s", string(streamConf))
 
-	changed := streamChanged || httpChanged
-	g.log.Logf("INFO [Generator] generation complete stream_changed=%t http_changed=%t", streamChanged, httpChanged)
+	httpConf, err = renderTemplate(g.httpTemplate, httpData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HTTP config generation failed: %w", err)
+	}
+	g.log.Logf("DEBUG [Generator] HTTP config generated:\n%s", string(httpConf))
 
-	return changed, nil
+	return streamConf, httpConf, nil
 }
 
 // buildTemplateData transforms container info into template data structures
-func (g *Generator) buildTemplateData(containers []docker.ContainerInfo) (StreamData, HTTPData) {
+func (g *Generator) buildTemplateData(containers []docker.ContainerInfo,
+	skipped ...docker.SkippedContainer) (StreamData, HTTPData) {
 	streamData := StreamData{
 		Timestamp:  time.Now().Format(time.RFC3339),
 		Containers: make([]StreamContainer, 0, len(containers)),
+		Syslog:     g.opts.Syslog,
+		Defaults:   g.opts.StreamDefaults,
+		SSHGateway: g.opts.SSHGateway,
+		ZoneSize:   g.opts.UpstreamZone,
+		Resolver:   g.opts.Resolver,
 	}
 
 	httpData := HTTPData{
-		Timestamp:   time.Now().Format(time.RFC3339),
-		HTTPServers: make([]HTTPServer, 0),
+		Timestamp:     time.Now().Format(time.RFC3339),
+		HTTPServers:   make([]HTTPServer, 0),
+		Syslog:        g.opts.Syslog,
+		AccessLogJSON: g.opts.AccessLogJSON,
+		ZoneSize:      g.opts.UpstreamZone,
+		Resolver:      g.opts.Resolver,
+
+		TrustedProxies: g.opts.Forwarded.TrustedProxies,
+
+		ClientHeaderBufferSize:   g.opts.HeaderBuffers.Size,
+		LargeClientHeaderBuffers: g.opts.HeaderBuffers.Large,
+
+		SSLSessionCache:   g.opts.TLSSessions.Cache,
+		SSLSessionTimeout: g.opts.TLSSessions.Timeout,
 	}
 
+	quicReuseportSet := false
+	pools := make(map[string]streamPool) // "tcp:53" -> first mapping with a hash
+	hostIndex := make(map[string]int)    // hostname -> index in httpData.HTTPServers
 	for _, container := range containers {
 		// process stream mappings (TCP/UDP)
 		if len(container.Mappings) > 0 {
 			streamContainer := StreamContainer{
 				Name:        container.Name,
 				ID:          container.ID,
+				Namespace:   container.Namespace,
+				Owner:       container.Owner.String(),
 				TCPMappings: make([]StreamMapping, 0),
 				UDPMappings: make([]StreamMapping, 0),
 			}
 
 			for _, mapping := range container.Mappings {
+				// replicas with the same hash share one upstream instead of conflicting
+				if pool, ok := pools[streamPoolKey(mapping)]; ok && mapping.Hash != "" && mapping.Hash == pool.hash {
+					pool.mapping.Replicas = append(pool.mapping.Replicas, Replica{
+						Name:    container.Name,
+						Address: serverAddress(container.IP, mapping.ContainerPort),
+					})
+					g.log.Logf("INFO [Generator] container=%s pooled into %s hash=%s",
+						container.Name, streamPoolKey(mapping), mapping.Hash)
+					continue
+				}
+
 				streamMapping := StreamMapping{
-					ProxyPort:     mapping.ProxyPort,
-					ContainerPort: mapping.ContainerPort,
-					ContainerIP:   container.IP,
+					ProxyPort:      mapping.ProxyPort,
+					ContainerPort:  mapping.ContainerPort,
+					ContainerIP:    serverIP(container.IP),
+					MaxConnections: mapping.MaxConnections,
+					Timeout:        mapping.Timeout,
+					ConnectTimeout: mapping.ConnectTimeout,
+					Hash:           mapping.Hash,
 				}
 
 				if mapping.Protocol == docker.TCP {
@@ -151,28 +619,455 @@ func (g *Generator) buildTemplateData(containers []docker.ContainerInfo) (Stream
 			}
 
 			streamData.Containers = append(streamData.Containers, streamContainer)
+			registerStreamPools(pools, docker.TCP, streamContainer.TCPMappings)
+			registerStreamPools(pools, docker.UDP, streamContainer.UDPMappings)
 		}
 
-		// process HTTP mappings
-		if container.HTTPMapping != nil {
-			for _, hostname := range container.HTTPMapping.Hostnames {
+		// process HTTP mappings, the proxy.http.* one and indexed routes
+		for _, mapping := range container.AllHTTPMappings() {
+			secrets, err := g.resolveSecrets(&mapping)
+			if err != nil {
+				// never serve a protected host without its auth or certificate
+				g.log.Logf("WARN [Generator] skipping http hosts container=%s reason=%q", container.Name, err)
+				httpData.Skipped = append(httpData.Skipped, newSkipped(container.Name, container.ID, err.Error()))
+				continue
+			}
+
+			// never serve a country-restricted host without its rules
+			if (len(mapping.GeoAllow) > 0 || len(mapping.GeoDeny) > 0) && g.opts.GeoIPDB == "" {
+				reason := "geo rules set but no GeoIP database is configured"
+				g.log.Logf("WARN [Generator] skipping http hosts container=%s reason=%q", container.Name, reason)
+				httpData.Skipped = append(httpData.Skipped, newSkipped(container.Name, container.ID, reason))
+				continue
+			}
+
+			// never serve an internal host to everyone
+			if mapping.InternalOnly && len(g.opts.Internal.CIDRs) == 0 {
+				reason := "internal_only set but no internal CIDRs are configured"
+				g.log.Logf("WARN [Generator] skipping http hosts container=%s reason=%q", container.Name, reason)
+				httpData.Skipped = append(httpData.Skipped, newSkipped(container.Name, container.ID, reason))
+				continue
+			}
+
+			// never serve a host that asked for the WAF without it
+			if mapping.WAF {
+				reason := ""
+				switch {
+				case g.opts.WAFRules == "":
+					reason = "waf enabled but no WAF rules file is configured"
+				case g.opts.Capabilities != nil && !g.opts.Capabilities.ModSecurity:
+					reason = "waf enabled but nginx lacks the ModSecurity module"
+				}
+				if reason != "" {
+					g.log.Logf("WARN [Generator] skipping http hosts container=%s reason=%q", container.Name, reason)
+					httpData.Skipped = append(httpData.Skipped, newSkipped(container.Name, container.ID, reason))
+					continue
+				}
+			}
+
+			if mapping.BlockBots && len(g.opts.BotPatterns) == 0 {
+				g.log.Logf("WARN [Generator] container=%s block_bots set but the bot blocklist is empty", container.Name)
+			}
+
+			http2, http3 := g.listenerProtocols(container.Name, &mapping)
+			requestID := g.opts.RequestID
+			if mapping.RequestID != nil {
+				requestID = *mapping.RequestID
+			}
+			httpData.RequestID = httpData.RequestID || requestID
+			logSample := g.opts.AccessLogSample
+			if mapping.LogSample != "" {
+				logSample = mapping.LogSample
+			}
+
+			// replicas pooled into the primary host already have its redirects
+			if i, exists := hostIndex[mapping.Primary()]; !exists || container.Service == "" ||
+				httpData.HTTPServers[i].Service != container.Service {
+				httpData.Redirects = append(httpData.Redirects, g.newRedirects(container, &mapping, secrets, http2)...)
+			}
+
+			for _, hostname := range mapping.Hostnames {
+				// replicas of a service share the upstream of the first one
+				if i, exists := hostIndex[hostname]; exists && container.Service != "" &&
+					httpData.HTTPServers[i].Service == container.Service {
+					httpData.HTTPServers[i].Replicas = append(httpData.HTTPServers[i].Replicas, Replica{
+						Name:    container.Name,
+						Address: httpAddress(container.IP, &mapping, hostname),
+					})
+					g.log.Logf("INFO [Generator] container=%s pooled into %s service=%s", container.Name, hostname, container.Service)
+					continue
+				}
+
+				certFile, keyFile := g.issuedCert(&mapping, hostname, secrets)
 				httpServer := HTTPServer{
-					ContainerName: container.Name,
-					ContainerID:   container.ID,
-					UpstreamName:  hostnameToUpstream(hostname),
-					Hostname:      hostname,
-					ContainerIP:   container.IP,
-					ContainerPort: container.HTTPMapping.ContainerPort,
-					HTTPS:         container.HTTPMapping.HTTPS,
+					ContainerName:  container.Name,
+					ContainerID:    container.ID,
+					Owner:          container.Owner.String(),
+					Service:        container.Service,
+					Namespace:      container.Namespace,
+					UpstreamName:   hostnameToUpstream(hostname),
+					Hostname:       hostname,
+					ContainerIP:    serverIP(container.IP),
+					ContainerPort:  mapping.PortFor(hostname),
+					HTTPS:          mapping.HTTPS,
+					PlainHTTP:      mapping.PlainHTTP,
+					AuthFile:       secrets.auth,
+					TLSCertFile:    certFile,
+					TLSKeyFile:     keyFile,
+					SecretsVersion: secrets.version,
+					UpstreamAuth:   secrets.upstreamAuth,
+					PassVars:       g.passVars(container.Name, &mapping, &httpData),
+
+					BackendHTTPS:     mapping.BackendHTTPS,
+					BackendSSLVerify: mapping.BackendSSLVerify,
+					BackendSNI:       mapping.BackendSNI,
+					UpstreamHost:     upstreamHost(container.IP, &mapping, hostname),
+					Forwarded:        g.forwardedMode(&mapping),
+					Resolver:         mapping.Resolver,
+
+					GRPC:  mapping.GRPC,
+					HTTP2: http2,
+					HTTP3: http3,
+
+					StaticRoot: mapping.StaticRoot,
+					Socket:     mapping.Socket,
+
+					GeoAllow: mapping.GeoAllow,
+					GeoDeny:  mapping.GeoDeny,
+
+					ValidReferers: strings.Join(mapping.ValidReferers, " "),
+
+					AllowFrom:  mapping.AllowFrom,
+					DenyStatus: g.opts.Internal.DenyStatus,
+
+					AllowedMethods: strings.Join(mapping.AllowedMethods, "|"),
+					MaxBodySize:    mapping.MaxBodySize,
+
+					NextUpstream:        mapping.NextUpstream,
+					NextUpstreamTimeout: mapping.NextUpstreamTimeout,
+					ReadTimeout:         mapping.ReadTimeout,
+					Preset:              mapping.Preset,
+					Audience:            mapping.Audience,
+
+					LimitConn: mapping.LimitConn,
+					LimitRate: mapping.LimitRate,
+
+					HeaderBuffers: mapping.HeaderBuffers,
+
+					BufferingOff:    mapping.BufferingOff,
+					ProxyBuffers:    mapping.ProxyBuffers,
+					ProxyBufferSize: mapping.ProxyBufferSize,
+
+					RequestID: requestID,
+
+					ACME: mapping.ACMEEnabled(),
+				}
+				if mapping.OIDC != nil {
+					httpServer.OIDCAuthURL = mapping.OIDC.AuthURL
+					httpServer.OIDCVouch = mapping.OIDC.Provider == docker.OIDCVouch
+					httpServer.OIDCLoginURL = mapping.OIDC.LoginURL
+				}
+				if logSample != "" && logSample != "100%" {
+					sample := newLogSample(logSample)
+					httpServer.LogSample = "proxy_log_" + sample.Name
+					if !slices.Contains(httpData.LogSamples, sample) {
+						httpData.LogSamples = append(httpData.LogSamples, sample)
+					}
+				}
+				if mapping.InternalOnly {
+					httpServer.AllowFrom = g.opts.Internal.CIDRs
+				}
+				if mapping.Mirror != "" {
+					httpServer.Mirror = g.mirrorTarget(containers, container, &mapping)
+				}
+				if mapping.HealthCheck != nil && mapping.StaticRoot == "" {
+					httpServer.HealthCheck, httpServer.ServerParams = g.healthCheck(container.Name, &mapping, hostname, httpServer.UpstreamHost)
+				}
+				if httpServer.DenyStatus == 0 {
+					httpServer.DenyStatus = 403
+				}
+				if mapping.Retries > 0 {
+					httpServer.NextUpstreamTries = mapping.Retries + 1
+				}
+				if mapping.WAF {
+					httpServer.WAFRules = g.opts.WAFRules
+				}
+				if mapping.BlockBots && len(g.opts.BotPatterns) > 0 {
+					httpServer.BlockBots = true
+					httpData.BotPatterns = g.opts.BotPatterns
+				}
+				if len(mapping.GeoAllow) > 0 || len(mapping.GeoDeny) > 0 {
+					httpData.GeoIPDB = g.opts.GeoIPDB
+				}
+				if http3 && !quicReuseportSet {
+					httpServer.QUICReuseport = true
+					quicReuseportSet = true
+				}
+				if _, exists := hostIndex[hostname]; !exists {
+					hostIndex[hostname] = len(httpData.HTTPServers)
 				}
 				httpData.HTTPServers = append(httpData.HTTPServers, httpServer)
 			}
 		}
 	}
 
+	for _, s := range skipped {
+		if s.Stream {
+			streamData.Skipped = append(streamData.Skipped, newSkipped(s.Name, s.ID, s.Reason))
+		}
+		if s.HTTP {
+			httpData.Skipped = append(httpData.Skipped, newSkipped(s.Name, s.ID, s.Reason))
+		}
+	}
+
+	httpData.ACMEChallengeAddr = g.opts.ACMEChallengeAddr
+	httpData.ACMEOnlyHostnames = acmeOnlyHostnames(httpData)
+
 	return streamData, httpData
 }
 
+// acmeOnlyHostnames returns the hosts of data needing a port 80 server for challenges
+// HTTP-01 challenges always arrive on port 80, HTTPS-only hosts need a server there
+// https=both hosts are on port 80 already and route challenges themselves
+func acmeOnlyHostnames(data HTTPData) []string {
+	if data.ACMEChallengeAddr == "" {
+		return nil
+	}
+
+	var hostnames []string
+	for _, server := range data.HTTPServers {
+		if server.HTTPS && !server.PlainHTTP && server.ACME {
+			hostnames = append(hostnames, server.Hostname)
+		}
+	}
+	for _, redirect := range data.Redirects {
+		if redirect.HTTPS && !redirect.PlainHTTP && redirect.ACME {
+			hostnames = append(hostnames, redirect.Hostname)
+		}
+	}
+	return hostnames
+}
+
+// newRedirects returns the redirect servers of the mapping's aliases
+func (g *Generator) newRedirects(container docker.ContainerInfo, mapping *docker.HTTPMapping,
+	secrets secretFiles, http2 bool) []HTTPRedirect {
+	redirects := make([]HTTPRedirect, 0, len(mapping.Aliases))
+	for _, alias := range mapping.Aliases {
+		certFile, keyFile := g.issuedCert(mapping, alias, secrets)
+		redirects = append(redirects, HTTPRedirect{
+			ContainerName: container.Name,
+			ContainerID:   container.ID,
+			Owner:         container.Owner.String(),
+			Namespace:     container.Namespace,
+			Hostname:      alias,
+			Target:        mapping.Primary(),
+			HTTPS:         mapping.HTTPS,
+			PlainHTTP:     mapping.PlainHTTP,
+			HTTP2:         http2,
+			TLSCertFile:   certFile,
+			TLSKeyFile:    keyFile,
+			ACME:          mapping.ACMEEnabled(),
+		})
+	}
+	return redirects
+}
+
+// httpAddress returns the upstream server address of a hostname, ip:port or unix:/path
+func httpAddress(ip string, mapping *docker.HTTPMapping, hostname string) string {
+	if mapping.Socket != "" {
+		return "unix:" + mapping.Socket
+	}
+	return serverAddress(ip, mapping.PortFor(hostname))
+}
+
+// serverAddress returns ip:port of an upstream server, IPv6 addresses in brackets
+func serverAddress(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// serverIP returns the IP of an upstream server as written before :port, IPv6 addresses in brackets
+func serverIP(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+	return ip
+}
+
+// forwardedMode returns the X-Forwarded-* mode of a route, empty appends
+func (g *Generator) forwardedMode(mapping *docker.HTTPMapping) string {
+	mode := g.opts.Forwarded.Mode
+	if mapping.Forwarded != "" {
+		mode = mapping.Forwarded
+	}
+	if mode == docker.ForwardedAppend {
+		return ""
+	}
+	return mode
+}
+
+// passVars returns the proxy.http.pass_vars headers of a route and emits the maps defining the
+// proxy's own variables among them, the country code is dropped without a GeoIP database
+func (g *Generator) passVars(containerName string, mapping *docker.HTTPMapping, httpData *HTTPData) []docker.PassVar {
+	var vars []docker.PassVar
+	for _, passVar := range mapping.PassVars {
+		switch passVar.Variable {
+		case "$proxy_geoip_country_code":
+			if g.opts.GeoIPDB == "" {
+				g.log.Logf("WARN [Generator] ignoring pass_vars header container=%s header=%s reason=%q",
+					containerName, passVar.Header, "no GeoIP database is configured")
+				continue
+			}
+			httpData.GeoIPDB = g.opts.GeoIPDB
+		case "$proxy_request_id":
+			httpData.RequestID = true
+		}
+		vars = append(vars, passVar)
+	}
+	return vars
+}
+
+// upstreamHost returns the Host header of proxy.http.upstream_host for the backend, empty for $host
+func upstreamHost(ip string, mapping *docker.HTTPMapping, hostname string) string {
+	switch mapping.UpstreamHost {
+	case docker.UpstreamHostPreserve:
+		return "$http_host"
+	case docker.UpstreamHostUpstream:
+		if mapping.Socket != "" {
+			return "localhost"
+		}
+		return serverAddress(ip, mapping.PortFor(hostname))
+	default:
+		return mapping.UpstreamHost
+	}
+}
+
+// streamPoolKey identifies the listener of a stream mapping, e.g. tcp:53
+func streamPoolKey(mapping docker.PortMapping) string {
+	return streamPortKey(mapping.Protocol, mapping.ProxyPort)
+}
+
+func streamPortKey(protocol docker.Protocol, port int) string {
+	if protocol == docker.UDP {
+		return fmt.Sprintf("udp:%d", port)
+	}
+	return fmt.Sprintf("tcp:%d", port)
+}
+
+// registerStreamPools makes hashed mappings joinable by replicas on the same port
+// The pointers stay valid, the mappings slice is not appended to afterwards
+func registerStreamPools(pools map[string]streamPool, protocol docker.Protocol, mappings []StreamMapping) {
+	for i := range mappings {
+		key := streamPortKey(protocol, mappings[i].ProxyPort)
+		if _, exists := pools[key]; exists || mappings[i].Hash == "" {
+			continue
+		}
+		pools[key] = streamPool{hash: mappings[i].Hash, mapping: &mappings[i]}
+	}
+}
+
+// listenerProtocols decides whether an HTTPS mapping listens with HTTP/2 and HTTP/3,
+// from the labels, the global options and what the nginx build supports
+func (g *Generator) listenerProtocols(containerName string, mapping *docker.HTTPMapping) (http2, http3 bool) {
+	if !mapping.HTTPS {
+		return false, false
+	}
+
+	http2, http3 = g.opts.HTTP2, g.opts.HTTP3
+	if mapping.HTTP2 != nil {
+		http2 = *mapping.HTTP2
+	}
+	if mapping.HTTP3 != nil {
+		http3 = *mapping.HTTP3
+	}
+	// gRPC needs HTTP/2 from the client
+	http2 = http2 || mapping.GRPC
+
+	if caps := g.opts.Capabilities; caps != nil {
+		if http2 && !caps.HTTP2 {
+			g.log.Logf("WARN [Generator] container=%s http2 requested but nginx lacks http_v2_module, disabled", containerName)
+			http2 = false
+		}
+		if http3 && !caps.HTTP3 {
+			g.log.Logf("WARN [Generator] container=%s http3 requested but nginx lacks http_v3_module, disabled", containerName)
+			http3 = false
+		}
+	}
+	return http2, http3
+}
+
+// newSkipped builds a skipped entry whose reason is safe to embed in a config comment
+func newSkipped(name, id, reason string) SkippedContainer {
+	reason = strings.Join(strings.Fields(reason), " ")
+	return SkippedContainer{Name: name, ID: id, Reason: reason}
+}
+
+// secretFiles are the resolved secret file paths of an HTTP mapping
+type secretFiles struct {
+	auth, cert, key string
+	upstreamAuth    string // header value, nginx cannot read headers from files
+	version         string // hash of the secret contents, changes when a secret rotates
+}
+
+// resolveSecrets maps secret references to files and checks they exist,
+// so a missing secret skips the host instead of failing nginx -t for every route
+func (g *Generator) resolveSecrets(mapping *docker.HTTPMapping) (secretFiles, error) {
+	resolver := g.opts.Secrets
+	if resolver == nil {
+		resolver = DirSecrets{Dir: g.opts.SecretsDir}
+	}
+
+	var files secretFiles
+	hash := sha256.New()
+	for _, ref := range []struct {
+		name string
+		dst  *string
+	}{
+		{mapping.AuthSecret, &files.auth},
+		{mapping.TLSCertSecret, &files.cert},
+		{mapping.TLSKeySecret, &files.key},
+		{mapping.UpstreamAuthSecret, &files.upstreamAuth},
+	} {
+		if ref.name == "" {
+			continue
+		}
+		path, err := resolver.Resolve(ref.name)
+		if err != nil {
+			return secretFiles{}, fmt.Errorf("secret %s not available: %w", ref.name, err)
+		}
+		// #nosec G304 -- path comes from the secret resolver, not user input
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return secretFiles{}, fmt.Errorf("secret %s not available: %w", ref.name, err)
+		}
+		hash.Write(content)
+		*ref.dst = path
+		if ref.dst == &files.upstreamAuth {
+			if *ref.dst, err = headerValue(content); err != nil {
+				return secretFiles{}, fmt.Errorf("secret %s: %w", ref.name, err)
+			}
+		}
+	}
+
+	if files.auth != "" || files.cert != "" || files.upstreamAuth != "" {
+		// nginx only re-reads secret files on reload, the version comment makes rotation change the config
+		files.version = hex.EncodeToString(hash.Sum(nil))[:12]
+	}
+	return files, nil
+}
+
+// ErrConflict matches errors of routes claiming the same port, hostname or SSH alias
+var ErrConflict = errors.New("route conflict")
+
+// conflictError is a conflict matching ErrConflict, its message names the conflict
+type conflictError struct{ error }
+
+func (conflictError) Is(target error) bool { return target == ErrConflict }
+
+// conflictf formats a conflict error
+func conflictf(format string, args ...any) error {
+	return conflictError{fmt.Errorf(format, args...)}
+}
+
 // validateConflicts checks for port and hostname conflicts
 func (g *Generator) validateConflicts(streamData StreamData, httpData HTTPData) error {
 	// check TCP port conflicts
@@ -180,19 +1075,22 @@ func (g *Generator) validateConflicts(streamData StreamData, httpData HTTPData)
 	for _, container := range streamData.Containers {
 		for _, mapping := range container.TCPMappings {
 			if existing, exists := tcpPorts[mapping.ProxyPort]; exists {
-				return fmt.Errorf("TCP port conflict: port %d claimed by both %s and %s",
+				return conflictf("TCP port conflict: port %d claimed by both %s and %s",
 					mapping.ProxyPort, existing, container.Name)
 			}
 			tcpPorts[mapping.ProxyPort] = container.Name
 		}
 	}
+	if page := g.opts.RestartPage; page.Grace > 0 && tcpPorts[page.Port] != "" {
+		return conflictf("TCP port conflict: port %d claimed by both %s and the restart page", page.Port, tcpPorts[page.Port])
+	}
 
 	// check UDP port conflicts
 	udpPorts := make(map[int]string)
 	for _, container := range streamData.Containers {
 		for _, mapping := range container.UDPMappings {
 			if existing, exists := udpPorts[mapping.ProxyPort]; exists {
-				return fmt.Errorf("UDP port conflict: port %d claimed by both %s and %s",
+				return conflictf("UDP port conflict: port %d claimed by both %s and %s",
 					mapping.ProxyPort, existing, container.Name)
 			}
 			udpPorts[mapping.ProxyPort] = container.Name
@@ -203,11 +1101,18 @@ func (g *Generator) validateConflicts(streamData StreamData, httpData HTTPData)
 	hostnames := make(map[string]string)
 	for _, server := range httpData.HTTPServers {
 		if existing, exists := hostnames[server.Hostname]; exists {
-			return fmt.Errorf("HTTP hostname conflict: %s claimed by both %s and %s",
+			return conflictf("HTTP hostname conflict: %s claimed by both %s and %s",
 				server.Hostname, existing, server.ContainerName)
 		}
 		hostnames[server.Hostname] = server.ContainerName
 	}
+	for _, redirect := range httpData.Redirects {
+		if existing, exists := hostnames[redirect.Hostname]; exists {
+			return conflictf("HTTP hostname conflict: %s claimed by both %s and %s (alias)",
+				redirect.Hostname, existing, redirect.ContainerName)
+		}
+		hostnames[redirect.Hostname] = redirect.ContainerName
+	}
 
 	g.log.Logf("DEBUG [Generator] validation passed tcp_ports=%d udp_ports=%d http_hosts=%d",
 		len(tcpPorts), len(udpPorts), len(hostnames))
@@ -215,38 +1120,25 @@ func (g *Generator) validateConflicts(streamData StreamData, httpData HTTPData)
 	return nil
 }
 
-// generateStreamConfig generates and writes stream config if changed
-func (g *Generator) generateStreamConfig(data StreamData) (bool, error) {
-	var buf bytes.Buffer
-	if err := g.streamTemplate.Execute(&buf, data); err != nil {
-		return false, fmt.Errorf("template execution failed: %w", err)
-	}
-
-	content := buf.Bytes()
-
-	// debug: print generated config
-	g.log.Logf("DEBUG [Generator] stream config generated:\n%s", string(content))
-
-	return g.writeIfChanged(g.streamConfigPath, content)
-}
-
-// generateHTTPConfig generates and writes HTTP config if changed
-func (g *Generator) generateHTTPConfig(data HTTPData) (bool, error) {
+// renderTemplate executes a config template into memory
+func renderTemplate(tmpl *template.Template, data any) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := g.httpTemplate.Execute(&buf, data); err != nil {
-		return false, fmt.Errorf("template execution failed: %w", err)
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template execution failed: %w", err)
 	}
-
-	content := buf.Bytes()
-
-	// debug: print generated config
-	g.log.Logf("DEBUG [Generator] HTTP config generated:\n%s", string(content))
-
-	return g.writeIfChanged(g.httpConfigPath, content)
+	return buf.Bytes(), nil
 }
 
 // writeIfChanged writes config to file only if content changed
+// In read-only mode the config is only compared with the file, see audit
 func (g *Generator) writeIfChanged(path string, content []byte) (bool, error) {
+	if g.insideExtraConfigDir(path) {
+		return false, fmt.Errorf("refusing to write %s: the extra config dir is managed outside the proxy", path)
+	}
+	if g.readOnly {
+		return g.audit(path, content)
+	}
+
 	newChecksum := checksum(content)
 
 	// read existing file checksum
@@ -257,14 +1149,23 @@ func (g *Generator) writeIfChanged(path string, content []byte) (bool, error) {
 	}
 
 	oldChecksum := checksum(oldContent)
+	perm := g.filePerm(path)
 
 	if newChecksum == oldChecksum {
 		g.log.Logf("DEBUG [Generator] config unchanged path=%s checksum=%s", path, newChecksum[:8])
-		return false, nil
+		if perm.enforce {
+			if err := perm.apply(path); err != nil {
+				return false, err
+			}
+		}
+		return false, g.writeSignature(path, content)
 	}
 
 	// write atomically (tmp file + rename)
-	if err := atomicWrite(path, content); err != nil {
+	if err := g.atomicWrite(path, content); err != nil {
+		return false, err
+	}
+	if err := g.writeSignature(path, content); err != nil {
 		return false, err
 	}
 
@@ -278,14 +1179,36 @@ func checksum(data []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// atomicWrite writes data to file atomically using tmp file + rename
-func atomicWrite(path string, data []byte) error {
-	tmpFile := path + ".tmp"
+// atomicWrite writes data to path atomically using a temp file in the same directory + rename
+// Temp names are unique, so concurrent runs never share one, and the rename stays on one filesystem
+// The mode and owner are set on the temp file, the file never appears with other permissions
+// With Options.Fsync the data and the rename are flushed, a crash leaves the old or the new file
+func (g *Generator) atomicWrite(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile := tmp.Name()
+	fail := func(err error) error {
+		_ = tmp.Close()        //nolint:errcheck // may be closed already
+		_ = os.Remove(tmpFile) //nolint:errcheck // the write error is returned
+		return err
+	}
 
 	// write to temp file
-	// #nosec G306 -- nginx config files need 0644 to be readable by nginx process
-	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
+	if _, err := tmp.Write(data); err != nil {
+		return fail(fmt.Errorf("failed to write temp file: %w", err))
+	}
+	if g.opts.Fsync {
+		if err := tmp.Sync(); err != nil {
+			return fail(fmt.Errorf("failed to sync temp file: %w", err))
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fail(fmt.Errorf("failed to write temp file: %w", err))
+	}
+	if err := g.filePerm(path).apply(tmpFile); err != nil {
+		return fail(err)
 	}
 
 	// atomic rename
@@ -298,14 +1221,36 @@ func atomicWrite(path string, data []byte) error {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
+	if g.opts.Fsync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// syncDir flushes a directory entry change such as a rename
+// Windows cannot sync directories, renames are flushed by the filesystem there
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	// #nosec G304 -- dir holds a configured output path
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for sync: %w", dir, err)
+	}
+	defer d.Close() //nolint:errcheck // read-only
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dir, err)
+	}
 	return nil
 }
 
 // hostnameToUpstream converts a hostname to a valid upstream name
-// Example: api.example.com -> http_api_example_com
+// Dots and hyphens both become underscores, so a short hash of the hostname keeps names like
+// a-b.com and a.b-com apart
+// Example: api.example.com -> http_api_example_com_d0c43d38
 func hostnameToUpstream(hostname string) string {
-	// replace dots and hyphens with underscores
-	upstream := regexp.MustCompile(`[.-]`).ReplaceAllString(hostname, "_")
-	// prefix with http_
-	return "http_" + strings.ToLower(upstream)
+	hostname = strings.ToLower(hostname)
+	sum := sha256.Sum256([]byte(hostname))
+	return "http_" + strings.NewReplacer(".", "_", "-", "_").Replace(hostname) + "_" + hex.EncodeToString(sum[:4])
 }
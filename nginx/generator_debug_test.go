@@ -39,11 +39,11 @@ func TestDebugOutput(t *testing.T) {
 		}
 
 		t.Log("\n=== Generating Stream Config (DEBUG level) ===")
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated")
 		}
 
@@ -78,11 +78,11 @@ func TestDebugOutput(t *testing.T) {
 		}
 
 		t.Log("\n=== Generating HTTP Config (DEBUG level) ===")
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated")
 		}
 
@@ -115,11 +115,11 @@ func TestDebugOutput(t *testing.T) {
 		}
 
 		t.Log("\n=== Generating Mixed Config (DEBUG level) ===")
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated")
 		}
 	})
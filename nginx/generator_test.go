@@ -1,10 +1,17 @@
 package nginx
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-pkgz/lgr"
 	"github.com/moontechs/proxy/docker"
@@ -194,6 +201,9 @@ func TestValidateConflicts(t *testing.T) {
 				if !strings.Contains(err.Error(), tt.errContains) {
 					t.Errorf("validateConflicts() error = %v, should contain %q", err, tt.errContains)
 				}
+				if !errors.Is(err, ErrConflict) {
+					t.Errorf("validateConflicts() error = %v, should match ErrConflict", err)
+				}
 			}
 		})
 	}
@@ -208,22 +218,22 @@ func TestHostnameToUpstream(t *testing.T) {
 		{
 			name:     "simple domain",
 			hostname: "api.example.com",
-			want:     "http_api_example_com",
+			want:     "http_api_example_com_d0c43d38",
 		},
 		{
 			name:     "subdomain with dashes",
 			hostname: "my-api.test-domain.com",
-			want:     "http_my_api_test_domain_com",
+			want:     "http_my_api_test_domain_com_abcd3159",
 		},
 		{
 			name:     "localhost",
 			hostname: "localhost",
-			want:     "http_localhost",
+			want:     "http_localhost_49960de5",
 		},
 		{
 			name:     "IP address",
 			hostname: "192.168.1.1",
-			want:     "http_192_168_1_1",
+			want:     "http_192_168_1_1_c5eb5a4c",
 		},
 	}
 
@@ -235,6 +245,13 @@ func TestHostnameToUpstream(t *testing.T) {
 			}
 		})
 	}
+
+	if a, b := hostnameToUpstream("a-b.com"), hostnameToUpstream("a.b-com"); a == b {
+		t.Errorf("hostnameToUpstream() = %q for both a-b.com and a.b-com", a)
+	}
+	if a, b := hostnameToUpstream("API.example.com"), hostnameToUpstream("api.example.com"); a != b {
+		t.Errorf("hostnameToUpstream() = %q and %q, want the same name regardless of case", a, b)
+	}
 }
 
 func TestGenerate(t *testing.T) {
@@ -262,11 +279,11 @@ func TestGenerate(t *testing.T) {
 			},
 		}
 
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated (changed=true)")
 		}
 
@@ -289,6 +306,114 @@ func TestGenerate(t *testing.T) {
 		if !strings.Contains(content, "listen 53 udp;") {
 			t.Error("stream config should contain UDP listen directive")
 		}
+		if strings.Contains(content, "limit_conn") {
+			t.Error("stream config should not limit connections without max_connections")
+		}
+	})
+
+	t.Run("limits stream connections per port", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{
+				Name: "ssh",
+				ID:   "abc123",
+				IP:   "172.17.0.2",
+				Mappings: []docker.PortMapping{
+					{ProxyPort: 2222, ContainerPort: 22, Protocol: docker.TCP, MaxConnections: 10},
+				},
+			},
+		}
+
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		streamContent, err := os.ReadFile(streamPath)
+		if err != nil {
+			t.Fatalf("failed to read stream config: %v", err)
+		}
+
+		content := string(streamContent)
+		for _, want := range []string{
+			"limit_conn_zone $server_port zone=tcp_2222_conn:1m;",
+			"proxy_pass tcp_2222;\n    limit_conn tcp_2222_conn 10;",
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("stream config missing %q:\n%s", want, content)
+			}
+		}
+	})
+
+	t.Run("sets stream timeouts per port", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{
+				Name: "db",
+				ID:   "abc123",
+				IP:   "172.17.0.2",
+				Mappings: []docker.PortMapping{
+					{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP, Timeout: "30m", ConnectTimeout: "2s"},
+					{ProxyPort: 6432, ContainerPort: 6432, Protocol: docker.TCP},
+					{ProxyPort: 5353, ContainerPort: 53, Protocol: docker.UDP, Timeout: "5s"},
+				},
+			},
+		}
+
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		streamContent, err := os.ReadFile(streamPath)
+		if err != nil {
+			t.Fatalf("failed to read stream config: %v", err)
+		}
+
+		content := string(streamContent)
+		for _, want := range []string{
+			"proxy_pass tcp_5432;\n    proxy_connect_timeout 2s;\n    proxy_timeout 30m;",
+			"proxy_pass tcp_6432;\n    proxy_connect_timeout 10s;\n    proxy_timeout 5m;",
+			"proxy_pass udp_5353;\n    proxy_timeout 5s;",
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("stream config missing %q:\n%s", want, content)
+			}
+		}
+	})
+
+	t.Run("pools replicas with the same stream hash", func(t *testing.T) {
+		containers := []docker.ContainerInfo{
+			{
+				Name:     "wg1",
+				ID:       "abc123",
+				IP:       "172.17.0.2",
+				Mappings: []docker.PortMapping{{ProxyPort: 51820, ContainerPort: 51820, Protocol: docker.UDP, Hash: "$remote_addr"}},
+			},
+			{
+				Name:     "wg2",
+				ID:       "def456",
+				IP:       "172.17.0.3",
+				Mappings: []docker.PortMapping{{ProxyPort: 51820, ContainerPort: 51820, Protocol: docker.UDP, Hash: "$remote_addr"}},
+			},
+		}
+
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		streamContent, err := os.ReadFile(streamPath)
+		if err != nil {
+			t.Fatalf("failed to read stream config: %v", err)
+		}
+
+		content := string(streamContent)
+		want := "upstream udp_51820 {\n    hash $remote_addr consistent;\n    server 172.17.0.2:51820;\n    server 172.17.0.3:51820; # wg2\n}"
+		if !strings.Contains(content, want) {
+			t.Errorf("stream config missing %q:\n%s", want, content)
+		}
+		if strings.Count(content, "listen 51820 udp;") != 1 {
+			t.Errorf("pooled replicas should share one server:\n%s", content)
+		}
+
+		// a replica without the hash still conflicts
+		containers[1].Mappings[0].Hash = ""
+		if _, err := gen.Generate(containers); err == nil || !strings.Contains(err.Error(), "UDP port conflict") {
+			t.Errorf("expected UDP conflict error, got %v", err)
+		}
 	})
 
 	t.Run("generates HTTP config for hostname routing", func(t *testing.T) {
@@ -305,11 +430,11 @@ func TestGenerate(t *testing.T) {
 			},
 		}
 
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated (changed=true)")
 		}
 
@@ -320,7 +445,7 @@ func TestGenerate(t *testing.T) {
 		}
 
 		content := string(httpContent)
-		if !strings.Contains(content, "upstream http_api_example_com") {
+		if !strings.Contains(content, "upstream http_api_example_com_d0c43d38") {
 			t.Error("HTTP config should contain upstream for api.example.com")
 		}
 		if !strings.Contains(content, "server_name api.example.com;") {
@@ -329,7 +454,7 @@ func TestGenerate(t *testing.T) {
 		if !strings.Contains(content, "listen 80;") {
 			t.Error("HTTP config should contain listen 80 for non-HTTPS")
 		}
-		if !strings.Contains(content, "proxy_pass http://http_api_example_com;") {
+		if !strings.Contains(content, "proxy_pass http://http_api_example_com_d0c43d38;") {
 			t.Error("HTTP config should contain proxy_pass directive")
 		}
 	})
@@ -348,11 +473,11 @@ func TestGenerate(t *testing.T) {
 			},
 		}
 
-		changed, err := gen.Generate(containers)
+		report, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated (changed=true)")
 		}
 
@@ -379,20 +504,20 @@ func TestGenerate(t *testing.T) {
 		}
 
 		// first generation
-		changed1, err := gen.Generate(containers)
+		report1, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed1 {
+		if !report1.Changed() {
 			t.Error("first generation should detect change")
 		}
 
 		// second generation with same data
-		changed2, err := gen.Generate(containers)
+		report2, err := gen.Generate(containers)
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if changed2 {
+		if report2.Changed() {
 			t.Error("second generation should not detect change (same config)")
 		}
 	})
@@ -434,11 +559,11 @@ func TestGenerateEmptyConfigs(t *testing.T) {
 	gen, _ := NewGenerator(streamPath, httpPath, log)
 
 	t.Run("generates empty configs when no containers", func(t *testing.T) {
-		changed, err := gen.Generate([]docker.ContainerInfo{})
+		report, err := gen.Generate([]docker.ContainerInfo{})
 		if err != nil {
 			t.Fatalf("Generate() error = %v", err)
 		}
-		if !changed {
+		if !report.Changed() {
 			t.Error("expected config to be generated")
 		}
 
@@ -462,3 +587,2206 @@ func TestGenerateEmptyConfigs(t *testing.T) {
 		}
 	})
 }
+
+func TestRender(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	containers := []docker.ContainerInfo{{
+		Name: "web", ID: "abc123", IP: "172.17.0.2",
+		Mappings:    []docker.PortMapping{{ProxyPort: 2222, ContainerPort: 22, Protocol: docker.TCP}},
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80},
+	}}
+
+	t.Run("returns configs without writing them", func(t *testing.T) {
+		streamConf, httpConf, err := gen.Render(containers)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		if !strings.Contains(string(streamConf), "listen 2222;") {
+			t.Errorf("stream config missing the TCP listener:\n%s", streamConf)
+		}
+		if !strings.Contains(string(httpConf), "server_name web.example.com;") {
+			t.Errorf("HTTP config missing the server:\n%s", httpConf)
+		}
+		for _, path := range []string{streamPath, httpPath} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Render() touched %s, stat error = %v", path, err)
+			}
+		}
+	})
+
+	t.Run("writes to the given writers", func(t *testing.T) {
+		var streamOut, httpOut bytes.Buffer
+		if err := gen.RenderTo(&streamOut, &httpOut, containers); err != nil {
+			t.Fatalf("RenderTo() error = %v", err)
+		}
+		if !strings.Contains(streamOut.String(), "upstream tcp_2222") || !strings.Contains(httpOut.String(), "web.example.com") {
+			t.Errorf("RenderTo() output:\n%s\n%s", streamOut.String(), httpOut.String())
+		}
+		if _, err := os.Stat(httpPath); !os.IsNotExist(err) {
+			t.Errorf("RenderTo() touched %s, stat error = %v", httpPath, err)
+		}
+	})
+
+	t.Run("fails on conflicts", func(t *testing.T) {
+		conflicting := append(containers, docker.ContainerInfo{
+			Name: "other", ID: "def456", IP: "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80},
+		})
+		if _, _, err := gen.Render(conflicting); err == nil {
+			t.Error("Render() should fail on a hostname conflict")
+		}
+		if err := gen.RenderTo(io.Discard, io.Discard, conflicting); err == nil {
+			t.Error("RenderTo() should fail on a hostname conflict")
+		}
+	})
+
+	t.Run("fails on writer errors", func(t *testing.T) {
+		if err := gen.RenderTo(failingWriter{}, io.Discard, containers); err == nil {
+			t.Error("RenderTo() should fail when the stream writer fails")
+		}
+	})
+}
+
+// failingWriter refuses every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestGenerateReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	web := docker.ContainerInfo{Name: "web", ID: "abc123", IP: "172.17.0.2",
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}}
+	skipped := docker.SkippedContainer{Name: "db", ID: "def456", Reason: "no IP address", Stream: true}
+
+	report, err := gen.Generate([]docker.ContainerInfo{web}, skipped)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !report.Changed() || !report.Stream.Changed || !report.HTTP.Changed {
+		t.Errorf("first report = %+v, want both configs changed", report)
+	}
+	if len(report.Changes.Added) != 1 || report.Changes.Added[0].Name != "web" {
+		t.Errorf("Changes.Added = %+v, want web", report.Changes.Added)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Reason != "no IP address" {
+		t.Errorf("Skipped = %+v, want db", report.Skipped)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	if report.HTTP.Path != httpPath || report.HTTP.Checksum != checksum(content) {
+		t.Errorf("HTTP = %+v, want the path and checksum of the written config", report.HTTP)
+	}
+	if details := report.Details(); details["added"] != "1" || details["skipped"] != "1" ||
+		details["http_checksum"] != report.HTTP.Checksum {
+		t.Errorf("Details() = %v", details)
+	}
+
+	// changes are computed against the previous generation
+	web.HTTPMapping = &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 8080}
+	report, err = gen.Generate([]docker.ContainerInfo{web})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(report.Changes.Added) != 0 || len(report.Changes.Changed) != 1 || len(report.Skipped) != 0 {
+		t.Errorf("second report changes = %+v, want web changed", report.Changes)
+	}
+
+	gen.SetPreviousRoutes(nil)
+	report, err = gen.Generate(nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !report.Changes.Empty() {
+		t.Errorf("report after SetPreviousRoutes(nil) = %+v, want no route changes", report.Changes)
+	}
+}
+
+func TestGenerateACMEChallenge(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{ACMEChallengeAddr: "127.0.0.1:8402"})
+
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "web",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80},
+		},
+		{
+			Name:        "secure",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"secure.example.com"}, ContainerPort: 443, HTTPS: true},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	if strings.Count(text, "location /.well-known/acme-challenge/") != 2 {
+		t.Errorf("expected challenge location in port 80 server and HTTPS-only server:\n%s", text)
+	}
+	if !strings.Contains(text, "proxy_pass http://127.0.0.1:8402;") {
+		t.Error("challenge location should proxy to the responder")
+	}
+	if !strings.Contains(text, "server_name secure.example.com;") {
+		t.Error("HTTPS-only hostnames should get a port 80 challenge server")
+	}
+}
+
+func TestGenerateSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	secretsDir := filepath.Join(tmpDir, "secrets")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	if err := os.Mkdir(secretsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app_htpasswd", "app_cert", "app_key"} {
+		if err := os.WriteFile(filepath.Join(secretsDir, name), []byte("secret"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{SecretsDir: secretsDir})
+
+	containers := []docker.ContainerInfo{
+		{
+			Name: "app",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"app.example.com"}, ContainerPort: 80, HTTPS: true,
+				AuthSecret: "app_htpasswd", TLSCertSecret: "app_cert", TLSKeySecret: "app_key",
+			},
+		},
+		{
+			Name: "missing",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"missing.example.com"}, ContainerPort: 80, AuthSecret: "not_mounted",
+			},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"auth_basic_user_file " + filepath.Join(secretsDir, "app_htpasswd") + ";",
+		"ssl_certificate " + filepath.Join(secretsDir, "app_cert") + ";",
+		"ssl_certificate_key " + filepath.Join(secretsDir, "app_key") + ";",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in HTTP config:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "missing.example.com") {
+		t.Error("host with a missing auth secret must not be served")
+	}
+}
+
+func TestGenerateUpstreamAuthSecret(t *testing.T) {
+	tmpDir := t.TempDir()
+	secretsDir := filepath.Join(tmpDir, "secrets")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	if err := os.Mkdir(secretsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"api_token": "Bearer s3cr3t-token\n",
+		"bad_token": "Bearer $remote_addr",
+	} {
+		if err := os.WriteFile(filepath.Join(secretsDir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{SecretsDir: secretsDir, SigningKey: []byte("key")})
+
+	api := docker.ContainerInfo{Name: "api", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+		Hostnames: []string{"api.example.com"}, ContainerPort: 8080, UpstreamAuthSecret: "api_token",
+	}}
+	bad := docker.ContainerInfo{Name: "bad", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+		Hostnames: []string{"bad.example.com"}, ContainerPort: 80, UpstreamAuthSecret: "bad_token",
+	}}
+	if _, err := gen.Generate([]docker.ContainerInfo{api, bad}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	secretsPath := SecretsPath(httpPath)
+	text := readConfig(t, httpPath)
+	if strings.Contains(text, "s3cr3t-token") {
+		t.Errorf("HTTP config contains the token:\n%s", text)
+	}
+	for _, want := range []string{
+		"include " + secretsPath + ";",
+		"proxy_set_header Authorization $proxy_upstream_authorization;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in HTTP config:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "server_name bad.example.com;") {
+		t.Error("host with a header secret nginx would interpolate must not be served")
+	}
+
+	secrets := readConfig(t, secretsPath)
+	if !strings.Contains(secrets, `"api.example.com" "Bearer s3cr3t-token"; # api`) {
+		t.Errorf("secrets include missing the token:\n%s", secrets)
+	}
+	if runtime.GOOS != "windows" {
+		for _, path := range []string{secretsPath, SignaturePath(secretsPath), httpPath} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DefaultSecretsFileMode
+			if path == httpPath {
+				want = 0o644
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("%s mode = %o, want %o", path, info.Mode().Perm(), want)
+			}
+		}
+
+		// the configured mode replaces a manual chmod
+		if err := os.Chmod(secretsPath, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		gen.SetOptions(Options{SecretsDir: secretsDir, SecretsFileMode: 0o640})
+		if _, err := gen.Generate([]docker.ContainerInfo{api}); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if info, err := os.Stat(secretsPath); err != nil || info.Mode().Perm() != 0o640 {
+			t.Errorf("secrets include mode = %v, %v, want 640", info.Mode(), err)
+		}
+	}
+
+	// the include goes away with the last route needing it
+	if _, err := gen.Generate(nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if _, err := os.Stat(secretsPath); !os.IsNotExist(err) {
+		t.Errorf("unused secrets include kept, stat error = %v", err)
+	}
+	if strings.Contains(readConfig(t, httpPath), secretsPath) {
+		t.Error("HTTP config still includes the secrets")
+	}
+
+	// remote targets never get the secrets include
+	gen.SetOptions(Options{SecretsDir: secretsDir, RemoteDelivery: true})
+	if _, err := gen.Generate([]docker.ContainerInfo{api}); err == nil ||
+		!strings.Contains(err.Error(), "proxy.http.upstream.auth.secret of api needs a local nginx") {
+		t.Errorf("Generate() with remote delivery error = %v, want upstream credentials refused", err)
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	for value, want := range map[string]string{
+		"api.example.com": `"api.example.com"`,
+		`Basic "quoted"`:  `"Basic \"quoted\""`,
+		`back\slash`:      `"back\\slash"`,
+		"Bearer café-✓":   `"Bearer café-✓"`,
+	} {
+		if got := quoteValue(value); got != want {
+			t.Errorf("quoteValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestGenerateConfigFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and owners are not supported on windows")
+	}
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	// chown to the current user works without privileges
+	gen.SetOptions(Options{
+		ConfigFileMode: 0o640,
+		ConfigOwner:    &FileOwner{UID: os.Getuid(), GID: os.Getgid()},
+		SigningKey:     []byte("key"),
+	})
+
+	checkModes := func() {
+		t.Helper()
+		for _, path := range []string{streamPath, httpPath, SignaturePath(httpPath)} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0o640 {
+				t.Errorf("%s mode = %o, want 640", path, info.Mode().Perm())
+			}
+		}
+	}
+
+	if _, err := gen.Generate(nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	checkModes()
+
+	// a manual chmod is reverted by the next generation
+	if err := os.Chmod(httpPath, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gen.Generate(nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	checkModes()
+}
+
+func TestAtomicWriteConcurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), path, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{Fsync: true})
+
+	// runs writing at once never share a temp file
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- gen.atomicWrite(path, []byte(strings.Repeat(strconv.Itoa(i), 4096)))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("atomicWrite() error = %v", err)
+		}
+	}
+
+	content := readConfig(t, path)
+	if len(content) != 4096 || strings.Count(content, content[:1]) != 4096 {
+		t.Errorf("config mixes several writes, length %d", len(content))
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	t.Run("custom template replaces built-in", func(t *testing.T) {
+		tmplPath := filepath.Join(tmpDir, "http.tmpl")
+		if err := os.WriteFile(tmplPath, []byte("# custom{{range .HTTPServers}} {{.Hostname}}{{end}}\n"), 0o600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if err := gen.LoadTemplates("", tmplPath); err != nil {
+			t.Fatalf("LoadTemplates() error = %v", err)
+		}
+
+		containers := []docker.ContainerInfo{
+			{Name: "web", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+		}
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+
+		content, _ := os.ReadFile(httpPath)
+		if string(content) != "# custom web.example.com\n" {
+			t.Errorf("unexpected HTTP config %q", content)
+		}
+	})
+
+	t.Run("invalid template keeps previous templates", func(t *testing.T) {
+		badPath := filepath.Join(tmpDir, "bad.tmpl")
+		if err := os.WriteFile(badPath, []byte("{{range}"), 0o600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if err := gen.LoadTemplates(badPath, ""); err == nil {
+			t.Fatal("expected parse error")
+		}
+
+		containers := []docker.ContainerInfo{
+			{Name: "api", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 80}},
+		}
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		content, _ := os.ReadFile(httpPath)
+		if string(content) != "# custom api.example.com\n" {
+			t.Errorf("expected the previous custom template, got HTTP config %q", content)
+		}
+	})
+
+	t.Run("missing template file fails", func(t *testing.T) {
+		if err := gen.LoadTemplates(filepath.Join(tmpDir, "missing.tmpl"), ""); err == nil {
+			t.Error("expected read error")
+		}
+	})
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	// stream config exists before start, HTTP config does not
+	if err := os.WriteFile(streamPath, []byte("# hand-written\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	gen, _ := NewGenerator(streamPath, httpPath, lgr.New())
+
+	snap, err := gen.TakeSnapshot()
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{Name: "web", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 80, ContainerPort: 8080, Protocol: docker.TCP}}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	changed, err := gen.RestoreSnapshot(snap)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if !changed {
+		t.Error("expected restore to report changes")
+	}
+
+	content, _ := os.ReadFile(streamPath)
+	if string(content) != "# hand-written\n" {
+		t.Errorf("stream config not restored, got %q", content)
+	}
+	if _, err := os.Stat(httpPath); !os.IsNotExist(err) {
+		t.Error("HTTP config absent before start should be removed on restore")
+	}
+}
+
+func TestGenerateSkippedComments(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{SecretsDir: tmpDir})
+
+	containers := []docker.ContainerInfo{
+		{
+			Name: "protected",
+			ID:   "ccc333",
+			IP:   "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"protected.example.com"}, ContainerPort: 80, AuthSecret: "not_mounted",
+			},
+		},
+	}
+	skipped := []docker.SkippedContainer{
+		{Name: "db", ID: "aaa111", Reason: "invalid TCP port mappings:\ninvalid port \"x\"", Stream: true},
+		{Name: "web", ID: "bbb222", Reason: "no IP address", HTTP: true},
+	}
+
+	if _, err := gen.Generate(containers, skipped...); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	stream, err := os.ReadFile(streamPath)
+	if err != nil {
+		t.Fatalf("failed to read stream config: %v", err)
+	}
+	http, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	if !strings.Contains(string(stream), "# SKIPPED CONTAINERS") ||
+		!strings.Contains(string(stream), `#   db (aaa111): invalid TCP port mappings: invalid port "x"`) {
+		t.Errorf("stream config should list the skipped container on one comment line:\n%s", stream)
+	}
+	if strings.Contains(string(stream), "web (bbb222)") {
+		t.Error("HTTP-only container should not be listed in the stream config")
+	}
+	if !strings.Contains(string(http), "#   web (bbb222): no IP address") {
+		t.Errorf("HTTP config should list the skipped container:\n%s", http)
+	}
+	if !strings.Contains(string(http), "#   protected (ccc333): secret not_mounted not available") {
+		t.Errorf("HTTP config should list hosts skipped for missing secrets:\n%s", http)
+	}
+
+	// nothing skipped, no comment block
+	if _, err := gen.Generate(nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	stream, err = os.ReadFile(streamPath)
+	if err != nil {
+		t.Fatalf("failed to read stream config: %v", err)
+	}
+	if strings.Contains(string(stream), "SKIPPED") {
+		t.Errorf("stream config should not have a skipped block:\n%s", stream)
+	}
+}
+
+func TestGenerateHTTPRoutes(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "app",
+			ID:          "abc123",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"app.example.com"}, ContainerPort: 3000},
+			HTTPRoutes: []docker.HTTPMapping{
+				{Hostnames: []string{"admin.example.com"}, ContainerPort: 9090},
+				{Hostnames: []string{"metrics.example.com"}, ContainerPort: 9100, HTTPS: true},
+			},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"server 172.17.0.2:3000;",
+		"server_name app.example.com;",
+		"server 172.17.0.2:9090;",
+		"server_name admin.example.com;",
+		"server 172.17.0.2:9100;",
+		"listen 443 ssl;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+
+	// host:port overrides the port of one hostname
+	containers[0].HTTPMapping = &docker.HTTPMapping{
+		Hostnames:     []string{"app.example.com", "api.example.com"},
+		ContainerPort: 3000,
+		HostPorts:     map[string]int{"api.example.com": 4000},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err = os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	if !strings.Contains(string(content), "server 172.17.0.2:4000;") || !strings.Contains(string(content), "server 172.17.0.2:3000;") {
+		t.Errorf("HTTP config should route api.example.com to port 4000:\n%s", content)
+	}
+
+	// the same hostname in two routes is a conflict
+	containers[0].HTTPRoutes[1].Hostnames = []string{"admin.example.com"}
+	if _, err := gen.Generate(containers); err == nil {
+		t.Error("Generate() should fail on a hostname used by two routes")
+	}
+}
+
+func TestGenerateBackendTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{
+			Name: "unifi",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"unifi.example.com"}, ContainerPort: 8443,
+				BackendHTTPS: true, BackendSSLVerify: true, BackendSNI: "unifi.local",
+			},
+		},
+		{
+			Name: "proxmox",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"pve.example.com"}, ContainerPort: 8006, BackendHTTPS: true,
+			},
+		},
+		{
+			Name:        "plain",
+			IP:          "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"plain.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"proxy_pass https://http_unifi_example_com_461a7a5c;",
+		"proxy_ssl_name unifi.local;",
+		"proxy_ssl_verify on;",
+		"proxy_ssl_trusted_certificate " + BackendCAFile + ";",
+		"proxy_pass https://http_pve_example_com_24d5818d;",
+		"proxy_ssl_name $host;",
+		"proxy_ssl_verify off;",
+		"proxy_pass http://http_plain_example_com_f3f3a43d;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "proxy_ssl_server_name on;") != 2 {
+		t.Errorf("only HTTPS backends should get proxy_ssl_* directives:\n%s", text)
+	}
+}
+
+func TestGenerateUpstreamHost(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	mapping := func(hostname, upstreamHost string) *docker.HTTPMapping {
+		return &docker.HTTPMapping{Hostnames: []string{hostname}, ContainerPort: 8080, UpstreamHost: upstreamHost}
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "default", IP: "172.17.0.2", HTTPMapping: mapping("default.example.com", "")},
+		{Name: "preserve", IP: "172.17.0.3", HTTPMapping: mapping("preserve.example.com", docker.UpstreamHostPreserve)},
+		{Name: "upstream", IP: "172.17.0.4", HTTPMapping: mapping("upstream.example.com", docker.UpstreamHostUpstream)},
+		{Name: "named", IP: "172.17.0.5", HTTPMapping: mapping("named.example.com", "wiki.internal:8080")},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	text := readConfig(t, httpPath)
+	for _, want := range []string{
+		"proxy_set_header Host $host;",
+		"proxy_set_header Host $http_host;",
+		"proxy_set_header Host 172.17.0.4:8080;",
+		"proxy_set_header Host wiki.internal:8080;",
+	} {
+		if strings.Count(text, want) != 1 {
+			t.Errorf("HTTP config should have %q once:\n%s", want, text)
+		}
+	}
+}
+
+func TestGenerateRequestRestrictions(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{Name: "wiki", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"wiki.example.com"}, ContainerPort: 8080, AllowedMethods: []string{"GET", "HEAD"},
+		}},
+		{Name: "upload", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"upload.example.com"}, ContainerPort: 8080, MaxBodySize: "1g",
+		}},
+		{Name: "app", IP: "172.17.0.4", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"app.example.com"}, ContainerPort: 8080,
+		}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	text := readConfig(t, httpPath)
+	for _, want := range []string{
+		"    if ($request_method !~ ^(GET|HEAD)$) {\n        return 405;\n    }",
+		"    client_max_body_size 1g;",
+	} {
+		if strings.Count(text, want) != 1 {
+			t.Errorf("HTTP config should have %q once:\n%s", want, text)
+		}
+	}
+}
+
+func TestGenerateResolver(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath, httpPath := filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{Resolver: "1.1.1.1 [2606:4700:4700::1111]"})
+
+	containers := []docker.ContainerInfo{
+		{Name: "app", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"app.example.com"}, ContainerPort: 8080,
+		}},
+		{Name: "intranet", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"intranet.example.com"}, ContainerPort: 8080, Resolver: "192.168.1.1",
+		}},
+		{Name: "wiki", IP: "172.17.0.4", Namespace: "team-a", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"wiki.example.com"}, ContainerPort: 8080,
+		}},
+		{Name: "db", IP: "172.17.0.5", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP}}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	text := readConfig(t, httpPath)
+	for _, want := range []string{"\nresolver 1.1.1.1 [2606:4700:4700::1111];\n", "    resolver 192.168.1.1;\n"} {
+		if strings.Count(text, want) != 1 {
+			t.Errorf("HTTP config should have %q once:\n%s", want, text)
+		}
+	}
+	if stream := readConfig(t, streamPath); !strings.Contains(stream, "\nresolver 1.1.1.1 [2606:4700:4700::1111];\n") {
+		t.Errorf("stream config missing the resolver:\n%s", stream)
+	}
+
+	// namespace configs are included at http level and inherit the resolver
+	if namespace := readConfig(t, NamespacePath(httpPath, "team-a")); strings.Contains(namespace, "resolver") {
+		t.Errorf("namespace HTTP config repeats the resolver:\n%s", namespace)
+	}
+}
+
+func TestGenerateGRPC(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{
+			Name: "api",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"grpc.example.com"}, ContainerPort: 50051, HTTPS: true, GRPC: true,
+			},
+		},
+		{
+			Name: "secure-api",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"grpcs.example.com"}, ContainerPort: 50052, HTTPS: true, GRPC: true, BackendHTTPS: true,
+			},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"listen 443 ssl http2;",
+		"grpc_pass grpc://http_grpc_example_com_a6c683af;",
+		"grpc_pass grpcs://http_grpcs_example_com_9db57ecd;",
+		"grpc_ssl_verify off;",
+		"grpc_set_header Host $host;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "proxy_pass http") {
+		t.Errorf("gRPC routes should not use proxy_pass:\n%s", text)
+	}
+}
+
+func TestGenerateListenerProtocols(t *testing.T) {
+	enabled, disabled := true, false
+	containers := []docker.ContainerInfo{
+		{
+			Name: "app",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"app.example.com", "www.example.com"}, ContainerPort: 80, HTTPS: true,
+			},
+		},
+		{
+			Name: "legacy",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"legacy.example.com"}, ContainerPort: 80, HTTPS: true, HTTP2: &disabled, HTTP3: &disabled,
+			},
+		},
+		{
+			Name:        "plain",
+			IP:          "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"plain.example.com"}, ContainerPort: 80, HTTP3: &enabled},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		wantHTTP2    int
+		wantQUIC     int
+		wantReuse    int
+		wantAltSvc   int
+		wantPlainTLS int
+	}{
+		{name: "disabled by default", opts: Options{}, wantPlainTLS: 3},
+		{name: "global http2 and http3", opts: Options{HTTP2: true, HTTP3: true}, wantHTTP2: 2, wantQUIC: 2, wantReuse: 1, wantAltSvc: 2, wantPlainTLS: 1},
+		{
+			name:         "nginx without http3",
+			opts:         Options{HTTP2: true, HTTP3: true, Capabilities: &Capabilities{HTTP2: true}},
+			wantHTTP2:    2,
+			wantPlainTLS: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			httpPath := filepath.Join(tmpDir, "http.conf")
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(tt.opts)
+
+			if _, err := gen.Generate(containers); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			content, err := os.ReadFile(httpPath)
+			if err != nil {
+				t.Fatalf("failed to read HTTP config: %v", err)
+			}
+			text := string(content)
+
+			for directive, want := range map[string]int{
+				"listen 443 ssl http2;":      tt.wantHTTP2,
+				"listen 443 quic":            tt.wantQUIC,
+				"listen 443 quic reuseport;": tt.wantReuse,
+				"add_header Alt-Svc":         tt.wantAltSvc,
+				"listen 443 ssl;":            tt.wantPlainTLS,
+			} {
+				if got := strings.Count(text, directive); got != want {
+					t.Errorf("%q appears %d times, want %d:\n%s", directive, got, want, text)
+				}
+			}
+			if strings.Count(text, "listen 80;") != 1 {
+				t.Errorf("plain HTTP host should keep its port 80 listener:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestGenerateStaticRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	containers := []docker.ContainerInfo{
+		{
+			Name: "site",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"www.example.com"}, ContainerPort: 80, StaticRoot: "/data/www",
+			},
+		},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"root /data/www;",
+		"try_files $uri $uri/ =404;",
+		"expires 1h;",
+		`location ~* \.(?:css|js|mjs|png|jpe?g|gif|svg|webp|avif|ico|woff2?)$ {`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"upstream ", "proxy_pass"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("static site should not have %q:\n%s", unwanted, text)
+		}
+	}
+}
+
+func TestGenerateSocketUpstream(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	mapping := &docker.HTTPMapping{Hostnames: []string{"app.example.com"}, ContainerPort: 80, Socket: "/run/app/app.sock"}
+	containers := []docker.ContainerInfo{
+		{Name: "app-1", IP: "172.17.0.2", Service: "shop/app", HTTPMapping: mapping},
+		{Name: "app-2", IP: "172.17.0.3", Service: "shop/app",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"app.example.com"}, ContainerPort: 80, Socket: "/run/app-2/app.sock"}},
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"server unix:/run/app/app.sock;",
+		"server unix:/run/app-2/app.sock; # app-2",
+		"proxy_pass http://http_app_example_com_28059829;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "172.17.0.2:80") {
+		t.Errorf("socket upstream should not use the container IP:\n%s", text)
+	}
+}
+
+func TestGenerateAliasRedirects(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{ACMEChallengeAddr: "127.0.0.1:8402"})
+
+	containers := []docker.ContainerInfo{
+		{Name: "blog", ID: "abc123", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"example.com"}, ContainerPort: 80, HTTPS: true, Aliases: []string{"www.example.com"},
+		}},
+		{Name: "docs", ID: "def456", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"docs.example.com"}, ContainerPort: 80, Aliases: []string{"doc.example.com"},
+		}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"# Alias of example.com: blog (abc123)",
+		"server_name www.example.com;",
+		"return 301 https://example.com$request_uri;",
+		"return 301 http://docs.example.com$request_uri;",
+		"server_name example.com www.example.com;", // certificates can be issued for the alias
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "upstream http_www_example_com_80fc0fb9") {
+		t.Errorf("alias should not get an upstream:\n%s", text)
+	}
+
+	// an alias claimed as a host by another container conflicts
+	containers = append(containers, docker.ContainerInfo{Name: "www", ID: "ghi789", IP: "172.17.0.4",
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"www.example.com"}, ContainerPort: 80}})
+	if _, err := gen.Generate(containers); err == nil || !strings.Contains(err.Error(), "www.example.com") {
+		t.Errorf("Generate() error = %v, want hostname conflict", err)
+	}
+}
+
+func TestGenerateGeoRules(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name: "eu-only",
+			ID:   "abc123",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"eu.example.com"}, ContainerPort: 80, GeoAllow: []string{"DE", "AT"},
+			},
+		},
+		{
+			Name: "no-us",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"intl.example.com"}, ContainerPort: 80, GeoDeny: []string{"US"},
+			},
+		},
+	}
+
+	t.Run("rules with database", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		httpPath := filepath.Join(tmpDir, "http.conf")
+		gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+		if err != nil {
+			t.Fatalf("NewGenerator() error = %v", err)
+		}
+		gen.SetOptions(Options{GeoIPDB: "/usr/share/GeoIP/GeoLite2-Country.mmdb"})
+
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		content, err := os.ReadFile(httpPath)
+		if err != nil {
+			t.Fatalf("failed to read HTTP config: %v", err)
+		}
+
+		text := string(content)
+		for _, want := range []string{
+			"geoip2 /usr/share/GeoIP/GeoLite2-Country.mmdb {",
+			"map $proxy_geoip_country_code $proxy_geo_blocked_http_eu_example_com_3eb52946 {\n    default 1;\n    DE 0;\n    AT 0;\n}",
+			"map $proxy_geoip_country_code $proxy_geo_blocked_http_intl_example_com_161ea275 {\n    default 0;\n    US 1;\n}",
+			"if ($proxy_geo_blocked_http_eu_example_com_3eb52946) {\n            return 403;",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("HTTP config missing %q:\n%s", want, text)
+			}
+		}
+		if strings.Count(text, "geoip2 ") != 1 {
+			t.Errorf("geoip2 block should be emitted once:\n%s", text)
+		}
+	})
+
+	t.Run("skipped without database", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		httpPath := filepath.Join(tmpDir, "http.conf")
+		gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+		if err != nil {
+			t.Fatalf("NewGenerator() error = %v", err)
+		}
+
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		content, err := os.ReadFile(httpPath)
+		if err != nil {
+			t.Fatalf("failed to read HTTP config: %v", err)
+		}
+
+		text := string(content)
+		if strings.Contains(text, "server_name eu.example.com;") || strings.Contains(text, "geoip2") {
+			t.Errorf("geo-restricted hosts must not be served without a database:\n%s", text)
+		}
+		if !strings.Contains(text, "eu-only (abc123): geo rules set but no GeoIP database is configured") {
+			t.Errorf("skipped host should be listed:\n%s", text)
+		}
+	})
+}
+
+func TestGenerateRequestID(t *testing.T) {
+	off := false
+	on := true
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "api",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 8080},
+		},
+		{
+			Name:        "metrics",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"metrics.example.com"}, ContainerPort: 9090, RequestID: &off},
+		},
+		{
+			Name:        "grpc",
+			IP:          "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"grpc.example.com"}, ContainerPort: 50051, GRPC: true, HTTPS: true, BackendHTTPS: true, RequestID: &on},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "global with per-host opt-out",
+			opts: Options{RequestID: true},
+			want: []string{
+				"map $http_x_request_id $proxy_request_id {\n    default $http_x_request_id;\n    \"\"      $request_id;\n}",
+				"log_format proxy_request_id ",
+				"request_id=$proxy_request_id",
+				"server_name api.example.com;\n    access_log /var/log/nginx/access.log proxy_request_id;\n    add_header X-Request-ID $proxy_request_id always;",
+				"proxy_set_header X-Request-ID $proxy_request_id;",
+				"grpc_set_header X-Request-ID $proxy_request_id;",
+			},
+			notWant: []string{"server_name metrics.example.com;\n    access_log"},
+		},
+		{
+			name: "label only",
+			want: []string{
+				"map $http_x_request_id $proxy_request_id {",
+				"grpc_set_header X-Request-ID $proxy_request_id;",
+			},
+			notWant: []string{"proxy_set_header X-Request-ID"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			httpPath := filepath.Join(tmpDir, "http.conf")
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(tt.opts)
+
+			if _, err := gen.Generate(containers); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			content, err := os.ReadFile(httpPath)
+			if err != nil {
+				t.Fatalf("failed to read HTTP config: %v", err)
+			}
+
+			text := string(content)
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("HTTP config missing %q:\n%s", want, text)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(text, notWant) {
+					t.Errorf("HTTP config should not contain %q:\n%s", notWant, text)
+				}
+			}
+			if strings.Count(text, "log_format proxy_request_id") != 1 {
+				t.Errorf("log format should be emitted once:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestGenerateWAF(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "shop",
+			ID:          "abc123",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 80, WAF: true},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "rules file and module",
+			opts: Options{WAFRules: "/etc/nginx/modsec/main.conf", Capabilities: &Capabilities{ModSecurity: true}},
+			want: []string{
+				"server_name shop.example.com;\n    modsecurity on;\n    modsecurity_rules_file /etc/nginx/modsec/main.conf;",
+			},
+			notWant: []string{"server_name blog.example.com;\n    modsecurity"},
+		},
+		{
+			name:    "skipped without rules file",
+			want:    []string{"shop (abc123): waf enabled but no WAF rules file is configured", "server_name blog.example.com;"},
+			notWant: []string{"server_name shop.example.com;", "modsecurity"},
+		},
+		{
+			name:    "skipped without module",
+			opts:    Options{WAFRules: "/etc/nginx/modsec/main.conf", Capabilities: &Capabilities{}},
+			want:    []string{"shop (abc123): waf enabled but nginx lacks the ModSecurity module"},
+			notWant: []string{"server_name shop.example.com;", "modsecurity on;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			httpPath := filepath.Join(tmpDir, "http.conf")
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(tt.opts)
+
+			if _, err := gen.Generate(containers); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			content, err := os.ReadFile(httpPath)
+			if err != nil {
+				t.Fatalf("failed to read HTTP config: %v", err)
+			}
+
+			text := string(content)
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("HTTP config missing %q:\n%s", want, text)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(text, notWant) {
+					t.Errorf("HTTP config should not contain %q:\n%s", notWant, text)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateBlockBots(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "shop",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 80, BlockBots: true},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{BotPatterns: []string{"sqlmap", "^BadBot/"}})
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"map $http_user_agent $proxy_bad_bot {\n    default 0;\n    \"~*sqlmap\" 1;\n    \"~*^BadBot/\" 1;\n}",
+		"server_name shop.example.com;\n    if ($proxy_bad_bot) {\n        return 403;\n    }",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "server_name blog.example.com;\n    if ($proxy_bad_bot)") {
+		t.Errorf("blog should not block bots:\n%s", text)
+	}
+
+	// without patterns nothing is blocked and the map is left out
+	gen.SetOptions(Options{})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err = os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	if strings.Contains(string(content), "proxy_bad_bot") {
+		t.Errorf("empty blocklist should not emit bot rules:\n%s", content)
+	}
+}
+
+func TestGenerateValidReferers(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name: "media",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"media.example.com"}, ContainerPort: 80,
+				ValidReferers: []string{"none", "blocked", "server_names", "*.example.com"},
+			},
+		},
+		{
+			Name: "gallery",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"gallery.example.com"}, StaticRoot: "/data/gallery", ValidReferers: []string{"none"},
+			},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"valid_referers none blocked server_names *.example.com;\n        if ($invalid_referer) {\n            return 403;",
+		"valid_referers none;",
+		// static assets are served from a nested location, which does not inherit the check
+		"# rewrite directives are not inherited by nested locations\n            if ($invalid_referer) {",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "valid_referers") != 2 {
+		t.Errorf("blog.example.com should allow every referer:\n%s", text)
+	}
+}
+
+func TestGenerateLimits(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name: "files",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"files.example.com"}, ContainerPort: 80, LimitConn: 2, LimitRate: "1m",
+			},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"limit_conn_zone $binary_remote_addr zone=http_files_example_com_64c51264_conn:1m;",
+		"limit_conn http_files_example_com_64c51264_conn 2;\n    limit_conn_status 429;\n    limit_rate 1m;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "limit_conn_zone") != 1 || strings.Count(text, "limit_rate ") != 1 {
+		t.Errorf("only files.example.com should be limited:\n%s", text)
+	}
+}
+
+func TestGenerateOIDC(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name: "grafana",
+			IP:   "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"grafana.example.com"}, ContainerPort: 3000, HTTPS: true,
+				OIDC: &docker.OIDC{Provider: docker.OIDCOAuth2Proxy, AuthURL: "http://oauth2-proxy:4180"},
+			},
+		},
+		{
+			Name: "wiki",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"wiki.example.com"}, ContainerPort: 80, HTTPS: true,
+				OIDC: &docker.OIDC{Provider: docker.OIDCVouch, AuthURL: "http://vouch:9090", LoginURL: "https://login.example.com"},
+			},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"location /oauth2/ {\n        proxy_pass http://oauth2-proxy:4180;",
+		"location = /oauth2/auth {\n        internal;",
+		"auth_request /oauth2/auth;",
+		"error_page 401 =302 /oauth2/start?rd=$scheme://$host$request_uri;",
+		"proxy_set_header X-Forwarded-Email $proxy_oidc_email;",
+		"location = /validate {\n        internal;\n        proxy_pass http://vouch:9090;",
+		"return 302 https://login.example.com/login?url=$scheme://$http_host$request_uri&",
+		"return 302 https://login.example.com/logout?url=$scheme://$http_host/;",
+		"auth_request /validate;",
+		"error_page 401 = @proxy_oidc_login;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "auth_request ") != 2 || strings.Count(text, "proxy_set_header X-Forwarded-User") != 2 {
+		t.Errorf("only grafana and wiki should require a login:\n%s", text)
+	}
+}
+
+func TestGenerateBuffering(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "events",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"events.example.com"}, ContainerPort: 80, BufferingOff: true},
+		},
+		{
+			Name: "api",
+			IP:   "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{
+				Hostnames: []string{"api.example.com"}, ContainerPort: 80, ProxyBuffers: "16 8k", ProxyBufferSize: "16k",
+			},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.4",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{"proxy_buffering off;", "proxy_buffers 16 8k;", "proxy_buffer_size 16k;"} {
+		if strings.Count(text, want) != 1 {
+			t.Errorf("HTTP config should contain %q once:\n%s", want, text)
+		}
+	}
+}
+
+func TestGenerateReplicasAndRetries(t *testing.T) {
+	retryMapping := docker.HTTPMapping{
+		Hostnames: []string{"api.example.com"}, ContainerPort: 8080,
+		NextUpstream: "error timeout http_502", Retries: 2, NextUpstreamTimeout: "10s",
+	}
+	replica1, replica2 := retryMapping, retryMapping
+	containers := []docker.ContainerInfo{
+		{Name: "shop-api-1", ID: "abc123", IP: "172.17.0.2", Service: "shop/api", HTTPMapping: &replica1},
+		{Name: "shop-api-2", ID: "def456", IP: "172.17.0.3", Service: "shop/api", HTTPMapping: &replica2},
+	}
+
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+
+	text := string(content)
+	for _, want := range []string{
+		"upstream http_api_example_com_d0c43d38 {\n    server 172.17.0.2:8080;\n    server 172.17.0.3:8080; # shop-api-2\n}",
+		"proxy_next_upstream error timeout http_502;\n        proxy_next_upstream_tries 3;\n        proxy_next_upstream_timeout 10s;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "server_name api.example.com;") != 1 {
+		t.Errorf("replicas should share one server block:\n%s", text)
+	}
+
+	// containers of different services still conflict
+	containers[1].Service = "shop/web"
+	if _, err := gen.Generate(containers); err == nil || !strings.Contains(err.Error(), "HTTP hostname conflict") {
+		t.Errorf("expected hostname conflict error, got %v", err)
+	}
+}
+
+func TestGenerateSyslog(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			Name:     "ssh",
+			IP:       "172.17.0.2",
+			Mappings: []docker.PortMapping{{ProxyPort: 2222, ContainerPort: 22, Protocol: docker.TCP}},
+		},
+		{
+			Name:        "api",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 8080},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{Syslog: "syslog:server=10.0.0.5:514", RequestID: true})
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	for path, wants := range map[string][]string{
+		streamPath: {
+			"log_format proxy_stream ",
+			"access_log syslog:server=10.0.0.5:514,tag=nginx_stream proxy_stream;",
+			"error_log syslog:server=10.0.0.5:514,tag=nginx_error warn;",
+		},
+		httpPath: {
+			"access_log syslog:server=10.0.0.5:514,tag=nginx_access combined;",
+			"error_log syslog:server=10.0.0.5:514,tag=nginx_error warn;",
+			// server level access_log replaces the inherited ones
+			"    access_log /var/log/nginx/access.log proxy_request_id;\n    access_log syslog:server=10.0.0.5:514,tag=nginx_access proxy_request_id;",
+		},
+	} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s missing %q:\n%s", filepath.Base(path), want, content)
+			}
+		}
+	}
+}
+
+func TestGenerateAccessLogJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID bool
+		wants     []string
+	}{
+		{
+			name: "plain",
+			wants: []string{
+				`log_format proxy_json escape=json '{"time":"$time_iso8601","host":"$server_name","status":$status,'`,
+				`'"request_length":$request_length,"bytes_sent":$bytes_sent,"body_bytes_sent":$body_bytes_sent,'`,
+				`'"upstream_response_time":"$upstream_response_time",'`,
+				`'"remote_addr":"$remote_addr"}';`,
+				"\naccess_log /var/log/nginx/access.json proxy_json;",
+			},
+		},
+		{
+			name:      "with request ids",
+			requestID: true,
+			wants: []string{
+				`"request_id":"$proxy_request_id"}';`,
+				// server level access_log replaces the inherited ones
+				"    access_log /var/log/nginx/access.log proxy_request_id;\n    access_log /var/log/nginx/access.json proxy_json;",
+			},
+		},
+	}
+
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "api",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 8080},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			httpPath := filepath.Join(tmpDir, "http.conf")
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(Options{AccessLogJSON: "/var/log/nginx/access.json", RequestID: tt.requestID})
+
+			if _, err := gen.Generate(containers); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			content, err := os.ReadFile(httpPath)
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("config missing %q:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateHTTPSBoth(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{ACMEChallengeAddr: "127.0.0.1:8402"})
+
+	containers := []docker.ContainerInfo{
+		{Name: "camera", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"cam.example.com"}, ContainerPort: 80, HTTPS: true, PlainHTTP: true,
+			Aliases: []string{"camera.example.com"},
+		}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"listen 443 ssl;\n    listen 80;\n    server_name cam.example.com;",
+		"return 301 $scheme://cam.example.com$request_uri;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "return 301 https://") {
+		t.Errorf("https=both must not redirect to HTTPS:\n%s", text)
+	}
+	// the port 80 listeners answer challenges, no separate challenge server
+	if strings.Contains(text, "ACME HTTP-01 challenges for HTTPS-only hosts") {
+		t.Errorf("unexpected challenge-only server:\n%s", text)
+	}
+	if n := strings.Count(text, "location /.well-known/acme-challenge/"); n != 2 {
+		t.Errorf("challenge locations = %d, want 2:\n%s", n, text)
+	}
+}
+
+// fakeCerts serves issued certificates from a map of hostnames
+type fakeCerts map[string]bool
+
+func (f fakeCerts) CertFiles(hostname string) (cert, key string, ok bool) {
+	if !f[hostname] {
+		return "", "", false
+	}
+	return "/certs/" + hostname + ".crt", "/certs/" + hostname + ".key", true
+}
+
+func TestGenerateACMEPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{ACMEChallengeAddr: "127.0.0.1:8402", Certificates: fakeCerts{"shop.example.com": true}})
+
+	optOut := false
+	containers := []docker.ContainerInfo{
+		{Name: "shop", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"shop.example.com"}, ContainerPort: 80, HTTPS: true,
+		}},
+		{Name: "intranet", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"intranet.example.com"}, ContainerPort: 80, HTTPS: true, ACME: &optOut,
+		}},
+		{Name: "plain", IP: "172.17.0.4", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"plain.example.com"}, ContainerPort: 80, ACME: &optOut,
+		}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"ssl_certificate /certs/shop.example.com.crt;",
+		"ssl_certificate_key /certs/shop.example.com.key;",
+		"server_name shop.example.com;\n\n    location /.well-known/acme-challenge/",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	// only the challenge server of shop.example.com routes challenges
+	if n := strings.Count(text, "location /.well-known/acme-challenge/"); n != 1 {
+		t.Errorf("challenge locations = %d, want 1:\n%s", n, text)
+	}
+
+	if got := ACMEHostnames(containers); len(got) != 1 || got[0] != "shop.example.com" {
+		t.Errorf("ACMEHostnames() = %v, want [shop.example.com]", got)
+	}
+}
+
+func TestGeneratePolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	policy, err := docker.ParsePolicy("*.corp.example.com", "1024-65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.SetOptions(Options{Policy: policy})
+
+	report, err := gen.Generate([]docker.ContainerInfo{
+		{Name: "web", IP: "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.corp.example.com", "web.example.com"}, ContainerPort: 80}},
+		{Name: "ssh", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 22, ContainerPort: 22}}},
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(report.Denied) != 2 || report.Denied[0].Route != "http:web.example.com" || report.Denied[1].Route != "tcp:22" {
+		t.Errorf("Denied = %+v, want web.example.com and port 22", report.Denied)
+	}
+	if report.Details()["denied"] != "2" {
+		t.Errorf("Details() = %v, want 2 denied", report.Details())
+	}
+	if http := readConfig(t, httpPath); !strings.Contains(http, "web.corp.example.com") || strings.Contains(http, "web.example.com;") {
+		t.Errorf("HTTP config should only route the corp hostname:\n%s", http)
+	}
+	if len(report.Routes.Containers) != 1 {
+		t.Errorf("routes = %+v, want only web", report.Routes.Containers)
+	}
+
+	// certificates are only ordered for the hostnames the policy admits
+	report, err = gen.Generate([]docker.ContainerInfo{{Name: "shop", IP: "172.17.0.4",
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.corp.example.com", "shop.example.com"}, ContainerPort: 80, HTTPS: true}}})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(report.ACMEHostnames) != 1 || report.ACMEHostnames[0] != "shop.corp.example.com" {
+		t.Errorf("ACMEHostnames = %v, want only the allowed hostname", report.ACMEHostnames)
+	}
+}
+
+func TestGenerateHTTPPreset(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if _, err := gen.Generate([]docker.ContainerInfo{
+		{Name: "ha", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"ha.example.com"},
+			ContainerPort: 8123, ReadTimeout: "1h", BufferingOff: true, Preset: "home-assistant v1"}},
+		{Name: "web", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+	}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{"# Preset: home-assistant v1", "proxy_read_timeout 1h;", "proxy_send_timeout 1h;", "proxy_read_timeout 60s;"} {
+		if !strings.Contains(http, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, http)
+		}
+	}
+	if strings.Count(http, "# Preset:") != 1 {
+		t.Errorf("only the ha route has a preset:\n%s", http)
+	}
+}
+
+func TestGenerateInternalOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "nas", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"nas.example.com"},
+			ContainerPort: 5000, InternalOnly: true}},
+		{Name: "admin", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"admin.example.com"},
+			ContainerPort: 8080, AllowFrom: []string{"203.0.113.7"}}},
+		{Name: "web", IP: "172.17.0.4", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+	}
+
+	internal, err := NewInternalNetworks("192.168.0.0/16,::1", 444)
+	if err != nil {
+		t.Fatalf("NewInternalNetworks() error = %v", err)
+	}
+	gen.SetOptions(Options{Internal: internal})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{"192.168.0.0/16 0;", "::1 0;", "203.0.113.7 0;", "return 444;"} {
+		if !strings.Contains(http, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, http)
+		}
+	}
+	if strings.Count(http, "geo $proxy_client_denied_") != 2 {
+		t.Errorf("only the nas and admin routes restrict clients:\n%s", http)
+	}
+	// the check is at server level, before any location such as the ACME challenges or /oauth2/
+	for _, hostname := range []string{"nas.example.com", "admin.example.com"} {
+		server := http[strings.Index(http, "server_name "+hostname):]
+		if deny, location := strings.Index(server, "if ($proxy_client_denied_"), strings.Index(server, "\n    location "); deny < 0 || deny > location {
+			t.Errorf("%s restricts clients only in some locations:\n%s", hostname, http)
+		}
+	}
+
+	// ACME challenges stay reachable for the CA
+	gen.SetOptions(Options{Internal: internal, ACMEChallengeAddr: "127.0.0.1:8099"})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if http = readConfig(t, httpPath); strings.Count(http, "if ($uri ~ ^/\\.well-known/acme-challenge/) {\n        break;") != 2 {
+		t.Errorf("restricted routes should let ACME challenges through:\n%s", http)
+	}
+
+	// no internal networks never serves the internal route to everyone
+	gen.SetOptions(Options{})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http = readConfig(t, httpPath)
+	if strings.Contains(http, "server_name nas.example.com") || !strings.Contains(http, "internal CIDRs are configured") ||
+		!strings.Contains(http, "return 403;") {
+		t.Errorf("nas should be skipped and admin denied with 403:\n%s", http)
+	}
+}
+
+func TestGenerateOwner(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath, httpPath := filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	owner := docker.Owner{Project: "shop", Service: "web", Image: "ghcr.io/acme/shop:1.4", LabelSource: "compose:/srv/shop/compose.yml"}
+	if _, err := gen.Generate([]docker.ContainerInfo{{Name: "shop-web-1", ID: "a1", IP: "172.17.0.2", Owner: owner,
+		Mappings:    []docker.PortMapping{{ProxyPort: 2222, ContainerPort: 22, Protocol: docker.TCP}},
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, Aliases: []string{"www.shop.example.com"}, ContainerPort: 80},
+	}}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := "# Owner: project=shop service=web image=ghcr.io/acme/shop:1.4 labels=compose:/srv/shop/compose.yml"
+	if stream := readConfig(t, streamPath); !strings.Contains(stream, "# Container: shop-web-1 (a1)\n"+want) {
+		t.Errorf("stream config missing %q:\n%s", want, stream)
+	}
+	if http := readConfig(t, httpPath); strings.Count(http, want) != 2 {
+		t.Errorf("HTTP config should name the owner of the server and the alias redirect:\n%s", http)
+	}
+}
+
+func TestGenerateAudiences(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	internal, err := NewInternalNetworks("192.168.0.0/16", 403)
+	if err != nil {
+		t.Fatalf("NewInternalNetworks() error = %v", err)
+	}
+	gen.SetOptions(Options{Internal: internal})
+	if _, err := gen.Generate([]docker.ContainerInfo{{Name: "nas", IP: "172.17.0.2",
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"nas.example.com"}, ContainerPort: 5000,
+			Audience: docker.AudienceExternal, OIDC: &docker.OIDC{Provider: docker.OIDCOAuth2Proxy, AuthURL: "http://oauth2-proxy:4180"}},
+		HTTPRoutes: []docker.HTTPMapping{{Hostnames: []string{"nas.lan"}, ContainerPort: 5000,
+			Audience: docker.AudienceInternal, InternalOnly: true}},
+	}}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{"# Audience: external", "# Audience: internal", "server_name nas.example.com;", "server_name nas.lan;"} {
+		if !strings.Contains(http, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, http)
+		}
+	}
+	if strings.Count(http, "geo $proxy_client_denied_") != 1 || strings.Count(http, "auth_request ") != 1 {
+		t.Errorf("only the internal route restricts clients and only the external one authenticates:\n%s", http)
+	}
+}
+
+func TestGenerateHealthCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "api", IP: "172.17.0.2", Service: "app_api", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 8080,
+			HealthCheck: &docker.HealthCheck{Path: "/healthz", Interval: 5 * time.Second, Timeout: time.Second, Fails: 3}}},
+		{Name: "api-2", IP: "172.17.0.3", Service: "app_api", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 8080,
+			HealthCheck: &docker.HealthCheck{Path: "/healthz", Interval: 5 * time.Second, Timeout: time.Second, Fails: 3}}},
+	}
+
+	gen.SetOptions(Options{Capabilities: &Capabilities{UpstreamCheck: true}})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{
+		"check interval=5000 rise=2 fall=3 timeout=1000 type=http;",
+		`check_http_send "GET /healthz HTTP/1.0\r\nHost: api.example.com\r\nConnection: close\r\n\r\n";`,
+		"server 172.17.0.3:8080; # api-2",
+	} {
+		if !strings.Contains(http, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, http)
+		}
+	}
+
+	// without the module the servers are marked down by failed requests
+	gen.SetOptions(Options{Capabilities: &Capabilities{}})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http = readConfig(t, httpPath)
+	if strings.Contains(http, "check ") || !strings.Contains(http, "server 172.17.0.2:8080 max_fails=3 fail_timeout=15s;") ||
+		!strings.Contains(http, "server 172.17.0.3:8080 max_fails=3 fail_timeout=15s; # api-2") {
+		t.Errorf("HTTP config should fall back to passive checks:\n%s", http)
+	}
+}
+
+func TestGeneratePassVars(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	passVars := []docker.PassVar{{Header: "X-Client-DN", Variable: "$ssl_client_s_dn"},
+		{Header: "X-Country", Variable: "$proxy_geoip_country_code"}, {Header: "X-Trace", Variable: "$proxy_request_id"}}
+	if _, err := gen.Generate([]docker.ContainerInfo{
+		{Name: "api", ID: "a1", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"},
+			ContainerPort: 80, PassVars: passVars}},
+		{Name: "rpc", ID: "b2", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"rpc.example.com"},
+			ContainerPort: 50051, GRPC: true, PassVars: passVars}},
+	}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{"proxy_set_header X-Client-DN $ssl_client_s_dn;", "grpc_set_header X-Client-DN $ssl_client_s_dn;",
+		"proxy_set_header X-Trace $proxy_request_id;", "map $http_x_request_id $proxy_request_id {"} {
+		if strings.Count(http, want) != 1 {
+			t.Errorf("HTTP config should contain %q once:\n%s", want, http)
+		}
+	}
+	if strings.Contains(http, "X-Country") {
+		t.Errorf("the country code is undefined without a GeoIP database:\n%s", http)
+	}
+}
+
+func TestGenerateMirror(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if _, err := gen.Generate([]docker.ContainerInfo{
+		{Name: "shop", ID: "a1", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"},
+			ContainerPort: 80, Mirror: "staging.example.com", MirrorPercent: 10}},
+		{Name: "api", ID: "b2", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"},
+			ContainerPort: 80, Mirror: "shop-staging:8081", MirrorPercent: 100}},
+		{Name: "shop-staging", ID: "c3", IP: "172.17.0.4", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"staging.example.com"},
+			ContainerPort: 3000}},
+		{Name: "blog", ID: "d4", IP: "172.17.0.5", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"},
+			ContainerPort: 80, Mirror: "unknown", MirrorPercent: 100}},
+	}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	http := readConfig(t, httpPath)
+	for _, want := range []string{
+		"split_clients \"${request_id}\" $proxy_mirror_http_shop_example_com_951623a2 {\n    10% 1;",
+		"proxy_pass http://172.17.0.4:3000$request_uri;\n        proxy_set_header Host staging.example.com;",
+		"proxy_pass http://172.17.0.4:8081$request_uri;\n        proxy_set_header Host $host;",
+		"mirror /_proxy_mirror;",
+	} {
+		if !strings.Contains(http, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, http)
+		}
+	}
+	if strings.Count(http, "mirror /_proxy_mirror;") != 2 || strings.Count(http, "split_clients") != 1 {
+		t.Errorf("shop and api are mirrored, only shop samples, blog's target is unknown:\n%s", http)
+	}
+}
+
+func TestGenerateIPv6Upstreams(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath, httpPath := filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	mapping := docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 8080, UpstreamHost: docker.UpstreamHostUpstream}
+	replica := mapping
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "fd00::2", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP}}},
+		{Name: "shop-1", IP: "fd00::3", Service: "shop/web", HTTPMapping: &mapping},
+		{Name: "shop-2", IP: "172.17.0.4", Service: "shop/web", HTTPMapping: &replica},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if text := readConfig(t, streamPath); !strings.Contains(text, "[fd00::2]:5432") {
+		t.Errorf("stream config should bracket the IPv6 upstream:\n%s", text)
+	}
+	text := readConfig(t, httpPath)
+	for _, want := range []string{"[fd00::3]:8080", "172.17.0.4:8080", "proxy_set_header Host [fd00::3]:8080;"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config should have %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "fd00::3:8080") {
+		t.Errorf("HTTP config should not have an unbracketed IPv6 upstream:\n%s", text)
+	}
+}
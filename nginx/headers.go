@@ -0,0 +1,34 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// headerBufferSizeRe matches client_header_buffer_size values, e.g. 4k
+	headerBufferSizeRe = regexp.MustCompile(`^[1-9][0-9]*[km]?$`)
+	// largeHeaderBuffersRe matches large_client_header_buffers values, e.g. 8 32k
+	largeHeaderBuffersRe = regexp.MustCompile(`^[1-9][0-9]{0,3} [1-9][0-9]*[km]?$`)
+)
+
+// HeaderBuffers holds global request header buffer sizes of the HTTP servers
+// The zero value leaves nginx's defaults (1k and 4 8k)
+type HeaderBuffers struct {
+	Size  string // client_header_buffer_size, e.g. 4k
+	Large string // large_client_header_buffers for long request lines and big cookies, e.g. 8 32k
+}
+
+// NewHeaderBuffers validates the header buffer sizes, empty values are left out
+func NewHeaderBuffers(size, large string) (HeaderBuffers, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	if size != "" && !headerBufferSizeRe.MatchString(size) {
+		return HeaderBuffers{}, fmt.Errorf("invalid client header buffer size %q, expected a size like 4k", size)
+	}
+	large = strings.ToLower(strings.Join(strings.Fields(large), " "))
+	if large != "" && !largeHeaderBuffersRe.MatchString(large) {
+		return HeaderBuffers{}, fmt.Errorf("invalid large client header buffers %q, expected a count and size like 8 32k", large)
+	}
+	return HeaderBuffers{Size: size, Large: large}, nil
+}
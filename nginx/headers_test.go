@@ -0,0 +1,84 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewHeaderBuffers(t *testing.T) {
+	tests := []struct {
+		size, large string
+		wantErr     bool
+	}{
+		{size: "4k", large: "8 32k"},
+		{large: " 4   16K "}, // normalized to 4 16k
+		{},
+		{size: "4kb", wantErr: true},
+		{size: "4k;", wantErr: true},
+		{large: "32k", wantErr: true},
+		{large: "8 32k; include /etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewHeaderBuffers(tt.size, tt.large)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewHeaderBuffers(%q, %q) error = %v, wantErr %t", tt.size, tt.large, err, tt.wantErr)
+		}
+		if err == nil && tt.large != "" && got.Large != strings.ToLower(strings.Join(strings.Fields(tt.large), " ")) {
+			t.Errorf("Large = %q, want normalized %q", got.Large, tt.large)
+		}
+	}
+}
+
+func TestGenerateHeaderBuffers(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	buffers, err := NewHeaderBuffers("4k", "8 16k")
+	if err != nil {
+		t.Fatalf("NewHeaderBuffers() error = %v", err)
+	}
+	gen.SetOptions(Options{HeaderBuffers: buffers})
+
+	containers := []docker.ContainerInfo{
+		{
+			Name:        "grafana",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"grafana.example.com"}, ContainerPort: 3000, HeaderBuffers: "8 32k"},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"\nclient_header_buffer_size 4k;\nlarge_client_header_buffers 8 16k;\n",
+		"\n    server_name grafana.example.com;",
+		"\n    large_client_header_buffers 8 32k;\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "large_client_header_buffers") != 2 {
+		t.Errorf("only grafana.example.com should override the global buffers:\n%s", text)
+	}
+}
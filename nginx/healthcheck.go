@@ -0,0 +1,60 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// UpstreamCheck is the check directive of the upstream check module
+type UpstreamCheck struct {
+	IntervalMS int
+	TimeoutMS  int
+	Fall       int    // consecutive failures marking a server down
+	Type       string // http, ssl_hello for HTTPS backends or tcp for gRPC
+	Send       string // check_http_send request of http checks
+}
+
+// healthCheck returns the active check of a route's upstream, or the passive max_fails and
+// fail_timeout server parameters when nginx lacks the upstream check module
+// Remote targets are not probed and get passive checks, an unknown check directive would fail the reload
+func (g *Generator) healthCheck(containerName string, mapping *docker.HTTPMapping, hostname, upstreamHost string) (*UpstreamCheck, string) {
+	hc := mapping.HealthCheck
+	if caps := g.opts.Capabilities; caps == nil || !caps.UpstreamCheck || mapping.Socket != "" {
+		if caps != nil && !caps.UpstreamCheck {
+			g.log.Logf("WARN [Generator] container=%s healthcheck set but nginx lacks the upstream check module, using passive checks", containerName)
+		}
+		// fails failed requests within fails check intervals mark a server down for as long
+		return nil, fmt.Sprintf(" max_fails=%d fail_timeout=%s", hc.Fails, nginxDuration(hc.Interval*time.Duration(hc.Fails)))
+	}
+
+	check := &UpstreamCheck{
+		IntervalMS: int(hc.Interval.Milliseconds()),
+		TimeoutMS:  int(hc.Timeout.Milliseconds()),
+		Fall:       hc.Fails,
+	}
+	switch {
+	case mapping.BackendHTTPS:
+		check.Type = "ssl_hello"
+	case mapping.GRPC:
+		check.Type = "tcp"
+	default:
+		host := hostname
+		if upstreamHost != "" && !strings.HasPrefix(upstreamHost, "$") {
+			host = upstreamHost
+		}
+		check.Type = "http"
+		check.Send = fmt.Sprintf(`GET %s HTTP/1.0\r\nHost: %s\r\nConnection: close\r\n\r\n`, hc.Path, host)
+	}
+	return check, ""
+}
+
+// nginxDuration formats a duration in nginx time units, e.g. 15s or 1500ms
+func nginxDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
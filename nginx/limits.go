@@ -0,0 +1,153 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrLimitExceeded is returned for generations beyond Options.Limits
+var ErrLimitExceeded = errors.New("config limit exceeded")
+
+// default Limits, far above what a single host routes on purpose
+const (
+	DefaultMaxRoutes          = 10000
+	DefaultMaxUpstreamServers = 256
+	DefaultMaxConfigSize      = "64m"
+)
+
+// limitWarnShare is the share of a limit from which every generation logs a warning
+const limitWarnShare = 0.8
+
+// configSizeRe matches config sizes, e.g. 512k, 64m or 1g
+var configSizeRe = regexp.MustCompile(`^([0-9]{1,7})([kmg]?)$`)
+
+// Limits stop generations with pathological label sets, e.g. a generated port list with
+// thousands of entries, before nginx has to load them; 0 disables a limit
+type Limits struct {
+	Routes          int // stream ports, SSH aliases, HTTP servers and alias redirects together
+	UpstreamServers int // servers of one upstream block, a container and its pooled replicas
+	ConfigSize      int // bytes of one rendered config
+}
+
+// NewLimits validates the limits, maxConfigSize is a size like 64m, 0 or off
+func NewLimits(maxRoutes, maxUpstreamServers int, maxConfigSize string) (Limits, error) {
+	if maxRoutes < 0 || maxUpstreamServers < 0 {
+		return Limits{}, fmt.Errorf("invalid limits routes=%d upstream_servers=%d, expected 0 or more", maxRoutes, maxUpstreamServers)
+	}
+	limits := Limits{Routes: maxRoutes, UpstreamServers: maxUpstreamServers}
+
+	s := strings.ToLower(strings.TrimSpace(maxConfigSize))
+	if s == "" || s == "off" {
+		return limits, nil
+	}
+	match := configSizeRe.FindStringSubmatch(s)
+	if match == nil {
+		return Limits{}, fmt.Errorf("invalid config size limit %q, expected a size like 64m or off", maxConfigSize)
+	}
+	size, err := strconv.Atoi(match[1])
+	if err != nil {
+		return Limits{}, fmt.Errorf("invalid config size limit %q: %w", maxConfigSize, err)
+	}
+	switch match[2] {
+	case "k":
+		size <<= 10
+	case "m":
+		size <<= 20
+	case "g":
+		size <<= 30
+	}
+	if size > 1<<30 {
+		return Limits{}, fmt.Errorf("invalid config size limit %q, expected at most 1g", maxConfigSize)
+	}
+	limits.ConfigSize = size
+	return limits, nil
+}
+
+// Usage is how much of the Limits the last generation used, also when it exceeded them
+type Usage struct {
+	Routes          int
+	UpstreamServers int // servers of the largest upstream block
+	ConfigSize      int // bytes of the largest rendered config, 0 when the routes already exceeded a limit
+	Limits          Limits
+}
+
+// Usage returns what the last generation used of the limits
+func (g *Generator) Usage() Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.usage
+}
+
+// setUsage records the usage of a generation
+func (g *Generator) setUsage(usage Usage) {
+	g.mu.Lock()
+	g.usage = usage
+	g.mu.Unlock()
+}
+
+// checkRouteLimits counts the routes and upstream servers of the template data, before
+// the templates are executed
+func (g *Generator) checkRouteLimits(streamData StreamData, httpData HTTPData) (Usage, error) {
+	usage := Usage{Routes: len(streamData.SSHRoutes) + len(httpData.HTTPServers) + len(httpData.Redirects), Limits: g.opts.Limits}
+	largest := ""
+	for _, container := range streamData.Containers {
+		for _, group := range []struct {
+			protocol string
+			mappings []StreamMapping
+		}{{"TCP", container.TCPMappings}, {"UDP", container.UDPMappings}} {
+			usage.Routes += len(group.mappings)
+			for _, mapping := range group.mappings {
+				if servers := 1 + len(mapping.Replicas); servers > usage.UpstreamServers {
+					usage.UpstreamServers, largest = servers, fmt.Sprintf("%s port %d", group.protocol, mapping.ProxyPort)
+				}
+			}
+		}
+	}
+	for _, server := range httpData.HTTPServers {
+		if servers := 1 + len(server.Replicas); server.StaticRoot == "" && servers > usage.UpstreamServers {
+			usage.UpstreamServers, largest = servers, server.Hostname
+		}
+	}
+	g.setUsage(usage)
+
+	limits := g.opts.Limits
+	if err := g.checkLimit("routes", usage.Routes, limits.Routes); err != nil {
+		return usage, err
+	}
+	if err := g.checkLimit("servers in the upstream of "+largest, usage.UpstreamServers, limits.UpstreamServers); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// checkSizeLimit checks the size of the rendered configs
+func (g *Generator) checkSizeLimit(usage Usage, configs renderedConfigs) error {
+	largest := ""
+	sizes := map[string]int{g.streamConfigPath: len(configs.stream), g.httpConfigPath: len(configs.http)}
+	for _, ns := range configs.namespaces {
+		sizes[ns.streamPath], sizes[ns.httpPath] = len(ns.stream), len(ns.http)
+	}
+	for path, size := range sizes {
+		if size > usage.ConfigSize || (size == usage.ConfigSize && path < largest) {
+			usage.ConfigSize, largest = size, path
+		}
+	}
+	g.setUsage(usage)
+	return g.checkLimit("bytes in "+largest, usage.ConfigSize, g.opts.Limits.ConfigSize)
+}
+
+// checkLimit fails when value exceeds limit and warns when it gets close, 0 disables the limit
+func (g *Generator) checkLimit(what string, value, limit int) error {
+	switch {
+	case limit <= 0:
+		return nil
+	case value > limit:
+		return fmt.Errorf("%w: %d %s, limit is %d", ErrLimitExceeded, value, what, limit)
+	case float64(value) >= limitWarnShare*float64(limit):
+		g.log.Logf("WARN [Generator] close to config limit: %d %s, limit is %d", value, what, limit)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewLimits(t *testing.T) {
+	tests := []struct {
+		routes, servers int
+		size            string
+		want            Limits
+		wantErr         bool
+	}{
+		{routes: 10000, servers: 256, size: "64m", want: Limits{Routes: 10000, UpstreamServers: 256, ConfigSize: 64 << 20}},
+		{size: " 512K ", want: Limits{ConfigSize: 512 << 10}},
+		{size: "1g", want: Limits{ConfigSize: 1 << 30}},
+		{size: "4096", want: Limits{ConfigSize: 4096}},
+		{size: "off"},
+		{},
+		{size: "2g", wantErr: true},
+		{size: "64 mb", wantErr: true},
+		{routes: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewLimits(tt.routes, tt.servers, tt.size)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NewLimits(%d, %d, %q) = %+v, %v, want %+v (error %t)", tt.routes, tt.servers, tt.size, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateConfigLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	// a port list typo claiming 100 ports, and three replicas of one service
+	db := docker.ContainerInfo{Name: "db", IP: "172.17.0.2"}
+	for port := 20000; port < 20100; port++ {
+		db.Mappings = append(db.Mappings, docker.PortMapping{ProxyPort: port, ContainerPort: 5432, Protocol: docker.TCP})
+	}
+	containers := []docker.ContainerInfo{db}
+	for i := range 3 {
+		containers = append(containers, docker.ContainerInfo{
+			Name: fmt.Sprintf("web-%d", i), IP: fmt.Sprintf("172.17.0.%d", 10+i), Service: "shop/web",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 8080},
+		})
+	}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string // error, empty for none
+	}{
+		{name: "disabled", limits: Limits{}},
+		{name: "close to the limits", limits: Limits{Routes: 110, UpstreamServers: 3, ConfigSize: 1 << 20}},
+		{name: "routes", limits: Limits{Routes: 100}, want: "config limit exceeded: 101 routes, limit is 100"},
+		{
+			name:   "upstream servers",
+			limits: Limits{UpstreamServers: 2},
+			want:   "config limit exceeded: 3 servers in the upstream of shop.example.com, limit is 2",
+		},
+		{name: "config size", limits: Limits{ConfigSize: 1024}, want: "bytes in " + filepath.Join(tmpDir, "stream.conf") + ", limit is 1024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen.SetOptions(Options{Limits: tt.limits})
+			_, _, err := gen.Render(containers)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Render() error = %v", err)
+				}
+			} else if !errors.Is(err, ErrLimitExceeded) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected ErrLimitExceeded with %q, got %v", tt.want, err)
+			}
+
+			usage := gen.Usage()
+			if usage.Routes != 101 || usage.UpstreamServers != 3 || usage.Limits != tt.limits {
+				t.Errorf("expected 101 routes and 3 upstream servers within %+v, got %+v", tt.limits, usage)
+			}
+			if rendered := tt.want == "" || tt.name == "config size"; rendered != (usage.ConfigSize > 0) {
+				t.Errorf("expected the config size only once rendered, got %d", usage.ConfigSize)
+			}
+		})
+	}
+}
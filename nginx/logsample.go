@@ -0,0 +1,16 @@
+package nginx
+
+import "strings"
+
+// LogSample is a sampling rate of the access log, rendered as a split_clients block and a
+// map of the response status to the access_log if= condition
+type LogSample struct {
+	Name    string // variable suffix, e.g. 0_5 for $proxy_log_0_5
+	Percent string // successful requests logged, e.g. 0.5%; 0% logs errors only
+}
+
+// newLogSample names the variables of a sampling rate parsed by docker.ParseLogSample
+func newLogSample(percent string) LogSample {
+	name := strings.NewReplacer(".", "_", "%", "").Replace(percent)
+	return LogSample{Name: name, Percent: percent}
+}
@@ -0,0 +1,56 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestGenerateLogSampling(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{AccessLogSample: "1%", AccessLogJSON: "/var/log/nginx/access.json"})
+
+	containers := []docker.ContainerInfo{
+		{Name: "api", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"api.example.com"}, ContainerPort: 80}},
+		{Name: "cdn", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"cdn.example.com"}, ContainerPort: 80, LogSample: "0.5%",
+		}},
+		{Name: "shop", IP: "172.17.0.4", HTTPMapping: &docker.HTTPMapping{
+			Hostnames: []string{"shop.example.com"}, ContainerPort: 80, LogSample: "100%",
+		}},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"split_clients $request_id $proxy_log_sampled_1 {\n    1% 1;\n    *    0;\n}",
+		"map $status $proxy_log_1 {\n    ~^[45]  1;\n    default $proxy_log_sampled_1;\n}",
+		"split_clients $request_id $proxy_log_sampled_0_5 {",
+		"server_name api.example.com;\n    access_log /var/log/nginx/access.log combined if=$proxy_log_1;\n" +
+			"    access_log /var/log/nginx/access.json proxy_json;",
+		"access_log /var/log/nginx/access.log combined if=$proxy_log_0_5;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "server_name shop.example.com;\n    access_log") {
+		t.Errorf("shop.example.com logs every request, it should keep the default access log:\n%s", text)
+	}
+}
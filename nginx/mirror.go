@@ -0,0 +1,57 @@
+package nginx
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// Mirror is where copies of a route's requests are sent, see proxy.http.mirror
+type Mirror struct {
+	Target  string // the label value, e.g. staging.example.com or app-staging:8080
+	Address string // host:port or unix:/path: of the backend, used in proxy_pass
+	Host    string // Host header of the copies, empty keeps $host
+	HTTPS   bool   // the backend speaks TLS
+	Percent int    // share of requests copied, 100 copies all
+}
+
+// mirrorTarget resolves the mirror of a route to a routed hostname or a container name,
+// nil if it is unknown or the route's own container; the route itself is served either way
+func (g *Generator) mirrorTarget(containers []docker.ContainerInfo, self docker.ContainerInfo, mapping *docker.HTTPMapping) *Mirror {
+	name, portStr, hasPort := strings.Cut(mapping.Mirror, ":")
+	port, _ := strconv.Atoi(portStr) //nolint:errcheck // validated when parsing the labels
+
+	for _, container := range containers {
+		for _, route := range container.AllHTTPMappings() {
+			isHost := slices.ContainsFunc(route.Hostnames, func(h string) bool { return strings.EqualFold(h, name) })
+			if !isHost && container.Name != name {
+				continue
+			}
+			if container.ID == self.ID {
+				g.log.Logf("WARN [Generator] container=%s mirror %s is the route's own container, not mirrored", self.Name, mapping.Mirror)
+				return nil
+			}
+			if route.StaticRoot != "" {
+				continue
+			}
+
+			mirror := &Mirror{Target: mapping.Mirror, HTTPS: route.BackendHTTPS, Percent: mapping.MirrorPercent}
+			hostname := route.Primary()
+			if isHost {
+				hostname = strings.ToLower(name)
+				mirror.Host = hostname
+			}
+			mirror.Address = httpAddress(container.IP, &route, hostname)
+			if route.Socket != "" {
+				mirror.Address += ":"
+			} else if hasPort {
+				mirror.Address = serverAddress(container.IP, port)
+			}
+			return mirror
+		}
+	}
+	g.log.Logf("WARN [Generator] container=%s mirror %s is not a routed hostname or container, not mirrored", self.Name, mapping.Mirror)
+	return nil
+}
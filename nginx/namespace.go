@@ -0,0 +1,176 @@
+package nginx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// namespaceConfig holds the stream and HTTP configs of one proxy.namespace
+type namespaceConfig struct {
+	name       string
+	streamPath string
+	httpPath   string
+	streamData StreamData
+	httpData   HTTPData
+	stream     []byte // rendered configs, nil when err is set
+	http       []byte
+	err        error // conflict within the namespace with IsolateNamespaces, its previous configs stay
+}
+
+// NamespacePath returns the config path of a namespace next to a main config path
+// Example: /etc/nginx/conf.d/proxy.conf, team-a -> /etc/nginx/conf.d/proxy-team-a.conf
+func NamespacePath(path, namespace string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + namespace + ext
+}
+
+// splitNamespaces moves the routes of namespaced containers out of the main template data,
+// returning one config per namespace sorted by name
+// Namespace configs copy the template data of the main config without its routes; the
+// templates write shared blocks (log formats, maps, TLS sessions) in the main config only
+func (g *Generator) splitNamespaces(streamData *StreamData, httpData *HTTPData) []namespaceConfig {
+	byName := make(map[string]*namespaceConfig)
+	get := func(name string) *namespaceConfig {
+		if ns, ok := byName[name]; ok {
+			return ns
+		}
+		ns := &namespaceConfig{
+			name:       name,
+			streamPath: NamespacePath(g.streamConfigPath, name),
+			httpPath:   NamespacePath(g.httpConfigPath, name),
+			streamData: *streamData,
+			httpData:   *httpData,
+		}
+		ns.streamData.Namespace, ns.httpData.Namespace = name, name
+		ns.streamData.Containers, ns.streamData.Skipped, ns.streamData.SSHRoutes, ns.streamData.Includes = nil, nil, nil, nil
+		ns.httpData.HTTPServers, ns.httpData.Redirects, ns.httpData.Skipped, ns.httpData.Includes = nil, nil, nil, nil
+		byName[name] = ns
+		return ns
+	}
+
+	containers := make([]StreamContainer, 0, len(streamData.Containers))
+	for _, ctr := range streamData.Containers {
+		if ctr.Namespace == "" {
+			containers = append(containers, ctr)
+			continue
+		}
+		ns := get(ctr.Namespace)
+		ns.streamData.Containers = append(ns.streamData.Containers, ctr)
+	}
+
+	servers := make([]HTTPServer, 0, len(httpData.HTTPServers))
+	for _, server := range httpData.HTTPServers {
+		if server.Namespace == "" {
+			servers = append(servers, server)
+			continue
+		}
+		ns := get(server.Namespace)
+		ns.httpData.HTTPServers = append(ns.httpData.HTTPServers, server)
+	}
+
+	var redirects []HTTPRedirect
+	for _, redirect := range httpData.Redirects {
+		if redirect.Namespace == "" {
+			redirects = append(redirects, redirect)
+			continue
+		}
+		ns := get(redirect.Namespace)
+		ns.httpData.Redirects = append(ns.httpData.Redirects, redirect)
+	}
+
+	if len(byName) == 0 {
+		return nil
+	}
+
+	streamData.Containers = containers
+	httpData.HTTPServers = servers
+	httpData.Redirects = redirects
+	httpData.ACMEOnlyHostnames = acmeOnlyHostnames(*httpData)
+
+	namespaces := make([]namespaceConfig, 0, len(byName))
+	for _, ns := range byName {
+		ns.httpData.ACMEOnlyHostnames = acmeOnlyHostnames(ns.httpData)
+		namespaces = append(namespaces, *ns)
+	}
+	slices.SortFunc(namespaces, func(a, b namespaceConfig) int { return strings.Compare(a.name, b.name) })
+	return namespaces
+}
+
+// validateNamespaces checks the main and namespace configs for conflicts
+// With IsolateNamespaces every namespace is checked on its own first, a conflict there is kept
+// in its err and the namespace is left out of the check across configs
+// Servers of hand-written configs are part of that check, listed first so conflicts name them first
+func (g *Generator) validateNamespaces(streamData StreamData, httpData HTTPData, namespaces []namespaceConfig,
+	extra []configServer) error {
+	all, allHTTP := StreamData{}, HTTPData{}
+	all.Containers, allHTTP.HTTPServers = configServerClaims(extra)
+	all.Containers = append(all.Containers, streamData.Containers...)
+	all.Containers = append(all.Containers, sshGatewayClaim(streamData)...)
+	allHTTP.HTTPServers = append(allHTTP.HTTPServers, httpData.HTTPServers...)
+	allHTTP.Redirects = slices.Clone(httpData.Redirects)
+	for i := range namespaces {
+		ns := &namespaces[i]
+		if g.opts.IsolateNamespaces {
+			if err := g.validateConflicts(ns.streamData, ns.httpData); err != nil {
+				g.log.Logf("ERROR [Generator] namespace conflict, keeping its previous configs namespace=%s error=%q",
+					ns.name, err)
+				ns.err = err
+				continue
+			}
+		}
+		all.Containers = append(all.Containers, ns.streamData.Containers...)
+		allHTTP.HTTPServers = append(allHTTP.HTTPServers, ns.httpData.HTTPServers...)
+		allHTTP.Redirects = append(allHTTP.Redirects, ns.httpData.Redirects...)
+	}
+	return g.validateConflicts(all, allHTTP)
+}
+
+// includeNamespaces lists the namespace configs in the main configs
+// A namespace that failed keeps its previous configs, they are included only if they exist
+func includeNamespaces(streamData *StreamData, httpData *HTTPData, namespaces []namespaceConfig) {
+	for _, ns := range namespaces {
+		if ns.err != nil && !fileExists(ns.streamPath) {
+			continue
+		}
+		streamData.Includes = append(streamData.Includes, ns.streamPath)
+		httpData.Includes = append(httpData.Includes, ns.httpPath)
+	}
+}
+
+// removeStaleNamespaces deletes generated namespace configs next to the main configs that are
+// not in keep, e.g. after the last container of a namespace stopped
+// Files without the generation header are never touched
+func (g *Generator) removeStaleNamespaces(keep []string) error {
+	for _, main := range []string{g.streamConfigPath, g.httpConfigPath} {
+		matches, err := filepath.Glob(NamespacePath(main, "*"))
+		if err != nil {
+			return err
+		}
+		for _, path := range matches {
+			if path == g.streamConfigPath || path == g.httpConfigPath || slices.Contains(keep, path) {
+				continue
+			}
+			// #nosec G304 -- path is next to the configured output paths
+			content, err := os.ReadFile(path)
+			if err != nil || !bytes.HasPrefix(content, []byte(headerPrefix)) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			if err := os.Remove(SignaturePath(path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			g.log.Logf("INFO [Generator] removed stale namespace config path=%s", path)
+		}
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
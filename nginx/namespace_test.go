@@ -0,0 +1,263 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNamespacePath(t *testing.T) {
+	tests := []struct {
+		path, namespace, want string
+	}{
+		{"/etc/nginx/conf.d/proxy.conf", "team-a", "/etc/nginx/conf.d/proxy-team-a.conf"},
+		{"/etc/nginx/stream.d/proxy.conf", "b", "/etc/nginx/stream.d/proxy-b.conf"},
+		{"http", "team-a", "http-team-a"},
+	}
+	for _, tt := range tests {
+		if got := NamespacePath(tt.path, tt.namespace); got != tt.want {
+			t.Errorf("NamespacePath(%q, %q) = %q, want %q", tt.path, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func namespacedContainers() []docker.ContainerInfo {
+	return []docker.ContainerInfo{
+		{
+			Name:        "web",
+			IP:          "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80},
+		},
+		{
+			Name:        "shop",
+			IP:          "172.17.0.3",
+			Namespace:   "team-a",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 8080},
+		},
+		{
+			Name:      "shop-db",
+			IP:        "172.17.0.4",
+			Namespace: "team-a",
+			Mappings:  []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP}},
+		},
+		{
+			Name:        "blog",
+			IP:          "172.17.0.5",
+			Namespace:   "team-b",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"blog.example.com"}, ContainerPort: 80},
+		},
+	}
+}
+
+func readConfig(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	return string(content)
+}
+
+func TestGenerateNamespaces(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{Syslog: "syslog:server=10.0.0.5:514", RequestID: true})
+
+	report, err := gen.Generate(namespacedContainers())
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(report.Namespaces) != 2 || report.Namespaces[0].Name != "team-a" || report.Namespaces[1].Name != "team-b" {
+		t.Fatalf("Namespaces = %+v, want team-a and team-b", report.Namespaces)
+	}
+	if details := report.Details(); details["namespaces"] != "2" || details["failed_namespaces"] != "" {
+		t.Errorf("Details() = %v, want 2 namespaces", details)
+	}
+
+	mainHTTP := readConfig(t, httpPath)
+	teamAHTTP := readConfig(t, NamespacePath(httpPath, "team-a"))
+	teamAStream := readConfig(t, NamespacePath(streamPath, "team-a"))
+	teamBHTTP := readConfig(t, NamespacePath(httpPath, "team-b"))
+
+	for _, want := range []string{
+		"server_name web.example.com;",
+		"include " + NamespacePath(httpPath, "team-a") + ";",
+		"include " + NamespacePath(httpPath, "team-b") + ";",
+		"access_log syslog:server=10.0.0.5:514,tag=nginx_access combined;",
+		"map $http_x_request_id $proxy_request_id {",
+	} {
+		if !strings.Contains(mainHTTP, want) {
+			t.Errorf("main HTTP config missing %q:\n%s", want, mainHTTP)
+		}
+	}
+	for _, unwanted := range []string{"shop.example.com", "blog.example.com"} {
+		if strings.Contains(mainHTTP, unwanted) {
+			t.Errorf("main HTTP config contains namespaced route %q", unwanted)
+		}
+	}
+	mainStream := readConfig(t, streamPath)
+	for _, ns := range []string{"team-a", "team-b"} {
+		if !strings.Contains(mainStream, "include "+NamespacePath(streamPath, ns)+";") {
+			t.Errorf("main stream config missing include of %s:\n%s", ns, mainStream)
+		}
+	}
+
+	if !strings.Contains(teamAHTTP, "# Namespace: team-a") || !strings.Contains(teamAHTTP, "server_name shop.example.com;") ||
+		!strings.Contains(teamAHTTP, "tag=nginx_access proxy_request_id;") {
+		t.Errorf("team-a HTTP config missing its route:\n%s", teamAHTTP)
+	}
+	// http-level blocks are defined once, in the main config
+	if strings.Contains(teamAHTTP, "tag=nginx_access combined;") || strings.Contains(teamAHTTP, "map $http_x_request_id") ||
+		strings.Contains(teamAHTTP, "blog.example.com") {
+		t.Errorf("team-a HTTP config has shared blocks or other namespaces:\n%s", teamAHTTP)
+	}
+	if !strings.Contains(teamAStream, "listen 5432;") || strings.Contains(teamAStream, "log_format proxy_stream") {
+		t.Errorf("team-a stream config:\n%s", teamAStream)
+	}
+	if !strings.Contains(teamBHTTP, "server_name blog.example.com;") {
+		t.Errorf("team-b HTTP config missing its route:\n%s", teamBHTTP)
+	}
+
+	// the last container of a namespace stopping removes its configs
+	report, err = gen.Generate(namespacedContainers()[:3])
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(report.Namespaces) != 1 || !report.Changed() {
+		t.Errorf("report = %+v, want team-a only and changed configs", report)
+	}
+	for _, path := range []string{NamespacePath(httpPath, "team-b"), NamespacePath(streamPath, "team-b")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("stale namespace config %s not removed, stat error = %v", path, err)
+		}
+	}
+	if strings.Contains(readConfig(t, httpPath), "team-b") {
+		t.Error("main HTTP config still includes team-b")
+	}
+}
+
+func TestGenerateNamespacesKeepsForeignFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	manual := NamespacePath(httpPath, "manual")
+	if err := os.WriteFile(manual, []byte("server {}\n"), 0o600); err != nil {
+		t.Fatalf("failed to write manual config: %v", err)
+	}
+	if _, err := gen.Generate(namespacedContainers()[:1]); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if _, err := os.Stat(manual); err != nil {
+		t.Errorf("config without the generation header was removed: %v", err)
+	}
+}
+
+func TestGenerateNamespaceConflicts(t *testing.T) {
+	conflicting := func(namespace string) docker.ContainerInfo {
+		return docker.ContainerInfo{
+			Name:        "shop-v2",
+			IP:          "172.17.0.6",
+			Namespace:   namespace,
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"shop.example.com"}, ContainerPort: 8080},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		isolate    bool
+		extra      docker.ContainerInfo
+		wantErr    bool
+		wantFailed string
+	}{
+		{name: "within namespace fails generation", extra: conflicting("team-a"), wantErr: true},
+		{name: "within namespace isolated", isolate: true, extra: conflicting("team-a"), wantFailed: "team-a"},
+		{name: "across namespaces fails generation", extra: conflicting("team-b"), wantErr: true},
+		{name: "across namespaces isolated still fails", isolate: true, extra: conflicting("team-b"), wantErr: true},
+		{name: "with main config isolated still fails", isolate: true, extra: conflicting(""), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			httpPath := filepath.Join(tmpDir, "http.conf")
+			gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+			gen.SetOptions(Options{IsolateNamespaces: tt.isolate})
+
+			// a first clean generation leaves configs to keep
+			if _, err := gen.Generate(namespacedContainers()); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			previous := readConfig(t, NamespacePath(httpPath, "team-a"))
+
+			report, err := gen.Generate(append(namespacedContainers(), tt.extra))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Generate() expected a conflict error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			if got := report.Details()["failed_namespaces"]; got != tt.wantFailed {
+				t.Errorf("failed_namespaces = %q, want %q", got, tt.wantFailed)
+			}
+			if got := readConfig(t, NamespacePath(httpPath, "team-a")); got != previous {
+				t.Errorf("failed namespace config rewritten:\n%s", got)
+			}
+			if !strings.Contains(readConfig(t, httpPath), "include "+NamespacePath(httpPath, "team-a")+";") {
+				t.Error("main HTTP config should keep including the previous team-a config")
+			}
+			if !strings.Contains(readConfig(t, NamespacePath(httpPath, "team-b")), "blog.example.com") {
+				t.Error("other namespaces should still be generated")
+			}
+		})
+	}
+}
+
+func TestSnapshotRestoreNamespaces(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if _, err := gen.Generate(namespacedContainers()[:3]); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	snap, err := gen.TakeSnapshot()
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if _, err := gen.Generate(namespacedContainers()); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if _, err := gen.RestoreSnapshot(snap); err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+
+	// team-b was generated after the snapshot
+	if _, err := os.Stat(NamespacePath(httpPath, "team-b")); !os.IsNotExist(err) {
+		t.Errorf("namespace config generated after the snapshot kept, stat error = %v", err)
+	}
+	if _, err := os.Stat(NamespacePath(httpPath, "team-a")); err != nil {
+		t.Errorf("namespace config of the snapshot removed: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package nginx
+
+import (
+	"os"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// Options holds global generation settings that apply to every route
+// The zero value generates the same configs as earlier versions
+type Options struct {
+	// ACMEChallengeAddr is the host:port of the ACME HTTP-01 responder
+	// When set, /.well-known/acme-challenge/ is proxied there on every port 80 server
+	ACMEChallengeAddr string
+
+	// SecretsDir holds files referenced by *.secret labels (htpasswd, TLS certs and keys)
+	// Defaults to /run/secrets, where Docker mounts secrets
+	SecretsDir string
+
+	// ConfigFileMode and ConfigOwner apply to the stream, HTTP and namespace configs and their
+	// signatures; 0 is DefaultConfigFileMode and nil keeps the owner of the proxy process
+	ConfigFileMode os.FileMode
+	ConfigOwner    *FileOwner
+
+	// Fsync flushes each written config and its rename to disk before the reload,
+	// so a crash or power loss never leaves a truncated config
+	Fsync bool
+
+	// SecretsFileMode and SecretsOwner apply to the secrets include holding upstream credentials,
+	// see SecretsPath; 0 is DefaultSecretsFileMode and nil keeps the owner of the proxy process
+	SecretsFileMode os.FileMode
+	SecretsOwner    *FileOwner
+
+	// RemoteDelivery is set when the configs are delivered to another nginx, which never gets
+	// the secrets include; upstream credentials then fail the generation
+	RemoteDelivery bool
+
+	// ExtraConfigDir holds hand-written *.conf files next to the generated ones; they are never written
+	// or removed, their listen and server_name directives are checked for conflicts with the labels
+	ExtraConfigDir string
+
+	// ConfigDumpCmd prints the whole nginx config, e.g. "nginx -T"; servers of hand-written files in
+	// its output are checked for conflicts like ExtraConfigDir, empty disables the check
+	ConfigDumpCmd string
+
+	// IsolateNamespaces checks conflicts within each proxy.namespace on its own: a conflict between
+	// two routes of one namespace keeps that namespace's previous configs and the rest is generated
+	// Conflicts across namespaces and with the main configs still fail the generation
+	IsolateNamespaces bool
+
+	// HeaderBuffers sets the request header buffers of all servers, see NewHeaderBuffers;
+	// proxy.http.header_buffers labels override the large buffers per host
+	HeaderBuffers HeaderBuffers
+
+	// StreamDefaults sets timeouts and tcp_nodelay of all stream servers, see NewStreamDefaults
+	StreamDefaults StreamDefaults
+
+	// SSHGateway routes TLS-wrapped SSH on one port by proxy.ssh.alias, see NewSSHGateway;
+	// aliases are ignored while it is disabled
+	SSHGateway SSHGateway
+
+	// UpstreamZone is the shared memory zone of every upstream block, see ParseUpstreamZone;
+	// empty leaves each worker its own upstream state
+	UpstreamZone string
+
+	// Forwarded sets the X-Forwarded-* headers sent to backends and the trusted proxies in front
+	// of nginx, see NewForwardedPolicy; proxy.http.forwarded_headers labels override the mode
+	Forwarded ForwardedPolicy
+
+	// Internal are the client networks of proxy.http.internal_only routes and the status of
+	// clients outside them, see NewInternalNetworks
+	Internal InternalNetworks
+
+	// Resolver is the DNS servers nginx resolves names with at runtime, see docker.ParseResolver;
+	// proxy.http.resolver labels override it per host, empty leaves resolving to nginx.conf
+	Resolver string
+
+	// PortCheck probes the host before stream ports are added to the configs, see checkPorts;
+	// PortCheckWarn logs ports bound by other processes, PortCheckFail fails the generation
+	PortCheck string
+
+	// Limits stop generations with too many routes, upstream servers or bytes of config,
+	// see NewLimits; the zero value disables them
+	Limits Limits
+
+	// RestartPage serves the HTTP routes of gone containers from a fallback upstream answering
+	// 503 for a grace period, see NewRestartPage; the zero value removes them at once
+	RestartPage RestartPage
+
+	// Policy drops the routes of containers it denies before generation, see Report.Denied
+	Policy docker.Policy
+
+	// TransformScript is a starlark file whose transform(containers) function may add, change
+	// or drop containers before rendering, see transform; empty disables it
+	TransformScript string
+
+	// PluginsDir holds executables run on every generation with the route set, see runPlugins;
+	// they may veto the generation or add config to the main configs, empty disables them
+	PluginsDir string
+
+	// TLSSessions configures session caching and ticket keys of HTTPS listeners, see NewTLSSessions
+	TLSSessions TLSSessions
+
+	// Secrets resolves *.secret label values to files, e.g. fetching them from Vault
+	// When nil, values are file names in SecretsDir
+	Secrets SecretResolver
+
+	// Certificates are used for HTTPS hosts without TLS secrets, nil uses the global certificate
+	Certificates CertStore
+
+	// SigningKey enables detached HMAC-SHA256 signatures (<config>.sig) for generated configs
+	SigningKey []byte
+
+	// HTTP2 and HTTP3 enable the protocols on HTTPS listeners, proxy.http.http2/http3 labels override them
+	HTTP2 bool
+	HTTP3 bool
+
+	// RequestID passes X-Request-ID to backends, generated when the client sent none,
+	// and logs it; proxy.http.request_id labels override it
+	RequestID bool
+
+	// WAFRules is the ModSecurity rules file for hosts with proxy.http.waf,
+	// such hosts are skipped while it is empty
+	WAFRules string
+
+	// BotPatterns are the user-agent regexes proxy.http.block_bots hosts answer with 403,
+	// see BotPatterns
+	BotPatterns []string
+
+	// AccessLogJSON is an extra access log in the proxy_json format, read by the metrics
+	// log tailer; empty disables it
+	AccessLogJSON string
+
+	// AccessLogSample is the share of successful requests logged, parsed by docker.ParseLogSample;
+	// errors are always logged, proxy.http.access_log.sample labels override it
+	AccessLogSample string
+
+	// Syslog ships access and error logs to syslog, see SyslogTarget; empty logs to files only
+	Syslog string
+
+	// ExternalStreams are stream routes to targets outside Docker, rendered after the container routes
+	ExternalStreams []ExternalStream
+
+	// GeoIPDB is the GeoIP2 country database for proxy.http.geo.* labels
+	// The geoip2 module must be loaded by nginx; hosts with geo rules are skipped when empty
+	GeoIPDB string
+
+	// Capabilities of the target nginx, protocols it lacks are not emitted
+	// When nil, every protocol is assumed to be supported
+	Capabilities *Capabilities
+}
+
+// DefaultSecretsDir is where Docker and Compose mount secrets
+const DefaultSecretsDir = "/run/secrets"
@@ -0,0 +1,146 @@
+package nginx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/state"
+)
+
+// ErrVetoed matches generations a plugin cancelled, see Options.PluginsDir
+var ErrVetoed = errors.New("generation vetoed by plugin")
+
+// pluginTimeout bounds each plugin run, a plugin still running then fails the generation
+const pluginTimeout = 30 * time.Second
+
+// pluginRequestVersion is the version of the JSON written to plugins, raised on incompatible changes
+const pluginRequestVersion = 1
+
+// PluginSnippet is config a plugin adds to the main stream or HTTP config
+type PluginSnippet struct {
+	Name   string // file name of the plugin
+	Config string
+}
+
+// pluginRequest is the route set written to the stdin of plugins
+type pluginRequest struct {
+	Version    int               `json:"version"`
+	Containers []state.Container `json:"containers"`
+}
+
+// pluginResponse is the JSON plugins answer on stdout, empty output allows the generation unchanged
+type pluginResponse struct {
+	Veto   string `json:"veto"`   // reason to cancel the generation, empty allows it
+	Stream string `json:"stream"` // config added to the main stream config
+	HTTP   string `json:"http"`   // config added to the main HTTP config
+}
+
+// runPlugins runs the plugins of PluginsDir in name order with the routes of containers
+// It returns their snippets, or an error when one vetoes the generation or fails, so a broken
+// plugin never lets configs through it was meant to check
+func (g *Generator) runPlugins(ctx context.Context, containers []docker.ContainerInfo) (stream, http []PluginSnippet, err error) {
+	if g.opts.PluginsDir == "" {
+		return nil, nil, nil
+	}
+	paths, err := pluginPaths(g.opts.PluginsDir)
+	if err != nil || len(paths) == 0 {
+		return nil, nil, err
+	}
+
+	input, err := json.Marshal(pluginRequest{Version: pluginRequestVersion, Containers: state.FromContainers(containers).Containers})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode plugin input: %w", err)
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		started := time.Now()
+		resp, err := runPlugin(ctx, path, input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("plugin %s failed: %w", name, err)
+		}
+		if resp.Veto != "" {
+			g.log.Logf("WARN [Generator] plugin vetoed generation plugin=%s reason=%q", name, resp.Veto)
+			return nil, nil, fmt.Errorf("%w %s: %s", ErrVetoed, name, resp.Veto)
+		}
+		if config := strings.TrimSpace(resp.Stream); config != "" {
+			stream = append(stream, PluginSnippet{Name: name, Config: config})
+		}
+		if config := strings.TrimSpace(resp.HTTP); config != "" {
+			http = append(http, PluginSnippet{Name: name, Config: config})
+		}
+		g.log.Logf("DEBUG [Generator] plugin finished plugin=%s stream=%t http=%t duration=%s",
+			name, resp.Stream != "", resp.HTTP != "", time.Since(started).Round(time.Millisecond))
+	}
+	return stream, http, nil
+}
+
+// pluginPaths lists the executables in dir sorted by name, a missing dir has none
+// Directories and hidden files, e.g. editor backups, are skipped
+func pluginPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins dir: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat plugin %s: %w", entry.Name(), err)
+		}
+		// Windows has no executable bit, any file may be run
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	return paths, nil // ReadDir sorts by name
+}
+
+// runPlugin runs one plugin with input on stdin and decodes its answer, it is killed when
+// parent is cancelled or after pluginTimeout
+func runPlugin(parent context.Context, path string, input []byte) (pluginResponse, error) {
+	ctx, cancel := context.WithTimeout(parent, pluginTimeout)
+	defer cancel()
+
+	// #nosec G204 -- plugins are executables installed in the configured plugins dir
+	cmd := exec.CommandContext(ctx, path)
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if parent.Err() != nil {
+			return pluginResponse{}, fmt.Errorf("interrupted: %w", parent.Err())
+		}
+		if ctx.Err() != nil {
+			return pluginResponse{}, fmt.Errorf("timed out after %s", pluginTimeout)
+		}
+		return pluginResponse{}, fmt.Errorf("%w\nStderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp pluginResponse
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return pluginResponse{}, fmt.Errorf("invalid output, expected JSON with veto, stream or http: %w", err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,128 @@
+package nginx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+// writePlugin installs a shell script plugin in dir
+func writePlugin(t *testing.T, dir, name, script string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeneratePlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins are not supported on windows")
+	}
+	tmpDir := t.TempDir()
+	pluginsDir := filepath.Join(tmpDir, "plugins.d")
+	if err := os.Mkdir(pluginsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{PluginsDir: pluginsDir})
+
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432}}},
+		{Name: "web", IP: "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web.example.com"}, ContainerPort: 80}},
+	}
+
+	// the route set is on stdin, a plugin may answer nothing
+	inputPath := filepath.Join(tmpDir, "input.json")
+	writePlugin(t, pluginsDir, "10-record", "cat > "+inputPath, 0o755)
+	writePlugin(t, pluginsDir, "20-snippets",
+		`echo '{"stream":"# stream snippet","http":"map $host $tier { default web; }"}'`, 0o755)
+	writePlugin(t, pluginsDir, "30-disabled", `echo '{"veto":"not executable"}'`, 0o644)
+	writePlugin(t, pluginsDir, ".40-hidden", `echo '{"veto":"hidden"}'`, 0o755)
+
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	input := readConfig(t, inputPath)
+	for _, want := range []string{`"version":1`, `"name":"db"`, "http:web.example.com"} {
+		if !strings.Contains(input, want) {
+			t.Errorf("plugin input missing %q:\n%s", want, input)
+		}
+	}
+	if stream := readConfig(t, streamPath); !strings.Contains(stream, "# Plugin: 20-snippets\n# stream snippet") {
+		t.Errorf("stream config missing plugin snippet:\n%s", stream)
+	}
+	if http := readConfig(t, httpPath); !strings.Contains(http, "# Plugin: 20-snippets\nmap $host $tier { default web; }") {
+		t.Errorf("HTTP config missing plugin snippet:\n%s", http)
+	}
+
+	t.Run("veto keeps the previous configs", func(t *testing.T) {
+		before := readConfig(t, httpPath)
+		writePlugin(t, pluginsDir, "50-freeze", `echo '{"veto":"change freeze"}'`, 0o755)
+		defer os.Remove(filepath.Join(pluginsDir, "50-freeze"))
+
+		_, err := gen.Generate(containers[:1])
+		if !errors.Is(err, ErrVetoed) || !strings.Contains(err.Error(), "50-freeze: change freeze") {
+			t.Fatalf("Generate() error = %v, want a veto by 50-freeze", err)
+		}
+		if after := readConfig(t, httpPath); after != before {
+			t.Error("vetoed generation changed the HTTP config")
+		}
+	})
+
+	t.Run("failing plugin fails the generation", func(t *testing.T) {
+		writePlugin(t, pluginsDir, "50-broken", "echo boom >&2; exit 2", 0o755)
+		defer os.Remove(filepath.Join(pluginsDir, "50-broken"))
+
+		_, err := gen.Generate(containers)
+		if err == nil || errors.Is(err, ErrVetoed) || !strings.Contains(err.Error(), "plugin 50-broken failed") ||
+			!strings.Contains(err.Error(), "boom") {
+			t.Fatalf("Generate() error = %v, want the plugin failure", err)
+		}
+	})
+
+	t.Run("invalid output fails the generation", func(t *testing.T) {
+		writePlugin(t, pluginsDir, "50-chatty", "echo hello", 0o755)
+		defer os.Remove(filepath.Join(pluginsDir, "50-chatty"))
+
+		if _, err := gen.Generate(containers); err == nil || !strings.Contains(err.Error(), "invalid output") {
+			t.Fatalf("Generate() error = %v, want invalid output", err)
+		}
+	})
+
+	t.Run("cancelled context stops a plugin", func(t *testing.T) {
+		writePlugin(t, pluginsDir, "50-slow", "exec sleep 10", 0o755)
+		defer os.Remove(filepath.Join(pluginsDir, "50-slow"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		_, err := gen.GenerateContext(ctx, containers)
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "plugin 50-slow failed: interrupted") {
+			t.Fatalf("GenerateContext() error = %v, want the plugin interrupted", err)
+		}
+		if elapsed := time.Since(started); elapsed > 5*time.Second {
+			t.Errorf("GenerateContext() took %s, want the plugin killed with the context", elapsed)
+		}
+	})
+}
+
+func TestPluginPathsMissingDir(t *testing.T) {
+	paths, err := pluginPaths(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(paths) != 0 {
+		t.Errorf("pluginPaths() = %v, %v, want no plugins", paths, err)
+	}
+}
@@ -0,0 +1,159 @@
+package nginx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// port check modes, see Options.PortCheck
+const (
+	PortCheckOff  = "off"
+	PortCheckWarn = "warn"
+	PortCheckFail = "fail"
+)
+
+// ParsePortCheck validates a port check mode, empty is off
+func ParsePortCheck(mode string) (string, error) {
+	switch mode {
+	case "", PortCheckOff:
+		return PortCheckOff, nil
+	case PortCheckWarn, PortCheckFail:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid port check %q, expected off, warn or fail", mode)
+}
+
+// checkPorts probes the host for sockets bound to stream ports the rendered configs add,
+// nginx would otherwise fail the reload with a bind error
+// Ports listened on by the configs on disk are nginx's own and not probed
+func (g *Generator) checkPorts(configs renderedConfigs) error {
+	if g.opts.PortCheck == "" || g.opts.PortCheck == PortCheckOff || g.readOnly {
+		return nil
+	}
+	rendered := map[string][]byte{g.streamConfigPath: configs.stream}
+	for _, ns := range configs.namespaces {
+		if ns.err == nil {
+			rendered[ns.streamPath] = ns.stream
+		}
+	}
+	next, err := streamListenPorts(rendered)
+	if err != nil {
+		g.log.Logf("DEBUG [Generator] port check skipped, rendered config not parsable error=%q", err)
+		return nil
+	}
+	current, err := g.currentListenPorts()
+	if err != nil {
+		g.log.Logf("DEBUG [Generator] port check skipped, config on disk not parsable error=%q", err)
+		return nil
+	}
+	var added []string
+	for port := range next {
+		if !current[port] {
+			added = append(added, port)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	bound, err := boundPorts()
+	if err != nil {
+		g.log.Logf("DEBUG [Generator] port check skipped error=%q", err)
+		return nil
+	}
+
+	var inUse []string
+	for _, port := range added {
+		if bound[port] {
+			inUse = append(inUse, port)
+		}
+	}
+	if len(inUse) == 0 {
+		return nil
+	}
+	slices.Sort(inUse)
+	if g.opts.PortCheck == PortCheckFail {
+		return conflictf("ports already bound on the host: %s, nginx could not listen on them", strings.Join(inUse, ", "))
+	}
+	for _, port := range inUse {
+		g.log.Logf("WARN [Generator] port already bound on the host, the nginx reload will fail to listen port=%s", port)
+	}
+	return nil
+}
+
+// currentListenPorts returns the stream ports of the main and namespace configs on disk
+func (g *Generator) currentListenPorts() (map[string]bool, error) {
+	paths, err := filepath.Glob(NamespacePath(g.streamConfigPath, "*"))
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string][]byte, len(paths)+1)
+	for _, path := range append(paths, g.streamConfigPath) {
+		// #nosec G304 -- path is the configured stream config or one of its namespace configs
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		configs[path] = content
+	}
+	return streamListenPorts(configs)
+}
+
+// streamListenPorts returns the "tcp:<port>" and "udp:<port>" keys the stream configs listen on
+func streamListenPorts(configs map[string][]byte) (map[string]bool, error) {
+	ports := make(map[string]bool)
+	for path, content := range configs {
+		servers, err := parseConfigServers(path, content)
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range servers {
+			for _, port := range server.tcpPorts {
+				ports["tcp:"+strconv.Itoa(port)] = true
+			}
+			for _, port := range server.udpPorts {
+				ports["udp:"+strconv.Itoa(port)] = true
+			}
+		}
+	}
+	return ports, nil
+}
+
+// socket states in /proc/net, see include/net/tcp_states.h
+const (
+	procNetListen = "0A" // TCP_LISTEN
+	procNetClosed = "07" // TCP_CLOSE, an unconnected bound UDP socket
+)
+
+// parseProcNet returns the local ports of the sockets in a /proc/net/{tcp,udp}[6] table with the given state
+func parseProcNet(content []byte, state string) ([]int, error) {
+	var ports []int
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != state {
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid local address %q", fields[1])
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local port %q: %w", fields[1], err)
+		}
+		ports = append(ports, int(port))
+	}
+	return ports, scanner.Err()
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// boundPorts returns the TCP ports listened on and the UDP ports bound in the network namespace
+// of the proxy, keyed like streamListenPorts
+func boundPorts() (map[string]bool, error) {
+	bound := make(map[string]bool)
+	for _, table := range []struct{ file, proto, state string }{
+		{"/proc/net/tcp", "tcp", procNetListen},
+		{"/proc/net/tcp6", "tcp", procNetListen},
+		{"/proc/net/udp", "udp", procNetClosed},
+		{"/proc/net/udp6", "udp", procNetClosed},
+	} {
+		content, err := os.ReadFile(table.file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // IPv6 disabled
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", table.file, err)
+		}
+		ports, err := parseProcNet(content, table.state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", table.file, err)
+		}
+		for _, port := range ports {
+			bound[table.proto+":"+strconv.Itoa(port)] = true
+		}
+	}
+	return bound, nil
+}
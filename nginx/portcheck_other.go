@@ -0,0 +1,10 @@
+//go:build !linux
+
+package nginx
+
+import "errors"
+
+// boundPorts needs /proc/net, the port check is skipped on other systems
+func boundPorts() (map[string]bool, error) {
+	return nil, errors.New("port check is only supported on linux")
+}
@@ -0,0 +1,80 @@
+package nginx
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestParseProcNet(t *testing.T) {
+	content := []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 21332 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18512 1 0000000000000000 100 0 0 10 0
+   2: 0200A8C0:D431 6400A8C0:01BB 01 00000000:00000000 02:000A7B2C 00000000  1000        0 51289 2 0000000000000000 20 4 30 10 -1
+   3: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20917 1 0000000000000000 100 0 0 10 0
+`)
+	ports, err := parseProcNet(content, procNetListen)
+	if err != nil {
+		t.Fatalf("parseProcNet() error = %v", err)
+	}
+	if !slices.Equal(ports, []int{5432, 3306, 80}) {
+		t.Errorf("ports = %v, want the listening 5432, 3306 and 80", ports)
+	}
+	if _, err := parseProcNet([]byte("header\n 0: 00000000:ZZZZ 00000000:0000 0A\n"), procNetListen); err == nil {
+		t.Error("parseProcNet() should fail on an invalid port")
+	}
+}
+
+func TestGeneratePortCheck(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the port check reads /proc/net")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	tmpDir := t.TempDir()
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: port, ContainerPort: 5432}}},
+	}
+
+	gen.SetOptions(Options{PortCheck: PortCheckFail})
+	if _, err := gen.Generate(containers); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Generate() error = %v, want a conflict with the bound port", err)
+	}
+
+	gen.SetOptions(Options{PortCheck: PortCheckWarn})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v, want a warning only", err)
+	}
+
+	// the port is in the config on disk now, its listener is nginx's own
+	gen.SetOptions(Options{PortCheck: PortCheckFail})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Errorf("Generate() error = %v, ports of the current config are not probed", err)
+	}
+}
+
+func TestParsePortCheck(t *testing.T) {
+	for mode, want := range map[string]string{"": PortCheckOff, "off": PortCheckOff, "warn": PortCheckWarn, "fail": PortCheckFail} {
+		if got, err := ParsePortCheck(mode); err != nil || got != want {
+			t.Errorf("ParsePortCheck(%q) = %q, %v, want %q", mode, got, err, want)
+		}
+	}
+	if _, err := ParsePortCheck("strict"); err == nil {
+		t.Error("ParsePortCheck(strict) should fail")
+	}
+}
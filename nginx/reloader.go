@@ -1,8 +1,8 @@
 package nginx
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"time"
 
 	"github.com/go-pkgz/lgr"
@@ -16,7 +16,12 @@ type Reloader struct {
 }
 
 // NewReloader creates a new Nginx reloader
+// reloadCmd is split into arguments and executed without a shell
 func NewReloader(reloadCmd string, log *lgr.Logger) (*Reloader, error) {
+	if _, err := SplitCommand(reloadCmd); err != nil {
+		return nil, fmt.Errorf("invalid reload command: %w", err)
+	}
+
 	return &Reloader{
 		reloadCmd: reloadCmd,
 		log:       log,
@@ -25,19 +30,28 @@ func NewReloader(reloadCmd string, log *lgr.Logger) (*Reloader, error) {
 
 // Reload reloads Nginx configuration
 // Implements reload throttling (minimum 1 second between reloads)
-func (r *Reloader) Reload() error {
+// The throttling wait and the command end when ctx is done, e.g. on shutdown
+func (r *Reloader) Reload(ctx context.Context) error {
 	// prevent reload storms
 	if time.Since(r.lastReload) < 1*time.Second {
 		r.log.Logf("WARN [Reloader] throttling reload, too_soon_after_last")
-		time.Sleep(1 * time.Second)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("reload interrupted: %w", ctx.Err())
+		}
 	}
 
 	r.log.Logf("INFO [Reloader] executing reload_cmd=%s", r.reloadCmd)
 
-	// #nosec G204 -- reloadCmd is from trusted configuration, not user input
-	//nolint:noctx // config command, not user request - context not needed
-	cmd := exec.Command("sh", "-c", r.reloadCmd)
+	cmd, err := buildCommandContext(ctx, r.reloadCmd)
+	if err != nil {
+		return fmt.Errorf("invalid reload command: %w", err)
+	}
 	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("reload interrupted: %w", ctx.Err())
+	}
 
 	if err != nil {
 		r.log.Logf("ERROR [Reloader] reload failed output=%q error=%q", string(output), err)
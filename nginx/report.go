@@ -0,0 +1,139 @@
+package nginx
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moontechs/proxy/docker"
+	"github.com/moontechs/proxy/state"
+)
+
+// Report describes what a generation produced
+// Conflicts fail the generation, so a report always describes conflict-free configs
+type Report struct {
+	Routes  *state.Snapshot           // routes of this generation
+	Changes state.Changes             // route changes since the previous generation, see SetPreviousRoutes
+	Skipped []docker.SkippedContainer // containers with proxy labels that are not routed, with the reason
+	Denied  []docker.DeniedRoute      // routes dropped by Options.Policy
+	Stream  ConfigReport
+	HTTP    ConfigReport
+
+	Namespaces []NamespaceReport // configs of proxy.namespace routes, sorted by name
+
+	// ACMEHostnames are the hostnames of the routes certificates are issued for, after the
+	// transform script and the policy, see ACMEHostnames
+	ACMEHostnames []string
+
+	// Warmups are the requests sent to added and changed HTTP routes after the reload,
+	// empty when warm-up is disabled or nothing was reloaded
+	Warmups []WarmupResult
+}
+
+// WarmupResult is the outcome of the warm-up request to one route
+type WarmupResult struct {
+	Container string
+	Route     string // e.g. http:api.example.com
+	OK        bool   // answered without a 5xx status
+	Detail    string // status of the response or the error
+	Duration  time.Duration
+}
+
+// NamespaceReport describes the configs of one namespace
+type NamespaceReport struct {
+	Name   string
+	Stream ConfigReport
+	HTTP   ConfigReport
+	Error  string // conflict within the namespace that kept its previous configs, see Options.IsolateNamespaces
+}
+
+// ConfigReport describes one generated config
+type ConfigReport struct {
+	Path     string
+	Checksum string // SHA256 of the rendered config
+	Changed  bool   // written, or differing from the file on disk in read-only mode
+}
+
+// Changed reports whether any config changed
+// Removed namespaces always change the main configs, they no longer include them
+func (r Report) Changed() bool {
+	if r.Stream.Changed || r.HTTP.Changed {
+		return true
+	}
+	for _, ns := range r.Namespaces {
+		if ns.Stream.Changed || ns.HTTP.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// Details returns the report as event details for webhooks and the admin API event stream
+func (r Report) Details() map[string]string {
+	details := map[string]string{
+		"added":           strconv.Itoa(len(r.Changes.Added)),
+		"removed":         strconv.Itoa(len(r.Changes.Removed)),
+		"changed":         strconv.Itoa(len(r.Changes.Changed)),
+		"relabeled":       strconv.Itoa(len(r.Changes.Relabeled)),
+		"skipped":         strconv.Itoa(len(r.Skipped)),
+		"denied":          strconv.Itoa(len(r.Denied)),
+		"stream_checksum": r.Stream.Checksum,
+		"http_checksum":   r.HTTP.Checksum,
+	}
+	if len(r.Warmups) > 0 {
+		failed := 0
+		for _, w := range r.Warmups {
+			if !w.OK {
+				failed++
+			}
+		}
+		details["warmed_up"] = strconv.Itoa(len(r.Warmups) - failed)
+		details["warmup_failed"] = strconv.Itoa(failed)
+	}
+	if len(r.Namespaces) == 0 {
+		return details
+	}
+
+	var failed []string
+	for _, ns := range r.Namespaces {
+		if ns.Error != "" {
+			failed = append(failed, ns.Name)
+		}
+	}
+	details["namespaces"] = strconv.Itoa(len(r.Namespaces))
+	if len(failed) > 0 {
+		details["failed_namespaces"] = strings.Join(failed, ",")
+	}
+	return details
+}
+
+// Summary returns the report as persisted with the state, see state.Report
+func (r Report) Summary() *state.Report {
+	summary := &state.Report{
+		Added:     state.Names(r.Changes.Added),
+		Removed:   state.Names(r.Changes.Removed),
+		Changed:   state.Names(r.Changes.Changed),
+		Relabeled: state.Names(r.Changes.Relabeled),
+	}
+	for _, ctr := range r.Skipped {
+		summary.Skipped = append(summary.Skipped, state.SkippedRoute{Container: ctr.Name, Reason: ctr.Reason})
+	}
+	for _, route := range r.Denied {
+		summary.Denied = append(summary.Denied, state.SkippedRoute{Container: route.Container, Route: route.Route, Reason: route.Reason})
+	}
+	for _, w := range r.Warmups {
+		summary.Warmups = append(summary.Warmups, state.WarmupResult{
+			Container: w.Container, Route: w.Route, OK: w.OK, Detail: w.Detail, Duration: w.Duration,
+		})
+	}
+	return summary
+}
+
+// SetPreviousRoutes sets the routes the next report's changes are computed against
+// Every generation replaces them with its own routes
+func (g *Generator) SetPreviousRoutes(snap *state.Snapshot) {
+	if snap == nil {
+		snap = &state.Snapshot{}
+	}
+	g.previous = snap
+}
@@ -0,0 +1,141 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// DefaultRestartPageAddr is the local listener of the restart page
+const DefaultRestartPageAddr = "127.0.0.1:8098"
+
+// restartPageRetry is the Retry-After and refresh interval of the restart page, in seconds
+const restartPageRetry = "5"
+
+// RestartPage keeps the HTTP routes of a container that is gone, e.g. during a quick restart,
+// for Grace with their upstream switched to a fallback server on Addr answering 503 with a
+// "service restarting" page; the zero value removes the routes at once
+type RestartPage struct {
+	Grace time.Duration
+	Host  string // of Addr, e.g. 127.0.0.1
+	Port  int
+}
+
+// NewRestartPage validates the grace period and the listen address of the restart page,
+// a grace period of 0 disables it
+func NewRestartPage(grace time.Duration, addr string) (RestartPage, error) {
+	if grace < 0 {
+		return RestartPage{}, fmt.Errorf("invalid restart page grace %s, expected 0 or more", grace)
+	}
+	if grace == 0 {
+		return RestartPage{}, nil
+	}
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return RestartPage{}, fmt.Errorf("invalid restart page address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 || net.ParseIP(host) == nil {
+		return RestartPage{}, fmt.Errorf("invalid restart page address %q, expected ip:port, e.g. %s", addr, DefaultRestartPageAddr)
+	}
+	return RestartPage{Grace: grace, Host: host, Port: port}, nil
+}
+
+// Addr returns the listen address of the restart page, IPv6 addresses in brackets
+func (p RestartPage) Addr() string {
+	return serverAddress(p.Host, p.Port)
+}
+
+// restartServer is an HTTP server of the last generation, gone is when its container
+// disappeared and zero while it is routed
+type restartServer struct {
+	server HTTPServer
+	gone   time.Time
+}
+
+// restartServers returns the servers to remember for the restart page after a generation of
+// containers and servers: the routed ones, and the ones of gone containers within the grace
+// period of the restart page
+// Servers whose hostname moved to another container or whose container still runs with other
+// labels are dropped at once
+func (g *Generator) restartServers(containers []docker.ContainerInfo, httpData HTTPData, now time.Time) map[string]restartServer {
+	grace := g.opts.RestartPage.Grace
+	if grace <= 0 {
+		return nil
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.Name] = true
+	}
+	servers := make(map[string]restartServer, len(httpData.HTTPServers))
+	routed := make(map[string]bool, len(httpData.HTTPServers)+len(httpData.Redirects))
+	for _, server := range httpData.HTTPServers {
+		routed[server.Hostname] = true
+		if server.StaticRoot == "" {
+			servers[server.Hostname] = restartServer{server: server}
+		}
+	}
+	for _, redirect := range httpData.Redirects {
+		routed[redirect.Hostname] = true
+	}
+
+	for hostname, previous := range g.restart {
+		if routed[hostname] || running[previous.server.ContainerName] {
+			continue
+		}
+		if previous.gone.IsZero() {
+			previous.gone = now
+			g.log.Logf("INFO [Generator] container gone, serving restart page host=%s container=%s grace=%s",
+				hostname, previous.server.ContainerName, grace)
+		}
+		if now.Sub(previous.gone) >= grace {
+			g.log.Logf("INFO [Generator] restart grace over, removing route host=%s container=%s",
+				hostname, previous.server.ContainerName)
+			continue
+		}
+		servers[hostname] = previous
+	}
+	return servers
+}
+
+// restartPageServers returns the servers of gone containers, sorted by hostname, with their
+// upstream switched to the restart page
+// Backend TLS, gRPC, mirrors and credentials of the route are left out, the page is plain HTTP
+func (g *Generator) restartPageServers(servers map[string]restartServer) []HTTPServer {
+	page := g.opts.RestartPage
+	var restarting []HTTPServer
+	for _, rs := range servers {
+		if rs.gone.IsZero() {
+			continue
+		}
+		server := rs.server
+		server.ContainerIP, server.ContainerPort = serverIP(page.Host), page.Port
+		server.Socket, server.Replicas, server.ServerParams, server.HealthCheck = "", nil, "", nil
+		server.Mirror, server.BackendHTTPS, server.GRPC = nil, false, false
+		server.UpstreamAuth, server.UpstreamHost = "", ""
+		server.Restarting = rs.gone.Add(page.Grace).UTC().Format(time.RFC3339)
+		restarting = append(restarting, server)
+	}
+	slices.SortFunc(restarting, func(a, b HTTPServer) int { return strings.Compare(a.Hostname, b.Hostname) })
+	return restarting
+}
+
+// RestartPageUntil returns when the next route on the restart page is removed, zero if none is
+func (g *Generator) RestartPageUntil() time.Time {
+	var until time.Time
+	for _, rs := range g.restart {
+		if rs.gone.IsZero() {
+			continue
+		}
+		if end := rs.gone.Add(g.opts.RestartPage.Grace); until.IsZero() || end.Before(until) {
+			until = end
+		}
+	}
+	return until
+}
@@ -0,0 +1,138 @@
+package nginx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewRestartPage(t *testing.T) {
+	tests := []struct {
+		grace   time.Duration
+		addr    string
+		want    RestartPage
+		wantErr bool
+	}{
+		{grace: 30 * time.Second, addr: DefaultRestartPageAddr, want: RestartPage{Grace: 30 * time.Second, Host: "127.0.0.1", Port: 8098}},
+		{grace: time.Minute, addr: " [::1]:9000 ", want: RestartPage{Grace: time.Minute, Host: "::1", Port: 9000}},
+		{addr: "garbage"},
+		{grace: -time.Second, wantErr: true},
+		{grace: time.Second, addr: "localhost:8098", wantErr: true},
+		{grace: time.Second, addr: "127.0.0.1:0", wantErr: true},
+		{grace: time.Second, addr: "127.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewRestartPage(tt.grace, tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NewRestartPage(%s, %q) = %+v, %v, want %+v (error %t)", tt.grace, tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if addr := (RestartPage{Host: "::1", Port: 9000}).Addr(); addr != "[::1]:9000" {
+		t.Errorf("Addr() = %q, want [::1]:9000", addr)
+	}
+}
+
+func TestGenerateRestartPage(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	page, err := NewRestartPage(time.Minute, DefaultRestartPageAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "token"), []byte("Bearer s3cret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	gen.SetOptions(Options{RestartPage: page, SecretsDir: tmpDir})
+
+	shop := docker.ContainerInfo{Name: "shop", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+		Hostnames: []string{"shop.example.com"}, ContainerPort: 8443, BackendHTTPS: true, UpstreamAuthSecret: "token",
+	}}
+	wiki := docker.ContainerInfo{Name: "wiki", IP: "172.17.0.3", HTTPMapping: &docker.HTTPMapping{
+		Hostnames: []string{"wiki.example.com"}, ContainerPort: 8080,
+	}}
+	generate := func(containers ...docker.ContainerInfo) string {
+		t.Helper()
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		return readConfig(t, httpPath)
+	}
+
+	if text := generate(shop, wiki); strings.Contains(text, "Restart page") || !gen.RestartPageUntil().IsZero() {
+		t.Fatalf("no restart page expected while the containers run:\n%s", text)
+	}
+
+	// shop is gone, wiki dropped its route but still runs
+	start := time.Now()
+	wiki.HTTPMapping = nil
+	text := generate(wiki)
+	for _, want := range []string{
+		"# Restarting: container gone, restart page until ",
+		"server 127.0.0.1:8098;",
+		"server_name shop.example.com;",
+		"proxy_pass http://",
+		"listen 127.0.0.1:8098;",
+		"return 503 '<!DOCTYPE html>",
+		"<h1>This service is restarting</h1>", // the client's Host header never reaches the HTML
+		"add_header Retry-After 5 always;",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config should have %q:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"wiki.example.com", "172.17.0.2", "proxy_pass https://", "Authorization"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("HTTP config should not have %q:\n%s", unwanted, text)
+		}
+	}
+	until := gen.RestartPageUntil()
+	if until.Before(start.Add(time.Minute)) || until.After(time.Now().Add(time.Minute)) {
+		t.Errorf("expected the restart page until a minute from now, got %s", until)
+	}
+	if again := generate(wiki); again != text {
+		t.Errorf("regenerating within the grace period should keep the config:\n%s", again)
+	}
+
+	// back within the grace period
+	if text := generate(shop); strings.Contains(text, "Restart page") || !strings.Contains(text, "server 172.17.0.2:8443;") {
+		t.Errorf("expected shop routed again without the restart page:\n%s", text)
+	}
+
+	// gone for longer than the grace period
+	generate()
+	for hostname, rs := range gen.restart {
+		rs.gone = rs.gone.Add(-time.Minute)
+		gen.restart[hostname] = rs
+	}
+	if text := generate(); strings.Contains(text, "shop.example.com") || strings.Contains(text, "Restart page") {
+		t.Errorf("expected shop removed after the grace period:\n%s", text)
+	}
+	if !gen.RestartPageUntil().IsZero() {
+		t.Errorf("expected no route on the restart page, got %s", gen.RestartPageUntil())
+	}
+}
+
+func TestGenerateRestartPagePortConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), filepath.Join(tmpDir, "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{RestartPage: RestartPage{Grace: time.Minute, Host: "127.0.0.1", Port: 8098}})
+
+	db := docker.ContainerInfo{Name: "db", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 8098, ContainerPort: 5432, Protocol: docker.TCP}}}
+	if _, err := gen.Generate([]docker.ContainerInfo{db}); !errors.Is(err, ErrConflict) ||
+		!strings.Contains(err.Error(), "port 8098 claimed by both db and the restart page") {
+		t.Errorf("expected a conflict with the restart page, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package nginx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SecretResolver maps a secret reference from a label to a file readable by nginx
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// DirSecrets resolves secret names to files in a directory, e.g. Docker secrets in /run/secrets
+type DirSecrets struct {
+	Dir string
+}
+
+// Resolve returns the path of the secret file, existence is checked by the generator
+func (d DirSecrets) Resolve(ref string) (string, error) {
+	dir := d.Dir
+	if dir == "" {
+		dir = DefaultSecretsDir
+	}
+	return filepath.Join(dir, ref), nil
+}
+
+// DefaultSecretsFileMode keeps the secrets include readable by its owner only
+const DefaultSecretsFileMode os.FileMode = 0o600
+
+// upstreamAuthVar holds the Authorization header of the matched server, defined by the secrets include
+const upstreamAuthVar = "$proxy_upstream_authorization"
+
+// SecretsPath returns the include holding the secret values of an HTTP config, next to it
+// The extension keeps it out of conf.d/*.conf globs, only the HTTP config includes it
+// Example: /etc/nginx/conf.d/http-proxy.conf -> /etc/nginx/conf.d/http-proxy.secrets
+func SecretsPath(httpPath string) string {
+	return strings.TrimSuffix(httpPath, filepath.Ext(httpPath)) + ".secrets"
+}
+
+// headerValue returns the single line of a secret holding an HTTP header value
+// Quotes, backslashes and $ are rejected, nginx would interpret them in the map value
+func headerValue(content []byte) (string, error) {
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", errors.New("empty header value")
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return r < ' ' || r == 0x7f || strings.ContainsRune("\"\\$", r) }) {
+		return "", errors.New("header value must be one line without quotes, backslashes or $")
+	}
+	return value, nil
+}
+
+// renderSecrets builds the secrets include of the HTTP servers with upstream credentials,
+// nil when no server has any
+func renderSecrets(timestamp string, servers []HTTPServer) []byte {
+	var auth []HTTPServer
+	for _, server := range servers {
+		if server.UpstreamAuth != "" {
+			auth = append(auth, server)
+		}
+	}
+	if len(auth) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(headerPrefix + timestamp + "\n")
+	b.WriteString("# DO NOT EDIT MANUALLY - Changes will be overwritten\n")
+	b.WriteString("# Secret values of the HTTP routes, keep this file private\n\n")
+	b.WriteString("# Authorization headers sent to proxy.http.upstream.auth.secret backends\n")
+	b.WriteString("map $server_name " + upstreamAuthVar + " {\n")
+	b.WriteString("    default \"\";\n")
+	for _, server := range auth {
+		fmt.Fprintf(&b, "    %s %s; # %s\n", quoteValue(server.Hostname), quoteValue(server.UpstreamAuth), server.ContainerName)
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// quoteValue quotes a string for an nginx config, escaping backslashes and double quotes
+// Unlike %q it keeps other characters as they are, nginx knows no other escapes
+func quoteValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// remoteSecretsError names the containers with upstream credentials, whose secrets include is
+// not delivered to remote targets
+func remoteSecretsError(servers []HTTPServer) error {
+	var containers []string
+	for _, server := range servers {
+		if server.UpstreamAuth != "" && !slices.Contains(containers, server.ContainerName) {
+			containers = append(containers, server.ContainerName)
+		}
+	}
+	return fmt.Errorf("proxy.http.upstream.auth.secret of %s needs a local nginx, the secrets include is not delivered to remote targets",
+		strings.Join(containers, ", "))
+}
+
+// writeSecrets writes the secrets include, or removes a generated one no server needs anymore
+func (g *Generator) writeSecrets(content []byte) error {
+	path := SecretsPath(g.httpConfigPath)
+	if content != nil {
+		if _, err := g.writeIfChanged(path, content); err != nil {
+			return fmt.Errorf("secrets generation failed: %w", err)
+		}
+		return nil
+	}
+	if g.readOnly {
+		return nil
+	}
+
+	// #nosec G304 -- path is next to the configured HTTP config
+	existing, err := os.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(existing, []byte(headerPrefix)) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove secrets include: %w", err)
+	}
+	if err := os.Remove(SignaturePath(path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove secrets include signature: %w", err)
+	}
+	g.log.Logf("INFO [Generator] removed unused secrets include path=%s", path)
+	return nil
+}
@@ -0,0 +1,91 @@
+package nginx
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrTampered is returned when a config file no longer matches its signature
+var ErrTampered = errors.New("config modified outside the proxy")
+
+// signaturePrefix identifies the algorithm in detached signature files
+const signaturePrefix = "hmac-sha256:"
+
+// SignaturePath returns the detached signature file of a config file
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// Sign returns the detached signature of content
+func Sign(key, content []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content) //nolint:errcheck // hash writes never fail
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeSignature writes the detached signature next to path when signing is enabled
+func (g *Generator) writeSignature(path string, content []byte) error {
+	if len(g.opts.SigningKey) == 0 {
+		return nil
+	}
+
+	sig := Sign(g.opts.SigningKey, content)
+	sigPath := SignaturePath(path)
+	// #nosec G304 -- path is from trusted configuration, not user input
+	if old, err := os.ReadFile(sigPath); err == nil && strings.TrimSpace(string(old)) == sig {
+		return nil
+	}
+	if err := g.atomicWrite(sigPath, []byte(sig+"\n")); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	g.log.Logf("DEBUG [Generator] signature written path=%s", sigPath)
+	return nil
+}
+
+// VerifySignatures checks the stream, HTTP and last generated namespace configs against their detached signatures
+// Missing configs are fine, configs without a signature or with a mismatching one return ErrTampered
+// A deleted signature is never trusted, regeneration signs configs written before signing was enabled
+func (g *Generator) VerifySignatures() error {
+	if len(g.opts.SigningKey) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, path := range append([]string{g.streamConfigPath, g.httpConfigPath}, g.namespacePaths...) {
+		if err := verifyFile(g.opts.SigningKey, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// verifyFile checks one config file, a missing config is not an error
+func verifyFile(key []byte, path string) error {
+	// #nosec G304 -- path is from trusted configuration, not user input
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// #nosec G304 -- path is from trusted configuration, not user input
+	sig, err := os.ReadFile(SignaturePath(path))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s has no signature: %w", path, ErrTampered)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read signature of %s: %w", path, err)
+	}
+
+	if !hmac.Equal([]byte(strings.TrimSpace(string(sig))), []byte(Sign(key, content))) {
+		return fmt.Errorf("%s: %w", path, ErrTampered)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package nginx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestSignatures(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{SigningKey: []byte("0123456789abcdef")})
+
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "172.17.0.2", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432}}},
+	}
+
+	t.Run("unsigned configs are tampered", func(t *testing.T) {
+		if err := os.WriteFile(streamPath, []byte("# written before signing was enabled\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := gen.VerifySignatures(); !errors.Is(err, ErrTampered) {
+			t.Errorf("VerifySignatures() error = %v, want ErrTampered", err)
+		}
+	})
+
+	t.Run("generated configs verify", func(t *testing.T) {
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		for _, path := range []string{streamPath, httpPath} {
+			if _, err := os.Stat(SignaturePath(path)); err != nil {
+				t.Errorf("missing signature for %s: %v", path, err)
+			}
+		}
+		if err := gen.VerifySignatures(); err != nil {
+			t.Errorf("VerifySignatures() error = %v", err)
+		}
+	})
+
+	t.Run("manual edit is detected and repaired by regeneration", func(t *testing.T) {
+		if err := os.WriteFile(streamPath, []byte("# edited by hand\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := gen.VerifySignatures(); !errors.Is(err, ErrTampered) {
+			t.Fatalf("VerifySignatures() error = %v, want ErrTampered", err)
+		}
+
+		report, err := gen.Generate(containers)
+		if err != nil || !report.Changed() {
+			t.Fatalf("Generate() = %+v, %v, want changed", report, err)
+		}
+		if err := gen.VerifySignatures(); err != nil {
+			t.Errorf("VerifySignatures() after regeneration error = %v", err)
+		}
+	})
+
+	t.Run("deleted signature is detected", func(t *testing.T) {
+		if err := os.Remove(SignaturePath(httpPath)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gen.VerifySignatures(); !errors.Is(err, ErrTampered) {
+			t.Errorf("VerifySignatures() error = %v, want ErrTampered", err)
+		}
+		if _, err := gen.Generate(containers); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		if err := gen.VerifySignatures(); err != nil {
+			t.Errorf("VerifySignatures() after regeneration error = %v", err)
+		}
+	})
+
+	t.Run("wrong key is detected", func(t *testing.T) {
+		gen.SetOptions(Options{SigningKey: []byte("another-key-0123456")})
+		if err := gen.VerifySignatures(); !errors.Is(err, ErrTampered) {
+			t.Errorf("VerifySignatures() error = %v, want ErrTampered", err)
+		}
+	})
+}
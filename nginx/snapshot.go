@@ -0,0 +1,77 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot holds generated config file contents captured at a point in time
+type Snapshot struct {
+	files map[string][]byte // path -> content, nil content means the file did not exist
+}
+
+// TakeSnapshot captures the current content of the stream, HTTP, secrets and namespace config files
+func (g *Generator) TakeSnapshot() (*Snapshot, error) {
+	snap := &Snapshot{files: make(map[string][]byte, 3)}
+
+	paths := []string{g.streamConfigPath, g.httpConfigPath, SecretsPath(g.httpConfigPath)}
+	for _, main := range []string{g.streamConfigPath, g.httpConfigPath} {
+		matches, err := filepath.Glob(NamespacePath(main, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot namespace configs: %w", err)
+		}
+		paths = append(paths, matches...)
+	}
+
+	for _, path := range paths {
+		// #nosec G304 -- path is from trusted configuration, not user input
+		content, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", path, err)
+		}
+		snap.files[path] = content
+	}
+
+	g.log.Logf("DEBUG [Generator] snapshot taken files=%d", len(snap.files))
+	return snap, nil
+}
+
+// RestoreSnapshot writes snapshot contents back, files missing at snapshot time are removed
+// including namespace configs generated since
+// Returns true if any file changed
+func (g *Generator) RestoreSnapshot(snap *Snapshot) (bool, error) {
+	changed := false
+
+	for path, content := range snap.files {
+		if content == nil {
+			if err := os.Remove(path); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return changed, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			g.log.Logf("INFO [Generator] removed config path=%s (absent before start)", path)
+			changed = true
+			continue
+		}
+
+		written, err := g.writeIfChanged(path, content)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || written
+	}
+
+	keep := make([]string, 0, len(snap.files))
+	for path, content := range snap.files {
+		if content != nil {
+			keep = append(keep, path)
+		}
+	}
+	if err := g.removeStaleNamespaces(keep); err != nil {
+		return changed, fmt.Errorf("failed to remove namespace configs: %w", err)
+	}
+
+	return changed, nil
+}
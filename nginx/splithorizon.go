@@ -0,0 +1,33 @@
+package nginx
+
+import (
+	"fmt"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// DefaultInternalCIDRs are the private and loopback networks proxy.http.internal_only serves
+const DefaultInternalCIDRs = "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.0/8,fc00::/7,::1"
+
+// InternalNetworks are the client networks of proxy.http.internal_only routes and the status
+// other clients get from them and from proxy.http.allow_from routes
+type InternalNetworks struct {
+	CIDRs      []string // empty skips internal_only routes instead of serving them to everyone
+	DenyStatus int      // 403, or 444 to close the connection without a response
+}
+
+// NewInternalNetworks parses comma-separated CIDRs and the deny status, 0 is 403
+func NewInternalNetworks(cidrs string, denyStatus int) (InternalNetworks, error) {
+	parsed, err := docker.ParseCIDRs(cidrs)
+	if err != nil {
+		return InternalNetworks{}, fmt.Errorf("invalid internal CIDRs: %w", err)
+	}
+	switch denyStatus {
+	case 0:
+		denyStatus = 403
+	case 403, 444:
+	default:
+		return InternalNetworks{}, fmt.Errorf("invalid internal deny status %d, expected 403 or 444", denyStatus)
+	}
+	return InternalNetworks{CIDRs: parsed, DenyStatus: denyStatus}, nil
+}
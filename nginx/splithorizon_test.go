@@ -0,0 +1,22 @@
+package nginx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewInternalNetworks(t *testing.T) {
+	got, err := NewInternalNetworks(DefaultInternalCIDRs, 0)
+	if err != nil || got.DenyStatus != 403 || !slices.Contains(got.CIDRs, "fc00::/7") {
+		t.Errorf("NewInternalNetworks() = %+v, %v, want the default networks with 403", got, err)
+	}
+	if got, err := NewInternalNetworks("", 444); err != nil || got.CIDRs != nil || got.DenyStatus != 444 {
+		t.Errorf("NewInternalNetworks(\"\") = %+v, %v, want no networks", got, err)
+	}
+	if _, err := NewInternalNetworks("10.0.0.0/8", 404); err == nil {
+		t.Error("NewInternalNetworks() should refuse status 404")
+	}
+	if _, err := NewInternalNetworks("intranet", 403); err == nil {
+		t.Error("NewInternalNetworks() should refuse an invalid CIDR")
+	}
+}
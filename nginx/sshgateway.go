@@ -0,0 +1,113 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// sshGatewayName is the owner of the gateway port in conflict errors
+const sshGatewayName = "ssh-gateway"
+
+// certPathRe matches absolute certificate paths nginx reads without quoting
+var certPathRe = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+
+// SSHGateway routes SSH on one stream port to containers by their proxy.ssh.alias
+// SSH has no SNI, so clients wrap it in TLS, e.g. with openssl s_client as ProxyCommand,
+// and send the alias as server name; nginx terminates TLS and passes plain SSH on
+// The zero value disables the gateway
+type SSHGateway struct {
+	Port int    // listen port, 0 disables the gateway
+	Cert string // certificate of the TLS listener
+	Key  string
+}
+
+// NewSSHGateway validates the gateway settings, port 0 disables it
+// The certificate is required, the stream block of nginx.conf has none to fall back to
+func NewSSHGateway(port int, cert, key string) (SSHGateway, error) {
+	if port == 0 {
+		return SSHGateway{}, nil
+	}
+	if port < 1 || port > 65535 {
+		return SSHGateway{}, fmt.Errorf("invalid SSH gateway port %d", port)
+	}
+	if cert == "" || key == "" {
+		return SSHGateway{}, fmt.Errorf("SSH gateway requires --ssh-gateway-cert and --ssh-gateway-key, its TLS listener has no other certificate")
+	}
+	for _, path := range []string{cert, key} {
+		if !certPathRe.MatchString(path) {
+			return SSHGateway{}, fmt.Errorf("invalid SSH gateway certificate path %q, expected an absolute path", path)
+		}
+	}
+	return SSHGateway{Port: port, Cert: cert, Key: key}, nil
+}
+
+// SSHRoute is one alias of the SSH gateway
+type SSHRoute struct {
+	Alias         string
+	Address       string // ip:port of the container's SSH server
+	ContainerName string
+}
+
+// sshRoutes returns the gateway routes of all containers sorted by alias
+// An alias claimed by two containers is a conflict
+func sshRoutes(containers []docker.ContainerInfo) ([]SSHRoute, error) {
+	owners := make(map[string]string)
+	var routes []SSHRoute
+	for _, container := range containers {
+		if container.SSH == nil {
+			continue
+		}
+		for _, alias := range container.SSH.Aliases {
+			if existing, exists := owners[alias]; exists {
+				return nil, conflictf("SSH alias conflict: %s claimed by both %s and %s", alias, existing, container.Name)
+			}
+			owners[alias] = container.Name
+			routes = append(routes, SSHRoute{
+				Alias:         alias,
+				Address:       net.JoinHostPort(container.IP, strconv.Itoa(container.SSH.ContainerPort)),
+				ContainerName: container.Name,
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Alias < routes[j].Alias })
+	return routes, nil
+}
+
+// withoutSSH drops the gateway aliases of containers while the gateway is disabled,
+// so they are neither rendered nor reported as routes
+func (g *Generator) withoutSSH(containers []docker.ContainerInfo) []docker.ContainerInfo {
+	if g.opts.SSHGateway.Port != 0 {
+		return containers
+	}
+	var filtered []docker.ContainerInfo
+	for i, container := range containers {
+		if container.SSH == nil {
+			continue
+		}
+		if filtered == nil {
+			filtered = append([]docker.ContainerInfo{}, containers...)
+		}
+		g.log.Logf("WARN [Generator] container=%s proxy.ssh.alias ignored, the SSH gateway is disabled", container.Name)
+		filtered[i].SSH = nil
+	}
+	if filtered == nil {
+		return containers
+	}
+	return filtered
+}
+
+// sshGatewayClaim presents the gateway port as a stream container for the conflict checks
+func sshGatewayClaim(streamData StreamData) []StreamContainer {
+	if len(streamData.SSHRoutes) == 0 {
+		return nil
+	}
+	return []StreamContainer{{
+		Name:        sshGatewayName,
+		TCPMappings: []StreamMapping{{ProxyPort: streamData.SSHGateway.Port}},
+	}}
+}
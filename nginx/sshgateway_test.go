@@ -0,0 +1,111 @@
+package nginx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewSSHGateway(t *testing.T) {
+	tests := []struct {
+		port      int
+		cert, key string
+		wantErr   bool
+	}{
+		{port: 2222, cert: "/etc/nginx/ssl/ssh.crt", key: "/etc/nginx/ssl/ssh.key"},
+		{port: 2222, wantErr: true},
+		{port: 0, cert: "ignored"},
+		{port: 70000, wantErr: true},
+		{port: 2222, cert: "/etc/nginx/ssl/ssh.crt", wantErr: true},
+		{port: 2222, cert: "ssh.crt", key: "ssh.key", wantErr: true},
+		{port: 2222, cert: "/etc/ssh.crt; include /etc/passwd", key: "/etc/ssh.key", wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := NewSSHGateway(tt.port, tt.cert, tt.key); (err != nil) != tt.wantErr {
+			t.Errorf("NewSSHGateway(%d, %q, %q) error = %v, wantErr %t", tt.port, tt.cert, tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateSSHGateway(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+
+	newGenerator := func(port int) *Generator {
+		gen, err := NewGenerator(streamPath, filepath.Join(tmpDir, "http.conf"), lgr.New())
+		if err != nil {
+			t.Fatalf("NewGenerator() error = %v", err)
+		}
+		gateway, err := NewSSHGateway(port, "/etc/nginx/ssl/ssh.crt", "/etc/nginx/ssl/ssh.key")
+		if err != nil {
+			t.Fatalf("NewSSHGateway() error = %v", err)
+		}
+		gen.SetOptions(Options{SSHGateway: gateway})
+		return gen
+	}
+	containers := []docker.ContainerInfo{
+		{Name: "db", IP: "172.17.0.2", SSH: &docker.SSHMapping{Aliases: []string{"db-shell"}, ContainerPort: 22}},
+		{Name: "git", IP: "172.17.0.3", Namespace: "team-a",
+			SSH: &docker.SSHMapping{Aliases: []string{"git", "backup.lan"}, ContainerPort: 2222}},
+	}
+
+	report, err := newGenerator(2200).Generate(containers)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	stream := readConfig(t, streamPath)
+	for _, want := range []string{
+		"map $ssl_server_name $proxy_ssh_upstream {\n" +
+			"    backup.lan 172.17.0.3:2222; # git\n" +
+			"    db-shell 172.17.0.2:22; # db\n" +
+			"    git 172.17.0.3:2222; # git\n}",
+		"listen 2200 ssl;\n    ssl_certificate /etc/nginx/ssl/ssh.crt;\n    ssl_certificate_key /etc/nginx/ssl/ssh.key;",
+		"proxy_pass $proxy_ssh_upstream;",
+	} {
+		if !strings.Contains(stream, want) {
+			t.Errorf("stream config missing %q:\n%s", want, stream)
+		}
+	}
+	if got := report.Routes.Containers[0].Routes; len(got) != 1 || got[0] != "ssh:db-shell -> 172.17.0.2:22" {
+		t.Errorf("routes of db = %v, want the SSH alias", got)
+	}
+
+	// the gateway port is claimed like a TCP port, aliases once
+	conflicts := []struct {
+		name      string
+		container docker.ContainerInfo
+		wantErr   string
+	}{
+		{"port", docker.ContainerInfo{Name: "sshd", IP: "172.17.0.4",
+			Mappings: []docker.PortMapping{{ProxyPort: 2200, ContainerPort: 22, Protocol: docker.TCP}}},
+			"TCP port conflict: port 2200 claimed by both"},
+		{"alias", docker.ContainerInfo{Name: "db2", IP: "172.17.0.5", SSH: &docker.SSHMapping{Aliases: []string{"db-shell"}, ContainerPort: 22}},
+			"SSH alias conflict: db-shell claimed by both db and db2"},
+	}
+	for _, tt := range conflicts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newGenerator(2200).Generate(append(append([]docker.ContainerInfo{}, containers...), tt.container))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// aliases are ignored while the gateway is disabled
+	report, err = newGenerator(0).Generate(containers)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if stream := readConfig(t, streamPath); strings.Contains(stream, "proxy_ssh_upstream") {
+		t.Errorf("stream config has the disabled gateway:\n%s", stream)
+	}
+	if got := report.Routes.Containers[0].Routes; len(got) != 0 {
+		t.Errorf("routes of db = %v, want none without the gateway", got)
+	}
+	if containers[0].SSH == nil {
+		t.Error("Generate() modified the containers passed in")
+	}
+}
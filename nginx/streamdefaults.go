@@ -0,0 +1,52 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// streamTimeRe matches nginx times such as 30s, 500ms or 1h
+var streamTimeRe = regexp.MustCompile(`^[1-9][0-9]*(ms|s|m|h|d)?$`)
+
+// StreamDefaults holds settings of all stream servers, written once at stream level
+// The zero value keeps the timeouts each server sets itself
+type StreamDefaults struct {
+	ProxyTimeout   string // proxy_timeout of TCP servers instead of their 5m, UDP servers keep 30s
+	ConnectTimeout string // proxy_connect_timeout of TCP servers instead of their 10s
+	PrereadTimeout string // preread_timeout, empty keeps the nginx default
+	TCPNodelay     string // tcp_nodelay on or off, empty keeps the nginx default
+}
+
+// NewStreamDefaults validates the stream defaults, empty values are left out
+func NewStreamDefaults(proxyTimeout, connectTimeout, prereadTimeout, tcpNodelay string) (StreamDefaults, error) {
+	d := StreamDefaults{}
+	for _, setting := range []struct {
+		directive string
+		value     string
+		dst       *string
+	}{
+		{"proxy_timeout", proxyTimeout, &d.ProxyTimeout},
+		{"proxy_connect_timeout", connectTimeout, &d.ConnectTimeout},
+		{"preread_timeout", prereadTimeout, &d.PrereadTimeout},
+	} {
+		value := strings.ToLower(strings.TrimSpace(setting.value))
+		if value != "" && !streamTimeRe.MatchString(value) {
+			return StreamDefaults{}, fmt.Errorf("invalid %s %q, expected a time like 30s or 1h", setting.directive, setting.value)
+		}
+		*setting.dst = value
+	}
+
+	switch nodelay := strings.ToLower(strings.TrimSpace(tcpNodelay)); nodelay {
+	case "", "on", "off":
+		d.TCPNodelay = nodelay
+	default:
+		return StreamDefaults{}, fmt.Errorf("invalid tcp_nodelay %q, expected on or off", tcpNodelay)
+	}
+	return d, nil
+}
+
+// Set reports whether any default is written to the stream config
+func (d StreamDefaults) Set() bool {
+	return d != StreamDefaults{}
+}
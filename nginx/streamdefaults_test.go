@@ -0,0 +1,97 @@
+package nginx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewStreamDefaults(t *testing.T) {
+	tests := []struct {
+		proxyTimeout, connectTimeout, prereadTimeout, tcpNodelay string
+		want                                                     StreamDefaults
+		wantErr                                                  bool
+	}{
+		{proxyTimeout: "1h", connectTimeout: " 5S ", prereadTimeout: "500ms", tcpNodelay: "OFF",
+			want: StreamDefaults{ProxyTimeout: "1h", ConnectTimeout: "5s", PrereadTimeout: "500ms", TCPNodelay: "off"}},
+		{proxyTimeout: "600", want: StreamDefaults{ProxyTimeout: "600"}},
+		{},
+		{proxyTimeout: "0s", wantErr: true},
+		{connectTimeout: "5 s", wantErr: true},
+		{prereadTimeout: "30s; include /etc/passwd", wantErr: true},
+		{tcpNodelay: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewStreamDefaults(tt.proxyTimeout, tt.connectTimeout, tt.prereadTimeout, tt.tcpNodelay)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NewStreamDefaults(%q, %q, %q, %q) = %+v, %v, want %+v (error %t)",
+				tt.proxyTimeout, tt.connectTimeout, tt.prereadTimeout, tt.tcpNodelay, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if (StreamDefaults{}).Set() || !(StreamDefaults{TCPNodelay: "on"}).Set() {
+		t.Error("Set() wrong for empty or partial defaults")
+	}
+}
+
+func TestGenerateStreamDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+
+	gen, err := NewGenerator(streamPath, filepath.Join(tmpDir, "http.conf"), lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	defaults, err := NewStreamDefaults("1h", "", "", "on")
+	if err != nil {
+		t.Fatalf("NewStreamDefaults() error = %v", err)
+	}
+	gen.SetOptions(Options{StreamDefaults: defaults})
+
+	containers := []docker.ContainerInfo{
+		{
+			Name:     "postgres",
+			IP:       "172.17.0.2",
+			Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP}},
+		},
+		{
+			Name:     "dns",
+			IP:       "172.17.0.3",
+			Mappings: []docker.PortMapping{{ProxyPort: 53, ContainerPort: 53, Protocol: docker.UDP}},
+		},
+		{
+			Name:      "redis",
+			IP:        "172.17.0.4",
+			Namespace: "team-a",
+			Mappings:  []docker.PortMapping{{ProxyPort: 6379, ContainerPort: 6379, Protocol: docker.TCP}},
+		},
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	stream := readConfig(t, streamPath)
+	for _, want := range []string{
+		"# Defaults of all stream servers\nproxy_timeout 1h;\ntcp_nodelay on;\n",
+		"proxy_connect_timeout 10s;", // no default, servers keep their own
+		"proxy_timeout 30s;",         // UDP servers keep theirs
+	} {
+		if !strings.Contains(stream, want) {
+			t.Errorf("stream config missing %q:\n%s", want, stream)
+		}
+	}
+	if strings.Contains(stream, "proxy_timeout 5m;") || strings.Contains(stream, "preread_timeout") {
+		t.Errorf("stream config overrides the defaults:\n%s", stream)
+	}
+
+	// namespace configs are included at stream level and inherit the defaults
+	namespace := readConfig(t, NamespacePath(streamPath, "team-a"))
+	if strings.Contains(namespace, "Defaults of all stream servers") || strings.Contains(namespace, "proxy_timeout 5m;") {
+		t.Errorf("namespace stream config repeats or overrides the defaults:\n%s", namespace)
+	}
+	if !strings.Contains(namespace, "listen 6379;") {
+		t.Errorf("namespace stream config missing its server:\n%s", namespace)
+	}
+}
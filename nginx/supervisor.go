@@ -0,0 +1,108 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Supervisor runs nginx as a foreground child process of the proxy
+type Supervisor struct {
+	startCmd string
+	log      *lgr.Logger
+	cmd      *exec.Cmd
+	done     chan struct{}
+	exitCode int
+	err      error
+}
+
+// NewSupervisor creates a new Nginx supervisor
+// startCmd must keep nginx in the foreground (e.g. nginx -g 'daemon off;')
+func NewSupervisor(startCmd string, log *lgr.Logger) *Supervisor {
+	return &Supervisor{
+		startCmd: startCmd,
+		log:      log,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start launches nginx and returns immediately
+// The child inherits stdout/stderr so nginx logs end up in the container output
+func (s *Supervisor) Start() error {
+	s.log.Logf("INFO [Supervisor] starting nginx start_cmd=%s", s.startCmd)
+
+	// no shell in between, signals are delivered to nginx directly
+	cmd, err := buildCommand(s.startCmd)
+	if err != nil {
+		return fmt.Errorf("invalid nginx command: %w", err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start nginx: %w", err)
+	}
+	s.cmd = cmd
+
+	s.log.Logf("INFO [Supervisor] nginx started pid=%d", cmd.Process.Pid)
+
+	go s.wait()
+
+	return nil
+}
+
+// wait blocks until nginx exits and records its exit status
+func (s *Supervisor) wait() {
+	err := s.cmd.Wait()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		s.exitCode = 0
+	case errors.As(err, &exitErr):
+		s.exitCode = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// killed by a signal, mirror the shell convention, e.g. 137 for SIGKILL and the OOM killer
+			s.exitCode = 128 + int(status.Signal())
+		}
+	default:
+		s.exitCode = 1
+		s.err = err
+	}
+
+	s.log.Logf("INFO [Supervisor] nginx exited code=%d", s.exitCode)
+	close(s.done)
+}
+
+// Signal forwards a signal to the nginx master process
+func (s *Supervisor) Signal(sig os.Signal) error {
+	if s.cmd == nil || s.cmd.Process == nil {
+		return errors.New("nginx is not running")
+	}
+
+	s.log.Logf("DEBUG [Supervisor] forwarding signal=%s pid=%d", sig, s.cmd.Process.Pid)
+
+	if err := s.cmd.Process.Signal(sig); err != nil {
+		return fmt.Errorf("failed to signal nginx: %w", err)
+	}
+	return nil
+}
+
+// Done returns a channel closed when nginx exits
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// ExitCode returns the nginx exit code, only valid after Done is closed
+func (s *Supervisor) ExitCode() int {
+	return s.exitCode
+}
+
+// Err returns a non-exit error from waiting on nginx, only valid after Done is closed
+func (s *Supervisor) Err() error {
+	return s.err
+}
@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+func TestSupervisor(t *testing.T) {
+	log := lgr.New()
+
+	t.Run("propagates exit code", func(t *testing.T) {
+		s := NewSupervisor("sh -c 'exit 3'", log)
+		if err := s.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+
+		select {
+		case <-s.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("process did not exit")
+		}
+
+		if s.ExitCode() != 3 {
+			t.Errorf("ExitCode() = %d, want 3", s.ExitCode())
+		}
+	})
+
+	t.Run("forwards signals to child", func(t *testing.T) {
+		s := NewSupervisor("sleep 30", log)
+		if err := s.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+
+		if err := s.Signal(syscall.SIGTERM); err != nil {
+			t.Fatalf("Signal() error = %v", err)
+		}
+
+		select {
+		case <-s.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("process did not exit after SIGTERM")
+		}
+
+		if s.ExitCode() != 128+15 {
+			t.Errorf("ExitCode() = %d, want 143 after SIGTERM", s.ExitCode())
+		}
+	})
+
+	t.Run("reports the signal that killed the child", func(t *testing.T) {
+		s := NewSupervisor("sleep 30", log)
+		if err := s.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+
+		if err := s.Signal(syscall.SIGKILL); err != nil {
+			t.Fatalf("Signal() error = %v", err)
+		}
+
+		select {
+		case <-s.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("process did not exit after SIGKILL")
+		}
+
+		if s.ExitCode() != 128+9 {
+			t.Errorf("ExitCode() = %d, want 137 after SIGKILL", s.ExitCode())
+		}
+	})
+
+	t.Run("signal before start fails", func(t *testing.T) {
+		s := NewSupervisor("sleep 30", log)
+		if err := s.Signal(syscall.SIGTERM); err == nil {
+			t.Error("expected error when signaling a process that was not started")
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// syslogFacilities are the facilities nginx accepts for syslog logging
+var syslogFacilities = map[string]bool{
+	"kern": true, "user": true, "mail": true, "daemon": true, "auth": true, "intern": true,
+	"lpr": true, "news": true, "uucp": true, "clock": true, "authpriv": true, "ftp": true,
+	"ntp": true, "audit": true, "alert": true, "cron": true,
+	"local0": true, "local1": true, "local2": true, "local3": true,
+	"local4": true, "local5": true, "local6": true, "local7": true,
+}
+
+// syslogServerRe matches host[:port], [ipv6][:port] or unix:/path
+var syslogServerRe = regexp.MustCompile(`^(unix:/[A-Za-z0-9._/-]+|[A-Za-z0-9.-]+(:[0-9]{1,5})?|\[[0-9A-Fa-f:.]+\](:[0-9]{1,5})?)$`)
+
+// SyslogTarget builds the syslog:server=... log destination for access_log and error_log,
+// empty if server is empty. Tags are appended per directive
+func SyslogTarget(server, facility string) (string, error) {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return "", nil
+	}
+	if !syslogServerRe.MatchString(server) {
+		return "", fmt.Errorf("invalid syslog server %q, expected host[:port] or unix:/path", server)
+	}
+
+	target := "syslog:server=" + server
+	if facility = strings.ToLower(strings.TrimSpace(facility)); facility != "" {
+		if !syslogFacilities[facility] {
+			return "", fmt.Errorf("invalid syslog facility %q", facility)
+		}
+		target += ",facility=" + facility
+	}
+	return target, nil
+}
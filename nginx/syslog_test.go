@@ -0,0 +1,33 @@
+package nginx
+
+import "testing"
+
+func TestSyslogTarget(t *testing.T) {
+	tests := []struct {
+		server   string
+		facility string
+		want     string
+		wantErr  bool
+	}{
+		{server: "", want: ""},
+		{server: "10.0.0.5", want: "syslog:server=10.0.0.5"},
+		{server: "logs.example.com:5514", facility: "Local3", want: "syslog:server=logs.example.com:5514,facility=local3"},
+		{server: "[2001:db8::1]:514", want: "syslog:server=[2001:db8::1]:514"},
+		{server: "unix:/dev/log", want: "syslog:server=unix:/dev/log"},
+		{server: "10.0.0.5 tag=evil;", wantErr: true},
+		{server: "10.0.0.5,facility=kern", wantErr: true},
+		{server: "10.0.0.5", facility: "local9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server+"/"+tt.facility, func(t *testing.T) {
+			got, err := SyslogTarget(tt.server, tt.facility)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyslogTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SyslogTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
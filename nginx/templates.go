@@ -1,35 +1,140 @@
 package nginx
 
+// BackendCAFile is the CA bundle HTTPS backend certificates are verified against
+const BackendCAFile = "/etc/ssl/certs/ca-certificates.crt"
+
 // StreamTemplate is the Nginx stream module configuration template
 // Generates TCP and UDP proxy server blocks with upstream definitions
 const StreamTemplate = `# Auto-generated by proxy-nginx at {{.Timestamp}}
 # DO NOT EDIT MANUALLY - Changes will be overwritten
+{{- if .Namespace}}
+# Namespace: {{.Namespace}}
+{{- end}}
+{{if .Skipped}}
+# ---------------------------------------------------------------
+# SKIPPED CONTAINERS - not routed by this config
+{{- range .Skipped}}
+#   {{.Name}} ({{.ID}}): {{.Reason}}
+{{- end}}
+# ---------------------------------------------------------------
+{{end}}
+{{- if and .Syslog (not .Namespace)}}
+# Logs shipped to syslog
+log_format proxy_stream '$remote_addr [$time_local] $protocol $status '
+                        '$bytes_sent $bytes_received $session_time "$upstream_addr"';
+access_log {{.Syslog}},tag=nginx_stream proxy_stream;
+error_log {{.Syslog}},tag=nginx_error warn;
+{{end}}
+{{- if and .Resolver (not .Namespace)}}
+# DNS servers for names resolved at runtime
+resolver {{.Resolver}};
+{{end}}
+{{- if and .Defaults.Set (not .Namespace)}}
+# Defaults of all stream servers
+{{- if .Defaults.ProxyTimeout}}
+proxy_timeout {{.Defaults.ProxyTimeout}};
+{{- end}}
+{{- if .Defaults.ConnectTimeout}}
+proxy_connect_timeout {{.Defaults.ConnectTimeout}};
+{{- end}}
+{{- if .Defaults.PrereadTimeout}}
+preread_timeout {{.Defaults.PrereadTimeout}};
+{{- end}}
+{{- if .Defaults.TCPNodelay}}
+tcp_nodelay {{.Defaults.TCPNodelay}};
+{{- end}}
+{{end}}
+{{- range .Includes}}
+include {{.}};
+{{- end}}
+{{- if not .Namespace}}{{range .Plugins}}
+
+# Plugin: {{.Name}}
+{{.Config}}
+{{- end}}{{end}}
+{{- if and .SSHRoutes (not .Namespace)}}
+
+# SSH gateway: TLS-wrapped SSH, routed by the alias clients send as server name
+map $ssl_server_name $proxy_ssh_upstream {
+{{- range .SSHRoutes}}
+    {{.Alias}} {{.Address}}; # {{.ContainerName}}
+{{- end}}
+}
 
+server {
+    listen {{.SSHGateway.Port}} ssl;
+    ssl_certificate {{.SSHGateway.Cert}};
+    ssl_certificate_key {{.SSHGateway.Key}};
+    proxy_pass $proxy_ssh_upstream;
+{{- if not .Defaults.ConnectTimeout}}
+    proxy_connect_timeout 10s;
+{{- end}}
+{{- if not .Defaults.ProxyTimeout}}
+    proxy_timeout 5m;
+{{- end}}
+}
+{{- end}}
 {{range .Containers}}
 {{if or .TCPMappings .UDPMappings}}
 # Container: {{.Name}} ({{.ID}})
+{{- if .Owner}}
+# Owner: {{.Owner}}
+{{- end}}
 {{range .TCPMappings}}
 upstream tcp_{{.ProxyPort}} {
+{{- if $.ZoneSize}}
+    zone tcp_{{.ProxyPort}} {{$.ZoneSize}};
+{{- end}}
+{{- if .Hash}}
+    hash {{.Hash}} consistent;
+{{- end}}
     server {{.ContainerIP}}:{{.ContainerPort}};
+{{- range .Replicas}}
+    server {{.Address}}; # {{.Name}}
+{{- end}}
 }
+{{- if .MaxConnections}}
+
+limit_conn_zone $server_port zone=tcp_{{.ProxyPort}}_conn:1m;
+{{- end}}
 
 server {
     listen {{.ProxyPort}};
     proxy_pass tcp_{{.ProxyPort}};
+{{- if .MaxConnections}}
+    limit_conn tcp_{{.ProxyPort}}_conn {{.MaxConnections}};
+{{- end}}
+{{- if .ConnectTimeout}}
+    proxy_connect_timeout {{.ConnectTimeout}};
+{{- else if not $.Defaults.ConnectTimeout}}
     proxy_connect_timeout 10s;
+{{- end}}
+{{- if .Timeout}}
+    proxy_timeout {{.Timeout}};
+{{- else if not $.Defaults.ProxyTimeout}}
     proxy_timeout 5m;
+{{- end}}
     proxy_buffer_size 16k;
 }
 {{end}}
 {{range .UDPMappings}}
 upstream udp_{{.ProxyPort}} {
+{{- if $.ZoneSize}}
+    zone udp_{{.ProxyPort}} {{$.ZoneSize}};
+{{- end}}
+{{- if .Hash}}
+    hash {{.Hash}} consistent;
+{{- end}}
     server {{.ContainerIP}}:{{.ContainerPort}};
+{{- range .Replicas}}
+    server {{.Address}}; # {{.Name}}
+{{- end}}
 }
 
 server {
     listen {{.ProxyPort}} udp;
     proxy_pass udp_{{.ProxyPort}};
-    proxy_timeout 30s;
+    proxy_timeout {{if .Timeout}}{{.Timeout}}{{else}}30s{{end}};
     proxy_responses 1;
     proxy_buffer_size 16k;
 }
@@ -42,25 +147,499 @@ server {
 // Generates HTTP server blocks with hostname-based routing and proxy headers
 const HTTPTemplate = `# Auto-generated by proxy-nginx at {{.Timestamp}}
 # DO NOT EDIT MANUALLY - Changes will be overwritten
+{{- if .Namespace}}
+# Namespace: {{.Namespace}}
+{{- end}}
+{{if .Skipped}}
+# ---------------------------------------------------------------
+# SKIPPED CONTAINERS - not routed by this config
+{{- range .Skipped}}
+#   {{.Name}} ({{.ID}}): {{.Reason}}
+{{- end}}
+# ---------------------------------------------------------------
+{{end}}
+{{- if and .Syslog (not .Namespace)}}
+# Logs shipped to syslog, next to the access logs configured in nginx.conf
+access_log {{.Syslog}},tag=nginx_access combined;
+error_log {{.Syslog}},tag=nginx_error warn;
+{{end}}
+{{- if and .Resolver (not .Namespace)}}
+# DNS servers for names resolved at runtime, e.g. by OCSP stapling or variables in proxy_pass
+resolver {{.Resolver}};
+{{end}}
+{{- if and .AccessLogJSON (not .Namespace)}}
+# JSON access log for per-host metrics
+log_format proxy_json escape=json '{"time":"$time_iso8601","host":"$server_name","status":$status,'
+                                  '"request_time":$request_time,"method":"$request_method",'
+                                  '"request_length":$request_length,"bytes_sent":$bytes_sent,"body_bytes_sent":$body_bytes_sent,'
+                                  '"upstream_connect_time":"$upstream_connect_time","upstream_header_time":"$upstream_header_time",'
+                                  '"upstream_response_time":"$upstream_response_time",'
+                                  '"remote_addr":"$remote_addr"{{if .RequestID}},"request_id":"$proxy_request_id"{{end}}}';
+access_log {{.AccessLogJSON}} proxy_json;
+{{end}}
+{{- if and (or .SSLSessionCache .SSLSessionTimeout .SessionTicketKeys) (not .Namespace)}}
+# TLS session resumption for HTTPS listeners
+{{- if .SSLSessionCache}}
+ssl_session_cache {{.SSLSessionCache}};
+{{- end}}
+{{- if .SSLSessionTimeout}}
+ssl_session_timeout {{.SSLSessionTimeout}};
+{{- end}}
+{{- range .SessionTicketKeys}}
+ssl_session_ticket_key {{.}};
+{{- end}}
+{{end}}
+{{- if and (or .ClientHeaderBufferSize .LargeClientHeaderBuffers) (not .Namespace)}}
+# Request header buffers, for big cookies and long URLs
+{{- if .ClientHeaderBufferSize}}
+client_header_buffer_size {{.ClientHeaderBufferSize}};
+{{- end}}
+{{- if .LargeClientHeaderBuffers}}
+large_client_header_buffers {{.LargeClientHeaderBuffers}};
+{{- end}}
+{{end}}
+{{- if and .TrustedProxies (not .Namespace)}}
+# Proxies in front of nginx: the client address is read from their X-Forwarded-For,
+# their forwarded headers are passed on and the ones of other peers replaced
+{{- range .TrustedProxies}}
+set_real_ip_from {{.}};
+{{- end}}
+real_ip_header X-Forwarded-For;
+real_ip_recursive on;
+
+geo $realip_remote_addr $proxy_trusted_peer {
+    default 0;
+{{- range .TrustedProxies}}
+    {{.}} 1;
+{{- end}}
+}
 
+map "$proxy_trusted_peer:$http_x_forwarded_for" $proxy_forwarded_for {
+    default "$realip_remote_addr";
+    "~^1:." "$http_x_forwarded_for, $realip_remote_addr";
+}
+
+map "$proxy_trusted_peer:$http_x_forwarded_proto" $proxy_forwarded_proto {
+    default   $scheme;
+    "1:http"  http;
+    "1:https" https;
+}
+
+map "$proxy_trusted_peer:$http_x_forwarded_host" $proxy_forwarded_host {
+    default $host;
+    "~^1:(?<proxy_trusted_host>[A-Za-z0-9.-]+(:[0-9]+)?)$" $proxy_trusted_host;
+}
+{{end}}
+{{- if and .GeoIPDB (not .Namespace)}}
+# Country lookup for proxy.http.geo.* rules
+geoip2 {{.GeoIPDB}} {
+    $proxy_geoip_country_code country iso_code;
+}
+{{end}}
+{{- if and .BotPatterns (not .Namespace)}}
+# User agents blocked on proxy.http.block_bots hosts
+map $http_user_agent $proxy_bad_bot {
+    default 0;
+{{- range .BotPatterns}}
+    "~*{{.}}" 1;
+{{- end}}
+}
+{{end}}
+{{- if and .RequestID (not .Namespace)}}
+# Request IDs, kept from the client or generated
+map $http_x_request_id $proxy_request_id {
+    default $http_x_request_id;
+    ""      $request_id;
+}
+
+log_format proxy_request_id '$remote_addr - $remote_user [$time_local] "$request" '
+                            '$status $body_bytes_sent "$http_referer" '
+                            '"$http_user_agent" request_id=$proxy_request_id';
+{{end}}
+{{- if not .Namespace}}{{range .LogSamples}}
+# Access log sampling: {{.Percent}} of successful requests, all errors
+{{- if ne .Percent "0%"}}
+split_clients $request_id $proxy_log_sampled_{{.Name}} {
+    {{.Percent}} 1;
+    *    0;
+}
+{{- end}}
+map $status $proxy_log_{{.Name}} {
+    ~^[45]  1;
+    default {{if ne .Percent "0%"}}$proxy_log_sampled_{{.Name}}{{else}}0{{end}};
+}
+{{end}}{{end}}
+{{- if and .SecretsInclude (not .Namespace)}}
+# Upstream credentials, kept in a private file
+include {{.SecretsInclude}};
+{{end}}
+{{- range .Includes}}
+include {{.}};
+{{- end}}
+{{- if not .Namespace}}{{range .Plugins}}
+
+# Plugin: {{.Name}}
+{{.Config}}
+{{- end}}{{end}}
 {{range .HTTPServers}}
 # Container: {{.ContainerName}} ({{.ContainerID}})
+{{- if .Owner}}
+# Owner: {{.Owner}}
+{{- end}}
+{{- if .Audience}}
+# Audience: {{.Audience}}
+{{- end}}
+{{- if .Preset}}
+# Preset: {{.Preset}}
+{{- end}}
+{{- if .Restarting}}
+# Restarting: container gone, restart page until {{.Restarting}}
+{{- end}}
+{{- if not .StaticRoot}}
 upstream {{.UpstreamName}} {
-    server {{.ContainerIP}}:{{.ContainerPort}};
+{{- if $.ZoneSize}}
+    zone {{.UpstreamName}} {{$.ZoneSize}};
+{{- end}}
+    server {{if .Socket}}unix:{{.Socket}}{{else}}{{.ContainerIP}}:{{.ContainerPort}}{{end}}{{.ServerParams}};
+{{- $serverParams := .ServerParams}}
+{{- range .Replicas}}
+    server {{.Address}}{{$serverParams}}; # {{.Name}}
+{{- end}}
+{{- with .HealthCheck}}
+    check interval={{.IntervalMS}} rise=2 fall={{.Fall}} timeout={{.TimeoutMS}} type={{.Type}};
+{{- if .Send}}
+    check_http_send "{{.Send}}";
+    check_http_expect_alive http_2xx http_3xx;
+{{- end}}
+{{- end}}
 }
+{{- end}}
+{{- if or .GeoAllow .GeoDeny}}
+
+map $proxy_geoip_country_code $proxy_geo_blocked_{{.UpstreamName}} {
+    default {{if .GeoAllow}}1{{else}}0{{end}};
+{{- range .GeoAllow}}
+    {{.}} 0;
+{{- end}}
+{{- range .GeoDeny}}
+    {{.}} 1;
+{{- end}}
+}
+{{- end}}
+{{- if .AllowFrom}}
+
+geo $proxy_client_denied_{{.UpstreamName}} {
+    default 1;
+{{- range .AllowFrom}}
+    {{.}} 0;
+{{- end}}
+}
+{{- end}}
+{{- if .LimitConn}}
+
+limit_conn_zone $binary_remote_addr zone={{.UpstreamName}}_conn:1m;
+{{- end}}
+{{- if and .Mirror (lt .Mirror.Percent 100)}}
+
+split_clients "${request_id}" $proxy_mirror_{{.UpstreamName}} {
+    {{.Mirror.Percent}}% 1;
+    * "";
+}
+{{- end}}
 
 server {
-    listen {{if .HTTPS}}443 ssl{{else}}80{{end}};
+    listen {{if .HTTPS}}443 ssl{{if .HTTP2}} http2{{end}}{{else}}80{{end}};
+{{- if .PlainHTTP}}
+    listen 80;
+{{- end}}
+{{- if .HTTP3}}
+    listen 443 quic{{if .QUICReuseport}} reuseport{{end}};
+    add_header Alt-Svc 'h3=":443"; ma=86400' always;
+{{- end}}
     server_name {{.Hostname}};
+{{- if .SecretsVersion}}
+    # secrets version {{.SecretsVersion}}
+{{- end}}
+{{- if or .RequestID .LogSample}}
+    access_log /var/log/nginx/access.log {{if .RequestID}}proxy_request_id{{else}}combined{{end}}{{if .LogSample}} if=${{.LogSample}}{{end}};
+{{- if $.Syslog}}
+    access_log {{$.Syslog}},tag=nginx_access {{if .RequestID}}proxy_request_id{{else}}combined{{end}}{{if .LogSample}} if=${{.LogSample}}{{end}};
+{{- end}}
+{{- if $.AccessLogJSON}}
+    access_log {{$.AccessLogJSON}} proxy_json;
+{{- end}}
+{{- end}}
+{{- if .RequestID}}
+    add_header X-Request-ID $proxy_request_id always;
+{{- end}}
+{{- if .WAFRules}}
+    modsecurity on;
+    modsecurity_rules_file {{.WAFRules}};
+{{- end}}
+{{- if .BlockBots}}
+    if ($proxy_bad_bot) {
+        return 403;
+    }
+{{- end}}
+{{- if .AllowedMethods}}
+    if ($request_method !~ ^({{.AllowedMethods}})$) {
+        return 405;
+    }
+{{- end}}
+{{- if .AllowFrom}}
+    # checked at server level, before any location is picked
+{{- if and $.ACMEChallengeAddr .ACME (or (not .HTTPS) .PlainHTTP)}}
+    if ($uri ~ ^/\.well-known/acme-challenge/) {
+        break;
+    }
+{{- end}}
+    if ($proxy_client_denied_{{.UpstreamName}}) {
+        return {{.DenyStatus}};
+    }
+{{- end}}
+{{- if .MaxBodySize}}
+    client_max_body_size {{.MaxBodySize}};
+{{- end}}
+{{- if .Resolver}}
+    resolver {{.Resolver}};
+{{- end}}
+{{- if .LimitConn}}
+    limit_conn {{.UpstreamName}}_conn {{.LimitConn}};
+    limit_conn_status 429;
+{{- end}}
+{{- if .LimitRate}}
+    limit_rate {{.LimitRate}};
+{{- end}}
+{{- if .HeaderBuffers}}
+    large_client_header_buffers {{.HeaderBuffers}};
+{{- end}}
+{{if .TLSCertFile}}
+    ssl_certificate {{.TLSCertFile}};
+    ssl_certificate_key {{.TLSKeyFile}};
+{{end}}
+{{- if and $.ACMEChallengeAddr .ACME (or (not .HTTPS) .PlainHTTP)}}
+    # ACME HTTP-01 challenges are answered by the proxy, even if the backend is down
+    location /.well-known/acme-challenge/ {
+        proxy_pass http://{{$.ACMEChallengeAddr}};
+    }
+{{end}}
+{{- if .OIDCVouch}}
+    # Single sign-on through Vouch Proxy, login and callback are served by Vouch
+    location = /validate {
+        internal;
+        proxy_pass {{.OIDCAuthURL}};
+        proxy_set_header Host $http_host;
+        proxy_set_header Content-Length "";
+        proxy_pass_request_body off;
+    }
 
+    location @proxy_oidc_login {
+        return 302 {{.OIDCLoginURL}}/login?url=$scheme://$http_host$request_uri&vouch-failcount=$proxy_oidc_failcount&X-Vouch-Token=$proxy_oidc_jwt&error=$proxy_oidc_error;
+    }
+
+    location = /vouch/sign_out {
+        return 302 {{.OIDCLoginURL}}/logout?url=$scheme://$http_host/;
+    }
+{{else if .OIDCAuthURL}}
+    # Single sign-on through oauth2-proxy: login, callback and sign-out under /oauth2/
+    location /oauth2/ {
+        proxy_pass {{.OIDCAuthURL}};
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header X-Auth-Request-Redirect $request_uri;
+    }
+
+    location = /oauth2/auth {
+        internal;
+        proxy_pass {{.OIDCAuthURL}};
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header X-Original-URI $request_uri;
+        proxy_set_header Content-Length "";
+        proxy_pass_request_body off;
+    }
+{{end}}
+{{- if .Mirror}}
+    # Copies of the requests for {{.Mirror.Target}}, their responses are discarded
+    location = /_proxy_mirror {
+        internal;
+{{- if lt .Mirror.Percent 100}}
+        if ($proxy_mirror_{{.UpstreamName}} = "") {
+            return 204;
+        }
+{{- end}}
+        proxy_pass http{{if .Mirror.HTTPS}}s{{end}}://{{.Mirror.Address}}$request_uri;
+        proxy_set_header Host {{or .Mirror.Host "$host"}};
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_connect_timeout 5s;
+    }
+{{end}}
     location / {
-        proxy_pass http://{{.UpstreamName}};
+{{- if or .GeoAllow .GeoDeny}}
+        if ($proxy_geo_blocked_{{.UpstreamName}}) {
+            return 403;
+        }
+{{- end}}
+{{- if .ValidReferers}}
+        valid_referers {{.ValidReferers}};
+        if ($invalid_referer) {
+            return 403;
+        }
+{{- end}}
+{{- if .AuthFile}}
+        auth_basic "Restricted";
+        auth_basic_user_file {{.AuthFile}};
+{{end}}
+{{- if .OIDCVouch}}
+        auth_request /validate;
+        auth_request_set $proxy_oidc_user $upstream_http_x_vouch_user;
+        auth_request_set $proxy_oidc_jwt $upstream_http_x_vouch_jwt;
+        auth_request_set $proxy_oidc_error $upstream_http_x_vouch_err;
+        auth_request_set $proxy_oidc_failcount $upstream_http_x_vouch_failcount;
+        error_page 401 = @proxy_oidc_login;
+{{else if .OIDCAuthURL}}
+        auth_request /oauth2/auth;
+        auth_request_set $proxy_oidc_user $upstream_http_x_auth_request_user;
+        auth_request_set $proxy_oidc_email $upstream_http_x_auth_request_email;
+        error_page 401 =302 /oauth2/start?rd=$scheme://$host$request_uri;
+{{end}}
+{{- if .Mirror}}
+        mirror /_proxy_mirror;
+        mirror_request_body on;
+{{- end}}
+{{- if .GRPC}}
+        grpc_pass {{if .BackendHTTPS}}grpcs{{else}}grpc{{end}}://{{.UpstreamName}};
+{{- if .BackendHTTPS}}
+
+        # TLS to the backend
+        grpc_ssl_server_name on;
+        grpc_ssl_name {{or .BackendSNI "$host"}};
+        grpc_ssl_verify {{if .BackendSSLVerify}}on{{else}}off{{end}};
+{{- if .BackendSSLVerify}}
+        grpc_ssl_trusted_certificate ` + BackendCAFile + `;
+{{- end}}
+{{- end}}
+
+        # gRPC headers
+        grpc_set_header Host {{or .UpstreamHost "$host"}};
+        grpc_set_header X-Real-IP $remote_addr;
+{{- if eq .Forwarded "strip"}}
+        grpc_set_header X-Forwarded-For "";
+        grpc_set_header X-Forwarded-Proto "";
+        grpc_set_header X-Forwarded-Host "";
+{{- else if eq .Forwarded "overwrite"}}
+        grpc_set_header X-Forwarded-For $remote_addr;
+        grpc_set_header X-Forwarded-Proto $scheme;
+        grpc_set_header X-Forwarded-Host $host;
+{{- else if $.TrustedProxies}}
+        grpc_set_header X-Forwarded-For $proxy_forwarded_for;
+        grpc_set_header X-Forwarded-Proto $proxy_forwarded_proto;
+        grpc_set_header X-Forwarded-Host $proxy_forwarded_host;
+{{- else}}
+        grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+{{- end}}
+{{- if .RequestID}}
+        grpc_set_header X-Request-ID $proxy_request_id;
+{{- end}}
+{{- if .UpstreamAuth}}
+        grpc_set_header Authorization ` + upstreamAuthVar + `;
+{{- end}}
+{{- range .PassVars}}
+        grpc_set_header {{.Header}} {{.Variable}};
+{{- end}}
+
+        # Timeouts, long enough for streaming calls
+        grpc_connect_timeout 60s;
+        grpc_send_timeout 1h;
+        grpc_read_timeout 1h;
+{{- if or .NextUpstream .NextUpstreamTries .NextUpstreamTimeout}}
+
+        # Failover to other replicas
+{{- if .NextUpstream}}
+        grpc_next_upstream {{.NextUpstream}};
+{{- end}}
+{{- if .NextUpstreamTries}}
+        grpc_next_upstream_tries {{.NextUpstreamTries}};
+{{- end}}
+{{- if .NextUpstreamTimeout}}
+        grpc_next_upstream_timeout {{.NextUpstreamTimeout}};
+{{- end}}
+{{- end}}
+{{- else if .StaticRoot}}
+        root {{.StaticRoot}};
+        index index.html;
+        try_files $uri $uri/ =404;
+
+        # Caching, expires sets Cache-Control so server level headers stay inherited
+        expires 1h;
+
+        location ~* \.(?:css|js|mjs|png|jpe?g|gif|svg|webp|avif|ico|woff2?)$ {
+{{- if or .GeoAllow .GeoDeny .ValidReferers}}
+            # rewrite directives are not inherited by nested locations
+{{- end}}
+{{- if or .GeoAllow .GeoDeny}}
+            if ($proxy_geo_blocked_{{.UpstreamName}}) {
+                return 403;
+            }
+{{- end}}
+{{- if .ValidReferers}}
+            if ($invalid_referer) {
+                return 403;
+            }
+{{- end}}
+            expires 7d;
+        }
+{{- else}}
+        proxy_pass {{if .BackendHTTPS}}https{{else}}http{{end}}://{{.UpstreamName}};
+{{- if .BackendHTTPS}}
+
+        # TLS to the backend
+        proxy_ssl_server_name on;
+        proxy_ssl_name {{or .BackendSNI "$host"}};
+        proxy_ssl_verify {{if .BackendSSLVerify}}on{{else}}off{{end}};
+{{- if .BackendSSLVerify}}
+        proxy_ssl_trusted_certificate ` + BackendCAFile + `;
+{{- end}}
+{{- end}}
 
         # Proxy headers
-        proxy_set_header Host $host;
+        proxy_set_header Host {{or .UpstreamHost "$host"}};
         proxy_set_header X-Real-IP $remote_addr;
+{{- if eq .Forwarded "strip"}}
+        proxy_set_header X-Forwarded-For "";
+        proxy_set_header X-Forwarded-Proto "";
+        proxy_set_header X-Forwarded-Host "";
+{{- else if eq .Forwarded "overwrite"}}
+        proxy_set_header X-Forwarded-For $remote_addr;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header X-Forwarded-Host $host;
+{{- else if $.TrustedProxies}}
+        proxy_set_header X-Forwarded-For $proxy_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $proxy_forwarded_proto;
+        proxy_set_header X-Forwarded-Host $proxy_forwarded_host;
+{{- else}}
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
         proxy_set_header X-Forwarded-Proto $scheme;
+{{- end}}
+{{- if .RequestID}}
+        proxy_set_header X-Request-ID $proxy_request_id;
+{{- end}}
+{{- if .OIDCAuthURL}}
+        proxy_set_header X-Forwarded-User $proxy_oidc_user;
+{{- if not .OIDCVouch}}
+        proxy_set_header X-Forwarded-Email $proxy_oidc_email;
+{{- end}}
+{{- end}}
+{{- if .UpstreamAuth}}
+        proxy_set_header Authorization ` + upstreamAuthVar + `;
+{{- end}}
+{{- range .PassVars}}
+        proxy_set_header {{.Header}} {{.Variable}};
+{{- end}}
 
         # WebSocket support
         proxy_http_version 1.1;
@@ -69,8 +648,91 @@ server {
 
         # Timeouts
         proxy_connect_timeout 60s;
-        proxy_send_timeout 60s;
-        proxy_read_timeout 60s;
+        proxy_send_timeout {{or .ReadTimeout "60s"}};
+        proxy_read_timeout {{or .ReadTimeout "60s"}};
+{{- if or .BufferingOff .ProxyBuffers .ProxyBufferSize}}
+
+        # Response buffering
+{{- if .BufferingOff}}
+        proxy_buffering off;
+{{- end}}
+{{- if .ProxyBuffers}}
+        proxy_buffers {{.ProxyBuffers}};
+{{- end}}
+{{- if .ProxyBufferSize}}
+        proxy_buffer_size {{.ProxyBufferSize}};
+{{- end}}
+{{- end}}
+{{- if or .NextUpstream .NextUpstreamTries .NextUpstreamTimeout}}
+
+        # Failover to other replicas
+{{- if .NextUpstream}}
+        proxy_next_upstream {{.NextUpstream}};
+{{- end}}
+{{- if .NextUpstreamTries}}
+        proxy_next_upstream_tries {{.NextUpstreamTries}};
+{{- end}}
+{{- if .NextUpstreamTimeout}}
+        proxy_next_upstream_timeout {{.NextUpstreamTimeout}};
+{{- end}}
+{{- end}}
+{{- end}}
+    }
+}
+{{end}}
+{{- range .Redirects}}
+# Alias of {{.Target}}: {{.ContainerName}} ({{.ContainerID}})
+{{- if .Owner}}
+# Owner: {{.Owner}}
+{{- end}}
+server {
+    listen {{if .HTTPS}}443 ssl{{if .HTTP2}} http2{{end}}{{else}}80{{end}};
+{{- if .PlainHTTP}}
+    listen 80;
+{{- end}}
+    server_name {{.Hostname}};
+{{- if .TLSCertFile}}
+
+    ssl_certificate {{.TLSCertFile}};
+    ssl_certificate_key {{.TLSKeyFile}};
+{{- end}}
+{{- if and $.ACMEChallengeAddr .ACME (or (not .HTTPS) .PlainHTTP)}}
+
+    location /.well-known/acme-challenge/ {
+        proxy_pass http://{{$.ACMEChallengeAddr}};
+    }
+{{- end}}
+
+    location / {
+        return 301 {{if .PlainHTTP}}$scheme{{else if .HTTPS}}https{{else}}http{{end}}://{{.Target}}$request_uri;
+    }
+}
+{{end}}
+{{- if .RestartPage}}
+# Restart page, the fallback upstream of routes whose container is gone
+server {
+    listen {{.RestartPage}};
+    default_type text/html;
+    add_header Retry-After ` + restartPageRetry + ` always;
+    add_header Cache-Control no-store always;
+
+    location / {
+        return 503 '<!DOCTYPE html><html><head><meta charset="utf-8"><meta http-equiv="refresh" content="` + restartPageRetry + `"><title>Service restarting</title></head><body style="font-family:sans-serif;text-align:center;padding-top:15vh"><h1>This service is restarting</h1><p>It will be back in a moment, this page reloads on its own.</p></body></html>';
+    }
+}
+{{end}}
+{{if .ACMEOnlyHostnames}}
+# ACME HTTP-01 challenges for HTTPS-only hosts
+server {
+    listen 80;
+    server_name{{range .ACMEOnlyHostnames}} {{.}}{{end}};
+
+    location /.well-known/acme-challenge/ {
+        proxy_pass http://{{.ACMEChallengeAddr}};
+    }
+
+    location / {
+        return 404;
     }
 }
 {{end}}
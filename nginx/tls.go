@@ -0,0 +1,130 @@
+package nginx
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTicketKeysDir is where managed session ticket keys are written
+const DefaultTicketKeysDir = "/etc/nginx/proxy-tickets"
+
+// ticketKeysKept is the number of ticket keys rendered: the newest encrypts new tickets,
+// the older ones still decrypt tickets issued before the last rotations
+const ticketKeysKept = 3
+
+// ticketKeySize is the key size nginx reads for AES256 tickets
+const ticketKeySize = 80
+
+var (
+	// sslSessionCacheRe matches off, none, or builtin[:size] and shared:name:size caches
+	sslSessionCacheRe = regexp.MustCompile(`^(off|none|((builtin(:[1-9][0-9]*)?|shared:[A-Za-z0-9_]+:[1-9][0-9]*[km]?)( |$))+)$`)
+	// sslSessionTimeoutRe matches nginx times such as 10m or 1d
+	sslSessionTimeoutRe = regexp.MustCompile(`^[1-9][0-9]*(ms|s|m|h|d)?$`)
+	// ticketKeyRe matches managed ticket key file names
+	ticketKeyRe = regexp.MustCompile(`^ticket-[0-9]+\.key$`)
+)
+
+// TLSSessions holds global TLS session resumption settings for HTTPS listeners
+// The zero value leaves nginx's defaults
+type TLSSessions struct {
+	Cache   string      // ssl_session_cache, e.g. shared:SSL:10m
+	Timeout string      // ssl_session_timeout, e.g. 1d
+	Tickets *TicketKeys // managed ssl_session_ticket_key files, nil keeps nginx's per-worker keys
+}
+
+// NewTLSSessions validates the session cache and timeout, empty values are left out
+func NewTLSSessions(cache, timeout string, tickets *TicketKeys) (TLSSessions, error) {
+	cache = strings.Join(strings.Fields(cache), " ")
+	if cache != "" && !sslSessionCacheRe.MatchString(cache) {
+		return TLSSessions{}, fmt.Errorf("invalid ssl session cache %q, expected e.g. shared:SSL:10m, builtin or off", cache)
+	}
+	timeout = strings.ToLower(strings.TrimSpace(timeout))
+	if timeout != "" && !sslSessionTimeoutRe.MatchString(timeout) {
+		return TLSSessions{}, fmt.Errorf("invalid ssl session timeout %q, expected a time like 10m or 1d", timeout)
+	}
+	return TLSSessions{Cache: cache, Timeout: timeout, Tickets: tickets}, nil
+}
+
+// TicketKeys manages session ticket key files in a directory, shared by all nginx workers
+// and kept across reloads so tickets survive them
+type TicketKeys struct {
+	Dir string
+}
+
+// Rotate writes a new ticket key, older keys stay until Prune
+func (t *TicketKeys) Rotate() error {
+	if err := os.MkdirAll(t.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create ticket keys dir: %w", err)
+	}
+
+	key := make([]byte, ticketKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate ticket key: %w", err)
+	}
+	path := filepath.Join(t.Dir, "ticket-"+strconv.FormatInt(time.Now().UnixNano(), 10)+".key")
+	// keys are secrets, unlike the configs written with atomicWrite
+	if err := os.WriteFile(path+".tmp", key, 0o600); err != nil {
+		return fmt.Errorf("failed to write ticket key: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to rename ticket key: %w", err)
+	}
+	return nil
+}
+
+// Prune removes the keys beyond the rendered ones, once a config using the newest keys is
+// applied; a failed apply leaves nginx on a config still naming the older keys
+func (t *TicketKeys) Prune() error {
+	names, err := t.names()
+	if err != nil {
+		return err
+	}
+	for _, name := range names[min(len(names), ticketKeysKept):] {
+		if err := os.Remove(filepath.Join(t.Dir, name)); err != nil {
+			return fmt.Errorf("failed to remove old ticket key: %w", err)
+		}
+	}
+	return nil
+}
+
+// Files returns the ticket key files to render, newest first
+// A missing directory returns no keys, they are created by the first rotation
+func (t *TicketKeys) Files() ([]string, error) {
+	names, err := t.names()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, ticketKeysKept)
+	for _, name := range names[:min(len(names), ticketKeysKept)] {
+		files = append(files, filepath.Join(t.Dir, name))
+	}
+	return files, nil
+}
+
+// names lists the ticket key file names, newest first
+func (t *TicketKeys) names() ([]string, error) {
+	entries, err := os.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ticket keys dir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if ticketKeyRe.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	// equal-length nanosecond timestamps sort chronologically as strings
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
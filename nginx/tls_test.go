@@ -0,0 +1,135 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestNewTLSSessions(t *testing.T) {
+	tests := []struct {
+		cache, timeout string
+		wantErr        bool
+	}{
+		{cache: "shared:SSL:10m", timeout: "1d"},
+		{cache: "builtin:1000  shared:SSL:50m"},
+		{cache: "off"},
+		{timeout: "10M"}, // lower-cased to 10m
+		{cache: "shared:SSL", wantErr: true},
+		{cache: "shared:SSL:10m; include /etc/passwd", wantErr: true},
+		{timeout: "1 day", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewTLSSessions(tt.cache, tt.timeout, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewTLSSessions(%q, %q) error = %v, wantErr %t", tt.cache, tt.timeout, err, tt.wantErr)
+		}
+		if err == nil && strings.Contains(got.Cache, "  ") {
+			t.Errorf("Cache = %q, want single spaces", got.Cache)
+		}
+	}
+}
+
+func TestTicketKeysRotate(t *testing.T) {
+	tickets := &TicketKeys{Dir: filepath.Join(t.TempDir(), "tickets")}
+
+	files, err := tickets.Files()
+	if err != nil || len(files) != 0 {
+		t.Fatalf("Files() = %v, %v, want none before the first rotation", files, err)
+	}
+
+	var newest []string
+	for range ticketKeysKept + 2 {
+		if err := tickets.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+		files, err := tickets.Files()
+		if err != nil {
+			t.Fatalf("Files() error = %v", err)
+		}
+		newest = append(newest, files[0])
+	}
+
+	files, err = tickets.Files()
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != ticketKeysKept || files[0] != newest[len(newest)-1] || files[1] != newest[len(newest)-2] {
+		t.Errorf("Files() = %v, want the %d newest of %v first", files, ticketKeysKept, newest)
+	}
+	// old keys stay until the config without them is applied
+	if entries, err := os.ReadDir(tickets.Dir); err != nil || len(entries) != ticketKeysKept+2 {
+		t.Errorf("dir has %d entries before Prune, want every key kept", len(entries))
+	}
+	if err := tickets.Prune(); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	entries, err := os.ReadDir(tickets.Dir)
+	if err != nil || len(entries) != ticketKeysKept {
+		t.Errorf("dir has %d entries, want old keys removed", len(entries))
+	}
+	info, err := os.Stat(files[0])
+	if err != nil || info.Size() != ticketKeySize || info.Mode().Perm() != 0o600 {
+		t.Errorf("ticket key = %v, %v, want %d bytes with mode 0600", info, err, ticketKeySize)
+	}
+}
+
+func TestGenerateTLSSessions(t *testing.T) {
+	tmpDir := t.TempDir()
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(filepath.Join(tmpDir, "stream.conf"), httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	tickets := &TicketKeys{Dir: filepath.Join(tmpDir, "tickets")}
+	if err := tickets.Rotate(); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	sessions, err := NewTLSSessions("shared:SSL:10m", "1d", tickets)
+	if err != nil {
+		t.Fatalf("NewTLSSessions() error = %v", err)
+	}
+	gen.SetOptions(Options{TLSSessions: sessions})
+
+	containers := []docker.ContainerInfo{{Name: "app", IP: "172.17.0.2", HTTPMapping: &docker.HTTPMapping{
+		Hostnames: []string{"app.example.com"}, ContainerPort: 80, HTTPS: true,
+	}}}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// the rotated key encrypts, the previous one still decrypts
+	if err := tickets.Rotate(); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() after rotation error = %v", err)
+	}
+
+	files, err := tickets.Files()
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	content, err := os.ReadFile(httpPath)
+	if err != nil {
+		t.Fatalf("failed to read HTTP config: %v", err)
+	}
+	text := string(content)
+	for _, want := range []string{
+		"ssl_session_cache shared:SSL:10m;",
+		"ssl_session_timeout 1d;",
+		"ssl_session_ticket_key " + files[0] + ";",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("HTTP config missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "ssl_session_ticket_key ") != 2 {
+		t.Errorf("want the new and the previous ticket key:\n%s", text)
+	}
+}
@@ -0,0 +1,86 @@
+package nginx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// transformFunc is the function a transform script defines, called with the containers
+const transformFunc = "transform"
+
+// transformMaxSteps bounds the work of a transform script, a script looping forever fails the generation
+const transformMaxSteps = 10_000_000
+
+// transform runs the TransformScript on containers, see Transform
+func (g *Generator) transform(containers []docker.ContainerInfo) ([]docker.ContainerInfo, error) {
+	return Transform(g.opts.TransformScript, containers, g.log)
+}
+
+// Transform runs the transform script at path on containers and returns the containers it answers,
+// an empty path returns them as they are
+// Containers are passed as dicts keyed like docker.ContainerInfo, e.g. c["HTTPMapping"]["Hostnames"],
+// the script may add, change or drop them before any route is rendered or checked
+func Transform(path string, containers []docker.ContainerInfo, log *lgr.Logger) ([]docker.ContainerInfo, error) {
+	if path == "" {
+		return containers, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transform script: %w", err)
+	}
+
+	thread := &starlark.Thread{
+		Name: "transform",
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Logf("INFO [Generator] transform script: %s", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(transformMaxSteps)
+	predeclared := starlark.StringDict{"json": starjson.Module}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("transform script failed: %w", err)
+	}
+	fn, ok := globals[transformFunc].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("transform script defines no %s(containers) function", transformFunc)
+	}
+
+	input, err := json.Marshal(containers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode containers: %w", err)
+	}
+	decoded, err := starlark.Call(thread, starjson.Module.Members["decode"], starlark.Tuple{starlark.String(input)}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode containers: %w", err)
+	}
+	result, err := starlark.Call(thread, fn, starlark.Tuple{decoded}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("transform script failed: %w", err)
+	}
+	if _, ok := result.(*starlark.List); !ok {
+		return nil, fmt.Errorf("transform script returned %s, expected a list of containers", result.Type())
+	}
+	encoded, err := starlark.Call(thread, starjson.Module.Members["encode"], starlark.Tuple{result}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transformed containers: %w", err)
+	}
+
+	// unknown keys are typos, e.g. "Hostname", that would silently drop a route setting
+	var transformed []docker.ContainerInfo
+	dec := json.NewDecoder(bytes.NewReader([]byte(encoded.(starlark.String))))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&transformed); err != nil {
+		return nil, fmt.Errorf("transform script returned invalid containers: %w", err)
+	}
+	log.Logf("DEBUG [Generator] containers transformed before=%d after=%d", len(containers), len(transformed))
+	return transformed, nil
+}
@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestGenerateTransform(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "transform.star")
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	gen.SetOptions(Options{TransformScript: scriptPath})
+
+	containers := []docker.ContainerInfo{
+		{Name: "staging-web", IP: "172.17.0.2",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"web"}, ContainerPort: 80}},
+		{Name: "tmp-debug", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 9000, ContainerPort: 9000}}},
+		{Name: "db", IP: "172.17.0.4", Mappings: []docker.PortMapping{{ProxyPort: 5432, ContainerPort: 5432}}},
+	}
+	script := `
+def transform(containers):
+    kept = []
+    for c in containers:
+        if c["Name"].startswith("tmp-"):
+            continue
+        if c["HTTPMapping"] and c["Name"].startswith("staging-"):
+            c["HTTPMapping"]["Hostnames"] = [h + ".staging.example.com" for h in c["HTTPMapping"]["Hostnames"]]
+        kept.append(c)
+    return kept
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := gen.Generate(containers)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if http := readConfig(t, httpPath); !strings.Contains(http, "server_name web.staging.example.com;") {
+		t.Errorf("HTTP config missing the transformed hostname:\n%s", http)
+	}
+	stream := readConfig(t, streamPath)
+	if strings.Contains(stream, "9000") || !strings.Contains(stream, "5432") {
+		t.Errorf("stream config should keep db and drop tmp-debug:\n%s", stream)
+	}
+	if len(report.Routes.Containers) != 2 {
+		t.Errorf("report routes = %+v, want the transformed containers", report.Routes.Containers)
+	}
+	if containers[0].HTTPMapping.Hostnames[0] != "web" {
+		t.Error("transform changed the caller's containers")
+	}
+
+	for name, tt := range map[string]struct{ script, want string }{
+		"missing function": {"x = 1", "no transform(containers) function"},
+		"not a list":       {"def transform(containers):\n    return None", "expected a list"},
+		"unknown key":      {"def transform(containers):\n    return [{\"Name\": \"web\", \"Hostname\": \"web\"}]", "invalid containers"},
+		"runtime error":    {"def transform(containers):\n    return containers[10]", "transform script failed"},
+		"endless loop":     {"def transform(containers):\n    for i in range(100000000):\n        pass\n    return containers", "transform script failed"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(scriptPath, []byte(tt.script), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := gen.Generate(containers); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// upstreamZoneRe matches shared memory sizes, e.g. 64k or 1m
+var upstreamZoneRe = regexp.MustCompile(`^([1-9][0-9]*)([km]?)$`)
+
+// minUpstreamZone is the smallest zone nginx accepts, 8 pages of 4k
+const minUpstreamZone = 32 << 10
+
+// DefaultUpstreamZone holds the state of an upstream with a few servers
+const DefaultUpstreamZone = "64k"
+
+// ParseUpstreamZone validates the shared memory zone size of every upstream block
+// The zone shares server state such as failures across workers and makes it readable
+// at runtime; empty and off return an empty size, leaving each worker its own state
+func ParseUpstreamZone(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "off" {
+		return "", nil
+	}
+	match := upstreamZoneRe.FindStringSubmatch(s)
+	if match == nil {
+		return "", fmt.Errorf("invalid upstream zone size %q, expected a size like 64k or off", s)
+	}
+	size, err := strconv.Atoi(match[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream zone size %q: %w", s, err)
+	}
+	switch match[2] {
+	case "k":
+		size <<= 10
+	case "m":
+		size <<= 20
+	}
+	if size < minUpstreamZone {
+		return "", fmt.Errorf("upstream zone size %q is too small, nginx needs at least 32k", s)
+	}
+	return s, nil
+}
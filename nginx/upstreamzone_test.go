@@ -0,0 +1,91 @@
+package nginx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestParseUpstreamZone(t *testing.T) {
+	tests := []struct {
+		input, want string
+		wantErr     bool
+	}{
+		{input: "64k", want: "64k"},
+		{input: " 1M ", want: "1m"},
+		{input: "32768", want: "32768"},
+		{input: "off"},
+		{},
+		{input: "16k", wantErr: true},
+		{input: "64 k", wantErr: true},
+		{input: "64k; include /etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUpstreamZone(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseUpstreamZone(%q) = %q, %v, want %q (error %t)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateUpstreamZone(t *testing.T) {
+	tmpDir := t.TempDir()
+	streamPath := filepath.Join(tmpDir, "stream.conf")
+	httpPath := filepath.Join(tmpDir, "http.conf")
+
+	gen, err := NewGenerator(streamPath, httpPath, lgr.New())
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	containers := []docker.ContainerInfo{
+		{
+			Name: "postgres",
+			IP:   "172.17.0.2",
+			Mappings: []docker.PortMapping{
+				{ProxyPort: 5432, ContainerPort: 5432, Protocol: docker.TCP},
+				{ProxyPort: 53, ContainerPort: 53, Protocol: docker.UDP},
+			},
+		},
+		{
+			Name:      "redis",
+			IP:        "172.17.0.4",
+			Namespace: "team-a",
+			Mappings:  []docker.PortMapping{{ProxyPort: 6379, ContainerPort: 6379, Protocol: docker.TCP}},
+		},
+		{
+			Name:        "web",
+			IP:          "172.17.0.3",
+			HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"app.example.com"}, ContainerPort: 8080},
+		},
+	}
+
+	gen.SetOptions(Options{UpstreamZone: "64k"})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	stream := readConfig(t, streamPath)
+	for _, want := range []string{"upstream tcp_5432 {\n    zone tcp_5432 64k;", "upstream udp_53 {\n    zone udp_53 64k;"} {
+		if !strings.Contains(stream, want) {
+			t.Errorf("stream config missing %q:\n%s", want, stream)
+		}
+	}
+	if http := readConfig(t, httpPath); !strings.Contains(http, "upstream http_app_example_com_28059829 {\n    zone http_app_example_com_28059829 64k;") {
+		t.Errorf("HTTP upstream missing its zone:\n%s", http)
+	}
+
+	if namespace := readConfig(t, NamespacePath(streamPath, "team-a")); !strings.Contains(namespace, "zone tcp_6379 64k;") {
+		t.Errorf("namespace stream config missing the zone:\n%s", namespace)
+	}
+
+	// without a size every worker keeps its own upstream state
+	gen.SetOptions(Options{})
+	if _, err := gen.Generate(containers); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if configs := readConfig(t, streamPath) + readConfig(t, httpPath); strings.Contains(configs, " 64k;") {
+		t.Errorf("configs have upstream zones while disabled:\n%s", configs)
+	}
+}
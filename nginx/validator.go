@@ -1,30 +1,46 @@
 package nginx
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 
 	"github.com/go-pkgz/lgr"
 )
 
 // Validator validates Nginx configuration files
 type Validator struct {
-	log *lgr.Logger
+	validateCmd string
+	log         *lgr.Logger
 }
 
-// NewValidator creates a new Nginx config validator
+// NewValidator creates a new Nginx config validator running 'nginx -t'
 func NewValidator(log *lgr.Logger) *Validator {
-	return &Validator{log: log}
+	return &Validator{validateCmd: "nginx -t", log: log}
 }
 
-// Validate runs 'nginx -t' to validate the configuration
-func (v *Validator) Validate() error {
-	v.log.Logf("DEBUG [Validator] running nginx -t")
+// NewCommandValidator creates a validator running a custom command,
+// e.g. 'nginx -t -c /etc/nginx-b/nginx.conf' for a second instance
+func NewCommandValidator(validateCmd string, log *lgr.Logger) (*Validator, error) {
+	if _, err := SplitCommand(validateCmd); err != nil {
+		return nil, fmt.Errorf("invalid validate command: %w", err)
+	}
+	return &Validator{validateCmd: validateCmd, log: log}, nil
+}
+
+// Validate runs the validation command, 'nginx -t' by default
+// The command is killed when ctx is done, e.g. on shutdown
+func (v *Validator) Validate(ctx context.Context) error {
+	v.log.Logf("DEBUG [Validator] running %s", v.validateCmd)
 
-	//nolint:noctx // validation command, context not needed
-	cmd := exec.Command("nginx", "-t")
+	cmd, err := buildCommandContext(ctx, v.validateCmd)
+	if err != nil {
+		return fmt.Errorf("invalid validate command: %w", err)
+	}
 	output, err := cmd.CombinedOutput()
 
+	if ctx.Err() != nil {
+		return fmt.Errorf("validation interrupted: %w", ctx.Err())
+	}
 	if err != nil {
 		v.log.Logf("ERROR [Validator] validation failed output=%q", string(output))
 		return fmt.Errorf("nginx config invalid: %w\nOutput: %s", err, string(output))
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// asyncQueue is the number of events an Async sink holds before it drops new ones
+const asyncQueue = 256
+
+// Async hands events to a background sender, so callers holding locks, like the pipeline,
+// never wait for slow webhooks; events are sent one at a time in order
+// When the queue is full new events are dropped with a warning
+type Async struct {
+	sink  Sink
+	queue chan asyncEvent
+	log   *lgr.Logger
+}
+
+// asyncEvent is a queued event, or a Flush barrier when done is set
+type asyncEvent struct {
+	ctx   context.Context
+	event Event
+	done  chan struct{}
+}
+
+// NewAsync creates an asynchronous sink sending to sink
+func NewAsync(sink Sink, log *lgr.Logger) *Async {
+	a := &Async{sink: sink, queue: make(chan asyncEvent, asyncQueue), log: log}
+	go a.send()
+	return a
+}
+
+// Notify queues the event, it is sent even if ctx is cancelled meanwhile
+func (a *Async) Notify(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	select {
+	case a.queue <- asyncEvent{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		a.log.Logf("WARN [Notify] event queue full, dropping event type=%s", event.Type)
+	}
+}
+
+// Flush waits until the queued events are sent and flushes the wrapped sink, e.g. before exit
+func (a *Async) Flush(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case a.queue <- asyncEvent{done: done}:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return
+	}
+	if f, ok := a.sink.(interface{ Flush(context.Context) }); ok {
+		f.Flush(ctx)
+	}
+}
+
+// send delivers the queued events for the lifetime of the process
+func (a *Async) send() {
+	for queued := range a.queue {
+		if queued.done != nil {
+			close(queued.done)
+			continue
+		}
+		a.sink.Notify(queued.ctx, queued.event)
+	}
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// blockingSink holds every event until release is closed
+type blockingSink struct {
+	recorder
+	release chan struct{}
+}
+
+func (b *blockingSink) Notify(ctx context.Context, event Event) {
+	<-b.release
+	b.recorder.Notify(ctx, event)
+}
+
+func TestAsync(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	a := NewAsync(sink, lgr.New())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	a.Notify(ctx, Event{Type: "route.added", Message: "app"})
+	a.Notify(ctx, Event{Type: "config.reloaded", Message: "reload"})
+	cancel()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify() waited %s for the sink", elapsed)
+	}
+
+	close(sink.release)
+	a.Flush(context.Background())
+	got := sink.received()
+	if len(got) != 2 || got[0].Message != "app" || got[1].Message != "reload" {
+		t.Errorf("received %+v, want both events in order", got)
+	}
+}
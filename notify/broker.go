@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of events a slow subscriber can fall behind
+const subscriberBuffer = 64
+
+// Broker fans events out to in-process subscribers, e.g. admin API event streams
+// Events are dropped for subscribers whose buffer is full, publishers never block
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+// NewBroker creates a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]struct{})}
+}
+
+// Notify delivers the event to every subscriber
+func (b *Broker) Notify(_ context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default: // subscriber is behind, drop rather than stall the publisher
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events and a function ending the subscription
+// The channel is closed by the cancel function or when the broker is closed
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends all subscriptions
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.closed = true
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	first, cancelFirst := b.Subscribe()
+	second, cancelSecond := b.Subscribe()
+
+	b.Notify(context.Background(), Event{Type: "config.reloaded"})
+	for _, ch := range []<-chan Event{first, second} {
+		if event := <-ch; event.Type != "config.reloaded" || event.Time.IsZero() {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	// a full subscriber does not block the publisher
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.Notify(context.Background(), Event{Type: "alert.firing"})
+	}
+	if len(first) != subscriberBuffer {
+		t.Errorf("buffered %d events, want %d", len(first), subscriberBuffer)
+	}
+
+	cancelFirst()
+	cancelFirst() // safe to call twice
+	if _, ok := <-drain(first); ok {
+		t.Error("cancelled subscription should be closed")
+	}
+
+	b.Close()
+	if _, ok := <-drain(second); ok {
+		t.Error("subscriptions should be closed with the broker")
+	}
+	cancelSecond()
+
+	late, _ := b.Subscribe()
+	if _, ok := <-late; ok {
+		t.Error("subscriptions after Close should be closed")
+	}
+}
+
+// drain discards buffered events and returns the channel once it is empty or closed
+func drain(ch <-chan Event) <-chan Event {
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return ch
+			}
+		default:
+			return ch
+		}
+	}
+}
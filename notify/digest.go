@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// EventDigest is the type of the summaries sent by Digest
+const EventDigest = "notify.digest"
+
+// digestMessages is the number of event messages listed in a summary
+const digestMessages = 20
+
+// Digest batches events of some types over a window and sends one summary for them,
+// e.g. for the reloads of a deployment; other events, such as failures, are sent at once
+// The window starts with the first batched event, a window with one event sends it unchanged
+type Digest struct {
+	sink   Sink
+	window time.Duration
+	types  map[string]bool
+	log    *lgr.Logger
+
+	mu      sync.Mutex
+	pending []Event
+	timer   *time.Timer // flushes pending at the end of the window, nil while nothing is pending
+}
+
+// NewDigest creates a digest sending to sink, batching the events of types over window
+func NewDigest(sink Sink, window time.Duration, types []string, log *lgr.Logger) *Digest {
+	d := &Digest{sink: sink, window: window, types: make(map[string]bool, len(types)), log: log}
+	for _, t := range types {
+		d.types[t] = true
+	}
+	return d
+}
+
+// Notify holds back events of the batched types until the window ends and sends others at once,
+// after the pending summary so the receiver sees events in order
+func (d *Digest) Notify(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if !d.types[event.Type] {
+		d.Flush(ctx)
+		d.sink.Notify(ctx, event)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = append(d.pending, event)
+	if d.timer == nil {
+		d.timer = time.AfterFunc(d.window, func() { d.Flush(context.Background()) })
+	}
+}
+
+// Flush sends the pending events now, e.g. on shutdown
+func (d *Digest) Flush(ctx context.Context) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.mu.Unlock()
+
+	switch len(pending) {
+	case 0:
+		return
+	case 1:
+		d.sink.Notify(ctx, pending[0])
+		return
+	}
+	d.log.Logf("DEBUG [Notify] sending digest events=%d", len(pending))
+	d.sink.Notify(ctx, summarize(pending))
+}
+
+// summarize returns one event counting the events by type and listing their messages
+func summarize(events []Event) Event {
+	counts := make(map[string]int)
+	for _, e := range events {
+		counts[e.Type]++
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	first, last := events[0].Time, events[len(events)-1].Time
+	details := map[string]string{
+		"events": strconv.Itoa(len(events)),
+		"first":  first.Format(time.RFC3339),
+		"last":   last.Format(time.RFC3339),
+	}
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		details[t] = strconv.Itoa(counts[t])
+		parts = append(parts, fmt.Sprintf("%d %s", counts[t], t))
+	}
+
+	messages := make([]string, 0, digestMessages+1)
+	for i, e := range events {
+		if i == digestMessages {
+			messages = append(messages, fmt.Sprintf("... and %d more", len(events)-i))
+			break
+		}
+		messages = append(messages, e.Message)
+	}
+	details["messages"] = strings.Join(messages, "\n")
+
+	return Event{
+		Type:    EventDigest,
+		Time:    last,
+		Message: fmt.Sprintf("%d events since %s: %s", len(events), first.Format(time.RFC3339), strings.Join(parts, ", ")),
+		Details: details,
+	}
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// recorder is a sink keeping the events it receives
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Notify(_ context.Context, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) received() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func TestDigest(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	d := NewDigest(rec, time.Hour, []string{"config.reloaded", "route.added"}, lgr.New())
+
+	// batched events wait for the window
+	d.Notify(ctx, Event{Type: "config.reloaded", Message: "reload 1"})
+	d.Notify(ctx, Event{Type: "route.added", Message: "app added"})
+	d.Notify(ctx, Event{Type: "config.reloaded", Message: "reload 2"})
+	if got := rec.received(); len(got) != 0 {
+		t.Fatalf("received %+v before the window ended, want nothing", got)
+	}
+
+	// a failure sends the summary first, then itself
+	d.Notify(ctx, Event{Type: "config.failed", Message: "nginx -t failed"})
+	got := rec.received()
+	if len(got) != 2 {
+		t.Fatalf("received %d events, want the digest and the failure", len(got))
+	}
+	sum := got[0]
+	if sum.Type != EventDigest || sum.Details["events"] != "3" || sum.Details["config.reloaded"] != "2" || sum.Details["route.added"] != "1" {
+		t.Errorf("unexpected digest %+v", sum)
+	}
+	if sum.Details["messages"] != "reload 1\napp added\nreload 2" {
+		t.Errorf("digest messages = %q", sum.Details["messages"])
+	}
+	if got[1].Type != "config.failed" {
+		t.Errorf("second event = %+v, want the failure", got[1])
+	}
+
+	// a window with one event sends it unchanged
+	d.Notify(ctx, Event{Type: "route.added", Message: "api added"})
+	d.Flush(ctx)
+	if got := rec.received(); len(got) != 3 || got[2].Type != "route.added" || got[2].Message != "api added" {
+		t.Errorf("received %+v, want the single event as is", got)
+	}
+	d.Flush(ctx)
+	if got := rec.received(); len(got) != 3 {
+		t.Errorf("empty flush sent %+v", got[3:])
+	}
+}
+
+func TestDigestWindow(t *testing.T) {
+	rec := &recorder{}
+	d := NewDigest(rec, 20*time.Millisecond, []string{"config.reloaded"}, lgr.New())
+	for range 30 {
+		d.Notify(context.Background(), Event{Type: "config.reloaded", Message: "reload"})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := rec.received()
+	if len(got) != 1 || got[0].Type != EventDigest || got[0].Details["events"] != "30" {
+		t.Fatalf("received %+v, want one digest of 30 events", got)
+	}
+	// messages are capped, the rest is counted
+	if msgs := got[0].Details["messages"]; len(msgs) == 0 || msgs[len(msgs)-len("... and 10 more"):] != "... and 10 more" {
+		t.Errorf("digest messages = %q, want the first 20 and a remainder", msgs)
+	}
+}
@@ -0,0 +1,162 @@
+// Package notify sends proxy events to webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Event is the JSON body posted to webhooks
+type Event struct {
+	Type    string            `json:"type"` // e.g. alert.firing, alert.resolved
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Sink receives events, e.g. webhooks or admin API subscribers
+type Sink interface {
+	Notify(ctx context.Context, event Event)
+}
+
+// Multi sends every event to each of its sinks in order
+type Multi []Sink
+
+// Notify sends the event to all sinks
+func (m Multi) Notify(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, sink := range m {
+		sink.Notify(ctx, event)
+	}
+}
+
+// Flush sends the events held back by sinks like Digest, e.g. before exit
+func (m Multi) Flush(ctx context.Context) {
+	for _, sink := range m {
+		if f, ok := sink.(interface{ Flush(context.Context) }); ok {
+			f.Flush(ctx)
+		}
+	}
+}
+
+// Notifier posts events to a list of webhook URLs
+type Notifier struct {
+	urls   []string
+	client *http.Client
+	log    *lgr.Logger
+}
+
+// New creates a notifier for urls, without urls events are dropped
+func New(urls []string, log *lgr.Logger) *Notifier {
+	return NewWithTimeout(urls, 10*time.Second, log)
+}
+
+// NewWithTimeout creates a notifier like New whose requests time out after timeout
+func NewWithTimeout(urls []string, timeout time.Duration, log *lgr.Logger) *Notifier {
+	return &Notifier{
+		urls:   urls,
+		client: &http.Client{Timeout: timeout},
+		log:    log,
+	}
+}
+
+// Enabled reports whether any webhook is configured
+func (n *Notifier) Enabled() bool {
+	return len(n.urls) > 0
+}
+
+// Notify posts the event to every webhook, failures are logged and not retried
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	if !n.Enabled() {
+		return
+	}
+	if err := n.Send(ctx, event); err != nil {
+		n.log.Logf("WARN [Notify] webhook failed type=%s error=%q", event.Type, err)
+	}
+}
+
+// Send posts the event to every webhook and returns the failures, e.g. for hooks that must succeed
+func (n *Notifier) Send(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var errs []error
+	for _, url := range n.urls {
+		if err := n.post(ctx, url, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", redactURL(url), err))
+			continue
+		}
+		n.log.Logf("DEBUG [Notify] webhook sent url=%s type=%s", redactURL(url), event.Type)
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // best effort error detail
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// ParseURLs splits a comma-separated webhook list and checks every URL is http(s) with a host
+func ParseURLs(value string) ([]string, error) {
+	var urls []string
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q, expected http:// or https:// and a host", redactURL(raw))
+		}
+		urls = append(urls, raw)
+	}
+	return urls, nil
+}
+
+// redactURL drops the path and query of a webhook URL for logging,
+// chat webhooks carry their token in the path
+func redactURL(url string) string {
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return "<invalid>"
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	host, _, _ = strings.Cut(host, "?")
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	return scheme + "://" + host + "/..."
+}
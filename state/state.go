@@ -0,0 +1,235 @@
+// Package state persists the routes applied by the last successful generation
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+// Snapshot is the persisted view of routes from the last successful generation
+type Snapshot struct {
+	GeneratedAt time.Time   `json:"generated_at"`
+	Containers  []Container `json:"containers"`
+
+	// Report summarizes the generation, nil in state files of older versions
+	Report *Report `json:"report,omitempty"`
+}
+
+// Report is the persisted summary of a generation, container names by change
+type Report struct {
+	Added     []string       `json:"added,omitempty"`
+	Removed   []string       `json:"removed,omitempty"`
+	Changed   []string       `json:"changed,omitempty"`
+	Relabeled []string       `json:"relabeled,omitempty"`
+	Skipped   []SkippedRoute `json:"skipped,omitempty"`
+	Denied    []SkippedRoute `json:"denied,omitempty"`
+	Warmups   []WarmupResult `json:"warmups,omitempty"`
+}
+
+// SkippedRoute is a container, or one route of it, left out of the generation
+type SkippedRoute struct {
+	Container string `json:"container"`
+	Route     string `json:"route,omitempty"` // empty when the whole container is skipped
+	Reason    string `json:"reason"`
+}
+
+// WarmupResult is the outcome of a warm-up request to an added route
+type WarmupResult struct {
+	Container string        `json:"container"`
+	Route     string        `json:"route"`
+	OK        bool          `json:"ok"`
+	Detail    string        `json:"detail"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Names returns the names of containers, e.g. the Added of Changes for a Report
+func Names(containers []Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, ctr := range containers {
+		names = append(names, ctr.Name)
+	}
+	return names
+}
+
+// Container holds the routes published for one container
+type Container struct {
+	Name   string   `json:"name"`
+	ID     string   `json:"id"`
+	Routes []string `json:"routes"`           // e.g. "tcp:80 -> 172.17.0.2:8080", "http:api.example.com -> 172.17.0.3:8080", "ssh:db -> 172.17.0.4:22"
+	Labels string   `json:"labels,omitempty"` // checksum of the proxy.* labels, empty in state files of older versions
+
+	// Owner is the workload responsible for the routes, nil for routes not read from Docker
+	Owner *docker.Owner `json:"owner,omitempty"`
+}
+
+// Changes describes the difference between two snapshots, keyed by container name
+type Changes struct {
+	Added   []Container
+	Removed []Container
+	Changed []Container // containers present in both with different routes (new routes)
+
+	// Relabeled are containers with the same routes whose proxy labels changed, e.g. auth or
+	// headers; their configs change while the routes do not
+	Relabeled []Container
+}
+
+// Empty reports whether there are no changes
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 && len(c.Relabeled) == 0
+}
+
+// FromContainers builds a snapshot from discovered containers
+func FromContainers(containers []docker.ContainerInfo) *Snapshot {
+	snap := &Snapshot{
+		GeneratedAt: time.Now().UTC(),
+		Containers:  make([]Container, 0, len(containers)),
+	}
+
+	for _, ctr := range containers {
+		container := Container{
+			Name:   ctr.Name,
+			ID:     ctr.ID,
+			Routes: Routes(ctr),
+			Labels: ctr.LabelsHash,
+		}
+		if ctr.Owner != (docker.Owner{}) {
+			owner := ctr.Owner
+			container.Owner = &owner
+		}
+		snap.Containers = append(snap.Containers, container)
+	}
+
+	sort.Slice(snap.Containers, func(i, j int) bool {
+		return snap.Containers[i].Name < snap.Containers[j].Name
+	})
+
+	return snap
+}
+
+// Routes returns the sorted route descriptions for a container
+func Routes(ctr docker.ContainerInfo) []string {
+	routes := make([]string, 0, len(ctr.Mappings))
+
+	for _, mapping := range ctr.Mappings {
+		proto := "tcp"
+		if mapping.Protocol == docker.UDP {
+			proto = "udp"
+		}
+		routes = append(routes, fmt.Sprintf("%s:%d -> %s", proto, mapping.ProxyPort,
+			net.JoinHostPort(ctr.IP, strconv.Itoa(mapping.ContainerPort))))
+	}
+
+	for _, mapping := range ctr.AllHTTPMappings() {
+		for _, hostname := range mapping.Hostnames {
+			target := net.JoinHostPort(ctr.IP, strconv.Itoa(mapping.PortFor(hostname)))
+			switch {
+			case mapping.StaticRoot != "":
+				target = "static:" + mapping.StaticRoot
+			case mapping.Socket != "":
+				target = "unix:" + mapping.Socket
+			}
+			routes = append(routes, fmt.Sprintf("http:%s -> %s", hostname, target))
+		}
+		for _, alias := range mapping.Aliases {
+			routes = append(routes, fmt.Sprintf("http:%s -> redirect:%s", alias, mapping.Primary()))
+		}
+	}
+
+	if ctr.SSH != nil {
+		target := net.JoinHostPort(ctr.IP, strconv.Itoa(ctr.SSH.ContainerPort))
+		for _, alias := range ctr.SSH.Aliases {
+			routes = append(routes, fmt.Sprintf("ssh:%s -> %s", alias, target))
+		}
+	}
+
+	sort.Strings(routes)
+	return routes
+}
+
+// Load reads a snapshot from disk
+// A missing file returns an empty snapshot, not an error
+func Load(path string) (*Snapshot, error) {
+	// #nosec G304 -- path is from trusted configuration, not user input
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// Save writes the snapshot atomically
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmpFile := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		_ = os.Remove(tmpFile) //nolint:errcheck // best effort cleanup
+		return fmt.Errorf("failed to rename state file: %w", err)
+	}
+	return nil
+}
+
+// Diff compares the previous snapshot with the current one
+func Diff(previous, current *Snapshot) Changes {
+	prev := make(map[string]Container, len(previous.Containers))
+	for _, ctr := range previous.Containers {
+		prev[ctr.Name] = ctr
+	}
+
+	var changes Changes
+	seen := make(map[string]bool, len(current.Containers))
+	for _, ctr := range current.Containers {
+		seen[ctr.Name] = true
+		old, ok := prev[ctr.Name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, ctr)
+		case !equalRoutes(old.Routes, ctr.Routes):
+			changes.Changed = append(changes.Changed, ctr)
+		case old.Labels != "" && ctr.Labels != old.Labels:
+			changes.Relabeled = append(changes.Relabeled, ctr)
+		}
+	}
+
+	for _, ctr := range previous.Containers {
+		if !seen[ctr.Name] {
+			changes.Removed = append(changes.Removed, ctr)
+		}
+	}
+
+	return changes
+}
+
+func equalRoutes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/moontechs/proxy/docker"
+)
+
+func TestRoutes(t *testing.T) {
+	ctr := docker.ContainerInfo{
+		Name: "app",
+		IP:   "172.17.0.2",
+		Mappings: []docker.PortMapping{
+			{ProxyPort: 53, ContainerPort: 5353, Protocol: docker.UDP},
+			{ProxyPort: 22, ContainerPort: 2222, Protocol: docker.TCP},
+		},
+		HTTPMapping: &docker.HTTPMapping{Hostnames: []string{"app.example.com"}, ContainerPort: 8080},
+		SSH:         &docker.SSHMapping{Aliases: []string{"app-shell"}, ContainerPort: 22},
+	}
+
+	got := Routes(ctr)
+	want := []string{
+		"http:app.example.com -> 172.17.0.2:8080",
+		"ssh:app-shell -> 172.17.0.2:22",
+		"tcp:22 -> 172.17.0.2:2222",
+		"udp:53 -> 172.17.0.2:5353",
+	}
+	if !equalRoutes(got, want) {
+		t.Errorf("Routes() = %v, want %v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := &Snapshot{Containers: []Container{
+		{Name: "kept", Routes: []string{"tcp:22 -> 172.17.0.2:22"}},
+		{Name: "changed", Routes: []string{"tcp:80 -> 172.17.0.3:80"}},
+		{Name: "gone", Routes: []string{"tcp:5432 -> 172.17.0.4:5432"}},
+		{Name: "relabeled", Routes: []string{"tcp:6379 -> 172.17.0.6:6379"}, Labels: "aaaa"},
+		{Name: "upgraded", Routes: []string{"tcp:3306 -> 172.17.0.7:3306"}}, // state of an older version
+	}}
+	current := &Snapshot{Containers: []Container{
+		{Name: "kept", Routes: []string{"tcp:22 -> 172.17.0.2:22"}},
+		{Name: "changed", Routes: []string{"tcp:80 -> 172.17.0.9:80"}},
+		{Name: "new", Routes: []string{"http:new.example.com -> 172.17.0.5:80"}},
+		{Name: "relabeled", Routes: []string{"tcp:6379 -> 172.17.0.6:6379"}, Labels: "bbbb"},
+		{Name: "upgraded", Routes: []string{"tcp:3306 -> 172.17.0.7:3306"}, Labels: "cccc"},
+	}}
+
+	changes := Diff(previous, current)
+
+	if len(changes.Added) != 1 || changes.Added[0].Name != "new" {
+		t.Errorf("Added = %+v, want [new]", changes.Added)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0].Name != "gone" {
+		t.Errorf("Removed = %+v, want [gone]", changes.Removed)
+	}
+	if len(changes.Changed) != 1 || changes.Changed[0].Name != "changed" {
+		t.Errorf("Changed = %+v, want [changed]", changes.Changed)
+	}
+	if len(changes.Relabeled) != 1 || changes.Relabeled[0].Name != "relabeled" {
+		t.Errorf("Relabeled = %+v, want [relabeled]", changes.Relabeled)
+	}
+	if Diff(current, current).Empty() != true {
+		t.Error("diff of identical snapshots should be empty")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	t.Run("missing file loads empty snapshot", func(t *testing.T) {
+		snap, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(snap.Containers) != 0 {
+			t.Errorf("expected empty snapshot, got %+v", snap)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		snap := FromContainers([]docker.ContainerInfo{
+			{Name: "b", ID: "2", IP: "172.17.0.3", Mappings: []docker.PortMapping{{ProxyPort: 80, ContainerPort: 80}}},
+			{Name: "a", ID: "1", IP: "172.17.0.2", Owner: docker.Owner{Project: "shop", Image: "shop:1.4"}},
+		})
+		if err := snap.Save(path); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		loaded, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(loaded.Containers) != 2 || loaded.Containers[0].Name != "a" {
+			t.Errorf("unexpected loaded snapshot %+v", loaded)
+		}
+		if owner := loaded.Containers[0].Owner; owner == nil || owner.Image != "shop:1.4" || loaded.Containers[1].Owner != nil {
+			t.Errorf("owners = %+v, %+v, want a's image and none for b", owner, loaded.Containers[1].Owner)
+		}
+		if !Diff(snap, loaded).Empty() {
+			t.Error("loaded snapshot should equal saved snapshot")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/nginx"
+)
+
+var unsafeNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Resolver resolves vault: label references by writing the secret to a file for nginx
+// Other references are passed to the fallback resolver
+type Resolver struct {
+	client   *Client
+	dir      string
+	fallback nginx.SecretResolver
+	log      *lgr.Logger
+}
+
+// NewResolver creates a resolver materializing Vault secrets into dir
+func NewResolver(client *Client, dir string, fallback nginx.SecretResolver, log *lgr.Logger) *Resolver {
+	return &Resolver{client: client, dir: dir, fallback: fallback, log: log}
+}
+
+// Resolve returns a file containing the referenced secret
+// The file is rewritten only when the secret changed
+func (r *Resolver) Resolve(value string) (string, error) {
+	ref, ok, err := ParseRef(value)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return r.fallback.Resolve(value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	content, err := r.client.Field(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(r.dir, fileName(ref))
+	// #nosec G304 -- path is built from the configured dir and a sanitized name
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, content) {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil { //nolint:gosec // nginx workers need to traverse the dir
+		return "", fmt.Errorf("failed to create vault secrets dir: %w", err)
+	}
+	if err := writeFile(path, content); err != nil {
+		return "", err
+	}
+
+	r.log.Logf("INFO [Vault] secret written ref=%s path=%s", ref, path)
+	return path, nil
+}
+
+// fileName builds a stable, collision-free file name for a reference
+func fileName(ref Ref) string {
+	sum := sha256.Sum256([]byte(ref.String()))
+	return unsafeNameRe.ReplaceAllString(ref.Path+"_"+ref.Field, "_") + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// writeFile writes data to a temp file in the same directory and renames it into place
+func writeFile(path string, data []byte) error {
+	tmpFile := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		_ = os.Remove(tmpFile) //nolint:errcheck // best effort cleanup
+		return fmt.Errorf("failed to rename %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package vault reads secrets referenced by labels from HashiCorp Vault
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// RefPrefix marks label values that reference Vault, e.g. vault:secret/data/app#cert
+const RefPrefix = "vault:"
+
+// Ref points at one field of a Vault secret
+type Ref struct {
+	Path  string // API path without /v1/, e.g. secret/data/app
+	Field string
+}
+
+// ParseRef parses a vault:<path>#<field> reference
+// Returns false for values that are not Vault references
+func ParseRef(s string) (Ref, bool, error) {
+	if !strings.HasPrefix(s, RefPrefix) {
+		return Ref{}, false, nil
+	}
+	path, field, ok := strings.Cut(strings.TrimPrefix(s, RefPrefix), "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || field == "" {
+		return Ref{}, true, fmt.Errorf("invalid vault reference %q, expected vault:<path>#<field>", s)
+	}
+	return Ref{Path: path, Field: field}, true, nil
+}
+
+// String returns the reference in label format
+func (r Ref) String() string {
+	return RefPrefix + r.Path + "#" + r.Field
+}
+
+// Client reads secrets over the Vault HTTP API and caches them for their lease duration
+type Client struct {
+	addr       string
+	token      string // static token, used when tokenFile is empty
+	tokenFile  string // token sink, e.g. written by Vault Agent, re-read on every request
+	defaultTTL time.Duration
+	http       *http.Client
+	log        *lgr.Logger
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	data    map[string]any
+	expires time.Time
+}
+
+// NewClient creates a Vault client
+// Secrets without a lease (KV) are re-read after defaultTTL
+func NewClient(addr, token, tokenFile string, defaultTTL time.Duration, log *lgr.Logger) (*Client, error) {
+	if addr == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if token == "" && tokenFile == "" {
+		return nil, errors.New("vault token or token file is required")
+	}
+	if defaultTTL <= 0 {
+		defaultTTL = 5 * time.Minute
+	}
+
+	return &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		token:      token,
+		tokenFile:  tokenFile,
+		defaultTTL: defaultTTL,
+		http:       &http.Client{Timeout: 10 * time.Second},
+		log:        log,
+		now:        time.Now,
+		cache:      make(map[string]cached),
+	}, nil
+}
+
+// Field returns the value of one secret field
+func (c *Client) Field(ctx context.Context, ref Ref) ([]byte, error) {
+	data, err := c.Read(ctx, ref.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	val, ok := data[ref.Field]
+	if !ok {
+		return nil, fmt.Errorf("field %q not found in %s", ref.Field, ref.Path)
+	}
+	str, ok := val.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %q in %s is not a string", ref.Field, ref.Path)
+	}
+	return []byte(str), nil
+}
+
+// Read returns the data of a secret, from cache while its lease is valid
+// If Vault is unreachable after the lease ended, the stale value is kept so nginx
+// keeps serving with the last known secret
+func (c *Client) Read(ctx context.Context, path string) (map[string]any, error) {
+	c.mu.Lock()
+	entry, ok := c.cache[path]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.data, nil
+	}
+
+	data, ttl, err := c.fetch(ctx, path)
+	if err != nil {
+		if ok {
+			c.log.Logf("WARN [Vault] refresh failed, using cached secret path=%s error=%q", path, err)
+			return entry.data, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[path] = cached{data: data, expires: c.now().Add(ttl)}
+	c.mu.Unlock()
+
+	c.log.Logf("DEBUG [Vault] secret read path=%s ttl=%s", path, ttl)
+	return data, nil
+}
+
+// fetch reads a secret from the API, unwrapping KV v2 responses
+func (c *Client) fetch(ctx context.Context, path string) (map[string]any, time.Duration, error) {
+	token, err := c.currentToken()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.addr+"/v1/"+path, http.NoBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // best effort error detail
+		return nil, 0, fmt.Errorf("vault read %s failed: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		LeaseDuration int            `json:"lease_duration"`
+		Data          map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	data := secret.Data
+	// KV v2 nests the secret under data.data next to data.metadata
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+
+	ttl := c.defaultTTL
+	if secret.LeaseDuration > 0 {
+		// refresh well before the lease expires
+		ttl = time.Duration(secret.LeaseDuration) * time.Second * 2 / 3
+	}
+	return data, ttl, nil
+}
+
+func (c *Client) currentToken() (string, error) {
+	if c.tokenFile == "" {
+		return c.token, nil
+	}
+	// #nosec G304 -- token file path is from trusted configuration
+	data, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
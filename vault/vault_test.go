@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/moontechs/proxy/nginx"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Ref
+		isVault bool
+		wantErr bool
+	}{
+		{in: "vault:secret/data/app#cert", want: Ref{Path: "secret/data/app", Field: "cert"}, isVault: true},
+		{in: "vault:/kv/app/#htpasswd", want: Ref{Path: "kv/app", Field: "htpasswd"}, isVault: true},
+		{in: "app_cert", isVault: false},
+		{in: "vault:secret/data/app", isVault: true, wantErr: true},
+		{in: "vault:#cert", isVault: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, isVault, err := ParseRef(tt.in)
+			if (err != nil) != tt.wantErr || isVault != tt.isVault {
+				t.Fatalf("ParseRef() = %v, %v, %v", got, isVault, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientCaching(t *testing.T) {
+	var requests atomic.Int32
+	value := atomic.Value{}
+	value.Store("cert-v1")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/data/app": // KV v2
+			_, _ = w.Write([]byte(`{"lease_duration":0,"data":{"data":{"cert":"` + value.Load().(string) + `"},"metadata":{"version":1}}}`))
+		case "/v1/kv/app": // KV v1 with a lease
+			_, _ = w.Write([]byte(`{"lease_duration":60,"data":{"htpasswd":"user:hash"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, "s.test", "", time.Minute, lgr.New())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	got, err := client.Field(ctx, Ref{Path: "secret/data/app", Field: "cert"})
+	if err != nil || string(got) != "cert-v1" {
+		t.Fatalf("Field() = %q, %v", got, err)
+	}
+	if _, err := client.Field(ctx, Ref{Path: "kv/app", Field: "htpasswd"}); err != nil {
+		t.Fatalf("Field() KV v1 error = %v", err)
+	}
+
+	// cached within ttl
+	value.Store("cert-v2")
+	got, _ = client.Field(ctx, Ref{Path: "secret/data/app", Field: "cert"})
+	if string(got) != "cert-v1" || requests.Load() != 2 {
+		t.Errorf("expected cached value, got %q after %d requests", got, requests.Load())
+	}
+
+	// refreshed after ttl
+	now = now.Add(2 * time.Minute)
+	got, _ = client.Field(ctx, Ref{Path: "secret/data/app", Field: "cert"})
+	if string(got) != "cert-v2" {
+		t.Errorf("expected rotated value, got %q", got)
+	}
+
+	// stale value kept when vault is unreachable
+	srv.Close()
+	now = now.Add(2 * time.Minute)
+	got, err = client.Field(ctx, Ref{Path: "secret/data/app", Field: "cert"})
+	if err != nil || string(got) != "cert-v2" {
+		t.Errorf("expected stale value on outage, got %q, %v", got, err)
+	}
+
+	if _, err := client.Field(ctx, Ref{Path: "secret/data/missing", Field: "cert"}); err == nil {
+		t.Error("expected error for uncached secret during outage")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"data":{"htpasswd":"user:hash"},"metadata":{}}}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, "s.test", "", time.Minute, lgr.New())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "vault")
+	resolver := NewResolver(client, dir, nginx.DirSecrets{Dir: "/run/secrets"}, lgr.New())
+
+	path, err := resolver.Resolve("vault:secret/data/app#htpasswd")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "user:hash" {
+		t.Errorf("materialized secret = %q, %v", data, err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("secret written outside vault dir: %s", path)
+	}
+
+	path, err = resolver.Resolve("app_htpasswd")
+	if err != nil || path != "/run/secrets/app_htpasswd" {
+		t.Errorf("fallback Resolve() = %s, %v", path, err)
+	}
+}